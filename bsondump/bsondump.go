@@ -3,12 +3,15 @@ package bsondump
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/util"
+	"github.com/mongodb/mongo-tools/mongoexport"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 	"os"
@@ -33,14 +36,36 @@ type BSONDump struct {
 	bsonSource *db.BSONSource
 }
 
-// Open opens the relevant file for reading. It returns a
-// non-nil error if it is unable to open the file.
+// gzipSuffix is appended to the name of the .bson files mongodump --gzip
+// writes.
+const gzipSuffix = ".gz"
+
+// Open opens the relevant file for reading, decompressing it if its name
+// ends in .gz. It returns a non-nil error if it is unable to open the file.
 func (bd *BSONDump) Open() error {
+	gzipped := strings.HasSuffix(bd.FileName, gzipSuffix)
+	if gzipped && bd.BSONDumpOptions.Follow {
+		return fmt.Errorf("--follow can not be used with gzipped file %v", bd.FileName)
+	}
 	file, err := os.Open(bd.FileName)
 	if err != nil {
 		return fmt.Errorf("couldn't open BSON file: %v", err)
 	}
-	bd.bsonSource = db.NewBSONSource(file)
+	var input io.ReadCloser = file
+	if gzipped {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("couldn't decompress gzipped BSON file: %v", err)
+		}
+		input = readCloser{gzipReader, file}
+	}
+	in, err := bd.windowInput(input)
+	if err != nil {
+		input.Close()
+		return err
+	}
+	bd.bsonSource = db.NewBSONSource(in)
 	return nil
 }
 
@@ -106,6 +131,72 @@ func (bd *BSONDump) JSON() (int, error) {
 	return numFound, nil
 }
 
+// csvFields returns the fields to write as CSV columns.
+func (bd *BSONDump) csvFields() ([]string, error) {
+	if bd.BSONDumpOptions.Fields != "" {
+		if bd.BSONDumpOptions.FieldFile != "" {
+			return nil, fmt.Errorf("incompatible options: --fields and --fieldFile")
+		}
+		return strings.Split(bd.BSONDumpOptions.Fields, ","), nil
+	}
+	if bd.BSONDumpOptions.FieldFile != "" {
+		return util.GetFieldsFromFile(bd.BSONDumpOptions.FieldFile)
+	}
+	return nil, fmt.Errorf("CSV output requires a field list")
+}
+
+// CSV iterates through the BSON file and writes the given fields of each
+// document it finds as a CSV row, formatted the same way as mongoexport's CSV
+// output, after a header row naming the fields.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) CSV() (int, error) {
+	numFound := 0
+
+	if bd.bsonSource == nil {
+		panic("Tried to call CSV() before opening file")
+	}
+
+	fields, err := bd.csvFields()
+	if err != nil {
+		return 0, err
+	}
+
+	decodedStream := db.NewDecodedBSONSource(bd.bsonSource)
+	defer decodedStream.Close()
+
+	csvOut := mongoexport.NewCSVExportOutput(fields, bd.Out)
+	if err = csvOut.WriteHeader(); err != nil {
+		return 0, err
+	}
+
+	var result bson.Raw
+	for decodedStream.Next(&result) {
+		decodedDoc := bson.M{}
+		err := bson.Unmarshal(result.Data, &decodedDoc)
+		if err == nil {
+			err = csvOut.ExportDocument(decodedDoc)
+		}
+		if err != nil {
+			log.Logf(log.Always, "unable to dump document %v: %v", numFound+1, err)
+
+			//if objcheck is turned on, stop now. otherwise keep on dumpin'
+			if bd.BSONDumpOptions.ObjCheck {
+				csvOut.Flush()
+				return numFound, err
+			}
+		}
+		numFound++
+	}
+	if err := csvOut.Flush(); err != nil {
+		return numFound, err
+	}
+	if err := decodedStream.Err(); err != nil {
+		return numFound, err
+	}
+	return numFound, nil
+}
+
 // Debug iterates through the BSON file and for each document it finds,
 // recursively descends into objects and arrays and prints a human readable
 // BSON representation containing the type and size of each field.
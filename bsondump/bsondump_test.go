@@ -0,0 +1,81 @@
+package bsondump
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a BSON file", t, func() {
+		dir, err := ioutil.TempDir("", "bsondump_csv")
+		So(err, ShouldBeNil)
+		bsonFile := filepath.Join(dir, "people.bson")
+		writeBSONFile(bsonFile,
+			bson.M{"name": "Ada", "address": bson.M{"city": "London", "zip": "N1"}, "tags": []string{"a", "b"}},
+			bson.M{"name": "Smith, \"Bob\"", "address": bson.M{"city": "New\nYork"}},
+			bson.M{"other": 1},
+		)
+
+		out := &bytes.Buffer{}
+		bd := &BSONDump{
+			BSONDumpOptions: &BSONDumpOptions{},
+			FileName:        bsonFile,
+			Out:             out,
+		}
+
+		Convey("the selected fields should be written as columns, after a header", func() {
+			bd.BSONDumpOptions.Fields = "name,address.city,tags"
+			So(bd.Open(), ShouldBeNil)
+			numFound, err := bd.CSV()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 3)
+			So(out.String(), ShouldEqual, "name,address.city,tags\n"+
+				"Ada,London,\"[\"\"a\"\",\"\"b\"\"]\"\n"+
+				"\"Smith, \"\"Bob\"\"\",\"New\nYork\",\n"+
+				",,\n")
+		})
+
+		Convey("a nested document should be written as JSON", func() {
+			bd.BSONDumpOptions.Fields = "address"
+			So(bd.Open(), ShouldBeNil)
+			_, err := bd.CSV()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldStartWith, "address\n\"{\"\"city\"\":\"\"London\"\",\"\"zip\"\":\"\"N1\"\"}\"\n")
+		})
+
+		Convey("the fields should be read from the --fieldFile", func() {
+			fieldFile := filepath.Join(dir, "fields.txt")
+			So(ioutil.WriteFile(fieldFile, []byte("address.zip\nname\n"), 0644), ShouldBeNil)
+			bd.BSONDumpOptions.FieldFile = fieldFile
+			So(bd.Open(), ShouldBeNil)
+			_, err := bd.CSV()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldStartWith, "address.zip,name\nN1,Ada\n")
+		})
+
+		Convey("--fields and --fieldFile together should be refused", func() {
+			bd.BSONDumpOptions.Fields = "name"
+			bd.BSONDumpOptions.FieldFile = "fields.txt"
+			_, err := bd.csvFields()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a field list should be required", func() {
+			_, err := bd.csvFields()
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package bsondump
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dumpFile is a .bson file of a dump directory to convert to JSON.
+type dumpFile struct {
+	// namespace of the collection the file holds, from the dump's layout
+	namespace string
+	// path of the .bson file, and of the .json file written for it
+	in, out string
+}
+
+// dumpFileResult is the outcome of converting one file of a dump directory.
+type dumpFileResult struct {
+	file     dumpFile
+	numFound int
+	err      error
+}
+
+// IsDirectory returns true if the file to dump is a directory.
+func (bd *BSONDump) IsDirectory() bool {
+	info, err := os.Stat(bd.FileName)
+	return err == nil && info.IsDir()
+}
+
+// dumpFiles returns the .bson files under the dump directory, gzipped or
+// not, each with the namespace it holds and the path of its .json file in
+// the --outDir, at the same place in the layout as in the dump. The
+// database of a file is the directory it is in, unless it is at the top of
+// the dump directory, as in the directory of a single database.
+func (bd *BSONDump) dumpFiles() ([]dumpFile, error) {
+	outDir := bd.BSONDumpOptions.OutDir
+	if outDir == "" {
+		outDir = bd.FileName
+	}
+	files := []dumpFile{}
+	err := filepath.Walk(bd.FileName, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		suffix := ".bson"
+		if strings.HasSuffix(info.Name(), ".bson"+gzipSuffix) {
+			suffix += gzipSuffix
+		} else if !strings.HasSuffix(info.Name(), suffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(bd.FileName, path)
+		if err != nil {
+			return err
+		}
+		namespace := strings.TrimSuffix(info.Name(), suffix)
+		if dir := filepath.Dir(rel); dir != "." {
+			namespace = filepath.Base(dir) + "." + namespace
+		}
+		files = append(files, dumpFile{
+			namespace: namespace,
+			in:        path,
+			out:       filepath.Join(outDir, strings.TrimSuffix(rel, suffix)+".json"),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading dump directory %v: %v", bd.FileName, err)
+	}
+	return files, nil
+}
+
+// DumpDirectory converts every .bson or .bson.gz file under the dump
+// directory to a .json file, with --numParallelFiles files converted at once. A file that
+// fails to convert doesn't stop the others; its partial .json file is
+// removed and the error returned lists every file that failed.
+// It returns the number of documents converted.
+func (bd *BSONDump) DumpDirectory() (int, error) {
+	files, err := bd.dumpFiles()
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no .bson files found in %v", bd.FileName)
+	}
+
+	workers := bd.BSONDumpOptions.NumParallelFiles
+	if workers < 1 {
+		workers = 1
+	}
+	fileChan := make(chan dumpFile)
+	resultChan := make(chan dumpFileResult)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range fileChan {
+				numFound, err := bd.dumpFile(file)
+				resultChan <- dumpFileResult{file, numFound, err}
+			}
+		}()
+	}
+	go func() {
+		for _, file := range files {
+			fileChan <- file
+		}
+		close(fileChan)
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	numFound := 0
+	failed := []string{}
+	for result := range resultChan {
+		numFound += result.numFound
+		if result.err != nil {
+			log.Logf(log.Always, "failed to convert %v (%v): %v", result.file.namespace, result.file.in, result.err)
+			failed = append(failed, fmt.Sprintf("%v: %v", result.file.in, result.err))
+			continue
+		}
+		log.Logf(log.Info, "converted %v documents of %v to %v",
+			result.numFound, result.file.namespace, result.file.out)
+	}
+	log.Logf(log.Always, "converted %v of %v files", len(files)-len(failed), len(files))
+	if len(failed) > 0 {
+		return numFound, fmt.Errorf("%v of %v files failed to convert:\n\t%v",
+			len(failed), len(files), strings.Join(failed, "\n\t"))
+	}
+	return numFound, nil
+}
+
+// dumpFile converts one .bson file to JSON, removing its .json file if the
+// conversion fails.
+func (bd *BSONDump) dumpFile(file dumpFile) (numFound int, err error) {
+	if err = os.MkdirAll(filepath.Dir(file.out), 0755); err != nil {
+		return 0, fmt.Errorf("error creating directory for %v: %v", file.out, err)
+	}
+	out, err := os.Create(file.out)
+	if err != nil {
+		return 0, fmt.Errorf("error creating %v: %v", file.out, err)
+	}
+	defer func() {
+		if closeErr := out.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error writing %v: %v", file.out, closeErr)
+		}
+		if err != nil {
+			os.Remove(file.out)
+		}
+	}()
+
+	writer := bufio.NewWriter(out)
+	fileDump := &BSONDump{
+		ToolOptions:     bd.ToolOptions,
+		BSONDumpOptions: bd.BSONDumpOptions,
+		FileName:        file.in,
+		Out:             writer,
+	}
+	if err = fileDump.Open(); err != nil {
+		return 0, err
+	}
+	numFound, err = fileDump.JSON()
+	if err != nil {
+		return numFound, err
+	}
+	if err = writer.Flush(); err != nil {
+		return numFound, fmt.Errorf("error writing %v: %v", file.out, err)
+	}
+	return numFound, nil
+}
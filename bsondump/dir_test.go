@@ -0,0 +1,123 @@
+package bsondump
+
+import (
+	"compress/gzip"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeBSONFile writes the documents to a .bson file, gzipping it if its
+// name ends in .gz.
+func writeBSONFile(path string, docs ...bson.M) {
+	So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+	file, err := os.Create(path)
+	So(err, ShouldBeNil)
+	defer file.Close()
+	var out io.Writer = file
+	if strings.HasSuffix(path, gzipSuffix) {
+		gzipWriter := gzip.NewWriter(file)
+		defer gzipWriter.Close()
+		out = gzipWriter
+	}
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		So(err, ShouldBeNil)
+		_, err = out.Write(data)
+		So(err, ShouldBeNil)
+	}
+}
+
+func TestDumpDirectory(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a dump directory", t, func() {
+		dumpDir, err := ioutil.TempDir("", "bsondump_dir")
+		So(err, ShouldBeNil)
+		writeBSONFile(filepath.Join(dumpDir, "db1", "a.bson"), bson.M{"_id": 1}, bson.M{"_id": 2})
+		writeBSONFile(filepath.Join(dumpDir, "db1", "b.bson.gz"), bson.M{"_id": 3})
+		writeBSONFile(filepath.Join(dumpDir, "db2", "c.bson"), bson.M{"_id": 4})
+		So(ioutil.WriteFile(filepath.Join(dumpDir, "db1", "a.metadata.json"), []byte("{}"), 0644), ShouldBeNil)
+
+		bd := &BSONDump{
+			BSONDumpOptions: &BSONDumpOptions{NumParallelFiles: 2},
+			FileName:        dumpDir,
+		}
+
+		Convey("its .bson files, gzipped or not, should be found with their namespaces", func() {
+			files, err := bd.dumpFiles()
+			So(err, ShouldBeNil)
+			namespaces := []string{}
+			for _, file := range files {
+				namespaces = append(namespaces, file.namespace)
+			}
+			sort.Strings(namespaces)
+			So(namespaces, ShouldResemble, []string{"db1.a", "db1.b", "db2.c"})
+		})
+
+		Convey("every file should be converted to JSON next to it", func() {
+			numFound, err := bd.DumpDirectory()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 4)
+			contents, err := ioutil.ReadFile(filepath.Join(dumpDir, "db1", "a.json"))
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "{\"_id\":1}\n{\"_id\":2}\n")
+			contents, err = ioutil.ReadFile(filepath.Join(dumpDir, "db1", "b.json"))
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "{\"_id\":3}\n")
+		})
+
+		Convey("with --outDir, the files should be laid out there as in the dump", func() {
+			outDir, err := ioutil.TempDir("", "bsondump_out")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(outDir)
+			bd.BSONDumpOptions.OutDir = outDir
+			_, err = bd.DumpDirectory()
+			So(err, ShouldBeNil)
+			_, err = os.Stat(filepath.Join(outDir, "db2", "c.json"))
+			So(err, ShouldBeNil)
+			_, err = os.Stat(filepath.Join(dumpDir, "db2", "c.json"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("a corrupt file shouldn't stop the others, and leave no .json file", func() {
+			So(ioutil.WriteFile(filepath.Join(dumpDir, "db2", "bad.bson"), []byte{0xff, 0xff, 0xff, 0x7f, 1}, 0644), ShouldBeNil)
+			numFound, err := bd.DumpDirectory()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "1 of 4 files failed to convert")
+			So(err.Error(), ShouldContainSubstring, "bad.bson")
+			So(numFound, ShouldEqual, 4)
+			_, err = os.Stat(filepath.Join(dumpDir, "db2", "bad.json"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+			_, err = os.Stat(filepath.Join(dumpDir, "db2", "c.json"))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("--follow should be refused for a gzipped file", func() {
+			bd.BSONDumpOptions.Follow = true
+			bd.FileName = filepath.Join(dumpDir, "db1", "b.bson.gz")
+			So(bd.Open(), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dumpDir)
+		})
+	})
+
+	Convey("A directory without .bson files should fail to convert", t, func() {
+		emptyDir, err := ioutil.TempDir("", "bsondump_empty")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(emptyDir)
+		bd := &BSONDump{BSONDumpOptions: &BSONDumpOptions{}, FileName: emptyDir}
+		_, err = bd.DumpDirectory()
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,155 @@
+package bsondump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"io"
+	"time"
+)
+
+// followInterval is how long --follow waits before looking for more data
+// at the end of the file.
+const followInterval = 500 * time.Millisecond
+
+// followReader reads a file that is still being written, such as one
+// mongodump is writing, waiting for more data at its end instead of
+// returning io.EOF.
+type followReader struct {
+	in       io.Reader
+	interval time.Duration
+}
+
+func (fr *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := fr.in.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		time.Sleep(fr.interval)
+	}
+}
+
+// readDocument reads the next whole BSON document. At the end of the input
+// it returns io.EOF, or, if only part of a document is left, that part and
+// io.ErrUnexpectedEOF.
+func readDocument(in io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	n, err := io.ReadFull(in, header)
+	if err != nil {
+		return header[:n], err
+	}
+	size := int32(binary.LittleEndian.Uint32(header))
+	if size < 5 || size > db.MaxMessageSize {
+		return nil, fmt.Errorf("invalid BSON document size: %v bytes", size)
+	}
+	doc := make([]byte, size)
+	copy(doc, header)
+	n, err = io.ReadFull(in, doc[4:])
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return doc[:4+n], err
+}
+
+// headReader passes on only the first documents of its input, for --head.
+type headReader struct {
+	in        io.Reader
+	remaining int
+	buf       bytes.Buffer
+	err       error
+}
+
+func (hr *headReader) Read(p []byte) (int, error) {
+	if hr.buf.Len() == 0 {
+		if hr.err != nil {
+			return 0, hr.err
+		}
+		if hr.remaining == 0 {
+			return 0, io.EOF
+		}
+		doc, err := hr.readDocument()
+		hr.buf.Write(doc)
+		hr.err = err
+		if hr.buf.Len() == 0 {
+			return 0, hr.err
+		}
+	}
+	return hr.buf.Read(p)
+}
+
+// readDocument reads the next document, leaving a truncated one for the
+// BSON source to report.
+func (hr *headReader) readDocument() ([]byte, error) {
+	doc, err := readDocument(hr.in)
+	if err == io.ErrUnexpectedEOF {
+		return doc, io.EOF
+	}
+	if err != nil {
+		return doc, err
+	}
+	hr.remaining--
+	return doc, nil
+}
+
+// tailDocuments reads its input to the end, returning a reader of its last
+// count documents, followed by what is left of a document being written.
+// Only the last count documents are held in memory.
+func tailDocuments(in io.Reader, count int) (io.Reader, error) {
+	// a ring of the last documents read, the oldest at next once it's full
+	docs := make([][]byte, 0, count)
+	next := 0
+	var partial []byte
+	for {
+		doc, err := readDocument(in)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			partial = doc
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(docs) < count {
+			docs = append(docs, doc)
+		} else {
+			docs[next] = doc
+			next = (next + 1) % count
+		}
+	}
+	readers := make([]io.Reader, 0, len(docs)+1)
+	for i := range docs {
+		readers = append(readers, bytes.NewReader(docs[(next+i)%len(docs)]))
+	}
+	readers = append(readers, bytes.NewReader(partial))
+	return io.MultiReader(readers...), nil
+}
+
+// readCloser reads from one reader and closes another.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// windowInput limits the file's documents to the --head or --tail, and
+// keeps reading the file as it grows with --follow.
+func (bd *BSONDump) windowInput(file io.ReadCloser) (io.ReadCloser, error) {
+	var in io.Reader = file
+	if bd.BSONDumpOptions.Follow {
+		in = &followReader{file, followInterval}
+	}
+	if bd.BSONDumpOptions.Tail > 0 {
+		tail, err := tailDocuments(file, bd.BSONDumpOptions.Tail)
+		if err != nil {
+			return nil, fmt.Errorf("error reading BSON file: %v", err)
+		}
+		in = io.MultiReader(tail, in)
+	}
+	if bd.BSONDumpOptions.Head > 0 {
+		in = &headReader{in: in, remaining: bd.BSONDumpOptions.Head}
+	}
+	return readCloser{in, file}, nil
+}
@@ -0,0 +1,106 @@
+package bsondump
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// appendDocuments appends the documents with the given _ids to the file.
+func appendDocuments(file *os.File, ids ...int) {
+	for _, id := range ids {
+		data, err := bson.Marshal(bson.M{"_id": id})
+		So(err, ShouldBeNil)
+		_, err = file.Write(data)
+		So(err, ShouldBeNil)
+	}
+}
+
+func TestFollow(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a BSON file still being written", t, func() {
+		file, err := ioutil.TempFile("", "bsondump_follow")
+		So(err, ShouldBeNil)
+		appendDocuments(file, 1, 2)
+
+		out := &bytes.Buffer{}
+		bd := &BSONDump{
+			BSONDumpOptions: &BSONDumpOptions{Follow: true},
+			FileName:        file.Name(),
+			Out:             out,
+		}
+		// dump runs JSON in the background, returning its outcome
+		dump := func() chan int {
+			So(bd.Open(), ShouldBeNil)
+			numFound := make(chan int, 1)
+			go func() {
+				n, _ := bd.JSON()
+				numFound <- n
+			}()
+			return numFound
+		}
+
+		Convey("--follow should output the documents appended, until --head documents were", func() {
+			bd.BSONDumpOptions.Head = 4
+			numFound := dump()
+			time.Sleep(2 * followInterval)
+			So(len(numFound), ShouldEqual, 0)
+
+			appendDocuments(file, 3, 4, 5)
+			select {
+			case n := <-numFound:
+				So(n, ShouldEqual, 4)
+			case <-time.After(10 * followInterval):
+				t.Fatal("--follow didn't stop after --head documents")
+			}
+			So(out.String(), ShouldEqual, "{\"_id\":1}\n{\"_id\":2}\n{\"_id\":3}\n{\"_id\":4}\n")
+		})
+
+		Convey("a document appended in parts should be waited for whole", func() {
+			bd.BSONDumpOptions.Head = 3
+			numFound := dump()
+			data, err := bson.Marshal(bson.M{"_id": 3})
+			So(err, ShouldBeNil)
+			_, err = file.Write(data[:5])
+			So(err, ShouldBeNil)
+			time.Sleep(2 * followInterval)
+			So(len(numFound), ShouldEqual, 0)
+
+			_, err = file.Write(data[5:])
+			So(err, ShouldBeNil)
+			select {
+			case n := <-numFound:
+				So(n, ShouldEqual, 3)
+			case <-time.After(10 * followInterval):
+				t.Fatal("--follow didn't read the document once whole")
+			}
+			So(out.String(), ShouldEqual, "{\"_id\":1}\n{\"_id\":2}\n{\"_id\":3}\n")
+		})
+
+		Convey("--tail should start from the last documents before following", func() {
+			bd.BSONDumpOptions.Tail = 1
+			bd.BSONDumpOptions.Head = 2
+			numFound := dump()
+			appendDocuments(file, 3)
+			select {
+			case n := <-numFound:
+				So(n, ShouldEqual, 2)
+			case <-time.After(10 * followInterval):
+				t.Fatal("--follow didn't stop after --head documents")
+			}
+			So(out.String(), ShouldEqual, "{\"_id\":2}\n{\"_id\":3}\n")
+		})
+
+		Reset(func() {
+			file.Close()
+			os.Remove(file.Name())
+		})
+	})
+}
@@ -0,0 +1,287 @@
+package bsondump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// maxNestingDepth is the deepest level of embedded documents and arrays
+// that the server accepts.
+const maxNestingDepth = 100
+
+// maxIdDisplayLength is the longest _id, in bytes of JSON, that is printed
+// in full when identifying a document.
+const maxIdDisplayLength = 64
+
+// lintMetadata is used to read the index keys out of a collection's
+// metadata.json file, if one exists alongside the BSON file.
+type lintMetadata struct {
+	Indexes []struct {
+		Key bson.D `json:"key"`
+	} `json:"indexes"`
+}
+
+// indexedFields returns the field paths that are part of an index on the
+// collection being linted. The _id field is always included; any other index
+// keys are read from the metadata.json file next to the BSON file.
+func (bd *BSONDump) indexedFields() []string {
+	fields := []string{"_id"}
+	if !strings.HasSuffix(bd.FileName, ".bson") {
+		return fields
+	}
+	metadataFileName := strings.TrimSuffix(bd.FileName, ".bson") + ".metadata.json"
+	jsonBytes, err := ioutil.ReadFile(metadataFileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Logf(log.Always, "unable to read metadata file %v: %v", metadataFileName, err)
+		}
+		return fields
+	}
+	meta := lintMetadata{}
+	if err = json.Unmarshal(jsonBytes, &meta); err != nil {
+		log.Logf(log.Always, "unable to parse metadata file %v: %v", metadataFileName, err)
+		return fields
+	}
+	seen := map[string]bool{"_id": true}
+	for _, index := range meta.Indexes {
+		for _, key := range index.Key {
+			// text and hashed index keys are not subject to the key size limit
+			if key.Value == "text" || key.Value == "hashed" || seen[key.Name] {
+				continue
+			}
+			seen[key.Name] = true
+			fields = append(fields, key.Name)
+		}
+	}
+	log.Logf(log.DebugLow, "checking index key sizes for fields %v", fields)
+	return fields
+}
+
+// Lint iterates through the BSON file and reports any documents that
+// would be rejected by, or behave differently on, a stricter target server:
+// documents over the configured size threshold, index keys over the index
+// key size limit, field names containing '.' or starting with '$', and
+// documents nested deeper than the server allows.
+// It returns the number of documents processed and a non-nil error if any
+// issues are found or an error is encountered reading the file.
+func (bd *BSONDump) Lint() (int, error) {
+	numFound := 0
+	numIssues := 0
+
+	if bd.bsonSource == nil {
+		panic("Tried to call Lint() before opening file")
+	}
+
+	defer bd.bsonSource.Close()
+
+	indexFields := bd.indexedFields()
+
+	reusableBuf := make([]byte, db.MaxBSONSize)
+	for {
+		hasDoc, docSize := bd.bsonSource.LoadNextInto(reusableBuf)
+		if !hasDoc {
+			break
+		}
+		numFound++
+
+		issues, err := lintDocument(reusableBuf[0:docSize], indexFields, bd.BSONDumpOptions)
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("invalid BSON: %v", err))
+		}
+		if len(issues) == 0 {
+			continue
+		}
+		numIssues += len(issues)
+		docName := describeDocument(reusableBuf[0:docSize], numFound)
+		for _, issue := range issues {
+			if _, err = fmt.Fprintf(bd.Out, "%v: %v\n", docName, issue); err != nil {
+				return numFound, err
+			}
+		}
+	}
+
+	if err := bd.bsonSource.Err(); err != nil {
+		return numFound, err
+	}
+	if numIssues > 0 {
+		return numFound, fmt.Errorf("lint found %v issue(s)", numIssues)
+	}
+	return numFound, nil
+}
+
+// describeDocument returns a label for a document, made from its position in
+// the file and its _id when one can be decoded.
+func describeDocument(data []byte, position int) string {
+	idDoc := struct {
+		Id interface{} `bson:"_id"`
+	}{}
+	if err := bson.Unmarshal(data, &idDoc); err != nil || idDoc.Id == nil {
+		return fmt.Sprintf("document #%v", position)
+	}
+	extendedId, err := bsonutil.ConvertBSONValueToJSON(idDoc.Id)
+	if err != nil {
+		return fmt.Sprintf("document #%v", position)
+	}
+	idBytes, err := json.Marshal(extendedId)
+	if err != nil {
+		return fmt.Sprintf("document #%v", position)
+	}
+	// keep oversized _id values from swamping the output
+	if len(idBytes) > maxIdDisplayLength {
+		idBytes = append(idBytes[:maxIdDisplayLength], "..."...)
+	}
+	return fmt.Sprintf("document #%v (_id: %s)", position, idBytes)
+}
+
+// lintDocument returns a description of each portability issue found in the
+// given raw BSON document.
+func lintDocument(data []byte, indexFields []string, opts *BSONDumpOptions) ([]string, error) {
+	var issues []string
+	if opts.MaxDocSize > 0 && len(data) > opts.MaxDocSize {
+		issues = append(issues, fmt.Sprintf("document size %v bytes exceeds threshold of %v bytes",
+			len(data), opts.MaxDocSize))
+	}
+
+	var rawD bson.RawD
+	if err := bson.Unmarshal(data, &rawD); err != nil {
+		return issues, err
+	}
+
+	fieldIssues, err := lintFieldNames(rawD, "", 1)
+	if err != nil {
+		return issues, err
+	}
+	issues = append(issues, fieldIssues...)
+
+	if opts.MaxIndexKeySize > 0 {
+		for _, field := range indexFields {
+			values, err := findFieldValues(rawD, strings.Split(field, "."))
+			if err != nil {
+				return issues, err
+			}
+			for _, value := range values {
+				if len(value.Data) > opts.MaxIndexKeySize {
+					issues = append(issues, fmt.Sprintf(
+						"value of indexed field '%v' is %v bytes, exceeding the index key limit of %v bytes",
+						field, len(value.Data), opts.MaxIndexKeySize))
+				}
+			}
+		}
+	}
+	return issues, nil
+}
+
+// lintFieldNames recursively checks the field names of a document for dots,
+// leading dollar signs, and excessive nesting.
+func lintFieldNames(rawD bson.RawD, prefix string, depth int) ([]string, error) {
+	var issues []string
+	if depth > maxNestingDepth {
+		return []string{fmt.Sprintf("field '%v' is nested more than %v levels deep",
+			strings.TrimSuffix(prefix, "."), maxNestingDepth)}, nil
+	}
+	for _, elem := range rawD {
+		path := prefix + elem.Name
+		switch {
+		case elem.Name == "":
+			issues = append(issues, fmt.Sprintf("field '%v' has an empty name", path))
+		case strings.HasPrefix(elem.Name, "$") && !isDBRefField(elem.Name):
+			issues = append(issues, fmt.Sprintf("field name '%v' starts with '$'", path))
+		case strings.Contains(elem.Name, "."):
+			issues = append(issues, fmt.Sprintf("field name '%v' contains '.'", path))
+		}
+
+		// recurse into embedded documents and arrays
+		if elem.Value.Kind == 0x03 || elem.Value.Kind == 0x04 {
+			subDoc, err := elements(elem.Value)
+			if err != nil {
+				return issues, err
+			}
+			subIssues, err := lintFieldNames(subDoc, path+".", depth+1)
+			if err != nil {
+				return issues, err
+			}
+			issues = append(issues, subIssues...)
+		}
+	}
+	return issues, nil
+}
+
+// elements returns the elements of an embedded document or array. Arrays
+// are encoded as documents keyed by index, but only decode into a RawD when
+// read as a document.
+func elements(value bson.Raw) (bson.RawD, error) {
+	var elems bson.RawD
+	err := bson.Raw{Kind: 0x03, Data: value.Data}.Unmarshal(&elems)
+	return elems, err
+}
+
+// isDBRefField reports whether the given field name is one of the
+// dollar-prefixed names that are legal as part of a DBRef.
+func isDBRefField(name string) bool {
+	return name == "$ref" || name == "$id" || name == "$db"
+}
+
+// findFieldValues returns every value stored at the given field path,
+// descending into arrays the same way a multikey index would.
+func findFieldValues(rawD bson.RawD, path []string) ([]bson.Raw, error) {
+	var values []bson.Raw
+	for _, elem := range rawD {
+		if elem.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			if elem.Value.Kind == 0x04 {
+				// each array element is a separate index key
+				elems, err := elements(elem.Value)
+				if err != nil {
+					return nil, err
+				}
+				for _, arrayElem := range elems {
+					values = append(values, arrayElem.Value)
+				}
+			} else {
+				values = append(values, elem.Value)
+			}
+			continue
+		}
+		switch elem.Value.Kind {
+		case 0x03:
+			var subDoc bson.RawD
+			if err := elem.Value.Unmarshal(&subDoc); err != nil {
+				return nil, err
+			}
+			subValues, err := findFieldValues(subDoc, path[1:])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, subValues...)
+		case 0x04:
+			elems, err := elements(elem.Value)
+			if err != nil {
+				return nil, err
+			}
+			for _, arrayElem := range elems {
+				if arrayElem.Value.Kind != 0x03 {
+					continue
+				}
+				var subDoc bson.RawD
+				if err := arrayElem.Value.Unmarshal(&subDoc); err != nil {
+					return nil, err
+				}
+				subValues, err := findFieldValues(subDoc, path[1:])
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, subValues...)
+			}
+		}
+	}
+	return values, nil
+}
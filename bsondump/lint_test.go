@@ -0,0 +1,209 @@
+package bsondump
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lintIssues marshals the document and returns the issues lintDocument
+// finds in it.
+func lintIssues(doc interface{}, indexFields []string, opts *BSONDumpOptions) []string {
+	data, err := bson.Marshal(doc)
+	So(err, ShouldBeNil)
+	issues, err := lintDocument(data, indexFields, opts)
+	So(err, ShouldBeNil)
+	return issues
+}
+
+func TestLintDocument(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	opts := &BSONDumpOptions{MaxDocSize: 16 * 1024 * 1024, MaxIndexKeySize: 16}
+
+	Convey("A portable document should have no issues", t, func() {
+		So(lintIssues(bson.D{{"_id", 1}, {"a", bson.D{{"b", "c"}}}}, []string{"_id"}, opts), ShouldBeEmpty)
+	})
+
+	Convey("Dotted and $-prefixed field names should be reported, at any depth", t, func() {
+		issues := lintIssues(bson.D{
+			{"_id", 1},
+			{"a.b", 1},
+			{"$set", 1},
+			{"nested", bson.D{{"c.d", 1}}},
+			{"list", []interface{}{bson.D{{"$inc", 1}}}},
+		}, nil, opts)
+		So(issues, ShouldResemble, []string{
+			"field name 'a.b' contains '.'",
+			"field name '$set' starts with '$'",
+			"field name 'nested.c.d' contains '.'",
+			"field name 'list.0.$inc' starts with '$'",
+		})
+	})
+
+	Convey("The $ref, $id and $db fields of a DBRef should be allowed", t, func() {
+		issues := lintIssues(bson.D{
+			{"_id", 1},
+			{"owner", bson.D{{"$ref", "users"}, {"$id", 2}, {"$db", "app"}}},
+		}, nil, opts)
+		So(issues, ShouldBeEmpty)
+	})
+
+	Convey("A document nested deeper than the server allows should be reported once", t, func() {
+		var nested interface{} = bson.D{{"leaf", 1}}
+		for i := 0; i < maxNestingDepth; i++ {
+			nested = bson.D{{"n", nested}}
+		}
+		issues := lintIssues(bson.D{{"_id", 1}, {"deep", nested}}, nil, opts)
+		So(len(issues), ShouldEqual, 1)
+		So(issues[0], ShouldStartWith, "field 'deep.n.n.")
+		So(issues[0], ShouldEndWith, "is nested more than 100 levels deep")
+	})
+
+	Convey("A document at the nesting limit should not be reported", t, func() {
+		var nested interface{} = 1
+		for i := 1; i < maxNestingDepth; i++ {
+			nested = bson.D{{"n", nested}}
+		}
+		So(lintIssues(bson.D{{"deep", nested}}, nil, opts), ShouldBeEmpty)
+	})
+
+	Convey("A document over --maxDocSize should be reported", t, func() {
+		issues := lintIssues(bson.D{{"_id", 1}, {"data", strings.Repeat("x", 64)}}, nil,
+			&BSONDumpOptions{MaxDocSize: 32})
+		So(len(issues), ShouldEqual, 1)
+		So(issues[0], ShouldContainSubstring, "exceeds threshold of 32 bytes")
+	})
+
+	Convey("Indexed values over --maxIndexKeySize should be reported", t, func() {
+		long := strings.Repeat("x", 32)
+
+		Convey("for top-level and dotted index keys", func() {
+			issues := lintIssues(bson.D{{"_id", 1}, {"a", bson.D{{"b", long}}}, {"c", long}},
+				[]string{"_id", "a.b"}, opts)
+			So(len(issues), ShouldEqual, 1)
+			So(issues[0], ShouldStartWith, "value of indexed field 'a.b' is")
+		})
+
+		Convey("for each element of an array, as a multikey index would", func() {
+			issues := lintIssues(bson.D{{"_id", 1}, {"tags", []interface{}{"short", long, long}}},
+				[]string{"tags"}, opts)
+			So(len(issues), ShouldEqual, 2)
+		})
+
+		Convey("for fields of documents in an array", func() {
+			issues := lintIssues(bson.D{{"_id", 1},
+				{"items", []interface{}{bson.D{{"sku", "a"}}, bson.D{{"sku", long}}, "scalar"}}},
+				[]string{"items.sku"}, opts)
+			So(len(issues), ShouldEqual, 1)
+		})
+
+		Convey("unless the index key limit is disabled", func() {
+			issues := lintIssues(bson.D{{"_id", long}}, []string{"_id"}, &BSONDumpOptions{})
+			So(issues, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestFindFieldValues(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document holding arrays", t, func() {
+		data, err := bson.Marshal(bson.D{
+			{"a", bson.D{{"b", 1}}},
+			{"tags", []interface{}{"x", "y"}},
+			{"items", []interface{}{bson.D{{"sku", "p"}}, bson.D{{"other", 1}}, bson.D{{"sku", "q"}}}},
+		})
+		So(err, ShouldBeNil)
+		var rawD bson.RawD
+		So(bson.Unmarshal(data, &rawD), ShouldBeNil)
+		valuesOf := func(path string) []interface{} {
+			values, err := findFieldValues(rawD, strings.Split(path, "."))
+			So(err, ShouldBeNil)
+			decoded := []interface{}{}
+			for _, value := range values {
+				var v interface{}
+				So(value.Unmarshal(&v), ShouldBeNil)
+				decoded = append(decoded, v)
+			}
+			return decoded
+		}
+
+		Convey("an embedded field should be found by its dotted path", func() {
+			So(valuesOf("a.b"), ShouldResemble, []interface{}{1})
+		})
+
+		Convey("each element of an array should be a separate value", func() {
+			So(valuesOf("tags"), ShouldResemble, []interface{}{"x", "y"})
+		})
+
+		Convey("the field should be found in each document of an array", func() {
+			So(valuesOf("items.sku"), ShouldResemble, []interface{}{"p", "q"})
+		})
+
+		Convey("a missing field should have no values", func() {
+			So(valuesOf("a.c"), ShouldBeEmpty)
+			So(valuesOf("missing"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestLint(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a BSON file and its metadata", t, func() {
+		dir, err := ioutil.TempDir("", "bsondump_lint")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		bsonFile := filepath.Join(dir, "coll.bson")
+		long := strings.Repeat("x", 32)
+		writeBSONFile(bsonFile,
+			bson.M{"_id": 1, "sku": "ok"},
+			bson.M{"_id": 2, "sku": long},
+			bson.M{"_id": 3, "a.b": 1},
+		)
+		metadata := `{"indexes":[{"key":{"_id":1}},{"key":{"sku":1}},{"key":{"body":"text"}}]}`
+		So(ioutil.WriteFile(filepath.Join(dir, "coll.metadata.json"), []byte(metadata), 0644), ShouldBeNil)
+
+		out := &bytes.Buffer{}
+		bd := &BSONDump{
+			BSONDumpOptions: &BSONDumpOptions{MaxDocSize: 16 * 1024 * 1024, MaxIndexKeySize: 16},
+			FileName:        bsonFile,
+			Out:             out,
+		}
+
+		Convey("the index keys should be read from the metadata, skipping text indexes", func() {
+			So(bd.indexedFields(), ShouldResemble, []string{"_id", "sku"})
+		})
+
+		Convey("each issue should be reported against its document", func() {
+			So(bd.Open(), ShouldBeNil)
+			numFound, err := bd.Lint()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "2 issue(s)")
+			So(numFound, ShouldEqual, 3)
+			So(out.String(), ShouldEqual,
+				"document #2 (_id: 2): value of indexed field 'sku' is 37 bytes, exceeding the index key limit of 16 bytes\n"+
+					"document #3 (_id: 3): field name 'a.b' contains '.'\n")
+		})
+
+		Convey("without a metadata file, only _id should be checked", func() {
+			So(os.Remove(filepath.Join(dir, "coll.metadata.json")), ShouldBeNil)
+			So(bd.indexedFields(), ShouldResemble, []string{"_id"})
+			So(bd.Open(), ShouldBeNil)
+			_, err := bd.Lint()
+			So(err.Error(), ShouldContainSubstring, "1 issue(s)")
+		})
+	})
+}
@@ -56,8 +56,50 @@ func main() {
 
 	log.Logf(log.DebugLow, "running bsondump with --objcheck: %v", bsonDumpOpts.ObjCheck)
 
-	if len(bsonDumpOpts.Type) != 0 && bsonDumpOpts.Type != "debug" && bsonDumpOpts.Type != "json" {
-		log.Logf(log.Always, "Unsupported output type '%v'. Must be either 'debug' or 'json'", bsonDumpOpts.Type)
+	if len(bsonDumpOpts.Type) != 0 && bsonDumpOpts.Type != "debug" && bsonDumpOpts.Type != "json" && bsonDumpOpts.Type != "csv" {
+		log.Logf(log.Always, "Unsupported output type '%v'. Must be either 'debug', 'json' or 'csv'", bsonDumpOpts.Type)
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if bsonDumpOpts.Type == "csv" && bsonDumpOpts.Fields == "" && bsonDumpOpts.FieldFile == "" {
+		log.Logf(log.Always, "--type=csv requires --fields or --fieldFile")
+		log.Logf(log.Always, "try 'bsondump --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+	if bsonDumpOpts.Type != "csv" && (bsonDumpOpts.Fields != "" || bsonDumpOpts.FieldFile != "") {
+		log.Logf(log.Always, "--fields and --fieldFile can only be used with --type=csv")
+		log.Logf(log.Always, "try 'bsondump --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if bsonDumpOpts.Head < 0 || bsonDumpOpts.Tail < 0 {
+		log.Logf(log.Always, "--head and --tail must be positive")
+		log.Logf(log.Always, "try 'bsondump --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+	if bsonDumpOpts.Head > 0 && bsonDumpOpts.Tail > 0 {
+		log.Logf(log.Always, "--head and --tail can't be used together")
+		log.Logf(log.Always, "try 'bsondump --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if dumper.IsDirectory() {
+		if bsonDumpOpts.Type != "json" || bsonDumpOpts.Lint || bsonDumpOpts.Follow {
+			log.Logf(log.Always, "a dump directory can only be converted with --type=json, without --lint or --follow")
+			log.Logf(log.Always, "try 'bsondump --help' for more information")
+			os.Exit(util.ExitBadOptions)
+		}
+		numFound, err := dumper.DumpDirectory()
+		log.Logf(log.Always, "%v objects found", numFound)
+		if err != nil {
+			log.Log(log.Always, err.Error())
+			os.Exit(util.ExitError)
+		}
+		return
+	}
+	if bsonDumpOpts.OutDir != "" {
+		log.Logf(log.Always, "--outDir can only be used to convert a dump directory")
+		log.Logf(log.Always, "try 'bsondump --help' for more information")
 		os.Exit(util.ExitBadOptions)
 	}
 
@@ -68,8 +110,12 @@ func main() {
 	}
 
 	var numFound int
-	if bsonDumpOpts.Type == "debug" {
+	if bsonDumpOpts.Lint {
+		numFound, err = dumper.Lint()
+	} else if bsonDumpOpts.Type == "debug" {
 		numFound, err = dumper.Debug()
+	} else if bsonDumpOpts.Type == "csv" {
+		numFound, err = dumper.CSV()
 	} else {
 		numFound, err = dumper.JSON()
 	}
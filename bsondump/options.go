@@ -1,21 +1,51 @@
 package bsondump
 
-var Usage = `<options> <file>
+var Usage = `<options> <file or dump directory>
 
-View and debug .bson files.
+View and debug .bson files, gzipped or not, or convert every .bson file of a dump directory to JSON.
 
 See http://docs.mongodb.org/manual/reference/program/bsondump/ for more information.`
 
 
 type BSONDumpOptions struct {
 	// Format to display the BSON data file
-	Type string `long:"type" default:"json" default-mask:"-" description:"type of output: debug, json (default 'json')"`
+	Type string `long:"type" default:"json" default-mask:"-" description:"type of output: debug, json, csv (default 'json')"`
+
+	// Fields to write as CSV columns
+	Fields string `long:"fields" short:"f" description:"comma separated list of field names to write as columns (required for --type=csv) e.g. -f \"name,address.city\""`
+
+	// File with the fields to write as CSV columns
+	FieldFile string `long:"fieldFile" description:"file with field names to write as columns - 1 per line"`
 
 	// Validate each BSON document before displaying
 	ObjCheck bool `long:"objcheck" description:"validate BSON during processing"`
 
 	// Display JSON data with indents
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
+
+	// Directory to write the JSON files of a dump directory to
+	OutDir string `long:"outDir" value-name:"<directory>" description:"when converting a dump directory, directory to write the .json files to, laid out as the dump is (defaults to the dump directory)"`
+
+	// Number of files of a dump directory to convert at once
+	NumParallelFiles int `long:"numParallelFiles" short:"j" value-name:"<count>" default:"4" default-mask:"-" description:"when converting a dump directory, number of files to convert in parallel (default 4)"`
+
+	// Only display the first documents
+	Head int `long:"head" value-name:"<count>" description:"only output the first <count> documents"`
+
+	// Only display the last documents
+	Tail int `long:"tail" value-name:"<count>" description:"only output the last <count> documents"`
+
+	// Keep reading as the file grows
+	Follow bool `long:"follow" description:"keep reading documents as they are appended to a file still being written, e.g. by a running mongodump, until interrupted or --head documents have been output"`
+
+	// Report portability issues instead of displaying the BSON data
+	Lint bool `long:"lint" description:"report documents with portability issues (oversized documents or index keys, '.' or '$' in field names) instead of printing them"`
+
+	// Document size above which --lint reports a document
+	MaxDocSize int `long:"maxDocSize" default:"16777216" default-mask:"-" description:"document size in bytes above which --lint reports a document (default 16777216)"`
+
+	// Index key size above which --lint reports an indexed value
+	MaxIndexKeySize int `long:"maxIndexKeySize" default:"1024" default-mask:"-" description:"index key size in bytes above which --lint reports an indexed value (default 1024)"`
 }
 
 func (_ *BSONDumpOptions) Name() string {
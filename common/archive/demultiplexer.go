@@ -3,7 +3,6 @@ package archive
 import (
 	"bytes"
 	"fmt"
-	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"gopkg.in/mgo.v2/bson"
@@ -25,9 +24,13 @@ type Demultiplexer struct {
 	outs               map[string]DemuxOut
 	hashes             map[string]hash.Hash64
 	currentNamespace   string
-	buf                [db.MaxBSONSize]byte
 	NamespaceChan      chan string
 	NamespaceErrorChan chan error
+
+	// BufferSize is the most data buffered for each namespace whose consumer
+	// is behind, DefaultDemuxBufferSize if 0. Once a namespace's buffer is
+	// full, the demultiplexer waits for its consumer to catch up.
+	BufferSize int
 }
 
 // Run creates and runs a parser with the Demultiplexer as a consumer
@@ -96,8 +99,10 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 		}
 	}
 	if colHeader.EOF {
+		_, muted := demux.outs[demux.currentNamespace].(*MutedCollection)
+		// the bodies of muted namespaces are skipped, so aren't checksummed
 		crc := int64(demux.hashes[demux.currentNamespace].Sum64())
-		if crc != colHeader.CRC {
+		if !muted && crc != colHeader.CRC {
 			return fmt.Errorf("CRC mismatch for namespace %v, %v!=%v",
 				demux.currentNamespace,
 				crc,
@@ -151,6 +156,13 @@ func (demux *Demultiplexer) BodyBSON(buf []byte) error {
 	return err
 }
 
+// SkipBody is part of the SkippingConsumer interface. The bodies of muted
+// namespaces are skipped over, rather than read and discarded.
+func (demux *Demultiplexer) SkipBody() bool {
+	_, muted := demux.outs[demux.currentNamespace].(*MutedCollection)
+	return muted
+}
+
 // Open installs the DemuxOut as the handler for data for the namespace ns
 func (demux *Demultiplexer) Open(ns string, out DemuxOut) {
 	// In the current implementation where this is either called before the demultiplexing is running
@@ -167,83 +179,42 @@ func (demux *Demultiplexer) Open(ns string, out DemuxOut) {
 }
 
 // RegularCollectionReceiver implements the intents.file interface.
-// RegularCollectionReceivers get paired with RegularCollectionSenders.
+// RegularCollectionReceivers read their namespace's data from a bounded
+// buffer the Demultiplexer writes it to, so that the Demultiplexer can go on
+// to other namespaces while the receiver's consumer catches up.
 type RegularCollectionReceiver struct {
-	readLenChan      <-chan int
-	readBufChan      chan<- []byte
-	Intent           *intents.Intent
-	Demux            *Demultiplexer
-	partialReadArray [db.MaxBSONSize]byte
-	partialReadBuf   []byte
-	isOpen           bool
+	Intent *intents.Intent
+	Demux  *Demultiplexer
+	buffer *demuxBuffer
 }
 
+// Read is part of the intents.file interface. It reads the namespace's data
+// as the Demultiplexer buffers it, returning io.EOF at its end.
 func (receiver *RegularCollectionReceiver) Read(r []byte) (int, error) {
-	if receiver.partialReadBuf != nil && len(receiver.partialReadBuf) > 0 {
-		wLen := len(receiver.partialReadBuf)
-		copyLen := copy(r, receiver.partialReadBuf)
-		if wLen == copyLen {
-			receiver.partialReadBuf = nil
-		} else {
-			receiver.partialReadBuf = receiver.partialReadBuf[copyLen:]
-		}
-		return copyLen, nil
-	}
-	// Since we're the "reader" here, not the "writer" we need to start with a read, in case the chan is closed
-	wLen, ok := <-receiver.readLenChan
-	if !ok {
-		close(receiver.readBufChan)
-		return 0, io.EOF
+	if receiver.buffer == nil {
+		return 0, fmt.Errorf("read from unopened receiver for %v", receiver.Intent.Namespace())
 	}
-	if wLen > db.MaxBSONSize {
-		return 0, fmt.Errorf("incomming buffer size is too big %v", wLen)
-	}
-	rLen := len(r)
-	if wLen > rLen {
-		// if the incomming write size is larger then the incomming read buffer then we need to accept
-		// the write in a larger buffer, fill the read buffer, then cache the remainder
-		receiver.partialReadBuf = receiver.partialReadArray[:wLen]
-		receiver.readBufChan <- receiver.partialReadBuf
-		writtenLength := <-receiver.readLenChan
-		if wLen != writtenLength {
-			return 0, fmt.Errorf("regularCollectionSender didn't send what it said it would")
-		}
-		copy(r, receiver.partialReadBuf)
-		receiver.partialReadBuf = receiver.partialReadBuf[rLen:]
-		return rLen, nil
-	}
-	// Send the read buff to the BodyBSON ParserConsumer to fill
-	receiver.readBufChan <- r
-	// Receiver the wLen of data written
-	wLen = <-receiver.readLenChan
-	return wLen, nil
+	return receiver.buffer.Read(r)
 }
 
 // Close is part of the intents.file interface. It currently does nothing. We can't close the
-// regularCollectionSender before the embedded stream reaches EOF. If this needs to be
-// implemented, then we need to swap out the regularCollectionSender with a null writer
+// buffer before the embedded stream reaches EOF, as the Demultiplexer would block on it.
 func (receiver *RegularCollectionReceiver) Close() error {
 	return nil
 }
 
-// Open is part of the intents.file interface.  It creates the chan's in the
-// RegularCollectionReceiver and adds the RegularCollectionReceiver to the set of
-// RegularCollectonReceivers in the demultiplexer
+// Open is part of the intents.file interface. It creates the receiver's buffer
+// and registers it with the demultiplexer as the namespace's DemuxOut.
 func (receiver *RegularCollectionReceiver) Open() error {
 	// TODO move this implementation to some non intents.file method, to be called from prioritizer.Get
 	// So that we don't have to enable this double open stuff.
 	// Currently the open needs to finish before the prioritizer.Get finishes, so we open the intents.file
 	// in prioritizer.Get even though it's going to get opened again in DumpIntent.
-	if receiver.isOpen {
+	if receiver.buffer != nil {
 		return nil
 	}
-	readLenChan := make(chan int)
-	readBufChan := make(chan []byte)
-	receiver.readLenChan = readLenChan
-	receiver.readBufChan = readBufChan
-	sender := &regularCollectionSender{readLenChan: readLenChan, readBufChan: readBufChan}
-	receiver.Demux.Open(receiver.Intent.Namespace(), sender)
-	receiver.isOpen = true
+	receiver.buffer = newDemuxBuffer(receiver.Demux.BufferSize)
+	receiver.Demux.Open(receiver.Intent.Namespace(), receiver.buffer)
 	return nil
 }
 
@@ -253,37 +224,6 @@ func (receiver *RegularCollectionReceiver) Write([]byte) (int, error) {
 	return 0, nil
 }
 
-// regularCollectionSender implements DemuxOut
-type regularCollectionSender struct {
-	readLenChan chan<- int
-	readBufChan <-chan []byte
-}
-
-// Write is part of the DemuxOut interface.
-func (sender *regularCollectionSender) Write(buf []byte) (int, error) {
-	//  As a writer, we need to write first, so that the reader can properly detect EOF
-	//  Additionally, the reader needs to know the write size, so that it can give us a
-	//  properly sized buffer. Sending the incomming buffersize fills both of these needs.
-	sender.readLenChan <- len(buf)
-	// Receive from the reader a buffer to put the bytes into
-	readBuf := <-sender.readBufChan
-	if len(readBuf) < len(buf) {
-		return 0, fmt.Errorf("readbuf is not large enough for incoming BodyBSON (%v<%v)",
-			len(readBuf), len(buf))
-	}
-	copy(readBuf, buf)
-	// Send back the length of the data copied in to the buffer
-	sender.readLenChan <- len(buf)
-	return len(buf), nil
-}
-
-// Close is part of the DemuxOut interface. It only closes the readLenChan, as that is what will
-// cause the RegularCollectionReceiver.Read() to receive EOF
-func (sender *regularCollectionSender) Close() error {
-	close(sender.readLenChan)
-	return nil
-}
-
 // SpecialCollectionCache implemnts both DemuxOut as well as intents.file
 type SpecialCollectionCache struct {
 	Intent *intents.Intent
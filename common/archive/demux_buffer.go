@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultDemuxBufferSize is the most data buffered for each namespace being
+// demultiplexed, unless the Demultiplexer's BufferSize says otherwise.
+const DefaultDemuxBufferSize = 16 * 1024 * 1024
+
+// minDemuxBufferSize is the size a namespace's buffer starts at. Buffers
+// grow as they fill, so small namespaces don't take the whole BufferSize.
+const minDemuxBufferSize = 64 * 1024
+
+// demuxBuffer is a bounded ring buffer between the demultiplexer, writing a
+// namespace's data, and the namespace's consumer, reading it. Writes block
+// while the buffer is full, so a slow consumer holds back the demultiplexer
+// rather than letting data pile up, and reads block while it's empty, until
+// the writer closes it.
+type demuxBuffer struct {
+	lock     sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	// data holds length bytes from start, wrapping around its end
+	data          []byte
+	start, length int
+	maxSize       int
+
+	closed bool
+}
+
+// newDemuxBuffer returns an empty demuxBuffer holding up to maxSize bytes.
+func newDemuxBuffer(maxSize int) *demuxBuffer {
+	if maxSize <= 0 {
+		maxSize = DefaultDemuxBufferSize
+	}
+	initialSize := minDemuxBufferSize
+	if initialSize > maxSize {
+		initialSize = maxSize
+	}
+	buffer := &demuxBuffer{data: make([]byte, initialSize), maxSize: maxSize}
+	buffer.notEmpty = sync.NewCond(&buffer.lock)
+	buffer.notFull = sync.NewCond(&buffer.lock)
+	return buffer
+}
+
+// Write copies p into the buffer, blocking while it's full. Data larger
+// than the buffer is handed over in pieces as the reader drains it.
+func (buffer *demuxBuffer) Write(p []byte) (int, error) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	written := 0
+	for written < len(p) {
+		if buffer.closed {
+			return written, io.ErrClosedPipe
+		}
+		if buffer.length == len(buffer.data) {
+			buffer.grow(len(p) - written)
+		}
+		for buffer.length == len(buffer.data) && !buffer.closed {
+			buffer.notFull.Wait()
+		}
+		if buffer.closed {
+			return written, io.ErrClosedPipe
+		}
+		end := (buffer.start + buffer.length) % len(buffer.data)
+		free := len(buffer.data) - buffer.length
+		if end+free > len(buffer.data) {
+			// the free space wraps around; fill up to the end first
+			free = len(buffer.data) - end
+		}
+		n := copy(buffer.data[end:end+free], p[written:])
+		buffer.length += n
+		written += n
+		buffer.notEmpty.Signal()
+	}
+	return written, nil
+}
+
+// grow enlarges a full buffer to make room for more bytes, doubling it up
+// to maxSize. The caller holds the lock.
+func (buffer *demuxBuffer) grow(more int) {
+	size := len(buffer.data)
+	if size >= buffer.maxSize {
+		return
+	}
+	for size < buffer.length+more && size < buffer.maxSize {
+		size *= 2
+	}
+	if size > buffer.maxSize {
+		size = buffer.maxSize
+	}
+	data := make([]byte, size)
+	n := copy(data, buffer.data[buffer.start:])
+	copy(data[n:], buffer.data[:buffer.start])
+	buffer.data = data
+	buffer.start = 0
+}
+
+// Read copies buffered data into p, blocking while the buffer is empty. It
+// returns io.EOF once the buffer is closed and drained.
+func (buffer *demuxBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	for buffer.length == 0 && !buffer.closed {
+		buffer.notEmpty.Wait()
+	}
+	if buffer.length == 0 {
+		// drained, so release the memory
+		buffer.data = nil
+		return 0, io.EOF
+	}
+	available := buffer.length
+	if buffer.start+available > len(buffer.data) {
+		// the data wraps around; read up to the end first
+		available = len(buffer.data) - buffer.start
+	}
+	n := copy(p, buffer.data[buffer.start:buffer.start+available])
+	buffer.start = (buffer.start + n) % len(buffer.data)
+	buffer.length -= n
+	buffer.notFull.Signal()
+	return n, nil
+}
+
+// Close marks the end of the namespace's data. Reads return io.EOF once
+// the buffered data is drained.
+func (buffer *demuxBuffer) Close() error {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	buffer.closed = true
+	buffer.notEmpty.Broadcast()
+	buffer.notFull.Broadcast()
+	return nil
+}
@@ -0,0 +1,91 @@
+package archive
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDemuxBuffer(t *testing.T) {
+
+	Convey("With a small demuxBuffer", t, func() {
+		buffer := newDemuxBuffer(1024)
+
+		Convey("data larger than the buffer should be handed over in order", func() {
+			data := make([]byte, 10*1024+7)
+			for i := range data {
+				data[i] = byte(i * 7)
+			}
+			writeErr := make(chan error, 1)
+			go func() {
+				// write in uneven pieces, so writes wrap around the buffer
+				for rest := data; len(rest) > 0; {
+					n := 300
+					if n > len(rest) {
+						n = len(rest)
+					}
+					if _, err := buffer.Write(rest[:n]); err != nil {
+						writeErr <- err
+						return
+					}
+					rest = rest[n:]
+				}
+				writeErr <- buffer.Close()
+			}()
+
+			read := &bytes.Buffer{}
+			chunk := make([]byte, 257)
+			for {
+				n, err := buffer.Read(chunk)
+				read.Write(chunk[:n])
+				if err == io.EOF {
+					break
+				}
+				So(err, ShouldBeNil)
+				So(len(buffer.data), ShouldBeLessThanOrEqualTo, 1024)
+			}
+			So(<-writeErr, ShouldBeNil)
+			So(read.Bytes(), ShouldResemble, data)
+		})
+
+		Convey("a write should block while the buffer is full", func() {
+			_, err := buffer.Write(make([]byte, 1024))
+			So(err, ShouldBeNil)
+			written := make(chan struct{})
+			go func() {
+				buffer.Write([]byte{1})
+				close(written)
+			}()
+			select {
+			case <-written:
+				t.Fatal("write to a full buffer didn't block")
+			default:
+			}
+			_, err = buffer.Read(make([]byte, 1))
+			So(err, ShouldBeNil)
+			<-written
+			So(buffer.length, ShouldEqual, 1024)
+		})
+
+		Convey("reads should return the data written before it's closed, then EOF", func() {
+			_, err := buffer.Write([]byte("abc"))
+			So(err, ShouldBeNil)
+			So(buffer.Close(), ShouldBeNil)
+			data, err := ioutil.ReadAll(buffer)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "abc")
+			_, err = buffer.Write([]byte("d"))
+			So(err, ShouldEqual, io.ErrClosedPipe)
+		})
+	})
+
+	Convey("A demuxBuffer should start small and grow as it fills", t, func() {
+		buffer := newDemuxBuffer(DefaultDemuxBufferSize)
+		So(len(buffer.data), ShouldEqual, minDemuxBufferSize)
+		_, err := buffer.Write(make([]byte, minDemuxBufferSize*3))
+		So(err, ShouldBeNil)
+		So(len(buffer.data), ShouldEqual, minDemuxBufferSize*4)
+	})
+}
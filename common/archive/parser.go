@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/db"
 	"io"
+	"io/ioutil"
 )
 
 // parser.go implements the parsing of the low-level archive format
@@ -20,6 +21,20 @@ type ParserConsumer interface {
 	End() error
 }
 
+// SkippingConsumer is a ParserConsumer that can have the parser skip over
+// the body of the current block, without reading it into memory or passing
+// it to BodyBSON.
+type SkippingConsumer interface {
+	ParserConsumer
+	SkipBody() bool
+}
+
+// Skipper is implemented by parser inputs that can skip over bytes more
+// cheaply than reading them, such as files that can seek.
+type Skipper interface {
+	Skip(n int64) error
+}
+
 // Parser encapsulates the small amount of state that the parser needs to keep
 type Parser struct {
 	In     io.Reader
@@ -62,38 +77,67 @@ func newParserWrappedError(msg string, err error) error {
 // then the remainder of the BSON document are read in to the parser, otherwise
 // an error is returned.
 func (parse *Parser) readBSONOrTerminator() (isTerminator bool, err error) {
+	size, isTerminator, err := parse.readLengthOrTerminator()
+	if err != nil || isTerminator {
+		return isTerminator, err
+	}
+	// TODO Because we're reusing this same buffer for all of our IO, we are basically guaranteeing that we'll
+	// copy the bytes twice.  At some point we should fix this. It's slightly complex, because we'll need consumer
+	// methods closing one buffer and acquiring another
+	_, err = io.ReadFull(parse.In, parse.buf[4:size])
+	if err != nil {
+		// any error, including EOF is an error so we wrap it up
+		return false, newParserWrappedError("read bson", err)
+	}
+	if parse.buf[size-1] != 0x00 {
+		return false, newParserError(fmt.Sprintf("bson (size: %v, byte: %d) doesn't end with a null byte", size, parse.buf[size-1]))
+	}
+	parse.length = int(size)
+	return false, nil
+}
+
+// readLengthOrTerminator reads four bytes, returning the BSON length they
+// hold, or true if they are a terminator.
+func (parse *Parser) readLengthOrTerminator() (size int32, isTerminator bool, err error) {
 	parse.length = 0
 	_, err = io.ReadFull(parse.In, parse.buf[0:4])
 	if err == io.EOF {
-		return false, err
+		return 0, false, err
 	}
 	if err != nil {
-		return false, newParserWrappedError("I/O error reading length or terminator", err)
+		return 0, false, newParserWrappedError("I/O error reading length or terminator", err)
 	}
-	size := int32(
+	size = int32(
 		(uint32(parse.buf[0]) << 0) |
 			(uint32(parse.buf[1]) << 8) |
 			(uint32(parse.buf[2]) << 16) |
 			(uint32(parse.buf[3]) << 24),
 	)
 	if size == terminator {
-		return true, nil
+		return 0, true, nil
 	}
 	if size < minBSONSize || size > db.MaxBSONSize {
-		return false, newParserError(fmt.Sprintf("%v is neither a valid bson length nor a archive terminator", size))
+		return 0, false, newParserError(fmt.Sprintf("%v is neither a valid bson length nor a archive terminator", size))
 	}
-	// TODO Because we're reusing this same buffer for all of our IO, we are basically guaranteeing that we'll
-	// copy the bytes twice.  At some point we should fix this. It's slightly complex, because we'll need consumer
-	// methods closing one buffer and acquiring another
-	_, err = io.ReadFull(parse.In, parse.buf[4:size])
-	if err != nil {
-		// any error, including EOF is an error so we wrap it up
-		return false, newParserWrappedError("read bson", err)
+	return size, false, nil
+}
+
+// skipBSONOrTerminator is like readBSONOrTerminator, but skips over the
+// BSON rather than reading it in.
+func (parse *Parser) skipBSONOrTerminator() (isTerminator bool, err error) {
+	size, isTerminator, err := parse.readLengthOrTerminator()
+	if err != nil || isTerminator {
+		return isTerminator, err
+	}
+	remaining := int64(size) - 4
+	if skipper, ok := parse.In.(Skipper); ok {
+		err = skipper.Skip(remaining)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, parse.In, remaining)
 	}
-	if parse.buf[size-1] != 0x00 {
-		return false, newParserError(fmt.Sprintf("bson (size: %v, byte: %d) doesn't end with a null byte", size, parse.buf[size-1]))
+	if err != nil {
+		return false, newParserWrappedError("skip bson", err)
 	}
-	parse.length = int(size)
 	return false, nil
 }
 
@@ -111,6 +155,7 @@ func (parse *Parser) ReadAllBlocks(consumer ParserConsumer) (err error) {
 
 // ReadBlock reads one archive block ( header + body* + terminator )
 // calling consumer.HeaderBSON() on the header, consumer.BodyBSON() on each piece of body,
+// unless a SkippingConsumer asks for the body to be skipped,
 // and consumer.EOF() when EOF is encountered before any data was read.
 // It returns nil if a whole block was read, io.EOF if nothing was read,
 // and a parserError if there was any io error in the middle of the block,
@@ -135,14 +180,23 @@ func (parse *Parser) ReadBlock(consumer ParserConsumer) (err error) {
 	if err != nil {
 		return newParserWrappedError("ParserConsumer.HeaderBSON()", err)
 	}
+	skipper, canSkip := consumer.(SkippingConsumer)
+	skip := canSkip && skipper.SkipBody()
 	for {
-		isTerminator, err = parse.readBSONOrTerminator()
+		if skip {
+			isTerminator, err = parse.skipBSONOrTerminator()
+		} else {
+			isTerminator, err = parse.readBSONOrTerminator()
+		}
 		if err != nil { // all errors, including EOF are errors here
 			return newParserWrappedError("ParserConsumer.BodyBSON()", err)
 		}
 		if isTerminator {
 			return nil
 		}
+		if skip {
+			continue
+		}
 		err = consumer.BodyBSON(parse.buf[:parse.length])
 		if err != nil {
 			return newParserWrappedError("ParserConsumer.BodyBSON()", err)
@@ -147,3 +147,62 @@ func TestParsing(t *testing.T) {
 	})
 	return
 }
+
+// skippingTestConsumer is a testConsumer that skips the bodies of blocks
+// with a "skip" header.
+type skippingTestConsumer struct {
+	testConsumer
+}
+
+func (stc *skippingTestConsumer) SkipBody() bool {
+	return stc.headers[len(stc.headers)-1] == "skip"
+}
+
+// countingSkipper counts the bytes skipped through Skip.
+type countingSkipper struct {
+	*bytes.Buffer
+	skipped int64
+}
+
+func (cs *countingSkipper) Skip(n int64) error {
+	cs.skipped += n
+	cs.Next(int(n))
+	return nil
+}
+
+func TestParsingSkippedBodies(t *testing.T) {
+
+	Convey("With a parser and a consumer that skips some blocks", t, func() {
+		stc := &skippingTestConsumer{}
+		buf := &bytes.Buffer{}
+		for _, str := range []string{"skip", "skipped0", "skipped1"} {
+			b, _ := bson.Marshal(strStruct{str})
+			buf.Write(b)
+		}
+		buf.Write(term)
+		for _, str := range []string{"read", "body"} {
+			b, _ := bson.Marshal(strStruct{str})
+			buf.Write(b)
+		}
+		buf.Write(term)
+
+		Convey("skipped bodies should not be passed to the consumer", func() {
+			parser := Parser{In: buf}
+			err := parser.ReadAllBlocks(stc)
+			So(err, ShouldBeNil)
+			So(stc.headers, ShouldResemble, []string{"skip", "read"})
+			So(stc.bodies, ShouldResemble, []string{"body"})
+			So(stc.eof, ShouldBeTrue)
+		})
+
+		Convey("inputs that can skip should skip the bodies themselves", func() {
+			skipper := &countingSkipper{Buffer: buf}
+			parser := Parser{In: skipper}
+			err := parser.ReadAllBlocks(stc)
+			So(err, ShouldBeNil)
+			So(stc.bodies, ShouldResemble, []string{"body"})
+			b, _ := bson.Marshal(strStruct{"skipped0"})
+			So(skipper.skipped, ShouldEqual, 2*(len(b)-4))
+		})
+	})
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// VolumePath returns the path of the given volume of a file split into
+// volumes at path. The first volume, numbered 0, keeps the path, and the
+// rest are numbered path.001, path.002, and so on.
+func VolumePath(path string, volume int) string {
+	if volume == 0 {
+		return path
+	}
+	return fmt.Sprintf("%v.%03d", path, volume)
+}
+
+// HasVolumes returns true if the file at path was split into volumes.
+func HasVolumes(path string) bool {
+	_, err := os.Stat(VolumePath(path, 1))
+	return err == nil
+}
+
+// VolumeReader is an io.ReadCloser reading a file split into volumes back as
+// a single stream, one volume after the other.
+type VolumeReader struct {
+	path    string
+	volume  int
+	current *os.File
+}
+
+// OpenVolumes opens the first volume of the file split into volumes at path.
+func OpenVolumes(path string) (*VolumeReader, error) {
+	first, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &VolumeReader{path: path, current: first}, nil
+}
+
+// Read is part of the io.Reader interface. It moves on to the next volume at
+// the end of each, until there are no more.
+func (vr *VolumeReader) Read(p []byte) (int, error) {
+	for {
+		n, err := vr.current.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		next, openErr := os.Open(VolumePath(vr.path, vr.volume+1))
+		if os.IsNotExist(openErr) {
+			return n, io.EOF
+		}
+		if openErr != nil {
+			return n, openErr
+		}
+		vr.current.Close()
+		vr.volume++
+		vr.current = next
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close is part of the io.Closer interface.
+func (vr *VolumeReader) Close() error {
+	return vr.current.Close()
+}
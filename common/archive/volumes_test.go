@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumeReader(t *testing.T) {
+
+	Convey("With an archive split into volumes on disk", t, func() {
+		dir, err := ioutil.TempDir("", "archive-volumes")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "dump.archive")
+		data := make([]byte, 2500)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		for volume := 0; volume*1024 < len(data); volume++ {
+			end := (volume + 1) * 1024
+			if end > len(data) {
+				end = len(data)
+			}
+			So(ioutil.WriteFile(VolumePath(path, volume), data[volume*1024:end], 0644), ShouldBeNil)
+		}
+
+		Convey("the volumes should be numbered after the first", func() {
+			So(VolumePath(path, 0), ShouldEqual, path)
+			So(VolumePath(path, 2), ShouldEqual, path+".002")
+			So(HasVolumes(path), ShouldBeTrue)
+		})
+
+		Convey("reading the volumes back should return the whole archive", func() {
+			reader, err := OpenVolumes(path)
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(read, data), ShouldBeTrue)
+			So(reader.Close(), ShouldBeNil)
+		})
+	})
+
+	Convey("A file that was not split should have no volumes", t, func() {
+		So(HasVolumes(filepath.Join(os.TempDir(), "no-such-archive")), ShouldBeFalse)
+	})
+}
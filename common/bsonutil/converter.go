@@ -158,6 +158,9 @@ func ConvertBSONValueToJSON(x interface{}) (interface{}, error) {
 	case string:
 		return v, nil // require no conversion
 
+	case json.Number:
+		return v, nil // written as a plain number
+
 	case int:
 		return json.NumberInt(v), nil
 
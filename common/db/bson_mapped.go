@@ -0,0 +1,106 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// MappedBSONSource reads the documents of a BSON file mapped into memory,
+// handing them out as slices of the mapping rather than copies, which saves
+// an allocation and a copy per document. The documents are only valid until
+// the source is closed, and must not be modified.
+type MappedBSONSource struct {
+	data    []byte
+	offset  int
+	maxSize int
+	err     error
+}
+
+// NewMappedBSONSource maps the file into memory, to read its documents of up
+// to maxSize bytes from the file's current offset. It returns an error if
+// the file can't be mapped, for the caller to read it as a stream instead.
+func NewMappedBSONSource(file *os.File, maxSize int) (*MappedBSONSource, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if !info.Mode().IsRegular() || size != int64(int(size)) {
+		return nil, fmt.Errorf("%v can not be mapped into memory", file.Name())
+	}
+	source := &MappedBSONSource{offset: int(offset), maxSize: maxSize}
+	if size > 0 {
+		if source.data, err = mapFile(file, int(size)); err != nil {
+			return nil, fmt.Errorf("error mapping %v into memory: %v", file.Name(), err)
+		}
+	}
+	if source.offset > len(source.data) {
+		source.offset = len(source.data)
+	}
+	return source, nil
+}
+
+// NextDocument returns the next document, as a slice of the mapping. It
+// returns false at the end of the file, or on an error, which Err returns.
+func (ms *MappedBSONSource) NextDocument() ([]byte, bool) {
+	remaining := len(ms.data) - ms.offset
+	if remaining == 0 {
+		ms.err = nil
+		return nil, false
+	}
+	if remaining < 4 {
+		ms.err = fmt.Errorf("invalid bson: %v", io.ErrUnexpectedEOF)
+		return nil, false
+	}
+	bsonSize := int(int32(binary.LittleEndian.Uint32(ms.data[ms.offset:])))
+	if bsonSize < 5 || bsonSize > ms.maxSize {
+		ms.err = fmt.Errorf("invalid BSONSize: %v bytes", bsonSize)
+		return nil, false
+	}
+	if bsonSize > remaining {
+		// a broken document at the end of the file
+		ms.err = fmt.Errorf("invalid bson: %v", io.ErrUnexpectedEOF)
+		return nil, false
+	}
+	doc := ms.data[ms.offset : ms.offset+bsonSize : ms.offset+bsonSize]
+	ms.offset += bsonSize
+	ms.err = nil
+	return doc, true
+}
+
+// LoadNextInto is part of the RawDocSource interface. It copies the next
+// document into the buffer, for callers that need their own copy.
+func (ms *MappedBSONSource) LoadNextInto(into []byte) (bool, int32) {
+	doc, ok := ms.NextDocument()
+	if !ok {
+		return false, 0
+	}
+	if len(doc) > len(into) {
+		ms.err = fmt.Errorf("invalid BSONSize: %v bytes", len(doc))
+		return false, 0
+	}
+	copy(into, doc)
+	return true, int32(len(doc))
+}
+
+// Close unmaps the file, invalidating the documents read from it.
+func (ms *MappedBSONSource) Close() error {
+	if ms.data == nil {
+		return nil
+	}
+	err := unmapFile(ms.data)
+	ms.data = nil
+	ms.offset = 0
+	return err
+}
+
+// Err is part of the RawDocSource interface.
+func (ms *MappedBSONSource) Err() error {
+	return ms.err
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMappedBSONSource(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a BSON file of three documents", t, func() {
+		file, err := ioutil.TempFile("", "mapped_bson_test")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			file.Close()
+			os.Remove(file.Name())
+		})
+		var docs [][]byte
+		for i := 0; i < 3; i++ {
+			doc, err := bson.Marshal(bson.D{{"_id", i}, {"name", "doc"}})
+			So(err, ShouldBeNil)
+			docs = append(docs, doc)
+			_, err = file.Write(doc)
+			So(err, ShouldBeNil)
+		}
+		_, err = file.Seek(0, io.SeekStart)
+		So(err, ShouldBeNil)
+
+		Convey("the mapped documents should be those of the file", func() {
+			source, err := NewMappedBSONSource(file, MaxBSONSize)
+			if err != nil {
+				// platforms without mmap read files as streams
+				SkipSo(err, ShouldBeNil)
+				return
+			}
+			defer source.Close()
+			for _, expected := range docs {
+				doc, ok := source.NextDocument()
+				So(ok, ShouldBeTrue)
+				So(doc, ShouldResemble, expected)
+			}
+			_, ok := source.NextDocument()
+			So(ok, ShouldBeFalse)
+			So(source.Err(), ShouldBeNil)
+		})
+
+		Convey("decoding should read the documents in place", func() {
+			source, err := NewMappedBSONSource(file, MaxBSONSize)
+			if err != nil {
+				SkipSo(err, ShouldBeNil)
+				return
+			}
+			decoded := NewDecodedBSONSourceWithMaxSize(source, MaxMessageSize)
+			defer decoded.Close()
+			result := bson.M{}
+			count := 0
+			for decoded.Next(&result) {
+				So(result["_id"], ShouldEqual, count)
+				count++
+			}
+			So(count, ShouldEqual, 3)
+			So(decoded.Err(), ShouldBeNil)
+		})
+
+		Convey("reading should start at the file's offset", func() {
+			_, err = file.Seek(int64(len(docs[0])), io.SeekStart)
+			So(err, ShouldBeNil)
+			source, err := NewMappedBSONSource(file, MaxBSONSize)
+			if err != nil {
+				SkipSo(err, ShouldBeNil)
+				return
+			}
+			defer source.Close()
+			doc, ok := source.NextDocument()
+			So(ok, ShouldBeTrue)
+			So(doc, ShouldResemble, docs[1])
+		})
+
+		Convey("a truncated document should be an error", func() {
+			So(file.Truncate(int64(len(docs[0])*3-2)), ShouldBeNil)
+			source, err := NewMappedBSONSource(file, MaxBSONSize)
+			if err != nil {
+				SkipSo(err, ShouldBeNil)
+				return
+			}
+			defer source.Close()
+			into := make([]byte, MaxBSONSize)
+			ok, size := source.LoadNextInto(into)
+			So(ok, ShouldBeTrue)
+			So(into[:size], ShouldResemble, docs[0])
+			source.NextDocument()
+			_, ok = source.NextDocument()
+			So(ok, ShouldBeFalse)
+			So(source.Err(), ShouldNotBeNil)
+		})
+	})
+}
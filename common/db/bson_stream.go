@@ -39,7 +39,18 @@ func (bs *BSONSource) Close() error {
 }
 
 func NewDecodedBSONSource(ds RawDocSource) *DecodedBSONSource {
-	return &DecodedBSONSource{make([]byte, MaxBSONSize), ds, nil}
+	return NewDecodedBSONSourceWithMaxSize(ds, MaxBSONSize)
+}
+
+// NewDecodedBSONSourceWithMaxSize returns a DecodedBSONSource that reads
+// documents of up to maxSize bytes, for reading documents over MaxBSONSize
+// so they can be handled by a SizeGuard.
+func NewDecodedBSONSourceWithMaxSize(ds RawDocSource, maxSize int) *DecodedBSONSource {
+	if _, ok := ds.(*MappedBSONSource); ok {
+		// documents are decoded in place from the mapping
+		return &DecodedBSONSource{nil, ds, nil}
+	}
+	return &DecodedBSONSource{make([]byte, maxSize), ds, nil}
 }
 
 // Err returns any error in the DecodedBSONSource or its RawDocSource.
@@ -52,12 +63,23 @@ func (dbs *DecodedBSONSource) Err() error {
 
 // Next unmarshals the next BSON document into result. Returns true if no errors
 // are encountered and false otherwise.
+// Documents decoded as bson.Raw share the source's buffer, or its mapping
+// for a MappedBSONSource, so must be copied to be kept.
 func (dbs *DecodedBSONSource) Next(result interface{}) bool {
-	hasDoc, docSize := dbs.LoadNextInto(dbs.reusableBuf)
-	if !hasDoc {
-		return false
+	var doc []byte
+	if mapped, ok := dbs.RawDocSource.(*MappedBSONSource); ok && dbs.reusableBuf == nil {
+		var hasDoc bool
+		if doc, hasDoc = mapped.NextDocument(); !hasDoc {
+			return false
+		}
+	} else {
+		hasDoc, docSize := dbs.LoadNextInto(dbs.reusableBuf)
+		if !hasDoc {
+			return false
+		}
+		doc = dbs.reusableBuf[0:docSize]
 	}
-	if err := bson.Unmarshal(dbs.reusableBuf[0:docSize], result); err != nil {
+	if err := bson.Unmarshal(doc, result); err != nil {
 		dbs.err = err
 		return false
 	}
@@ -2,10 +2,16 @@ package db
 
 import (
 	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"reflect"
 )
 
+// insertMessageOverhead is the room left in an insert message for its
+// header and namespace, besides the documents.
+const insertMessageOverhead = 16 * 1024
+
 // BufferedBulkInserter implements a bufio.Writer-like design for queuing up
 // documents and inserting them in bulk when the given doc limit (or max
 // message size) is reached. Must be flushed at the end to ensure that all
@@ -14,9 +20,16 @@ type BufferedBulkInserter struct {
 	bulk            *mgo.Bulk
 	collection      *mgo.Collection
 	continueOnError bool
+	ordered         bool
 	docLimit        int
+	byteLimit       int
 	byteCount       int
 	docCount        int
+
+	// with a retry policy or when continuing on error, the buffered
+	// documents are kept to insert them again if the bulk insert fails
+	retry *RetryPolicy
+	docs  []bson.Raw
 }
 
 // NewBufferedBulkInserter returns an initialized BufferedBulkInserter
@@ -27,19 +40,57 @@ func NewBufferedBulkInserter(collection *mgo.Collection, docLimit int,
 		collection:      collection,
 		continueOnError: continueOnError,
 		docLimit:        docLimit,
+		byteLimit:       MaxMessageSize - insertMessageOverhead,
 	}
 	bb.resetBulk()
 	return bb
 }
 
+// KeepOrder makes the inserter insert documents in the order they are
+// buffered even when continuing on error: a document failing to insert
+// doesn't keep the ones after it from being inserted, in order.
+func (bb *BufferedBulkInserter) KeepOrder() {
+	bb.ordered = true
+	bb.resetBulk()
+}
+
+// SetRetryPolicy makes the inserter retry bulk inserts that fail with
+// transient errors, as the policy allows.
+func (bb *BufferedBulkInserter) SetRetryPolicy(policy *RetryPolicy) {
+	bb.retry = policy
+}
+
+// SetMaxMessageSize makes the inserter split its bulk inserts so that each
+// fits in a message of the given size, such as the maxMessageSizeBytes the
+// server reports. A size of zero keeps the default of MaxMessageSize.
+func (bb *BufferedBulkInserter) SetMaxMessageSize(size int) {
+	if size > insertMessageOverhead {
+		bb.byteLimit = size - insertMessageOverhead
+	}
+}
+
+// full returns true if a document of the given size doesn't fit in the
+// buffered bulk insert.
+func (bb *BufferedBulkInserter) full(docSize int) bool {
+	return bb.docCount >= bb.docLimit || bb.byteCount+docSize > bb.byteLimit
+}
+
+// newBulk returns an empty bulk insert, unordered when continuing on error
+// unless the order is kept.
+func (bb *BufferedBulkInserter) newBulk() *mgo.Bulk {
+	bulk := bb.collection.Bulk()
+	if bb.continueOnError && !bb.ordered {
+		bulk.Unordered()
+	}
+	return bulk
+}
+
 // throw away the old bulk and init a new one
 func (bb *BufferedBulkInserter) resetBulk() {
-	bb.bulk = bb.collection.Bulk()
-	if bb.continueOnError {
-		bb.bulk.Unordered()
-	}
+	bb.bulk = bb.newBulk()
 	bb.byteCount = 0
 	bb.docCount = 0
+	bb.docs = bb.docs[:0]
 }
 
 // Insert adds a document to the buffer for bulk insertion. If the buffer is
@@ -50,24 +101,212 @@ func (bb *BufferedBulkInserter) Insert(doc interface{}) error {
 		return fmt.Errorf("bson encoding error: %v", err)
 	}
 	// flush if we are full
-	if bb.docCount >= bb.docLimit || bb.byteCount+len(rawBytes) > MaxMessageSize {
+	if bb.full(len(rawBytes)) {
 		err = bb.Flush()
 	}
 	// buffer the document
 	bb.docCount++
 	bb.byteCount += len(rawBytes)
 	bb.bulk.Insert(bson.Raw{Data: rawBytes})
+	if bb.retry != nil || bb.continueOnError {
+		bb.docs = append(bb.docs, bson.Raw{Data: rawBytes})
+	}
 	return err
 }
 
+// Buffered returns the number of documents waiting for the next bulk insert.
+func (bb *BufferedBulkInserter) Buffered() int {
+	return bb.docCount
+}
+
+// FailedDocument is a document a bulk insert failed to insert, and why.
+type FailedDocument struct {
+	Doc bson.Raw
+	Err error
+}
+
+// BulkInsertError is the error of a bulk insert that continued on error,
+// listing the documents it failed to insert.
+type BulkInsertError struct {
+	Failed []FailedDocument
+}
+
+func (err *BulkInsertError) Error() string {
+	if len(err.Failed) == 1 {
+		return err.Failed[0].Err.Error()
+	}
+	return fmt.Sprintf("%v documents failed to insert, the first with: %v",
+		len(err.Failed), err.Failed[0].Err)
+}
+
 // Flush writes all buffered documents in one bulk insert then resets the buffer.
+// When continuing on error, a bulk insert failing on some of its documents
+// returns a *BulkInsertError listing them, as long as every document has an
+// _id to find the ones that were inserted by: those that weren't are
+// inserted again one at a time, in order. An ordered bulk insert holding
+// documents without an _id is made one document at a time instead.
 func (bb *BufferedBulkInserter) Flush() error {
 	if bb.docCount == 0 {
 		return nil
 	}
 	defer bb.resetBulk()
-	if _, err := bb.bulk.Run(); err != nil {
+	if bb.continueOnError && bb.ordered && !haveIDs(bb.docs) {
+		return bb.insertEach(bb.docs)
+	}
+	err := bb.runBulk()
+	if err == nil || !bb.continueOnError || IsRetryableError(err) || !haveIDs(bb.docs) {
 		return err
 	}
+	missing, findErr := NotInserted(bb.collection, bb.docs)
+	if findErr != nil {
+		return fmt.Errorf("%v; %v", err, findErr)
+	}
+	return bb.insertEach(missing)
+}
+
+// runBulk makes the buffered bulk insert.
+// With a retry policy, a bulk insert failing with a transient error is
+// retried with the documents the failed attempt didn't insert, in their
+// original order. Documents without an _id get one from the server, so the
+// ones a failed attempt inserted can't be found, and a bulk insert holding
+// any is not retried.
+func (bb *BufferedBulkInserter) runBulk() error {
+	retry := bb.retry
+	if retry != nil && !haveIDs(bb.docs) {
+		retry = nil
+	}
+	return retry.Do("bulk insert into "+bb.collection.FullName, func(attempt int) error {
+		if attempt == 1 {
+			_, err := bb.bulk.Run()
+			return err
+		}
+		bb.collection.Database.Session.Refresh()
+		missing, err := NotInserted(bb.collection, bb.docs)
+		if err != nil {
+			return err
+		}
+		if len(missing) < len(bb.docs) {
+			log.Logf(log.Info, "%v of %v documents were inserted into %v before the bulk insert failed",
+				len(bb.docs)-len(missing), len(bb.docs), bb.collection.FullName)
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		bulk := bb.newBulk()
+		for _, doc := range missing {
+			bulk.Insert(doc)
+		}
+		_, err = bulk.Run()
+		return err
+	})
+}
+
+// insertEach inserts the documents one at a time, in order, going on past
+// those that fail. It returns a *BulkInsertError listing the documents that
+// failed, or the error of a document that failed to insert with a transient
+// error, which is likely to fail the rest.
+func (bb *BufferedBulkInserter) insertEach(docs []bson.Raw) error {
+	failed := []FailedDocument{}
+	for _, doc := range docs {
+		retry := bb.retry
+		if _, ok := rawDocumentID(doc); !ok {
+			retry = nil
+		}
+		err := retry.Do("insert into "+bb.collection.FullName, func(attempt int) error {
+			if attempt > 1 {
+				bb.collection.Database.Session.Refresh()
+				missing, err := NotInserted(bb.collection, []bson.Raw{doc})
+				if err != nil {
+					return err
+				}
+				if len(missing) == 0 {
+					return nil
+				}
+			}
+			return bb.collection.Insert(doc)
+		})
+		if IsRetryableError(err) {
+			return err
+		}
+		if err != nil {
+			failed = append(failed, FailedDocument{doc, err})
+		}
+	}
+	if len(failed) > 0 {
+		return &BulkInsertError{failed}
+	}
 	return nil
 }
+
+// NotInserted returns the documents, in order, that the collection doesn't
+// hold: those without an _id, those whose _id isn't in it, and those whose
+// _id is the _id of another document, such as one inserted before them,
+// which inserting the document again reports as a duplicate key. It tells
+// which documents of a failed bulk insert were inserted.
+func NotInserted(collection *mgo.Collection, docs []bson.Raw) ([]bson.Raw, error) {
+	ids := make([]bson.Raw, len(docs))
+	found := make([]bson.Raw, 0, len(docs))
+	for i, doc := range docs {
+		if id, ok := rawDocumentID(doc); ok {
+			ids[i] = id
+			found = append(found, id)
+		}
+	}
+	stored := map[string]bson.Raw{}
+	iter := collection.Find(bson.M{"_id": bson.M{"$in": found}}).Iter()
+	doc := bson.Raw{}
+	for iter.Next(&doc) {
+		id, _ := rawDocumentID(doc)
+		stored[idKey(id)] = bson.Raw{Kind: doc.Kind, Data: append([]byte(nil), doc.Data...)}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("error finding the documents inserted into %v: %v", collection.FullName, err)
+	}
+	missing := []bson.Raw{}
+	for i, doc := range docs {
+		if ids[i].Kind != 0 {
+			if storedDoc, ok := stored[idKey(ids[i])]; ok && sameDocument(storedDoc, doc) {
+				continue
+			}
+		}
+		missing = append(missing, doc)
+	}
+	return missing, nil
+}
+
+// rawDocumentID returns the _id of a document, or false if it has none.
+func rawDocumentID(doc bson.Raw) (bson.Raw, bool) {
+	fields := struct {
+		ID bson.Raw `bson:"_id"`
+	}{}
+	if err := bson.Unmarshal(doc.Data, &fields); err != nil || fields.ID.Kind == 0 {
+		return bson.Raw{}, false
+	}
+	return fields.ID, true
+}
+
+// idKey returns a map key for an _id.
+func idKey(id bson.Raw) string {
+	return string(id.Kind) + string(id.Data)
+}
+
+// haveIDs returns true if every document has an _id.
+func haveIDs(docs []bson.Raw) bool {
+	for _, doc := range docs {
+		if _, ok := rawDocumentID(doc); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sameDocument returns true if the documents hold the same fields and
+// values, whatever the order of their fields, as the server moves the _id
+// of an inserted document first.
+func sameDocument(a, b bson.Raw) bool {
+	docA, docB := bson.M{}, bson.M{}
+	if bson.Unmarshal(a.Data, &docA) != nil || bson.Unmarshal(b.Data, &docB) != nil {
+		return false
+	}
+	return reflect.DeepEqual(docA, docB)
+}
@@ -1,9 +1,11 @@
 package db
 
 import (
+	"errors"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"testing"
 )
@@ -98,9 +100,106 @@ func TestBufferedBulkInserterInserts(t *testing.T) {
 			})
 		})
 
+		Convey("using a test collection holding a document and keeping the order", func() {
+			testCol := session.DB("tools-test").C("bulk4")
+			So(testCol.Insert(bson.M{"_id": 2, "a": "existing"}), ShouldBeNil)
+			bufBulk = NewBufferedBulkInserter(testCol, 10, true)
+			bufBulk.KeepOrder()
+
+			Convey("a duplicate key shouldn't keep the documents after it from being inserted", func() {
+				for i := 1; i <= 4; i++ {
+					So(bufBulk.Insert(bson.M{"_id": i, "a": "new"}), ShouldBeNil)
+				}
+				err := bufBulk.Flush()
+				So(err, ShouldHaveSameTypeAs, &BulkInsertError{})
+				failed := err.(*BulkInsertError).Failed
+				So(len(failed), ShouldEqual, 1)
+				So(mgo.IsDup(failed[0].Err), ShouldBeTrue)
+				id, _ := rawDocumentID(failed[0].Doc)
+				So(id.Data, ShouldResemble, []byte{2, 0, 0, 0})
+
+				count, err := testCol.Find(bson.M{"a": "new"}).Count()
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 3)
+			})
+		})
+
 		Reset(func() {
 			session.DB("tools-test").DropDatabase()
 		})
 	})
 
 }
+
+func TestBufferedBulkInserterLimits(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a BufferedBulkInserter limited to 3 documents", t, func() {
+		bufBulk := NewBufferedBulkInserter(&mgo.Collection{}, 3, false)
+
+		Convey("it should be full at the document limit", func() {
+			bufBulk.docCount = 3
+			So(bufBulk.full(10), ShouldBeTrue)
+		})
+
+		Convey("it should be full when a document would overflow the default message size", func() {
+			bufBulk.docCount, bufBulk.byteCount = 1, MaxMessageSize/2
+			So(bufBulk.full(1024), ShouldBeFalse)
+			So(bufBulk.full(MaxMessageSize/2), ShouldBeTrue)
+		})
+
+		Convey("it should be full when a document would overflow the server's message size", func() {
+			bufBulk.SetMaxMessageSize(4 * 1024 * 1024)
+			bufBulk.docCount, bufBulk.byteCount = 1, 3*1024*1024
+			So(bufBulk.full(512*1024), ShouldBeFalse)
+			So(bufBulk.full(1024*1024), ShouldBeTrue)
+		})
+
+		Convey("an unreported message size should keep the default", func() {
+			bufBulk.SetMaxMessageSize(0)
+			So(bufBulk.byteLimit, ShouldEqual, MaxMessageSize-insertMessageOverhead)
+		})
+	})
+}
+
+func TestBufferedBulkInserterRetries(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	raw := func(doc interface{}) bson.Raw {
+		data, err := bson.Marshal(doc)
+		So(err, ShouldBeNil)
+		return bson.Raw{Kind: 0x03, Data: data}
+	}
+
+	Convey("Documents should be told apart by their _id", t, func() {
+		id, ok := rawDocumentID(raw(bson.D{{"a", 1}, {"_id", 5}}))
+		So(ok, ShouldBeTrue)
+		other, ok := rawDocumentID(raw(bson.M{"_id": 5, "b": 2}))
+		So(ok, ShouldBeTrue)
+		So(idKey(id), ShouldEqual, idKey(other))
+		other, _ = rawDocumentID(raw(bson.M{"_id": "5"}))
+		So(idKey(id), ShouldNotEqual, idKey(other))
+		_, ok = rawDocumentID(raw(bson.D{{"a", 1}}))
+		So(ok, ShouldBeFalse)
+
+		Convey("and only retried if they all have one", func() {
+			So(haveIDs([]bson.Raw{raw(bson.M{"_id": 1}), raw(bson.M{"_id": nil})}), ShouldBeTrue)
+			So(haveIDs([]bson.Raw{raw(bson.M{"_id": 1}), raw(bson.M{"a": 1})}), ShouldBeFalse)
+		})
+	})
+
+	Convey("A stored document should match the one inserted whatever its field order", t, func() {
+		inserted := raw(bson.D{{"a", 1}, {"_id", 5}, {"b", bson.D{{"c", "x"}}}})
+		So(sameDocument(raw(bson.D{{"_id", 5}, {"a", 1}, {"b", bson.D{{"c", "x"}}}}), inserted), ShouldBeTrue)
+		So(sameDocument(raw(bson.D{{"_id", 5}, {"a", 2}, {"b", bson.D{{"c", "x"}}}}), inserted), ShouldBeFalse)
+	})
+
+	Convey("A bulk insert error should report the documents that failed", t, func() {
+		err := &BulkInsertError{[]FailedDocument{{raw(bson.M{"_id": 1}), errors.New("E11000 duplicate key error")}}}
+		So(err.Error(), ShouldEqual, "E11000 duplicate key error")
+		err.Failed = append(err.Failed, FailedDocument{raw(bson.M{"_id": 2}), errors.New("E11000 duplicate key error")})
+		So(err.Error(), ShouldEqual, "2 documents failed to insert, the first with: E11000 duplicate key error")
+	})
+}
@@ -181,6 +181,35 @@ func (sp *SessionProvider) SupportsWriteCommands() (bool, error) {
 	return (masterDoc.Ok == 1 && masterDoc.MaxWire >= 2), nil
 }
 
+// ServerLimits are the largest document and wire protocol message the
+// connected server accepts.
+type ServerLimits struct {
+	MaxBSONObjectSize   int `bson:"maxBsonObjectSize"`
+	MaxMessageSizeBytes int `bson:"maxMessageSizeBytes"`
+}
+
+// GetServerLimits returns the limits the connected server reports with
+// isMaster, or MaxBSONSize and MaxMessageSize for those it doesn't report.
+func (sp *SessionProvider) GetServerLimits() (ServerLimits, error) {
+	limits := ServerLimits{}
+	session, err := sp.GetSession()
+	if err != nil {
+		return limits, err
+	}
+	session.SetSocketTimeout(0)
+	defer session.Close()
+	if err = session.Run("isMaster", &limits); err != nil {
+		return limits, err
+	}
+	if limits.MaxBSONObjectSize <= 0 {
+		limits.MaxBSONObjectSize = MaxBSONSize
+	}
+	if limits.MaxMessageSizeBytes <= 0 {
+		limits.MaxMessageSizeBytes = MaxMessageSize
+	}
+	return limits, nil
+}
+
 // FindOne retuns the first document in the collection and database that matches
 // the query after skip, sort and query flags are applied.
 func (sp *SessionProvider) FindOne(db, collection string, skip int, query interface{}, sort []string, into interface{}, flags int) error {
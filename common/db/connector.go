@@ -1,6 +1,7 @@
 package db
 
 import (
+	"github.com/mongodb/mongo-tools/common/db/handshake"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
@@ -37,6 +38,7 @@ func (self *VanillaDBConnector) Configure(opts options.ToolOptions) error {
 		Password:       opts.Auth.Password,
 		Source:         opts.GetAuthenticationDatabase(),
 		Mechanism:      opts.Auth.Mechanism,
+		DialServer:     handshake.Dialer(opts.ClientAppName(), DefaultDialTimeout, nil),
 	}
 	return nil
 }
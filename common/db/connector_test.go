@@ -35,6 +35,26 @@ func TestVanillaDBConnector(t *testing.T) {
 
 		})
 
+		Convey("calling Configure should tag connections with the tool's name,"+
+			" version, purpose and label", func() {
+
+			connector = &VanillaDBConnector{}
+
+			opts := options.ToolOptions{
+				AppName:    "mongodump",
+				VersionStr: "r3.4.0",
+				Connection: &options.Connection{
+					Host:     "localhost",
+					AppLabel: "nightly-backup",
+				},
+				Auth: &options.Auth{},
+			}
+			So(connector.Configure(opts), ShouldBeNil)
+			So(opts.ClientAppName(), ShouldEqual, "mongodump r3.4.0 backup nightly-backup")
+			So(connector.dialInfo.DialServer, ShouldNotBeNil)
+
+		})
+
 		Convey("calling GetNewSession with a running mongod should connect"+
 			" successfully", func() {
 
@@ -5,6 +5,7 @@ package db
 import (
 	"errors"
 	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/password"
 	"gopkg.in/mgo.v2"
@@ -60,6 +61,10 @@ type SessionProvider struct {
 
 	// flags for generating the master session
 	flags sessionFlag
+
+	// with --cacheCredentials, the account whose password entered at the
+	// prompt is cached once the master session is connected
+	credentialAccount string
 }
 
 // ApplyOpsResponse represents the response from an 'applyOps' command.
@@ -100,6 +105,9 @@ func (self *SessionProvider) GetSession() (*mgo.Session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to db server: %v", err)
 	}
+	if self.credentialAccount != "" {
+		password.Remember(self.credentialAccount)
+	}
 	// handle session flags
 	if (self.flags & Monotonic) > 0 {
 		self.masterSession.SetMode(mgo.Monotonic, true)
@@ -111,6 +119,17 @@ func (self *SessionProvider) GetSession() (*mgo.Session, error) {
 	return self.masterSession.Copy(), nil
 }
 
+// Close closes the provider's master session, if one was created. Sessions
+// already returned by GetSession are unaffected.
+func (self *SessionProvider) Close() {
+	self.masterSessionLock.Lock()
+	defer self.masterSessionLock.Unlock()
+	if self.masterSession != nil {
+		self.masterSession.Close()
+		self.masterSession = nil
+	}
+}
+
 // SetFlags allows certain modifications to the masterSession after
 // initial creation.
 func (self *SessionProvider) SetFlags(flagBits sessionFlag) {
@@ -124,6 +143,25 @@ func (self *SessionProvider) SetFlags(flagBits sessionFlag) {
 	self.flags = flagBits
 }
 
+// AskForPassword fills in the password when the authentication mechanism
+// needs one and none was given, from the OS keychain with
+// --cacheCredentials, or else by prompting for it; a password entered at
+// the prompt is cached once a session provider connects with it. With
+// --forgetCredentials, the password is first removed from the OS keychain.
+func AskForPassword(opts *options.ToolOptions) {
+	if opts.Auth.ForgetCredentials {
+		if err := password.Forget(opts.CredentialAccount()); err != nil {
+			log.Logf(log.Always, "warning: could not remove the cached password: %v", err)
+		} else {
+			log.Logf(log.Always, "removed the cached password for %v", opts.CredentialAccount())
+		}
+		opts.Auth.ForgetCredentials = false
+	}
+	if opts.Auth.ShouldAskForPassword() {
+		opts.Auth.Password = password.PromptOrCached(opts.CredentialAccount(), opts.Auth.CacheCredentials)
+	}
+}
+
 // NewSessionProvider constructs a session provider but does not attempt to
 // create the initial session.
 func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
@@ -131,8 +169,10 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 	provider := &SessionProvider{}
 
 	// finalize auth options, filling in missing passwords
-	if opts.Auth.ShouldAskForPassword() {
-		opts.Auth.Password = password.Prompt()
+	AskForPassword(&opts)
+
+	if opts.Auth.CacheCredentials {
+		provider.credentialAccount = opts.CredentialAccount()
 	}
 
 	// create the connector for dialing the database
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// RateLimiter paces writes to a number of documents per second. A nil
+// RateLimiter doesn't limit.
+type RateLimiter struct {
+	perSecond float64
+	start     time.Time
+	done      int64
+	sleep     func(time.Duration)
+}
+
+// NewRateLimiter returns a limiter to perSecond documents per second, or nil
+// if perSecond is 0.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{perSecond: perSecond, start: time.Now(), sleep: time.Sleep}
+}
+
+// Wait blocks until n more documents can be written within the rate.
+func (limiter *RateLimiter) Wait(n int) {
+	if limiter == nil {
+		return
+	}
+	due := limiter.start.Add(time.Duration(float64(limiter.done) / limiter.perSecond * float64(time.Second)))
+	if delay := due.Sub(time.Now()); delay > 0 {
+		limiter.sleep(delay)
+	}
+	limiter.done += int64(n)
+}
+
+// DeleteInBatches deletes the documents matching the query from the
+// collection, selecting the _ids of up to batchSize of them at a time, at
+// the pace of the limiter. The query is repeated when deleting a batch, so
+// documents updated since they were selected, and no longer matching, are
+// kept; once a batch deletes none, the deletion stops rather than select the
+// same documents over again. After each batch, deleted is called, if set,
+// with the number of documents it deleted. It returns the number of
+// documents deleted.
+func DeleteInBatches(collection *mgo.Collection, query interface{}, batchSize int,
+	limiter *RateLimiter, deleted func(int64)) (int64, error) {
+	total := int64(0)
+	for {
+		var docs []struct {
+			ID interface{} `bson:"_id"`
+		}
+		err := collection.Find(query).Select(bson.M{"_id": 1}).Limit(batchSize).All(&docs)
+		if err != nil {
+			return total, err
+		}
+		if len(docs) == 0 {
+			return total, nil
+		}
+		ids := make([]interface{}, 0, len(docs))
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+		limiter.Wait(len(ids))
+		info, err := collection.RemoveAll(bson.M{"$and": []interface{}{query, bson.M{"_id": bson.M{"$in": ids}}}})
+		if err != nil {
+			return total, err
+		}
+		total += int64(info.Removed)
+		if deleted != nil {
+			deleted(int64(info.Removed))
+		}
+		if info.Removed == 0 {
+			return total, nil
+		}
+	}
+}
+
+// DeleteIDsInBatches deletes the documents with the given _ids that still
+// match the query from the collection, up to batchSize of them at a time, at
+// the pace of the limiter. Unlike DeleteInBatches, documents matching the
+// query but not listed, such as ones written since the _ids were gathered,
+// are kept. After each batch, deleted is called, if set, with the number of
+// documents it deleted. It returns the number of documents deleted.
+func DeleteIDsInBatches(collection *mgo.Collection, query interface{}, ids []interface{}, batchSize int,
+	limiter *RateLimiter, deleted func(int64)) (int64, error) {
+	return deleteIDs(func(selector interface{}) (int, error) {
+		info, err := collection.RemoveAll(selector)
+		if err != nil {
+			return 0, err
+		}
+		return info.Removed, nil
+	}, query, ids, batchSize, limiter, deleted)
+}
+
+// deleteIDs implements DeleteIDsInBatches, deleting each batch with remove.
+func deleteIDs(remove func(selector interface{}) (int, error), query interface{}, ids []interface{},
+	batchSize int, limiter *RateLimiter, deleted func(int64)) (int64, error) {
+	total := int64(0)
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		ids = ids[len(batch):]
+		limiter.Wait(len(batch))
+		removed, err := remove(bson.M{"$and": []interface{}{query, bson.M{"_id": bson.M{"$in": batch}}}})
+		if err != nil {
+			return total, err
+		}
+		total += int64(removed)
+		if deleted != nil {
+			deleted(int64(removed))
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a rate limiter of 100 documents per second", t, func() {
+		limiter := NewRateLimiter(100)
+		delay := time.Duration(0)
+		limiter.sleep = func(d time.Duration) { delay = d }
+
+		Convey("the first batch should not wait", func() {
+			limiter.Wait(50)
+			So(delay, ShouldEqual, 0)
+		})
+
+		Convey("later batches should be spaced out to the rate", func() {
+			limiter.Wait(50)
+			limiter.Wait(50)
+			So(delay, ShouldBeGreaterThan, 400*time.Millisecond)
+			So(delay, ShouldBeLessThanOrEqualTo, 500*time.Millisecond)
+			limiter.Wait(50)
+			So(delay, ShouldBeGreaterThan, 900*time.Millisecond)
+			So(delay, ShouldBeLessThanOrEqualTo, time.Second)
+		})
+	})
+
+	Convey("Without a rate, a nil limiter should not wait", t, func() {
+		limiter := NewRateLimiter(0)
+		So(limiter, ShouldBeNil)
+		limiter.Wait(1000)
+	})
+}
+
+func TestDeleteIDs(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a collection of documents matching the query", t, func() {
+		query := bson.M{"archived": true}
+		collection := map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true}
+		selectors := []interface{}{}
+		remove := func(selector interface{}) (int, error) {
+			selectors = append(selectors, selector)
+			removed := 0
+			for _, id := range selector.(bson.M)["$and"].([]interface{})[1].(bson.M)["_id"].(bson.M)["$in"].([]interface{}) {
+				if collection[id.(int)] {
+					delete(collection, id.(int))
+					removed++
+				}
+			}
+			return removed, nil
+		}
+
+		Convey("only the listed _ids should be deleted, in batches, keeping matching documents written since", func() {
+			batches := []int64{}
+			deleted, err := deleteIDs(remove, query, []interface{}{1, 2, 3}, 2, nil,
+				func(n int64) { batches = append(batches, n) })
+			So(err, ShouldBeNil)
+			So(deleted, ShouldEqual, 3)
+			So(batches, ShouldResemble, []int64{2, 1})
+			So(collection, ShouldResemble, map[int]bool{4: true, 5: true})
+		})
+
+		Convey("each batch should still be restricted to the query", func() {
+			_, err := deleteIDs(remove, query, []interface{}{1}, 10, nil, nil)
+			So(err, ShouldBeNil)
+			So(selectors, ShouldResemble, []interface{}{
+				bson.M{"$and": []interface{}{query, bson.M{"_id": bson.M{"$in": []interface{}{1}}}}},
+			})
+		})
+
+		Convey("_ids already gone should not count as deleted", func() {
+			delete(collection, 2)
+			deleted, err := deleteIDs(remove, query, []interface{}{1, 2, 3}, 10, nil, nil)
+			So(err, ShouldBeNil)
+			So(deleted, ShouldEqual, 2)
+		})
+
+		Convey("the first error should stop the deletion", func() {
+			calls := 0
+			failing := func(selector interface{}) (int, error) {
+				calls++
+				return 0, fmt.Errorf("not primary")
+			}
+			_, err := deleteIDs(failing, query, []interface{}{1, 2, 3}, 1, nil, nil)
+			So(err, ShouldNotBeNil)
+			So(calls, ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,134 @@
+// Package handshake sends the client metadata naming the application at the
+// start of the connections made to MongoDB.
+package handshake
+
+import (
+	"encoding/binary"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"net"
+	"runtime"
+	"time"
+)
+
+// opQuery and opReply are the wire protocol op codes of a query and its reply.
+const (
+	opQuery = 2004
+	opReply = 1
+)
+
+// queryFlagSlaveOk lets the handshake run against secondaries.
+const queryFlagSlaveOk = 1 << 2
+
+// maxReplySize bounds the size of the reply to the handshake.
+const maxReplySize = 16 * 1024 * 1024
+
+// DialFunc is the dial function of an mgo.DialInfo.
+type DialFunc func(addr *mgo.ServerAddr) (net.Conn, error)
+
+// Dialer returns a dial function which starts each new connection
+// with an isMaster command carrying the client metadata naming the
+// application, before handing the connection over to the driver. Servers
+// from MongoDB 3.4 show the application name in currentOp and their logs,
+// and only accept the metadata in the first command of a connection, which
+// the vendored driver doesn't send. Connections are made with dial, or over
+// TCP within the timeout if dial is nil. Without an application name, dial
+// is returned as is.
+func Dialer(appName string, timeout time.Duration, dial DialFunc) DialFunc {
+	if appName == "" {
+		return dial
+	}
+	if dial == nil {
+		dial = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr.TCPAddr().String(), timeout)
+		}
+	}
+	return func(addr *mgo.ServerAddr) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		if timeout > 0 {
+			conn.SetDeadline(time.Now().Add(timeout))
+		}
+		if err = handshake(conn, appName); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("handshake with %v failed: %v", addr.String(), err)
+		}
+		conn.SetDeadline(time.Time{})
+		return conn, nil
+	}
+}
+
+// handshake sends the isMaster command carrying the client metadata over
+// the connection, and reads its reply.
+func handshake(conn io.ReadWriter, appName string) error {
+	message, err := handshakeMessage(appName)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Write(message); err != nil {
+		return err
+	}
+	return readHandshakeReply(conn)
+}
+
+// handshakeMessage returns the query message of the isMaster command
+// carrying the client metadata.
+func handshakeMessage(appName string) ([]byte, error) {
+	metadata := bson.D{
+		{"application", bson.D{{"name", appName}}},
+		{"driver", bson.D{{"name", "mgo"}, {"version", "v2"}}},
+		{"os", bson.D{{"type", runtime.GOOS}, {"architecture", runtime.GOARCH}}},
+	}
+	query, err := bson.Marshal(bson.D{{"isMaster", 1}, {"client", metadata}})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the client metadata: %v", err)
+	}
+	// header: length, request id, response to, op code; then the flags,
+	// the collection, the documents to skip and to return, and the query
+	message := make([]byte, 16, 16+4+len("admin.$cmd")+1+8+len(query))
+	message = appendInt32(message, queryFlagSlaveOk)
+	message = append(message, "admin.$cmd"...)
+	message = append(message, 0)
+	message = appendInt32(message, 0)
+	message = appendInt32(message, -1)
+	message = append(message, query...)
+	binary.LittleEndian.PutUint32(message[0:], uint32(len(message)))
+	binary.LittleEndian.PutUint32(message[4:], 1)
+	binary.LittleEndian.PutUint32(message[8:], 0)
+	binary.LittleEndian.PutUint32(message[12:], opQuery)
+	return message, nil
+}
+
+// readHandshakeReply reads the reply to the handshake, returning an error
+// if it isn't a reply holding a document. Servers older than 3.4 ignore the
+// client metadata, so the command's result itself isn't checked.
+func readHandshakeReply(conn io.Reader) error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	length := int(int32(binary.LittleEndian.Uint32(header[0:])))
+	if length < 16+20 || length > maxReplySize {
+		return fmt.Errorf("invalid reply length %v", length)
+	}
+	if opCode := binary.LittleEndian.Uint32(header[12:]); opCode != opReply {
+		return fmt.Errorf("unexpected reply op code %v", opCode)
+	}
+	body := make([]byte, length-16)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return err
+	}
+	// flags, cursor id, starting from, then the number of documents
+	if returned := int32(binary.LittleEndian.Uint32(body[16:])); returned != 1 {
+		return fmt.Errorf("reply holds %v documents instead of 1", returned)
+	}
+	return nil
+}
+
+func appendInt32(b []byte, i int32) []byte {
+	return append(b, byte(i), byte(i>>8), byte(i>>16), byte(i>>24))
+}
@@ -0,0 +1,77 @@
+package handshake
+
+import (
+	"encoding/binary"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"net"
+	"testing"
+)
+
+// fakeServer reads a query from the connection and sends back a reply
+// holding the given number of documents, returning the query it read.
+func fakeServer(conn net.Conn, returned int32) (bson.M, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(header)-16)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	// skip the flags and "admin.$cmd\x00", then the skip and return counts
+	query := bson.M{}
+	if err := bson.Unmarshal(body[4+11+8:], &query); err != nil {
+		return nil, err
+	}
+	doc, _ := bson.Marshal(bson.M{"ok": 1, "ismaster": true})
+	reply := make([]byte, 16, 36+len(doc))
+	reply = appendInt32(reply, 0)
+	reply = append(reply, make([]byte, 8)...)
+	reply = appendInt32(reply, 0)
+	reply = appendInt32(reply, returned)
+	reply = append(reply, doc...)
+	binary.LittleEndian.PutUint32(reply[0:], uint32(len(reply)))
+	binary.LittleEndian.PutUint32(reply[12:], opReply)
+	_, err := conn.Write(reply)
+	return query, err
+}
+
+func TestHandshake(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a connection to a server", t, func() {
+		client, server := net.Pipe()
+		queries := make(chan bson.M, 1)
+
+		Convey("the handshake should send the application name in an isMaster", func() {
+			go func() {
+				query, _ := fakeServer(server, 1)
+				queries <- query
+			}()
+			So(handshake(client, "mongodump r3.4.0 backup"), ShouldBeNil)
+			query := <-queries
+			So(query["isMaster"], ShouldEqual, 1)
+			metadata := query["client"].(bson.M)
+			So(metadata["application"].(bson.M)["name"], ShouldEqual, "mongodump r3.4.0 backup")
+		})
+
+		Convey("a reply without a document should fail the handshake", func() {
+			go fakeServer(server, 0)
+			So(handshake(client, "mongodump"), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			client.Close()
+			server.Close()
+		})
+	})
+
+	Convey("Without an application name, the dial function should be left as is", t, func() {
+		So(Dialer("", 0, nil), ShouldBeNil)
+		So(Dialer("mongodump", 0, nil), ShouldNotBeNil)
+	})
+}
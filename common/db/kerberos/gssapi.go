@@ -5,6 +5,7 @@ package kerberos
 // #cgo windows LDFLAGS: -Lc:/sasl/lib
 
 import (
+	"github.com/mongodb/mongo-tools/common/db/handshake"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
@@ -46,6 +47,7 @@ func (self *KerberosDBConnector) Configure(opts options.ToolOptions) error {
 		Service:     opts.Kerberos.Service,
 		ServiceHost: opts.Kerberos.ServiceHost,
 		Mechanism:   KERBEROS_AUTHENTICATION_MECHANISM,
+		DialServer:  handshake.Dialer(opts.ClientAppName(), KERBEROS_DIAL_TIMEOUT, nil),
 	}
 
 	return nil
@@ -0,0 +1,18 @@
+// +build !darwin,!linux
+
+package db
+
+import (
+	"fmt"
+	"os"
+)
+
+// mapFile is unsupported on this platform, so files are read as streams.
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return nil, fmt.Errorf("memory mapping is not supported on this platform")
+}
+
+// unmapFile is never called, as mapFile never succeeds.
+func unmapFile(data []byte) error {
+	return nil
+}
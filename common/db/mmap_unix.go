@@ -0,0 +1,18 @@
+// +build darwin linux
+
+package db
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the first size bytes of the file into memory, read-only.
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile releases a mapping made by mapFile.
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
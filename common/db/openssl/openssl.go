@@ -8,6 +8,7 @@ import (
 
 	"gopkg.in/mgo.v2"
 
+	"github.com/mongodb/mongo-tools/common/db/handshake"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/spacemonkeygo/openssl"
@@ -56,7 +57,7 @@ func (self *SSLDBConnector) Configure(opts options.ToolOptions) error {
 		Timeout:        DefaultSSLDialTimeout,
 		Direct:         opts.Direct,
 		ReplicaSetName: opts.ReplicaSetName,
-		DialServer:     dialer,
+		DialServer:     handshake.Dialer(opts.ClientAppName(), DefaultSSLDialTimeout, dialer),
 		Username:       opts.Auth.Username,
 		Password:       opts.Auth.Password,
 		Source:         opts.GetAuthenticationDatabase(),
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"sort"
+	"time"
+)
+
+// replica set member state of a secondary
+const stateSecondary = 2
+
+// ReplSetStatus holds the parts of the replSetGetStatus command's result
+// needed to measure replication lag.
+type ReplSetStatus struct {
+	Members []MemberStatus `bson:"members"`
+}
+
+type MemberStatus struct {
+	Name       string    `bson:"name"`
+	State      int       `bson:"state"`
+	OptimeDate time.Time `bson:"optimeDate"`
+	Self       bool      `bson:"self"`
+}
+
+// ReplSetConfig holds the member tags from the replSetGetConfig command.
+type ReplSetConfig struct {
+	Config struct {
+		Members []MemberConfig `bson:"members"`
+	} `bson:"config"`
+}
+
+type MemberConfig struct {
+	Host string            `bson:"host"`
+	Tags map[string]string `bson:"tags"`
+}
+
+// GetReplSetStatus runs replSetGetStatus on the server the provider is
+// connected to.
+func (self *SessionProvider) GetReplSetStatus() (ReplSetStatus, error) {
+	status := ReplSetStatus{}
+	err := self.Run("replSetGetStatus", &status, "admin")
+	return status, err
+}
+
+// GetReplSetConfig runs replSetGetConfig on the server the provider is
+// connected to.
+func (self *SessionProvider) GetReplSetConfig() (ReplSetConfig, error) {
+	config := ReplSetConfig{}
+	err := self.Run("replSetGetConfig", &config, "admin")
+	return config, err
+}
+
+// Lag returns how far the named member's oplog is behind the most recent
+// oplog entry of any member, or of the member the status was read from if
+// name is empty.
+func (status ReplSetStatus) Lag(name string) (time.Duration, string, error) {
+	var latest time.Time
+	var member *MemberStatus
+	for i := range status.Members {
+		m := &status.Members[i]
+		if m.OptimeDate.After(latest) {
+			latest = m.OptimeDate
+		}
+		if (name == "" && m.Self) || (name != "" && m.Name == name) {
+			member = m
+		}
+	}
+	if member == nil {
+		if name == "" {
+			return 0, "", fmt.Errorf("replica set status does not include the connected member")
+		}
+		return 0, "", fmt.Errorf("%v is not a member of the replica set", name)
+	}
+	return latest.Sub(member.OptimeDate), member.Name, nil
+}
+
+// SelectTaggedMember returns the secondary whose tags include all of the
+// given ones and that is the least behind, preferring the first in the
+// config when several are as far behind.
+func SelectTaggedMember(status ReplSetStatus, config ReplSetConfig, tags map[string]string) (string, error) {
+	var candidates []string
+	for _, member := range config.Config.Members {
+		if hasTags(member.Tags, tags) {
+			candidates = append(candidates, member.Host)
+		}
+	}
+	secondaries := map[string]bool{}
+	for _, member := range status.Members {
+		secondaries[member.Name] = member.State == stateSecondary
+	}
+
+	best := ""
+	var bestLag time.Duration
+	for _, host := range candidates {
+		if !secondaries[host] {
+			continue
+		}
+		lag, _, err := status.Lag(host)
+		if err != nil {
+			continue
+		}
+		if best == "" || lag < bestLag {
+			best, bestLag = host, lag
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no secondary of the replica set has the tags %v", FormatTags(tags))
+	}
+	return best, nil
+}
+
+func hasTags(memberTags, tags map[string]string) bool {
+	for key, value := range tags {
+		if memberTags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatTags returns the tags as a document, with its keys sorted.
+func FormatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	formatted := "{"
+	for i, key := range keys {
+		if i > 0 {
+			formatted += ", "
+		}
+		formatted += fmt.Sprintf("%v: %q", key, tags[key])
+	}
+	return formatted + "}"
+}
+
+// ParseTags parses a JSON document of replica set tags given to the named
+// option, such as '{dc: "east", use: "backup"}'.
+func ParseTags(option, spec string) (map[string]string, error) {
+	var asJSON interface{}
+	if err := json.Unmarshal([]byte(spec), &asJSON); err != nil {
+		return nil, fmt.Errorf("error parsing %v as json: %v", option, err)
+	}
+	converted, err := bsonutil.ConvertJSONValueToBSON(asJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error converting %v to bson: %v", option, err)
+	}
+	asMap, ok := converted.(map[string]interface{})
+	if !ok || len(asMap) == 0 {
+		return nil, fmt.Errorf("%v must be a non-empty document of tags", option)
+	}
+	tags := map[string]string{}
+	for key, value := range asMap {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v value for '%v' must be a string", option, key)
+		}
+		tags[key] = str
+	}
+	return tags, nil
+}
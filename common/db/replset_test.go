@@ -0,0 +1,73 @@
+package db
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestReplicationLag(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the status of a replica set", t, func() {
+		now := time.Now()
+		status := ReplSetStatus{Members: []MemberStatus{
+			{Name: "a:27017", State: 1, OptimeDate: now},
+			{Name: "b:27017", State: 2, OptimeDate: now.Add(-5 * time.Second), Self: true},
+			{Name: "c:27017", State: 2, OptimeDate: now.Add(-90 * time.Second)},
+			{Name: "d:27017", State: 8, OptimeDate: now.Add(-time.Second)},
+		}}
+
+		Convey("lag should be measured from the most recent optime", func() {
+			lag, member, err := status.Lag("")
+			So(err, ShouldBeNil)
+			So(member, ShouldEqual, "b:27017")
+			So(lag, ShouldEqual, 5*time.Second)
+
+			lag, _, err = status.Lag("c:27017")
+			So(err, ShouldBeNil)
+			So(lag, ShouldEqual, 90*time.Second)
+
+			_, _, err = status.Lag("e:27017")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("the least lagged healthy secondary with the tags should be selected", func() {
+			config := ReplSetConfig{}
+			config.Config.Members = append(config.Config.Members,
+				MemberConfig{"a:27017", map[string]string{"use": "backup"}},
+				MemberConfig{"b:27017", map[string]string{"dc": "west", "use": "backup"}},
+				MemberConfig{"c:27017", map[string]string{"dc": "east", "use": "backup"}},
+				MemberConfig{"d:27017", map[string]string{"dc": "east", "use": "backup"}},
+			)
+
+			host, err := SelectTaggedMember(status, config, map[string]string{"use": "backup"})
+			So(err, ShouldBeNil)
+			So(host, ShouldEqual, "b:27017")
+
+			// d is recovering, so only c is left
+			host, err = SelectTaggedMember(status, config, map[string]string{"dc": "east"})
+			So(err, ShouldBeNil)
+			So(host, ShouldEqual, "c:27017")
+
+			_, err = SelectTaggedMember(status, config, map[string]string{"dc": "north"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseTags(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Tags should be a document of strings", t, func() {
+		tags, err := ParseTags("--tags", `{dc: "east", use: "backup"}`)
+		So(err, ShouldBeNil)
+		So(tags, ShouldResemble, map[string]string{"dc": "east", "use": "backup"})
+		So(FormatTags(tags), ShouldEqual, `{dc: "east", use: "backup"}`)
+
+		_, err = ParseTags("--tags", `{dc: 1}`)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "--tags")
+	})
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"strings"
+	"time"
+)
+
+// retryableCodes are the server error codes of writes that fail because of a
+// replica set election, a shutdown or a conflicting write, and can succeed
+// when retried.
+var retryableCodes = map[int]bool{
+	6:     true, // HostUnreachable
+	7:     true, // HostNotFound
+	89:    true, // NetworkTimeout
+	91:    true, // ShutdownInProgress
+	112:   true, // WriteConflict
+	189:   true, // PrimarySteppedDown
+	9001:  true, // SocketException
+	10107: true, // NotMaster
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotMasterNoSlaveOk
+	13436: true, // NotMasterOrSecondary
+}
+
+// retryableMessages identify transient errors by their message, as bulk
+// writes only report the message of the error that failed them.
+var retryableMessages = []string{
+	"not master",
+	"node is recovering",
+	"primary stepped down",
+	"interrupted at shutdown",
+	"interrupted due to repl state change",
+	"shutdown in progress",
+	"writeconflict",
+	"write conflict",
+	"connection reset",
+	"broken pipe",
+	"i/o timeout",
+	"no reachable servers",
+	"closed explicitly",
+}
+
+// IsRetryableError returns true if the error is transient, such as a
+// primary stepping down, a dropped connection or a write conflict, so the
+// write that failed with it can be retried.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch e := err.(type) {
+	case *mgo.LastError:
+		if retryableCodes[e.Code] {
+			return true
+		}
+	case *mgo.QueryError:
+		if retryableCodes[e.Code] {
+			return true
+		}
+	}
+	if IsConnectionError(err) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, retryable := range retryableMessages {
+		if strings.Contains(message, retryable) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxRetryBackoff caps the wait before retrying, however many attempts
+// have failed.
+const maxRetryBackoff = 30 * time.Second
+
+// RetryPolicy retries writes that fail with transient errors, doubling the
+// wait before each new attempt. A nil RetryPolicy makes a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a write is attempted, including the
+	// first; Backoff is the wait before the first retry
+	MaxAttempts int
+	Backoff     time.Duration
+
+	sleep func(time.Duration)
+}
+
+// NewRetryPolicy returns a policy making up to maxAttempts attempts at a
+// write, or nil if maxAttempts allows no retries.
+func NewRetryPolicy(maxAttempts int, backoff time.Duration) *RetryPolicy {
+	if maxAttempts <= 1 {
+		return nil
+	}
+	return &RetryPolicy{MaxAttempts: maxAttempts, Backoff: backoff, sleep: time.Sleep}
+}
+
+// backoff returns the wait before the given attempt, from the second on.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	wait := policy.Backoff
+	for i := 2; i < attempt && wait < maxRetryBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryBackoff {
+		wait = maxRetryBackoff
+	}
+	return wait
+}
+
+// Do runs the write, numbering its attempts from 1, and runs it again after
+// a backoff each time it fails with a retryable error, until it succeeds,
+// fails otherwise, or runs out of attempts. It returns the last error.
+func (policy *RetryPolicy) Do(description string, write func(attempt int) error) error {
+	err := write(1)
+	if policy == nil {
+		return err
+	}
+	for attempt := 2; attempt <= policy.MaxAttempts && IsRetryableError(err); attempt++ {
+		wait := policy.backoff(attempt)
+		log.Logf(log.Always, "retrying %v in %v after a transient error (attempt %v of %v): %v",
+			description, wait, attempt, policy.MaxAttempts, err)
+		policy.sleep(wait)
+		err = write(attempt)
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"errors"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("When classifying write errors", t, func() {
+		Convey("elections, dropped connections and write conflicts should be retryable", func() {
+			So(IsRetryableError(&mgo.LastError{Code: 10107, Err: "not master"}), ShouldBeTrue)
+			So(IsRetryableError(&mgo.QueryError{Code: 11602, Message: "operation was interrupted"}), ShouldBeTrue)
+			So(IsRetryableError(&mgo.LastError{Code: 112, Err: "WriteConflict"}), ShouldBeTrue)
+			So(IsRetryableError(io.EOF), ShouldBeTrue)
+			So(IsRetryableError(errors.New("read tcp 10.0.0.1:27017: connection reset by peer")), ShouldBeTrue)
+			So(IsRetryableError(errors.New("not master and slaveOk=false")), ShouldBeTrue)
+		})
+
+		Convey("other errors should not be retryable", func() {
+			So(IsRetryableError(nil), ShouldBeFalse)
+			So(IsRetryableError(&mgo.LastError{Code: 11000, Err: "E11000 duplicate key error"}), ShouldBeFalse)
+			So(IsRetryableError(errors.New("document is larger than the maximum size")), ShouldBeFalse)
+		})
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a policy of 4 attempts backing off from 100ms", t, func() {
+		policy := NewRetryPolicy(4, 100*time.Millisecond)
+		var waits []time.Duration
+		policy.sleep = func(wait time.Duration) { waits = append(waits, wait) }
+
+		Convey("a write failing with transient errors should be retried with doubling waits", func() {
+			attempts := 0
+			err := policy.Do("test write", func(attempt int) error {
+				attempts++
+				So(attempt, ShouldEqual, attempts)
+				if attempt < 3 {
+					return errors.New("not master")
+				}
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(attempts, ShouldEqual, 3)
+			So(waits, ShouldResemble, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond})
+		})
+
+		Convey("a write should fail with its last error once out of attempts", func() {
+			attempts := 0
+			err := policy.Do("test write", func(attempt int) error {
+				attempts++
+				return errors.New("connection reset by peer")
+			})
+			So(err, ShouldNotBeNil)
+			So(attempts, ShouldEqual, 4)
+		})
+
+		Convey("a write failing with another error should not be retried", func() {
+			attempts := 0
+			err := policy.Do("test write", func(attempt int) error {
+				attempts++
+				return errors.New("E11000 duplicate key error")
+			})
+			So(err, ShouldNotBeNil)
+			So(attempts, ShouldEqual, 1)
+		})
+
+		Convey("the wait should be capped", func() {
+			policy.Backoff = 20 * time.Second
+			So(policy.backoff(2), ShouldEqual, 20*time.Second)
+			So(policy.backoff(5), ShouldEqual, maxRetryBackoff)
+		})
+	})
+
+	Convey("A policy of a single attempt should not retry", t, func() {
+		policy := NewRetryPolicy(1, time.Second)
+		So(policy, ShouldBeNil)
+		attempts := 0
+		err := policy.Do("test write", func(attempt int) error {
+			attempts++
+			return errors.New("not master")
+		})
+		So(err, ShouldNotBeNil)
+		So(attempts, ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"sync/atomic"
+)
+
+// Policies for documents larger than the maximum BSON document size.
+const (
+	OversizedFail     = "fail"
+	OversizedSkip     = "skip"
+	OversizedTruncate = "truncate"
+)
+
+// SizeGuard checks the documents a tool reads or writes against the maximum
+// BSON document size, and applies a policy to the ones that exceed it:
+// failing with an error naming the document, skipping it, or removing
+// selected fields until it fits.
+type SizeGuard struct {
+	policy  string
+	fields  [][]string
+	maxSize int
+
+	skipped   int64
+	truncated int64
+}
+
+// NewSizeGuard returns a SizeGuard for the given policy, which defaults to
+// failing. truncateFields is a comma-separated list of fields to remove, in
+// order, from oversized documents under the truncate policy.
+func NewSizeGuard(policy, truncateFields string) (*SizeGuard, error) {
+	if policy == "" {
+		policy = OversizedFail
+	}
+	guard := &SizeGuard{policy: policy, maxSize: MaxBSONSize}
+	switch policy {
+	case OversizedFail, OversizedSkip:
+		if truncateFields != "" {
+			return nil, fmt.Errorf("--truncateFields can only be used with --oversizedDocs=%v", OversizedTruncate)
+		}
+	case OversizedTruncate:
+		if truncateFields == "" {
+			return nil, fmt.Errorf("--oversizedDocs=%v requires --truncateFields", OversizedTruncate)
+		}
+		for _, field := range strings.Split(truncateFields, ",") {
+			path := strings.Split(strings.TrimSpace(field), ".")
+			for _, part := range path {
+				if part == "" {
+					return nil, fmt.Errorf("invalid field '%v' in --truncateFields", field)
+				}
+			}
+			guard.fields = append(guard.fields, path)
+		}
+	default:
+		return nil, fmt.Errorf("invalid --oversizedDocs policy '%v', choose '%v', '%v' or '%v'",
+			policy, OversizedFail, OversizedSkip, OversizedTruncate)
+	}
+	return guard, nil
+}
+
+// Check returns the document to use in place of raw, which is raw itself if
+// it fits. It returns nil if the document is to be skipped, and an error if
+// it doesn't fit and the policy is to fail. A nil SizeGuard accepts every
+// document.
+func (guard *SizeGuard) Check(raw []byte, namespace string) ([]byte, error) {
+	if guard == nil || len(raw) <= guard.maxSize {
+		return raw, nil
+	}
+	id := documentID(raw)
+	switch guard.policy {
+	case OversizedSkip:
+		atomic.AddInt64(&guard.skipped, 1)
+		log.Logf(log.Always, "skipping document %v in %v: its size of %v exceeds the %v limit",
+			id, namespace, text.FormatByteAmount(int64(len(raw))), text.FormatByteAmount(int64(guard.maxSize)))
+		return nil, nil
+	case OversizedTruncate:
+		truncated, err := guard.truncate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error truncating document %v in %v: %v", id, namespace, err)
+		}
+		atomic.AddInt64(&guard.truncated, 1)
+		log.Logf(log.Always, "truncated document %v in %v from %v to %v", id, namespace,
+			text.FormatByteAmount(int64(len(raw))), text.FormatByteAmount(int64(len(truncated))))
+		return truncated, nil
+	}
+	return nil, fmt.Errorf("document %v in %v is %v, over the %v limit; use --oversizedDocs to skip or truncate it",
+		id, namespace, text.FormatByteAmount(int64(len(raw))), text.FormatByteAmount(int64(guard.maxSize)))
+}
+
+// truncate removes the --truncateFields from the document, in order, until
+// it fits.
+func (guard *SizeGuard) truncate(raw []byte) ([]byte, error) {
+	doc := bson.D{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	for _, path := range guard.fields {
+		var removed bool
+		if doc, removed = removePath(doc, path); !removed {
+			continue
+		}
+		truncated, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		if len(truncated) <= guard.maxSize {
+			return truncated, nil
+		}
+	}
+	return nil, fmt.Errorf("still over the %v limit after removing --truncateFields",
+		text.FormatByteAmount(int64(guard.maxSize)))
+}
+
+// Skipped returns the number of oversized documents skipped.
+func (guard *SizeGuard) Skipped() int64 {
+	if guard == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&guard.skipped)
+}
+
+// Truncated returns the number of oversized documents truncated.
+func (guard *SizeGuard) Truncated() int64 {
+	if guard == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&guard.truncated)
+}
+
+// LogSummary logs how many oversized documents were skipped or truncated,
+// if any.
+func (guard *SizeGuard) LogSummary() {
+	if skipped := guard.Skipped(); skipped > 0 {
+		log.Logf(log.Always, "skipped %v oversized document(s)", skipped)
+	}
+	if truncated := guard.Truncated(); truncated > 0 {
+		log.Logf(log.Always, "truncated %v oversized document(s)", truncated)
+	}
+}
+
+// removePath removes the field at the dot-delimited path from the document,
+// returning whether it was there.
+func removePath(doc bson.D, path []string) (bson.D, bool) {
+	for i, elem := range doc {
+		if elem.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(doc[:i:i], doc[i+1:]...), true
+		}
+		subdoc, ok := elem.Value.(bson.D)
+		if !ok {
+			return doc, false
+		}
+		subdoc, removed := removePath(subdoc, path[1:])
+		doc[i].Value = subdoc
+		return doc, removed
+	}
+	return doc, false
+}
+
+// documentID returns the _id of the document for identifying it in
+// messages.
+func documentID(raw []byte) string {
+	doc := struct {
+		ID interface{} `bson:"_id"`
+	}{}
+	if err := bson.Unmarshal(raw, &doc); err != nil || doc.ID == nil {
+		return "with unknown _id"
+	}
+	return fmt.Sprintf("with _id %v", doc.ID)
+}
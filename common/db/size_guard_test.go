@@ -0,0 +1,109 @@
+package db
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+func TestNewSizeGuard(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("When creating a size guard", t, func() {
+		Convey("the policy should default to failing", func() {
+			guard, err := NewSizeGuard("", "")
+			So(err, ShouldBeNil)
+			So(guard.policy, ShouldEqual, OversizedFail)
+		})
+
+		Convey("unknown policies should be rejected", func() {
+			_, err := NewSizeGuard("shrink", "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("truncate should require --truncateFields", func() {
+			_, err := NewSizeGuard(OversizedTruncate, "")
+			So(err, ShouldNotBeNil)
+			_, err = NewSizeGuard(OversizedTruncate, "a,,b")
+			So(err, ShouldNotBeNil)
+			guard, err := NewSizeGuard(OversizedTruncate, "blob, meta.history")
+			So(err, ShouldBeNil)
+			So(guard.fields, ShouldResemble, [][]string{{"blob"}, {"meta", "history"}})
+		})
+
+		Convey("--truncateFields should only be allowed with truncate", func() {
+			_, err := NewSizeGuard(OversizedSkip, "blob")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSizeGuardCheck(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a size guard limited to 100 bytes", t, func() {
+		small, err := bson.Marshal(bson.D{{"_id", 1}, {"name", "small"}})
+		So(err, ShouldBeNil)
+		large, err := bson.Marshal(bson.D{
+			{"_id", 2},
+			{"name", "large"},
+			{"blob", strings.Repeat("x", 80)},
+			{"meta", bson.D{{"history", strings.Repeat("y", 80)}}},
+		})
+		So(err, ShouldBeNil)
+
+		newGuard := func(policy, fields string) *SizeGuard {
+			guard, err := NewSizeGuard(policy, fields)
+			So(err, ShouldBeNil)
+			guard.maxSize = 100
+			return guard
+		}
+
+		Convey("documents that fit should be returned unchanged", func() {
+			for _, policy := range []string{OversizedFail, OversizedSkip} {
+				data, err := newGuard(policy, "").Check(small, "test.docs")
+				So(err, ShouldBeNil)
+				So(data, ShouldResemble, small)
+			}
+		})
+
+		Convey("a nil guard should accept every document", func() {
+			var guard *SizeGuard
+			data, err := guard.Check(large, "test.docs")
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, large)
+		})
+
+		Convey("fail should return an error naming the document", func() {
+			_, err := newGuard(OversizedFail, "").Check(large, "test.docs")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "_id 2")
+			So(err.Error(), ShouldContainSubstring, "test.docs")
+		})
+
+		Convey("skip should drop the document and count it", func() {
+			guard := newGuard(OversizedSkip, "")
+			data, err := guard.Check(large, "test.docs")
+			So(err, ShouldBeNil)
+			So(data, ShouldBeNil)
+			So(guard.Skipped(), ShouldEqual, 1)
+		})
+
+		Convey("truncate should remove fields in order until the document fits", func() {
+			guard := newGuard(OversizedTruncate, "missing,meta.history,blob,name")
+			data, err := guard.Check(large, "test.docs")
+			So(err, ShouldBeNil)
+			So(guard.Truncated(), ShouldEqual, 1)
+			doc := bson.D{}
+			So(bson.Unmarshal(data, &doc), ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{{"_id", 2}, {"name", "large"}, {"meta", bson.D{}}})
+		})
+
+		Convey("truncate should fail if removing the fields is not enough", func() {
+			guard := newGuard(OversizedTruncate, "name")
+			_, err := guard.Check(large, "test.docs")
+			So(err, ShouldNotBeNil)
+			So(guard.Truncated(), ShouldEqual, 0)
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 	"strconv"
 )
 
@@ -121,3 +122,29 @@ func BuildWriteConcern(writeConcern string, nodeType NodeType) (*mgo.Safe, error
 	)
 	return sessionSafety, nil
 }
+
+// WriteConcernDocument converts an mgo.Safe object, as returned by
+// BuildWriteConcern, into the writeConcern document of a database command,
+// for commands that write data but don't take the session's safety into
+// account. A nil mgo.Safe means an unacknowledged write concern.
+func WriteConcernDocument(sessionSafety *mgo.Safe) bson.D {
+	if sessionSafety == nil {
+		return bson.D{{w, 0}}
+	}
+	var writeConcern bson.D
+	if sessionSafety.WMode != "" {
+		writeConcern = bson.D{{w, sessionSafety.WMode}}
+	} else {
+		writeConcern = bson.D{{w, sessionSafety.W}}
+	}
+	if sessionSafety.WTimeout > 0 {
+		writeConcern = append(writeConcern, bson.DocElem{wTimeout, sessionSafety.WTimeout})
+	}
+	if sessionSafety.J {
+		writeConcern = append(writeConcern, bson.DocElem{j, true})
+	}
+	if sessionSafety.FSync {
+		writeConcern = append(writeConcern, bson.DocElem{fSync, true})
+	}
+	return writeConcern
+}
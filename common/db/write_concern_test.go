@@ -2,6 +2,8 @@ package db
 
 import (
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 	"testing"
 )
 
@@ -164,3 +166,21 @@ func TestConstructWCObject(t *testing.T) {
 		})
 	})
 }
+
+func TestWriteConcernDocument(t *testing.T) {
+	Convey("When converting a write concern into a command's writeConcern document", t, func() {
+		Convey("every field that was set should be included", func() {
+			writeConcern, err := BuildWriteConcern(`{w: "majority", wtimeout: 5000, j: true}`, ReplSet)
+			So(err, ShouldBeNil)
+			So(WriteConcernDocument(writeConcern), ShouldResemble,
+				bson.D{{"w", "majority"}, {"wtimeout", 5000}, {"j", true}})
+		})
+		Convey("a numeric w should be kept as a number", func() {
+			So(WriteConcernDocument(&mgo.Safe{W: 2, FSync: true}), ShouldResemble,
+				bson.D{{"w", 2}, {"fsync", true}})
+		})
+		Convey("an unacknowledged write concern should be w: 0", func() {
+			So(WriteConcernDocument(nil), ShouldResemble, bson.D{{"w", 0}})
+		})
+	})
+}
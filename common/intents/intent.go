@@ -323,6 +323,16 @@ func (manager *Manager) Finalize(pType PriorityType) {
 	manager.intentsByDiscoveryOrder = nil
 }
 
+// FinalizeRanked is like Finalize, but processes the intents by increasing
+// rank, as given by the rank function, and those of equal rank in the order
+// they were discovered.
+func (manager *Manager) FinalizeRanked(rank func(*Intent) int) {
+	log.Log(log.DebugHigh, "finalizing intent manager with ranked prioritizer")
+	manager.prioritizer = NewRankedPrioritizer(manager.intentsByDiscoveryOrder, rank)
+	manager.intents = nil
+	manager.intentsByDiscoveryOrder = nil
+}
+
 func (manager *Manager) UsePrioritizer(prioritizer IntentPrioritizer) {
 	manager.prioritizer = prioritizer
 }
@@ -52,6 +52,34 @@ func (legacy *legacyPrioritizer) Finish(*Intent) {
 	return
 }
 
+//===== Ranked =====
+
+// NewRankedPrioritizer returns a prioritizer processing the intents by
+// increasing rank, and the intents of equal rank in the order they were
+// read off the file system.
+func NewRankedPrioritizer(intentList []*Intent, rank func(*Intent) int) *legacyPrioritizer {
+	ranked := byRank{intents: make([]*Intent, len(intentList)), ranks: make([]int, len(intentList))}
+	copy(ranked.intents, intentList)
+	for i, intent := range ranked.intents {
+		ranked.ranks[i] = rank(intent)
+	}
+	sort.Stable(ranked)
+	return &legacyPrioritizer{queue: ranked.intents}
+}
+
+// For sorting intents by increasing rank
+type byRank struct {
+	intents []*Intent
+	ranks   []int
+}
+
+func (s byRank) Len() int { return len(s.intents) }
+func (s byRank) Swap(i, j int) {
+	s.intents[i], s.intents[j] = s.intents[j], s.intents[i]
+	s.ranks[i], s.ranks[j] = s.ranks[j], s.ranks[i]
+}
+func (s byRank) Less(i, j int) bool { return s.ranks[i] < s.ranks[j] }
+
 //===== Longest Task First =====
 
 // longestTaskFirstPrioritizer returns intents in the order of largest -> smallest,
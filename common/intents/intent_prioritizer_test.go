@@ -32,6 +32,36 @@ func TestLegacyPrioritizer(t *testing.T) {
 	})
 }
 
+func TestRankedPrioritizer(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a rankedPrioritizer initialized with an ordered intent list", t, func() {
+		testList := []*Intent{
+			&Intent{DB: "a", C: "1"},
+			&Intent{DB: "b", C: "1"},
+			&Intent{DB: "a", C: "2"},
+			&Intent{DB: "c", C: "1"},
+		}
+		ranks := map[string]int{"b": 0, "a": 1}
+		ranked := NewRankedPrioritizer(testList, func(intent *Intent) int {
+			if rank, ok := ranks[intent.DB]; ok {
+				return rank
+			}
+			return len(ranks)
+		})
+		So(ranked, ShouldNotBeNil)
+
+		Convey("the intents should come by rank, then in their listed order", func() {
+			order := []string{}
+			for intent := ranked.Get(); intent != nil; intent = ranked.Get() {
+				order = append(order, intent.Namespace())
+			}
+			So(order, ShouldResemble, []string{"b.1", "a.1", "a.2", "c.1"})
+		})
+	})
+}
+
 func TestBasicDBHeapBehavior(t *testing.T) {
 	var dbheap heap.Interface
 
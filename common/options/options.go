@@ -98,6 +98,8 @@ func (v Verbosity) IsQuiet() bool {
 type Connection struct {
 	Host string `short:"h" long:"host" description:"mongodb host to connect to (setname/host1,host2 for replica sets)"`
 	Port string `long:"port" description:"server port (can also use --host hostname:port)"`
+
+	AppLabel string `long:"appLabel" description:"a label, such as a job name, appended to the application name the tool's connections are tagged with, e.g. 'mongodump r3.4.0 backup nightly-backup', to tell its operations apart in currentOp and the server logs (MongoDB 3.4 and later)"`
 }
 
 // Struct holding ssl-related options
@@ -115,9 +117,12 @@ type SSL struct {
 // Struct holding auth-related options
 type Auth struct {
 	Username  string `short:"u" long:"username" description:"username for authentication"`
-	Password  string `short:"p" long:"password" description:"password for authentication"`
+	Password  string `short:"p" long:"password" description:"password for authentication; leave out to be prompted for it, so it doesn't show in the process list"`
 	Source    string `long:"authenticationDatabase" description:"database that holds the user's credentials"`
 	Mechanism string `long:"authenticationMechanism" description:"authentication mechanism to use"`
+
+	CacheCredentials  bool `long:"cacheCredentials" description:"remember the password entered at the prompt in the OS keychain (the macOS Keychain, or the Secret Service on Linux) once it has been used to connect, and use it instead of prompting next time"`
+	ForgetCredentials bool `long:"forgetCredentials" description:"remove the password remembered with --cacheCredentials for this user, host and authentication database from the OS keychain"`
 }
 
 // Struct for Kerberos/GSSAPI-specific options
@@ -251,6 +256,56 @@ func (o *ToolOptions) GetAuthenticationDatabase() string {
 	return ""
 }
 
+// CredentialAccount identifies the credentials of the user on the host, for
+// --cacheCredentials: user@host/authenticationDatabase.
+func (o *ToolOptions) CredentialAccount() string {
+	host := "localhost"
+	if o.Connection != nil && o.Host != "" {
+		host = o.Host
+	}
+	if o.Connection != nil && o.Port != "" {
+		host += ":" + o.Port
+	}
+	return fmt.Sprintf("%v@%v/%v", o.Auth.Username, host, o.GetAuthenticationDatabase())
+}
+
+// maxClientAppNameLength is the longest application name servers accept in
+// the client metadata of a connection.
+const maxClientAppNameLength = 128
+
+// toolPurposes tell what each tool's connections are for, in their
+// application name.
+var toolPurposes = map[string]string{
+	"mongodump":    "backup",
+	"mongoexport":  "export",
+	"mongofiles":   "gridfs",
+	"mongoimport":  "import",
+	"mongooplog":   "oplog-replay",
+	"mongoprune":   "prune",
+	"mongorestore": "restore",
+	"mongotop":     "monitoring",
+}
+
+// ClientAppName returns the application name the tool's connections are
+// tagged with: the tool's name, version and purpose, followed by the
+// --appLabel.
+func (o *ToolOptions) ClientAppName() string {
+	appName := o.AppName
+	if o.VersionStr != "" {
+		appName += " " + o.VersionStr
+	}
+	if purpose := toolPurposes[o.AppName]; purpose != "" {
+		appName += " " + purpose
+	}
+	if o.Connection != nil && o.AppLabel != "" {
+		appName += " " + o.AppLabel
+	}
+	if len(appName) > maxClientAppNameLength {
+		appName = appName[:maxClientAppNameLength]
+	}
+	return appName
+}
+
 // AddOptions registers an additional options group to this instance
 func (o *ToolOptions) AddOptions(opts ExtraOptions) error {
 	_, err := o.parser.AddGroup(opts.Name()+" options", "", opts)
@@ -267,6 +322,11 @@ func (o *ToolOptions) Parse() ([]string, error) {
 	return o.parser.Parse()
 }
 
+// ParseArgs parses the given args instead of the command line's, as Parse.
+func (o *ToolOptions) ParseArgs(args []string) ([]string, error) {
+	return o.parser.ParseArgs(args)
+}
+
 func parseHiddenOption(opts *HiddenOptions, option string, arg flags.SplitArgument, args []string) ([]string, error) {
 	if option == "dbpath" || option == "directoryperdb" || option == "journal" {
 		return args, fmt.Errorf(`--dbpath and related flags are not supported in 3.0 tools.
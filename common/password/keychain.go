@@ -0,0 +1,78 @@
+package password
+
+import (
+	"github.com/mongodb/mongo-tools/common/log"
+	"sync"
+)
+
+// keychainService names the entries the tools keep in the OS keychain.
+const keychainService = "mongo-tools"
+
+// keychain stores passwords by account.
+type keychain interface {
+	get(account string) (string, error)
+	set(account, pass string) error
+	delete(account string) error
+}
+
+// osKeychain is the OS keychain, reached through the platform's command.
+type osKeychain struct{}
+
+// the keychain and the prompt used, replaced in tests
+var (
+	defaultKeychain keychain = osKeychain{}
+	prompt                   = Prompt
+)
+
+// prompted holds the passwords entered at the prompt, by account, until
+// they are known to be right and can be stored in the keychain.
+var prompted = struct {
+	sync.Mutex
+	passwords map[string]string
+}{passwords: map[string]string{}}
+
+// PromptOrCached returns the password for the account. With cache set, the
+// password is looked up in the OS keychain first, and the one entered at
+// the prompt is kept to be stored there by Remember once it has been used to
+// connect; otherwise it's always prompted for.
+func PromptOrCached(account string, cache bool) string {
+	if !cache {
+		return prompt()
+	}
+	pass, err := defaultKeychain.get(account)
+	if err == nil && pass != "" {
+		log.Logf(log.DebugLow, "using the password for %v cached in the OS keychain", account)
+		return pass
+	}
+	if err != nil {
+		log.Logf(log.DebugLow, "no password for %v cached in the OS keychain: %v", account, err)
+	}
+	pass = prompt()
+	prompted.Lock()
+	prompted.passwords[account] = pass
+	prompted.Unlock()
+	return pass
+}
+
+// Remember stores the password entered at the prompt for the account in
+// the OS keychain, once it has been used to connect, so a mistyped password
+// is never cached. It does nothing if no password was prompted for.
+func Remember(account string) {
+	prompted.Lock()
+	pass, ok := prompted.passwords[account]
+	delete(prompted.passwords, account)
+	prompted.Unlock()
+	if !ok {
+		return
+	}
+	if err := defaultKeychain.set(account, pass); err != nil {
+		log.Logf(log.Always, "warning: could not cache the password in the OS keychain: %v", err)
+	} else {
+		log.Logf(log.Info, "cached the password for %v in the OS keychain", account)
+	}
+}
+
+// Forget removes the account's password from the OS keychain.
+func Forget(account string) error {
+	return defaultKeychain.delete(account)
+}
@@ -0,0 +1,41 @@
+package password
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// The macOS Keychain is reached through the security command. Passwords
+// are given to it on standard input, so they never show in its arguments.
+
+func (osKeychain) get(account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password",
+		"-s", keychainService, "-a", account, "-w").Output()
+	if err != nil {
+		return "", fmt.Errorf("security find-generic-password: %v", err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func (osKeychain) set(account, pass string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %v -a %v -w %v\n",
+		strconv.Quote(keychainService), strconv.Quote(account), strconv.Quote(pass)))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("security add-generic-password: %v %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (osKeychain) delete(account string) error {
+	if err := exec.Command("security", "delete-generic-password",
+		"-s", keychainService, "-a", account).Run(); err != nil {
+		return fmt.Errorf("security delete-generic-password: %v", err)
+	}
+	return nil
+}
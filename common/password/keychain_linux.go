@@ -0,0 +1,41 @@
+package password
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service, such as GNOME Keyring or KWallet, is reached through
+// the secret-tool command from libsecret. Passwords are given to it on
+// standard input, so they never show in its arguments.
+
+func (osKeychain) get(account string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup",
+		"service", keychainService, "account", account).Output()
+	if err != nil {
+		return "", fmt.Errorf("secret-tool lookup: %v", err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func (osKeychain) set(account, pass string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", keychainService+" "+account,
+		"service", keychainService, "account", account)
+	cmd.Stdin = strings.NewReader(pass)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("secret-tool store: %v %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (osKeychain) delete(account string) error {
+	if err := exec.Command("secret-tool", "clear",
+		"service", keychainService, "account", account).Run(); err != nil {
+		return fmt.Errorf("secret-tool clear: %v", err)
+	}
+	return nil
+}
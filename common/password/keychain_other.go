@@ -0,0 +1,22 @@
+// +build !darwin,!linux
+
+package password
+
+import (
+	"fmt"
+)
+
+// errNoKeychain is returned on the platforms without a supported keychain.
+var errNoKeychain = fmt.Errorf("caching credentials is only supported on macOS and Linux")
+
+func (osKeychain) get(account string) (string, error) {
+	return "", errNoKeychain
+}
+
+func (osKeychain) set(account, pass string) error {
+	return errNoKeychain
+}
+
+func (osKeychain) delete(account string) error {
+	return errNoKeychain
+}
@@ -0,0 +1,100 @@
+package password
+
+import (
+	"errors"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// fakeKeychain keeps passwords in memory.
+type fakeKeychain map[string]string
+
+func (k fakeKeychain) get(account string) (string, error) {
+	pass, ok := k[account]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return pass, nil
+}
+
+func (k fakeKeychain) set(account, pass string) error {
+	k[account] = pass
+	return nil
+}
+
+func (k fakeKeychain) delete(account string) error {
+	if _, ok := k[account]; !ok {
+		return errors.New("not found")
+	}
+	delete(k, account)
+	return nil
+}
+
+func TestPromptOrCached(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a keychain", t, func() {
+		keychain := fakeKeychain{}
+		defaultKeychain = keychain
+		prompts := 0
+		prompt = func() string {
+			prompts++
+			return "typed"
+		}
+		account := "user@localhost/admin"
+
+		Convey("a cached password should be used without prompting", func() {
+			keychain[account] = "cached"
+			So(PromptOrCached(account, true), ShouldEqual, "cached")
+			So(prompts, ShouldEqual, 0)
+		})
+
+		Convey("a prompted password should only be cached once remembered", func() {
+			So(PromptOrCached(account, true), ShouldEqual, "typed")
+			So(prompts, ShouldEqual, 1)
+			_, cached := keychain[account]
+			So(cached, ShouldBeFalse)
+
+			Remember(account)
+			So(keychain[account], ShouldEqual, "typed")
+
+			Convey("and then used without prompting", func() {
+				So(PromptOrCached(account, true), ShouldEqual, "typed")
+				So(prompts, ShouldEqual, 1)
+			})
+		})
+
+		Convey("a password that isn't remembered, as it failed to connect, should never be cached", func() {
+			PromptOrCached(account, true)
+			Remember("other@localhost/admin")
+			So(keychain, ShouldBeEmpty)
+		})
+
+		Convey("remembering an account without a prompted password should cache nothing", func() {
+			Remember(account)
+			So(keychain, ShouldBeEmpty)
+		})
+
+		Convey("without caching, the password should always be prompted for and never cached", func() {
+			keychain[account] = "cached"
+			So(PromptOrCached(account, false), ShouldEqual, "typed")
+			Remember(account)
+			So(keychain[account], ShouldEqual, "cached")
+		})
+
+		Convey("a forgotten password should be removed from the keychain", func() {
+			keychain[account] = "cached"
+			So(Forget(account), ShouldBeNil)
+			So(keychain, ShouldBeEmpty)
+			So(Forget(account), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			defaultKeychain = osKeychain{}
+			prompt = Prompt
+			prompted.passwords = map[string]string{}
+		})
+	})
+}
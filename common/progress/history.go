@@ -0,0 +1,137 @@
+package progress
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// HistoryLength is the number of throughput samples a bar keeps, one
+	// taken each time the bar is written, so with the default wait time a
+	// sparkline covers the last half minute.
+	HistoryLength = 10
+
+	// SlowdownRatio is the fraction of its earlier average throughput below
+	// which a bar's latest throughput is reported as slowing.
+	SlowdownRatio = 0.5
+
+	// TrendSlowing and TrendStalled are written after the sparkline of a bar
+	// whose throughput has dropped.
+	TrendSlowing = "slowing"
+	TrendStalled = "stalled"
+)
+
+// SparkLevels are the characters of a sparkline, from the lowest
+// throughput to the highest.
+var SparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// throughputSample is the amount completed at a point in time.
+type throughputSample struct {
+	time   time.Time
+	amount int64
+}
+
+// throughputHistory is a rolling history of the amounts completed, from
+// which the throughput between samples is derived.
+type throughputHistory struct {
+	samples []throughputSample
+}
+
+// record adds a sample, dropping the oldest once HistoryLength+1 are kept,
+// so that the history holds HistoryLength throughputs.
+func (history *throughputHistory) record(now time.Time, amount int64) {
+	history.samples = append(history.samples, throughputSample{now, amount})
+	if len(history.samples) > HistoryLength+1 {
+		history.samples = history.samples[len(history.samples)-HistoryLength-1:]
+	}
+}
+
+// rates returns the amount completed per second between each sample and the
+// one before it, oldest first.
+func (history *throughputHistory) rates() []float64 {
+	rates := []float64{}
+	for i := 1; i < len(history.samples); i++ {
+		elapsed := history.samples[i].time.Sub(history.samples[i-1].time).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		rates = append(rates, float64(history.samples[i].amount-history.samples[i-1].amount)/elapsed)
+	}
+	return rates
+}
+
+// sparkline draws the throughputs, each scaled to the highest of them, or
+// returns "" until there are two to compare.
+func sparkline(rates []float64) string {
+	if len(rates) < 2 {
+		return ""
+	}
+	max := 0.0
+	for _, rate := range rates {
+		if rate > max {
+			max = rate
+		}
+	}
+	line := make([]rune, len(rates))
+	for i, rate := range rates {
+		level := 0
+		if max > 0 && rate > 0 {
+			level = int(rate / max * float64(len(SparkLevels)-1))
+		}
+		line[i] = SparkLevels[level]
+	}
+	return string(line)
+}
+
+// trend returns TrendStalled if nothing was completed since the previous
+// sample while something was before, TrendSlowing if the latest throughput
+// is under SlowdownRatio of the average of the earlier ones, or else "".
+func trend(rates []float64) string {
+	if len(rates) < 2 {
+		return ""
+	}
+	earlier := 0.0
+	for _, rate := range rates[:len(rates)-1] {
+		earlier += rate
+	}
+	earlier /= float64(len(rates) - 1)
+	latest := rates[len(rates)-1]
+	switch {
+	case earlier <= 0:
+		return ""
+	case latest <= 0:
+		return TrendStalled
+	case latest < earlier*SlowdownRatio:
+		return TrendSlowing
+	}
+	return ""
+}
+
+// formatHistory records the amount completed and returns the sparkline of
+// the bar's recent throughput, followed by its trend if it has dropped, or
+// "" if the bar doesn't show its history.
+func (pb *Bar) formatHistory(currentCount int64) string {
+	if !pb.ShowHistory {
+		return ""
+	}
+	pb.history.record(time.Now(), currentCount)
+	rates := pb.history.rates()
+	line := sparkline(rates)
+	if t := trend(rates); t != "" {
+		line += " " + t
+	}
+	return line
+}
+
+// HistoryShownOn returns whether bars written to w should show their
+// history: only if w is a terminal, as the sparkline's characters are noise
+// in a log file or a pipe.
+func HistoryShownOn(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,65 @@
+package progress
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestThroughputHistory(t *testing.T) {
+
+	Convey("With a history of samples taken a second apart", t, func() {
+		history := &throughputHistory{}
+		start := time.Now()
+		for i, amount := range []int64{0, 100, 300, 600, 800, 820} {
+			history.record(start.Add(time.Duration(i)*time.Second), amount)
+		}
+
+		Convey("the rates between samples should be kept in order", func() {
+			So(history.rates(), ShouldResemble, []float64{100, 200, 300, 200, 20})
+		})
+
+		Convey("the sparkline should scale them to the highest", func() {
+			So(sparkline(history.rates()), ShouldEqual, "▃▅█▅▁")
+		})
+
+		Convey("a drop in the latest rate should be noted", func() {
+			So(trend(history.rates()), ShouldEqual, TrendSlowing)
+			history.record(start.Add(6*time.Second), 820)
+			So(trend(history.rates()), ShouldEqual, TrendStalled)
+		})
+
+		Convey("only the latest HistoryLength rates should be kept", func() {
+			for i := 6; i < 20; i++ {
+				history.record(start.Add(time.Duration(i)*time.Second), int64(i*100))
+			}
+			So(len(history.rates()), ShouldEqual, HistoryLength)
+			So(trend(history.rates()), ShouldEqual, "")
+		})
+	})
+
+	Convey("Nothing should be drawn until there are two rates to compare", t, func() {
+		So(sparkline([]float64{5}), ShouldEqual, "")
+		So(trend([]float64{5}), ShouldEqual, "")
+	})
+
+	Convey("A bar should only show its history when asked to", t, func() {
+		pbar := &Bar{Name: "test", Watching: NewCounter(0)}
+		So(pbar.formatHistory(10), ShouldEqual, "")
+		pbar.ShowHistory = true
+		pbar.formatHistory(10)
+		So(len(pbar.history.samples), ShouldEqual, 1)
+	})
+
+	Convey("The history should only be shown on a terminal", t, func() {
+		So(HistoryShownOn(&bytes.Buffer{}), ShouldBeFalse)
+		file, err := ioutil.TempFile("", "progress_history")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+		defer file.Close()
+		So(HistoryShownOn(file), ShouldBeFalse)
+	})
+}
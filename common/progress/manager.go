@@ -52,6 +52,7 @@ func (manager *Manager) Attach(pb *Bar) {
 		}
 	}
 
+	pb.startTime = time.Now()
 	manager.bars = append(manager.bars, pb)
 }
 
@@ -90,7 +90,18 @@ type Bar struct {
 	// WaitTime is the time to wait between writing the bar
 	WaitTime time.Duration
 
-	stopChan chan struct{}
+	// ShowRate adds the amount completed per second and, when the total
+	// amount is known, the estimated time remaining
+	ShowRate bool
+
+	// ShowHistory adds a sparkline of the bar's throughput each time it was
+	// written, over its last HistoryLength writes, and notes when the latest
+	// throughput has dropped well below the earlier one
+	ShowHistory bool
+
+	history   throughputHistory
+	startTime time.Time
+	stopChan  chan struct{}
 }
 
 // Start starts the Bar goroutine. Once Start is called, a bar will
@@ -104,6 +115,7 @@ func (pb *Bar) Start() {
 		panic("Cannot use a Bar with an unset Writer")
 	}
 	pb.stopChan = make(chan struct{})
+	pb.startTime = time.Now()
 
 	go pb.start()
 }
@@ -136,23 +148,56 @@ func (pb *Bar) formatCounts() (string, string) {
 	return fmt.Sprintf("%v", maxCount), fmt.Sprintf("%v", currentCount)
 }
 
+// formatRate returns the amount completed per second since the bar was
+// started, followed by the estimated time remaining if the total amount is
+// known, or "" if the bar doesn't show its rate.
+func (pb *Bar) formatRate(maxCount, currentCount int64) string {
+	if !pb.ShowRate || pb.startTime.IsZero() {
+		return ""
+	}
+	elapsed := time.Since(pb.startTime).Seconds()
+	if elapsed <= 0 {
+		return ""
+	}
+	rate := float64(currentCount) / elapsed
+	var rateStr string
+	if pb.IsBytes {
+		rateStr = fmt.Sprintf("%v/s", text.FormatByteAmount(int64(rate)))
+	} else {
+		rateStr = fmt.Sprintf("%.0f/s", rate)
+	}
+	if maxCount == 0 || currentCount >= maxCount || rate == 0 {
+		return rateStr
+	}
+	remaining := time.Duration(float64(maxCount-currentCount) / rate * float64(time.Second))
+	return fmt.Sprintf("%v, ETA %v", rateStr, remaining/time.Second*time.Second)
+}
+
 // computes all necessary values renders to the bar's Writer
 func (pb *Bar) renderToWriter() {
 	maxCount, currentCount := pb.Watching.Progress()
 	maxStr, currentStr := pb.formatCounts()
+	rateStr := pb.formatRate(maxCount, currentCount)
+	if rateStr != "" {
+		rateStr = " " + rateStr
+	}
+	if historyStr := pb.formatHistory(currentCount); historyStr != "" {
+		rateStr += " " + historyStr
+	}
 	if maxCount == 0 {
 		// if we have no max amount, just print a count
-		fmt.Fprintf(pb.Writer, "%v\t%v", pb.Name, currentStr)
+		fmt.Fprintf(pb.Writer, "%v\t%v%v", pb.Name, currentStr, rateStr)
 		return
 	}
 	// otherwise, print a bar and percents
 	percent := float64(currentCount) / float64(maxCount)
-	fmt.Fprintf(pb.Writer, "%v %v\t%s/%s (%2.1f%%)",
+	fmt.Fprintf(pb.Writer, "%v %v\t%s/%s (%2.1f%%)%v",
 		drawBar(pb.BarLength, percent),
 		pb.Name,
 		currentStr,
 		maxStr,
 		percent*100,
+		rateStr,
 	)
 }
 
@@ -171,6 +216,12 @@ func (pb *Bar) renderToGridRow(grid *text.GridWriter) {
 			fmt.Sprintf("(%2.1f%%)", percent*100),
 		)
 	}
+	if rateStr := pb.formatRate(maxCount, currentCount); rateStr != "" {
+		grid.WriteCell(rateStr)
+	}
+	if historyStr := pb.formatHistory(currentCount); historyStr != "" {
+		grid.WriteCell(historyStr)
+	}
 	grid.EndRow()
 }
 
@@ -181,3 +181,32 @@ func TestBarUnits(t *testing.T) {
 		})
 	})
 }
+
+func TestProgressBarRate(t *testing.T) {
+
+	Convey("With a ProgressBar showing its rate, started ten seconds ago", t, func() {
+		watching := NewCounter(1000)
+		watching.Inc(250)
+		pbar := &Bar{
+			Name:      "test",
+			Watching:  watching,
+			BarLength: 10,
+			ShowRate:  true,
+			startTime: time.Now().Add(-10 * time.Second),
+		}
+
+		Convey("the rate and estimated time remaining should be shown", func() {
+			So(pbar.formatRate(watching.Progress()), ShouldEqual, "25/s, ETA 30s")
+		})
+
+		Convey("only the rate should be shown once done or without a max", func() {
+			So(pbar.formatRate(1000, 1000), ShouldEqual, "100/s")
+			So(pbar.formatRate(0, 250), ShouldEqual, "25/s")
+		})
+
+		Convey("nothing should be shown for a bar not showing its rate", func() {
+			pbar.ShowRate = false
+			So(pbar.formatRate(watching.Progress()), ShouldEqual, "")
+		})
+	})
+}
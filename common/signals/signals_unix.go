@@ -16,3 +16,16 @@ func Handle() {
 	<-sigChan
 	os.Exit(util.ExitKill)
 }
+
+// NotifyPause relays SIGUSR1, asking the tool to pause, to pause, and
+// SIGUSR2, asking it to resume, to resume.
+func NotifyPause(pause, resume chan<- os.Signal) {
+	signal.Notify(pause, syscall.SIGUSR1)
+	signal.Notify(resume, syscall.SIGUSR2)
+}
+
+// StopPause stops relaying the signals of NotifyPause to the channels.
+func StopPause(pause, resume chan<- os.Signal) {
+	signal.Stop(pause)
+	signal.Stop(resume)
+}
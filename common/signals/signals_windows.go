@@ -14,3 +14,10 @@ func Handle() {
 	<-sigChan
 	os.Exit(util.ExitKill)
 }
+
+// NotifyPause does nothing, as Windows has no signals to pause and resume
+// with.
+func NotifyPause(pause, resume chan<- os.Signal) {}
+
+// StopPause does nothing, as NotifyPause does nothing.
+func StopPause(pause, resume chan<- os.Signal) {}
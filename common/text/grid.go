@@ -12,8 +12,24 @@ import (
 type Cell struct {
 	contents string
 	feed     bool
+
+	// color is an ANSI escape sequence, such as ColorRed, applied to the
+	// cell's contents but not its padding
+	color string
 }
 
+// ANSI escape sequences for coloring cells written with WriteColoredCell.
+const (
+	ColorRed     = "\x1b[31m"
+	ColorGreen   = "\x1b[32m"
+	ColorYellow  = "\x1b[33m"
+	ColorBlue    = "\x1b[34m"
+	ColorMagenta = "\x1b[35m"
+	ColorCyan    = "\x1b[36m"
+
+	colorReset = "\x1b[0m"
+)
+
 type GridWriter struct {
 	ColumnPadding int
 	MinWidth      int
@@ -40,7 +56,15 @@ func (gw *GridWriter) init() {
 // WriteCell writes the given string into the next cell in the current row.
 func (gw *GridWriter) WriteCell(data string) {
 	gw.init()
-	gw.Grid[gw.CurrentRow] = append(gw.Grid[gw.CurrentRow], Cell{data, false})
+	gw.Grid[gw.CurrentRow] = append(gw.Grid[gw.CurrentRow], Cell{contents: data})
+}
+
+// WriteColoredCell writes the given string into the next cell in the current
+// row, colored with the given ANSI escape sequence. An empty color writes a
+// plain cell.
+func (gw *GridWriter) WriteColoredCell(data, color string) {
+	gw.init()
+	gw.Grid[gw.CurrentRow] = append(gw.Grid[gw.CurrentRow], Cell{contents: data, color: color})
 }
 
 // WriteCells writes multiple cells by calling WriteCell for each argument.
@@ -54,7 +78,7 @@ func (gw *GridWriter) WriteCells(data ...string) {
 // to extend past the width of the current column, and ends the row.
 func (gw *GridWriter) Feed(data string) {
 	gw.init()
-	gw.Grid[gw.CurrentRow] = append(gw.Grid[gw.CurrentRow], Cell{data, true})
+	gw.Grid[gw.CurrentRow] = append(gw.Grid[gw.CurrentRow], Cell{contents: data, feed: true})
 	gw.EndRow()
 }
 
@@ -142,7 +166,16 @@ func (gw *GridWriter) Flush(w io.Writer) {
 		lastRow := i == (len(gw.Grid) - 1)
 		for j, cell := range row {
 			lastCol := (j == len(row)-1)
-			fmt.Fprintf(w, fmt.Sprintf("%%%vs", gw.colWidths[j]), cell.contents)
+			if cell.color != "" {
+				// pad outside of the escape sequences, which take up no width
+				padding := gw.colWidths[j] - len(cell.contents)
+				if padding > 0 {
+					fmt.Fprint(w, strings.Repeat(" ", padding))
+				}
+				fmt.Fprint(w, cell.color+cell.contents+colorReset)
+			} else {
+				fmt.Fprintf(w, fmt.Sprintf("%%%vs", gw.colWidths[j]), cell.contents)
+			}
 			if gw.ColumnPadding > 0 && !lastCol {
 				fmt.Fprint(w, strings.Repeat(" ", gw.ColumnPadding))
 			}
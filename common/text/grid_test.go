@@ -102,3 +102,21 @@ func TestWriteGrid(t *testing.T) {
 		So(gw.calculateWidths(), ShouldResemble, []int{7, 2, 4, 9})
 	})
 }
+
+func TestWriteColoredCells(t *testing.T) {
+	Convey("With a grid writer with colored cells", t, func() {
+		gw := GridWriter{ColumnPadding: 1}
+		gw.WriteCells("name", "queue")
+		gw.EndRow()
+		gw.WriteCell("a")
+		gw.WriteColoredCell("12", ColorRed)
+		gw.EndRow()
+
+		Convey("only the contents should be colored, leaving the columns aligned", func() {
+			buf := bytes.Buffer{}
+			gw.Flush(&buf)
+			So(buf.String(), ShouldEqual,
+				"name queue\n   a    "+ColorRed+"12"+colorReset+"\n")
+		})
+	})
+}
@@ -2,6 +2,8 @@ package text
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -46,3 +48,39 @@ func formatUnitAmount(base, size int64, resultFormat string, units []string) str
 	}
 	return fmt.Sprintf(resultFormat, result, units[i-1])
 }
+
+// ParseByteAmount parses a human-readable size such as "2GB", "512M" or
+// "1048576" into a number of bytes. Units are binary, so 1KB is 1024 bytes;
+// both the long and short unit forms are accepted, case-insensitively.
+func ParseByteAmount(amount string) (int64, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(amount))
+	multiplier := int64(1)
+	for i := len(longByteUnits) - 1; i > 0; i-- {
+		if strings.HasSuffix(trimmed, longByteUnits[i]) {
+			trimmed = strings.TrimSuffix(trimmed, longByteUnits[i])
+			multiplier = pow(binary, i)
+			break
+		}
+		if strings.HasSuffix(trimmed, shortByteUnits[i]) {
+			trimmed = strings.TrimSuffix(trimmed, shortByteUnits[i])
+			multiplier = pow(binary, i)
+			break
+		}
+	}
+	if multiplier == 1 {
+		trimmed = strings.TrimSuffix(trimmed, longByteUnits[0])
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(trimmed), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid byte amount '%v'", amount)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+func pow(base int64, exp int) int64 {
+	result := int64(1)
+	for ; exp > 0; exp-- {
+		result *= base
+	}
+	return result
+}
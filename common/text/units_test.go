@@ -56,3 +56,33 @@ func TestOtherByteFormats(t *testing.T) {
 		})
 	})
 }
+
+func TestParseByteAmount(t *testing.T) {
+	Convey("With some sample byte amount strings", t, func() {
+		Convey("plain numbers are bytes", func() {
+			size, err := ParseByteAmount("1048576")
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, 1048576)
+			size, err = ParseByteAmount("100B")
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, 100)
+		})
+		Convey("long and short units are binary multiples", func() {
+			size, err := ParseByteAmount("2GB")
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, 2*1024*1024*1024)
+			size, err = ParseByteAmount("512m")
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, 512*1024*1024)
+			size, err = ParseByteAmount("1.5KB")
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, 1536)
+		})
+		Convey("malformed amounts are rejected", func() {
+			for _, amount := range []string{"", "GB", "two GB", "-1MB", "10TB"} {
+				_, err := ParseByteAmount(amount)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
@@ -0,0 +1,128 @@
+package mongodump
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+)
+
+// archiveChecksum is an order-independent digest of a set of documents:
+// their count, and the sum of a hash of each.
+type archiveChecksum struct {
+	count int64
+	sum   uint64
+}
+
+// add includes a document in the checksum.
+func (checksum *archiveChecksum) add(doc []byte) {
+	hash := md5.Sum(doc)
+	checksum.count++
+	checksum.sum += binary.BigEndian.Uint64(hash[:8])
+}
+
+// String returns the count and checksum, for logging.
+func (checksum *archiveChecksum) String() string {
+	return fmt.Sprintf("%v documents with checksum %016x", checksum.count, checksum.sum)
+}
+
+// checksumWriter adds each document written through it to a checksum and,
+// if ids is set, records its _id. dumpIterToWriter writes whole documents,
+// one or more per call.
+type checksumWriter struct {
+	io.Writer
+	checksum *archiveChecksum
+	ids      *[]interface{}
+}
+
+// Write is part of the io.Writer interface.
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	n, err := cw.Writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	for len(p) > 0 {
+		size := documentSize(p)
+		cw.checksum.add(p[:size])
+		if cw.ids != nil {
+			var doc struct {
+				ID interface{} `bson:"_id"`
+			}
+			if err = bson.Unmarshal(p[:size], &doc); err != nil {
+				return n, fmt.Errorf("error reading the _id of a dumped document: %v", err)
+			}
+			*cw.ids = append(*cw.ids, doc.ID)
+		}
+		p = p[size:]
+	}
+	return n, nil
+}
+
+// DeleteArchived deletes the documents dumped with --archiveThenDelete from
+// their collection, once it has checked that the collection still holds
+// exactly the documents dumped. Only the _ids dumped are deleted, so
+// documents matching --query written after the check are kept. Documents are
+// deleted in batches of --deleteBatchSize, at most --deleteRateLimit per
+// second.
+func (dump *MongoDump) DeleteArchived() error {
+	if dump.archived == nil {
+		return nil
+	}
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	// read what is about to be deleted from the primary
+	session.SetMode(mgo.Strong, true)
+	session.SetCursorTimeout(0)
+	collection := session.DB(dump.ToolOptions.DB).C(dump.ToolOptions.Collection)
+	namespace := collection.FullName
+
+	log.Logf(log.Always, "checking that %v still holds the %v dumped", namespace, dump.archived)
+	onServer := &archiveChecksum{}
+	iter := collection.Find(dump.query).Iter()
+	raw := bson.Raw{}
+	for iter.Next(&raw) {
+		onServer.add(raw.Data)
+	}
+	if err = iter.Close(); err != nil {
+		return fmt.Errorf("error reading %v: %v", namespace, err)
+	}
+	if *onServer != *dump.archived {
+		return fmt.Errorf("not deleting from %v: the query now matches %v, but %v were dumped; "+
+			"the collection changed since the dump", namespace, onServer, dump.archived)
+	}
+
+	log.Logf(log.Always, "deleting %v archived documents from %v", dump.archived.count, namespace)
+	deleteProgressor := progress.NewCounter(dump.archived.count)
+	bar := &progress.Bar{
+		Name:      namespace,
+		Watching:  deleteProgressor,
+		BarLength: progressBarLength,
+		ShowRate:  true,
+	}
+	progressManager := progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
+	progressManager.Attach(bar)
+	progressManager.Start()
+	defer progressManager.Stop()
+
+	limiter := db.NewRateLimiter(dump.OutputOptions.DeleteRateLimit)
+	deleted, err := db.DeleteIDsInBatches(collection, dump.query, dump.archivedIDs,
+		dump.OutputOptions.DeleteBatchSize, limiter, deleteProgressor.Inc)
+	if err != nil {
+		return fmt.Errorf("error deleting from %v after deleting %v documents: %v", namespace, deleted, err)
+	}
+	if deleted != dump.archived.count {
+		log.Logf(log.Always, "warning: deleted %v documents from %v, but %v were dumped; "+
+			"dumped documents were deleted or changed during the deletion", deleted, namespace, dump.archived.count)
+	} else {
+		log.Logf(log.Always, "deleted %v archived documents from %v", deleted, namespace)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package mongodump
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestArchiveChecksum(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With documents to checksum", t, func() {
+		docs := [][]byte{}
+		for i := 0; i < 3; i++ {
+			doc, err := bson.Marshal(bson.D{{"_id", i}, {"level", "debug"}})
+			So(err, ShouldBeNil)
+			docs = append(docs, doc)
+		}
+
+		Convey("the checksum should not depend on the order of the documents", func() {
+			forward, backward := &archiveChecksum{}, &archiveChecksum{}
+			for i := range docs {
+				forward.add(docs[i])
+				backward.add(docs[len(docs)-1-i])
+			}
+			So(forward.count, ShouldEqual, 3)
+			So(*forward, ShouldResemble, *backward)
+		})
+
+		Convey("the checksum should change with any document", func() {
+			all, some := &archiveChecksum{}, &archiveChecksum{}
+			for _, doc := range docs {
+				all.add(doc)
+			}
+			some.add(docs[0])
+			some.add(docs[1])
+			changed, err := bson.Marshal(bson.D{{"_id", 2}, {"level", "info"}})
+			So(err, ShouldBeNil)
+			some.add(changed)
+			So(some.count, ShouldEqual, all.count)
+			So(some.sum, ShouldNotEqual, all.sum)
+		})
+
+		Convey("the documents written through a checksumWriter should be checksummed", func() {
+			expected, checksum := &archiveChecksum{}, &archiveChecksum{}
+			out := &bytes.Buffer{}
+			writer := &checksumWriter{Writer: out, checksum: checksum}
+			for _, doc := range docs {
+				expected.add(doc)
+				_, err := writer.Write(doc)
+				So(err, ShouldBeNil)
+			}
+			So(*checksum, ShouldResemble, *expected)
+			So(out.Len(), ShouldEqual, len(docs[0])+len(docs[1])+len(docs[2]))
+		})
+
+		Convey("a batch of documents written at once should be checksummed document by document", func() {
+			expected, checksum := &archiveChecksum{}, &archiveChecksum{}
+			batch := []byte{}
+			for _, doc := range docs {
+				expected.add(doc)
+				batch = append(batch, doc...)
+			}
+			writer := &checksumWriter{Writer: &bytes.Buffer{}, checksum: checksum}
+			_, err := writer.Write(batch)
+			So(err, ShouldBeNil)
+			So(*checksum, ShouldResemble, *expected)
+		})
+
+		Convey("the _ids of the documents written should be recorded, to delete only those", func() {
+			ids := []interface{}{}
+			writer := &checksumWriter{Writer: &bytes.Buffer{}, checksum: &archiveChecksum{}, ids: &ids}
+			_, err := writer.Write(append(append([]byte{}, docs[0]...), docs[1]...))
+			So(err, ShouldBeNil)
+			_, err = writer.Write(docs[2])
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []interface{}{0, 1, 2})
+		})
+	})
+}
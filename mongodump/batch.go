@@ -0,0 +1,99 @@
+package mongodump
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+const (
+	// writeBatchSize is the size past which the documents accumulated by
+	// dumpIterToWriter are written out with a single call to Write.
+	writeBatchSize = 1024 * 1024
+
+	// maxPooledBuffer is the largest document buffer returned to the pool,
+	// so that an occasional huge document doesn't stay pinned in memory.
+	maxPooledBuffer = 64 * 1024
+)
+
+// docBufferPool holds the buffers that readIter copies documents into,
+// reused once they are written out.
+var docBufferPool = sync.Pool{
+	New: func() interface{} {
+		buff := make([]byte, 0, 4*1024)
+		return &buff
+	},
+}
+
+// getDocBuffer returns a copy of raw in a buffer from the pool.
+func getDocBuffer(raw []byte) []byte {
+	buff := docBufferPool.Get().(*[]byte)
+	return append((*buff)[:0], raw...)
+}
+
+// putDocBuffer returns a buffer obtained from getDocBuffer to the pool. The
+// buffer must not be used afterwards.
+func putDocBuffer(buff []byte) {
+	if cap(buff) > maxPooledBuffer {
+		return
+	}
+	buff = buff[:0]
+	docBufferPool.Put(&buff)
+}
+
+// documentSize returns the length of the BSON document at the start of p,
+// or len(p) if p doesn't start with a document length that fits within it.
+func documentSize(p []byte) int {
+	if len(p) < 5 {
+		return len(p)
+	}
+	size := int(int32(binary.LittleEndian.Uint32(p)))
+	if size < 5 || size > len(p) {
+		return len(p)
+	}
+	return size
+}
+
+// writeBatch accumulates whole documents to write them with a single call
+// to Write, which saves a trip through the layers of writers (compression,
+// checksums, volumes, the archive multiplexer) for each small document.
+type writeBatch struct {
+	writer io.Writer
+	buff   []byte
+	docs   int64
+}
+
+func newWriteBatch(writer io.Writer) *writeBatch {
+	return &writeBatch{writer: writer, buff: make([]byte, 0, writeBatchSize)}
+}
+
+// add appends a copy of the document to the batch, flushing the batch once
+// it is full. It returns the number of documents flushed, if any.
+func (batch *writeBatch) add(doc []byte) (int64, error) {
+	batch.buff = append(batch.buff, doc...)
+	batch.docs++
+	if len(batch.buff) < writeBatchSize {
+		return 0, nil
+	}
+	return batch.flush()
+}
+
+// flush writes out the documents in the batch and returns their number.
+func (batch *writeBatch) flush() (int64, error) {
+	if batch.docs == 0 {
+		return 0, nil
+	}
+	_, err := batch.writer.Write(batch.buff)
+	flushed := batch.docs
+	batch.docs = 0
+	// don't keep a batch that grew for a large document
+	if cap(batch.buff) > 2*writeBatchSize {
+		batch.buff = make([]byte, 0, writeBatchSize)
+	} else {
+		batch.buff = batch.buff[:0]
+	}
+	if err != nil {
+		return 0, err
+	}
+	return flushed, nil
+}
@@ -0,0 +1,67 @@
+package mongodump
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// countingBuffer records how many calls to Write it receives.
+type countingBuffer struct {
+	bytes.Buffer
+	writes int
+}
+
+func (cb *countingBuffer) Write(p []byte) (int, error) {
+	cb.writes++
+	return cb.Buffer.Write(p)
+}
+
+func TestWriteBatch(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a write batch", t, func() {
+		out := &countingBuffer{}
+		batch := newWriteBatch(out)
+
+		Convey("small documents should be written together once flushed", func() {
+			for i := 0; i < 100; i++ {
+				flushed, err := batch.add(getDocBuffer([]byte("document")))
+				So(err, ShouldBeNil)
+				So(flushed, ShouldEqual, 0)
+			}
+			So(out.writes, ShouldEqual, 0)
+			flushed, err := batch.flush()
+			So(err, ShouldBeNil)
+			So(flushed, ShouldEqual, 100)
+			So(out.writes, ShouldEqual, 1)
+			So(out.Len(), ShouldEqual, 100*len("document"))
+
+			flushed, err = batch.flush()
+			So(err, ShouldBeNil)
+			So(flushed, ShouldEqual, 0)
+			So(out.writes, ShouldEqual, 1)
+		})
+
+		Convey("a full batch should be flushed as documents are added", func() {
+			doc := make([]byte, writeBatchSize/2)
+			flushed, err := batch.add(doc)
+			So(err, ShouldBeNil)
+			So(flushed, ShouldEqual, 0)
+			flushed, err = batch.add(doc)
+			So(err, ShouldBeNil)
+			So(flushed, ShouldEqual, 2)
+			So(out.writes, ShouldEqual, 1)
+		})
+	})
+
+	Convey("A pooled document buffer should hold a copy of the document", t, func() {
+		raw := []byte("document")
+		buff := getDocBuffer(raw)
+		raw[0] = 'D'
+		So(string(buff), ShouldEqual, "document")
+		putDocBuffer(buff)
+	})
+}
@@ -0,0 +1,131 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DumpInfoFile is the name of the file, at the root of a dump directory,
+// that records the settings of the server the dump was taken from.
+const DumpInfoFile = "dump_info.json"
+
+// dumpInfoParameters are the server parameters recorded in the dump info,
+// chosen for affecting how a restored deployment behaves.
+var dumpInfoParameters = []string{
+	"authenticationMechanisms",
+	"enableTestCommands",
+	"failIndexKeyTooLong",
+	"logLevel",
+	"notablescan",
+	"textSearchEnabled",
+	"ttlMonitorEnabled",
+}
+
+// DumpInfo holds the settings of the source server that are not part of
+// any collection's metadata, so that a restored environment can be
+// configured to match.
+type DumpInfo struct {
+	ServerVersion string `json:"serverVersion,omitempty"`
+
+	// Profiling maps each dumped database to its profiler settings.
+	Profiling map[string]ProfilingSettings `json:"profiling,omitempty"`
+
+	// ServerParameters holds the values of dumpInfoParameters, as returned by
+	// getParameter. Fail points can only be enabled on a server started with
+	// enableTestCommands; the server has no command listing the enabled ones.
+	ServerParameters bson.M `json:"serverParameters,omitempty"`
+}
+
+// ProfilingSettings holds a database's profiling level and slow operation threshold.
+type ProfilingSettings struct {
+	Level  int `json:"level" bson:"was"`
+	SlowMS int `json:"slowms" bson:"slowms"`
+}
+
+// getDumpInfo gathers the server settings for the dump info. Settings that
+// cannot be read, for example due to missing privileges, are left out.
+func (dump *MongoDump) getDumpInfo() (*DumpInfo, error) {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	version := ""
+	if buildInfo, err := session.BuildInfo(); err != nil {
+		log.Logf(log.DebugLow, "unable to get server version for %v: %v", DumpInfoFile, err)
+	} else {
+		version = buildInfo.Version
+	}
+
+	// the profiler is configured on each shard, not on mongos
+	var profiling map[string]ProfilingSettings
+	if !dump.isMongos {
+		profiling = map[string]ProfilingSettings{}
+		for _, dbName := range dump.dumpedDBs() {
+			settings := ProfilingSettings{}
+			if err = session.DB(dbName).Run(bson.D{{"profile", -1}}, &settings); err != nil {
+				log.Logf(log.DebugLow, "unable to get profiling settings for %v: %v", dbName, err)
+				continue
+			}
+			profiling[dbName] = settings
+		}
+	}
+
+	getParameter := bson.D{{"getParameter", 1}}
+	for _, name := range dumpInfoParameters {
+		getParameter = append(getParameter, bson.DocElem{name, 1})
+	}
+	parameters := bson.M{}
+	if err = session.DB("admin").Run(getParameter, &parameters); err != nil {
+		log.Logf(log.DebugLow, "unable to get server parameters for %v: %v", DumpInfoFile, err)
+		parameters = nil
+	}
+	return newDumpInfo(version, profiling, parameters)
+}
+
+// newDumpInfo builds the dump info from the server's version, the profiling
+// settings of each dumped database, and the getParameter result, which is
+// left out if nil.
+func newDumpInfo(version string, profiling map[string]ProfilingSettings, parameters bson.M) (*DumpInfo, error) {
+	info := &DumpInfo{ServerVersion: version, Profiling: profiling}
+	if parameters != nil {
+		delete(parameters, "ok")
+		converted, err := bsonutil.ConvertBSONValueToJSON(parameters)
+		if err != nil {
+			return nil, fmt.Errorf("error converting server parameters to JSON: %v", err)
+		}
+		info.ServerParameters = converted.(bson.M)
+	}
+	return info, nil
+}
+
+// DumpServerInfo writes the source server's settings to the root of the dump
+// directory. It is a no-op when dumping to stdout or to an archive.
+func (dump *MongoDump) DumpServerInfo() error {
+	if dump.useStdout || dump.OutputOptions.Archive != "" {
+		return nil
+	}
+	info, err := dump.getDumpInfo()
+	if err != nil {
+		return err
+	}
+	infoJSON, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error marshalling %v: %v", DumpInfoFile, err)
+	}
+	infoPath := dump.outputPath("", DumpInfoFile)
+	log.Logf(log.DebugLow, "writing server settings to %v", infoPath)
+	out, err := dump.Target.Create(infoPath)
+	if err != nil {
+		return fmt.Errorf("error creating %v: %v", infoPath, err)
+	}
+	if _, err = out.Write(append(infoJSON, '\n')); err != nil {
+		out.Close()
+		return fmt.Errorf("error writing %v: %v", infoPath, err)
+	}
+	return out.Close()
+}
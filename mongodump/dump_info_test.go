@@ -0,0 +1,44 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestDumpInfo(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the settings read from a server", t, func() {
+		profiling := map[string]ProfilingSettings{"app": {Level: 1, SlowMS: 50}}
+		parameters := bson.M{
+			"ok":                       1.0,
+			"enableTestCommands":       false,
+			"logLevel":                 2,
+			"failIndexKeyTooLong":      true,
+			"authenticationMechanisms": []interface{}{"SCRAM-SHA-1"},
+		}
+
+		Convey("the dump info should hold them, without the command's ok field", func() {
+			info, err := newDumpInfo("3.2.1", profiling, parameters)
+			So(err, ShouldBeNil)
+			infoJSON, err := json.Marshal(info)
+			So(err, ShouldBeNil)
+			So(string(infoJSON), ShouldEqual, `{"serverVersion":"3.2.1",`+
+				`"profiling":{"app":{"level":1,"slowms":50}},`+
+				`"serverParameters":{"authenticationMechanisms":["SCRAM-SHA-1"],"enableTestCommands":false,`+
+				`"failIndexKeyTooLong":true,"logLevel":2}}`)
+		})
+
+		Convey("settings that could not be read should be left out", func() {
+			info, err := newDumpInfo("", nil, nil)
+			So(err, ShouldBeNil)
+			infoJSON, err := json.Marshal(info)
+			So(err, ShouldBeNil)
+			So(string(infoJSON), ShouldEqual, `{}`)
+		})
+	})
+}
@@ -0,0 +1,140 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// gridFSIDBatchSize is the number of file ids placed in each $in query when
+// dumping a GridFS bucket, keeping queries well under the BSON size limit.
+const gridFSIDBatchSize = 10000
+
+// gridFSSnapshot holds the file ids of a GridFS bucket captured at the
+// start of the dump. Both the files and chunks collections of the bucket
+// are dumped by id from the snapshot, so that every dumped file has all of
+// its chunks and no orphaned chunks are dumped for files uploaded, or still
+// being uploaded, while the dump runs.
+type gridFSSnapshot struct {
+	bucket string
+	ids    []interface{}
+
+	// expectedChunks is the number of chunks the captured files should have
+	expectedChunks int64
+}
+
+// gridFSBuckets returns the GridFS buckets among the queued intents, mapping
+// the namespace of each bucket's files collection to that of its chunks
+// collection. Both collections must be part of the dump.
+func gridFSBuckets(allIntents []*intents.Intent) map[string]string {
+	namespaces := map[string]bool{}
+	for _, intent := range allIntents {
+		namespaces[intent.Namespace()] = true
+	}
+	buckets := map[string]string{}
+	for _, intent := range allIntents {
+		if intent.IsSpecialCollection() || !strings.HasSuffix(intent.C, ".files") {
+			continue
+		}
+		chunks := strings.TrimSuffix(intent.Namespace(), ".files") + ".chunks"
+		if namespaces[chunks] {
+			buckets[intent.Namespace()] = chunks
+		}
+	}
+	return buckets
+}
+
+// SnapshotGridFSBuckets captures the file ids of every GridFS bucket being
+// dumped. It must be called before the intents are dumped.
+func (dump *MongoDump) SnapshotGridFSBuckets() error {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	dump.gridFSSnapshots = map[string]*gridFSSnapshot{}
+	for files, chunks := range gridFSBuckets(dump.manager.Intents()) {
+		bucket := strings.TrimSuffix(files, ".files")
+		snapshot := &gridFSSnapshot{bucket: bucket}
+
+		fileDoc := struct {
+			Id        interface{} `bson:"_id"`
+			Length    int64       `bson:"length"`
+			ChunkSize int64       `bson:"chunkSize"`
+		}{}
+		dbName := files[:strings.Index(files, ".")]
+		iter := session.DB(dbName).C(files[len(dbName)+1:]).Find(nil).
+			Select(bson.M{"_id": 1, "length": 1, "chunkSize": 1}).Iter()
+		for iter.Next(&fileDoc) {
+			snapshot.ids = append(snapshot.ids, fileDoc.Id)
+			if fileDoc.ChunkSize > 0 {
+				snapshot.expectedChunks += (fileDoc.Length + fileDoc.ChunkSize - 1) / fileDoc.ChunkSize
+			}
+		}
+		if err = iter.Close(); err != nil {
+			return fmt.Errorf("error reading files of GridFS bucket %v: %v", bucket, err)
+		}
+		log.Logf(log.Info, "captured %v files in GridFS bucket %v", len(snapshot.ids), bucket)
+
+		dump.gridFSSnapshots[files] = snapshot
+		dump.gridFSSnapshots[chunks] = snapshot
+	}
+	return nil
+}
+
+// dumpGridFSIntent dumps the files or chunks collection of a GridFS bucket,
+// restricted to the files captured in its snapshot.
+func (dump *MongoDump) dumpGridFSIntent(intent *intents.Intent, snapshot *gridFSSnapshot) error {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.SetPrefetch(1.0)
+	session.SetCursorTimeout(0)
+
+	idField, expected := "_id", int64(len(snapshot.ids))
+	if strings.HasSuffix(intent.C, ".chunks") {
+		idField, expected = "files_id", snapshot.expectedChunks
+	}
+	log.Logf(log.Info, "%v documents to dump", expected)
+
+	dumpProgressor := progress.NewCounter(expected)
+	bar := &progress.Bar{
+		Name:      intent.Namespace(),
+		Watching:  dumpProgressor,
+		BarLength: progressBarLength,
+	}
+	dump.progressManager.Attach(bar)
+	defer dump.progressManager.Detach(bar)
+
+	collection := session.DB(intent.DB).C(intent.C)
+	out := &countingWriter{Writer: intent.BSONFile}
+	start := time.Now()
+	var written int64
+	for first := 0; first < len(snapshot.ids); first += gridFSIDBatchSize {
+		end := first + gridFSIDBatchSize
+		if end > len(snapshot.ids) {
+			end = len(snapshot.ids)
+		}
+		iter := collection.Find(bson.M{idField: bson.M{"$in": snapshot.ids[first:end]}}).Iter()
+		written, err = dump.dumpIterToWriter(iter, intent.Namespace(), out, dumpProgressor)
+		iter.Close()
+		if err != nil {
+			dump.recordStats(intent, written, out.bytes, time.Since(start), err)
+			return err
+		}
+	}
+	dump.recordStats(intent, written, out.bytes, time.Since(start), nil)
+	log.Logf(log.Always, "done dumping %v (%v documents dumped)", intent.Namespace(), written)
+	if written != expected {
+		log.Logf(log.Always, "warning: expected %v documents in %v but dumped %v; "+
+			"files may have been deleted or be missing chunks", expected, intent.Namespace(), written)
+	}
+	return nil
+}
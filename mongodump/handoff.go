@@ -0,0 +1,119 @@
+package mongodump
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+)
+
+// oplogFile is the interface of an intent's BSON file.
+type oplogFile interface {
+	io.ReadWriteCloser
+	Open() error
+}
+
+// oplogEndTracker passes the oplog entries dumped through to the oplog's
+// file, keeping the timestamp of the last one. A write may hold several
+// entries, as dumpIterToWriter batches them.
+type oplogEndTracker struct {
+	oplogFile
+	last bson.MongoTimestamp
+}
+
+func (tracker *oplogEndTracker) Write(p []byte) (int, error) {
+	last := tracker.last
+	for rest := p; len(rest) > 0; {
+		size := documentSize(rest)
+		entry := struct {
+			Timestamp bson.MongoTimestamp `bson:"ts"`
+		}{}
+		if err := bson.Unmarshal(rest[:size], &entry); err != nil {
+			return 0, fmt.Errorf("error reading oplog entry: %v", err)
+		}
+		if entry.Timestamp > last {
+			last = entry.Timestamp
+		}
+		rest = rest[size:]
+	}
+	n, err := tracker.oplogFile.Write(p)
+	if err == nil {
+		tracker.last = last
+	}
+	return n, err
+}
+
+// handoffTimestamp is a timestamp as extended JSON, {"$timestamp": {"t": ..., "i": ...}}.
+type handoffTimestamp struct {
+	Timestamp struct {
+		T uint32 `json:"t"`
+		I uint32 `json:"i"`
+	} `json:"$timestamp"`
+}
+
+func newHandoffTimestamp(ts bson.MongoTimestamp) *handoffTimestamp {
+	handoff := &handoffTimestamp{}
+	handoff.Timestamp.T = uint32(uint64(ts) >> 32)
+	handoff.Timestamp.I = uint32(ts)
+	return handoff
+}
+
+// dumpHandoff is the --handoffFile document. The dump, with its oplog
+// replayed, is consistent as of OplogEnd, so a change stream opened with
+// StartAtOperationTime sees every later change and none of the dump's.
+type dumpHandoff struct {
+	OplogStart           *handoffTimestamp `json:"oplogStart"`
+	OplogEnd             *handoffTimestamp `json:"oplogEnd"`
+	StartAtOperationTime *handoffTimestamp `json:"startAtOperationTime"`
+	ClusterTime          *handoffTimestamp `json:"clusterTime,omitempty"`
+}
+
+// newDumpHandoff returns the handoff for a dump whose oplog starts after
+// start and ends at end. If no entries were dumped, it ends at start.
+func newDumpHandoff(start, end, clusterTime bson.MongoTimestamp) dumpHandoff {
+	if end < start {
+		end = start
+	}
+	handoff := dumpHandoff{
+		OplogStart:           newHandoffTimestamp(start),
+		OplogEnd:             newHandoffTimestamp(end),
+		StartAtOperationTime: newHandoffTimestamp(end + 1),
+	}
+	if clusterTime != 0 {
+		handoff.ClusterTime = newHandoffTimestamp(clusterTime)
+	}
+	return handoff
+}
+
+// getClusterTime returns the cluster time the server reports, or 0 if it
+// doesn't report one (before MongoDB 3.6, or outside a replica set).
+func (dump *MongoDump) getClusterTime() bson.MongoTimestamp {
+	result := struct {
+		ClusterTime struct {
+			ClusterTime bson.MongoTimestamp `bson:"clusterTime"`
+		} `bson:"$clusterTime"`
+	}{}
+	if err := dump.sessionProvider.Run("ping", &result, "admin"); err != nil {
+		log.Logf(log.DebugLow, "unable to read cluster time: %v", err)
+		return 0
+	}
+	return result.ClusterTime.ClusterTime
+}
+
+// writeHandoff writes the --handoffFile, from which change data capture
+// consumers can pick up where the dump's oplog ends.
+func (dump *MongoDump) writeHandoff() error {
+	handoff := newDumpHandoff(dump.oplogStart, dump.oplogEnd, dump.getClusterTime())
+	handoffJSON, err := json.MarshalIndent(handoff, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding handoff: %v", err)
+	}
+	if err = ioutil.WriteFile(dump.OutputOptions.HandoffFile, append(handoffJSON, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing --handoffFile: %v", err)
+	}
+	log.Logf(log.Always, "wrote handoff to %v: the dump is consistent as of oplog timestamp %v:%v",
+		dump.OutputOptions.HandoffFile, handoff.OplogEnd.Timestamp.T, handoff.OplogEnd.Timestamp.I)
+	return nil
+}
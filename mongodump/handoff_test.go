@@ -0,0 +1,72 @@
+package mongodump
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+// bufferFile is an in-memory intent file.
+type bufferFile struct {
+	bytes.Buffer
+}
+
+func (f *bufferFile) Open() error  { return nil }
+func (f *bufferFile) Close() error { return nil }
+
+func TestDumpHandoff(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When dumping oplog entries through an oplogEndTracker", t, func() {
+		out := &bufferFile{}
+		tracker := &oplogEndTracker{oplogFile: out}
+		for _, ts := range []int64{5<<32 | 1, 5<<32 | 3, 6<<32 | 1} {
+			entry, err := bson.Marshal(bson.D{{"ts", bson.MongoTimestamp(ts)}, {"op", "n"}})
+			So(err, ShouldBeNil)
+			_, err = tracker.Write(entry)
+			So(err, ShouldBeNil)
+		}
+
+		Convey("the entries should be written and the last timestamp kept", func() {
+			So(out.Len(), ShouldBeGreaterThan, 0)
+			So(tracker.last, ShouldEqual, bson.MongoTimestamp(6<<32|1))
+		})
+
+		Convey("the last timestamp of a batch of entries should be kept", func() {
+			batch := []byte{}
+			for _, ts := range []int64{7<<32 | 1, 7<<32 | 2, 8<<32 | 1} {
+				entry, err := bson.Marshal(bson.D{{"ts", bson.MongoTimestamp(ts)}, {"op", "n"}})
+				So(err, ShouldBeNil)
+				batch = append(batch, entry...)
+			}
+			before := out.Len()
+			n, err := tracker.Write(batch)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, len(batch))
+			So(out.Len(), ShouldEqual, before+len(batch))
+			So(tracker.last, ShouldEqual, bson.MongoTimestamp(8<<32|1))
+		})
+	})
+
+	Convey("A handoff should start change streams right after the oplog's end", t, func() {
+		handoff := newDumpHandoff(5<<32|1, 6<<32|1, 7<<32|2)
+		handoffJSON, err := json.Marshal(handoff)
+		So(err, ShouldBeNil)
+		So(string(handoffJSON), ShouldEqual, `{"oplogStart":{"$timestamp":{"t":5,"i":1}},`+
+			`"oplogEnd":{"$timestamp":{"t":6,"i":1}},`+
+			`"startAtOperationTime":{"$timestamp":{"t":6,"i":2}},`+
+			`"clusterTime":{"$timestamp":{"t":7,"i":2}}}`)
+
+		Convey("and end at its start when no entries were dumped", func() {
+			handoff = newDumpHandoff(5<<32|1, 0, 0)
+			So(handoff.OplogEnd.Timestamp.T, ShouldEqual, 5)
+			So(handoff.OplogEnd.Timestamp.I, ShouldEqual, 1)
+			So(handoff.StartAtOperationTime.Timestamp.I, ShouldEqual, 2)
+			So(handoff.ClusterTime, ShouldBeNil)
+		})
+	})
+}
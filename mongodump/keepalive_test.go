@@ -0,0 +1,91 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeIter returns its documents, then no more, counting the calls to Next.
+type fakeIter struct {
+	docs  [][]byte
+	calls int32
+}
+
+func (iter *fakeIter) Next(result interface{}) bool {
+	call := int(atomic.AddInt32(&iter.calls, 1))
+	if call > len(iter.docs) {
+		return false
+	}
+	*result.(*bson.Raw) = bson.Raw{Kind: 0x03, Data: iter.docs[call-1]}
+	return true
+}
+
+// nextCalls returns the number of calls to Next so far.
+func (iter *fakeIter) nextCalls() int {
+	return int(atomic.LoadInt32(&iter.calls))
+}
+
+// receiveAll returns the documents sent on buffChan until it is closed.
+func receiveAll(buffChan <-chan []byte) []int {
+	received := []int{}
+	for buff := range buffChan {
+		doc := struct {
+			ID int `bson:"_id"`
+		}{}
+		So(bson.Unmarshal(buff, &doc), ShouldBeNil)
+		received = append(received, doc.ID)
+	}
+	return received
+}
+
+func TestReadIter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an iterator over a few documents", t, func() {
+		iter := &fakeIter{}
+		for i := 0; i < 5; i++ {
+			doc, err := bson.Marshal(bson.M{"_id": i})
+			So(err, ShouldBeNil)
+			iter.docs = append(iter.docs, doc)
+		}
+		buffChan := make(chan []byte)
+		done := make(chan struct{})
+
+		Convey("without a keepalive, the documents should be sent in order as they are received", func() {
+			go readIter(iter, 0, buffChan, done)
+			<-time.After(20 * time.Millisecond)
+			So(iter.nextCalls(), ShouldEqual, 1)
+			So(receiveAll(buffChan), ShouldResemble, []int{0, 1, 2, 3, 4})
+		})
+
+		Convey("with a keepalive and a stalled receiver", func() {
+			go readIter(iter, 5*time.Millisecond, buffChan, done)
+			<-time.After(50 * time.Millisecond)
+
+			Convey("the documents should be read ahead, until the iterator is exhausted", func() {
+				So(iter.nextCalls(), ShouldEqual, len(iter.docs)+1)
+
+				Convey("and the buffer should then drain in order", func() {
+					So(receiveAll(buffChan), ShouldResemble, []int{0, 1, 2, 3, 4})
+				})
+			})
+
+			Convey("the keepalive should stop once the iterator is closed or fails", func() {
+				<-time.After(50 * time.Millisecond)
+				So(iter.nextCalls(), ShouldEqual, len(iter.docs)+1)
+				So(receiveAll(buffChan), ShouldResemble, []int{0, 1, 2, 3, 4})
+			})
+
+			Convey("reading should stop once the receiver is done", func() {
+				close(done)
+				_, open := <-buffChan
+				So(open, ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"time"
+)
+
+const (
+	// lagPollInterval is how often the lag is checked while waiting for it
+	// to drop below --maxLag before the dump starts
+	lagPollInterval = 5 * time.Second
+
+	// lagCheckInterval is how often the lag is checked during the dump
+	lagCheckInterval = time.Minute
+)
+
+// parseTargetTags parses the --targetTags JSON document.
+func parseTargetTags(targetTags string) (map[string]string, error) {
+	return db.ParseTags("--targetTags", targetTags)
+}
+
+// resolveTargetTags connects to the replica set to find the member to dump
+// from for --targetTags.
+func (dump *MongoDump) resolveTargetTags() (string, error) {
+	tags, err := parseTargetTags(dump.InputOptions.TargetTags)
+	if err != nil {
+		return "", fmt.Errorf("bad option: %v", err)
+	}
+	provider, err := db.NewSessionProvider(*dump.ToolOptions)
+	if err != nil {
+		return "", fmt.Errorf("can't create session: %v", err)
+	}
+	defer provider.Close()
+	provider.SetFlags(db.Monotonic)
+
+	status, err := provider.GetReplSetStatus()
+	if err != nil {
+		return "", fmt.Errorf("error getting replica set status for --targetTags: %v", err)
+	}
+	config, err := provider.GetReplSetConfig()
+	if err != nil {
+		return "", fmt.Errorf("error getting replica set config for --targetTags: %v", err)
+	}
+	host, err := db.SelectTaggedMember(status, config, tags)
+	if err != nil {
+		return "", err
+	}
+	log.Logf(log.Info, "selected %v for tags %v", host, db.FormatTags(tags))
+	return host, nil
+}
+
+// replicationLag returns the replication lag of the member being dumped.
+func (dump *MongoDump) replicationLag() (time.Duration, string, error) {
+	status, err := dump.sessionProvider.GetReplSetStatus()
+	if err != nil {
+		return 0, "", fmt.Errorf("error getting replica set status for --maxLag: %v", err)
+	}
+	return status.Lag("")
+}
+
+// checkLagBeforeDump fails if the member being dumped is more than --maxLag
+// behind, or with --waitForLag, waits until it has caught up.
+func (dump *MongoDump) checkLagBeforeDump() error {
+	maxLag := time.Duration(dump.InputOptions.MaxLag) * time.Second
+	for {
+		lag, member, err := dump.replicationLag()
+		if err != nil {
+			return err
+		}
+		if lag <= maxLag {
+			log.Logf(log.Info, "replication lag of %v is %v", member, lag)
+			return nil
+		}
+		if !dump.InputOptions.WaitForLag {
+			return fmt.Errorf("replication lag of %v is %v, more than --maxLag of %v", member, lag, maxLag)
+		}
+		log.Logf(log.Always, "waiting for the replication lag of %v (%v) to drop below %v", member, lag, maxLag)
+		select {
+		case <-dump.context().Done():
+			return dump.context().Err()
+		case <-time.After(lagPollInterval):
+		}
+	}
+}
+
+// watchLag checks the replication lag of the member being dumped every
+// lagCheckInterval, warning when it exceeds --maxLag, until the returned
+// function is called.
+func (dump *MongoDump) watchLag() func() {
+	maxLag := time.Duration(dump.InputOptions.MaxLag) * time.Second
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lagCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-dump.context().Done():
+				return
+			case <-ticker.C:
+			}
+			lag, member, err := dump.replicationLag()
+			if err != nil {
+				log.Logf(log.Info, "%v", err)
+				continue
+			}
+			if lag > maxLag {
+				log.Logf(log.Always, "warning: replication lag of %v is %v, more than --maxLag of %v; "+
+					"the data being dumped is older than expected", member, lag, maxLag)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/signals"
@@ -19,6 +20,8 @@ func main() {
 	opts.AddOptions(inputOpts)
 	outputOpts := &mongodump.OutputOptions{}
 	opts.AddOptions(outputOpts)
+	sshOpts := &mongodump.SSHOptions{}
+	opts.AddOptions(sshOpts)
 
 	args, err := opts.Parse()
 	if err != nil {
@@ -55,6 +58,7 @@ func main() {
 		ToolOptions:   opts,
 		OutputOptions: outputOpts,
 		InputOptions:  inputOpts,
+		SSHOptions:    sshOpts,
 	}
 
 	err = dump.Init()
@@ -63,7 +67,11 @@ func main() {
 		os.Exit(util.ExitError)
 	}
 
-	err = dump.Dump()
+	err = dump.Dump(context.Background())
+	if err == nil && outputOpts.ArchiveThenDelete {
+		err = dump.DeleteArchived()
+	}
+	dump.Close()
 	if err != nil {
 		log.Logf(log.Always, "Failed: %v", err)
 		os.Exit(util.ExitError)
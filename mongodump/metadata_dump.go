@@ -9,6 +9,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"gopkg.in/mgo.v2/bson"
+	"strings"
 )
 
 // Metadata holds information about a collection's options and indexes.
@@ -23,6 +24,51 @@ type IndexDocumentFromDB struct {
 	Key     bson.D `bson:"key"`
 }
 
+// behaviorOptionNames are the collection options that change how a collection
+// behaves, rather than how it is stored.
+var behaviorOptionNames = []string{
+	"capped", "collation", "storageEngine", "validationAction", "validationLevel", "validator",
+}
+
+// behaviorOptions returns the names of the behavior-affecting options set in
+// the given collection options.
+func behaviorOptions(options bson.D) []string {
+	found := []string{}
+	for _, name := range behaviorOptionNames {
+		if value, err := bsonutil.FindValueByKey(name, &options); err == nil && value != nil {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// getCollectionOptions reads a collection's options with listCollections,
+// returning nil if the collection has none.
+func (dump *MongoDump) getCollectionOptions(intent *intents.Intent) (*bson.D, error) {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	collInfo, err := db.GetCollectionOptions(session.DB(intent.DB).C(intent.C))
+	if err != nil {
+		return nil, fmt.Errorf("error getting collection options for `%v`: %v", intent.Namespace(), err)
+	}
+	if collInfo == nil {
+		return nil, nil
+	}
+	options, _ := bsonutil.FindValueByKey("options", collInfo)
+	if options == nil {
+		return nil, nil
+	}
+	optionsD, ok := options.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse collection options for `%v` as bson.D", intent.Namespace())
+	}
+	return &optionsD, nil
+}
+
 // dumpMetadata gets the metadata for a collection and writes it
 // in readable JSON format.
 func (dump *MongoDump) dumpMetadata(intent *intents.Intent) error {
@@ -43,9 +89,20 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent) error {
 		Indexes: []interface{}{},
 	}
 
-	// The collection options were already gathered while building the list of intents.
+	// The collection options were usually gathered while building the list of intents;
+	// if not, we fetch the full collection info with listCollections. The options hold
+	// everything the create command needs to recreate the collection's behavior,
+	// such as collation, validator, validationLevel/Action and storageEngine.
 	// We convert them to JSON so that they can be written to the metadata json file as text.
+	if intent.Options == nil {
+		if intent.Options, err = dump.getCollectionOptions(intent); err != nil {
+			return err
+		}
+	}
 	if intent.Options != nil {
+		if captured := behaviorOptions(*intent.Options); len(captured) > 0 {
+			log.Logf(log.DebugLow, "\tcollection `%v` has options: %v", nsID, strings.Join(captured, ", "))
+		}
 		if meta.Options, err = bsonutil.ConvertBSONValueToJSON(*intent.Options); err != nil {
 			return fmt.Errorf("error converting collection options to JSON: %v", err)
 		}
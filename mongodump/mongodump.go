@@ -3,6 +3,7 @@ package mongodump
 
 import (
 	"compress/gzip"
+	"context"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/auth"
@@ -13,12 +14,16 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,6 +32,11 @@ const (
 	progressBarWaitTime = time.Second * 3
 
 	defaultPermissions = 0755
+
+	// when writes stall, the cursor keepalive reads ahead about one getMore
+	// batch at a time, buffering at most keepAliveMaxBuffer bytes in memory
+	keepAliveReadAhead = 4 * 1024 * 1024
+	keepAliveMaxBuffer = 64 * 1024 * 1024
 )
 
 // MongoDump is a container for the user-specified options and
@@ -36,18 +46,56 @@ type MongoDump struct {
 	ToolOptions   *options.ToolOptions
 	InputOptions  *InputOptions
 	OutputOptions *OutputOptions
+	SSHOptions    *SSHOptions
+
+	// Target creates the files of a dump written to a directory or archive
+	// file. Init defaults it to the local filesystem.
+	Target OutputTarget
+
+	// OutputWriter receives the output when dumping to stdout, with
+	// --out - or --archive -. Init defaults it to os.Stdout.
+	OutputWriter io.Writer
 
 	// useful internals that we don't directly expose as options
 	sessionProvider *db.SessionProvider
 	manager         *intents.Manager
 	useStdout       bool
+	ctx             context.Context
 	query           bson.M
 	oplogCollection string
 	oplogStart      bson.MongoTimestamp
+	oplogEnd        bson.MongoTimestamp
 	isMongos        bool
 	authVersion     int
 	archive         *archive.Writer
 	progressManager *progress.Manager
+	showHistory     bool
+	maxFileSize     int64
+	sshTunnel       *sshTunnel
+	sizeGuard       *db.SizeGuard
+	pauser          *pauser
+
+	// file ids captured for each GridFS collection with --gridfsConsistent
+	gridFSSnapshots map[string]*gridFSSnapshot
+
+	// collections that failed to dump when running with --continueOnError
+	failures     []intentFailure
+	failuresLock sync.Mutex
+
+	// per-collection statistics for the end-of-run summary
+	stats statsCollector
+
+	// the documents dumped with --archiveThenDelete, to check against the
+	// collection before deleting them
+	archived *archiveChecksum
+	// and their _ids, the only documents deleted
+	archivedIDs []interface{}
+}
+
+// intentFailure records a collection that could not be dumped.
+type intentFailure struct {
+	namespace string
+	err       error
 }
 
 // ValidateOptions checks for any incompatible sets of options.
@@ -63,8 +111,14 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("must specify a database when running with dumpDbUsersAndRoles")
 	case dump.OutputOptions.DumpDBUsersAndRoles && dump.ToolOptions.Namespace.Collection != "":
 		return fmt.Errorf("cannot specify a collection when running with dumpDbUsersAndRoles")
+	case dump.OutputOptions.DumpUsersAndRolesPerDB && dump.ToolOptions.Namespace.DB != "":
+		return fmt.Errorf("--dumpUsersAndRolesPerDb is only supported on full dumps; use --dumpDbUsersAndRoles for a single database")
+	case dump.OutputOptions.DumpUsersAndRolesPerDB && dump.OutputOptions.Archive != "":
+		return fmt.Errorf("--dumpUsersAndRolesPerDb is not supported with --archive")
 	case dump.OutputOptions.Oplog && dump.ToolOptions.Namespace.DB != "":
 		return fmt.Errorf("--oplog mode only supported on full dumps")
+	case dump.OutputOptions.HandoffFile != "" && !dump.OutputOptions.Oplog:
+		return fmt.Errorf("--handoffFile requires --oplog")
 	case len(dump.OutputOptions.ExcludedCollections) > 0 && dump.ToolOptions.Namespace.Collection != "":
 		return fmt.Errorf("--collection is not allowed when --excludeCollection is specified")
 	case len(dump.OutputOptions.ExcludedCollectionPrefixes) > 0 && dump.ToolOptions.Namespace.Collection != "":
@@ -75,24 +129,135 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("--db is required when --excludeCollectionsWithPrefix is specified")
 	case dump.OutputOptions.Repair && dump.InputOptions.Query != "":
 		return fmt.Errorf("cannot run a query with --repair enabled")
+	case dump.InputOptions.SinceField != "" && dump.InputOptions.Since == "":
+		return fmt.Errorf("--since is required when --sinceField is specified")
+	case dump.InputOptions.Since != "" && dump.InputOptions.SinceField == "":
+		return fmt.Errorf("--sinceField is required when --since is specified")
+	case dump.OutputOptions.Repair && dump.InputOptions.SinceField != "":
+		return fmt.Errorf("cannot use --sinceField with --repair enabled")
 	case dump.OutputOptions.Out != "" && dump.OutputOptions.Archive != "":
 		return fmt.Errorf("--out not allowed when --archive is specified")
+	case dump.OutputOptions.MaxFileSize != "" && (dump.OutputOptions.Out == "-" || dump.OutputOptions.Archive == "-"):
+		return fmt.Errorf("--maxFileSize can not be used when writing to stdout")
+	case dump.OutputOptions.ArchivePartSize != "" && (dump.OutputOptions.Archive == "" || dump.OutputOptions.Archive == "-"):
+		return fmt.Errorf("--archivePartSize requires --archive to name a file")
+	case dump.OutputOptions.ArchivePartSize != "" && dump.OutputOptions.MaxFileSize != "":
+		return fmt.Errorf("--archivePartSize can not be used with --maxFileSize")
+	case strings.ContainsAny(dump.InputOptions.TargetHost, "/,"):
+		return fmt.Errorf("--targetHost must name a single host, e.g. --targetHost host:port")
+	case dump.InputOptions.TargetTags != "" && dump.InputOptions.TargetHost != "":
+		return fmt.Errorf("--targetTags can not be used with --targetHost")
+	case dump.InputOptions.TargetTags != "" && dump.SSHOptions != nil && dump.SSHOptions.SSHHost != "":
+		return fmt.Errorf("--targetTags can not be used with --sshHost")
+	case dump.InputOptions.MaxLag < 0:
+		return fmt.Errorf("--maxLag can not be negative")
+	case dump.InputOptions.Stagger < 0:
+		return fmt.Errorf("--stagger can not be negative")
+	case dump.InputOptions.WaitForLag && dump.InputOptions.MaxLag == 0:
+		return fmt.Errorf("--waitForLag requires --maxLag")
+	case dump.SSHOptions != nil && dump.SSHOptions.SSHHost == "" &&
+		(dump.SSHOptions.SSHUser != "" || dump.SSHOptions.SSHKeyFile != ""):
+		return fmt.Errorf("--sshUser and --sshKeyFile require --sshHost")
+	case dump.OutputOptions.GridFSConsistent && dump.OutputOptions.Repair:
+		return fmt.Errorf("--gridfsConsistent can not be used with --repair")
+	case dump.OutputOptions.GridFSConsistent && (dump.InputOptions.Query != "" || dump.InputOptions.SinceField != ""):
+		return fmt.Errorf("--gridfsConsistent can not be used with --query or --sinceField")
+	case dump.OutputOptions.ArchiveThenDelete && dump.InputOptions.Query == "":
+		return fmt.Errorf("--archiveThenDelete requires --query, selecting the documents to archive and delete")
+	case dump.OutputOptions.ArchiveThenDelete && (dump.OutputOptions.Out == "-" || dump.OutputOptions.Archive == "-"):
+		return fmt.Errorf("--archiveThenDelete can not be used when writing to stdout")
+	case dump.OutputOptions.ArchiveThenDelete && strings.HasPrefix(dump.ToolOptions.Namespace.Collection, "system."):
+		return fmt.Errorf("--archiveThenDelete can not delete from system collections")
+	case dump.OutputOptions.ArchiveThenDelete && dump.OutputOptions.OversizedDocs != "" && dump.OutputOptions.OversizedDocs != "fail":
+		return fmt.Errorf("--archiveThenDelete can only be used with --oversizedDocs=fail, so every deleted document is dumped whole")
+	case dump.OutputOptions.ArchiveThenDelete && (dump.InputOptions.TargetHost != "" || dump.InputOptions.TargetTags != ""):
+		return fmt.Errorf("--archiveThenDelete can not be used with --targetHost or --targetTags, as it deletes through the primary")
+	case dump.OutputOptions.ArchiveThenDelete && dump.OutputOptions.DeleteBatchSize <= 0:
+		return fmt.Errorf("--deleteBatchSize must be positive")
+	case dump.OutputOptions.DeleteRateLimit < 0:
+		return fmt.Errorf("--deleteRateLimit can not be negative")
 	}
 	return nil
 }
 
 // Init performs preliminary setup operations for MongoDump.
-func (dump *MongoDump) Init() error {
-	err := dump.ValidateOptions()
+func (dump *MongoDump) Init() (err error) {
+	err = dump.ValidateOptions()
+	if err != nil {
+		return fmt.Errorf("bad option: %v", err)
+	}
+	maxFileSize, maxFileSizeFlag := dump.OutputOptions.MaxFileSize, "--maxFileSize"
+	if dump.OutputOptions.ArchivePartSize != "" {
+		// --archivePartSize is --maxFileSize for an archive file
+		maxFileSize, maxFileSizeFlag = dump.OutputOptions.ArchivePartSize, "--archivePartSize"
+	}
+	if maxFileSize != "" {
+		dump.maxFileSize, err = text.ParseByteAmount(maxFileSize)
+		if err != nil {
+			return fmt.Errorf("bad option: %v: %v", maxFileSizeFlag, err)
+		}
+		if dump.maxFileSize <= 0 {
+			return fmt.Errorf("bad option: %v must be greater than zero", maxFileSizeFlag)
+		}
+	}
+	dump.sizeGuard, err = db.NewSizeGuard(dump.OutputOptions.OversizedDocs, dump.OutputOptions.TruncateFields)
 	if err != nil {
 		return fmt.Errorf("bad option: %v", err)
 	}
+	if dump.InputOptions.PauseFile != "" && dump.InputOptions.CursorKeepAlive <= 0 {
+		log.Logf(log.Always, "warning: with --cursorKeepAliveSecs=0, the server may reap "+
+			"the dump's cursors while it is paused")
+	}
+	dump.pauser = newPauser(dump.InputOptions.PauseFile)
+	dump.useStdout = dump.OutputOptions.Out == "-"
+	if dump.OutputWriter == nil {
+		dump.OutputWriter = os.Stdout
+	}
+	if dump.Target == nil {
+		dump.Target = &fileTarget{maxSize: dump.maxFileSize}
+	}
+	setName := dump.ToolOptions.ReplicaSetName
+	targetHost := ""
+	if dump.InputOptions.TargetTags != "" {
+		targetHost, err = dump.resolveTargetTags()
+		if err != nil {
+			return err
+		}
+	} else if dump.InputOptions.TargetHost != "" {
+		targetHost = dump.InputOptions.TargetHost
+	}
+	if targetHost != "" {
+		dump.ToolOptions = targetHostOptions(dump.ToolOptions, targetHost)
+	}
+	if dump.SSHOptions != nil && dump.SSHOptions.SSHHost != "" {
+		var remoteAddr string
+		remoteAddr, err = tunnelRemoteAddr(dump.ToolOptions.Connection)
+		if err != nil {
+			return fmt.Errorf("bad option: %v", err)
+		}
+		dump.sshTunnel, err = startSSHTunnel(dump.SSHOptions, remoteAddr)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				dump.Close()
+			}
+		}()
+		targetHost = remoteAddr
+		dump.ToolOptions = targetHostOptions(dump.ToolOptions, dump.sshTunnel.localAddr)
+	}
 	dump.sessionProvider, err = db.NewSessionProvider(*dump.ToolOptions)
 	if err != nil {
 		return fmt.Errorf("can't create session: %v", err)
 	}
 	// ensure we allow secondary reads and disable TCP timeouts
 	dump.sessionProvider.SetFlags(db.Monotonic | db.DisableSocketTimeout)
+	if targetHost != "" {
+		if err = dump.verifyTargetHost(targetHost, setName); err != nil {
+			return err
+		}
+	}
 	dump.isMongos, err = dump.sessionProvider.IsMongos()
 	if err != nil {
 		return err
@@ -101,14 +266,93 @@ func (dump *MongoDump) Init() error {
 	if dump.OutputOptions.Repair && dump.isMongos {
 		return fmt.Errorf("--repair flag cannot be used on a mongos")
 	}
+	if dump.InputOptions.MaxLag > 0 && dump.isMongos {
+		return fmt.Errorf("--maxLag flag cannot be used on a mongos")
+	}
 	dump.manager = intents.NewIntentManager()
 	dump.progressManager = progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
+	// the bars are logged, to standard error
+	dump.showHistory = !dump.OutputOptions.NoProgressHistory && progress.HistoryShownOn(os.Stderr)
 	return nil
 }
 
-// Dump handles some final options checking and executes MongoDump.
-func (dump *MongoDump) Dump() error {
-	var err error
+// targetHostOptions returns a copy of the tool options that connects
+// directly to the given host, bypassing replica set discovery and server
+// selection.
+func targetHostOptions(opts *options.ToolOptions, host string) *options.ToolOptions {
+	targetOpts := *opts
+	connection := *opts.Connection
+	connection.Host = host
+	if strings.Contains(host, ":") {
+		connection.Port = ""
+	}
+	targetOpts.Connection = &connection
+	targetOpts.Direct = true
+	targetOpts.ReplicaSetName = ""
+	return &targetOpts
+}
+
+// verifyTargetHost checks that the directly connected host, described by
+// target, belongs to the replica set named in --host, if any, and logs the
+// member's state.
+func (dump *MongoDump) verifyTargetHost(target, setName string) error {
+	isMaster := struct {
+		SetName   string `bson:"setName"`
+		IsMaster  bool   `bson:"ismaster"`
+		Secondary bool   `bson:"secondary"`
+		Hidden    bool   `bson:"hidden"`
+	}{}
+	if err := dump.sessionProvider.Run("isMaster", &isMaster, "admin"); err != nil {
+		return fmt.Errorf("error connecting to %v: %v", target, err)
+	}
+	if setName != "" && isMaster.SetName != setName {
+		return fmt.Errorf("%v is not a member of replica set '%v'", target, setName)
+	}
+	state := "standalone"
+	switch {
+	case isMaster.IsMaster && isMaster.SetName != "":
+		state = "primary"
+	case isMaster.Hidden:
+		state = "hidden secondary"
+	case isMaster.Secondary:
+		state = "secondary"
+	}
+	log.Logf(log.Always, "dumping from %v (%v)", target, state)
+	return nil
+}
+
+// context returns the context of the running dump. Dump sets it; methods
+// called directly, without Dump, are never cancelled.
+func (dump *MongoDump) context() context.Context {
+	if dump.ctx == nil {
+		return context.Background()
+	}
+	return dump.ctx
+}
+
+// Close releases resources held after Init, such as the SSH tunnel.
+func (dump *MongoDump) Close() {
+	if dump.sshTunnel != nil {
+		dump.sshTunnel.Close()
+		dump.sshTunnel = nil
+	}
+	dump.pauser.stop()
+	dump.pauser = nil
+}
+
+// Dump handles some final options checking and executes MongoDump. The dump
+// stops with the context's error once the context is cancelled or times out;
+// collections already started are abandoned and partially written. A nil
+// context is never cancelled.
+func (dump *MongoDump) Dump(ctx context.Context) (err error) {
+	dump.ctx = ctx
+	dump.stats.start = time.Now()
+	if dump.InputOptions.MaxLag > 0 {
+		if err = dump.checkLagBeforeDump(); err != nil {
+			return err
+		}
+		defer dump.watchLag()()
+	}
 	if dump.InputOptions.Query != "" {
 		// parse JSON then convert extended JSON values
 		var asJSON interface{}
@@ -128,7 +372,30 @@ func (dump *MongoDump) Dump() error {
 		dump.query = bson.M(asMap)
 	}
 
-	if dump.OutputOptions.DumpDBUsersAndRoles {
+	if dump.InputOptions.SinceField != "" {
+		if err = dump.addSinceToQuery(); err != nil {
+			return err
+		}
+	}
+
+	// from here on, the summary is reported however the dump ends, so a
+	// failed dump still leaves its --statsFile
+	defer func() {
+		if statsErr := dump.reportStats(err); statsErr != nil {
+			if err == nil {
+				err = statsErr
+			} else {
+				log.Logf(log.Always, "%v", statsErr)
+			}
+		}
+	}()
+
+	if dump.OutputOptions.ArchiveThenDelete {
+		dump.archived = &archiveChecksum{}
+		dump.archivedIDs = nil
+	}
+
+	if dump.OutputOptions.DumpDBUsersAndRoles || dump.OutputOptions.DumpUsersAndRolesPerDB {
 		// first make sure this is possible with the connected database
 		dump.authVersion, err = auth.GetAuthVersion(dump.sessionProvider)
 		if err != nil {
@@ -214,6 +481,10 @@ func (dump *MongoDump) Dump() error {
 		}
 	}
 
+	if err = dump.context().Err(); err != nil {
+		return err
+	}
+
 	// IO Phase I
 	// metadata, users, roles, and versions
 
@@ -241,12 +512,23 @@ func (dump *MongoDump) Dump() error {
 		return fmt.Errorf("error dumping system indexes: %v", err)
 	}
 
+	err = dump.DumpServerInfo()
+	if err != nil {
+		return fmt.Errorf("error dumping server settings: %v", err)
+	}
+
 	if dump.ToolOptions.DB == "admin" || dump.ToolOptions.DB == "" {
 		err = dump.DumpUsersAndRoles()
 		if err != nil {
 			return fmt.Errorf("error dumping users and roles: %v", err)
 		}
 	}
+	if dump.OutputOptions.DumpUsersAndRolesPerDB {
+		err = dump.DumpUsersAndRolesPerDB()
+		if err != nil {
+			return err
+		}
+	}
 	if dump.OutputOptions.DumpDBUsersAndRoles {
 		log.Logf(log.Always, "dumping users and roles for %v", dump.ToolOptions.DB)
 		if dump.ToolOptions.DB == "admin" {
@@ -275,6 +557,17 @@ func (dump *MongoDump) Dump() error {
 		}
 	}
 
+	if dump.OutputOptions.GridFSConsistent {
+		log.Logf(log.Info, "capturing GridFS file lists")
+		if err = dump.SnapshotGridFSBuckets(); err != nil {
+			return err
+		}
+	}
+
+	if err = dump.context().Err(); err != nil {
+		return err
+	}
+
 	// IO Phase II
 	// regular collections
 
@@ -285,8 +578,27 @@ func (dump *MongoDump) Dump() error {
 	dump.progressManager.Start()
 	defer dump.progressManager.Stop()
 
+	// capture the oplog while dumping collections if it nears rolling over
+	// past the dump's start
+	var stopOplogWatch func() *oplogCapture
+	if dump.OutputOptions.Oplog && dump.OutputOptions.OplogCaptureHeadroom > 0 {
+		stopOplogWatch = dump.watchOplogHeadroom()
+	}
+
 	// dump all queued collections
-	if err := dump.DumpIntents(); err != nil {
+	err = dump.DumpIntents()
+	var capture *oplogCapture
+	if stopOplogWatch != nil {
+		capture = stopOplogWatch()
+	}
+	if err != nil {
+		if capture != nil {
+			capture.finish(0)
+		}
+		return err
+	}
+
+	if err = dump.context().Err(); err != nil {
 		return err
 	}
 
@@ -300,7 +612,24 @@ func (dump *MongoDump) Dump() error {
 	// while dumping the database. Before and after dumping the oplog,
 	// we check to see if the oplog has rolled over (i.e. the most recent entry when
 	// we started still exist, so we know we haven't lost data)
-	if dump.OutputOptions.Oplog {
+	if capture != nil {
+		latest, err := dump.getOplogStartTime()
+		if err != nil {
+			capture.finish(0)
+			return fmt.Errorf("error getting the latest oplog entry: %v", err)
+		}
+		log.Logf(log.Always, "finishing the capture of the oplog to %v", dump.manager.Oplog().BSONPath)
+		err = capture.finish(latest)
+		dump.oplogEnd = capture.tracker.last
+		if err != nil {
+			return fmt.Errorf("error capturing oplog: %v", err)
+		}
+		if dump.OutputOptions.HandoffFile != "" {
+			if err = dump.writeHandoff(); err != nil {
+				return err
+			}
+		}
+	} else if dump.OutputOptions.Oplog {
 		log.Logf(log.DebugLow, "checking if oplog entry %v still exists", dump.oplogStart)
 		exists, err := dump.checkOplogTimestampExists(dump.oplogStart)
 		if !exists {
@@ -331,6 +660,18 @@ func (dump *MongoDump) Dump() error {
 			return fmt.Errorf("unable to check oplog for overflow: %v", err)
 		}
 		log.Logf(log.DebugHigh, "oplog entry %v still exists", dump.oplogStart)
+
+		if dump.OutputOptions.HandoffFile != "" {
+			if err = dump.writeHandoff(); err != nil {
+				return err
+			}
+		}
+	}
+
+	dump.sizeGuard.LogSummary()
+
+	if err = dump.reportFailures(); err != nil {
+		return err
 	}
 
 	log.Logf(log.Info, "done")
@@ -339,9 +680,11 @@ func (dump *MongoDump) Dump() error {
 }
 
 // DumpIntents iterates through the previously-created intents and
-// dumps all of the found collections.
+// dumps all of the found collections, stopping early if the dump's
+// context is done.
 func (dump *MongoDump) DumpIntents() error {
 	resultChan := make(chan error)
+	ctx := dump.context()
 
 	var jobs int
 	if dump.ToolOptions != nil && dump.ToolOptions.HiddenOptions != nil {
@@ -356,21 +699,40 @@ func (dump *MongoDump) DumpIntents() error {
 
 	log.Logf(log.Info, "dumping with %v job threads", jobs)
 
+	// closed once a job thread finds no more work to do, so the threads
+	// still waiting their turn to start don't wait for nothing
+	drained := make(chan struct{})
+	var drainOnce sync.Once
+
 	// start a goroutine for each job thread
 	for i := 0; i < jobs; i++ {
 		go func(id int) {
 			log.Logf(log.DebugHigh, "starting dump routine with id=%v", id)
+			// wait before taking any work, to leave it to the threads
+			// already started in the meantime
+			if err := dump.staggerStart(ctx, id, drained); err != nil {
+				resultChan <- err
+				return
+			}
 			for {
+				if err := ctx.Err(); err != nil {
+					resultChan <- err
+					return
+				}
 				intent := dump.manager.Pop()
 				if intent == nil {
 					log.Logf(log.DebugHigh, "ending dump routine with id=%v, no more work to do", id)
+					drainOnce.Do(func() { close(drained) })
 					resultChan <- nil
 					return
 				}
 				err := dump.DumpIntent(intent)
 				if err != nil {
-					resultChan <- err
-					return
+					if !dump.OutputOptions.ContinueOnError || ctx.Err() != nil {
+						resultChan <- err
+						return
+					}
+					dump.recordFailure(intent, err)
 				}
 				dump.manager.Finish(intent)
 			}
@@ -387,6 +749,51 @@ func (dump *MongoDump) DumpIntents() error {
 	return nil
 }
 
+// staggerStart delays the job thread with the given id by id times the
+// --stagger interval, so the threads don't all start cold collection scans
+// at the same moment. The wait ends early once drained is closed, as there is
+// no work left to wait for.
+func (dump *MongoDump) staggerStart(ctx context.Context, id int, drained <-chan struct{}) error {
+	if dump.InputOptions == nil || dump.InputOptions.Stagger <= 0 || id == 0 {
+		return nil
+	}
+	delay := time.Duration(id*dump.InputOptions.Stagger) * time.Second
+	log.Logf(log.DebugLow, "delaying dump routine with id=%v for %v", id, delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recordFailure notes that the given intent failed to dump, so that the
+// remaining intents can continue when running with --continueOnError.
+func (dump *MongoDump) recordFailure(intent *intents.Intent, err error) {
+	log.Logf(log.Always, "error dumping %v, continuing: %v", intent.Namespace(), err)
+	dump.failuresLock.Lock()
+	defer dump.failuresLock.Unlock()
+	dump.failures = append(dump.failures, intentFailure{intent.Namespace(), err})
+}
+
+// reportFailures logs each collection that failed to dump and returns an
+// error if there were any.
+func (dump *MongoDump) reportFailures() error {
+	dump.failuresLock.Lock()
+	defer dump.failuresLock.Unlock()
+	if len(dump.failures) == 0 {
+		return nil
+	}
+	for _, failure := range dump.failures {
+		log.Logf(log.Always, "failed: %v: %v", failure.namespace, failure.err)
+	}
+	return fmt.Errorf("%v collection(s) failed to dump", len(dump.failures))
+}
+
 // DumpIntent dumps the specified database's collection.
 func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	session, err := dump.sessionProvider.GetSession()
@@ -398,6 +805,9 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	// more results as soon as results are returned. This effectively
 	// duplicates the behavior of an exhaust cursor.
 	session.SetPrefetch(1.0)
+	// don't let the server time out the cursor when writing to the
+	// destination is slow; cursors are always closed once the dump finishes
+	session.SetCursorTimeout(0)
 
 	err = intent.BSONFile.Open()
 	if err != nil {
@@ -405,10 +815,15 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	}
 	defer intent.BSONFile.Close()
 
+	if snapshot, ok := dump.gridFSSnapshots[intent.Namespace()]; ok {
+		log.Logf(log.Always, "writing %v to %v", intent.Namespace(), intent.BSONPath)
+		return dump.dumpGridFSIntent(intent, snapshot)
+	}
+
 	var findQuery *mgo.Query
-	switch {
-	case len(dump.query) > 0:
-		findQuery = session.DB(intent.DB).C(intent.C).Find(dump.query)
+	switch query := dump.queryForIntent(intent); {
+	case len(query) > 0:
+		findQuery = session.DB(intent.DB).C(intent.C).Find(query)
 	case dump.InputOptions.TableScan:
 		// ---forceTablesScan runs the query without snapshot enabled
 		findQuery = session.DB(intent.DB).C(intent.C).Find(nil)
@@ -432,7 +847,11 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 		log.Logf(log.Always, "writing repair of %v to %v", intent.Namespace(), intent.BSONPath)
 		repairIter := session.DB(intent.DB).C(intent.C).Repair()
 		repairCounter := progress.NewCounter(1) // this counter is ignored
-		if _, err := dump.dumpIterToWriter(repairIter, intent.BSONFile, repairCounter); err != nil {
+		out := &countingWriter{Writer: intent.BSONFile}
+		start := time.Now()
+		written, err := dump.dumpIterToWriter(repairIter, intent.Namespace(), out, repairCounter)
+		dump.recordStats(intent, written, out.bytes, time.Since(start), err)
+		if err != nil {
 			return fmt.Errorf("repair error: %v", err)
 		}
 		log.Logf(log.Always,
@@ -447,6 +866,39 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	return nil
 }
 
+// addSinceToQuery adds a range condition on --sinceField to the dump query,
+// selecting documents modified on or after the --since date.
+func (dump *MongoDump) addSinceToQuery() error {
+	since, err := util.FormatDate(dump.InputOptions.Since)
+	if err != nil {
+		return fmt.Errorf("error parsing --since date '%v': %v", dump.InputOptions.Since, err)
+	}
+	if dump.query == nil {
+		dump.query = bson.M{}
+	}
+	if _, ok := dump.query[dump.InputOptions.SinceField]; ok {
+		return fmt.Errorf("--query can not filter on '%v' when used with --sinceField",
+			dump.InputOptions.SinceField)
+	}
+	dump.query[dump.InputOptions.SinceField] = bson.M{"$gte": since}
+	log.Logf(log.DebugLow, "dumping documents with %v on or after %v",
+		dump.InputOptions.SinceField, since)
+	return nil
+}
+
+// queryForIntent returns the query to use when dumping the given intent.
+// Users, roles, and other special collections are always dumped in full,
+// as are system collections when the query comes only from --sinceField.
+func (dump *MongoDump) queryForIntent(intent *intents.Intent) bson.M {
+	if intent.IsSpecialCollection() {
+		return nil
+	}
+	if dump.InputOptions.Query == "" && strings.HasPrefix(intent.C, "system.") {
+		return nil
+	}
+	return dump.query
+}
+
 // dumpQueryToWriter takes an mgo Query, its intent, and a writer, performs the query,
 // and writes the raw bson results to the writer.
 func (dump *MongoDump) dumpQueryToWriter(
@@ -460,15 +912,24 @@ func (dump *MongoDump) dumpQueryToWriter(
 
 	dumpProgressor := progress.NewCounter(int64(total))
 	bar := &progress.Bar{
-		Name:      intent.Namespace(),
-		Watching:  dumpProgressor,
-		BarLength: progressBarLength,
+		Name:        intent.Namespace(),
+		Watching:    dumpProgressor,
+		BarLength:   progressBarLength,
+		ShowHistory: dump.showHistory,
 	}
 	dump.progressManager.Attach(bar)
 	defer dump.progressManager.Detach(bar)
 
 	iter := query.Iter()
-	written, err := dump.dumpIterToWriter(iter, intent.BSONFile, dumpProgressor)
+	defer iter.Close()
+	out := &countingWriter{Writer: intent.BSONFile}
+	var writer io.Writer = out
+	if dump.archived != nil && len(dump.queryForIntent(intent)) > 0 {
+		writer = &checksumWriter{Writer: out, checksum: dump.archived, ids: &dump.archivedIDs}
+	}
+	start := time.Now()
+	written, err := dump.dumpIterToWriter(iter, intent.Namespace(), writer, dumpProgressor)
+	dump.recordStats(intent, written, out.bytes, time.Since(start), err)
 	if err != nil {
 		return err
 	}
@@ -477,55 +938,237 @@ func (dump *MongoDump) dumpQueryToWriter(
 	return nil
 }
 
-// dumpIterToWriter takes an mgo iterator, a writer, and a pointer to
-// a counter, and dumps the iterator's contents to the writer.
-func (dump *MongoDump) dumpIterToWriter(iter *mgo.Iter, writer io.Writer,
+// dumpIterToWriter takes an mgo iterator, the namespace it reads, a writer,
+// and a pointer to a counter, and dumps the iterator's contents to the writer.
+// Each call to Write holds one or more whole documents.
+func (dump *MongoDump) dumpIterToWriter(iter *mgo.Iter, namespace string, writer io.Writer,
 	progressCount progress.Progressor) (written int64, err error) {
 
 	// We run the result iteration in its own goroutine,
 	// this allows disk i/o to not block reads from the db,
 	// which gives a slight speedup on benchmarks
 	buffChan := make(chan []byte)
-	go func() {
-		for {
-			raw := &bson.Raw{}
-			next := iter.Next(raw)
-			if !next {
-				// we check the iterator for errors below
-				close(buffChan)
-				return
-			}
-
-			nextCopy := make([]byte, len(raw.Data))
-			copy(nextCopy, raw.Data)
-
-			buffChan <- nextCopy
-		}
-	}()
+	done := make(chan struct{})
+	defer close(done)
+	var keepAlive time.Duration
+	if dump.InputOptions != nil {
+		keepAlive = time.Duration(dump.InputOptions.CursorKeepAlive) * time.Second
+	}
+	go readIter(iter, keepAlive, buffChan, done)
+
+	// give up on the collection once it exceeds its --collectionTimeout,
+	// not counting the time the dump spends paused
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	var limit time.Duration
+	start, pausedAtStart := time.Now(), dump.pauser.pausedTime()
+	if dump.InputOptions != nil && dump.InputOptions.CollectionTimeout > 0 {
+		limit = time.Duration(dump.InputOptions.CollectionTimeout) * time.Second
+		timer = time.NewTimer(limit)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 
-	// while there are still results in the database,
-	// grab results from the goroutine and write them to filesystem
+	// while there are still results in the database, grab results from
+	// the goroutine and write them to filesystem in batches
+	batch := newWriteBatch(writer)
+	ctx := dump.context()
 	for {
-		buff, alive := <-buffChan
+		var buff []byte
+		var alive bool
+		select {
+		case buff, alive = <-buffChan:
+		case <-ctx.Done():
+			return progressCount.Get(), ctx.Err()
+		case <-timeout:
+			if left := limit - dump.pauser.activeSince(start, pausedAtStart); left > 0 {
+				// the dump was paused, which pushes the timeout back
+				timer.Reset(left)
+				continue
+			}
+			return progressCount.Get(), fmt.Errorf("timed out after %v seconds (--collectionTimeout)",
+				dump.InputOptions.CollectionTimeout)
+		}
 		if !alive {
 			if iter.Err() != nil {
 				return progressCount.Get(), fmt.Errorf("error reading collection: %v", iter.Err())
 			}
 			break
 		}
-		_, err := writer.Write(buff)
+		if err := dump.pauser.wait(ctx); err != nil {
+			putDocBuffer(buff)
+			return progressCount.Get(), err
+		}
+		doc, err := dump.sizeGuard.Check(buff, namespace)
+		if err != nil {
+			return progressCount.Get(), err
+		}
+		var flushed int64
+		if doc != nil {
+			flushed, err = batch.add(doc)
+		}
+		putDocBuffer(buff)
 		if err != nil {
 			return progressCount.Get(), fmt.Errorf("error writing to file: %v", err)
 		}
-		progressCount.Inc(1)
+		progressCount.Inc(flushed)
 	}
 
+	flushed, err := batch.flush()
+	if err != nil {
+		return progressCount.Get(), fmt.Errorf("error writing to file: %v", err)
+	}
+	progressCount.Inc(flushed)
 	return progressCount.Get(), nil
 }
 
+// docIterator is the part of *mgo.Iter that readIter reads documents with.
+type docIterator interface {
+	Next(result interface{}) bool
+}
+
+// readIter reads documents from the iterator and sends copies of them, in
+// buffers from docBufferPool, on buffChan, closing it once the iterator is exhausted or returning early
+// once done is closed by the receiver. If the receiving
+// side stalls for longer than the keepAlive interval, readIter
+// reads ahead into memory so that getMores keep being issued and the
+// server cursor is not reaped while the writer catches up. A keepAlive of
+// zero disables reading ahead.
+func readIter(iter docIterator, keepAlive time.Duration, buffChan chan<- []byte, done <-chan struct{}) {
+	defer close(buffChan)
+
+	nextDoc := func() ([]byte, bool) {
+		raw := &bson.Raw{}
+		if !iter.Next(raw) {
+			// the iterator is checked for errors by the receiver
+			return nil, false
+		}
+		return getDocBuffer(raw.Data), true
+	}
+
+	if keepAlive <= 0 {
+		for {
+			buff, ok := nextDoc()
+			if !ok {
+				return
+			}
+			select {
+			case buffChan <- buff:
+			case <-done:
+				return
+			}
+		}
+	}
+
+	timer := time.NewTimer(keepAlive)
+	timer.Stop()
+	var pending [][]byte
+	pendingSize := 0
+	exhausted := false
+	for {
+		if len(pending) == 0 {
+			if exhausted {
+				return
+			}
+			buff, ok := nextDoc()
+			if !ok {
+				return
+			}
+			pending = append(pending, buff)
+			pendingSize += len(buff)
+		}
+
+		// the common case: the writer is keeping up
+		select {
+		case buffChan <- pending[0]:
+			pendingSize -= len(pending[0])
+			pending = pending[1:]
+			continue
+		default:
+		}
+
+		timer.Reset(keepAlive)
+		select {
+		case buffChan <- pending[0]:
+			pendingSize -= len(pending[0])
+			pending = pending[1:]
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if exhausted {
+				// the iterator is closed or failed, leaving no cursor to keep alive
+				continue
+			}
+			if pendingSize >= keepAliveMaxBuffer {
+				log.Logf(log.Info, "writes stalled for over %v with %v buffered; "+
+					"relying on noCursorTimeout to keep the cursor open", keepAlive,
+					text.FormatByteAmount(int64(pendingSize)))
+				continue
+			}
+			// read roughly one batch ahead, forcing a getMore
+			readAhead := 0
+			for readAhead < keepAliveReadAhead && pendingSize < keepAliveMaxBuffer {
+				buff, ok := nextDoc()
+				if !ok {
+					exhausted = true
+					break
+				}
+				pending = append(pending, buff)
+				pendingSize += len(buff)
+				readAhead += len(buff)
+			}
+			log.Logf(log.DebugLow, "writes stalled for over %v; read ahead %v to keep the cursor alive",
+				keepAlive, text.FormatByteAmount(int64(readAhead)))
+		}
+	}
+}
+
 // DumpUsersAndRolesForDB queries and dumps the users and roles tied to the given
 // database. Only works with an authentication schema version >= 3.
 func (dump *MongoDump) DumpUsersAndRolesForDB(db string) error {
+	return dump.dumpUsersRolesVersion(db,
+		dump.manager.Users(), dump.manager.Roles(), dump.manager.AuthVersion())
+}
+
+// DumpUsersAndRolesPerDB dumps the users and roles tied to each database in a
+// full dump in to that database's folder, as DumpUsersAndRolesForDB does for a
+// single database. Only works with an authentication schema version >= 3.
+func (dump *MongoDump) DumpUsersAndRolesPerDB() error {
+	for _, dbName := range dump.dumpedDBs() {
+		log.Logf(log.Info, "dumping users and roles for %v", dbName)
+		usersIntent, rolesIntent, versionIntent := dump.newUsersRolesVersionIntents(dbName)
+		err := dump.dumpUsersRolesVersion(dbName, usersIntent, rolesIntent, versionIntent)
+		if err != nil {
+			return fmt.Errorf("error dumping users and roles for db %v: %v", dbName, err)
+		}
+	}
+	return nil
+}
+
+// dumpedDBs returns the sorted names of the databases with collections being
+// dumped, other than admin. It must be called before the manager is finalized.
+func (dump *MongoDump) dumpedDBs() []string {
+	seen := map[string]bool{}
+	dbNames := []string{}
+	for _, intent := range dump.manager.Intents() {
+		if intent.DB == "" || intent.DB == "admin" || intent.IsSpecialCollection() || seen[intent.DB] {
+			continue
+		}
+		seen[intent.DB] = true
+		dbNames = append(dbNames, intent.DB)
+	}
+	sort.Strings(dbNames)
+	return dbNames
+}
+
+// dumpUsersRolesVersion dumps the users and roles tied to the given database,
+// along with the auth schema version, to the given intents.
+func (dump *MongoDump) dumpUsersRolesVersion(db string,
+	usersIntent, rolesIntent, versionIntent *intents.Intent) error {
 	session, err := dump.sessionProvider.GetSession()
 	if err != nil {
 		return err
@@ -534,37 +1177,34 @@ func (dump *MongoDump) DumpUsersAndRolesForDB(db string) error {
 
 	dbQuery := bson.M{"db": db}
 	usersQuery := session.DB("admin").C("system.users").Find(dbQuery)
-	intent := dump.manager.Users()
-	err = intent.BSONFile.Open()
+	err = usersIntent.BSONFile.Open()
 	if err != nil {
 		return fmt.Errorf("error opening output stream for dumping Users: %v", err)
 	}
-	defer intent.BSONFile.Close()
-	err = dump.dumpQueryToWriter(usersQuery, intent)
+	defer usersIntent.BSONFile.Close()
+	err = dump.dumpQueryToWriter(usersQuery, usersIntent)
 	if err != nil {
 		return fmt.Errorf("error dumping db users: %v", err)
 	}
 
 	rolesQuery := session.DB("admin").C("system.roles").Find(dbQuery)
-	intent = dump.manager.Roles()
-	err = intent.BSONFile.Open()
+	err = rolesIntent.BSONFile.Open()
 	if err != nil {
 		return fmt.Errorf("error opening output stream for dumping Roles: %v", err)
 	}
-	defer intent.BSONFile.Close()
-	err = dump.dumpQueryToWriter(rolesQuery, intent)
+	defer rolesIntent.BSONFile.Close()
+	err = dump.dumpQueryToWriter(rolesQuery, rolesIntent)
 	if err != nil {
 		return fmt.Errorf("error dumping db roles: %v", err)
 	}
 
 	versionQuery := session.DB("admin").C("system.version").Find(nil)
-	intent = dump.manager.AuthVersion()
-	err = intent.BSONFile.Open()
+	err = versionIntent.BSONFile.Open()
 	if err != nil {
 		return fmt.Errorf("error opening output stream for dumping AuthVersion: %v", err)
 	}
-	defer intent.BSONFile.Close()
-	err = dump.dumpQueryToWriter(versionQuery, intent)
+	defer versionIntent.BSONFile.Close()
+	err = dump.dumpQueryToWriter(versionQuery, versionIntent)
 	if err != nil {
 		return fmt.Errorf("error dumping db auth version: %v", err)
 	}
@@ -612,6 +1252,10 @@ func (dump *MongoDump) DumpSystemIndexes() error {
 // DumpMetadata dumps the metadata for each intent in the manager
 // that has metadata
 func (dump *MongoDump) DumpMetadata() error {
+	indexBuilds, err := dump.inProgressIndexBuilds()
+	if err != nil {
+		log.Logf(log.Info, "unable to check for in-progress index builds: %v", err)
+	}
 	allIntents := dump.manager.Intents()
 	for _, intent := range allIntents {
 		if intent.MetadataFile != nil {
@@ -619,6 +1263,7 @@ func (dump *MongoDump) DumpMetadata() error {
 			if err != nil {
 				return err
 			}
+			dump.checkUnsupportedFeatures(intent, indexBuilds)
 		}
 	}
 	return nil
@@ -653,7 +1298,7 @@ func (wwc *wrappedWriterCloser) Close() error {
 
 func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 	if dump.OutputOptions.Archive == "-" {
-		out = &nopCloseWriter{os.Stdout}
+		out = &nopCloseWriter{dump.OutputWriter}
 	} else {
 		targetStat, err := os.Stat(dump.OutputOptions.Archive)
 		if err == nil && targetStat.IsDir() {
@@ -662,12 +1307,12 @@ func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 			if dump.OutputOptions.Gzip {
 				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
 			}
-			out, err = os.Create(defaultArchiveFilePath)
+			out, err = dump.createArchiveFile(defaultArchiveFilePath)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			out, err = os.Create(dump.OutputOptions.Archive)
+			out, err = dump.createArchiveFile(dump.OutputOptions.Archive)
 			if err != nil {
 				return nil, err
 			}
@@ -681,3 +1326,13 @@ func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 	}
 	return out, nil
 }
+
+// createArchiveFile creates the archive file with the dump's OutputTarget.
+// On disk, archive volumes are filled exactly, since archive blocks need
+// not be kept whole.
+func (dump *MongoDump) createArchiveFile(path string) (io.WriteCloser, error) {
+	if _, ok := dump.Target.(*fileTarget); ok {
+		return newVolumeWriter(path, dump.maxFileSize, false)
+	}
+	return dump.Target.Create(path)
+}
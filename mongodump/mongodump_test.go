@@ -1,9 +1,11 @@
 package mongodump
 
 import (
+	"context"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
@@ -18,6 +20,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -251,6 +254,342 @@ func TestMongoDumpValidateOptions(t *testing.T) {
 			So(err.Error(), ShouldContainSubstring, "cannot dump using a query without a specified collection")
 		})
 
+		Convey("--archivePartSize should be --maxFileSize for an archive file", func() {
+			md.OutputOptions.Archive = "dump.archive"
+			md.OutputOptions.ArchivePartSize = "0"
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--archivePartSize must be greater than zero")
+
+			md.OutputOptions.MaxFileSize = "1GB"
+			err = md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--archivePartSize can not be used with --maxFileSize")
+		})
+
+		Convey("--targetHost must name a single host", func() {
+			md.InputOptions.TargetHost = "rs0/host1:27017,host2:27017"
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--targetHost must name a single host")
+		})
+
+		Convey("--targetTags can not be combined with --targetHost", func() {
+			md.InputOptions.TargetHost = "host1:27017"
+			md.InputOptions.TargetTags = `{use: "backup"}`
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--targetTags can not be used with --targetHost")
+		})
+
+		Convey("--waitForLag requires --maxLag", func() {
+			md.InputOptions.WaitForLag = true
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--waitForLag requires --maxLag")
+		})
+
+		Convey("--targetHost should connect directly to the named member", func() {
+			md.ToolOptions.Host = "rs0/host1,host2"
+			md.ToolOptions.Port = "27017"
+			md.ToolOptions.ReplicaSetName = "rs0"
+
+			targetOpts := targetHostOptions(md.ToolOptions, "hidden1:27018")
+			So(targetOpts.Host, ShouldEqual, "hidden1:27018")
+			So(targetOpts.Port, ShouldEqual, "")
+			So(targetOpts.Direct, ShouldBeTrue)
+			So(targetOpts.ReplicaSetName, ShouldEqual, "")
+			So(md.ToolOptions.Host, ShouldEqual, "rs0/host1,host2")
+		})
+
+		Convey("we have to specify --sinceField and --since together", func() {
+			md.InputOptions.SinceField = "updatedAt"
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--since is required when --sinceField is specified")
+
+			md.InputOptions.SinceField = ""
+			md.InputOptions.Since = "2024-05-01T00:00:00Z"
+
+			err = md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--sinceField is required when --since is specified")
+		})
+
+		Convey("per-database users and roles are only allowed on full dumps", func() {
+			md.OutputOptions.DumpUsersAndRolesPerDB = true
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--dumpUsersAndRolesPerDb is only supported on full dumps")
+		})
+
+		Convey("--archiveThenDelete requires a --query and an output it can check", func() {
+			md.ToolOptions.Namespace.Collection = "events"
+			md.OutputOptions.ArchiveThenDelete = true
+			md.OutputOptions.DeleteBatchSize = 1000
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--archiveThenDelete requires --query")
+
+			md.InputOptions.Query = `{level: "debug"}`
+			md.OutputOptions.Out = "-"
+			err = md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--archiveThenDelete can not be used when writing to stdout")
+
+			md.OutputOptions.Out = ""
+			md.OutputOptions.OversizedDocs = "skip"
+			err = md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--oversizedDocs=fail")
+		})
+
+		Convey("--since should generate a range query on --sinceField", func() {
+			md.InputOptions.SinceField = "updatedAt"
+			md.InputOptions.Since = "2024-05-01T00:00:00Z"
+
+			So(md.addSinceToQuery(), ShouldBeNil)
+			So(md.query, ShouldResemble, bson.M{
+				"updatedAt": bson.M{"$gte": time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+			})
+		})
+
+		Convey("--since should be rejected if it is not a date", func() {
+			md.InputOptions.SinceField = "updatedAt"
+			md.InputOptions.Since = "yesterday"
+
+			err := md.addSinceToQuery()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "error parsing --since date")
+		})
+
+		Convey("--sshUser and --sshKeyFile require --sshHost", func() {
+			md.SSHOptions = &SSHOptions{SSHKeyFile: "id_rsa"}
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--sshUser and --sshKeyFile require --sshHost")
+		})
+
+		Convey("the SSH tunnel should forward to a single server", func() {
+			remoteAddr, err := tunnelRemoteAddr(&options.Connection{Host: "rs0/db1.internal", Port: "27018"})
+			So(err, ShouldBeNil)
+			So(remoteAddr, ShouldEqual, "db1.internal:27018")
+
+			remoteAddr, err = tunnelRemoteAddr(&options.Connection{})
+			So(err, ShouldBeNil)
+			So(remoteAddr, ShouldEqual, "localhost:27017")
+
+			_, err = tunnelRemoteAddr(&options.Connection{Host: "rs0/db1,db2"})
+			So(err, ShouldNotBeNil)
+
+			args := sshTunnelArgs(&SSHOptions{SSHHost: "bastion:2222", SSHUser: "ops", SSHKeyFile: "id_rsa"},
+				"127.0.0.1:40000", remoteAddr)
+			So(args, ShouldContain, "127.0.0.1:40000:localhost:27017")
+			So(args[len(args)-1], ShouldEqual, "bastion")
+			So(strings.Join(args, " "), ShouldContainSubstring, "-p 2222 -l ops -i id_rsa")
+		})
+
+	})
+}
+
+func TestMongoDumpStagger(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoDump instance", t, func() {
+		md := simpleMongoDumpInstance()
+
+		Convey("--stagger can not be negative", func() {
+			md.InputOptions.Stagger = -1
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--stagger can not be negative")
+		})
+
+		Convey("the first job thread should never be delayed", func() {
+			md.InputOptions.Stagger = 60
+			start := time.Now()
+			So(md.staggerStart(context.Background(), 0, nil), ShouldBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+
+		Convey("a delayed job thread should stop waiting when the dump is cancelled", func() {
+			md.InputOptions.Stagger = 60
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(md.staggerStart(ctx, 3, nil), ShouldEqual, context.Canceled)
+		})
+
+		Convey("a delayed job thread should stop waiting when there's no work left", func() {
+			md.InputOptions.Stagger = 60
+			drained := make(chan struct{})
+			close(drained)
+			start := time.Now()
+			So(md.staggerStart(context.Background(), 3, drained), ShouldBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+	})
+}
+
+func TestMongoDumpFailureReport(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoDump instance", t, func() {
+		md := simpleMongoDumpInstance()
+
+		Convey("no failures should be reported when none were recorded", func() {
+			So(md.reportFailures(), ShouldBeNil)
+		})
+
+		Convey("recorded failures should be reported as an error", func() {
+			md.recordFailure(&intents.Intent{DB: "db", C: "slow"}, fmt.Errorf("timed out"))
+			md.recordFailure(&intents.Intent{DB: "db", C: "broken"}, fmt.Errorf("bad data"))
+
+			err := md.reportFailures()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "2 collection(s) failed to dump")
+			So(md.failures[0].namespace, ShouldEqual, "db.slow")
+		})
+	})
+}
+
+func TestMongoDumpStats(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoDump instance that has dumped some collections", t, func() {
+		md := simpleMongoDumpInstance()
+		md.stats.start = time.Now().Add(-2 * time.Second)
+		md.recordStats(&intents.Intent{DB: "db", C: "b"}, 10, 1000, time.Second, nil)
+		md.recordStats(&intents.Intent{DB: "db", C: "a"}, 5, 500, time.Second, fmt.Errorf("timed out"))
+
+		Convey("the summary should total the collections in namespace order", func() {
+			summary := md.summarizeStats()
+			So(summary.Documents, ShouldEqual, 15)
+			So(summary.Bytes, ShouldEqual, 1500)
+			So(summary.Failures, ShouldEqual, 1)
+			So(summary.Collections[0].Namespace, ShouldEqual, "db.a")
+			So(summary.Collections[0].Error, ShouldEqual, "timed out")
+			So(summary.BytesPerSec, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("the summary should be written to the --statsFile as JSON", func() {
+			statsFile, err := ioutil.TempFile("", "mongodump_stats")
+			So(err, ShouldBeNil)
+			So(statsFile.Close(), ShouldBeNil)
+			defer os.Remove(statsFile.Name())
+
+			md.OutputOptions.StatsFile = statsFile.Name()
+			So(md.reportStats(nil), ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(statsFile.Name())
+			So(err, ShouldBeNil)
+			summary := dumpStats{}
+			So(json.Unmarshal(contents, &summary), ShouldBeNil)
+			So(summary.Documents, ShouldEqual, 15)
+			So(len(summary.Collections), ShouldEqual, 2)
+			So(summary.Error, ShouldEqual, "")
+		})
+
+		Convey("a failed dump should still be written to the --statsFile, with its error", func() {
+			statsFile, err := ioutil.TempFile("", "mongodump_stats")
+			So(err, ShouldBeNil)
+			So(statsFile.Close(), ShouldBeNil)
+			defer os.Remove(statsFile.Name())
+
+			md.OutputOptions.StatsFile = statsFile.Name()
+			So(md.reportStats(fmt.Errorf("error dumping metadata: lost connection")), ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(statsFile.Name())
+			So(err, ShouldBeNil)
+			summary := dumpStats{}
+			So(json.Unmarshal(contents, &summary), ShouldBeNil)
+			So(summary.Documents, ShouldEqual, 15)
+			So(summary.Error, ShouldEqual, "error dumping metadata: lost connection")
+		})
+	})
+
+	Convey("Collections whose count changed during the dump should be flagged", t, func() {
+		So(countChanged(100, 100, 10), ShouldBeFalse)
+		So(countChanged(100, 105, 10), ShouldBeFalse)
+		So(countChanged(100, 89, 10), ShouldBeTrue)
+		So(countChanged(0, 3, 10), ShouldBeTrue)
+		So(countChanged(100, 50, 0), ShouldBeFalse)
+
+		md := simpleMongoDumpInstance()
+		md.OutputOptions.CountChangeThreshold = 10
+		changed := &intents.Intent{DB: "db", C: "changed"}
+		steady := &intents.Intent{DB: "db", C: "steady"}
+		md.stats.recordPreDumpCount(changed, 100)
+		md.stats.recordPreDumpCount(steady, 100)
+		md.recordStats(changed, 150, 1000, time.Second, nil)
+		md.recordStats(steady, 101, 1000, time.Second, nil)
+
+		summary := md.summarizeStats()
+		So(summary.CountChanges, ShouldEqual, 1)
+		So(summary.Collections[0].CountChanged, ShouldBeTrue)
+		So(*summary.Collections[0].PreDumpCount, ShouldEqual, 100)
+		So(summary.Collections[1].CountChanged, ShouldBeFalse)
+	})
+}
+
+func TestTargetTags(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("--targetTags should be a document of string tags", t, func() {
+		tags, err := parseTargetTags(`{dc: "east", use: "backup"}`)
+		So(err, ShouldBeNil)
+		So(tags, ShouldResemble, map[string]string{"dc": "east", "use": "backup"})
+
+		_, err = parseTargetTags(`{dc: 1}`)
+		So(err, ShouldNotBeNil)
+		_, err = parseTargetTags(`{}`)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestBehaviorOptions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Collection options that change behavior should be recognized", t, func() {
+		options := bson.D{
+			{"validator", bson.M{"x": bson.M{"$exists": true}}},
+			{"validationLevel", "moderate"},
+			{"collation", bson.M{"locale": "fr"}},
+			{"flags", 1},
+		}
+		So(behaviorOptions(options), ShouldResemble, []string{"collation", "validationLevel", "validator"})
+		So(behaviorOptions(bson.D{}), ShouldResemble, []string{})
+	})
+}
+
+func TestGridFSBuckets(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With intents for several collections", t, func() {
+		allIntents := []*intents.Intent{
+			{DB: "db", C: "fs.chunks"},
+			{DB: "db", C: "fs.files"},
+			{DB: "db", C: "photos.files"},
+			{DB: "db", C: "photos.chunks"},
+			{DB: "db", C: "videos.files"},
+			{DB: "other", C: "videos.chunks"},
+			{DB: "db", C: "users"},
+		}
+
+		Convey("only buckets with both collections in the dump should be found", func() {
+			buckets := gridFSBuckets(allIntents)
+			So(len(buckets), ShouldEqual, 2)
+			So(buckets["db.fs.files"], ShouldEqual, "db.fs.chunks")
+			So(buckets["db.photos.files"], ShouldEqual, "db.photos.chunks")
+		})
 	})
 }
 
@@ -272,7 +611,7 @@ func TestMongoDumpKerberos(t *testing.T) {
 
 		err = mongoDump.Init()
 		So(err, ShouldBeNil)
-		err = mongoDump.Dump()
+		err = mongoDump.Dump(context.Background())
 		So(err, ShouldBeNil)
 		path, err := os.Getwd()
 		So(err, ShouldBeNil)
@@ -311,7 +650,7 @@ func TestMongoDumpBSON(t *testing.T) {
 				Convey("it dumps to the default output directory", func() {
 					// we don't have to set this manually if parsing options via command line
 					md.OutputOptions.Out = "dump"
-					err = md.Dump()
+					err = md.Dump(context.Background())
 					So(err, ShouldBeNil)
 					path, err := os.Getwd()
 					So(err, ShouldBeNil)
@@ -364,7 +703,7 @@ func TestMongoDumpBSON(t *testing.T) {
 
 				Convey("it dumps to a user-specified output directory", func() {
 					md.OutputOptions.Out = "dump_user"
-					err = md.Dump()
+					err = md.Dump(context.Background())
 					So(err, ShouldBeNil)
 					path, err := os.Getwd()
 					So(err, ShouldBeNil)
@@ -393,7 +732,7 @@ func TestMongoDumpBSON(t *testing.T) {
 
 				Convey("that exists. The dumped directory should contain the necessary bson files", func() {
 					md.OutputOptions.Out = "dump"
-					err = md.Dump()
+					err = md.Dump(context.Background())
 					So(err, ShouldBeNil)
 					path, err := os.Getwd()
 					So(err, ShouldBeNil)
@@ -416,7 +755,7 @@ func TestMongoDumpBSON(t *testing.T) {
 				Convey("that does not exist. The dumped directory shouldn't be created", func() {
 					md.OutputOptions.Out = "dump"
 					md.ToolOptions.Namespace.DB = "nottestdb"
-					err = md.Dump()
+					err = md.Dump(context.Background())
 					So(err, ShouldBeNil)
 
 					path, err := os.Getwd()
@@ -459,7 +798,7 @@ func TestMongoDumpBSON(t *testing.T) {
 					err = md.Init()
 					So(err, ShouldBeNil)
 
-					err = md.Dump()
+					err = md.Dump(context.Background())
 					So(err, ShouldBeNil)
 				}
 
@@ -515,7 +854,7 @@ func TestMongoDumpMetaData(t *testing.T) {
 			err = md.Init()
 			So(err, ShouldBeNil)
 
-			err = md.Dump()
+			err = md.Dump(context.Background())
 			So(err, ShouldBeNil)
 
 			path, err := os.Getwd()
@@ -0,0 +1,250 @@
+package mongodump
+
+import (
+	"context"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+const (
+	// oplogHeadroomInterval is how often the oplog's headroom is checked
+	// while collections are dumped.
+	oplogHeadroomInterval = 30 * time.Second
+
+	// oplogCaptureWait is how long the rolling capture waits for new oplog
+	// entries before checking whether it is done.
+	oplogCaptureWait = time.Second
+)
+
+// timestampTime returns the wall clock time of an oplog timestamp.
+func timestampTime(ts bson.MongoTimestamp) time.Time {
+	return time.Unix(int64(uint64(ts)>>32), 0)
+}
+
+// oplogHeadroom returns how far the oldest entry of the oplog is from the
+// entry the dump's oplog starts after: how much more the oplog can roll over
+// before the dump can no longer capture all of its entries.
+func oplogHeadroom(start, oldest bson.MongoTimestamp) time.Duration {
+	return timestampTime(start).Sub(timestampTime(oldest))
+}
+
+// getOplogOldestTime returns the timestamp of the oldest oplog entry.
+func (dump *MongoDump) getOplogOldestTime() (bson.MongoTimestamp, error) {
+	oldestOplogEntry := db.Oplog{}
+	err := dump.sessionProvider.FindOne("local", dump.oplogCollection, 0, nil, []string{"+$natural"}, &oldestOplogEntry, 0)
+	if err != nil {
+		return 0, err
+	}
+	return oldestOplogEntry.Timestamp, nil
+}
+
+// oplogCursor is the part of a tailable *mgo.Iter the rolling capture
+// reads the oplog with.
+type oplogCursor interface {
+	Next(result interface{}) bool
+	Err() error
+	Timeout() bool
+	Close() error
+}
+
+// oplogSource is the oplog the rolling capture reads.
+type oplogSource interface {
+	// tail returns a tailable cursor on the entries after the timestamp,
+	// timing out after oplogCaptureWait without new entries
+	tail(from bson.MongoTimestamp) oplogCursor
+	// exists returns true if the oplog still holds the entry at the timestamp
+	exists(ts bson.MongoTimestamp) (bool, error)
+}
+
+// serverOplog is the oplog of the server being dumped.
+type serverOplog struct {
+	dump  *MongoDump
+	oplog *mgo.Collection
+}
+
+func (source serverOplog) tail(from bson.MongoTimestamp) oplogCursor {
+	return source.oplog.Find(bson.M{"ts": bson.M{"$gt": from}}).LogReplay().Tail(oplogCaptureWait)
+}
+
+func (source serverOplog) exists(ts bson.MongoTimestamp) (bool, error) {
+	return source.dump.checkOplogTimestampExists(ts)
+}
+
+// oplogCapture is a rolling capture of the oplog, streaming its entries to
+// the dump's oplog file while collections are still being dumped.
+type oplogCapture struct {
+	tracker *oplogEndTracker
+	// receives the timestamp to capture up to once collections are dumped
+	stop chan bson.MongoTimestamp
+	// receives the capture's outcome once it ends
+	done chan error
+}
+
+// newOplogCapture returns a capture writing the entries after the
+// timestamp to the file.
+func newOplogCapture(file oplogFile, start bson.MongoTimestamp) *oplogCapture {
+	return &oplogCapture{
+		tracker: &oplogEndTracker{oplogFile: file, last: start},
+		stop:    make(chan bson.MongoTimestamp, 1),
+		done:    make(chan error, 1),
+	}
+}
+
+// watchOplogHeadroom checks, every oplogHeadroomInterval until the returned
+// function is called, whether the oplog is within --oplogCaptureHeadroom of
+// rolling over past the dump's oplog start, and if so starts a rolling
+// capture of the oplog, returned by the function.
+func (dump *MongoDump) watchOplogHeadroom() func() *oplogCapture {
+	threshold := time.Duration(dump.OutputOptions.OplogCaptureHeadroom) * time.Second
+	return watchHeadroom(dump.oplogStart, threshold, oplogHeadroomInterval, dump.getOplogOldestTime,
+		func(headroom time.Duration) *oplogCapture {
+			log.Logf(log.Always, "the oplog is within %v of rolling over past the dump's start; "+
+				"writing it to %v while collections are dumped", headroom, dump.manager.Oplog().BSONPath)
+			return dump.startOplogCapture()
+		})
+}
+
+// watchHeadroom gets the oldest oplog entry every interval, until the
+// returned function is called, and once the oplog can roll over less than
+// threshold past start, calls begin and stops watching. The returned
+// function returns what begin did, or nil if it wasn't called.
+func watchHeadroom(start bson.MongoTimestamp, threshold, interval time.Duration,
+	oldest func() (bson.MongoTimestamp, error), begin func(time.Duration) *oplogCapture) func() *oplogCapture {
+	done := make(chan struct{})
+	result := make(chan *oplogCapture, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				result <- nil
+				return
+			case <-ticker.C:
+			}
+			oldestTS, err := oldest()
+			if err != nil {
+				log.Logf(log.Info, "error reading the oldest oplog entry: %v", err)
+				continue
+			}
+			headroom := oplogHeadroom(start, oldestTS)
+			log.Logf(log.DebugLow, "the oplog can roll over %v more before it is past the dump's start", headroom)
+			if headroom > threshold {
+				continue
+			}
+			result <- begin(headroom)
+			return
+		}
+	}()
+	return func() *oplogCapture {
+		close(done)
+		return <-result
+	}
+}
+
+// startOplogCapture starts capturing the oplog entries after the dump's
+// oplog start to the oplog's file.
+func (dump *MongoDump) startOplogCapture() *oplogCapture {
+	capture := newOplogCapture(dump.manager.Oplog().BSONFile, dump.oplogStart)
+	go func() {
+		capture.done <- dump.captureOplog(capture)
+	}()
+	return capture
+}
+
+// finish waits for the capture to have written the entry at the timestamp,
+// the latest in the oplog once collections are dumped, and returns the
+// capture's error, if any. A timestamp of 0 stops the capture as soon as
+// possible, such as when the dump failed.
+func (capture *oplogCapture) finish(ts bson.MongoTimestamp) error {
+	capture.stop <- ts
+	return <-capture.done
+}
+
+// captureOplog tails the server's oplog into the oplog's file.
+func (dump *MongoDump) captureOplog(capture *oplogCapture) error {
+	oplogFile := capture.tracker.oplogFile
+	if err := oplogFile.Open(); err != nil {
+		return fmt.Errorf("error opening oplog file: %v", err)
+	}
+	defer oplogFile.Close()
+
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+	source := serverOplog{dump, session.DB("local").C(dump.oplogCollection)}
+	return capture.run(dump.context(), source)
+}
+
+// run tails the oplog from the capture's start, writing its entries until
+// told to stop and caught up. The cursor is reopened after the last entry
+// written if the server closes it.
+func (capture *oplogCapture) run(ctx context.Context, source oplogSource) error {
+	from := capture.tracker.last
+	stopAt := bson.MongoTimestamp(-1)
+	for {
+		done, err := capture.tail(ctx, source, from, &stopAt)
+		if done || err != nil {
+			return err
+		}
+		if capture.tracker.last > from {
+			from = capture.tracker.last
+		}
+		log.Logf(log.DebugLow, "oplog cursor closed; reopening it after %v", from)
+		time.Sleep(oplogCaptureWait)
+	}
+}
+
+// tail writes the entries after the timestamp from a tailable cursor until
+// it's closed, returning true once the capture is done: told to stop, with
+// stopAt set, and caught up to it.
+func (capture *oplogCapture) tail(ctx context.Context, source oplogSource, from bson.MongoTimestamp,
+	stopAt *bson.MongoTimestamp) (bool, error) {
+	iter := source.tail(from)
+	defer iter.Close()
+	verified := false
+	entry := bson.Raw{}
+	for {
+		for iter.Next(&entry) {
+			if _, err := capture.tracker.Write(entry.Data); err != nil {
+				return false, fmt.Errorf("error writing oplog entry: %v", err)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return false, fmt.Errorf("error tailing oplog: %v", err)
+		}
+		// once the cursor has started reading, the entry it reads after must
+		// still be in the oplog, or entries were lost between the two
+		if !verified {
+			exists, err := source.exists(from)
+			if err != nil {
+				return false, fmt.Errorf("unable to check oplog for overflow: %v", err)
+			}
+			if !exists {
+				return false, fmt.Errorf(
+					"oplog overflow: mongodump was unable to capture all new oplog entries during execution")
+			}
+			verified = true
+		}
+		select {
+		case ts := <-capture.stop:
+			*stopAt = ts
+		case <-ctx.Done():
+			return false, ctx.Err()
+		default:
+		}
+		if *stopAt >= 0 && capture.tracker.last >= *stopAt {
+			return true, nil
+		}
+		if !iter.Timeout() {
+			return false, nil
+		}
+	}
+}
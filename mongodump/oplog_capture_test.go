@@ -0,0 +1,215 @@
+package mongodump
+
+import (
+	"context"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOplogHeadroom(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With oplog timestamps", t, func() {
+		ts := func(seconds, inc int64) bson.MongoTimestamp {
+			return bson.MongoTimestamp(seconds<<32 | inc)
+		}
+
+		Convey("the wall clock time of a timestamp ignores its increment", func() {
+			So(timestampTime(ts(1500000000, 7)), ShouldResemble, time.Unix(1500000000, 0))
+		})
+
+		Convey("the headroom is how far the oldest entry is behind the start", func() {
+			So(oplogHeadroom(ts(1500000600, 1), ts(1500000000, 9)), ShouldEqual, 10*time.Minute)
+			So(oplogHeadroom(ts(1500000000, 1), ts(1500000000, 1)), ShouldEqual, 0)
+		})
+
+		Convey("the headroom is negative once the oplog rolled over past the start", func() {
+			So(oplogHeadroom(ts(1500000000, 1), ts(1500000030, 1)), ShouldEqual, -30*time.Second)
+		})
+	})
+}
+
+// fakeOplog is an oplog growing as entries are added, read by cursors that
+// the server closes after closeAfter entries, if set.
+type fakeOplog struct {
+	sync.Mutex
+	entries    []bson.MongoTimestamp
+	tails      []bson.MongoTimestamp
+	closeAfter int
+	missing    bool
+}
+
+func (oplog *fakeOplog) add(ts ...bson.MongoTimestamp) {
+	oplog.Lock()
+	defer oplog.Unlock()
+	oplog.entries = append(oplog.entries, ts...)
+}
+
+func (oplog *fakeOplog) tail(from bson.MongoTimestamp) oplogCursor {
+	oplog.Lock()
+	defer oplog.Unlock()
+	oplog.tails = append(oplog.tails, from)
+	return &fakeCursor{oplog: oplog, last: from}
+}
+
+func (oplog *fakeOplog) exists(ts bson.MongoTimestamp) (bool, error) {
+	return !oplog.missing, nil
+}
+
+// fakeCursor reads the entries of a fakeOplog after the last one it read.
+type fakeCursor struct {
+	oplog  *fakeOplog
+	last   bson.MongoTimestamp
+	read   int
+	closed bool
+}
+
+func (cursor *fakeCursor) Next(result interface{}) bool {
+	cursor.oplog.Lock()
+	defer cursor.oplog.Unlock()
+	if cursor.oplog.closeAfter > 0 && cursor.read >= cursor.oplog.closeAfter {
+		cursor.closed = true
+		return false
+	}
+	for _, ts := range cursor.oplog.entries {
+		if ts > cursor.last {
+			data, _ := bson.Marshal(bson.D{{"ts", ts}, {"op", "n"}})
+			*result.(*bson.Raw) = bson.Raw{Kind: 0x03, Data: data}
+			cursor.last = ts
+			cursor.read++
+			return true
+		}
+	}
+	return false
+}
+
+func (cursor *fakeCursor) Err() error    { return nil }
+func (cursor *fakeCursor) Timeout() bool { return !cursor.closed }
+func (cursor *fakeCursor) Close() error  { return nil }
+
+// writtenEntries returns the timestamps of the entries written to the file.
+func writtenEntries(file *bufferFile) []bson.MongoTimestamp {
+	written := []bson.MongoTimestamp{}
+	data := file.Bytes()
+	for len(data) > 0 {
+		size := documentSize(data)
+		entry := struct {
+			Timestamp bson.MongoTimestamp `bson:"ts"`
+		}{}
+		So(bson.Unmarshal(data[:size], &entry), ShouldBeNil)
+		written = append(written, entry.Timestamp)
+		data = data[size:]
+	}
+	return written
+}
+
+func TestOplogCapture(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a rolling capture of an oplog after entry 2", t, func() {
+		oplog := &fakeOplog{entries: []bson.MongoTimestamp{1, 2, 3}}
+		file := &bufferFile{}
+		capture := newOplogCapture(file, 2)
+		ctx, cancel := context.WithCancel(context.Background())
+		start := func() {
+			go func() {
+				capture.done <- capture.run(ctx, oplog)
+			}()
+		}
+
+		Convey("finishing it should wait for the entries up to the latest", func() {
+			start()
+			oplog.add(4, 5)
+			So(capture.finish(5), ShouldBeNil)
+			So(writtenEntries(file), ShouldResemble, []bson.MongoTimestamp{3, 4, 5})
+			So(capture.tracker.last, ShouldEqual, 5)
+		})
+
+		Convey("finishing it at 0 should stop it without waiting", func() {
+			start()
+			So(capture.finish(0), ShouldBeNil)
+			So(oplog.tails, ShouldResemble, []bson.MongoTimestamp{2})
+		})
+
+		Convey("a cursor the server closes should be reopened after the last entry written", func() {
+			oplog.closeAfter = 1
+			oplog.add(4)
+			start()
+			So(capture.finish(4), ShouldBeNil)
+			So(writtenEntries(file), ShouldResemble, []bson.MongoTimestamp{3, 4})
+			So(oplog.tails, ShouldResemble, []bson.MongoTimestamp{2, 3})
+		})
+
+		Convey("an oplog that rolled over past the start should fail it", func() {
+			oplog.missing = true
+			start()
+			err := capture.finish(3)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "oplog overflow")
+		})
+
+		Convey("cancelling the dump should stop it", func() {
+			start()
+			cancel()
+			So(<-capture.done, ShouldEqual, context.Canceled)
+		})
+
+		Reset(func() {
+			cancel()
+		})
+	})
+}
+
+func TestWatchOplogHeadroom(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When watching the oplog's headroom", t, func() {
+		start := bson.MongoTimestamp(1500000600 << 32)
+		capture := &oplogCapture{}
+		begun := make(chan time.Duration, 1)
+		begin := func(headroom time.Duration) *oplogCapture {
+			begun <- headroom
+			return capture
+		}
+
+		Convey("a capture should begin once the headroom drops under the threshold", func() {
+			oldest := make(chan bson.MongoTimestamp, 3)
+			oldest <- 1500000000 << 32
+			oldest <- 1500000500 << 32
+			stop := watchHeadroom(start, 5*time.Minute, time.Millisecond, func() (bson.MongoTimestamp, error) {
+				return <-oldest, nil
+			}, begin)
+			So(<-begun, ShouldEqual, 100*time.Second)
+			So(stop(), ShouldEqual, capture)
+		})
+
+		Convey("errors reading the oplog should be skipped", func() {
+			failures := 0
+			stop := watchHeadroom(start, 5*time.Minute, time.Millisecond, func() (bson.MongoTimestamp, error) {
+				if failures < 2 {
+					failures++
+					return 0, fmt.Errorf("not master")
+				}
+				return start, nil
+			}, begin)
+			So(<-begun, ShouldEqual, 0)
+			So(stop(), ShouldEqual, capture)
+		})
+
+		Convey("no capture should begin when the watch stops first", func() {
+			stop := watchHeadroom(start, 5*time.Minute, time.Hour, func() (bson.MongoTimestamp, error) {
+				return start, nil
+			}, begin)
+			So(stop(), ShouldBeNil)
+			So(len(begun), ShouldEqual, 0)
+		})
+	})
+}
@@ -66,7 +66,8 @@ func (dump *MongoDump) checkOplogTimestampExists(ts bson.MongoTimestamp) (bool,
 }
 
 // DumpOplogAfterTimestamp takes a timestamp and writer and dumps all oplog entries after
-// the given timestamp to the writer. Returns any errors that occur.
+// the given timestamp to the writer, keeping the timestamp of the last one as the
+// dump's oplogEnd. Returns any errors that occur.
 func (dump *MongoDump) DumpOplogAfterTimestamp(ts bson.MongoTimestamp) error {
 	session, err := dump.sessionProvider.GetSession()
 	if err != nil {
@@ -76,5 +77,14 @@ func (dump *MongoDump) DumpOplogAfterTimestamp(ts bson.MongoTimestamp) error {
 	session.SetPrefetch(1.0) // mimic exhaust cursor
 	queryObj := bson.M{"ts": bson.M{"$gt": ts}}
 	oplogQuery := session.DB("local").C(dump.oplogCollection).Find(queryObj).LogReplay()
-	return dump.dumpQueryToWriter(oplogQuery, dump.manager.Oplog())
+	oplogIntent := *dump.manager.Oplog()
+	if err = oplogIntent.BSONFile.Open(); err != nil {
+		return fmt.Errorf("error opening oplog file: %v", err)
+	}
+	defer oplogIntent.BSONFile.Close()
+	tracker := &oplogEndTracker{oplogFile: oplogIntent.BSONFile}
+	oplogIntent.BSONFile = tracker
+	err = dump.dumpQueryToWriter(oplogQuery, &oplogIntent)
+	dump.oplogEnd = tracker.last
+	return err
 }
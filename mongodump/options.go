@@ -12,6 +12,34 @@ See http://docs.mongodb.org/manual/reference/program/mongodump/ for more informa
 type InputOptions struct {
 	Query     string `long:"query" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
 	TableScan bool   `long:"forceTableScan" description:"force a table scan"`
+
+	// SinceField and Since together restrict every dumped collection to
+	// documents whose SinceField is on or after the Since date
+	SinceField string `long:"sinceField" description:"date field used with --since to select recently modified documents, e.g. --sinceField updatedAt"`
+	Since      string `long:"since" description:"only dump documents whose --sinceField is on or after this date, e.g. --since 2024-05-01T00:00:00Z"`
+
+	// CursorKeepAlive is how long writes may stall before dump cursors start
+	// reading ahead to keep the server cursor alive
+	CursorKeepAlive int `long:"cursorKeepAliveSecs" default:"300" default-mask:"-" description:"when writing output stalls for this many seconds, read ahead in the background so the server cursor is not reaped; 0 disables (defaults to 300)"`
+
+	// PauseFile pauses the dump while it exists
+	PauseFile string `long:"pauseFile" description:"pause the dump while this file exists, checking for it every second, to yield to production load without restarting it; the dump can also be paused with SIGUSR1 and resumed with SIGUSR2; paused cursors are kept alive as with --cursorKeepAliveSecs"`
+
+	// TargetHost forces the dump onto a single replica set member
+	TargetHost string `long:"targetHost" description:"dump from this replica set member, e.g. a hidden secondary, connecting to it directly instead of letting the driver select a server; if --host names a replica set, the member must belong to it"`
+
+	// TargetTags picks the replica set member to dump from by its tags
+	TargetTags string `long:"targetTags" description:"dump from the least lagged secondary whose replica set tags include these, as a JSON document, e.g. '{dc:\"east\",use:\"backup\"}'; the member is then used as with --targetHost"`
+
+	// MaxLag guards against dumping from a member that is too far behind
+	MaxLag     int  `long:"maxLag" description:"refuse to start dumping when the member's replication lag exceeds this many seconds, and warn if it does so during the dump; 0 disables"`
+	WaitForLag bool `long:"waitForLag" description:"with --maxLag, wait for the member's replication lag to drop below the limit instead of refusing to start"`
+
+	// CollectionTimeout bounds the time spent dumping any single collection
+	CollectionTimeout int `long:"collectionTimeout" description:"maximum number of seconds to spend dumping any one collection, not counting the time the dump is paused; 0 for no limit (see --continueOnError)"`
+
+	// Stagger spaces out the job threads' first collection scans
+	Stagger int `long:"stagger" description:"number of seconds to wait between starting each job thread, so parallel dumps don't begin scanning their first collections at once; 0 starts them together"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -25,10 +53,25 @@ type OutputOptions struct {
 	Gzip                       bool     `long:"gzip" description:"compress archive our collection output with Gzip"`
 	Repair                     bool     `long:"repair" description:"try to recover documents from damaged data files (not supported by all storage engines)"`
 	Oplog                      bool     `long:"oplog" description:"use oplog for taking a point-in-time snapshot"`
+	OplogCaptureHeadroom       int      `long:"oplogCaptureHeadroom" value-name:"<seconds>" default:"600" default-mask:"-" description:"with --oplog, once the oldest oplog entry is within this many seconds of the dump's start, write the oplog to the dump while collections are still being dumped, rather than after them, so a busy oplog rolling over during a long dump doesn't fail it; 0 disables (defaults to 600)"`
 	Archive                    string   `long:"archive" optional:"true" optional-value:"-" description:"dump in to the specified dump-archive instead of a directory"`
 	DumpDBUsersAndRoles        bool     `long:"dumpDbUsersAndRoles" description:"dump user and role definitions for the specified database"`
+	DumpUsersAndRolesPerDB     bool     `long:"dumpUsersAndRolesPerDb" description:"in a full dump, also dump each database's user and role definitions in to its folder, as --dumpDbUsersAndRoles does for one database"`
 	ExcludedCollections        []string `long:"excludeCollection" description:"collection to exclude from the dump (may be specified multiple times to exclude additional collections)"`
 	ExcludedCollectionPrefixes []string `long:"excludeCollectionsWithPrefix" description:"exclude all collections from the dump that have the given prefix (may be specified multiple times to exclude additional prefixes)"`
+	MaxFileSize                string   `long:"maxFileSize" description:"split each .bson file or archive into numbered volumes (.001, .002, ...) of at most this size, e.g. 2GB; concatenate the volumes of a .bson file to restore it; mongorestore --archive reads an archive's volumes back given its path"`
+	ArchivePartSize            string   `long:"archivePartSize" description:"the same as --maxFileSize, for an archive file: write the archive as numbered volumes (.001, .002, ...) of at most this size, e.g. 5GB; mongorestore --archive reads the volumes back given the archive path"`
+	ContinueOnError            bool     `long:"continueOnError" description:"continue dumping the remaining collections when one fails or exceeds --collectionTimeout, reporting the failures at the end"`
+	StatsFile                  string   `long:"statsFile" description:"write a JSON summary of the dump (per-collection document counts, bytes written, durations, and throughput) to this file, also when the dump fails"`
+	HandoffFile                string   `long:"handoffFile" description:"with --oplog, write the oplog timestamp the dump is consistent as of, and the cluster time, as JSON to this file, so change data capture can start where the dump ends"`
+	CountChangeThreshold       float64  `long:"countChangeThreshold" default:"10" default-mask:"-" description:"warn when the number of documents dumped from a collection differs from its count before the dump by more than this percentage, as the collection changed while being dumped; 0 disables (defaults to 10)"`
+	OversizedDocs              string   `long:"oversizedDocs" default:"fail" default-mask:"-" description:"what to do with documents over the 16MB BSON limit: fail, skip or truncate (defaults to 'fail')"`
+	TruncateFields             string   `long:"truncateFields" description:"comma-separated fields to remove, in order, from documents over the BSON limit until they fit, with --oversizedDocs=truncate"`
+	GridFSConsistent           bool     `long:"gridfsConsistent" description:"dump each GridFS bucket's files and chunks collections from the same list of files, so every dumped file has all of its chunks"`
+	ArchiveThenDelete          bool     `long:"archiveThenDelete" description:"once the documents matching --query are dumped, check that the collection still holds exactly those documents, by count and checksum, then delete them from it in batches; for archiving old data in one step"`
+	DeleteBatchSize            int      `long:"deleteBatchSize" default:"1000" default-mask:"-" description:"number of documents to delete per batch with --archiveThenDelete (defaults to 1000)"`
+	DeleteRateLimit            float64  `long:"deleteRateLimit" description:"with --archiveThenDelete, delete at most this many documents per second; 0 for no limit"`
+	NoProgressHistory          bool     `long:"noProgressHistory" description:"don't draw a sparkline of each progress bar's recent throughput, which is otherwise drawn when standard error is a terminal"`
 }
 
 // Name returns a human-readable group name for output options.
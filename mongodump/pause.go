@@ -0,0 +1,170 @@
+package mongodump
+
+import (
+	"context"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/signals"
+	"os"
+	"sync"
+	"time"
+)
+
+// pauseFilePollInterval is how often the --pauseFile is checked for.
+const pauseFilePollInterval = time.Second
+
+// pauser lets operators pause the dump, to yield to production load
+// without restarting it: SIGUSR1 pauses it until SIGUSR2, and so does the
+// presence of the --pauseFile. While paused, the cursors are kept alive by
+// the read-ahead of --cursorKeepAliveSecs. A nil pauser never pauses.
+type pauser struct {
+	file string
+
+	mutex     sync.Mutex
+	signalled bool
+	fileFound bool
+	// resumed is closed when the dump resumes, and replaced when it pauses
+	resumed chan struct{}
+	// pausedSince is when the current pause began, and pausedTotal the
+	// time spent in earlier pauses
+	pausedSince time.Time
+	pausedTotal time.Duration
+
+	stopChan chan struct{}
+}
+
+// newPauser starts watching for the pause and resume signals, and for the
+// pause file, if any. It must be stopped once the dump is done.
+func newPauser(file string) *pauser {
+	p := &pauser{
+		file:     file,
+		resumed:  make(chan struct{}),
+		stopChan: make(chan struct{}),
+	}
+	close(p.resumed)
+	go p.watch()
+	return p
+}
+
+// watch updates the pause state from the signals and the pause file until
+// the pauser is stopped.
+func (p *pauser) watch() {
+	pause := make(chan os.Signal, 1)
+	resume := make(chan os.Signal, 1)
+	signals.NotifyPause(pause, resume)
+	defer signals.StopPause(pause, resume)
+
+	var poll <-chan time.Time
+	if p.file != "" {
+		ticker := time.NewTicker(pauseFilePollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+		p.checkFile()
+	}
+	for {
+		select {
+		case <-pause:
+			p.setSignalled(true)
+		case <-resume:
+			p.setSignalled(false)
+		case <-poll:
+			p.checkFile()
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+func (p *pauser) setSignalled(signalled bool) {
+	p.update(func() {
+		p.signalled = signalled
+	})
+}
+
+func (p *pauser) checkFile() {
+	_, err := os.Stat(p.file)
+	p.update(func() {
+		p.fileFound = err == nil
+	})
+}
+
+// update changes the pause state with change, logging when the dump pauses
+// or resumes.
+func (p *pauser) update(change func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	wasPaused := p.pausedLocked()
+	change()
+	switch paused := p.pausedLocked(); {
+	case paused && !wasPaused:
+		log.Logf(log.Always, "dump paused, %v", p.reasonLocked())
+		p.resumed = make(chan struct{})
+		p.pausedSince = time.Now()
+	case !paused && wasPaused:
+		log.Logf(log.Always, "dump resumed")
+		close(p.resumed)
+		p.pausedTotal += time.Since(p.pausedSince)
+	}
+}
+
+func (p *pauser) pausedLocked() bool {
+	return p.signalled || p.fileFound
+}
+
+// reasonLocked tells what keeps the dump paused.
+func (p *pauser) reasonLocked() string {
+	if p.fileFound {
+		return "until " + p.file + " is removed"
+	}
+	return "until resumed with SIGUSR2"
+}
+
+// wait blocks while the dump is paused, returning the context's error if it
+// is cancelled in the meantime.
+func (p *pauser) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mutex.Lock()
+	resumed := p.resumed
+	p.mutex.Unlock()
+	select {
+	case <-resumed:
+		return nil
+	default:
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pausedTime returns the total time the dump has spent paused so far,
+// including the current pause.
+func (p *pauser) pausedTime() time.Duration {
+	if p == nil {
+		return 0
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	total := p.pausedTotal
+	if p.pausedLocked() {
+		total += time.Since(p.pausedSince)
+	}
+	return total
+}
+
+// activeSince returns the time elapsed since start, less the time the dump
+// spent paused since then, pausedAtStart being its pausedTime at start.
+func (p *pauser) activeSince(start time.Time, pausedAtStart time.Duration) time.Duration {
+	return time.Since(start) - (p.pausedTime() - pausedAtStart)
+}
+
+// stop stops watching for the signals and the pause file.
+func (p *pauser) stop() {
+	if p == nil {
+		return
+	}
+	close(p.stopChan)
+}
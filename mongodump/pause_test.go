@@ -0,0 +1,117 @@
+package mongodump
+
+import (
+	"context"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitReturns reports whether the pauser's wait returns within a short
+// time, and with what error.
+func waitReturns(p *pauser, ctx context.Context) (bool, error) {
+	result := make(chan error, 1)
+	go func() {
+		result <- p.wait(ctx)
+	}()
+	select {
+	case err := <-result:
+		return true, err
+	case <-time.After(100 * time.Millisecond):
+		return false, nil
+	}
+}
+
+func TestPauser(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a pauser watching a pause file", t, func() {
+		dir, err := ioutil.TempDir("", "mongodump-pause")
+		So(err, ShouldBeNil)
+		pauseFile := filepath.Join(dir, "pause")
+		p := newPauser(pauseFile)
+		Reset(func() {
+			p.stop()
+			os.RemoveAll(dir)
+		})
+
+		Convey("the dump should go on while the file is absent", func() {
+			returned, err := waitReturns(p, context.Background())
+			So(returned, ShouldBeTrue)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("the dump should pause while the file exists", func() {
+			So(ioutil.WriteFile(pauseFile, nil, 0644), ShouldBeNil)
+			p.checkFile()
+			returned, _ := waitReturns(p, context.Background())
+			So(returned, ShouldBeFalse)
+
+			Convey("and resume once it is removed", func() {
+				So(os.Remove(pauseFile), ShouldBeNil)
+				p.checkFile()
+				returned, err := waitReturns(p, context.Background())
+				So(returned, ShouldBeTrue)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("and stay paused while also paused by signal", func() {
+				p.setSignalled(true)
+				So(os.Remove(pauseFile), ShouldBeNil)
+				p.checkFile()
+				returned, _ := waitReturns(p, context.Background())
+				So(returned, ShouldBeFalse)
+				p.setSignalled(false)
+				returned, _ = waitReturns(p, context.Background())
+				So(returned, ShouldBeTrue)
+			})
+
+			Convey("and stop waiting when the dump is cancelled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				returned, err := waitReturns(p, ctx)
+				So(returned, ShouldBeTrue)
+				So(err, ShouldEqual, context.Canceled)
+			})
+		})
+	})
+
+	Convey("With a pauser, the time spent paused should be tracked", t, func() {
+		p := newPauser("")
+		Reset(p.stop)
+		start := time.Now()
+		So(p.pausedTime(), ShouldEqual, 0)
+
+		p.setSignalled(true)
+		time.Sleep(50 * time.Millisecond)
+		So(p.pausedTime(), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+		p.setSignalled(false)
+		paused := p.pausedTime()
+		So(paused, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+
+		Convey("and left out of the time a collection has been dumping for", func() {
+			time.Sleep(20 * time.Millisecond)
+			So(p.pausedTime(), ShouldEqual, paused)
+			active := p.activeSince(start, 0)
+			So(active, ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+			So(active, ShouldBeLessThan, time.Since(start)-paused+time.Millisecond)
+		})
+
+		Convey("but not the pauses before the collection started", func() {
+			restart := time.Now()
+			So(p.activeSince(restart, p.pausedTime()), ShouldBeLessThan, 20*time.Millisecond)
+		})
+	})
+
+	Convey("A nil pauser should never pause", t, func() {
+		var p *pauser
+		So(p.wait(context.Background()), ShouldBeNil)
+		So(p.pausedTime(), ShouldEqual, 0)
+		p.stop()
+	})
+}
@@ -1,7 +1,6 @@
 package mongodump
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/archive"
@@ -11,7 +10,6 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"gopkg.in/mgo.v2/bson"
 	"io"
-	"os"
 	"path/filepath"
 	"strings"
 )
@@ -21,13 +19,14 @@ type collectionInfo struct {
 	Options *bson.D `bson:"options"`
 }
 
-// realBSONFile implements the intents.file interface. It lets intents write to real BSON files
-// ok disk via an embedded bufio.Writer
-// The Write method of the intents.file interface is implemented here by the embedded bufio.Writer
+// realBSONFile implements the intents.file interface. It lets intents write to BSON files
+// created by the dump's OutputTarget, which on disk splits the output into numbered volumes
+// when --maxFileSize is set.
+// The Write method of the intents.file interface is implemented here by the embedded io.WriteCloser
 type realBSONFile struct {
-	*bufio.Writer
-	file   *os.File
+	io.WriteCloser
 	intent *intents.Intent
+	target OutputTarget
 }
 
 // Open is part of the intents.file interface. realBSONFiles need to have Open called before
@@ -38,19 +37,10 @@ func (f *realBSONFile) Open() (err error) {
 		return fmt.Errorf("error creating BSON file without a path, namespace: %v",
 			f.intent.Namespace())
 	}
-	err = os.MkdirAll(filepath.Dir(f.intent.BSONPath), os.ModeDir|os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("error creating directory for BSON file %v: %v",
-			filepath.Dir(f.intent.BSONPath), err)
-	}
-	f.file, err = os.Create(f.intent.BSONPath)
+	f.WriteCloser, err = f.target.Create(f.intent.BSONPath)
 	if err != nil {
 		return fmt.Errorf("error creating BSON file %v: %v", f.intent.BSONPath, err)
 	}
-
-	// wrap writer in buffer to reduce load on disk
-	f.Writer = bufio.NewWriterSize(f.file, 32*1024)
-
 	return nil
 }
 
@@ -62,28 +52,23 @@ func (f *realBSONFile) Read([]byte) (int, error) {
 
 // Close is part of the intents.file interface, Close on realBSONFiles gets called in DumpIntent
 func (f *realBSONFile) Close() error {
-	err := f.Writer.Flush()
-	if err != nil {
-		return err
-	}
-	return f.file.Close()
+	return f.WriteCloser.Close()
 }
 
+// realMetadataFile implements the intents.file interface for metadata files
+// created by the dump's OutputTarget.
 type realMetadataFile struct {
-	*os.File
+	io.WriteCloser
 	intent *intents.Intent
+	target OutputTarget
 }
 
+// Open is part of the intents.file interface.
 func (f *realMetadataFile) Open() (err error) {
 	if f.intent.MetadataPath == "" {
 		return fmt.Errorf("No MetadataPath for %v.%v", f.intent.DB, f.intent.C)
 	}
-	err = os.MkdirAll(filepath.Dir(f.intent.MetadataPath), os.ModeDir|os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("error creating directory for Metadata file %v: %v",
-			filepath.Dir(f.intent.MetadataPath), err)
-	}
-	f.File, err = os.Create(f.intent.MetadataPath)
+	f.WriteCloser, err = f.target.Create(f.intent.MetadataPath)
 	if err != nil {
 		return fmt.Errorf("error creating Metadata file %v: %v",
 			f.intent.MetadataPath, err)
@@ -91,24 +76,27 @@ func (f *realMetadataFile) Open() (err error) {
 	return nil
 }
 
+// Read is part of the intents.file interface. Metadata files are never read back.
+func (f *realMetadataFile) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
 // stdoutFile implements the intents.file interface. stdoutFiles are used when single collections
-// are written directly (non-archive-mode) to standard out, via "--dir -"
+// are written directly (non-archive-mode) to standard out, via "--out -". They write to the
+// dump's OutputWriter.
 type stdoutFile struct {
-	*os.File
+	io.Writer
 	intent *intents.Intent
 }
 
 // Open is part of the intents.file interface.
 func (f *stdoutFile) Open() error {
-	f.File = os.Stdout
 	return nil
 }
 
-// Close is part of the intents.file interface. While we could actually close os.Stdout here,
-// that's actually a bad idea. Unsetting f.File here will cause future writes to fail, but that
-// shouldn't happen anyway.
+// Close is part of the intents.file interface. The OutputWriter is never closed, as it
+// is owned by the caller.
 func (f *stdoutFile) Close() error {
-	f.File = nil
 	return nil
 }
 
@@ -156,19 +144,17 @@ func (dump *MongoDump) NewIntent(dbName, colName string, stdout bool) (*intents.
 		BSONPath: dump.outputPath(dbName, colName) + ".bson",
 	}
 
-	// add stdout flags if we're using stdout
-	if dump.useStdout {
-		intent.BSONFile = &stdoutFile{intent: intent}
-		intent.MetadataFile = &stdoutFile{intent: intent}
-	}
-
-	if dump.OutputOptions.Archive != "" {
+	// collections written to stdout have no metadata file
+	switch {
+	case dump.useStdout:
+		intent.BSONFile = &stdoutFile{Writer: dump.OutputWriter, intent: intent}
+	case dump.OutputOptions.Archive != "":
 		intent.BSONFile = &archive.MuxIn{Intent: intent, Mux: dump.archive.Mux}
-	} else {
-		intent.BSONFile = &realBSONFile{intent: intent}
+	default:
+		intent.BSONFile = &realBSONFile{intent: intent, target: dump.Target}
 	}
 
-	if !intent.IsSystemIndexes() {
+	if !intent.IsSystemIndexes() && !dump.useStdout {
 		intent.MetadataPath = dump.outputPath(dbName, colName+".metadata.json")
 		if dump.OutputOptions.Archive != "" {
 			intent.MetadataFile = &archive.MetadataFile{
@@ -176,7 +162,7 @@ func (dump *MongoDump) NewIntent(dbName, colName string, stdout bool) (*intents.
 				Buffer: &bytes.Buffer{},
 			}
 		} else {
-			intent.MetadataFile = &realMetadataFile{intent: intent}
+			intent.MetadataFile = &realMetadataFile{intent: intent, target: dump.Target}
 		}
 	}
 
@@ -192,6 +178,7 @@ func (dump *MongoDump) NewIntent(dbName, colName string, stdout bool) (*intents.
 		return nil, fmt.Errorf("error counting %v: %v", intent.Namespace(), err)
 	}
 	intent.Size = int64(count)
+	dump.stats.recordPreDumpCount(intent, intent.Size)
 
 	return intent, nil
 }
@@ -212,7 +199,7 @@ func (dump *MongoDump) CreateOplogIntents() error {
 	if dump.OutputOptions.Archive != "" {
 		oplogIntent.BSONFile = &archive.MuxIn{Mux: dump.archive.Mux, Intent: oplogIntent}
 	} else {
-		oplogIntent.BSONFile = &realBSONFile{intent: oplogIntent}
+		oplogIntent.BSONFile = &realBSONFile{intent: oplogIntent, target: dump.Target}
 	}
 	dump.manager.Put(oplogIntent)
 	return nil
@@ -222,20 +209,31 @@ func (dump *MongoDump) CreateOplogIntents() error {
 // collection folder, for the users, roles and version admin database collections
 // And then it adds the intents in to the manager
 func (dump *MongoDump) CreateUsersRolesVersionIntentsForDB(db string) error {
+	usersIntent, rolesIntent, versionIntent := dump.newUsersRolesVersionIntents(db)
+	dump.manager.Put(usersIntent)
+	dump.manager.Put(rolesIntent)
+	dump.manager.Put(versionIntent)
+
+	return nil
+}
+
+// newUsersRolesVersionIntents creates intents for the users, roles and version
+// admin database collections, to be written in to the given database's folder.
+func (dump *MongoDump) newUsersRolesVersionIntents(db string) (usersIntent, rolesIntent, versionIntent *intents.Intent) {
 
 	outDir := dump.outputPath(db, "")
 
-	usersIntent := &intents.Intent{
+	usersIntent = &intents.Intent{
 		DB:       "admin",
 		C:        "system.users",
 		BSONPath: filepath.Join(outDir, "$admin.system.users.bson"),
 	}
-	rolesIntent := &intents.Intent{
+	rolesIntent = &intents.Intent{
 		DB:       "admin",
 		C:        "system.roles",
 		BSONPath: filepath.Join(outDir, "$admin.system.roles.bson"),
 	}
-	versionIntent := &intents.Intent{
+	versionIntent = &intents.Intent{
 		DB:       "admin",
 		C:        "system.version",
 		BSONPath: filepath.Join(outDir, "$admin.system.version.bson"),
@@ -245,15 +243,11 @@ func (dump *MongoDump) CreateUsersRolesVersionIntentsForDB(db string) error {
 		rolesIntent.BSONFile = &archive.MuxIn{Intent: rolesIntent, Mux: dump.archive.Mux}
 		versionIntent.BSONFile = &archive.MuxIn{Intent: versionIntent, Mux: dump.archive.Mux}
 	} else {
-		usersIntent.BSONFile = &realBSONFile{intent: usersIntent}
-		rolesIntent.BSONFile = &realBSONFile{intent: rolesIntent}
-		versionIntent.BSONFile = &realBSONFile{intent: versionIntent}
+		usersIntent.BSONFile = &realBSONFile{intent: usersIntent, target: dump.Target}
+		rolesIntent.BSONFile = &realBSONFile{intent: rolesIntent, target: dump.Target}
+		versionIntent.BSONFile = &realBSONFile{intent: versionIntent, target: dump.Target}
 	}
-	dump.manager.Put(usersIntent)
-	dump.manager.Put(rolesIntent)
-	dump.manager.Put(versionIntent)
-
-	return nil
+	return usersIntent, rolesIntent, versionIntent
 }
 
 // CreateCollectionIntent builds an intent for a given collection and
@@ -0,0 +1,139 @@
+package mongodump
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// sshTunnelTimeout is how long to wait for the ssh client to open the
+// forwarded port before giving up.
+const sshTunnelTimeout = 30 * time.Second
+
+// SSHOptions defines the set of options for reaching the server through an
+// SSH tunnel.
+type SSHOptions struct {
+	SSHHost    string `long:"sshHost" description:"connect through an SSH tunnel to this host, as host or host:port; the server is then reached from the SSH host using --host or --targetHost"`
+	SSHUser    string `long:"sshUser" description:"user name on the SSH host (defaults to the ssh client's configuration)"`
+	SSHKeyFile string `long:"sshKeyFile" description:"private key file for the SSH host; keys from ssh-agent and the ssh client's configuration are also used"`
+}
+
+// Name returns a human-readable group name for SSH options.
+func (_ *SSHOptions) Name() string {
+	return "ssh tunnel"
+}
+
+// sshTunnel is a local port forwarded to the server by the system's ssh
+// client. Host keys are checked against the user's known_hosts as usual, and
+// ssh runs in batch mode, so only key-based authentication is possible.
+type sshTunnel struct {
+	localAddr string
+	cmd       *exec.Cmd
+	stderr    bytes.Buffer
+	exited    chan error
+}
+
+// tunnelRemoteAddr returns the single server address to forward to, as seen
+// from the SSH host.
+func tunnelRemoteAddr(connection *options.Connection) (string, error) {
+	host := connection.Host
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[i+1:]
+	}
+	if strings.Contains(host, ",") {
+		return "", fmt.Errorf("--sshHost can only tunnel to a single server; " +
+			"use --targetHost to pick a replica set member")
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	if !strings.Contains(host, ":") {
+		port := connection.Port
+		if port == "" {
+			port = "27017"
+		}
+		host = host + ":" + port
+	}
+	return host, nil
+}
+
+// sshTunnelArgs returns the arguments to the ssh client that forward
+// localAddr to remoteAddr through the SSH host.
+func sshTunnelArgs(opts *SSHOptions, localAddr, remoteAddr string) []string {
+	args := []string{"-N",
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+		"-L", localAddr + ":" + remoteAddr,
+	}
+	sshHost := opts.SSHHost
+	if host, port, err := net.SplitHostPort(sshHost); err == nil {
+		sshHost = host
+		args = append(args, "-p", port)
+	}
+	if opts.SSHUser != "" {
+		args = append(args, "-l", opts.SSHUser)
+	}
+	if opts.SSHKeyFile != "" {
+		args = append(args, "-i", opts.SSHKeyFile, "-o", "IdentitiesOnly=yes")
+	}
+	return append(args, sshHost)
+}
+
+// startSSHTunnel starts the ssh client forwarding a free local port to the
+// remote address, and waits until the port accepts connections.
+func startSSHTunnel(opts *SSHOptions, remoteAddr string) (*sshTunnel, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error finding a free local port for the SSH tunnel: %v", err)
+	}
+	localAddr := listener.Addr().String()
+	listener.Close()
+
+	tunnel := &sshTunnel{localAddr: localAddr, exited: make(chan error, 1)}
+	tunnel.cmd = exec.Command("ssh", sshTunnelArgs(opts, localAddr, remoteAddr)...)
+	tunnel.cmd.Stderr = &tunnel.stderr
+	tunnel.cmd.SysProcAttr = sshSysProcAttr()
+	log.Logf(log.DebugLow, "starting ssh %v", strings.Join(tunnel.cmd.Args[1:], " "))
+	if err = tunnel.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting ssh: %v", err)
+	}
+	go func() {
+		tunnel.exited <- tunnel.cmd.Wait()
+	}()
+
+	deadline := time.Now().Add(sshTunnelTimeout)
+	for {
+		select {
+		case err = <-tunnel.exited:
+			return nil, fmt.Errorf("ssh to %v exited before the tunnel opened: %v: %v",
+				opts.SSHHost, err, strings.TrimSpace(tunnel.stderr.String()))
+		default:
+		}
+		conn, err := net.DialTimeout("tcp", localAddr, time.Second)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			tunnel.Close()
+			return nil, fmt.Errorf("timed out waiting for the SSH tunnel through %v", opts.SSHHost)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Logf(log.Always, "tunneling to %v through %v", remoteAddr, opts.SSHHost)
+	return tunnel, nil
+}
+
+// Close stops the ssh client.
+func (tunnel *sshTunnel) Close() {
+	if tunnel.cmd.Process != nil {
+		tunnel.cmd.Process.Kill()
+		<-tunnel.exited
+	}
+}
@@ -0,0 +1,11 @@
+package mongodump
+
+import (
+	"syscall"
+)
+
+// sshSysProcAttr has the ssh client killed if mongodump exits without
+// closing the tunnel.
+func sshSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package mongodump
+
+import (
+	"syscall"
+)
+
+// sshSysProcAttr returns nil; the ssh client is only stopped when the tunnel
+// is closed.
+func sshSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,227 @@
+package mongodump
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// collectionStats describes how dumping a single collection went.
+type collectionStats struct {
+	Namespace string  `json:"ns"`
+	Documents int64   `json:"documents"`
+	Bytes     int64   `json:"bytes"`
+	Seconds   float64 `json:"seconds"`
+	Error     string  `json:"error,omitempty"`
+
+	// PreDumpCount is the collection's document count when the dump was
+	// planned, and CountChanged is set when Documents differs from it by
+	// more than the --countChangeThreshold
+	PreDumpCount *int64 `json:"preDumpCount,omitempty"`
+	CountChanged bool   `json:"countChanged,omitempty"`
+}
+
+// dumpStats is the summary of a whole mongodump run, written to --statsFile.
+type dumpStats struct {
+	Start       time.Time `json:"start"`
+	Seconds     float64   `json:"seconds"`
+	Documents   int64     `json:"documents"`
+	Bytes       int64     `json:"bytes"`
+	BytesPerSec float64   `json:"bytesPerSec"`
+	Failures    int       `json:"failures"`
+
+	// Error is the error the dump stopped with, if it failed
+	Error string `json:"error,omitempty"`
+
+	// CountChanges is the number of collections whose count changed
+	// noticeably during the dump
+	CountChanges int               `json:"countChanges"`
+	Collections  []collectionStats `json:"collections"`
+
+	// Unsupported lists what the dump couldn't capture, such as index
+	// builds in progress or time-series buckets
+	Unsupported []unsupportedFeature `json:"unsupported,omitempty"`
+}
+
+// statsCollector gathers per-collection statistics from concurrent dump
+// routines.
+type statsCollector struct {
+	sync.Mutex
+	start       time.Time
+	collections []collectionStats
+
+	// preDumpCounts holds the document count of each collection, by
+	// namespace, from when its intent was created
+	preDumpCounts map[string]int64
+
+	// features found that the dump couldn't capture
+	unsupported []unsupportedFeature
+}
+
+// recordPreDumpCount saves the collection's document count before it is
+// dumped.
+func (collector *statsCollector) recordPreDumpCount(intent *intents.Intent, count int64) {
+	collector.Lock()
+	defer collector.Unlock()
+	if collector.preDumpCounts == nil {
+		collector.preDumpCounts = map[string]int64{}
+	}
+	collector.preDumpCounts[intent.Namespace()] = count
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	io.Writer
+	bytes int64
+}
+
+// Write is part of the io.Writer interface.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.Writer.Write(p)
+	cw.bytes += int64(n)
+	return n, err
+}
+
+// recordStats adds the statistics for one dumped collection.
+func (dump *MongoDump) recordStats(intent *intents.Intent, documents, bytes int64,
+	duration time.Duration, err error) {
+	stats := collectionStats{
+		Namespace: intent.Namespace(),
+		Documents: documents,
+		Bytes:     bytes,
+		Seconds:   duration.Seconds(),
+	}
+	if err != nil {
+		stats.Error = err.Error()
+	}
+	dump.stats.Lock()
+	defer dump.stats.Unlock()
+	// counts are only comparable when the whole collection was dumped
+	if count, ok := dump.stats.preDumpCounts[stats.Namespace]; ok && err == nil &&
+		!dump.OutputOptions.Repair && len(dump.queryForIntent(intent)) == 0 {
+		stats.PreDumpCount = &count
+		if countChanged(count, documents, dump.OutputOptions.CountChangeThreshold) {
+			stats.CountChanged = true
+			log.Logf(log.Always, "warning: %v had %v documents before the dump but %v were dumped; "+
+				"it changed during the dump, which may not be a consistent snapshot of it",
+				stats.Namespace, count, documents)
+		}
+	}
+	dump.stats.collections = append(dump.stats.collections, stats)
+}
+
+// countChanged returns true if the number of documents dumped differs from
+// the count before the dump by more than threshold percent. A threshold of
+// zero or less never reports a change.
+func countChanged(before, dumped int64, threshold float64) bool {
+	if threshold <= 0 || before == dumped {
+		return false
+	}
+	if before == 0 {
+		return true
+	}
+	difference := math.Abs(float64(dumped - before))
+	return difference*100/float64(before) > threshold
+}
+
+// summarizeStats totals the recorded statistics, with collections listed
+// in namespace order.
+func (dump *MongoDump) summarizeStats() dumpStats {
+	dump.stats.Lock()
+	defer dump.stats.Unlock()
+	summary := dumpStats{
+		Start:       dump.stats.start,
+		Seconds:     time.Since(dump.stats.start).Seconds(),
+		Collections: append([]collectionStats{}, dump.stats.collections...),
+		Unsupported: append([]unsupportedFeature{}, dump.stats.unsupported...),
+	}
+	sort.Sort(byNamespace(summary.Collections))
+	for _, stats := range summary.Collections {
+		summary.Documents += stats.Documents
+		summary.Bytes += stats.Bytes
+		if stats.Error != "" {
+			summary.Failures++
+		}
+		if stats.CountChanged {
+			summary.CountChanges++
+		}
+	}
+	if summary.Seconds > 0 {
+		summary.BytesPerSec = float64(summary.Bytes) / summary.Seconds
+	}
+	return summary
+}
+
+// reportStats logs a summary of the dump, which failed with dumpErr if it
+// isn't nil, and writes it as JSON to the --statsFile, if one was given.
+func (dump *MongoDump) reportStats(dumpErr error) error {
+	summary := dump.summarizeStats()
+	if dumpErr != nil {
+		summary.Error = dumpErr.Error()
+	}
+
+	out := &text.GridWriter{ColumnPadding: 2}
+	out.WriteCells("ns", "documents", "size", "duration", "rate")
+	out.EndRow()
+	for _, stats := range summary.Collections {
+		out.WriteCells(stats.Namespace, fmt.Sprint(stats.Documents),
+			text.FormatByteAmount(stats.Bytes), formatSeconds(stats.Seconds),
+			formatRate(stats.Bytes, stats.Seconds))
+		if stats.Error != "" {
+			out.WriteCell("failed")
+		} else if stats.CountChanged {
+			out.WriteCell(fmt.Sprintf("changed during dump (%v before)", *stats.PreDumpCount))
+		}
+		out.EndRow()
+	}
+	out.WriteCells("total", fmt.Sprint(summary.Documents),
+		text.FormatByteAmount(summary.Bytes), formatSeconds(summary.Seconds),
+		formatRate(summary.Bytes, summary.Seconds))
+	out.EndRow()
+	out.FlushRows(log.Writer(log.Always))
+	if summary.CountChanges > 0 {
+		log.Logf(log.Always, "warning: %v collection(s) changed noticeably during the dump", summary.CountChanges)
+	}
+	if len(summary.Unsupported) > 0 {
+		log.Logf(log.Always, "warning: the dump could not capture %v feature(s) of the dumped collections; "+
+			"restoring it will not reproduce them, see the warnings above", len(summary.Unsupported))
+	}
+
+	if dump.OutputOptions.StatsFile == "" {
+		return nil
+	}
+	statsJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding dump statistics: %v", err)
+	}
+	if err = ioutil.WriteFile(dump.OutputOptions.StatsFile, append(statsJSON, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing --statsFile: %v", err)
+	}
+	return nil
+}
+
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds*float64(time.Second)) / time.Millisecond * time.Millisecond).String()
+}
+
+func formatRate(bytes int64, seconds float64) string {
+	if seconds <= 0 {
+		return "-"
+	}
+	return text.FormatByteAmount(int64(float64(bytes)/seconds)) + "/s"
+}
+
+// byNamespace sorts collection statistics by namespace.
+type byNamespace []collectionStats
+
+func (s byNamespace) Len() int           { return len(s) }
+func (s byNamespace) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byNamespace) Less(i, j int) bool { return s[i].Namespace < s[j].Namespace }
@@ -0,0 +1,35 @@
+package mongodump
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// OutputTarget creates the files a dump is written to: the .bson and
+// .metadata.json files of each collection, the dump info, and the archive
+// file when dumping to an archive. Paths are those the files would have on
+// disk, rooted at --out. Each call to Write of a .bson file holds one or
+// more whole BSON documents, never part of one.
+//
+// The default target writes to the local filesystem; programs using
+// mongodump as a library can supply their own, for example to upload the
+// dump to object storage as it is written.
+type OutputTarget interface {
+	Create(path string) (io.WriteCloser, error)
+}
+
+// fileTarget is the OutputTarget for the local filesystem. Files are split
+// into numbered volumes once they reach maxSize bytes, if it is non-zero.
+type fileTarget struct {
+	maxSize int64
+}
+
+// Create is part of the OutputTarget interface.
+func (target *fileTarget) Create(path string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating directory for %v: %v", path, err)
+	}
+	return newVolumeWriter(path, target.maxSize, true)
+}
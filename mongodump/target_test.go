@@ -0,0 +1,77 @@
+package mongodump
+
+import (
+	"bytes"
+	"context"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"testing"
+)
+
+// memoryTarget is an OutputTarget that keeps each file in memory.
+type memoryTarget map[string]*bytes.Buffer
+
+func (target memoryTarget) Create(path string) (io.WriteCloser, error) {
+	target[path] = &bytes.Buffer{}
+	return &nopCloseWriter{target[path]}, nil
+}
+
+func TestOutputTargets(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an intent for a collection", t, func() {
+		intent := &intents.Intent{
+			DB:           "db",
+			C:            "coll",
+			BSONPath:     "dump/db/coll.bson",
+			MetadataPath: "dump/db/coll.metadata.json",
+		}
+
+		Convey("BSON and metadata files should be created by the output target", func() {
+			target := memoryTarget{}
+			intent.BSONFile = &realBSONFile{intent: intent, target: target}
+			intent.MetadataFile = &realMetadataFile{intent: intent, target: target}
+			for _, file := range []interface {
+				io.WriteCloser
+				Open() error
+			}{intent.BSONFile, intent.MetadataFile} {
+				So(file.Open(), ShouldBeNil)
+				_, err := file.Write([]byte("data"))
+				So(err, ShouldBeNil)
+				So(file.Close(), ShouldBeNil)
+			}
+			So(target["dump/db/coll.bson"].String(), ShouldEqual, "data")
+			So(target["dump/db/coll.metadata.json"].String(), ShouldEqual, "data")
+		})
+
+		Convey("stdout files should write to the output writer", func() {
+			out := &bytes.Buffer{}
+			intent.BSONFile = &stdoutFile{Writer: out, intent: intent}
+			So(intent.BSONFile.Open(), ShouldBeNil)
+			_, err := intent.BSONFile.Write([]byte("data"))
+			So(err, ShouldBeNil)
+			So(intent.BSONFile.Close(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "data")
+		})
+
+		Convey("a cancelled dump should not start dumping any intents", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			dump := &MongoDump{
+				OutputOptions: &OutputOptions{ContinueOnError: true},
+				manager:       intents.NewIntentManager(),
+				ctx:           ctx,
+			}
+			dump.manager.Put(intent)
+			So(dump.DumpIntents(), ShouldEqual, context.Canceled)
+		})
+
+		Convey("a dump without a context should never be cancelled", func() {
+			dump := &MongoDump{}
+			So(dump.context().Err(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package mongodump
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Features of the source deployment that a logical dump can't fully
+// capture.
+const (
+	featureIndexBuild          = "inProgressIndexBuild"
+	featureQueryableEncryption = "queryableEncryption"
+	featureTimeSeries          = "timeSeries"
+)
+
+// unsupportedFeature is something found in a dumped namespace that a
+// logical dump can't represent, so restoring the dump won't reproduce it.
+type unsupportedFeature struct {
+	Namespace string `json:"ns"`
+	Feature   string `json:"feature"`
+	Warning   string `json:"warning"`
+}
+
+// collectionUnsupportedFeatures returns what a logical dump can't capture
+// about a collection, judging from its name and options.
+func collectionUnsupportedFeatures(namespace, colName string, options *bson.D) []unsupportedFeature {
+	features := []unsupportedFeature{}
+	if strings.HasPrefix(colName, "system.buckets.") {
+		features = append(features, unsupportedFeature{namespace, featureTimeSeries,
+			"time-series bucket collection: its internal buckets are dumped as plain documents and " +
+				"restore as a regular collection; restore the measurements through the time-series " +
+				"collection " + strings.TrimPrefix(colName, "system.buckets.") + " instead"})
+	}
+	if strings.HasPrefix(colName, "enxcol_.") {
+		features = append(features, unsupportedFeature{namespace, featureQueryableEncryption,
+			"queryable encryption state collection: its contents are tied to the encrypted " +
+				"collection's server-side state and are only consistent with it if both are restored " +
+				"together with the same key vault"})
+	}
+	if options == nil {
+		return features
+	}
+	if value, err := bsonutil.FindValueByKey("timeseries", options); err == nil && value != nil {
+		features = append(features, unsupportedFeature{namespace, featureTimeSeries,
+			"time-series collection: measurements are dumped through the collection, not as their " +
+				"buckets, so the restored collection is rebucketed and its bucket layout is not preserved"})
+	}
+	if value, err := bsonutil.FindValueByKey("encryptedFields", options); err == nil && value != nil {
+		features = append(features, unsupportedFeature{namespace, featureQueryableEncryption,
+			"queryable encryption collection: encrypted fields are dumped as ciphertext and can only " +
+				"be queried after a restore that also restores its enxcol_ state collections and key vault"})
+	}
+	return features
+}
+
+// inProgressIndexBuilds returns the names of the indexes being built when
+// the dump started, by namespace. Their builds aren't listed by listIndexes,
+// so the dumped metadata doesn't include them.
+func (dump *MongoDump) inProgressIndexBuilds() (map[string][]string, error) {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	result := struct {
+		InProg []struct {
+			NS      string `bson:"ns"`
+			Command struct {
+				CreateIndexes string `bson:"createIndexes"`
+				Indexes       []struct {
+					Name string `bson:"name"`
+				} `bson:"indexes"`
+			} `bson:"command"`
+		} `bson:"inprog"`
+	}{}
+	command := bson.D{{"currentOp", 1}, {"command.createIndexes", bson.M{"$exists": true}}}
+	if err = session.DB("admin").Run(command, &result); err != nil {
+		return nil, err
+	}
+	builds := map[string][]string{}
+	for _, op := range result.InProg {
+		dbName := strings.SplitN(op.NS, ".", 2)[0]
+		namespace := dbName + "." + op.Command.CreateIndexes
+		for _, index := range op.Command.Indexes {
+			builds[namespace] = append(builds[namespace], index.Name)
+		}
+	}
+	return builds, nil
+}
+
+// recordUnsupported warns about a feature the dump couldn't capture, and
+// adds it to the statistics.
+func (dump *MongoDump) recordUnsupported(feature unsupportedFeature) {
+	log.Logf(log.Always, "warning: %v: %v", feature.Namespace, feature.Warning)
+	dump.stats.Lock()
+	defer dump.stats.Unlock()
+	dump.stats.unsupported = append(dump.stats.unsupported, feature)
+}
+
+// checkUnsupportedFeatures warns about everything the dump of the intent's
+// collection won't capture. The intent's options must already be read.
+func (dump *MongoDump) checkUnsupportedFeatures(intent *intents.Intent, indexBuilds map[string][]string) {
+	for _, feature := range collectionUnsupportedFeatures(intent.Namespace(), intent.C, intent.Options) {
+		dump.recordUnsupported(feature)
+	}
+	if names := indexBuilds[intent.Namespace()]; len(names) > 0 {
+		dump.recordUnsupported(unsupportedFeature{intent.Namespace(), featureIndexBuild,
+			fmt.Sprintf("index build(s) in progress for %v are not in the dumped metadata; "+
+				"recreate them after restoring", strings.Join(names, ", "))})
+	}
+}
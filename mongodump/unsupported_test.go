@@ -0,0 +1,44 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestCollectionUnsupportedFeatures(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When checking collections for features a dump can't capture", t, func() {
+		Convey("a regular collection should have none", func() {
+			options := &bson.D{{"capped", true}, {"size", 4096}}
+			So(collectionUnsupportedFeatures("db.c", "c", options), ShouldBeEmpty)
+			So(collectionUnsupportedFeatures("db.c", "c", nil), ShouldBeEmpty)
+		})
+
+		Convey("time-series collections and their buckets should be reported", func() {
+			options := &bson.D{{"timeseries", bson.D{{"timeField", "ts"}}}}
+			features := collectionUnsupportedFeatures("db.weather", "weather", options)
+			So(len(features), ShouldEqual, 1)
+			So(features[0].Feature, ShouldEqual, featureTimeSeries)
+
+			features = collectionUnsupportedFeatures("db.system.buckets.weather", "system.buckets.weather", nil)
+			So(len(features), ShouldEqual, 1)
+			So(features[0].Feature, ShouldEqual, featureTimeSeries)
+			So(features[0].Warning, ShouldContainSubstring, "weather")
+		})
+
+		Convey("queryable encryption collections and their state collections should be reported", func() {
+			options := &bson.D{{"encryptedFields", bson.D{{"fields", []interface{}{}}}}}
+			features := collectionUnsupportedFeatures("db.patients", "patients", options)
+			So(len(features), ShouldEqual, 1)
+			So(features[0].Feature, ShouldEqual, featureQueryableEncryption)
+
+			features = collectionUnsupportedFeatures("db.enxcol_.patients.esc", "enxcol_.patients.esc", nil)
+			So(len(features), ShouldEqual, 1)
+			So(features[0].Namespace, ShouldEqual, "db.enxcol_.patients.esc")
+		})
+	})
+}
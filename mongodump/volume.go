@@ -0,0 +1,139 @@
+package mongodump
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/log"
+	"os"
+)
+
+// volumeWriter is an io.WriteCloser that writes to a file on disk, rolling
+// over into sequentially numbered volumes (path, path.001, path.002, ...)
+// once the current volume reaches maxSize bytes. Concatenating the volumes
+// in order reproduces the unsplit output.
+type volumeWriter struct {
+	path    string
+	maxSize int64
+
+	// wholeWrites never splits a BSON document across volumes, for callers
+	// writing whole documents: a write that doesn't fit in the current
+	// volume is split between documents, and a write that isn't made of
+	// documents is kept whole. A single document larger than maxSize gets a
+	// volume of its own.
+	wholeWrites bool
+
+	volume  int
+	written int64
+	file    *os.File
+	buf     *bufio.Writer
+}
+
+// newVolumeWriter creates the first volume at path and returns a volumeWriter
+// for it. A maxSize of zero disables splitting.
+func newVolumeWriter(path string, maxSize int64, wholeWrites bool) (*volumeWriter, error) {
+	vw := &volumeWriter{
+		path:        path,
+		maxSize:     maxSize,
+		wholeWrites: wholeWrites,
+	}
+	if err := vw.openVolume(); err != nil {
+		return nil, err
+	}
+	return vw, nil
+}
+
+// volumePath returns the path of the current volume. The first volume
+// keeps the unadorned path.
+func (vw *volumeWriter) volumePath() string {
+	return archive.VolumePath(vw.path, vw.volume)
+}
+
+func (vw *volumeWriter) openVolume() (err error) {
+	vw.file, err = os.Create(vw.volumePath())
+	if err != nil {
+		return fmt.Errorf("error creating file %v: %v", vw.volumePath(), err)
+	}
+	// wrap writer in buffer to reduce load on disk
+	vw.buf = bufio.NewWriterSize(vw.file, 32*1024)
+	vw.written = 0
+	return nil
+}
+
+func (vw *volumeWriter) closeVolume() error {
+	if err := vw.buf.Flush(); err != nil {
+		return err
+	}
+	return vw.file.Close()
+}
+
+// roll closes the current volume and starts the next one.
+func (vw *volumeWriter) roll() error {
+	if err := vw.closeVolume(); err != nil {
+		return err
+	}
+	vw.volume++
+	log.Logf(log.Info, "%v reached %v bytes, continuing in %v",
+		vw.path, vw.written, vw.volumePath())
+	return vw.openVolume()
+}
+
+// Write is part of the io.Writer interface.
+func (vw *volumeWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if vw.maxSize > 0 {
+			room := vw.maxSize - vw.written
+			switch {
+			case room <= 0:
+				if err = vw.roll(); err != nil {
+					return n, err
+				}
+				continue
+			case int64(len(p)) > room && vw.wholeWrites:
+				fit := wholeDocuments(p, room)
+				switch {
+				case fit > 0:
+					chunk = p[:fit]
+				case vw.written > 0:
+					if err = vw.roll(); err != nil {
+						return n, err
+					}
+					continue
+				default:
+					chunk = p[:documentSize(p)]
+				}
+			case int64(len(p)) > room && !vw.wholeWrites:
+				chunk = p[:room]
+			}
+		}
+		written, err := vw.buf.Write(chunk)
+		n += written
+		vw.written += int64(written)
+		if err != nil {
+			return n, err
+		}
+		p = p[written:]
+	}
+	return n, nil
+}
+
+// Close is part of the io.Closer interface. It flushes and closes the
+// current volume.
+func (vw *volumeWriter) Close() error {
+	return vw.closeVolume()
+}
+
+// wholeDocuments returns the length of the documents at the start of p that
+// fit within room bytes.
+func wholeDocuments(p []byte, room int64) int {
+	fit := 0
+	for fit < len(p) {
+		size := documentSize(p[fit:])
+		if int64(fit+size) > room {
+			break
+		}
+		fit += size
+	}
+	return fit
+}
@@ -0,0 +1,102 @@
+package mongodump
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumeWriter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a temporary output directory", t, func() {
+		dir, err := ioutil.TempDir("", "mongodump_volume_test")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "coll.bson")
+
+		Convey("whole writes should never be split across volumes", func() {
+			vw, err := newVolumeWriter(path, 10, true)
+			So(err, ShouldBeNil)
+			for _, doc := range []string{"aaaa", "bbbb", "cccc", "dddddddddddd", "ee"} {
+				_, err = vw.Write([]byte(doc))
+				So(err, ShouldBeNil)
+			}
+			So(vw.Close(), ShouldBeNil)
+
+			for volume, expected := range map[string]string{
+				path:          "aaaabbbb",
+				path + ".001": "cccc",
+				path + ".002": "dddddddddddd",
+				path + ".003": "ee",
+			} {
+				contents, err := ioutil.ReadFile(volume)
+				So(err, ShouldBeNil)
+				So(string(contents), ShouldEqual, expected)
+			}
+		})
+
+		Convey("a batch of documents should be split between documents", func() {
+			docs := [][]byte{}
+			batch := []byte{}
+			for i := 0; i < 3; i++ {
+				doc, err := bson.Marshal(bson.M{"_id": i})
+				So(err, ShouldBeNil)
+				docs = append(docs, doc)
+				batch = append(batch, doc...)
+			}
+			vw, err := newVolumeWriter(path, int64(2*len(docs[0])+1), true)
+			So(err, ShouldBeNil)
+			n, err := vw.Write(batch)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, len(batch))
+			So(vw.Close(), ShouldBeNil)
+
+			for volume, expected := range map[string][]byte{
+				path:          batch[:2*len(docs[0])],
+				path + ".001": docs[2],
+			} {
+				contents, err := ioutil.ReadFile(volume)
+				So(err, ShouldBeNil)
+				So(contents, ShouldResemble, expected)
+			}
+		})
+
+		Convey("byte-level writes should fill each volume exactly", func() {
+			vw, err := newVolumeWriter(path, 4, false)
+			So(err, ShouldBeNil)
+			_, err = vw.Write([]byte("0123456789"))
+			So(err, ShouldBeNil)
+			So(vw.Close(), ShouldBeNil)
+
+			for volume, expected := range map[string]string{
+				path:          "0123",
+				path + ".001": "4567",
+				path + ".002": "89",
+			} {
+				contents, err := ioutil.ReadFile(volume)
+				So(err, ShouldBeNil)
+				So(string(contents), ShouldEqual, expected)
+			}
+		})
+
+		Convey("a zero max size should write a single file", func() {
+			vw, err := newVolumeWriter(path, 0, true)
+			So(err, ShouldBeNil)
+			_, err = vw.Write([]byte("0123456789"))
+			So(err, ShouldBeNil)
+			So(vw.Close(), ShouldBeNil)
+
+			_, err = os.Stat(path + ".001")
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+
+}
@@ -0,0 +1,117 @@
+package mongoexport
+
+import (
+	"io"
+	"sync"
+)
+
+// defaultBufferSize is the size of each of the output buffers without
+// --bufferSize.
+const defaultBufferSize = 1024 * 1024
+
+// asyncWriter is a double-buffered io.Writer: documents are serialized into
+// one buffer while the other, once full, is written out by its own
+// goroutine, so that a slow write to disk or stdout doesn't hold up reading
+// from the cursor.
+type asyncWriter struct {
+	out     io.Writer
+	size    int
+	current []byte
+
+	// full carries the buffers to write out to the writing goroutine, and
+	// free brings them back once written
+	full chan []byte
+	free chan []byte
+	done chan struct{}
+
+	errMutex sync.Mutex
+	err      error
+}
+
+// newAsyncWriter starts writing out to out from two buffers of the given
+// size. The asyncWriter must be closed to stop its goroutine.
+func newAsyncWriter(out io.Writer, size int) *asyncWriter {
+	w := &asyncWriter{
+		out:     out,
+		size:    size,
+		current: make([]byte, 0, size),
+		full:    make(chan []byte, 1),
+		free:    make(chan []byte, 1),
+		done:    make(chan struct{}),
+	}
+	w.free <- make([]byte, 0, size)
+	go w.writeBuffers()
+	return w
+}
+
+// writeBuffers writes out the full buffers until the asyncWriter is closed.
+// After an error, buffers are returned without being written.
+func (w *asyncWriter) writeBuffers() {
+	defer close(w.done)
+	for buff := range w.full {
+		if w.error() == nil {
+			if _, err := w.out.Write(buff); err != nil {
+				w.errMutex.Lock()
+				w.err = err
+				w.errMutex.Unlock()
+			}
+		}
+		w.free <- buff[:0]
+	}
+}
+
+// error returns the error the writing goroutine ran into, if any.
+func (w *asyncWriter) error() error {
+	w.errMutex.Lock()
+	defer w.errMutex.Unlock()
+	return w.err
+}
+
+// swap hands the current buffer to the writing goroutine and carries on
+// with the other one, once it has been written out.
+func (w *asyncWriter) swap() {
+	w.full <- w.current
+	w.current = <-w.free
+}
+
+// Write is part of the io.Writer interface. It returns the error of an
+// earlier write to the underlying writer, if there was one.
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	if err := w.error(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		room := w.size - len(w.current)
+		if room == 0 {
+			w.swap()
+			continue
+		}
+		if room > len(p) {
+			room = len(p)
+		}
+		w.current = append(w.current, p[:room]...)
+		p = p[room:]
+	}
+	return n, nil
+}
+
+// Flush writes out the buffered data and waits until it is written.
+func (w *asyncWriter) Flush() error {
+	if len(w.current) > 0 {
+		w.swap()
+	}
+	// the other buffer is free once it's written out
+	buff := <-w.free
+	w.free <- buff
+	return w.error()
+}
+
+// Close flushes the asyncWriter and stops its goroutine. It doesn't close
+// the underlying writer.
+func (w *asyncWriter) Close() error {
+	err := w.Flush()
+	close(w.full)
+	<-w.done
+	return err
+}
@@ -0,0 +1,56 @@
+package mongoexport
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestAsyncWriter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an asynchronous writer", t, func() {
+		out := &bytes.Buffer{}
+		w := newAsyncWriter(out, 4)
+
+		Convey("writes should be buffered until a buffer fills up or it's flushed", func() {
+			_, err := w.Write([]byte("ab"))
+			So(err, ShouldBeNil)
+			So(w.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "ab")
+
+			n, err := w.Write([]byte("cdefghijklm"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 11)
+			So(w.Close(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "abcdefghijklm")
+		})
+
+		Convey("closing it should write out what's buffered", func() {
+			_, err := w.Write([]byte("xyz"))
+			So(err, ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "xyz")
+		})
+	})
+
+	Convey("A write error should be returned by later writes and the flush", t, func() {
+		w := newAsyncWriter(failingWriter{}, 4)
+		_, err := w.Write([]byte("abcdefgh"))
+		So(err, ShouldBeNil)
+		So(w.Flush(), ShouldNotBeNil)
+		_, err = w.Write([]byte("ij"))
+		So(err, ShouldNotBeNil)
+		So(w.Close(), ShouldNotBeNil)
+	})
+}
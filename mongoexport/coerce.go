@@ -0,0 +1,200 @@
+package mongoexport
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types that --coerce can convert field values to.
+const (
+	CoerceString       = "string"
+	CoerceNumber       = "number"
+	CoerceEpochMillis  = "epochMillis"
+	CoerceEpochSeconds = "epochSeconds"
+)
+
+// coercion converts the values of a field to a plain scalar type.
+type coercion struct {
+	field  string
+	path   []string
+	target string
+}
+
+// parseCoercions parses the --coerce option, given as comma-separated
+// field=type pairs.
+func parseCoercions(rules string) ([]coercion, error) {
+	var coercions []coercion
+	seen := map[string]bool{}
+	for _, rule := range strings.Split(rules, ",") {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid coercion '%v', expected field=type", rule)
+		}
+		field, target := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if field == "" {
+			return nil, fmt.Errorf("invalid coercion '%v', expected field=type", rule)
+		}
+		switch target {
+		case CoerceString, CoerceNumber, CoerceEpochMillis, CoerceEpochSeconds:
+		default:
+			return nil, fmt.Errorf("invalid coercion type '%v' for field '%v', choose '%v', '%v', '%v' or '%v'",
+				target, field, CoerceString, CoerceNumber, CoerceEpochMillis, CoerceEpochSeconds)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("field '%v' is coerced more than once", field)
+		}
+		seen[field] = true
+		coercions = append(coercions, coercion{field, strings.Split(field, "."), target})
+	}
+	return coercions, nil
+}
+
+// coerceDocument applies the coercions to the document in place. Fields that
+// are missing or null are left alone.
+func coerceDocument(document bson.M, coercions []coercion) error {
+	for _, c := range coercions {
+		if err := coerceField(document, c.path, c.target); err != nil {
+			return fmt.Errorf("error coercing field '%v': %v", c.field, err)
+		}
+	}
+	return nil
+}
+
+// coerceField coerces the value at the path within the given document or
+// array. A path into an array without an index applies to every element, so
+// 'items.price' coerces the price of each item.
+func coerceField(subdoc interface{}, path []string, target string) error {
+	switch doc := subdoc.(type) {
+	case bson.M:
+		value, ok := doc[path[0]]
+		if !ok {
+			return nil
+		}
+		if len(path) > 1 {
+			return coerceField(value, path[1:], target)
+		}
+		coerced, err := coerceValue(value, target)
+		if err != nil {
+			return err
+		}
+		doc[path[0]] = coerced
+	case []interface{}:
+		index, err := strconv.Atoi(path[0])
+		if err != nil {
+			for _, elem := range doc {
+				if err := coerceField(elem, path, target); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if index < 0 || index >= len(doc) {
+			return nil
+		}
+		if len(path) > 1 {
+			return coerceField(doc[index], path[1:], target)
+		}
+		coerced, err := coerceValue(doc[index], target)
+		if err != nil {
+			return err
+		}
+		doc[index] = coerced
+	}
+	return nil
+}
+
+// coerceValue converts a single value to the target type. Numbers are
+// returned as json.Number so they are written as plain JSON numbers rather
+// than as extended JSON.
+func coerceValue(value interface{}, target string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if array, ok := value.([]interface{}); ok {
+		coerced := make([]interface{}, len(array))
+		for i, elem := range array {
+			var err error
+			if coerced[i], err = coerceValue(elem, target); err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	}
+
+	switch target {
+	case CoerceString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case bson.ObjectId:
+			return v.Hex(), nil
+		case time.Time:
+			return v.UTC().Format("2006-01-02T15:04:05.000Z"), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case int:
+			return strconv.Itoa(v), nil
+		case int32:
+			return strconv.FormatInt(int64(v), 10), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case []byte:
+			return base64.StdEncoding.EncodeToString(v), nil
+		case bson.Binary:
+			return base64.StdEncoding.EncodeToString(v.Data), nil
+		case bson.RegEx:
+			return "/" + v.Pattern + "/" + v.Options, nil
+		case bson.Symbol:
+			return string(v), nil
+		}
+	case CoerceNumber:
+		switch v := value.(type) {
+		case int:
+			return json.Number(strconv.Itoa(v)), nil
+		case int32:
+			return json.Number(strconv.FormatInt(int64(v), 10)), nil
+		case int64:
+			return json.Number(strconv.FormatInt(v, 10)), nil
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("%v is not a finite number", v)
+			}
+			return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+		case string:
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("'%v' is not a number", v)
+			}
+			return json.Number(v), nil
+		case bool:
+			if v {
+				return json.Number("1"), nil
+			}
+			return json.Number("0"), nil
+		}
+	case CoerceEpochMillis, CoerceEpochSeconds:
+		var t time.Time
+		switch v := value.(type) {
+		case time.Time:
+			t = v
+		case bson.ObjectId:
+			t = v.Time()
+		case bson.MongoTimestamp:
+			t = time.Unix(int64(v)>>32, 0)
+		default:
+			return nil, fmt.Errorf("can't coerce a value of type %T to %v", value, target)
+		}
+		if target == CoerceEpochSeconds {
+			return json.Number(strconv.FormatInt(t.Unix(), 10)), nil
+		}
+		return json.Number(strconv.FormatInt(t.Unix()*1000+int64(t.Nanosecond()/1e6), 10)), nil
+	}
+	return nil, fmt.Errorf("can't coerce a value of type %T to %v", value, target)
+}
@@ -0,0 +1,71 @@
+package mongoexport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestCoerce(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With coercions for several fields", t, func() {
+		coercions, err := parseCoercions("_id=string, created=epochMillis,items.price=string,total=number,missing=number")
+		So(err, ShouldBeNil)
+		So(len(coercions), ShouldEqual, 5)
+
+		id := bson.ObjectIdHex("5571fb6e8b1a8e8f4a3c1d2e")
+		document := bson.M{
+			"_id":     id,
+			"created": time.Date(2015, 6, 1, 12, 30, 0, 5e6, time.UTC),
+			"items": []interface{}{
+				bson.M{"price": 9.99},
+				bson.M{"price": int64(12)},
+				bson.M{"name": "no price"},
+			},
+			"total": int64(1 << 40),
+		}
+
+		Convey("values should become plain scalars", func() {
+			So(coerceDocument(document, coercions), ShouldBeNil)
+			So(document["_id"], ShouldEqual, id.Hex())
+			So(document["created"], ShouldEqual, json.Number("1433161800005"))
+			So(document["items"], ShouldResemble, []interface{}{
+				bson.M{"price": "9.99"},
+				bson.M{"price": "12"},
+				bson.M{"name": "no price"},
+			})
+			So(document["total"], ShouldEqual, json.Number("1099511627776"))
+			_, ok := document["missing"]
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("coerced numbers should be written without extended JSON", func() {
+			So(coerceDocument(document, coercions), ShouldBeNil)
+			out := &bytes.Buffer{}
+			jsonExporter := NewJSONExportOutput(false, false, out)
+			So(jsonExporter.ExportDocument(bson.M{"created": document["created"], "total": document["total"]}), ShouldBeNil)
+			So(jsonExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual, `{"created":1433161800005,"total":1099511627776}`+"\n")
+		})
+
+		Convey("values that can't be coerced should be reported", func() {
+			coercions, err := parseCoercions("name=epochMillis")
+			So(err, ShouldBeNil)
+			err = coerceDocument(bson.M{"name": "Dublin"}, coercions)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "field 'name'")
+		})
+	})
+
+	Convey("Invalid coercions should be rejected", t, func() {
+		for _, rules := range []string{"_id", "=string", "_id=decimal", "_id=string,_id=number"} {
+			_, err := parseCoercions(rules)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
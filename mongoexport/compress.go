@@ -0,0 +1,102 @@
+package mongoexport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Compression algorithms of --compress.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// zstdCommand is the command output is piped through with --compress=zstd.
+// It isn't shipped with the tools, and must be installed separately.
+const zstdCommand = "zstd"
+
+// validateCompression returns an error if the --compress algorithm is unknown
+// or, for zstd, if the zstd command can't be found.
+func validateCompression(compression string) error {
+	switch compression {
+	case "", Gzip:
+		return nil
+	case Zstd:
+		if _, err := exec.LookPath(zstdCommand); err != nil {
+			return fmt.Errorf("--compress=zstd needs the %v command, which isn't installed or isn't in the PATH: %v", zstdCommand, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid --compress '%v', choose 'gzip' or 'zstd'", compression)
+}
+
+// nopCloser is an io.WriteCloser whose Close does nothing.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// newCompressWriter returns a writer compressing what is written to it to
+// out with the algorithm, or writing it as is if the algorithm is "". It must
+// be closed to write out the end of the compressed stream; this doesn't
+// close out.
+func newCompressWriter(compression string, out io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case "":
+		return nopCloser{out}, nil
+	case Gzip:
+		return gzip.NewWriter(out), nil
+	case Zstd:
+		return newZstdWriter(out)
+	}
+	return nil, fmt.Errorf("unknown compression '%v'", compression)
+}
+
+// zstdWriter compresses what is written to it by piping it through the zstd
+// command, which writes to the output.
+type zstdWriter struct {
+	cmd    *exec.Cmd
+	in     io.WriteCloser
+	stderr bytes.Buffer
+}
+
+func newZstdWriter(out io.Writer) (*zstdWriter, error) {
+	w := &zstdWriter{cmd: exec.Command(zstdCommand, "-q", "-c")}
+	w.cmd.Stdout = out
+	w.cmd.Stderr = &w.stderr
+	in, err := w.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	w.in = in
+	if err = w.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting %v: %v", zstdCommand, err)
+	}
+	return w, nil
+}
+
+func (w *zstdWriter) Write(p []byte) (int, error) {
+	n, err := w.in.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("error writing to %v: %v", zstdCommand, err)
+	}
+	return n, nil
+}
+
+// Close ends the input of zstd and waits for it to have written the rest of
+// its output.
+func (w *zstdWriter) Close() error {
+	w.in.Close()
+	if err := w.cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(w.stderr.String()); msg != "" {
+			return fmt.Errorf("%v failed: %v: %v", zstdCommand, err, msg)
+		}
+		return fmt.Errorf("%v failed: %v", zstdCommand, err)
+	}
+	return nil
+}
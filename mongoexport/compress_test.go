@@ -0,0 +1,63 @@
+package mongoexport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating --compress", t, func() {
+		So(validateCompression(""), ShouldBeNil)
+		So(validateCompression(Gzip), ShouldBeNil)
+		So(validateCompression("lz4"), ShouldNotBeNil)
+	})
+
+	Convey("Output written without compression is left as is", t, func() {
+		out := &bytes.Buffer{}
+		w, err := newCompressWriter("", out)
+		So(err, ShouldBeNil)
+		w.Write([]byte(`{"a":1}` + "\n"))
+		So(w.Close(), ShouldBeNil)
+		So(out.String(), ShouldEqual, `{"a":1}`+"\n")
+	})
+
+	Convey("Output compressed with gzip can be decompressed", t, func() {
+		out := &bytes.Buffer{}
+		w, err := newCompressWriter(Gzip, out)
+		So(err, ShouldBeNil)
+		w.Write([]byte(`{"a":1}` + "\n"))
+		So(w.Close(), ShouldBeNil)
+
+		r, err := gzip.NewReader(out)
+		So(err, ShouldBeNil)
+		data, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"a":1}`+"\n")
+	})
+
+	if _, err := exec.LookPath(zstdCommand); err != nil {
+		return
+	}
+
+	Convey("Output compressed with zstd can be decompressed", t, func() {
+		out := &bytes.Buffer{}
+		w, err := newCompressWriter(Zstd, out)
+		So(err, ShouldBeNil)
+		w.Write([]byte(`{"a":1}` + "\n"))
+		So(w.Close(), ShouldBeNil)
+		So(out.Len(), ShouldBeGreaterThan, 0)
+
+		cmd := exec.Command(zstdCommand, "-d", "-q", "-c")
+		cmd.Stdin = out
+		data, err := cmd.Output()
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"a":1}`+"\n")
+	})
+}
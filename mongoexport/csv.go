@@ -1,7 +1,6 @@
 package mongoexport
 
 import (
-	"encoding/csv"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/json"
@@ -19,25 +18,40 @@ type CSVExportOutput struct {
 	// for example "location.city" or "addresses.0".
 	Fields []string
 
+	// Header is the names written in the header row, one per field, which
+	// default to the fields themselves.
+	Header []string
+
 	// NumExported maintains a running total of the number of documents written.
 	NumExported int64
 
-	csvWriter *csv.Writer
+	csvWriter *csvRowWriter
 }
 
 // NewCSVExportOutput returns a CSVExportOutput configured to write output to the
 // given io.Writer, extracting the specified fields only.
 func NewCSVExportOutput(fields []string, out io.Writer) *CSVExportOutput {
+	return NewCSVDialectExportOutput(fields, DefaultCSVDialect, out)
+}
+
+// NewCSVDialectExportOutput returns a CSVExportOutput writing output in the
+// given CSV dialect.
+func NewCSVDialectExportOutput(fields []string, dialect CSVDialect, out io.Writer) *CSVExportOutput {
 	return &CSVExportOutput{
 		fields,
+		nil,
 		0,
-		csv.NewWriter(out),
+		newCSVRowWriter(out, dialect),
 	}
 }
 
 // WriteHeader writes a comma-delimited list of fields as the output header row.
 func (csvExporter *CSVExportOutput) WriteHeader() error {
-	csvExporter.csvWriter.Write(csvExporter.Fields)
+	if csvExporter.Header != nil {
+		csvExporter.csvWriter.Write(csvExporter.Header)
+	} else {
+		csvExporter.csvWriter.Write(csvExporter.Fields)
+	}
 	return csvExporter.csvWriter.Error()
 }
 
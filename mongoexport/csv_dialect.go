@@ -0,0 +1,140 @@
+package mongoexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVDialect is how CSV output is delimited, quoted and terminated.
+type CSVDialect struct {
+	// Delimiter separates the fields of a row.
+	Delimiter rune
+	// Quote encloses fields holding the delimiter, the quote, a line break
+	// or leading white space; a quote within a field is doubled.
+	Quote rune
+	// LineTerminator ends each row.
+	LineTerminator string
+}
+
+// DefaultCSVDialect is the RFC 4180 dialect, with rows ending in a newline.
+var DefaultCSVDialect = CSVDialect{Delimiter: ',', Quote: '"', LineTerminator: "\n"}
+
+// lineTerminators are the values of --lineTerminator.
+var lineTerminators = map[string]string{
+	"lf":   "\n",
+	"crlf": "\r\n",
+	"cr":   "\r",
+	`\n`:   "\n",
+	`\r\n`: "\r\n",
+	`\r`:   "\r",
+}
+
+// ParseCSVDialect returns the dialect given by --csvDelimiter, --csvQuote
+// and --lineTerminator, each defaulting to that of DefaultCSVDialect when
+// empty. The delimiter may be given as 'tab' or '\t' for TSV.
+func ParseCSVDialect(delimiter, quote, terminator string) (CSVDialect, error) {
+	dialect := DefaultCSVDialect
+	if delimiter != "" {
+		if delimiter == "tab" || delimiter == `\t` {
+			delimiter = "\t"
+		}
+		r, err := singleRune("--csvDelimiter", delimiter)
+		if err != nil {
+			return dialect, err
+		}
+		dialect.Delimiter = r
+	}
+	if quote != "" {
+		r, err := singleRune("--csvQuote", quote)
+		if err != nil {
+			return dialect, err
+		}
+		dialect.Quote = r
+	}
+	if dialect.Delimiter == dialect.Quote {
+		return dialect, fmt.Errorf("--csvDelimiter and --csvQuote must be different characters")
+	}
+	for _, r := range []rune{dialect.Delimiter, dialect.Quote} {
+		if r == '\r' || r == '\n' {
+			return dialect, fmt.Errorf("--csvDelimiter and --csvQuote can't be line breaks")
+		}
+	}
+	if terminator != "" {
+		lineTerminator, ok := lineTerminators[strings.ToLower(terminator)]
+		if !ok {
+			return dialect, fmt.Errorf("invalid --lineTerminator '%v', choose 'lf', 'crlf' or 'cr'", terminator)
+		}
+		dialect.LineTerminator = lineTerminator
+	}
+	return dialect, nil
+}
+
+// singleRune returns the only character of the option's value.
+func singleRune(option, value string) (rune, error) {
+	r, size := utf8.DecodeRuneInString(value)
+	if r == utf8.RuneError || size != len(value) {
+		return 0, fmt.Errorf("%v must be a single character, got '%v'", option, value)
+	}
+	return r, nil
+}
+
+// csvRowWriter writes rows of fields in a CSV dialect, quoting fields as
+// encoding/csv does.
+type csvRowWriter struct {
+	dialect CSVDialect
+	w       *bufio.Writer
+	err     error
+}
+
+func newCSVRowWriter(out io.Writer, dialect CSVDialect) *csvRowWriter {
+	return &csvRowWriter{dialect: dialect, w: bufio.NewWriter(out)}
+}
+
+// Write writes a row, keeping the first error for Error.
+func (cw *csvRowWriter) Write(row []string) {
+	if cw.err != nil {
+		return
+	}
+	quote := string(cw.dialect.Quote)
+	for i, field := range row {
+		if i > 0 {
+			cw.w.WriteRune(cw.dialect.Delimiter)
+		}
+		if !cw.needsQuotes(field) {
+			cw.w.WriteString(field)
+			continue
+		}
+		cw.w.WriteString(quote)
+		cw.w.WriteString(strings.Replace(field, quote, quote+quote, -1))
+		cw.w.WriteString(quote)
+	}
+	_, cw.err = cw.w.WriteString(cw.dialect.LineTerminator)
+}
+
+// needsQuotes returns true if the field must be quoted to be read back.
+func (cw *csvRowWriter) needsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsAny(field, "\r\n") ||
+		strings.ContainsRune(field, cw.dialect.Delimiter) || strings.ContainsRune(field, cw.dialect.Quote) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return r == ' ' || r == '\t'
+}
+
+// Flush writes the buffered rows out.
+func (cw *csvRowWriter) Flush() {
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+}
+
+// Error returns the first error writing or flushing.
+func (cw *csvRowWriter) Error() error {
+	return cw.err
+}
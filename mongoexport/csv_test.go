@@ -44,3 +44,38 @@ func TestWriteCSV(t *testing.T) {
 
 	})
 }
+
+func TestCSVDialect(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a semicolon delimited dialect quoting with single quotes and CRLF line endings", t, func() {
+		dialect, err := ParseCSVDialect(";", "'", "crlf")
+		So(err, ShouldBeNil)
+		out := &bytes.Buffer{}
+		csvExporter := NewCSVDialectExportOutput([]string{"a", "b", "c"}, dialect, out)
+
+		Convey("fields should only be quoted when they need to be", func() {
+			So(csvExporter.WriteHeader(), ShouldBeNil)
+			So(csvExporter.ExportDocument(bson.M{"a": "1,5", "b": "x;y", "c": "it's"}), ShouldBeNil)
+			So(csvExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "a;b;c\r\n1,5;'x;y';'it''s'\r\n")
+		})
+	})
+
+	Convey("Tab delimited output should be written with 'tab'", t, func() {
+		dialect, err := ParseCSVDialect("tab", "", `\n`)
+		So(err, ShouldBeNil)
+		So(dialect.Delimiter, ShouldEqual, '\t')
+		So(dialect.Quote, ShouldEqual, '"')
+		So(dialect.LineTerminator, ShouldEqual, "\n")
+	})
+
+	Convey("Invalid dialects should be rejected", t, func() {
+		_, err := ParseCSVDialect(";;", "", "")
+		So(err, ShouldNotBeNil)
+		_, err = ParseCSVDialect("'", "'", "")
+		So(err, ShouldNotBeNil)
+		_, err = ParseCSVDialect("", "", "crcr")
+		So(err, ShouldNotBeNil)
+	})
+}
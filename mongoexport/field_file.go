@@ -0,0 +1,105 @@
+package mongoexport
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// exportField is a field to export: the path it is projected by, its
+// dot-delimited path in the documents, and the name of its CSV header or
+// SQL column.
+type exportField struct {
+	projection string
+	path       string
+	name       string
+}
+
+// newExportField returns the field at the path, named after it. A '$'
+// projection, as in "a.$", is exported as the array it projects.
+func newExportField(path string) exportField {
+	field := exportField{projection: path, path: path}
+	// for '$' field projections, exclude '.$' from the field name
+	if i := strings.LastIndex(path, "."); i != -1 && path[i+1:] == "$" {
+		field.path = path[:i]
+	}
+	field.name = field.path
+	return field
+}
+
+// renamed returns true if the field is written under a name of its own.
+func (field exportField) renamed() bool {
+	return field.name != field.path
+}
+
+// parseFieldSpec parses a line of --fieldFile: the path of a field, e.g.
+// "user.address.city", optionally followed by the name to write it under,
+// e.g. "user.address.city:city".
+func parseFieldSpec(spec string) (exportField, error) {
+	i := strings.LastIndex(spec, ":")
+	if i == -1 {
+		return newExportField(spec), nil
+	}
+	path, name := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if path == "" || name == "" {
+		return exportField{}, fmt.Errorf("invalid field '%v', expected path:name", spec)
+	}
+	field := newExportField(path)
+	field.name = name
+	return field, nil
+}
+
+// readFieldFile reads the fields listed in a --fieldFile, one per line,
+// skipping blank lines and those starting with '#', and checks that no two
+// are written under the same name.
+func readFieldFile(path string) ([]exportField, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening --fieldFile: %v", err)
+	}
+	defer file.Close()
+
+	fields := []exportField{}
+	names := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		field, err := parseFieldSpec(text)
+		if err != nil {
+			return nil, fmt.Errorf("--fieldFile line %v: %v", line, err)
+		}
+		if other, ok := names[field.name]; ok {
+			return nil, fmt.Errorf("--fieldFile line %v: fields '%v' and '%v' are both named '%v'",
+				line, other, field.path, field.name)
+		}
+		names[field.name] = field.path
+		fields = append(fields, field)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading --fieldFile: %v", err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("--fieldFile '%v' lists no fields", path)
+	}
+	return fields, nil
+}
+
+// parseFields returns the fields given by --fields, or listed in
+// --fieldFile, or nil if neither is set.
+func (exp *MongoExport) parseFields() ([]exportField, error) {
+	if exp.OutputOpts.Fields != "" {
+		fields := []exportField{}
+		for _, path := range strings.Split(exp.OutputOpts.Fields, ",") {
+			fields = append(fields, newExportField(path))
+		}
+		return fields, nil
+	}
+	if exp.OutputOpts.FieldFile != "" {
+		return readFieldFile(exp.OutputOpts.FieldFile)
+	}
+	return nil, nil
+}
@@ -0,0 +1,115 @@
+package mongoexport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// writeFieldFile writes the contents to a temporary field file, returning
+// its path.
+func writeFieldFile(contents string) string {
+	file, err := ioutil.TempFile("", "mongoexport-fields")
+	So(err, ShouldBeNil)
+	_, err = file.WriteString(contents)
+	So(err, ShouldBeNil)
+	So(file.Close(), ShouldBeNil)
+	return file.Name()
+}
+
+func TestFieldFile(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing a field of a field file", t, func() {
+
+		Convey("a path is named after itself", func() {
+			field, err := parseFieldSpec("user.address.city")
+			So(err, ShouldBeNil)
+			So(field, ShouldResemble, exportField{"user.address.city", "user.address.city", "user.address.city"})
+			So(field.renamed(), ShouldBeFalse)
+		})
+
+		Convey("a path can be given a name of its own", func() {
+			field, err := parseFieldSpec("user.address.city : city")
+			So(err, ShouldBeNil)
+			So(field, ShouldResemble, exportField{"user.address.city", "user.address.city", "city"})
+			So(field.renamed(), ShouldBeTrue)
+		})
+
+		Convey("a '$' projection is exported as the array it projects", func() {
+			field, err := parseFieldSpec("tags.$:tag")
+			So(err, ShouldBeNil)
+			So(field, ShouldResemble, exportField{"tags.$", "tags", "tag"})
+		})
+
+		Convey("a rename must have both a path and a name", func() {
+			_, err := parseFieldSpec("user.address.city:")
+			So(err, ShouldNotBeNil)
+			_, err = parseFieldSpec(":city")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("When exporting the fields of a field file", t, func() {
+		path := writeFieldFile("# the export's columns\n_id:id\n\nuser.address.city:city\n  score  \n")
+		exp := &MongoExport{
+			OutputOpts: &OutputFormatOptions{FieldFile: path, Type: CSV},
+			csvDialect: DefaultCSVDialect,
+		}
+		defer os.Remove(path)
+		fields, err := exp.parseFields()
+		So(err, ShouldBeNil)
+		So(fields, ShouldResemble, []exportField{
+			{"_id", "_id", "id"},
+			{"user.address.city", "user.address.city", "city"},
+			{"score", "score", "score"},
+		})
+
+		out := &bytes.Buffer{}
+		output, err := exp.getExportOutput(out)
+		So(err, ShouldBeNil)
+		So(output.WriteHeader(), ShouldBeNil)
+		So(output.ExportDocument(bson.M{
+			"_id":   1,
+			"user":  bson.M{"address": bson.M{"city": "Lyon"}},
+			"score": 5,
+		}), ShouldBeNil)
+		So(output.Flush(), ShouldBeNil)
+		So(out.String(), ShouldEqual, "id,city,score\n1,Lyon,5\n")
+	})
+
+	Convey("Renamed fields name their SQL columns, unless --columnMap does", t, func() {
+		path := writeFieldFile("_id:id\nuser.address.city:city\nuser.name\n")
+		exp := &MongoExport{OutputOpts: &OutputFormatOptions{
+			FieldFile: path,
+			Type:      SQL,
+			Table:     "users",
+			ColumnMap: "_id=user_id",
+		}}
+		defer os.Remove(path)
+		output, err := exp.getExportOutput(&bytes.Buffer{})
+		So(err, ShouldBeNil)
+		So(output.(*SQLExportOutput).Columns, ShouldResemble, []string{"user_id", "city", "user_name"})
+	})
+
+	Convey("A field file is rejected", t, func() {
+
+		Convey("if two fields have the same name", func() {
+			path := writeFieldFile("a.city:city\nb.city:city\n")
+			_, err := readFieldFile(path)
+			os.Remove(path)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("if it lists no fields", func() {
+			path := writeFieldFile("# nothing\n\n")
+			_, err := readFieldFile(path)
+			os.Remove(path)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
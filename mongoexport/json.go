@@ -7,8 +7,37 @@ import (
 	"github.com/mongodb/mongo-tools/common/json"
 	"gopkg.in/mgo.v2/bson"
 	"io"
+	"strings"
 )
 
+// Layouts of JSON output supported by --jsonFormat.
+const (
+	JSONLines       = "lines"
+	JSONArrayFormat = "array"
+)
+
+// parseJSONFormat returns whether JSON output is written as an array, from
+// --jsonFormat and --jsonArray. With neither, documents are written one per
+// line.
+func parseJSONFormat(format string, jsonArray, pretty bool) (bool, error) {
+	switch strings.ToLower(format) {
+	case "":
+		return jsonArray, nil
+	case JSONArrayFormat:
+		return true, nil
+	case JSONLines:
+		if jsonArray {
+			return false, fmt.Errorf("cannot use --jsonArray with --jsonFormat=%v", JSONLines)
+		}
+		if pretty {
+			return false, fmt.Errorf("cannot use --pretty with --jsonFormat=%v, as it writes each "+
+				"document over several lines", JSONLines)
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid --jsonFormat '%v', choose '%v' or '%v'", format, JSONLines, JSONArrayFormat)
+}
+
 // JSONExportOutput is an implementation of ExportOutput that writes documents
 // to the output in JSON format.
 type JSONExportOutput struct {
@@ -71,3 +71,34 @@ func TestJSONArray(t *testing.T) {
 
 	})
 }
+
+func TestJSONFormat(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With no --jsonFormat, --jsonArray should choose the layout", t, func() {
+		jsonArray, err := parseJSONFormat("", false, false)
+		So(err, ShouldBeNil)
+		So(jsonArray, ShouldBeFalse)
+		jsonArray, err = parseJSONFormat("", true, true)
+		So(err, ShouldBeNil)
+		So(jsonArray, ShouldBeTrue)
+	})
+
+	Convey("--jsonFormat should choose lines or an array", t, func() {
+		jsonArray, err := parseJSONFormat("Array", false, true)
+		So(err, ShouldBeNil)
+		So(jsonArray, ShouldBeTrue)
+		jsonArray, err = parseJSONFormat("lines", false, false)
+		So(err, ShouldBeNil)
+		So(jsonArray, ShouldBeFalse)
+	})
+
+	Convey("Lines shouldn't be combined with --jsonArray or --pretty", t, func() {
+		_, err := parseJSONFormat("lines", true, false)
+		So(err, ShouldNotBeNil)
+		_, err = parseJSONFormat("lines", false, true)
+		So(err, ShouldNotBeNil)
+		_, err = parseJSONFormat("ndjson", false, false)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -1,4 +1,4 @@
-// Package mongoexport produces a JSON or CSV export of data stored in a MongoDB instance.
+// Package mongoexport produces a JSON, CSV, or SQL export of data stored in a MongoDB instance.
 package mongoexport
 
 import (
@@ -8,6 +8,8 @@ import (
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -15,12 +17,19 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+)
+
+const (
+	progressBarLength   = 24
+	progressBarWaitTime = time.Second * 3
 )
 
 // Output types supported by mongoexport.
 const (
 	CSV  = "csv"
 	JSON = "json"
+	SQL  = "sql"
 )
 
 // MongoExport is a container for the user-specified options and
@@ -37,6 +46,21 @@ type MongoExport struct {
 	// for connecting to the db
 	SessionProvider *db.SessionProvider
 	ExportOutput    ExportOutput
+
+	// CSV dialect parsed from --csvDelimiter, --csvQuote and --lineTerminator
+	csvDialect CSVDialect
+
+	// coercions parsed from --coerce
+	coercions []coercion
+
+	// handles documents over the maximum BSON document size
+	sizeGuard *db.SizeGuard
+
+	// size of each output buffer, from --bufferSize
+	bufferSize int
+
+	// tags of the secondary to export from, from --readPreferenceTags
+	readTags map[string]string
 }
 
 // ExportOutput is an interface that specifies how a document should be formatted
@@ -89,10 +113,93 @@ func (exp *MongoExport) ValidateSettings() error {
 		// special error for an empty type value
 		return fmt.Errorf("--type cannot be empty")
 	}
-	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON {
-		return fmt.Errorf("invalid output type '%v', choose 'json' or 'csv'", exp.OutputOpts.Type)
+	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON && exp.OutputOpts.Type != SQL {
+		return fmt.Errorf("invalid output type '%v', choose 'json', 'csv', or 'sql'", exp.OutputOpts.Type)
+	}
+
+	if exp.OutputOpts.Fields != "" && exp.OutputOpts.FieldFile != "" {
+		return fmt.Errorf("cannot use --fields with --fieldFile")
+	}
+	fields, err := exp.parseFields()
+	if err != nil {
+		return err
+	}
+	if exp.OutputOpts.Type == JSON {
+		for _, field := range fields {
+			if field.renamed() {
+				return fmt.Errorf("cannot rename field '%v' to '%v' with --type=json; "+
+					"renames only apply to --type=csv and --type=sql", field.path, field.name)
+			}
+		}
+	}
+
+	exp.OutputOpts.SQLDialect = strings.ToLower(exp.OutputOpts.SQLDialect)
+	if exp.OutputOpts.Type == SQL {
+		if exp.OutputOpts.SQLDialect != MySQL && exp.OutputOpts.SQLDialect != Postgres {
+			return fmt.Errorf("invalid SQL dialect '%v', choose 'mysql' or 'postgres'", exp.OutputOpts.SQLDialect)
+		}
+	} else if exp.OutputOpts.Table != "" || exp.OutputOpts.ColumnMap != "" {
+		return fmt.Errorf("--table and --columnMap can only be used with --type=sql")
 	}
 
+	if exp.OutputOpts.Type == JSON {
+		jsonArray, err := parseJSONFormat(exp.OutputOpts.JSONFormat, exp.OutputOpts.JSONArray, exp.OutputOpts.Pretty)
+		if err != nil {
+			return err
+		}
+		exp.OutputOpts.JSONArray = jsonArray
+	} else if exp.OutputOpts.JSONFormat != "" {
+		return fmt.Errorf("--jsonFormat can only be used with --type=json")
+	}
+
+	if exp.OutputOpts.Type == CSV {
+		csvDialect, err := ParseCSVDialect(exp.OutputOpts.CSVDelimiter, exp.OutputOpts.CSVQuote,
+			exp.OutputOpts.LineTerminator)
+		if err != nil {
+			return err
+		}
+		exp.csvDialect = csvDialect
+	} else if exp.OutputOpts.CSVDelimiter != "" || exp.OutputOpts.CSVQuote != "" || exp.OutputOpts.LineTerminator != "" {
+		return fmt.Errorf("--csvDelimiter, --csvQuote and --lineTerminator can only be used with --type=csv")
+	}
+
+	exp.OutputOpts.Compress = strings.ToLower(exp.OutputOpts.Compress)
+	if err := validateCompression(exp.OutputOpts.Compress); err != nil {
+		return err
+	}
+
+	if exp.OutputOpts.Coerce != "" {
+		coercions, err := parseCoercions(exp.OutputOpts.Coerce)
+		if err != nil {
+			return fmt.Errorf("invalid --coerce: %v", err)
+		}
+		exp.coercions = coercions
+	}
+
+	if exp.OutputOpts.OutputFile != "" {
+		outputFile := expandOutputPath(exp.OutputOpts.OutputFile, exp.ToolOptions.Namespace.DB,
+			exp.ToolOptions.Namespace.Collection, exp.OutputOpts.Type, time.Now())
+		if outputFile != exp.OutputOpts.OutputFile {
+			log.Logf(log.Info, "writing output to %v", outputFile)
+			exp.OutputOpts.OutputFile = outputFile
+		}
+	}
+
+	if exp.OutputOpts.BufferSize != "" {
+		size, err := text.ParseByteAmount(exp.OutputOpts.BufferSize)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid --bufferSize '%v': expected a positive size, e.g. 4MB",
+				exp.OutputOpts.BufferSize)
+		}
+		exp.bufferSize = int(size)
+	}
+
+	sizeGuard, err := db.NewSizeGuard(exp.OutputOpts.OversizedDocs, exp.OutputOpts.TruncateFields)
+	if err != nil {
+		return err
+	}
+	exp.sizeGuard = sizeGuard
+
 	if exp.InputOpts != nil && exp.InputOpts.Query != "" {
 		_, err := getObjectFromArg(exp.InputOpts.Query)
 		if err != nil {
@@ -106,6 +213,19 @@ func (exp *MongoExport) ValidateSettings() error {
 			return err
 		}
 	}
+
+	if exp.InputOpts != nil && exp.InputOpts.ReadPreferenceTags != "" {
+		if !exp.InputOpts.SlaveOk {
+			return fmt.Errorf("--readPreferenceTags can not be used with --slaveOk=false")
+		}
+		exp.readTags, err = db.ParseTags("--readPreferenceTags", exp.InputOpts.ReadPreferenceTags)
+		if err != nil {
+			return err
+		}
+	}
+	if exp.InputOpts != nil && exp.InputOpts.MaxStalenessSeconds < 0 {
+		return fmt.Errorf("--maxStalenessSeconds can not be negative")
+	}
 	return nil
 }
 
@@ -153,10 +273,10 @@ func makeFieldSelector(fields string) bson.M {
 	return selector
 }
 
-// getCursor returns a cursor that can be iterated over to get all the documents
-// to export, based on the options given to mongoexport. Also returns the
-// associated session, so that it can be closed once the cursor is used up.
-func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
+// getQuery returns a query for all the documents to export, based on the
+// options given to mongoexport. Also returns the associated session, so that
+// it can be closed once the query's cursor is used up.
+func (exp *MongoExport) getQuery() (*mgo.Query, *mgo.Session, error) {
 
 	sortFields := []string{}
 	if exp.InputOpts != nil && exp.InputOpts.Sort != "" {
@@ -179,6 +299,11 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 		}
 	}
 
+	fields, err := exp.parseFields()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	flags := 0
 	if len(query) == 0 && exp.InputOpts != nil &&
 		exp.InputOpts.ForceTableScan != true && exp.InputOpts.Sort == "" {
@@ -209,30 +334,56 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 		C(exp.ToolOptions.Namespace.Collection).Find(query).Sort(sortFields...).
 		Skip(skip).Limit(limit)
 
-	if len(exp.OutputOpts.Fields) > 0 {
-		q.Select(makeFieldSelector(exp.OutputOpts.Fields))
+	if len(fields) > 0 {
+		projections := make([]string, 0, len(fields))
+		for _, field := range fields {
+			projections = append(projections, field.projection)
+		}
+		q.Select(makeFieldSelector(strings.Join(projections, ",")))
 	}
 
 	q = db.ApplyFlags(q, session, flags)
 
-	return q.Iter(), session, nil
+	return q, session, nil
 
 }
 
 // Internal function that handles exporting to the given writer. Used primarily
 // for testing, because it bypasses writing to the file system.
 func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
-	exportOutput, err := exp.getExportOutput(out)
+	// serialize documents while earlier ones are written out
+	bufferSize := exp.bufferSize
+	if bufferSize == 0 {
+		bufferSize = defaultBufferSize
+	}
+	asyncOut := newAsyncWriter(out, bufferSize)
+	defer asyncOut.Close()
+
+	exportOutput, err := exp.getExportOutput(asyncOut)
 	if err != nil {
 		return 0, err
 	}
 
-	cursor, session, err := exp.getCursor()
+	if exp.readTags != nil {
+		if err = exp.connectTaggedMember(); err != nil {
+			return 0, err
+		}
+	}
+	var staleChan <-chan error
+	if exp.InputOpts != nil && exp.InputOpts.MaxStalenessSeconds > 0 {
+		if err = exp.checkStaleness(); err != nil {
+			return 0, err
+		}
+		var stopWatching func()
+		staleChan, stopWatching = exp.watchStaleness()
+		defer stopWatching()
+	}
+
+	query, session, err := exp.getQuery()
 	if err != nil {
 		return 0, err
 	}
 	defer session.Close()
-	defer cursor.Close()
 
 	connURL := exp.ToolOptions.Host
 	if connURL == "" {
@@ -249,13 +400,60 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		return 0, err
 	}
 
-	var result bson.M
+	namespace := exp.ToolOptions.Namespace.DB + "." + exp.ToolOptions.Namespace.Collection
+	defer exp.sizeGuard.LogSummary()
+
+	// count the matching documents so the progress bar can show the
+	// percentage done and the time remaining
+	total, err := query.Count()
+	if err != nil {
+		log.Logf(log.Info, "error counting documents to export, progress will show no total: %v", err)
+		total = 0
+	} else {
+		log.Logf(log.Info, "~%v documents to export", total)
+	}
+	exportProgressor := progress.NewCounter(int64(total))
+	bar := &progress.Bar{
+		Name:      namespace,
+		Watching:  exportProgressor,
+		BarLength: progressBarLength,
+		ShowRate:  true,
+	}
+	progressManager := progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
+	progressManager.Attach(bar)
+	progressManager.Start()
+	defer progressManager.Stop()
+
+	cursor := query.Iter()
+	defer cursor.Close()
+
+	var raw bson.Raw
 
 	docsCount := int64(0)
 
 	// Write document content
-	for cursor.Next(&result) {
-		err := exportOutput.ExportDocument(result)
+	for cursor.Next(&raw) {
+		select {
+		case err := <-staleChan:
+			return docsCount, err
+		default:
+		}
+		exportProgressor.Inc(1)
+		data, err := exp.sizeGuard.Check(raw.Data, namespace)
+		if err != nil {
+			return docsCount, err
+		}
+		if data == nil {
+			continue
+		}
+		result := bson.M{}
+		if err := bson.Unmarshal(data, &result); err != nil {
+			return docsCount, err
+		}
+		if err := coerceDocument(result, exp.coercions); err != nil {
+			return docsCount, err
+		}
+		err = exportOutput.ExportDocument(result)
 		if err != nil {
 			return docsCount, err
 		}
@@ -271,6 +469,9 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		return docsCount, err
 	}
 	exportOutput.Flush()
+	if err = asyncOut.Flush(); err != nil {
+		return docsCount, fmt.Errorf("error writing output: %v", err)
+	}
 	return docsCount, nil
 }
 
@@ -278,7 +479,14 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 // of documents successfully exported, and a non-nil error if something went wrong
 // during the export operation.
 func (exp *MongoExport) Export(out io.Writer) (int64, error) {
-	count, err := exp.exportInternal(out)
+	compressOut, err := newCompressWriter(exp.OutputOpts.Compress, out)
+	if err != nil {
+		return 0, err
+	}
+	count, err := exp.exportInternal(compressOut)
+	if closeErr := compressOut.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error compressing output: %v", closeErr)
+	}
 	return count, err
 }
 
@@ -286,35 +494,64 @@ func (exp *MongoExport) Export(out io.Writer) (int64, error) {
 // transforming BSON documents into the appropriate output format and writing
 // them to an output stream.
 func (exp *MongoExport) getExportOutput(out io.Writer) (ExportOutput, error) {
-	if exp.OutputOpts.Type == CSV {
-		// TODO what if user specifies *both* --fields and --fieldFile?
-		var fields []string
-		var err error
-		if len(exp.OutputOpts.Fields) > 0 {
-			fields = strings.Split(exp.OutputOpts.Fields, ",")
-		} else if exp.OutputOpts.FieldFile != "" {
-			fields, err = util.GetFieldsFromFile(exp.OutputOpts.FieldFile)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, fmt.Errorf("CSV mode requires a field list")
+	switch exp.OutputOpts.Type {
+	case CSV:
+		exportFields, err := exp.getExportFields()
+		if err != nil {
+			return nil, err
 		}
-
-		exportFields := make([]string, 0, len(fields))
-		for _, field := range fields {
-			// for '$' field projections, exclude '.$' from the field name
-			if i := strings.LastIndex(field, "."); i != -1 && field[i+1:] == "$" {
-				exportFields = append(exportFields, field[:i])
-			} else {
-				exportFields = append(exportFields, field)
+		csvOutput := NewCSVDialectExportOutput(fieldPaths(exportFields), exp.csvDialect, out)
+		for _, field := range exportFields {
+			csvOutput.Header = append(csvOutput.Header, field.name)
+		}
+		return csvOutput, nil
+	case SQL:
+		exportFields, err := exp.getExportFields()
+		if err != nil {
+			return nil, err
+		}
+		renames := map[string]string{}
+		for _, field := range exportFields {
+			if field.renamed() {
+				renames[field.path] = field.name
 			}
 		}
-		return NewCSVExportOutput(exportFields, out), nil
+		columns, err := sqlColumnNames(fieldPaths(exportFields), renames, exp.OutputOpts.ColumnMap)
+		if err != nil {
+			return nil, err
+		}
+		// insert into the table named after the collection unless told otherwise
+		table := exp.OutputOpts.Table
+		if table == "" {
+			table = exp.ToolOptions.Namespace.Collection
+		}
+		return NewSQLExportOutput(fieldPaths(exportFields), columns, table, exp.OutputOpts.SQLDialect, out), nil
 	}
 	return NewJSONExportOutput(exp.OutputOpts.JSONArray, exp.OutputOpts.Pretty, out), nil
 }
 
+// getExportFields returns the list of fields to export for output types that
+// write a fixed set of columns.
+func (exp *MongoExport) getExportFields() ([]exportField, error) {
+	fields, err := exp.parseFields()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%v mode requires a field list", strings.ToUpper(exp.OutputOpts.Type))
+	}
+	return fields, nil
+}
+
+// fieldPaths returns the paths of the fields in the documents.
+func fieldPaths(fields []exportField) []string {
+	paths := make([]string, 0, len(fields))
+	for _, field := range fields {
+		paths = append(paths, field.path)
+	}
+	return paths
+}
+
 // getObjectFromArg takes an object in extended JSON, and converts it to an object that
 // can be passed straight to db.collection.find(...) as a query or sort critera.
 // Returns an error if the string is not valid JSON, or extended JSON.
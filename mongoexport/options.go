@@ -2,27 +2,64 @@ package mongoexport
 
 var Usage = `<options>
 
-Export data from MongoDB in CSV or JSON format.
+Export data from MongoDB in CSV, JSON, or SQL format.
 
 See http://docs.mongodb.org/manual/reference/program/mongoexport/ for more information.`
 
 // OutputFormatOptions defines the set of options to use in formatting exported data.
 type OutputFormatOptions struct {
 	// Fields is an option to directly specify comma-separated fields to export to CSV.
-	Fields string `long:"fields" short:"f" description:"comma separated list of field names (required for exporting CSV) e.g. -f \"name,age\" "`
+	Fields string `long:"fields" short:"f" description:"comma separated list of field names (required for exporting CSV and SQL) e.g. -f \"name,age\" "`
 
 	// FieldFile is a filename that refers to a list of fields to export, 1 per line.
-	FieldFile string `long:"fieldFile" description:"file with field names - 1 per line"`
+	FieldFile string `long:"fieldFile" description:"file with field names - 1 per line, projected by the query; a nested field can be given a CSV header or SQL column name of its own as path:name, e.g. user.address.city:city; blank lines and lines starting with # are skipped"`
 
-	// Type selects the type of output to export as (json or csv).
-	Type string `long:"type" default:"json" default-mask:"-" description:"the output format, either json or csv (defaults to 'json')"`
+	// Type selects the type of output to export as (json, csv, or sql).
+	Type string `long:"type" default:"json" default-mask:"-" description:"the output format, either json, csv, or sql (defaults to 'json')"`
 
-	// OutputFile specifies an output file path.
-	OutputFile string `long:"out" short:"o" description:"output file; if not specified, stdout is used"`
+	// CSVDelimiter separates the fields of CSV output.
+	CSVDelimiter string `long:"csvDelimiter" value-name:"<char>" description:"character separating the fields of CSV output, e.g. ';' or 'tab' (defaults to ',')"`
+
+	// CSVQuote encloses CSV fields that need quoting.
+	CSVQuote string `long:"csvQuote" value-name:"<char>" description:"character enclosing CSV fields that hold the delimiter, the quote character or a line break (defaults to '\"')"`
+
+	// LineTerminator ends each row of CSV output.
+	LineTerminator string `long:"lineTerminator" value-name:"<terminator>" description:"line ending of each row of CSV output: lf, crlf or cr (defaults to lf)"`
+
+	// SQLDialect selects the flavor of SQL written for the sql output type.
+	SQLDialect string `long:"sqlDialect" default:"mysql" default-mask:"-" description:"the SQL dialect to write INSERT statements in, either mysql or postgres (defaults to 'mysql')"`
+
+	// Table is the table that SQL INSERT statements write to.
+	Table string `long:"table" description:"table to insert rows into when exporting SQL (defaults to the collection name)"`
+
+	// ColumnMap renames the columns that fields are written to in SQL output.
+	ColumnMap string `long:"columnMap" description:"comma separated field=column pairs naming the SQL column for a field, e.g. --columnMap \"_id=id,address.city=city\"; other fields are flattened, so a.b is written to column a_b"`
+
+	// Coerce converts the values of fields to plain scalar types.
+	Coerce string `long:"coerce" description:"comma separated field=type pairs converting the field's values to plain scalars for consumers that can't read extended JSON, e.g. --coerce \"_id=string,createdAt=epochMillis\"; type is one of string, number, epochMillis or epochSeconds"`
+
+	// OversizedDocs sets how documents over the maximum BSON document size are handled.
+	OversizedDocs string `long:"oversizedDocs" default:"fail" default-mask:"-" description:"what to do with documents over the 16MB BSON limit: fail, skip or truncate (defaults to 'fail')"`
+
+	// TruncateFields lists the fields removed from oversized documents with --oversizedDocs=truncate.
+	TruncateFields string `long:"truncateFields" description:"comma separated fields to remove, in order, from documents over the BSON limit until they fit, with --oversizedDocs=truncate"`
+
+	// OutputFile specifies an output file path, which may contain placeholders.
+	OutputFile string `long:"out" short:"o" description:"output file; if not specified, stdout is used; may contain the placeholders {db}, {collection}, {type} and {date:layout}, with a Go time layout such as {date:2006-01-02}, e.g. --out \"exports/{db}/{collection}-{date:20060102}.json\"; other braces are kept as they are"`
+
+	// Compress compresses the output with gzip or zstd; zstd depends on the
+	// zstd binary being installed.
+	Compress string `long:"compress" value-name:"<algorithm>" description:"compress the output, written to --out or stdout, with gzip or zstd; zstd pipes the output through the zstd command, which must be installed separately and be in the PATH"`
+
+	// BufferSize is the size of each of the two buffers output is written from.
+	BufferSize string `long:"bufferSize" value-name:"<size>" description:"size of each of the two buffers the output is written from, e.g. 4MB: documents are serialized into one while the other is written out, so slow disk writes don't hold up the export (defaults to 1MB)"`
 
 	// JSONArray if set will export the documents an array of JSON documents.
 	JSONArray bool `long:"jsonArray" description:"output to a JSON array rather than one object per line"`
 
+	// JSONFormat selects between one JSON document per line and a JSON array.
+	JSONFormat string `long:"jsonFormat" value-name:"<format>" description:"how JSON output is laid out: lines writes one document per line (JSON Lines, the default), for streaming, and array writes a single JSON array of the documents; --jsonArray is the same as --jsonFormat=array"`
+
 	// Pretty displays JSON data in a human-readable form.
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 }
@@ -40,6 +77,9 @@ type InputOptions struct {
 	Skip           int    `long:"skip" description:"number of documents to skip"`
 	Limit          int    `long:"limit" description:"limit the number of documents to export"`
 	Sort           string `long:"sort" description:"sort order, as a JSON string, e.g. '{x:1}'"`
+
+	ReadPreferenceTags  string `long:"readPreferenceTags" value-name:"<json>" description:"export from the least lagged secondary whose replica set tags include these, as a JSON document, e.g. '{use: \"analytics\"}', connecting to it directly"`
+	MaxStalenessSeconds int    `long:"maxStalenessSeconds" value-name:"<seconds>" description:"refuse to export from a replica set member more than this many seconds behind, and abort the export if it falls that far behind during it; 0 disables"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -0,0 +1,60 @@
+package mongoexport
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// defaultDateLayout is the layout of a {date} placeholder without one.
+const defaultDateLayout = "2006-01-02"
+
+// expandOutputPath replaces the placeholders of an --out path: {db} and
+// {collection} with the exported namespace, {type} with the output type,
+// and {date:layout} with the given time in a Go time layout, such as
+// {date:2006-01-02T1504}; {date} alone uses the layout 2006-01-02. Any other
+// braces, such as those of {host} or of an unclosed '{', are kept as they
+// are, since file names may contain them.
+func expandOutputPath(path, db, collection, outputType string, now time.Time) string {
+	expanded := &bytes.Buffer{}
+	rest := path
+	for {
+		open := strings.Index(rest, "{")
+		if open < 0 {
+			expanded.WriteString(rest)
+			return expanded.String()
+		}
+		expanded.WriteString(rest[:open])
+		end := strings.Index(rest[open:], "}")
+		if end < 0 {
+			expanded.WriteString(rest[open:])
+			return expanded.String()
+		}
+		placeholder := rest[open+1 : open+end]
+
+		name, layout := placeholder, ""
+		if i := strings.Index(placeholder, ":"); i >= 0 {
+			name, layout = placeholder[:i], placeholder[i+1:]
+		}
+		switch {
+		case name == "db" && layout == "":
+			expanded.WriteString(db)
+		case name == "collection" && layout == "":
+			expanded.WriteString(collection)
+		case name == "type" && layout == "":
+			expanded.WriteString(outputType)
+		case name == "date":
+			if layout == "" {
+				layout = defaultDateLayout
+			}
+			expanded.WriteString(now.Format(layout))
+		default:
+			// not a placeholder: keep the brace, and look for placeholders
+			// after it
+			expanded.WriteString("{")
+			rest = rest[open+1:]
+			continue
+		}
+		rest = rest[open+end+1:]
+	}
+}
@@ -0,0 +1,43 @@
+package mongoexport
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestExpandOutputPath(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When expanding an --out path", t, func() {
+		now := time.Date(2024, 5, 1, 14, 32, 5, 0, time.UTC)
+
+		Convey("a path without placeholders should be unchanged", func() {
+			path := expandOutputPath("out/users.json", "app", "users", JSON, now)
+			So(path, ShouldEqual, "out/users.json")
+		})
+
+		Convey("the namespace, type and date should be filled in", func() {
+			path := expandOutputPath("exports/{db}/{collection}-{date:20060102T1504}.{type}", "app", "users", CSV, now)
+			So(path, ShouldEqual, "exports/app/users-20240501T1432.csv")
+		})
+
+		Convey("a date without a layout should be written as 2006-01-02", func() {
+			path := expandOutputPath("{date}/{collection}.json", "app", "users", JSON, now)
+			So(path, ShouldEqual, "2024-05-01/users.json")
+		})
+
+		Convey("other braces should be kept as they are", func() {
+			So(expandOutputPath("{host}.json", "app", "users", JSON, now), ShouldEqual, "{host}.json")
+			So(expandOutputPath("{db:x}.json", "app", "users", JSON, now), ShouldEqual, "{db:x}.json")
+			So(expandOutputPath("{date.json", "app", "users", JSON, now), ShouldEqual, "{date.json")
+			So(expandOutputPath("users}.json", "app", "users", JSON, now), ShouldEqual, "users}.json")
+		})
+
+		Convey("placeholders next to other braces should still be filled in", func() {
+			So(expandOutputPath("{x{db}}/{collection}.json", "app", "users", JSON, now), ShouldEqual, "{xapp}/users.json")
+		})
+	})
+}
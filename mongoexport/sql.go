@@ -0,0 +1,258 @@
+package mongoexport
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQL dialects supported by the SQL export output.
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+)
+
+// sqlRowsPerInsert is the number of rows written in each INSERT statement.
+const sqlRowsPerInsert = 100
+
+// SQLExportOutput is an implementation of ExportOutput that writes documents
+// to the output as SQL INSERT statements, one row per document. Each field
+// becomes a column; embedded documents and arrays that are not addressed by
+// a dotted field name are written as JSON strings.
+type SQLExportOutput struct {
+	// Fields is a list of field names in the bson documents to be exported.
+	// A field can also use dot-delimited modifiers to address nested structures,
+	// for example "location.city" or "addresses.0".
+	Fields []string
+
+	// Columns holds the name of the column each field is written to.
+	Columns []string
+
+	// Table is the name of the table rows are inserted into.
+	Table string
+
+	// Dialect is the SQL dialect to write, either MySQL or Postgres.
+	Dialect string
+
+	// NumExported maintains a running total of the number of documents written.
+	NumExported int64
+
+	rows []string
+	out  *bufio.Writer
+}
+
+// NewSQLExportOutput returns a SQLExportOutput configured to write INSERT
+// statements for the given table and columns to the given io.Writer.
+func NewSQLExportOutput(fields, columns []string, table, dialect string, out io.Writer) *SQLExportOutput {
+	return &SQLExportOutput{
+		Fields:  fields,
+		Columns: columns,
+		Table:   table,
+		Dialect: dialect,
+		out:     bufio.NewWriter(out),
+	}
+}
+
+// sqlColumnNames maps each field to a column name. Columns named in the
+// mapping, given as comma-separated field=column pairs, or else in renames,
+// are used as is; all other fields are flattened by replacing '.' with '_'.
+func sqlColumnNames(fields []string, renames map[string]string, mapping string) ([]string, error) {
+	renamed := map[string]string{}
+	for field, column := range renames {
+		renamed[field] = column
+	}
+	if mapping != "" {
+		for _, pair := range strings.Split(mapping, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+				return nil, fmt.Errorf("invalid column mapping '%v', expected field=column", pair)
+			}
+			renamed[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	columns := make([]string, 0, len(fields))
+	seen := map[string]string{}
+	for _, field := range fields {
+		column, ok := renamed[field]
+		if ok {
+			delete(renamed, field)
+		} else {
+			column = strings.Replace(field, ".", "_", -1)
+		}
+		if other, ok := seen[column]; ok {
+			return nil, fmt.Errorf("fields '%v' and '%v' both map to column '%v'", other, field, column)
+		}
+		seen[column] = field
+		columns = append(columns, column)
+	}
+	for field := range renamed {
+		return nil, fmt.Errorf("column mapping for '%v' does not match an exported field", field)
+	}
+	return columns, nil
+}
+
+// WriteHeader is a no-op for SQL export formats.
+func (sqlExporter *SQLExportOutput) WriteHeader() error {
+	// no SQL header
+	return nil
+}
+
+// WriteFooter writes out any rows that have not yet been written.
+func (sqlExporter *SQLExportOutput) WriteFooter() error {
+	return sqlExporter.writeInsert()
+}
+
+// Flush writes any pending data to the underlying I/O stream.
+func (sqlExporter *SQLExportOutput) Flush() error {
+	return sqlExporter.out.Flush()
+}
+
+// ExportDocument adds a row for the document, writing an INSERT statement
+// once enough rows have been collected.
+func (sqlExporter *SQLExportOutput) ExportDocument(document bson.M) error {
+	values := make([]string, 0, len(sqlExporter.Fields))
+	for _, fieldName := range sqlExporter.Fields {
+		fieldVal, ok := lookupField(fieldName, document)
+		if !ok {
+			values = append(values, "NULL")
+			continue
+		}
+		value, err := sqlExporter.formatValue(fieldVal)
+		if err != nil {
+			return fmt.Errorf("error exporting field '%v': %v", fieldName, err)
+		}
+		values = append(values, value)
+	}
+	sqlExporter.rows = append(sqlExporter.rows, "("+strings.Join(values, ",")+")")
+	sqlExporter.NumExported++
+	if len(sqlExporter.rows) >= sqlRowsPerInsert {
+		return sqlExporter.writeInsert()
+	}
+	return nil
+}
+
+// writeInsert writes the collected rows as a single INSERT statement.
+func (sqlExporter *SQLExportOutput) writeInsert() error {
+	if len(sqlExporter.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, 0, len(sqlExporter.Columns))
+	for _, column := range sqlExporter.Columns {
+		columns = append(columns, sqlExporter.quoteIdentifier(column))
+	}
+	_, err := fmt.Fprintf(sqlExporter.out, "INSERT INTO %v (%v) VALUES\n%v;\n",
+		sqlExporter.quoteIdentifier(sqlExporter.Table), strings.Join(columns, ", "),
+		strings.Join(sqlExporter.rows, ",\n"))
+	sqlExporter.rows = sqlExporter.rows[:0]
+	return err
+}
+
+// quoteIdentifier quotes a table or column name for the dialect.
+func (sqlExporter *SQLExportOutput) quoteIdentifier(name string) string {
+	if sqlExporter.Dialect == Postgres {
+		return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+	}
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// quoteString returns a string literal for the dialect. MySQL treats
+// backslashes in strings as escapes; Postgres, with its default
+// standard_conforming_strings, does not.
+func (sqlExporter *SQLExportOutput) quoteString(s string) string {
+	if sqlExporter.Dialect == Postgres {
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	return "'" + mysqlEscaper.Replace(s) + "'"
+}
+
+var mysqlEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	"\x00", `\0`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\x1a", `\Z`,
+)
+
+// formatValue returns the SQL literal for a BSON value.
+func (sqlExporter *SQLExportOutput) formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "NULL", nil
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case json.Number:
+		return string(v), nil
+	case string:
+		return sqlExporter.quoteString(v), nil
+	case bson.ObjectId:
+		return sqlExporter.quoteString(v.Hex()), nil
+	case time.Time:
+		return sqlExporter.quoteString(v.UTC().Format("2006-01-02 15:04:05.000")), nil
+	case bson.MongoTimestamp:
+		return strconv.FormatInt(int64(v), 10), nil
+	}
+
+	// write embedded documents, arrays and any other values as extended JSON
+	extendedValue, err := bsonutil.ConvertBSONValueToJSON(value)
+	if err != nil {
+		return "", err
+	}
+	kind := reflect.ValueOf(extendedValue).Kind()
+	if kind != reflect.Map && kind != reflect.Slice && kind != reflect.Struct {
+		return sqlExporter.quoteString(fmt.Sprintf("%v", extendedValue)), nil
+	}
+	buf, err := json.Marshal(extendedValue)
+	if err != nil {
+		return "", err
+	}
+	return sqlExporter.quoteString(string(buf)), nil
+}
+
+// lookupField returns the value of a possibly dot-delimited field in the
+// document, and whether the field exists.
+func lookupField(fieldName string, document bson.M) (interface{}, bool) {
+	var subdoc interface{} = document
+	for _, path := range strings.Split(fieldName, ".") {
+		switch doc := subdoc.(type) {
+		case bson.M:
+			value, ok := doc[path]
+			if !ok {
+				return nil, false
+			}
+			subdoc = value
+		case []interface{}:
+			arrayIndex, err := strconv.Atoi(path)
+			if err != nil || arrayIndex < 0 || arrayIndex >= len(doc) {
+				return nil, false
+			}
+			subdoc = doc[arrayIndex]
+		default:
+			return nil, false
+		}
+	}
+	return subdoc, true
+}
@@ -0,0 +1,76 @@
+package mongoexport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestWriteSQL(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a SQL export output", t, func() {
+		fields := []string{"_id", "name", "address.city", "tags", "created"}
+		columns, err := sqlColumnNames(fields, nil, "_id=id")
+		So(err, ShouldBeNil)
+		So(columns, ShouldResemble, []string{"id", "name", "address_city", "tags", "created"})
+
+		out := &bytes.Buffer{}
+		document := bson.M{
+			"_id":     1,
+			"name":    "O'Brien\\",
+			"address": bson.M{"city": "Dublin"},
+			"tags":    []interface{}{"a", "b"},
+			"created": time.Date(2015, 6, 1, 12, 30, 0, 0, time.UTC),
+		}
+
+		Convey("MySQL rows should use backtick identifiers and backslash escapes", func() {
+			sqlExporter := NewSQLExportOutput(fields, columns, "people", MySQL, out)
+			So(sqlExporter.ExportDocument(document), ShouldBeNil)
+			So(sqlExporter.ExportDocument(bson.M{"_id": 2}), ShouldBeNil)
+			So(sqlExporter.WriteFooter(), ShouldBeNil)
+			So(sqlExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual,
+				"INSERT INTO `people` (`id`, `name`, `address_city`, `tags`, `created`) VALUES\n"+
+					`(1,'O\'Brien\\','Dublin','["a","b"]','2015-06-01 12:30:00.000'),`+"\n"+
+					"(2,NULL,NULL,NULL,NULL);\n")
+		})
+
+		Convey("Postgres rows should use double-quoted identifiers and doubled quotes", func() {
+			sqlExporter := NewSQLExportOutput(fields, columns, "people", Postgres, out)
+			So(sqlExporter.ExportDocument(document), ShouldBeNil)
+			So(sqlExporter.WriteFooter(), ShouldBeNil)
+			So(sqlExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual,
+				`INSERT INTO "people" ("id", "name", "address_city", "tags", "created") VALUES`+"\n"+
+					`(1,'O''Brien\','Dublin','["a","b"]','2015-06-01 12:30:00.000');`+"\n")
+		})
+
+		Convey("rows should be split across INSERT statements", func() {
+			sqlExporter := NewSQLExportOutput([]string{"_id"}, []string{"_id"}, "t", MySQL, out)
+			for i := 0; i < sqlRowsPerInsert+1; i++ {
+				So(sqlExporter.ExportDocument(bson.M{"_id": i}), ShouldBeNil)
+			}
+			So(sqlExporter.WriteFooter(), ShouldBeNil)
+			So(sqlExporter.Flush(), ShouldBeNil)
+			So(bytes.Count(out.Bytes(), []byte("INSERT INTO")), ShouldEqual, 2)
+			So(sqlExporter.NumExported, ShouldEqual, sqlRowsPerInsert+1)
+		})
+
+		Convey("invalid column mappings should be rejected", func() {
+			_, err := sqlColumnNames(fields, nil, "_id")
+			So(err, ShouldNotBeNil)
+			_, err = sqlColumnNames(fields, nil, "missing=x")
+			So(err, ShouldNotBeNil)
+			_, err = sqlColumnNames([]string{"a.b", "a_b"}, nil, "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			out.Reset()
+		})
+	})
+}
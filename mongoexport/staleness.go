@@ -0,0 +1,108 @@
+package mongoexport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"strings"
+	"time"
+)
+
+// stalenessCheckInterval is how often the staleness of the member exported
+// from is checked during the export, with --maxStalenessSeconds
+const stalenessCheckInterval = 10 * time.Second
+
+// connectTaggedMember connects directly to the least lagged secondary whose
+// tags include the --readPreferenceTags, replacing the session provider.
+func (exp *MongoExport) connectTaggedMember() error {
+	status, err := exp.SessionProvider.GetReplSetStatus()
+	if err != nil {
+		return fmt.Errorf("error getting replica set status for --readPreferenceTags: %v", err)
+	}
+	config, err := exp.SessionProvider.GetReplSetConfig()
+	if err != nil {
+		return fmt.Errorf("error getting replica set config for --readPreferenceTags: %v", err)
+	}
+	host, err := db.SelectTaggedMember(status, config, exp.readTags)
+	if err != nil {
+		return err
+	}
+	log.Logf(log.Info, "selected %v for tags %v", host, db.FormatTags(exp.readTags))
+
+	opts := exp.ToolOptions
+	connection := *opts.Connection
+	connection.Host = host
+	if strings.Contains(host, ":") {
+		connection.Port = ""
+	}
+	opts.Connection = &connection
+	opts.Direct = true
+	opts.ReplicaSetName = ""
+	provider, err := db.NewSessionProvider(opts)
+	if err != nil {
+		return fmt.Errorf("error connecting to %v: %v", host, err)
+	}
+	exp.SessionProvider.Close()
+	exp.SessionProvider = provider
+	exp.ToolOptions = opts
+	return nil
+}
+
+// checkStaleness returns an error if the member exported from is more than
+// --maxStalenessSeconds behind the most recent member of its replica set.
+func (exp *MongoExport) checkStaleness() error {
+	status, err := exp.SessionProvider.GetReplSetStatus()
+	if err != nil {
+		return fmt.Errorf("error getting replica set status for --maxStalenessSeconds: %v", err)
+	}
+	return staleError(status, exp.maxStaleness())
+}
+
+// maxStaleness returns the --maxStalenessSeconds limit.
+func (exp *MongoExport) maxStaleness() time.Duration {
+	return time.Duration(exp.InputOpts.MaxStalenessSeconds) * time.Second
+}
+
+// staleError returns an error if the member the status was read from is
+// more than maxStaleness behind.
+func staleError(status db.ReplSetStatus, maxStaleness time.Duration) error {
+	lag, member, err := status.Lag("")
+	if err != nil {
+		return err
+	}
+	if lag > maxStaleness {
+		return fmt.Errorf("%v is %v behind, more than --maxStalenessSeconds of %v", member, lag, maxStaleness)
+	}
+	log.Logf(log.DebugLow, "%v is %v behind", member, lag)
+	return nil
+}
+
+// watchStaleness checks the staleness of the member exported from every
+// stalenessCheckInterval, until the returned function is called. The
+// returned channel receives an error once the member is too far behind,
+// aborting the export.
+func (exp *MongoExport) watchStaleness() (<-chan error, func()) {
+	staleChan := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(stalenessCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			status, err := exp.SessionProvider.GetReplSetStatus()
+			if err != nil {
+				log.Logf(log.Info, "error getting replica set status for --maxStalenessSeconds: %v", err)
+				continue
+			}
+			if err = staleError(status, exp.maxStaleness()); err != nil {
+				staleChan <- err
+				return
+			}
+		}
+	}()
+	return staleChan, func() { close(done) }
+}
@@ -0,0 +1,28 @@
+package mongoexport
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStaleness(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the status read from a secondary", t, func() {
+		now := time.Now()
+		status := db.ReplSetStatus{Members: []db.MemberStatus{
+			{Name: "a:27017", State: 1, OptimeDate: now},
+			{Name: "b:27017", State: 2, OptimeDate: now.Add(-30 * time.Second), Self: true},
+		}}
+
+		Convey("it should only be stale when further behind than allowed", func() {
+			So(staleError(status, time.Minute), ShouldBeNil)
+			err := staleError(status, 10*time.Second)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "b:27017 is 30s behind")
+		})
+	})
+}
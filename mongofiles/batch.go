@@ -0,0 +1,238 @@
+package mongofiles
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchCommands are the commands 'batch' runs.
+var batchCommands = map[string]bool{
+	Put:      true,
+	Get:      true,
+	GetID:    true,
+	Delete:   true,
+	DeleteID: true,
+}
+
+// batchCommand is a command read by 'batch' from one line of its input.
+type batchCommand struct {
+	// index of the command among the lines run, and its line number
+	index, line   int
+	command       string
+	fileName      string
+	localFileName string
+	// err is set if the line isn't a valid command
+	err error
+}
+
+func (bc batchCommand) String() string {
+	return fmt.Sprintf("line %v (%v %v)", bc.line, bc.command, bc.fileName)
+}
+
+// batchResult is the outcome of running a batch command.
+type batchResult struct {
+	command batchCommand
+	output  string
+	err     error
+}
+
+// splitBatchLine splits a line of 'batch' input into its arguments,
+// separated by white space. An argument holding white space can be quoted:
+// within single quotes every character is kept as is, and within double
+// quotes a backslash escapes the next character.
+func splitBatchLine(text string) ([]string, error) {
+	args := []string{}
+	var arg []rune
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range text {
+		switch {
+		case escaped:
+			arg = append(arg, r)
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg = append(arg, r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = nil, false
+			}
+		default:
+			arg = append(arg, r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+// parseBatchLine parses a line of 'batch' input: a command, the GridFS
+// filename or _id, and, for put, get and get_id, an optional local filename.
+func parseBatchLine(text string) (command, fileName, localFileName string, err error) {
+	args, err := splitBatchLine(text)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !batchCommands[args[0]] {
+		return "", "", "", fmt.Errorf("'%v' can not be run by '%v'; use %v, %v, %v, %v or %v",
+			args[0], Batch, Put, Get, GetID, Delete, DeleteID)
+	}
+	if len(args) == 1 || args[1] == "" {
+		return "", "", "", fmt.Errorf("'%v' argument missing", args[0])
+	}
+	if len(args) > 3 {
+		return "", "", "", fmt.Errorf("too many arguments")
+	}
+	if len(args) == 3 {
+		if args[0] == Delete || args[0] == DeleteID {
+			return "", "", "", fmt.Errorf("'%v' does not take a local filename", args[0])
+		}
+		if args[2] == "-" {
+			return "", "", "", fmt.Errorf("standard input and output can not be used by '%v'", Batch)
+		}
+		localFileName = args[2]
+	}
+	return args[0], args[1], localFileName, nil
+}
+
+// readBatchCommands sends the commands read from the input, one per line,
+// skipping blank lines and those starting with '#', then closes the channel.
+func readBatchCommands(in io.Reader, commands chan<- batchCommand) error {
+	defer close(commands)
+	scanner := bufio.NewScanner(in)
+	line, index := 0, 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		command := batchCommand{index: index, line: line}
+		command.command, command.fileName, command.localFileName, command.err = parseBatchLine(text)
+		if command.err != nil {
+			command.command = strings.Fields(text)[0]
+		}
+		commands <- command
+		index++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading commands: %v", err)
+	}
+	return nil
+}
+
+// runBatchCommand runs a command read by 'batch', with the storage options
+// of the command line.
+func (mf *MongoFiles) runBatchCommand(gfs *mgo.GridFS, command batchCommand) (string, error) {
+	if command.err != nil {
+		return "", command.err
+	}
+	storageOptions := *mf.StorageOptions
+	storageOptions.LocalFileName = command.localFileName
+	commandFiles := &MongoFiles{
+		ToolOptions:     mf.ToolOptions,
+		StorageOptions:  &storageOptions,
+		SessionProvider: mf.SessionProvider,
+		Command:         command.command,
+		FileName:        command.fileName,
+	}
+	return commandFiles.handleCommand(gfs)
+}
+
+// handle logic for 'batch' command: run the commands read from standard
+// input, --numParallelCommands at once over copies of the session, and
+// report how many of each succeeded. A failing command doesn't stop the
+// others, and the output of the commands is returned in input order.
+func (mf *MongoFiles) handleBatch(session *mgo.Session) (string, error) {
+	in := mf.BatchInput
+	if in == nil {
+		in = os.Stdin
+	}
+	workers := mf.StorageOptions.NumParallelCommands
+	if workers < 1 {
+		workers = 1
+	}
+	start := time.Now()
+
+	commands := make(chan batchCommand)
+	results := make(chan batchResult)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- readBatchCommands(in, commands)
+	}()
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workerSession := session.Copy()
+			defer workerSession.Close()
+			gfs := workerSession.DB(mf.StorageOptions.DB).GridFS(mf.StorageOptions.GridFSPrefix)
+			for command := range commands {
+				output, err := mf.runBatchCommand(gfs, command)
+				results <- batchResult{command, output, err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	outputs := []string{}
+	succeeded := map[string]int{}
+	failed := 0
+	for result := range results {
+		for len(outputs) <= result.command.index {
+			outputs = append(outputs, "")
+		}
+		if result.err != nil {
+			failed++
+			log.Logf(log.Always, "%v failed: %v", result.command, strings.TrimSpace(result.err.Error()))
+			continue
+		}
+		succeeded[result.command.command]++
+		outputs[result.command.index] = result.output
+	}
+	if err := <-readErr; err != nil {
+		return strings.Join(outputs, ""), err
+	}
+
+	total := len(outputs)
+	summary := fmt.Sprintf("batch: %v of %v command(s) succeeded in %v",
+		total-failed, total, time.Since(start).Round(time.Millisecond))
+	if len(succeeded) > 0 {
+		counts := []string{}
+		for command, count := range succeeded {
+			counts = append(counts, fmt.Sprintf("%v: %v", command, count))
+		}
+		sort.Strings(counts)
+		summary += " (" + strings.Join(counts, ", ") + ")"
+	}
+	output := strings.Join(outputs, "") + summary + "\n"
+	if failed > 0 {
+		return output, fmt.Errorf("%v of %v batch command(s) failed", failed, total)
+	}
+	return output, nil
+}
@@ -20,7 +20,7 @@ func main() {
 	storageOpts := &mongofiles.StorageOptions{}
 	opts.AddOptions(storageOpts)
 
-	args, err := opts.Parse()
+	args, err := opts.ParseArgs(mongofiles.JoinRevisionArg(os.Args[1:]))
 	if err != nil {
 		log.Logf(log.Always, "error parsing command line options: %v", err)
 		log.Logf(log.Always, "try 'mongofiles --help' for more information")
@@ -66,6 +66,8 @@ func main() {
 
 	output, err := mf.Run(true)
 	if err != nil {
+		// batch reports the commands that succeeded even when others failed
+		fmt.Printf("%s", output)
 		log.Logf(log.Always, "Failed: %v", err)
 		os.Exit(util.ExitError)
 	}
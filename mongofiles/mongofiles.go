@@ -8,24 +8,35 @@ import (
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // List of possible commands for mongofiles.
 const (
-	List     = "list"
-	Search   = "search"
-	Put      = "put"
-	Get      = "get"
-	GetID    = "get_id"
-	Delete   = "delete"
-	DeleteID = "delete_id"
+	List      = "list"
+	Search    = "search"
+	Put       = "put"
+	Get       = "get"
+	GetID     = "get_id"
+	Delete    = "delete"
+	DeleteID  = "delete_id"
+	Prune     = "prune"
+	Revisions = "revisions"
+	Batch     = "batch"
+)
+
+const (
+	progressBarLength   = 24
+	progressBarWaitTime = time.Second * 3
 )
 
 // MongoFiles is a container for the user-specified options and
@@ -45,6 +56,9 @@ type MongoFiles struct {
 
 	// filename in GridFS
 	FileName string
+
+	// where 'batch' reads its commands from; defaults to standard input
+	BatchInput io.Reader
 }
 
 // GFSFile represents a GridFS file.
@@ -76,7 +90,24 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		} else {
 			fileName = args[1]
 		}
-	case Search, Put, Get, Delete, GetID, DeleteID:
+	case Prune:
+		if len(args) > 1 {
+			return fmt.Errorf("'%v' does not take a filename argument", args[0])
+		}
+		if mf.StorageOptions.OlderThan == "" {
+			return fmt.Errorf("--olderThan is required for '%v'", args[0])
+		}
+		if _, err := parseRetentionPeriod(mf.StorageOptions.OlderThan); err != nil {
+			return err
+		}
+	case Batch:
+		if len(args) > 1 {
+			return fmt.Errorf("'%v' does not take a filename argument", args[0])
+		}
+		if mf.StorageOptions.LocalFileName != "" {
+			return fmt.Errorf("--local can not be used with '%v'; give each command's local filename on its line", args[0])
+		}
+	case Search, Put, Get, Delete, GetID, DeleteID, Revisions:
 		// also make sure the supporting argument isn't literally an
 		// empty string for example, mongofiles get ""
 		if len(args) == 1 || args[1] == "" {
@@ -87,6 +118,23 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		return fmt.Errorf("'%v' is not a valid command", args[0])
 	}
 
+	if mf.StorageOptions.Revision != "" {
+		if args[0] != Get && args[0] != Batch {
+			return fmt.Errorf("--revision can only be used with '%v'", Get)
+		}
+		if _, err := strconv.Atoi(mf.StorageOptions.Revision); err != nil {
+			return fmt.Errorf("invalid --revision value '%v'", mf.StorageOptions.Revision)
+		}
+	}
+	if mf.StorageOptions.KeepRevisions != 0 {
+		if args[0] != Delete && args[0] != Batch {
+			return fmt.Errorf("--keepRevisions can only be used with '%v'", Delete)
+		}
+		if mf.StorageOptions.KeepRevisions < 0 {
+			return fmt.Errorf("--keepRevisions can not be negative")
+		}
+	}
+
 	if mf.StorageOptions.GridFSPrefix == "" {
 		return fmt.Errorf("--prefix can not be blank")
 	}
@@ -130,9 +178,74 @@ func (mf *MongoFiles) getLocalFileName(gridFile *mgo.GridFile) string {
 	return localFileName
 }
 
+// JoinRevisionArg joins a negative --revision value given as a separate
+// argument to the flag, as in --revision=-1, so that it isn't parsed as an
+// option of its own.
+func JoinRevisionArg(args []string) []string {
+	joined := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--revision" && i+1 < len(args) && strings.HasPrefix(args[i+1], "-") {
+			if _, err := strconv.Atoi(args[i+1]); err == nil {
+				joined = append(joined, args[i]+"="+args[i+1])
+				i++
+				continue
+			}
+		}
+		joined = append(joined, args[i])
+	}
+	return joined
+}
+
+// find all revisions of the file, oldest first
+func (mf *MongoFiles) findRevisions(gfs *mgo.GridFS) ([]GFSFile, error) {
+	var files []GFSFile
+	err := gfs.Find(bson.M{"filename": mf.FileName}).Sort("uploadDate", "_id").All(&files)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving revisions of '%v': %v", mf.FileName, err)
+	}
+	return files, nil
+}
+
+// selectRevision returns the given revision from a list of revisions sorted
+// oldest first. Non-negative revisions count up from the original file, and
+// negative ones count back from the newest.
+func selectRevision(files []GFSFile, revision int) (GFSFile, error) {
+	index := revision
+	if revision < 0 {
+		index = len(files) + revision
+	}
+	if index < 0 || index >= len(files) {
+		return GFSFile{}, fmt.Errorf("revision %v does not exist; there are %v revision(s)", revision, len(files))
+	}
+	return files[index], nil
+}
+
 // handle logic for 'get' command
 func (mf *MongoFiles) handleGet(gfs *mgo.GridFS) (string, error) {
-	gFile, err := gfs.Open(mf.FileName)
+	revision := -1
+	if mf.StorageOptions.Revision != "" {
+		var err error
+		if revision, err = strconv.Atoi(mf.StorageOptions.Revision); err != nil {
+			return "", fmt.Errorf("invalid --revision value '%v'", mf.StorageOptions.Revision)
+		}
+	}
+	files, err := mf.findRevisions(gfs)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("error opening GridFS file '%s': %v", mf.FileName, mgo.ErrNotFound)
+	}
+	file, err := selectRevision(files, revision)
+	if err != nil {
+		return "", fmt.Errorf("error opening GridFS file '%s': %v", mf.FileName, err)
+	}
+	if len(files) > 1 && mf.StorageOptions.Revision == "" {
+		log.Logf(log.Info, "'%v' has %v revisions; getting the newest, use --revision to pick another",
+			mf.FileName, len(files))
+	}
+
+	gFile, err := gfs.OpenId(file.Id)
 	if err != nil {
 		return "", fmt.Errorf("error opening GridFS file '%s': %v", mf.FileName, err)
 	}
@@ -162,6 +275,42 @@ func (mf *MongoFiles) handleGetID(gfs *mgo.GridFS) (string, error) {
 	return fmt.Sprintf("finished writing to: %s\n", mf.getLocalFileName(gFile)), nil
 }
 
+// handle logic for 'revisions' command
+func (mf *MongoFiles) handleRevisions(gfs *mgo.GridFS) (string, error) {
+	files, err := mf.findRevisions(gfs)
+	if err != nil {
+		return "", err
+	}
+	output := ""
+	for i, file := range files {
+		output += fmt.Sprintf("%d\t%s\t%d\t%s\n",
+			i, file.Id.Hex(), file.Length, file.UploadDate.Format(time.RFC3339))
+	}
+	return output, nil
+}
+
+// logic for deleting all but the newest --keepRevisions revisions of a file
+// with 'delete'
+func (mf *MongoFiles) handleDeleteOldRevisions(gfs *mgo.GridFS) (string, error) {
+	files, err := mf.findRevisions(gfs)
+	if err != nil {
+		return "", err
+	}
+	keep := mf.StorageOptions.KeepRevisions
+	if len(files) <= keep {
+		return fmt.Sprintf("'%v' has %v revision(s); nothing to delete\n", mf.FileName, len(files)), nil
+	}
+	old := files[:len(files)-keep]
+	for _, file := range old {
+		if err = gfs.RemoveId(file.Id); err != nil {
+			return "", fmt.Errorf("error while removing revision of '%v' with _id %v from GridFS: %v",
+				mf.FileName, file.Id.Hex(), err)
+		}
+	}
+	return fmt.Sprintf("successfully deleted %v old revision(s) of '%v' from GridFS, keeping the newest %v\n",
+		len(old), mf.FileName, keep), nil
+}
+
 // logic for deleting a file with 'delete_id'
 func (mf *MongoFiles) handleDeleteID(gfs *mgo.GridFS) (string, error) {
 	id, err := mf.parseID()
@@ -204,12 +353,44 @@ func (mf *MongoFiles) writeFile(gridFile *mgo.GridFile) (err error) {
 		log.Logf(log.DebugLow, "created local file '%v'", localFileName)
 	}
 
-	if _, err = io.Copy(localFile, gridFile); err != nil {
+	if _, err = copyWithProgress(gridFile.Name(), localFile, gridFile, gridFile.Size()); err != nil {
 		return fmt.Errorf("error while writing data into local file '%v': %v\n", localFileName, err)
 	}
 	return nil
 }
 
+// progressReader counts the bytes read through it on a progressor.
+type progressReader struct {
+	io.Reader
+	progressor progress.Progressor
+}
+
+// Read is part of the io.Reader interface.
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.Reader.Read(p)
+	pr.progressor.Inc(int64(n))
+	return n, err
+}
+
+// copyWithProgress copies src to dst while showing a progress bar, with the
+// throughput and the time remaining, of the bytes copied out of size, or just
+// of the bytes copied if size is 0.
+func copyWithProgress(name string, dst io.Writer, src io.Reader, size int64) (int64, error) {
+	progressor := progress.NewCounter(size)
+	bar := &progress.Bar{
+		Name:      name,
+		Watching:  progressor,
+		BarLength: progressBarLength,
+		IsBytes:   true,
+		ShowRate:  true,
+	}
+	manager := progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
+	manager.Attach(bar)
+	manager.Start()
+	defer manager.Stop()
+	return io.Copy(dst, &progressReader{src, progressor})
+}
+
 // handle logic for 'put' command.
 func (mf *MongoFiles) handlePut(gfs *mgo.GridFS) (string, error) {
 	localFileName := mf.getLocalFileName(nil)
@@ -239,6 +420,14 @@ func (mf *MongoFiles) handlePut(gfs *mgo.GridFS) (string, error) {
 		log.Logf(log.DebugLow, "creating GridFS file '%v' from local file '%v'", mf.FileName, localFileName)
 	}
 
+	// the size of the local file, if known, for the progress bar
+	var size int64
+	if localFileName != "-" {
+		if info, err := os.Stat(localFileName); err == nil {
+			size = info.Size()
+		}
+	}
+
 	gFile, err := gfs.Create(mf.FileName)
 	if err != nil {
 		return "", fmt.Errorf("error while creating '%v' in GridFS: %v\n", mf.FileName, err)
@@ -250,7 +439,7 @@ func (mf *MongoFiles) handlePut(gfs *mgo.GridFS) (string, error) {
 		gFile.SetContentType(mf.StorageOptions.ContentType)
 	}
 
-	_, err = io.Copy(gFile, localFile)
+	_, err = copyWithProgress(mf.FileName, gFile, localFile, size)
 	if err != nil {
 		return "", fmt.Errorf("error while storing '%v' into GridFS: %v\n", localFileName, err)
 	}
@@ -259,6 +448,99 @@ func (mf *MongoFiles) handlePut(gfs *mgo.GridFS) (string, error) {
 	return output, nil
 }
 
+// parseRetentionPeriod parses a retention period such as "30d", "2w" or "36h".
+// In addition to the units understood by time.ParseDuration, it accepts
+// 'd' for days and 'w' for weeks.
+func parseRetentionPeriod(period string) (time.Duration, error) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(period, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(period, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		duration, err := time.ParseDuration(period)
+		if err != nil || duration <= 0 {
+			return 0, fmt.Errorf("invalid --olderThan value '%v'", period)
+		}
+		return duration, nil
+	}
+	count, err := strconv.Atoi(period[:len(period)-1])
+	if err != nil || count <= 0 {
+		return 0, fmt.Errorf("invalid --olderThan value '%v'", period)
+	}
+	return time.Duration(count) * unit, nil
+}
+
+// build the query used by 'prune' to select files uploaded before the cutoff,
+// combined with the optional --query filter
+func (mf *MongoFiles) buildPruneQuery(cutoff time.Time) (bson.M, error) {
+	query := bson.M{}
+	if mf.StorageOptions.Query != "" {
+		var asJSON interface{}
+		if err := json.Unmarshal([]byte(mf.StorageOptions.Query), &asJSON); err != nil {
+			return nil, fmt.Errorf("error parsing query as json: %v", err)
+		}
+		convertedJSON, err := bsonutil.ConvertJSONValueToBSON(asJSON)
+		if err != nil {
+			return nil, fmt.Errorf("error converting query to bson: %v", err)
+		}
+		asMap, ok := convertedJSON.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("query is not in proper format")
+		}
+		query = bson.M(asMap)
+	}
+	if _, ok := query["uploadDate"]; ok {
+		return nil, fmt.Errorf("--query can not filter on 'uploadDate' when used with --olderThan")
+	}
+	query["uploadDate"] = bson.M{"$lt": cutoff}
+	return query, nil
+}
+
+// handle logic for 'prune' command
+func (mf *MongoFiles) handlePrune(gfs *mgo.GridFS) (string, error) {
+	retention, err := parseRetentionPeriod(mf.StorageOptions.OlderThan)
+	if err != nil {
+		return "", err
+	}
+	cutoff := time.Now().Add(-retention)
+	query, err := mf.buildPruneQuery(cutoff)
+	if err != nil {
+		return "", err
+	}
+	log.Logf(log.DebugLow, "pruning GridFS files uploaded before %v", cutoff.Format(time.RFC3339))
+
+	// collect the matching files first so removals don't disturb the cursor
+	var files []GFSFile
+	if err = gfs.Find(query).Sort("uploadDate").All(&files); err != nil {
+		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+
+	output := ""
+	var prunedBytes int64
+	for _, file := range files {
+		uploaded := file.UploadDate.Format(time.RFC3339)
+		if mf.StorageOptions.DryRun {
+			output += fmt.Sprintf("would delete: %s\t%d\t%s\n", file.Name, file.Length, uploaded)
+		} else {
+			if err = gfs.RemoveId(file.Id); err != nil {
+				return output, fmt.Errorf("error while removing '%v' (_id %v) from GridFS: %v",
+					file.Name, file.Id.Hex(), err)
+			}
+			output += fmt.Sprintf("deleted: %s\t%d\t%s\n", file.Name, file.Length, uploaded)
+		}
+		prunedBytes += file.Length
+	}
+
+	if mf.StorageOptions.DryRun {
+		output += fmt.Sprintf("dry run: %v file(s) totalling %v bytes would be deleted\n", len(files), prunedBytes)
+	} else {
+		output += fmt.Sprintf("successfully deleted %v file(s) totalling %v bytes from GridFS\n", len(files), prunedBytes)
+	}
+	return output, nil
+}
+
 // Run the mongofiles utility. If displayHost is true, the connected host/port is
 // displayed.
 func (mf *MongoFiles) Run(displayHost bool) (string, error) {
@@ -307,13 +589,24 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if mf.Command == Batch {
+		return mf.handleBatch(session)
+	}
+
 	// get GridFS handle
 	gfs := session.DB(mf.StorageOptions.DB).GridFS(mf.StorageOptions.GridFSPrefix)
 
-	var output string
-
 	log.Logf(log.Info, "handling mongofiles '%v' command...", mf.Command)
 
+	return mf.handleCommand(gfs)
+}
+
+// handleCommand runs the mongofiles command on the GridFS, returning its
+// output.
+func (mf *MongoFiles) handleCommand(gfs *mgo.GridFS) (string, error) {
+	var output string
+	var err error
+
 	switch mf.Command {
 
 	case List:
@@ -360,13 +653,27 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 			return "", err
 		}
 
-	case Delete:
+	case Revisions:
 
-		err = gfs.Remove(mf.FileName)
+		output, err = mf.handleRevisions(gfs)
 		if err != nil {
-			return "", fmt.Errorf("error while removing '%v' from GridFS: %v\n", mf.FileName, err)
+			return "", err
+		}
+
+	case Delete:
+
+		if mf.StorageOptions.KeepRevisions > 0 {
+			output, err = mf.handleDeleteOldRevisions(gfs)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			err = gfs.Remove(mf.FileName)
+			if err != nil {
+				return "", fmt.Errorf("error while removing '%v' from GridFS: %v\n", mf.FileName, err)
+			}
+			output = fmt.Sprintf("successfully deleted all instances of '%v' from GridFS\n", mf.FileName)
 		}
-		output = fmt.Sprintf("successfully deleted all instances of '%v' from GridFS\n", mf.FileName)
 
 	case DeleteID:
 
@@ -375,6 +682,13 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 			return "", err
 		}
 
+	case Prune:
+
+		output, err = mf.handlePrune(gfs)
+		if err != nil {
+			return "", err
+		}
+
 	}
 
 	return output, nil
@@ -6,6 +6,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	"github.com/mongodb/mongo-tools/common/util"
 	. "github.com/smartystreets/goconvey/convey"
@@ -15,6 +16,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -207,6 +209,224 @@ func TestValidArguments(t *testing.T) {
 			So(err.Error(), ShouldEqual, fmt.Sprintf("'%v' is not a valid command", args[0]))
 		})
 
+		Convey("It should error out when prune is given a filename or no --olderThan", func() {
+			err := mf.ValidateCommand([]string{"prune", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "'prune' does not take a filename argument")
+
+			err = mf.ValidateCommand([]string{"prune"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--olderThan is required for 'prune'")
+		})
+
+		Convey("It should not error out when prune is given a valid --olderThan", func() {
+			mf.StorageOptions.OlderThan = "30d"
+			So(mf.ValidateCommand([]string{"prune"}), ShouldBeNil)
+			So(mf.Command, ShouldEqual, Prune)
+		})
+
+		Convey("It should only accept --revision with get and --keepRevisions with delete", func() {
+			mf.StorageOptions.Revision = "-2"
+			So(mf.ValidateCommand([]string{"get", "file"}), ShouldBeNil)
+			err := mf.ValidateCommand([]string{"delete", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--revision can only be used with 'get'")
+
+			mf.StorageOptions.Revision = "newest"
+			err = mf.ValidateCommand([]string{"get", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "invalid --revision value 'newest'")
+
+			mf.StorageOptions.Revision = ""
+			mf.StorageOptions.KeepRevisions = 2
+			So(mf.ValidateCommand([]string{"delete", "file"}), ShouldBeNil)
+			err = mf.ValidateCommand([]string{"revisions", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--keepRevisions can only be used with 'delete'")
+		})
+
+		Convey("It should only accept batch without a filename or --local", func() {
+			So(mf.ValidateCommand([]string{"batch"}), ShouldBeNil)
+			So(mf.Command, ShouldEqual, Batch)
+			err := mf.ValidateCommand([]string{"batch", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "'batch' does not take a filename argument")
+
+			mf.StorageOptions.LocalFileName = "local"
+			So(mf.ValidateCommand([]string{"batch"}), ShouldNotBeNil)
+		})
+
+	})
+}
+
+// Test that the lines read by 'batch' are parsed into commands
+func TestParseBatchLine(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Arguments should be split on white space, unless quoted", t, func() {
+		args, err := splitBatchLine(`put  "my report.pdf"	'/tmp/a "b"' "x\"y"`)
+		So(err, ShouldBeNil)
+		So(args, ShouldResemble, []string{"put", "my report.pdf", `/tmp/a "b"`, `x"y`})
+
+		_, err = splitBatchLine(`get "unterminated`)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A put, get or get_id may be given a local filename", t, func() {
+		command, fileName, localFileName, err := parseBatchLine("put report.pdf /tmp/report.pdf")
+		So(err, ShouldBeNil)
+		So(command, ShouldEqual, Put)
+		So(fileName, ShouldEqual, "report.pdf")
+		So(localFileName, ShouldEqual, "/tmp/report.pdf")
+
+		command, fileName, localFileName, err = parseBatchLine(`get_id '{"$oid": "5f0c5c4a0000000000000000"}'`)
+		So(err, ShouldBeNil)
+		So(command, ShouldEqual, GetID)
+		So(fileName, ShouldEqual, `{"$oid": "5f0c5c4a0000000000000000"}`)
+		So(localFileName, ShouldEqual, "")
+	})
+
+	Convey("Invalid lines should be rejected", t, func() {
+		for _, line := range []string{"list", "prune", "get", "delete a b", "put a b c", "get a -"} {
+			_, _, _, err := parseBatchLine(line)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Blank lines and comments should be skipped", t, func() {
+		commands := make(chan batchCommand, 10)
+		err := readBatchCommands(strings.NewReader("# upload\nput a\n\nbogus b\ndelete c\n"), commands)
+		So(err, ShouldBeNil)
+		read := []batchCommand{}
+		for command := range commands {
+			read = append(read, command)
+		}
+		So(len(read), ShouldEqual, 3)
+		So(read[0].line, ShouldEqual, 2)
+		So(read[1].err, ShouldNotBeNil)
+		So(read[1].command, ShouldEqual, "bogus")
+		So(read[2].index, ShouldEqual, 2)
+		So(read[2].line, ShouldEqual, 5)
+	})
+}
+
+// Test that revisions are counted from the original file, or back from the
+// newest one
+func TestSelectRevision(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With three revisions of a file, oldest first", t, func() {
+		files := []GFSFile{{Length: 1}, {Length: 2}, {Length: 3}}
+
+		Convey("non-negative revisions should count from the original", func() {
+			file, err := selectRevision(files, 0)
+			So(err, ShouldBeNil)
+			So(file.Length, ShouldEqual, 1)
+			file, err = selectRevision(files, 2)
+			So(err, ShouldBeNil)
+			So(file.Length, ShouldEqual, 3)
+		})
+
+		Convey("negative revisions should count back from the newest", func() {
+			file, err := selectRevision(files, -1)
+			So(err, ShouldBeNil)
+			So(file.Length, ShouldEqual, 3)
+			file, err = selectRevision(files, -3)
+			So(err, ShouldBeNil)
+			So(file.Length, ShouldEqual, 1)
+		})
+
+		Convey("revisions that do not exist should error", func() {
+			_, err := selectRevision(files, 3)
+			So(err, ShouldNotBeNil)
+			_, err = selectRevision(files, -4)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+// Test that a negative --revision is parsed as its value rather than as an
+// option
+func TestJoinRevisionArg(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the mongofiles options", t, func() {
+		opts := options.New("mongofiles", Usage, options.EnabledOptions{Auth: true, Connection: true})
+		storageOpts := &StorageOptions{}
+		So(opts.AddOptions(storageOpts), ShouldBeNil)
+
+		Convey("a negative --revision given as a separate argument should be its value", func() {
+			args, err := opts.ParseArgs(JoinRevisionArg([]string{"get", "--revision", "-2", "report.pdf"}))
+			So(err, ShouldBeNil)
+			So(storageOpts.Revision, ShouldEqual, "-2")
+			So(args, ShouldResemble, []string{"get", "report.pdf"})
+		})
+
+		Convey("other arguments should be left alone", func() {
+			args := []string{"get", "--revision", "1", "-v", "--revision=-1", "--local", "-x"}
+			So(JoinRevisionArg(args), ShouldResemble, args)
+			So(JoinRevisionArg([]string{"get", "--revision", "-v"}), ShouldResemble, []string{"get", "--revision", "-v"})
+		})
+	})
+}
+
+// Test that retention periods for 'prune' are parsed correctly
+func TestParseRetentionPeriod(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing a retention period", t, func() {
+		Convey("days and weeks should be supported", func() {
+			period, err := parseRetentionPeriod("30d")
+			So(err, ShouldBeNil)
+			So(period, ShouldEqual, 30*24*time.Hour)
+
+			period, err = parseRetentionPeriod("2w")
+			So(err, ShouldBeNil)
+			So(period, ShouldEqual, 14*24*time.Hour)
+		})
+
+		Convey("standard durations should be supported", func() {
+			period, err := parseRetentionPeriod("36h")
+			So(err, ShouldBeNil)
+			So(period, ShouldEqual, 36*time.Hour)
+		})
+
+		Convey("invalid or non-positive periods should error", func() {
+			for _, period := range []string{"", "d", "abc", "-3d", "0h", "1.5d"} {
+				_, err := parseRetentionPeriod(period)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+// Test that copies report their progress
+func TestCopyWithProgress(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When copying through a progress reader", t, func() {
+		data := strings.Repeat("gridfs", 1000)
+		progressor := progress.NewCounter(int64(len(data)))
+		out := &bytes.Buffer{}
+		n, err := io.Copy(out, &progressReader{strings.NewReader(data), progressor})
+
+		Convey("every byte should be copied and counted", func() {
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, len(data))
+			So(out.String(), ShouldEqual, data)
+			So(progressor.Get(), ShouldEqual, len(data))
+		})
+	})
+
+	Convey("When copying with a progress bar", t, func() {
+		out := &bytes.Buffer{}
+		n, err := copyWithProgress("file.txt", out, strings.NewReader("contents"), 0)
+
+		Convey("the copy should complete even without a known size", func() {
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 8)
+			So(out.String(), ShouldEqual, "contents")
+		})
 	})
 }
 
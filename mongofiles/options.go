@@ -8,10 +8,14 @@ Possible commands include:
 	list      - list all files; 'filename' is an optional prefix which listed filenames must begin with
 	search    - search all files; 'filename' is a substring which listed filenames must contain
 	put       - add a file with filename 'filename'
-	get       - get a file with filename 'filename'
+	get       - get a file with filename 'filename'; the newest revision unless --revision is given
 	get_id    - get a file with the given '_id'
-	delete    - delete all files with filename 'filename'
+	revisions - list the revisions of files with filename 'filename', oldest first
+	delete    - delete all files with filename 'filename', or only older revisions with --keepRevisions
 	delete_id - delete a file with the given '_id'
+	prune     - delete all files uploaded longer ago than --olderThan, optionally restricted by --query
+	batch     - run the put, get, get_id, delete and delete_id commands read from standard input, one per line
+	            with its filename or _id and, for put, get and get_id, an optional local filename, e.g. 'put report.pdf /tmp/report.pdf'
 
 See http://docs.mongodb.org/manual/reference/program/mongofiles/ for more information.`
 
@@ -32,6 +36,25 @@ type StorageOptions struct {
 	// GridFSPrefix specifies what GridFS prefix to use; defaults to 'fs'
 	GridFSPrefix string `long:"prefix" default:"fs" default-mask:"-" description:"GridFS prefix to use (default is 'fs')"`
 
+	// 'Revision' selects the revision of a file that 'get' retrieves, when
+	// several files share its name
+	Revision string `long:"revision" value-name:"<n>" description:"revision of the file to get: 0 is the original, 1 the first revision, and so on, while -1 is the newest, -2 the one before it, and so on (defaults to -1)"`
+
+	// 'KeepRevisions' makes 'delete' keep this many of the newest revisions
+	KeepRevisions int `long:"keepRevisions" value-name:"<n>" description:"delete all but the newest <n> revisions of the file"`
+
+	// 'OlderThan' is the retention period used by 'prune', e.g. 30d, 2w or 12h
+	OlderThan string `long:"olderThan" description:"retention period for prune; files uploaded before now minus this period are deleted, e.g. 30d, 2w, 12h"`
+
+	// 'Query' optionally restricts the files considered by 'prune'
+	Query string `long:"query" short:"q" description:"query filter on files for prune, as a JSON string, e.g., '{contentType:\"text/plain\"}'"`
+
+	// if set, 'DryRun' lists the files 'prune' would delete without deleting them
+	DryRun bool `long:"dryRun" description:"list the files prune would delete without deleting them"`
+
+	// 'NumParallelCommands' is the number of commands 'batch' runs at once
+	NumParallelCommands int `long:"numParallelCommands" short:"j" value-name:"<count>" default:"4" default-mask:"-" description:"number of commands batch runs in parallel (default 4)"`
+
 	// Specifies the write concern for each write operation that mongofiles writes to the target database.
 	// By default, mongofiles waits for a majority of members from the replica set to respond before returning.
 	WriteConcern string `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
@@ -0,0 +1,113 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"strings"
+)
+
+// errNamespaceExists is the code of the error of creating a collection that
+// already exists.
+const errNamespaceExists = 48
+
+// parseCollectionOptions returns the options to create the target
+// collection with, from --cappedSize, --cappedMax, --collation and
+// --validatorFile, or nil if none were given.
+func (imp *MongoImport) parseCollectionOptions() (bson.D, error) {
+	options := bson.D{}
+	if imp.IngestOptions.CappedSize != "" {
+		size, err := text.ParseByteAmount(imp.IngestOptions.CappedSize)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --cappedSize: %v", err)
+		}
+		if size <= 0 {
+			return nil, fmt.Errorf("--cappedSize must be greater than zero")
+		}
+		options = append(options, bson.DocElem{"capped", true}, bson.DocElem{"size", size})
+		if imp.IngestOptions.CappedMax < 0 {
+			return nil, fmt.Errorf("--cappedMax can not be negative")
+		}
+		if imp.IngestOptions.CappedMax > 0 {
+			options = append(options, bson.DocElem{"max", imp.IngestOptions.CappedMax})
+		}
+	} else if imp.IngestOptions.CappedMax != 0 {
+		return nil, fmt.Errorf("--cappedMax requires --cappedSize")
+	}
+
+	if imp.IngestOptions.Collation != "" {
+		collation, err := parseJSONOption([]byte(imp.IngestOptions.Collation))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --collation '%v': %v", imp.IngestOptions.Collation, err)
+		}
+		options = append(options, bson.DocElem{"collation", collation})
+	}
+
+	if imp.IngestOptions.ValidatorFile != "" {
+		data, err := ioutil.ReadFile(imp.IngestOptions.ValidatorFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading --validatorFile: %v", err)
+		}
+		validator, err := parseJSONOption(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validator in %v: %v", imp.IngestOptions.ValidatorFile, err)
+		}
+		options = append(options, bson.DocElem{"validator", validator})
+	}
+
+	if len(options) == 0 {
+		return nil, nil
+	}
+	return options, nil
+}
+
+// parseJSONOption parses a JSON document, which may use extended JSON such
+// as {"$date": ...}, keeping the order of its fields.
+func parseJSONOption(data []byte) (bson.D, error) {
+	document, err := json.UnmarshalBsonD(data)
+	if err != nil {
+		return nil, err
+	}
+	return bsonutil.GetExtendedBsonD(document)
+}
+
+// createCollection creates the target collection with the options given on
+// the command line, unless it already exists, in which case it is imported
+// into as it is.
+func (imp *MongoImport) createCollection(session *mgo.Session) error {
+	if len(imp.createOptions) == 0 {
+		return nil
+	}
+	command := append(bson.D{{"create", imp.ToolOptions.Collection}}, imp.createOptions...)
+	log.Logf(log.DebugLow, "creating collection %v.%v: %v",
+		imp.ToolOptions.DB, imp.ToolOptions.Collection, command)
+	err := session.DB(imp.ToolOptions.DB).Run(command, &bson.M{})
+	if isNamespaceExists(err) {
+		log.Logf(log.Always, "collection %v.%v already exists; importing into it without the "+
+			"given collection options", imp.ToolOptions.DB, imp.ToolOptions.Collection)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error creating collection %v.%v: %v", imp.ToolOptions.DB, imp.ToolOptions.Collection, err)
+	}
+	log.Logf(log.Info, "created collection %v.%v with the given options",
+		imp.ToolOptions.DB, imp.ToolOptions.Collection)
+	return nil
+}
+
+// isNamespaceExists returns true if the error is that of creating a
+// collection that already exists.
+func isNamespaceExists(err error) bool {
+	if err == nil {
+		return false
+	}
+	if queryErr, ok := err.(*mgo.QueryError); ok && queryErr.Code == errNamespaceExists {
+		return true
+	}
+	return strings.Contains(err.Error(), "already exists")
+}
@@ -0,0 +1,85 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseCollectionOptions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With collection options given on the command line", t, func() {
+		imp := &MongoImport{IngestOptions: &IngestOptions{}}
+
+		Convey("no options should create nothing", func() {
+			options, err := imp.parseCollectionOptions()
+			So(err, ShouldBeNil)
+			So(options, ShouldBeNil)
+		})
+
+		Convey("--cappedSize and --cappedMax should make a capped collection", func() {
+			imp.IngestOptions.CappedSize = "1MB"
+			imp.IngestOptions.CappedMax = 500
+			options, err := imp.parseCollectionOptions()
+			So(err, ShouldBeNil)
+			So(options, ShouldResemble, bson.D{{"capped", true}, {"size", int64(1024 * 1024)}, {"max", int64(500)}})
+		})
+
+		Convey("--cappedMax should require --cappedSize", func() {
+			imp.IngestOptions.CappedMax = 500
+			_, err := imp.parseCollectionOptions()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("--collation should be parsed as JSON", func() {
+			imp.IngestOptions.Collation = `{locale: "fr", strength: 2}`
+			options, err := imp.parseCollectionOptions()
+			So(err, ShouldBeNil)
+			So(asMap(options), ShouldResemble, bson.M{"collation": bson.M{"locale": "fr", "strength": 2}})
+
+			imp.IngestOptions.Collation = `{locale: `
+			_, err = imp.parseCollectionOptions()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("--validatorFile should be read as a JSON document", func() {
+			file, err := ioutil.TempFile("", "mongoimport_validator_test")
+			So(err, ShouldBeNil)
+			Reset(func() {
+				os.Remove(file.Name())
+			})
+			_, err = file.WriteString(`{"$jsonSchema": {"required": ["name"]}}`)
+			So(err, ShouldBeNil)
+			So(file.Close(), ShouldBeNil)
+
+			imp.IngestOptions.ValidatorFile = file.Name()
+			options, err := imp.parseCollectionOptions()
+			So(err, ShouldBeNil)
+			So(asMap(options), ShouldResemble, bson.M{
+				"validator": bson.M{"$jsonSchema": bson.M{"required": []interface{}{"name"}}}})
+		})
+	})
+
+	Convey("Creating a collection that already exists should be recognized", t, func() {
+		So(isNamespaceExists(&mgo.QueryError{Code: errNamespaceExists}), ShouldBeTrue)
+		So(isNamespaceExists(fmt.Errorf("collection already exists")), ShouldBeTrue)
+		So(isNamespaceExists(fmt.Errorf("not authorized")), ShouldBeFalse)
+		So(isNamespaceExists(nil), ShouldBeFalse)
+	})
+}
+
+// asMap returns the document as read back from its BSON.
+func asMap(document bson.D) bson.M {
+	data, err := bson.Marshal(document)
+	So(err, ShouldBeNil)
+	m := bson.M{}
+	So(bson.Unmarshal(data, &m), ShouldBeNil)
+	return m
+}
@@ -22,6 +22,12 @@ type Converter interface {
 	Convert() (document bson.D, err error)
 }
 
+// An indexedConverter is a Converter that knows the index, from 0, of the
+// record it converts in the input.
+type indexedConverter interface {
+	recordIndex() uint64
+}
+
 // An importWorker reads Converter from the unprocessedDataChan channel and
 // sends processed BSON documents on the processedDocumentChan channel
 type importWorker struct {
@@ -33,6 +39,9 @@ type importWorker struct {
 
 	// used to synchronise all worker goroutines
 	tomb *tomb.Tomb
+
+	// adds provenance fields to each processed document
+	metadata *importMetadata
 }
 
 // an interface for tracking the number of bytes, which is used in mongoimport to feed
@@ -239,7 +248,8 @@ func setNestedValue(key string, value interface{}, document *bson.D) {
 // channel in parallel and then sends over the processed data to the outputChan
 // channel - either in sequence or concurrently (depending on the value of
 // ordered) - in which the data was received
-func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, outputChan chan bson.D) (retErr error) {
+func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, outputChan chan bson.D,
+	metadata *importMetadata) (retErr error) {
 	if numDecoders == 0 {
 		numDecoders = 1
 	}
@@ -257,7 +267,8 @@ func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, out
 		iw := &importWorker{
 			unprocessedDataChan:   inChan,
 			processedDocumentChan: outChan,
-			tomb: importTomb,
+			tomb:                  importTomb,
+			metadata:              metadata,
 		}
 		importWorkers = append(importWorkers, iw)
 		wg.Add(1)
@@ -381,6 +392,9 @@ func (iw *importWorker) processDocuments(ordered bool) error {
 			if err != nil {
 				return err
 			}
+			if indexed, ok := converter.(indexedConverter); ok {
+				document = iw.metadata.annotate(document, indexed.recordIndex())
+			}
 			iw.processedDocumentChan <- document
 		case <-iw.tomb.Dying():
 			return nil
@@ -294,6 +294,10 @@ func TestRemoveBlankFields(t *testing.T) {
 			}
 			So(removeBlankFields(bsonDocument), ShouldResemble, expectedDocument)
 		})
+		Convey("null values should be kept", func() {
+			bsonDocument := bson.D{bson.DocElem{"a", nil}, bson.DocElem{"b", ""}}
+			So(removeBlankFields(bsonDocument), ShouldResemble, bson.D{bson.DocElem{"a", nil}})
+		})
 	})
 }
 
@@ -492,7 +496,7 @@ func TestStreamDocuments(t *testing.T) {
 				inputChannel <- csvConverter
 			}
 			close(inputChannel)
-			So(streamDocuments(true, 3, inputChannel, outputChannel), ShouldBeNil)
+			So(streamDocuments(true, 3, inputChannel, outputChannel, nil), ShouldBeNil)
 
 			// ensure documents are streamed out and processed in the correct manner
 			for _, expectedDocument := range expectedDocuments {
@@ -510,7 +514,7 @@ func TestStreamDocuments(t *testing.T) {
 			close(inputChannel)
 
 			// ensure that an error is returned on the error channel
-			So(streamDocuments(true, 3, inputChannel, outputChannel), ShouldNotBeNil)
+			So(streamDocuments(true, 3, inputChannel, outputChannel, nil), ShouldNotBeNil)
 		})
 	})
 }
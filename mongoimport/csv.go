@@ -25,6 +25,9 @@ type CSVInputReader struct {
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
 
+	// metadata adds provenance fields to each document, with --addImportMetadata
+	metadata *importMetadata
+
 	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
 	sizeTracker
 }
@@ -96,7 +99,7 @@ func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 	}()
 
 	go func() {
-		csvErrChan <- streamDocuments(ordered, r.numDecoders, csvRecordChan, readDocs)
+		csvErrChan <- streamDocuments(ordered, r.numDecoders, csvRecordChan, readDocs, r.metadata)
 	}()
 
 	return channelQuorumError(csvErrChan, 2)
@@ -111,3 +114,8 @@ func (c CSVConverter) Convert() (bson.D, error) {
 		c.index,
 	)
 }
+
+// recordIndex implements the indexedConverter interface.
+func (c CSVConverter) recordIndex() uint64 {
+	return c.index
+}
@@ -1,6 +1,8 @@
 package mongoimport
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
@@ -21,6 +23,10 @@ type JSONInputReader struct {
 	// decoder is used to read the 	next valid JSON documents from the input source
 	decoder *json.Decoder
 
+	// lineReader reads line-delimited JSON, until a line that isn't a whole
+	// document makes the rest of the input go through the decoder
+	lineReader *bufio.Reader
+
 	// numProcessed indicates the number of JSON documents processed
 	numProcessed uint64
 
@@ -47,6 +53,9 @@ type JSONInputReader struct {
 
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
+
+	// metadata adds provenance fields to each document, with --addImportMetadata
+	metadata *importMetadata
 }
 
 // JSONConverter implements the Converter interface for JSON input.
@@ -55,6 +64,9 @@ type JSONConverter struct {
 	index uint64
 }
 
+// jsonLineBufferSize is the size of the buffer reading line-delimited JSON.
+const jsonLineBufferSize = 1024 * 1024
+
 var (
 	// ErrNoOpeningBracket means that the input source did not contain any
 	// opening brace - returned only if --jsonArray is passed in.
@@ -71,14 +83,19 @@ var (
 // configured to read data to the given io.Reader.
 func NewJSONInputReader(isArray bool, in io.Reader, numDecoders int) *JSONInputReader {
 	szCount := &sizeTrackingReader{in, 0}
-	return &JSONInputReader{
+	r := &JSONInputReader{
 		isArray:            isArray,
 		sizeTracker:        szCount,
-		decoder:            json.NewDecoder(szCount),
 		readOpeningBracket: false,
 		bytesFromReader:    make([]byte, 1),
 		numDecoders:        numDecoders,
 	}
+	if isArray {
+		r.decoder = json.NewDecoder(szCount)
+	} else {
+		r.lineReader = bufio.NewReaderSize(szCount, jsonLineBufferSize)
+	}
+	return r
 }
 
 // ReadAndValidateHeader is a no-op for JSON imports; always returns nil.
@@ -96,44 +113,120 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 	// begin reading from source
 	go func() {
 		var err error
-		for {
-			if r.isArray {
-				if err = r.readJSONArraySeparator(); err != nil {
-					close(rawChan)
-					if err == io.EOF {
-						jsonErrChan <- nil
-					} else {
-						r.numProcessed++
-						jsonErrChan <- fmt.Errorf("error reading separator after document #%v: %v", r.numProcessed, err)
-					}
-					return
-				}
-			}
-			rawBytes, err := r.decoder.ScanObject()
-			if err != nil {
-				close(rawChan)
+		if r.isArray {
+			err = r.scanObjects(rawChan)
+		} else {
+			err = r.readLines(rawChan)
+		}
+		close(rawChan)
+		jsonErrChan <- err
+	}()
+
+	// begin processing read bytes
+	go func() {
+		jsonErrChan <- streamDocuments(ordered, r.numDecoders, rawChan, readChan, r.metadata)
+	}()
+
+	return channelQuorumError(jsonErrChan, 2)
+}
+
+// scanObjects sends the documents read by the decoder on rawChan, until the
+// end of the input.
+func (r *JSONInputReader) scanObjects(rawChan chan<- Converter) error {
+	for {
+		if r.isArray {
+			if err := r.readJSONArraySeparator(); err != nil {
 				if err == io.EOF {
-					jsonErrChan <- nil
-				} else {
-					r.numProcessed++
-					jsonErrChan <- fmt.Errorf("error processing document #%v: %v", r.numProcessed, err)
+					return nil
 				}
-				return
+				r.numProcessed++
+				return fmt.Errorf("error reading separator after document #%v: %v", r.numProcessed, err)
 			}
+		}
+		rawBytes, err := r.decoder.ScanObject()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			r.numProcessed++
+			return fmt.Errorf("error processing document #%v: %v", r.numProcessed, err)
+		}
+		rawChan <- JSONConverter{
+			data:  rawBytes,
+			index: r.numProcessed,
+		}
+		r.numProcessed++
+	}
+}
+
+// readLines sends the documents of line-delimited JSON on rawChan. Lines
+// holding a single whole document, as mongoexport writes them, are split
+// off with a quick scan and left to be parsed by the decoding goroutines,
+// in parallel. From the first line that doesn't, such as the start of a
+// document spread over several lines, the rest of the input is scanned by
+// the decoder.
+func (r *JSONInputReader) readLines(rawChan chan<- Converter) error {
+	for {
+		line, err := r.lineReader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			r.numProcessed++
+			return fmt.Errorf("error processing document #%v: %v", r.numProcessed, err)
+		}
+		document := bytes.TrimSpace(line)
+		if len(document) > 0 && !isWholeObject(document) {
+			r.decoder = json.NewDecoder(io.MultiReader(bytes.NewReader(line), r.lineReader))
+			return r.scanObjects(rawChan)
+		}
+		if len(document) > 0 {
 			rawChan <- JSONConverter{
-				data:  rawBytes,
+				data:  document,
 				index: r.numProcessed,
 			}
 			r.numProcessed++
 		}
-	}()
-
-	// begin processing read bytes
-	go func() {
-		jsonErrChan <- streamDocuments(ordered, r.numDecoders, rawChan, readChan)
-	}()
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
 
-	return channelQuorumError(jsonErrChan, 2)
+// isWholeObject returns true if the line is a single object: it opens with
+// a brace that is closed by its last byte, skipping over quoted strings.
+// Lines with a slash outside strings, which starts a regular expression
+// whose pattern could hold anything, are left to the decoder. The object
+// is only checked for its bounds; the decoding goroutines check the rest.
+func isWholeObject(line []byte) bool {
+	if len(line) < 2 || line[0] != '{' {
+		return false
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if quote != 0 {
+			switch c {
+			case '\\':
+				i++
+			case quote:
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i == len(line)-1
+			}
+		case '/':
+			return false
+		}
+	}
+	return false
 }
 
 // Convert implements the Converter interface for JSON input. It converts a
@@ -153,6 +246,11 @@ func (c JSONConverter) Convert() (bson.D, error) {
 	return bsonD, nil
 }
 
+// recordIndex implements the indexedConverter interface.
+func (c JSONConverter) recordIndex() uint64 {
+	return c.index
+}
+
 // readJSONArraySeparator is a helper method used to process JSON arrays. It is
 // used to read any of the valid separators for a JSON array and flag invalid
 // characters.
@@ -145,11 +145,47 @@ func TestJSONPlainStreamDocument(t *testing.T) {
 			}
 		})
 
+		Convey("documents spread over several lines should be imported "+
+			"after line-delimited ones", func() {
+			contents := "{\"a\": 1}\n{\"b\": /x{2}\"/}\n{\"c\": {\n  \"d\": 2\n}}\n{\"e\": 3}\n"
+			r := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 2)
+			docChan := make(chan bson.D, 4)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan)[0].Name, ShouldEqual, "a")
+			So((<-docChan)[0].Name, ShouldEqual, "b")
+			So((<-docChan)[0].Name, ShouldEqual, "c")
+			So((<-docChan)[0].Name, ShouldEqual, "e")
+		})
+
+		Convey("an invalid line should return an error", func() {
+			contents := "{\"a\": 1}\n{\"b\": }\n"
+			r := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
+			So(r.StreamDocument(true, make(chan bson.D, 2)), ShouldNotBeNil)
+		})
+
 		Reset(func() {
 			jsonFile.Close()
 			fileHandle.Close()
 		})
 	})
+
+	Convey("Lines should be told whole objects by their bounds", t, func() {
+		for line, whole := range map[string]bool{
+			`{"a": 1}`:                true,
+			`{"a": {"b": [1, {}]}}`:   true,
+			`{"a": "}{"}`:             true,
+			`{'a': '\'}'}`:            true,
+			`{"a": "\"}"}`:            true,
+			`{"a": ObjectId("5a9b")}`: true,
+			`{"a": 1}{"b": 2}`:        false,
+			`{"a": {`:                 false,
+			`{"a": /}/}`:              false,
+			`[{"a": 1}]`:              false,
+			`1`:                       false,
+		} {
+			So(isWholeObject([]byte(line)), ShouldEqual, whole)
+		}
+	})
 }
 
 func TestReadJSONArraySeparator(t *testing.T) {
@@ -0,0 +1,141 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// Kinds of provenance field added by --addImportMetadata.
+const (
+	metadataTime  = "time"
+	metadataFile  = "file"
+	metadataLine  = "line"
+	metadataBatch = "batch"
+)
+
+// defaultMetadataFields names the field each kind of provenance is added
+// in, unless --addImportMetadata names another.
+var defaultMetadataFields = map[string]string{
+	metadataTime:  "_importedAt",
+	metadataFile:  "_importFile",
+	metadataLine:  "_importLine",
+	metadataBatch: "_importBatch",
+}
+
+// metadataField is a provenance field added to every imported document.
+type metadataField struct {
+	kind string
+	name string
+}
+
+// importMetadata adds provenance fields to each imported document, for
+// --addImportMetadata. A nil importMetadata adds nothing.
+type importMetadata struct {
+	fields []metadataField
+
+	// the source file, and the batch id shared by every document imported
+	file    string
+	batchID bson.ObjectId
+
+	// lineOffset is added to the index of each record, from 0, to give its
+	// line: 1, and 1 more for the --headerline
+	lineOffset uint64
+
+	// now returns the import time of a document
+	now func() time.Time
+}
+
+// parseImportMetadata parses an --addImportMetadata list of kinds of
+// provenance, each optionally followed by the field to add it in, such as
+// "time=importedAt,file,line".
+func parseImportMetadata(spec string) ([]metadataField, error) {
+	fields := []metadataField{}
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		kind, name := entry, ""
+		if i := strings.Index(entry, "="); i >= 0 {
+			kind, name = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+			if name == "" {
+				return nil, fmt.Errorf("invalid --addImportMetadata entry '%v': missing field name", entry)
+			}
+		}
+		defaultName, ok := defaultMetadataFields[kind]
+		if !ok {
+			return nil, fmt.Errorf("invalid --addImportMetadata entry '%v': expected time, file, line or batch", entry)
+		}
+		if name == "" {
+			name = defaultName
+		}
+		if strings.HasPrefix(name, "$") || strings.Contains(name, ".") {
+			return nil, fmt.Errorf("invalid --addImportMetadata field '%v': cannot contain '.' or start with '$'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("--addImportMetadata field '%v' given more than once", name)
+		}
+		seen[name] = true
+		fields = append(fields, metadataField{kind: kind, name: name})
+	}
+	return fields, nil
+}
+
+// newImportMetadata sets up the --addImportMetadata fields for this import.
+func (imp *MongoImport) newImportMetadata() (*importMetadata, error) {
+	fields, err := parseImportMetadata(imp.IngestOptions.AddImportMetadata)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &importMetadata{
+		fields:     fields,
+		file:       imp.InputOptions.File,
+		batchID:    bson.NewObjectId(),
+		lineOffset: 1,
+		now:        time.Now,
+	}
+	if metadata.file == "" {
+		metadata.file = "stdin"
+	}
+	if imp.InputOptions.HeaderLine && (imp.InputOptions.Type == CSV || imp.InputOptions.Type == TSV) {
+		metadata.lineOffset++
+	}
+	log.Logf(log.Always, "adding import metadata to each document, with batch id %v", metadata.batchID.Hex())
+	return metadata, nil
+}
+
+// annotate adds the provenance fields to the document converted from the
+// record at the given index of the input, replacing any fields of the same
+// names.
+func (metadata *importMetadata) annotate(document bson.D, index uint64) bson.D {
+	if metadata == nil {
+		return document
+	}
+	for _, field := range metadata.fields {
+		var value interface{}
+		switch field.kind {
+		case metadataTime:
+			value = metadata.now()
+		case metadataFile:
+			value = metadata.file
+		case metadataLine:
+			value = int64(index + metadata.lineOffset)
+		case metadataBatch:
+			value = metadata.batchID
+		}
+		document = setField(document, field.name, value)
+	}
+	return document
+}
+
+// setField sets a top-level field of a document, replacing it if present.
+func setField(document bson.D, name string, value interface{}) bson.D {
+	for i := range document {
+		if document[i].Name == name {
+			document[i].Value = value
+			return document
+		}
+	}
+	return append(document, bson.DocElem{Name: name, Value: value})
+}
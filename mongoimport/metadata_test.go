@@ -0,0 +1,79 @@
+package mongoimport
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func TestImportMetadata(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --addImportMetadata", t, func() {
+		Convey("every kind should be added in its default field", func() {
+			fields, err := parseImportMetadata("time,file,line,batch")
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, []metadataField{
+				{metadataTime, "_importedAt"},
+				{metadataFile, "_importFile"},
+				{metadataLine, "_importLine"},
+				{metadataBatch, "_importBatch"},
+			})
+		})
+
+		Convey("fields may be renamed", func() {
+			fields, err := parseImportMetadata("time=loadedAt, file")
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, []metadataField{{metadataTime, "loadedAt"}, {metadataFile, "_importFile"}})
+		})
+
+		Convey("unknown kinds and invalid or repeated fields should be rejected", func() {
+			for _, spec := range []string{"size", "time=", "time=a.b", "file=$f", "time=x,file=x"} {
+				_, err := parseImportMetadata(spec)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("With import metadata for a CSV file with a header line", t, func() {
+		importedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		batchID := bson.NewObjectId()
+		metadata := &importMetadata{
+			fields:     []metadataField{{metadataFile, "src"}, {metadataLine, "line"}, {metadataBatch, "batch"}, {metadataTime, "at"}},
+			file:       "people.csv",
+			batchID:    batchID,
+			lineOffset: 2,
+			now:        func() time.Time { return importedAt },
+		}
+
+		Convey("each document should be annotated with its provenance", func() {
+			document := metadata.annotate(bson.D{{"name", "ada"}, {"src", "old"}}, 4)
+			So(document, ShouldResemble, bson.D{
+				{"name", "ada"},
+				{"src", "people.csv"},
+				{"line", int64(6)},
+				{"batch", batchID},
+				{"at", importedAt},
+			})
+		})
+
+		Convey("documents streamed through the import workers should be annotated", func() {
+			inputChannel := make(chan Converter, 1)
+			outputChannel := make(chan bson.D, 1)
+			inputChannel <- CSVConverter{fields: []string{"name"}, data: []string{"ada"}, index: 0}
+			close(inputChannel)
+			So(streamDocuments(true, 1, inputChannel, outputChannel, metadata), ShouldBeNil)
+			document := <-outputChannel
+			So(document[0], ShouldResemble, bson.DocElem{"name", "ada"})
+			So(document[2], ShouldResemble, bson.DocElem{"line", int64(2)})
+		})
+	})
+
+	Convey("A nil importMetadata should add nothing", t, func() {
+		var metadata *importMetadata
+		So(metadata.annotate(bson.D{{"a", 1}}, 0), ShouldResemble, bson.D{{"a", 1}})
+	})
+}
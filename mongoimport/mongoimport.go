@@ -1,4 +1,4 @@
-// Package mongoimport allows importing content from a JSON, CSV, or TSV into a MongoDB instance.
+// Package mongoimport allows importing content from a JSON, CSV, TSV, or SQL dump into a MongoDB instance.
 package mongoimport
 
 import (
@@ -7,7 +7,6 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
-	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -17,6 +16,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Input format types accepted by mongoimport.
@@ -24,6 +24,7 @@ const (
 	CSV  = "csv"
 	TSV  = "tsv"
 	JSON = "json"
+	SQL  = "sql"
 )
 
 const (
@@ -65,6 +66,18 @@ type MongoImport struct {
 
 	// type of node the SessionProvider is connected to
 	nodeType db.NodeType
+
+	// handles documents over the maximum BSON document size
+	sizeGuard *db.SizeGuard
+
+	// adds provenance fields to each document, with --addImportMetadata
+	metadata *importMetadata
+
+	// options to create the target collection with, if it doesn't exist
+	createOptions bson.D
+
+	// outcome of the documents written, for the final summary
+	summary summaryCollector
 }
 
 type InputReader interface {
@@ -101,7 +114,8 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 	} else {
 		if !(imp.InputOptions.Type == TSV ||
 			imp.InputOptions.Type == JSON ||
-			imp.InputOptions.Type == CSV) {
+			imp.InputOptions.Type == CSV ||
+			imp.InputOptions.Type == SQL) {
 			return fmt.Errorf("unknown type %v", imp.InputOptions.Type)
 		}
 	}
@@ -130,6 +144,15 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 				return fmt.Errorf("incompatible options: --fieldFile and --headerline")
 			}
 		}
+	} else if imp.InputOptions.Type == SQL {
+		// fields are optional for SQL dumps, which carry their own column names
+		if imp.InputOptions.HeaderLine {
+			return fmt.Errorf("can not use --headerline when input type is SQL")
+		}
+		if imp.InputOptions.Fields != nil &&
+			imp.InputOptions.FieldFile != nil {
+			return fmt.Errorf("incompatible options: --fields and --fieldFile")
+		}
 	} else {
 		// input type is JSON
 		if imp.InputOptions.HeaderLine {
@@ -146,6 +169,10 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		}
 	}
 
+	if imp.InputOptions.Table != "" && imp.InputOptions.Type != SQL {
+		return fmt.Errorf("can only use --table when input type is SQL")
+	}
+
 	if imp.IngestOptions.UpsertFields != "" {
 		imp.IngestOptions.Upsert = true
 		imp.upsertFields = strings.Split(imp.IngestOptions.UpsertFields, ",")
@@ -156,11 +183,30 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		imp.upsertFields = []string{"_id"}
 	}
 
+	imp.sizeGuard, err = db.NewSizeGuard(imp.IngestOptions.OversizedDocs, imp.IngestOptions.TruncateFields)
+	if err != nil {
+		return err
+	}
+
+	if imp.IngestOptions.AddImportMetadata != "" {
+		if imp.metadata, err = imp.newImportMetadata(); err != nil {
+			return err
+		}
+	}
+
 	if imp.IngestOptions.Upsert {
 		imp.IngestOptions.MaintainInsertionOrder = true
 		log.Logf(log.Info, "using upsert fields: %v", imp.upsertFields)
 	}
 
+	if imp.createOptions, err = imp.parseCollectionOptions(); err != nil {
+		return err
+	}
+	if imp.IngestOptions.CappedSize != "" {
+		// capped collections keep their documents in insertion order
+		imp.IngestOptions.MaintainInsertionOrder = true
+	}
+
 	// set the number of decoding workers to use for imports
 	if imp.ToolOptions.NumDecodingWorkers <= 0 {
 		imp.ToolOptions.NumDecodingWorkers = imp.ToolOptions.MaxProcs
@@ -202,6 +248,18 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		}
 	}
 
+	if isS3Path(imp.InputOptions.File) {
+		if _, _, err := parseS3Path(imp.InputOptions.File); err != nil {
+			return err
+		}
+		if imp.InputOptions.S3PartSizeMB <= 0 {
+			return fmt.Errorf("--s3PartSize must be greater than 0")
+		}
+		if imp.InputOptions.S3Concurrency <= 0 {
+			return fmt.Errorf("--s3Concurrency must be greater than 0")
+		}
+	}
+
 	// ensure we have a valid string to use for the collection
 	if imp.ToolOptions.Collection == "" {
 		log.Logf(log.Always, "no collection specified")
@@ -224,6 +282,15 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 // returns a progress.Progressor which can be used to track progress if the
 // reader supports it.
 func (imp *MongoImport) getSourceReader() (io.ReadCloser, int64, error) {
+	if isS3Path(imp.InputOptions.File) {
+		source, size, err := imp.openS3Object(imp.InputOptions.File)
+		if err != nil {
+			return nil, -1, err
+		}
+		log.Logf(log.Info, "object size: %v bytes", size)
+		return source, size, nil
+	}
+
 	if imp.InputOptions.File != "" {
 		file, err := os.Open(util.ToUniversalPath(imp.InputOptions.File))
 		if err != nil {
@@ -282,9 +349,14 @@ func (imp *MongoImport) ImportDocuments() (uint64, error) {
 		BarLength: progressBarLength,
 		IsBytes:   true,
 	}
+	imp.summary.start = time.Now()
 	bar.Start()
-	defer bar.Stop()
-	return imp.importDocuments(inputReader)
+	numImported, err := imp.importDocuments(inputReader)
+	bar.Stop()
+	if summaryErr := imp.reportSummary(); err == nil {
+		err = summaryErr
+	}
+	return numImported, err
 }
 
 // importDocuments is a helper to ImportDocuments and does all the ingestion
@@ -335,6 +407,10 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported ui
 		}
 	}
 
+	if err = imp.createCollection(session); err != nil {
+		return 0, err
+	}
+
 	readDocs := make(chan bson.D, workerBufferSize)
 	processingErrChan := make(chan error)
 	ordered := imp.IngestOptions.MaintainInsertionOrder
@@ -349,7 +425,9 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported ui
 		processingErrChan <- imp.ingestDocuments(readDocs)
 	}()
 
-	return imp.insertionCount, channelQuorumError(processingErrChan, 2)
+	err = channelQuorumError(processingErrChan, 2)
+	imp.sizeGuard.LogSummary()
+	return imp.insertionCount, err
 }
 
 // ingestDocuments accepts a channel from which it reads documents to be inserted
@@ -446,13 +524,21 @@ readLoop:
 			// ignore blank fields if specified
 			if ignoreBlanks {
 				document = removeBlankFields(document)
+				if imp.InputOptions.Type == SQL {
+					document = removeNullFields(document)
+				}
+			}
+			if !imp.IngestOptions.Upsert {
+				document = withID(document)
 			}
 			if documentBytes, err = bson.Marshal(document); err != nil {
 				return err
 			}
-			if len(documentBytes) > maxBSONSize {
-				log.Logf(log.Always, "warning: attempting to insert document with size %v (exceeds %v limit)",
-					text.FormatByteAmount(int64(len(documentBytes))), text.FormatByteAmount(maxBSONSize))
+			if documentBytes, err = imp.sizeGuard.Check(documentBytes, collection.FullName); err != nil {
+				return err
+			}
+			if documentBytes == nil {
+				continue
 			}
 			numMessageBytes += len(documentBytes)
 			documents = append(documents, bson.Raw{3, documentBytes})
@@ -482,11 +568,22 @@ func (imp *MongoImport) handleUpsert(documents []bson.Raw, collection *mgo.Colle
 		selector := constructUpsertDocument(imp.upsertFields, document)
 		if selector == nil {
 			err = collection.Insert(document)
+			if err == nil {
+				imp.summary.recordWrites(1, 0, 0)
+			}
 		} else {
-			_, err = collection.Upsert(selector, document)
+			var info *mgo.ChangeInfo
+			info, err = collection.Upsert(selector, document)
+			if err == nil && info != nil && info.Updated > 0 {
+				imp.summary.recordWrites(0, 0, 1)
+			} else if err == nil {
+				imp.summary.recordWrites(0, 1, 0)
+			}
 		}
 		if err == nil {
 			numInserted++
+		} else {
+			imp.summary.recordFailure(1, err)
 		}
 		if err = filterIngestError(stopOnError, err); err != nil {
 			return numInserted, err
@@ -495,6 +592,18 @@ func (imp *MongoImport) handleUpsert(documents []bson.Raw, collection *mgo.Colle
 	return numInserted, nil
 }
 
+// withID returns the document with an _id, generating an ObjectId for it if
+// it has none, as the server would, so that the documents of a failed bulk
+// insert can be told apart by their _id.
+func withID(document bson.D) bson.D {
+	for _, elem := range document {
+		if elem.Name == "_id" {
+			return document
+		}
+	}
+	return append(bson.D{{"_id", bson.NewObjectId()}}, document...)
+}
+
 // insert  performs the actual insertion/updates. If no upsert fields are
 // present in the document to be inserted, it simply inserts the documents
 // into the given collection
@@ -527,19 +636,26 @@ func (imp *MongoImport) insert(documents []bson.Raw, collection *mgo.Collection)
 	// mgo.Bulk doesn't currently implement write commands so mgo.BulkResult
 	// isn't informative
 	_, err = bulk.Run()
-
-	// TOOLS-349: Note that this count may not be entirely accurate if some
-	// ingester workers insert when another errors out.
-	//
-	// Without write commands, we can't say for sure how many documents
-	// were inserted when we use bulk inserts so we assume the entire batch
-	// insert failed if an error is returned. The result is that we may
-	// report that less documents - than were actually inserted - were
-	// inserted into the database. This will change as soon as BulkResults
-	// are supported by the driver
 	if err == nil {
 		numInserted = len(documents)
+		imp.summary.recordWrites(numInserted, 0, 0)
+		return nil
+	}
+
+	// TOOLS-349: without write commands, the error doesn't say which
+	// documents failed, so they are found by their _id in the collection.
+	// If they can't be, the entire batch is assumed to have failed, and
+	// we may report that less documents - than were actually inserted -
+	// were inserted into the database.
+	failed := documents
+	if missing, findErr := db.NotInserted(collection, documents); findErr == nil {
+		failed = missing
+	} else {
+		log.Logf(log.Info, "%v", findErr)
 	}
+	numInserted = len(documents) - len(failed)
+	imp.summary.recordWrites(numInserted, 0, 0)
+	imp.summary.recordFailure(len(failed), err)
 	return filterIngestError(stopOnError, err)
 }
 
@@ -564,9 +680,24 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 	}
 
 	if imp.InputOptions.Type == CSV {
-		return NewCSVInputReader(fields, in, imp.ToolOptions.NumDecodingWorkers), nil
+		reader := NewCSVInputReader(fields, in, imp.ToolOptions.NumDecodingWorkers)
+		reader.metadata = imp.metadata
+		return reader, nil
 	} else if imp.InputOptions.Type == TSV {
-		return NewTSVInputReader(fields, in, imp.ToolOptions.NumDecodingWorkers), nil
+		reader := NewTSVInputReader(fields, in, imp.ToolOptions.NumDecodingWorkers)
+		reader.metadata = imp.metadata
+		return reader, nil
+	} else if imp.InputOptions.Type == SQL {
+		// import the table named after the collection unless told otherwise
+		table := imp.InputOptions.Table
+		if table == "" {
+			table = imp.ToolOptions.Collection
+		}
+		reader := NewSQLInputReader(fields, table, in, imp.ToolOptions.NumDecodingWorkers)
+		reader.metadata = imp.metadata
+		return reader, nil
 	}
-	return NewJSONInputReader(imp.InputOptions.JSONArray, in, imp.ToolOptions.NumDecodingWorkers), nil
+	reader := NewJSONInputReader(imp.InputOptions.JSONArray, in, imp.ToolOptions.NumDecodingWorkers)
+	reader.metadata = imp.metadata
+	return reader, nil
 }
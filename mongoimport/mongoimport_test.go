@@ -419,6 +419,23 @@ func TestGetInputReader(t *testing.T) {
 	})
 }
 
+func TestWithID(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("Given documents to insert", t, func() {
+		Convey("one with an _id should be left as is", func() {
+			document := bson.D{{"a", 1}, {"_id", 2}}
+			So(withID(document), ShouldResemble, document)
+		})
+		Convey("one without an _id should be given an ObjectId first", func() {
+			document := withID(bson.D{{"a", 1}})
+			So(len(document), ShouldEqual, 2)
+			So(document[0].Name, ShouldEqual, "_id")
+			So(document[0].Value, ShouldHaveSameTypeAs, bson.NewObjectId())
+			So(document[1], ShouldResemble, bson.DocElem{"a", 1})
+		})
+	})
+}
+
 func TestImportDocuments(t *testing.T) {
 	testutil.VerifyTestType(t, testutil.IntegrationTestType)
 	Convey("With a mongoimport instance", t, func() {
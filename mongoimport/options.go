@@ -2,7 +2,7 @@ package mongoimport
 
 var Usage = `<options> <file>
 
-Import CSV, TSV or JSON data into MongoDB. If no file is provided, mongoimport reads from stdin.
+Import CSV, TSV or JSON data, or the rows of a table in a MySQL or Postgres SQL dump, into MongoDB. If no file is provided, mongoimport reads from stdin.
 
 See http://docs.mongodb.org/manual/reference/program/mongoimport/ for more information.`
 
@@ -15,7 +15,7 @@ type InputOptions struct {
 	FieldFile *string `long:"fieldFile" description:"file with field names - 1 per line"`
 
 	// Specifies the location and name of a file containing the data to import.
-	File string `long:"file" description:"file to import from; if not specified, stdin is used"`
+	File string `long:"file" description:"file to import from, or an s3://bucket/key object; if not specified, stdin is used"`
 
 	// Treats the input source's first line as field list (csv and tsv only).
 	HeaderLine bool `long:"headerline" description:"use first line in input source as the field list (CSV and TSV only)"`
@@ -23,8 +23,20 @@ type InputOptions struct {
 	// Indicates that the underlying input source contains a single JSON array with the documents to import.
 	JSONArray bool `long:"jsonArray" description:"treat input source as a JSON array"`
 
-	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV and TSV files.
-	Type string `long:"type" default:"json" default-mask:"-" description:"input format to import: json, csv, or tsv (defaults to 'json')"`
+	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV and TSV files, and SQL dumps.
+	Type string `long:"type" default:"json" default-mask:"-" description:"input format to import: json, csv, tsv, or sql (defaults to 'json')"`
+
+	// Specifies the table to import from a SQL dump.
+	Table string `long:"table" description:"table whose rows to import from a mysqldump INSERT or pg_dump COPY dump (SQL only; defaults to the collection name)"`
+
+	// Sets the size of the ranges an s3:// object is downloaded in.
+	S3PartSizeMB int `long:"s3PartSize" value-name:"<megabytes>" default:"8" default-mask:"-" description:"size of the parts an s3:// object is downloaded in, in megabytes (defaults to 8)"`
+
+	// Sets the number of parts of an s3:// object downloaded at once.
+	S3Concurrency int `long:"s3Concurrency" default:"4" default-mask:"-" description:"number of parts of an s3:// object to download concurrently (defaults to 4)"`
+
+	// Specifies an S3-compatible endpoint to read s3:// objects from instead of AWS.
+	S3Endpoint string `long:"s3Endpoint" description:"URL of an S3-compatible store to read s3:// objects from instead of AWS, e.g. http://localhost:9000"`
 }
 
 // Name returns a description of the InputOptions struct.
@@ -37,8 +49,8 @@ type IngestOptions struct {
 	// Drops target collection before importing.
 	Drop bool `long:"drop" description:"drop collection before inserting documents"`
 
-	// Ignores fields with empty values in CSV and TSV imports.
-	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV and TSV"`
+	// Ignores fields with empty values in CSV, TSV and SQL imports.
+	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV and TSV, and NULL or empty values in SQL"`
 
 	// Indicates that documents will be inserted in the order of their appearance in the input source.
 	MaintainInsertionOrder bool `long:"maintainInsertionOrder" description:"insert documents in the order of their appearance in the input source"`
@@ -55,6 +67,30 @@ type IngestOptions struct {
 	// Specifies a list of fields for the query portion of the upsert; defaults to _id field.
 	UpsertFields string `long:"upsertFields" description:"comma-separated fields for the query part of the upsert"`
 
+	// Adds provenance fields to every imported document.
+	AddImportMetadata string `long:"addImportMetadata" optional:"true" optional-value:"time,file,line,batch" value-name:"<kind>[=<field>][,...]" description:"add provenance fields to every imported document: time imported (_importedAt), source file (_importFile), line (_importLine; the number of the record in the input, which is its line when each record is one line) and an id shared by the documents of this import (_importBatch); give a comma-separated list of kinds to add only some, each optionally naming its field, e.g. time=loadedAt,file (defaults to all)"`
+
+	// Creates the target collection capped to the given size if it doesn't exist.
+	CappedSize string `long:"cappedSize" value-name:"<size>" description:"if the collection doesn't exist, create it as a capped collection of this size, e.g. 100MB; documents are then inserted in the order of the input"`
+
+	// Limits the number of documents in a capped collection created with --cappedSize.
+	CappedMax int64 `long:"cappedMax" value-name:"<count>" description:"with --cappedSize, the most documents the capped collection holds"`
+
+	// Creates the target collection with the given default collation if it doesn't exist.
+	Collation string `long:"collation" value-name:"<json>" description:"if the collection doesn't exist, create it with this default collation, e.g. '{locale: \"fr\", strength: 2}'"`
+
+	// Creates the target collection with the validator in the given file if it doesn't exist.
+	ValidatorFile string `long:"validatorFile" value-name:"<filename>" description:"if the collection doesn't exist, create it with the validator in this JSON file, e.g. {\"$jsonSchema\": {\"required\": [\"name\"]}}, so that documents failing it are rejected"`
+
+	// Sets how documents over the maximum BSON document size are handled.
+	OversizedDocs string `long:"oversizedDocs" description:"what to do with documents over the 16MB BSON limit: fail, skip or truncate (defaults to 'fail')" default:"fail" default-mask:"-"`
+
+	// Specifies the fields removed from oversized documents with --oversizedDocs=truncate.
+	TruncateFields string `long:"truncateFields" description:"comma-separated fields to remove, in order, from documents over the BSON limit until they fit, with --oversizedDocs=truncate"`
+
+	// Specifies a file to write the final summary of the import to, as JSON.
+	SummaryFile string `long:"summaryFile" description:"write a JSON summary of the import (documents inserted, upserted, modified, skipped and failed, failures by error and throughput) to this file"`
+
 	// Sets write concern level for write operations.
 	WriteConcern string `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
 }
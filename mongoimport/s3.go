@@ -0,0 +1,327 @@
+package mongoimport
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	s3Scheme = "s3://"
+
+	// emptyPayloadHash is the SHA256 of an empty request body, as sent with
+	// every GET and HEAD request
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// number of times a part download is attempted before giving up
+	s3PartAttempts = 3
+)
+
+// isS3Path returns true if the input file refers to an S3 object.
+func isS3Path(path string) bool {
+	return strings.HasPrefix(path, s3Scheme)
+}
+
+// parseS3Path splits an s3://bucket/key path into its bucket and key.
+func parseS3Path(path string) (string, string, error) {
+	if !isS3Path(path) {
+		return "", "", fmt.Errorf("'%v' is not an s3:// path", path)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(path, s3Scheme), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("'%v' must be of the form s3://bucket/key", path)
+	}
+	return parts[0], parts[1], nil
+}
+
+// s3Client makes signed requests to S3, or to an S3-compatible store.
+type s3Client struct {
+	// endpoint of an S3-compatible store, requested with path-style URLs;
+	// if empty, AWS's virtual-hosted style URLs are used
+	endpoint string
+
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+
+	// now returns the time requests are signed at
+	now func() time.Time
+
+	httpClient *http.Client
+}
+
+// newS3ClientFromEnv creates an s3Client using the standard AWS environment
+// variables for credentials and region.
+func newS3ClientFromEnv(endpoint string) (*s3Client, error) {
+	client := &s3Client{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		now:          time.Now,
+		httpClient:   http.DefaultClient,
+	}
+	if client.region == "" {
+		client.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if client.region == "" {
+		client.region = "us-east-1"
+	}
+	if client.accessKey == "" || client.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to read from S3")
+	}
+	return client, nil
+}
+
+// objectURL returns the URL of the given object.
+func (client *s3Client) objectURL(bucket, key string) string {
+	if client.endpoint != "" {
+		return fmt.Sprintf("%v/%v/%v", client.endpoint, bucket, escapeS3Key(key))
+	}
+	return fmt.Sprintf("https://%v.s3.%v.amazonaws.com/%v", bucket, client.region, escapeS3Key(key))
+}
+
+// escapeS3Key URI-encodes each segment of an object key as required by
+// signature version 4.
+func escapeS3Key(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(url.QueryEscape(segment), "+", "%20", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sign adds an AWS signature version 4 Authorization header to the request.
+// The host, any range and all x-amz-* headers are signed.
+func (client *s3Client) sign(req *http.Request) {
+	now := client.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%v/%v/s3/aws4_request", now.Format("20060102"), client.region)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if client.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", client.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+client.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, client.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		client.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// do sends a signed request for the object, checking that it succeeded.
+func (client *s3Client) do(method, bucket, key, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequest(method, client.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	client.sign(req)
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error reading s3://%v/%v: %v", bucket, key, resp.Status)
+	}
+	return resp, nil
+}
+
+// objectSize returns the size in bytes of the object.
+func (client *s3Client) objectSize(bucket, key string) (int64, error) {
+	resp, err := client.do("HEAD", bucket, key, "")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("size of s3://%v/%v is unknown", bucket, key)
+	}
+	return resp.ContentLength, nil
+}
+
+// getRange downloads the given bytes of the object.
+func (client *s3Client) getRange(bucket, key string, start, end int64) ([]byte, error) {
+	var err error
+	for attempt := 1; attempt <= s3PartAttempts; attempt++ {
+		var data []byte
+		data, err = client.tryGetRange(bucket, key, start, end)
+		if err == nil {
+			return data, nil
+		}
+		log.Logf(log.DebugLow, "attempt %v to download bytes %v-%v of s3://%v/%v failed: %v",
+			attempt, start, end, bucket, key, err)
+	}
+	return nil, err
+}
+
+func (client *s3Client) tryGetRange(bucket, key string, start, end int64) ([]byte, error) {
+	resp, err := client.do("GET", bucket, key, fmt.Sprintf("bytes=%v-%v", start, end))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != end-start+1 {
+		return nil, fmt.Errorf("expected %v bytes, got %v", end-start+1, len(data))
+	}
+	return data, nil
+}
+
+// s3Part is a downloaded range of an S3 object.
+type s3Part struct {
+	data []byte
+	err  error
+}
+
+// s3ObjectReader reads an S3 object by downloading ranges of it in
+// parallel. Parts are handed to the reader in order, so the object is read
+// as a single stream and the input readers see every record whole, no
+// matter where the part boundaries fall. At most 'concurrency' parts are
+// held in memory at once, so the object never needs to be staged locally.
+type s3ObjectReader struct {
+	// pending holds a channel for each part being downloaded, in order
+	pending chan chan s3Part
+
+	current   *bytes.Reader
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newS3ObjectReader starts downloading the object in parts of partSize
+// bytes, with up to concurrency downloads at once.
+func newS3ObjectReader(client *s3Client, bucket, key string, size, partSize int64, concurrency int) *s3ObjectReader {
+	reader := &s3ObjectReader{
+		pending: make(chan chan s3Part, concurrency-1),
+		current: bytes.NewReader(nil),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(reader.pending)
+		for start := int64(0); start < size; start += partSize {
+			end := start + partSize - 1
+			if end >= size {
+				end = size - 1
+			}
+			part := make(chan s3Part, 1)
+			select {
+			case reader.pending <- part:
+			case <-reader.done:
+				return
+			}
+			go func(start, end int64) {
+				data, err := client.getRange(bucket, key, start, end)
+				part <- s3Part{data, err}
+			}(start, end)
+		}
+	}()
+	return reader
+}
+
+// Read implements io.Reader, returning the object's bytes in order.
+func (reader *s3ObjectReader) Read(p []byte) (int, error) {
+	for reader.current.Len() == 0 {
+		next, ok := <-reader.pending
+		if !ok {
+			return 0, io.EOF
+		}
+		part := <-next
+		if part.err != nil {
+			return 0, part.err
+		}
+		reader.current = bytes.NewReader(part.data)
+	}
+	return reader.current.Read(p)
+}
+
+// Close stops downloading further parts.
+func (reader *s3ObjectReader) Close() error {
+	reader.closeOnce.Do(func() { close(reader.done) })
+	return nil
+}
+
+// openS3Object returns a reader for the S3 object at the given s3:// path,
+// along with its size.
+func (imp *MongoImport) openS3Object(path string) (io.ReadCloser, int64, error) {
+	bucket, key, err := parseS3Path(path)
+	if err != nil {
+		return nil, -1, err
+	}
+	client, err := newS3ClientFromEnv(imp.InputOptions.S3Endpoint)
+	if err != nil {
+		return nil, -1, err
+	}
+	size, err := client.objectSize(bucket, key)
+	if err != nil {
+		return nil, -1, err
+	}
+	partSize := int64(imp.InputOptions.S3PartSizeMB) * 1024 * 1024
+	log.Logf(log.DebugLow, "downloading s3://%v/%v in parts of %v bytes with %v concurrent downloads",
+		bucket, key, partSize, imp.InputOptions.S3Concurrency)
+	return newS3ObjectReader(client, bucket, key, size, partSize, imp.InputOptions.S3Concurrency), size, nil
+}
@@ -0,0 +1,526 @@
+package mongoimport
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	sqlCreateTablePattern = regexp.MustCompile(`(?i)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([^\s(]+)\s*\(`)
+	sqlColumnPattern      = regexp.MustCompile("^\\s+[`\"]([^`\"]+)[`\"]\\s")
+	sqlInsertPattern      = regexp.MustCompile(`(?is)^INSERT\s+(?:IGNORE\s+)?INTO\s+([^\s(]+)\s*(?:\(([^)]*)\))?\s*VALUES\s*`)
+	sqlCopyPattern        = regexp.MustCompile(`(?is)^COPY\s+([^\s(]+)\s*(?:\(([^)]*)\))?\s+FROM\s+stdin`)
+)
+
+// SQLInputReader implements the InputReader interface for SQL dumps. It reads
+// the rows of a single table from MySQL INSERT statements, as written by
+// mysqldump, and from Postgres COPY blocks in text format, as written by
+// pg_dump. Everything else in the dump is skipped.
+type SQLInputReader struct {
+	// fields is a list of field names in the BSON documents to be imported;
+	// when empty, the column names embedded in the dump are used instead
+	fields []string
+
+	// table is the name of the table whose rows are imported
+	table string
+
+	// sqlReader is the underlying reader used to read the dump
+	sqlReader *bufio.Reader
+
+	// createFields holds the column names from the table's CREATE TABLE
+	// statement, for INSERT statements without a column list
+	createFields []string
+
+	// tables records the names of all tables seen in the dump
+	tables map[string]bool
+
+	// numProcessed tracks the number of rows processed by the underlying reader
+	numProcessed uint64
+
+	// numDecoders is the number of concurrent goroutines to use for decoding
+	numDecoders int
+
+	// metadata adds provenance fields to each document, with --addImportMetadata
+	metadata *importMetadata
+
+	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
+	sizeTracker
+}
+
+// SQLConverter implements the Converter interface for rows read from a SQL dump.
+type SQLConverter struct {
+	fields []string
+	values []interface{}
+	index  uint64
+}
+
+// NewSQLInputReader returns a SQLInputReader configured to read the rows of
+// the given table from the given io.Reader.
+func NewSQLInputReader(fields []string, table string, in io.Reader, numDecoders int) *SQLInputReader {
+	szCount := &sizeTrackingReader{in, 0}
+	return &SQLInputReader{
+		fields:       fields,
+		table:        table,
+		sqlReader:    bufio.NewReader(szCount),
+		tables:       map[string]bool{},
+		numProcessed: uint64(0),
+		numDecoders:  numDecoders,
+		sizeTracker:  szCount,
+	}
+}
+
+// ReadAndValidateHeader is a no-op for SQL imports; column names are read
+// from the statements in the dump.
+func (r *SQLInputReader) ReadAndValidateHeader() error {
+	return nil
+}
+
+// StreamDocument takes a boolean indicating if the documents should be streamed
+// in read order and a channel on which to stream the documents processed from
+// the underlying reader. Returns a non-nil error if streaming fails.
+func (r *SQLInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
+	sqlRowChan := make(chan Converter, r.numDecoders)
+	sqlErrChan := make(chan error)
+
+	// begin reading from source
+	go func() {
+		err := r.readRows(sqlRowChan)
+		close(sqlRowChan)
+		sqlErrChan <- err
+	}()
+
+	// begin processing read rows
+	go func() {
+		sqlErrChan <- streamDocuments(ordered, r.numDecoders, sqlRowChan, readDocs, r.metadata)
+	}()
+
+	return channelQuorumError(sqlErrChan, 2)
+}
+
+// readRows scans the dump statement by statement, sending a converter on
+// rowChan for each row of the table being imported.
+func (r *SQLInputReader) readRows(rowChan chan<- Converter) error {
+	var inCreate, inCopy, importCopy bool
+	var copyFields []string
+	for {
+		line, err := r.sqlReader.ReadString(entryDelimiter)
+		if err != nil && (err != io.EOF || line == "") {
+			if err != io.EOF {
+				return fmt.Errorf("read error after row #%v: %v", r.numProcessed, err)
+			}
+			if inCopy {
+				return fmt.Errorf("unterminated COPY data for table %v", r.table)
+			}
+			r.logUnmatchedTable()
+			return nil
+		}
+
+		switch {
+		case inCopy:
+			row := strings.TrimRight(line, "\r\n")
+			if row == `\.` {
+				inCopy = false
+				continue
+			}
+			if !importCopy {
+				continue
+			}
+			rowChan <- SQLConverter{
+				fields: copyFields,
+				values: parseCopyRow(row),
+				index:  r.numProcessed,
+			}
+			r.numProcessed++
+
+		case inCreate:
+			if strings.HasPrefix(strings.TrimSpace(line), ")") {
+				inCreate = false
+			} else if match := sqlColumnPattern.FindStringSubmatch(line); match != nil {
+				r.createFields = append(r.createFields, match[1])
+			}
+
+		case sqlCreateTablePattern.MatchString(line):
+			table := sqlIdentifier(sqlCreateTablePattern.FindStringSubmatch(line)[1])
+			if table == r.table {
+				r.createFields = nil
+				inCreate = true
+			}
+
+		case sqlCopyPattern.MatchString(line):
+			match := sqlCopyPattern.FindStringSubmatch(line)
+			table := sqlIdentifier(match[1])
+			r.tables[table] = true
+			inCopy = true
+			importCopy = table == r.table
+			if importCopy {
+				if copyFields, err = r.fieldsFor(match[2]); err != nil {
+					return err
+				}
+			}
+
+		case sqlInsertPattern.MatchString(line):
+			if err = r.readInsert(line, rowChan); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readInsert parses an INSERT statement beginning on the given line, reading
+// further lines if the statement spans several of them. Each line is parsed
+// once: the rows of the whole tuples read so far are sent, and only the
+// unfinished tuple is carried over to the next line.
+func (r *SQLInputReader) readInsert(statement string, rowChan chan<- Converter) error {
+	match := sqlInsertPattern.FindStringSubmatch(statement)
+	table := sqlIdentifier(match[1])
+	r.tables[table] = true
+
+	var fields []string
+	if table == r.table {
+		var err error
+		if fields, err = r.fieldsFor(match[2]); err != nil {
+			return err
+		}
+	}
+	rest := statement[len(match[0]):]
+	afterTuple := false
+	for {
+		rows, consumed, complete, err := parseInsertValues(rest, afterTuple)
+		if err != nil {
+			return fmt.Errorf("error parsing INSERT into %v after row #%v: %v", table, r.numProcessed, err)
+		}
+		if table == r.table {
+			for _, row := range rows {
+				rowChan <- SQLConverter{
+					fields: fields,
+					values: row,
+					index:  r.numProcessed,
+				}
+				r.numProcessed++
+			}
+		}
+		if complete {
+			return nil
+		}
+		afterTuple = afterTuple || len(rows) > 0
+		line, err := r.sqlReader.ReadString(entryDelimiter)
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return fmt.Errorf("unterminated INSERT statement for table %v", table)
+			}
+			return fmt.Errorf("read error after row #%v: %v", r.numProcessed, err)
+		}
+		rest = rest[consumed:] + line
+	}
+}
+
+// fieldsFor returns the field names to use for a statement with the given
+// column list. Fields specified with --fields or --fieldFile take precedence,
+// followed by the statement's own column list and then the columns of the
+// table's CREATE TABLE statement.
+func (r *SQLInputReader) fieldsFor(columnList string) ([]string, error) {
+	if len(r.fields) > 0 {
+		return r.fields, nil
+	}
+	if strings.TrimSpace(columnList) == "" {
+		return r.createFields, nil
+	}
+	var fields []string
+	for _, column := range strings.Split(columnList, ",") {
+		fields = append(fields, sqlIdentifier(column))
+	}
+	if err := validateFields(fields); err != nil {
+		return nil, fmt.Errorf("invalid columns for table %v: %v", r.table, err)
+	}
+	return fields, nil
+}
+
+// logUnmatchedTable warns when the dump had no rows for the table being
+// imported, listing the tables that were found instead.
+func (r *SQLInputReader) logUnmatchedTable() {
+	if r.numProcessed > 0 || r.tables[r.table] {
+		return
+	}
+	var tables []string
+	for table := range r.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	log.Logf(log.Always, "no rows found for table '%v'; tables in the dump: %v (use --table to choose one)",
+		r.table, strings.Join(tables, ", "))
+}
+
+// Convert implements the Converter interface for SQL input. It converts a
+// SQLConverter struct to a BSON document.
+func (c SQLConverter) Convert() (bson.D, error) {
+	log.Logf(log.DebugHigh, "got row: %v", c.values)
+	document := bson.D{}
+	for index, value := range c.values {
+		if index < len(c.fields) {
+			if strings.Index(c.fields[index], ".") != -1 {
+				setNestedValue(c.fields[index], value, &document)
+			} else {
+				document = append(document, bson.DocElem{c.fields[index], value})
+			}
+			continue
+		}
+		key := "field" + strconv.Itoa(index)
+		for _, field := range c.fields {
+			if field == key {
+				return nil, fmt.Errorf("duplicate field name - on %v - for value #%v ('%v') in document #%v",
+					key, index+1, value, c.index)
+			}
+		}
+		document = append(document, bson.DocElem{key, value})
+	}
+	return document, nil
+}
+
+// recordIndex implements the indexedConverter interface.
+func (c SQLConverter) recordIndex() uint64 {
+	return c.index
+}
+
+// removeNullFields returns a copy of a document read from a SQL dump without
+// its NULL values, which --ignoreBlanks leaves out along with empty strings,
+// nor the embedded documents left empty by removing them.
+func removeNullFields(document bson.D) (newDocument bson.D) {
+	for _, keyVal := range document {
+		switch val := keyVal.Value.(type) {
+		case nil:
+			continue
+		case *bson.D:
+			keyVal.Value = removeNullFields(*val)
+		case bson.D:
+			keyVal.Value = removeNullFields(val)
+		}
+		if val, ok := keyVal.Value.(bson.D); ok && val == nil {
+			continue
+		}
+		newDocument = append(newDocument, keyVal)
+	}
+	return newDocument
+}
+
+// sqlIdentifier strips quoting and any schema or database qualifier from a
+// table or column name.
+func sqlIdentifier(name string) string {
+	name = strings.TrimSpace(name)
+	if index := strings.LastIndex(name, "."); index != -1 {
+		name = name[index+1:]
+	}
+	return strings.Trim(name, "`\"")
+}
+
+// parseInsertValues parses the tuples following VALUES in a MySQL INSERT
+// statement. afterTuple is true if s continues the statement after a tuple,
+// so that it starts with the ',' or ';' that follows one. It returns the rows
+// of the whole tuples in s, and the length of s they take up. complete is
+// false if s ends before the terminating semicolon, in which case the caller
+// should append more input to the rest of s and carry on.
+func parseInsertValues(s string, afterTuple bool) (rows [][]interface{}, consumed int, complete bool, err error) {
+	i := 0
+	skipSpace := func() {
+		for i < len(s) && strings.IndexByte(" \t\r\n", s[i]) != -1 {
+			i++
+		}
+	}
+	for {
+		skipSpace()
+		if i >= len(s) {
+			return rows, consumed, false, nil
+		}
+		if afterTuple || len(rows) > 0 {
+			// tuples are separated by commas and ended by a semicolon
+			switch s[i] {
+			case ';':
+				return rows, i + 1, true, nil
+			case ',':
+				i++
+				skipSpace()
+				if i >= len(s) {
+					return rows, consumed, false, nil
+				}
+			default:
+				return nil, 0, false, fmt.Errorf("expected ',' or ';' but found '%c'", s[i])
+			}
+		}
+		if s[i] != '(' {
+			return nil, 0, false, fmt.Errorf("expected '(' but found '%c'", s[i])
+		}
+		i++
+
+		row := []interface{}{}
+		for {
+			skipSpace()
+			if i >= len(s) {
+				return rows, consumed, false, nil
+			}
+			if strings.HasPrefix(s[i:], "_binary ") {
+				i += len("_binary ")
+				skipSpace()
+				if i >= len(s) {
+					return rows, consumed, false, nil
+				}
+			}
+			if s[i] == '\'' || s[i] == '"' {
+				value, end := parseMySQLString(s, i)
+				if end == -1 {
+					return rows, consumed, false, nil
+				}
+				row = append(row, value)
+				i = end
+			} else {
+				end := strings.IndexAny(s[i:], ",)")
+				if end == -1 {
+					return rows, consumed, false, nil
+				}
+				token := strings.TrimSpace(s[i : i+end])
+				if strings.EqualFold(token, "NULL") {
+					row = append(row, nil)
+				} else {
+					row = append(row, getParsedValue(token))
+				}
+				i += end
+			}
+
+			skipSpace()
+			if i >= len(s) {
+				return rows, consumed, false, nil
+			}
+			if s[i] == ',' {
+				i++
+				continue
+			}
+			if s[i] != ')' {
+				return nil, 0, false, fmt.Errorf("expected ',' or ')' but found '%c'", s[i])
+			}
+			i++
+			rows = append(rows, row)
+			consumed = i
+			break
+		}
+	}
+}
+
+// parseMySQLString unescapes the quoted string starting at s[start], returning
+// the string and the index just past its closing quote, or -1 if the string
+// is not terminated.
+func parseMySQLString(s string, start int) (string, int) {
+	quote := s[start]
+	value := make([]byte, 0, 32)
+	for i := start + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+			if i >= len(s) {
+				return "", -1
+			}
+			switch s[i] {
+			case '0':
+				value = append(value, 0)
+			case 'b':
+				value = append(value, '\b')
+			case 'n':
+				value = append(value, '\n')
+			case 'r':
+				value = append(value, '\r')
+			case 't':
+				value = append(value, '\t')
+			case 'Z':
+				value = append(value, 0x1a)
+			case '%', '_':
+				// kept escaped, as in LIKE patterns
+				value = append(value, '\\', s[i])
+			default:
+				value = append(value, s[i])
+			}
+		case c == quote:
+			// a doubled quote is an escaped quote
+			if i+1 < len(s) && s[i+1] == quote {
+				value = append(value, quote)
+				i++
+				continue
+			}
+			return string(value), i + 1
+		default:
+			value = append(value, c)
+		}
+	}
+	return "", -1
+}
+
+// parseCopyRow splits a row of Postgres COPY text format data into its
+// values. \N denotes NULL.
+func parseCopyRow(row string) []interface{} {
+	var values []interface{}
+	for _, token := range strings.Split(row, "\t") {
+		if token == `\N` {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, getParsedValue(unescapeCopyValue(token)))
+	}
+	return values
+}
+
+// unescapeCopyValue decodes the backslash escapes of the COPY text format.
+func unescapeCopyValue(token string) string {
+	if strings.IndexByte(token, '\\') == -1 {
+		return token
+	}
+	value := make([]byte, 0, len(token))
+	for i := 0; i < len(token); i++ {
+		if token[i] != '\\' || i+1 == len(token) {
+			value = append(value, token[i])
+			continue
+		}
+		i++
+		switch c := token[i]; {
+		case c == 'b':
+			value = append(value, '\b')
+		case c == 'f':
+			value = append(value, '\f')
+		case c == 'n':
+			value = append(value, '\n')
+		case c == 'r':
+			value = append(value, '\r')
+		case c == 't':
+			value = append(value, '\t')
+		case c == 'v':
+			value = append(value, '\v')
+		case c >= '0' && c <= '7':
+			// up to three octal digits
+			end := i + 1
+			for end < len(token) && end < i+3 && token[end] >= '0' && token[end] <= '7' {
+				end++
+			}
+			n, _ := strconv.ParseUint(token[i:end], 8, 8)
+			value = append(value, byte(n))
+			i = end - 1
+		case c == 'x' && i+1 < len(token) && isHexDigit(token[i+1]):
+			// up to two hex digits
+			end := i + 2
+			if end < len(token) && isHexDigit(token[end]) {
+				end++
+			}
+			n, _ := strconv.ParseUint(token[i+1:end], 16, 8)
+			value = append(value, byte(n))
+			i = end - 1
+		default:
+			value = append(value, c)
+		}
+	}
+	return string(value)
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
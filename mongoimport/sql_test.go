@@ -0,0 +1,164 @@
+package mongoimport
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+const mysqlDump = "-- MySQL dump 10.13\n" +
+	"DROP TABLE IF EXISTS `users`;\n" +
+	"CREATE TABLE `users` (\n" +
+	"  `id` int(11) NOT NULL,\n" +
+	"  `name` varchar(64) DEFAULT NULL,\n" +
+	"  `bio` text,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8;\n" +
+	"LOCK TABLES `users` WRITE;\n" +
+	"INSERT INTO `users` VALUES (1,'O\\'Brien','line one\\nline two'),(2,'Ann',NULL);\n" +
+	"INSERT INTO `orders` VALUES (10,1,9.5);\n" +
+	"INSERT INTO `users` (`id`, `name`) VALUES\n" +
+	"(3,'it''s'),\n" +
+	"(4,'semi;colon');\n" +
+	"UNLOCK TABLES;\n"
+
+const postgresDump = "--\n-- PostgreSQL database dump\n--\n" +
+	"COPY public.orders (id, user_id, total) FROM stdin;\n" +
+	"10\t1\t9.5\n" +
+	"\\.\n" +
+	"COPY public.users (id, name, bio) FROM stdin;\n" +
+	"1\tO'Brien\tline one\\nline two\n" +
+	"2\tAnn\t\\N\n" +
+	"\\.\n"
+
+func readSQLDocuments(dump, table string, fields []string) ([]bson.D, error) {
+	r := NewSQLInputReader(fields, table, bytes.NewReader([]byte(dump)), 1)
+	docChan := make(chan bson.D, 10)
+	if err := r.StreamDocument(true, docChan); err != nil {
+		return nil, err
+	}
+	var docs []bson.D
+	for doc := range docChan {
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func TestSQLStreamDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a SQL input reader", t, func() {
+
+		Convey("rows of a mysqldump table should be read using its column names", func() {
+			docs, err := readSQLDocuments(mysqlDump, "users", nil)
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{
+				{{"id", 1}, {"name", "O'Brien"}, {"bio", "line one\nline two"}},
+				{{"id", 2}, {"name", "Ann"}, {"bio", nil}},
+				{{"id", 3}, {"name", "it's"}},
+				{{"id", 4}, {"name", "semi;colon"}},
+			})
+		})
+
+		Convey("rows of a pg_dump COPY block should be read using its column list", func() {
+			docs, err := readSQLDocuments(postgresDump, "users", nil)
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{
+				{{"id", 1}, {"name", "O'Brien"}, {"bio", "line one\nline two"}},
+				{{"id", 2}, {"name", "Ann"}, {"bio", nil}},
+			})
+		})
+
+		Convey("only rows of the requested table should be read", func() {
+			docs, err := readSQLDocuments(mysqlDump, "orders", nil)
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{{{"field0", 10}, {"field1", 1}, {"field2", 9.5}}})
+
+			docs, err = readSQLDocuments(postgresDump, "missing", nil)
+			So(err, ShouldBeNil)
+			So(len(docs), ShouldEqual, 0)
+		})
+
+		Convey("fields passed in should override the dump's column names", func() {
+			docs, err := readSQLDocuments(postgresDump, "orders", []string{"_id", "user", "amount.total"})
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{
+				{{"_id", 10}, {"user", 1}, {"amount", &bson.D{{"total", 9.5}}}},
+			})
+		})
+
+		Convey("malformed or truncated statements should return an error", func() {
+			_, err := readSQLDocuments("INSERT INTO `users` VALUES (1,'a') (2,'b');\n", "users", nil)
+			So(err, ShouldNotBeNil)
+
+			_, err = readSQLDocuments("INSERT INTO `users` VALUES (1,'unterminated\n", "users", nil)
+			So(err, ShouldNotBeNil)
+
+			_, err = readSQLDocuments("COPY users (id) FROM stdin;\n1\n", "users", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseInsertValues(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A statement split across lines should be parsed a whole tuple at a time", t, func() {
+		rows, consumed, complete, err := parseInsertValues("(1,'a'),(2,'b", false)
+		So(err, ShouldBeNil)
+		So(complete, ShouldBeFalse)
+		So(rows, ShouldResemble, [][]interface{}{{1, "a"}})
+		So(consumed, ShouldEqual, len("(1,'a')"))
+
+		rest := "(1,'a'),(2,'b"[consumed:] + "c'),\n"
+		rows, consumed, complete, err = parseInsertValues(rest, true)
+		So(err, ShouldBeNil)
+		So(complete, ShouldBeFalse)
+		So(rows, ShouldResemble, [][]interface{}{{2, "bc"}})
+
+		rows, _, complete, err = parseInsertValues(rest[consumed:]+"(3,NULL);\n", true)
+		So(err, ShouldBeNil)
+		So(complete, ShouldBeTrue)
+		So(rows, ShouldResemble, [][]interface{}{{3, nil}})
+	})
+
+	Convey("A statement continuing after a tuple must start with ',' or ';'", t, func() {
+		_, _, _, err := parseInsertValues("(4);", true)
+		So(err, ShouldNotBeNil)
+		_, _, complete, err := parseInsertValues(" ;", true)
+		So(err, ShouldBeNil)
+		So(complete, ShouldBeTrue)
+	})
+}
+
+func TestRemoveNullFields(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("NULL values, and embedded documents left empty, should be removed", t, func() {
+		document := bson.D{
+			{"a", 0},
+			{"b", nil},
+			{"c", ""},
+			{"d", &bson.D{{"x", nil}}},
+			{"e", &bson.D{{"x", nil}, {"y", 1}}},
+		}
+		So(removeNullFields(document), ShouldResemble, bson.D{
+			{"a", 0},
+			{"c", ""},
+			{"e", bson.D{{"y", 1}}},
+		})
+	})
+}
+
+func TestUnescapeCopyValue(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("COPY text format escapes should be decoded", t, func() {
+		So(unescapeCopyValue(`plain`), ShouldEqual, "plain")
+		So(unescapeCopyValue(`a\tb\\c`), ShouldEqual, "a\tb\\c")
+		So(unescapeCopyValue(`\101\x42`), ShouldEqual, "AB")
+		So(unescapeCopyValue(`trailing\`), ShouldEqual, `trailing\`)
+	})
+}
@@ -0,0 +1,160 @@
+package mongoimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Classes of insert errors tallied in the import summary.
+const (
+	errorClassDuplicateKey = "duplicateKey"
+	errorClassValidation   = "validation"
+	errorClassWriteConcern = "writeConcern"
+	errorClassConnection   = "connection"
+	errorClassOther        = "other"
+)
+
+// importSummary is the outcome of a whole mongoimport run, written to the
+// --summaryFile.
+type importSummary struct {
+	Start      time.Time `json:"start"`
+	Seconds    float64   `json:"seconds"`
+	Inserted   int64     `json:"inserted"`
+	Upserted   int64     `json:"upserted"`
+	Modified   int64     `json:"modified"`
+	Skipped    int64     `json:"skipped"`
+	Failed     int64     `json:"failed"`
+	DocsPerSec float64   `json:"docsPerSec"`
+
+	// Errors counts the documents that failed, by class of error
+	Errors map[string]int64 `json:"errors"`
+}
+
+// summaryCollector tallies the outcome of the documents written by
+// concurrent insertion workers.
+type summaryCollector struct {
+	sync.Mutex
+	start    time.Time
+	inserted int64
+	upserted int64
+	modified int64
+	failed   int64
+	errors   map[string]int64
+}
+
+// recordWrites adds the numbers of documents inserted, upserted and
+// modified.
+func (collector *summaryCollector) recordWrites(inserted, upserted, modified int) {
+	collector.Lock()
+	defer collector.Unlock()
+	collector.inserted += int64(inserted)
+	collector.upserted += int64(upserted)
+	collector.modified += int64(modified)
+}
+
+// recordFailure adds documents that failed to be written because of err.
+func (collector *summaryCollector) recordFailure(count int, err error) {
+	collector.Lock()
+	defer collector.Unlock()
+	if collector.errors == nil {
+		collector.errors = map[string]int64{}
+	}
+	collector.failed += int64(count)
+	collector.errors[errorClass(err)] += int64(count)
+}
+
+// errorClass returns the class of an insert or upsert error.
+func errorClass(err error) string {
+	if mgo.IsDup(err) {
+		return errorClassDuplicateKey
+	}
+	if err == db.ErrLostConnection || db.IsConnectionError(err) {
+		return errorClassConnection
+	}
+	code := 0
+	switch e := err.(type) {
+	case *mgo.LastError:
+		code = e.Code
+	case *mgo.QueryError:
+		code = e.Code
+	}
+	switch {
+	case code == 121:
+		return errorClassValidation
+	case code == 64 || strings.Contains(err.Error(), "waiting for replication timed out"):
+		return errorClassWriteConcern
+	}
+	return errorClassOther
+}
+
+// summarize totals the recorded outcomes, counting skipped the documents
+// left out by --oversizedDocs=skip.
+func (imp *MongoImport) summarize() importSummary {
+	imp.summary.Lock()
+	defer imp.summary.Unlock()
+	summary := importSummary{
+		Start:    imp.summary.start,
+		Seconds:  time.Since(imp.summary.start).Seconds(),
+		Inserted: imp.summary.inserted,
+		Upserted: imp.summary.upserted,
+		Modified: imp.summary.modified,
+		Skipped:  imp.sizeGuard.Skipped(),
+		Failed:   imp.summary.failed,
+		Errors:   map[string]int64{},
+	}
+	for class, count := range imp.summary.errors {
+		summary.Errors[class] = count
+	}
+	if summary.Seconds > 0 {
+		written := summary.Inserted + summary.Upserted + summary.Modified
+		summary.DocsPerSec = float64(written) / summary.Seconds
+	}
+	return summary
+}
+
+// writeSummary writes a human-readable form of the summary.
+func writeSummary(out io.Writer, summary importSummary) {
+	fmt.Fprintf(out, "inserted: %v, upserted: %v, modified: %v, skipped: %v, failed: %v\n",
+		summary.Inserted, summary.Upserted, summary.Modified, summary.Skipped, summary.Failed)
+	if len(summary.Errors) > 0 {
+		classes := make([]string, 0, len(summary.Errors))
+		for class := range summary.Errors {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		counts := make([]string, 0, len(classes))
+		for _, class := range classes {
+			counts = append(counts, fmt.Sprintf("%v: %v", class, summary.Errors[class]))
+		}
+		fmt.Fprintf(out, "failures by error: %v\n", strings.Join(counts, ", "))
+	}
+	fmt.Fprintf(out, "took %.3fs (%.1f documents/sec)\n", summary.Seconds, summary.DocsPerSec)
+}
+
+// reportSummary logs a summary of the import and writes it as JSON to the
+// --summaryFile, if one was given.
+func (imp *MongoImport) reportSummary() error {
+	summary := imp.summarize()
+	writeSummary(log.Writer(log.Always), summary)
+
+	if imp.IngestOptions.SummaryFile == "" {
+		return nil
+	}
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding import summary: %v", err)
+	}
+	if err = ioutil.WriteFile(imp.IngestOptions.SummaryFile, append(summaryJSON, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing --summaryFile: %v", err)
+	}
+	return nil
+}
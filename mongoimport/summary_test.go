@@ -0,0 +1,62 @@
+package mongoimport
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"testing"
+	"time"
+)
+
+func TestImportSummary(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When classifying insert errors", t, func() {
+		Convey("duplicate key errors should be recognized", func() {
+			So(errorClass(&mgo.LastError{Code: 11000}), ShouldEqual, errorClassDuplicateKey)
+		})
+		Convey("document validation errors should be recognized", func() {
+			So(errorClass(&mgo.LastError{Code: 121}), ShouldEqual, errorClassValidation)
+		})
+		Convey("write concern errors should be recognized", func() {
+			So(errorClass(&mgo.LastError{Code: 64}), ShouldEqual, errorClassWriteConcern)
+		})
+		Convey("any other error should be counted as other", func() {
+			So(errorClass(fmt.Errorf("something went wrong")), ShouldEqual, errorClassOther)
+		})
+	})
+
+	Convey("With outcomes recorded by the insertion workers", t, func() {
+		imp := &MongoImport{}
+		imp.summary.start = time.Now().Add(-2 * time.Second)
+		imp.summary.recordWrites(10, 0, 0)
+		imp.summary.recordWrites(0, 3, 2)
+		imp.summary.recordFailure(4, &mgo.LastError{Code: 11000})
+		imp.summary.recordFailure(1, fmt.Errorf("something went wrong"))
+
+		Convey("the summary should total them", func() {
+			summary := imp.summarize()
+			So(summary.Inserted, ShouldEqual, 10)
+			So(summary.Upserted, ShouldEqual, 3)
+			So(summary.Modified, ShouldEqual, 2)
+			So(summary.Skipped, ShouldEqual, 0)
+			So(summary.Failed, ShouldEqual, 5)
+			So(summary.Errors, ShouldResemble, map[string]int64{
+				errorClassDuplicateKey: 4,
+				errorClassOther:        1,
+			})
+			So(summary.DocsPerSec, ShouldBeGreaterThan, 0)
+
+			Convey("and print them with the failures by error", func() {
+				out := &bytes.Buffer{}
+				writeSummary(out, summary)
+				So(out.String(), ShouldContainSubstring,
+					"inserted: 10, upserted: 3, modified: 2, skipped: 0, failed: 5")
+				So(out.String(), ShouldContainSubstring, "failures by error: duplicateKey: 4, other: 1")
+			})
+		})
+	})
+}
@@ -32,6 +32,9 @@ type TSVInputReader struct {
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
 
+	// metadata adds provenance fields to each document, with --addImportMetadata
+	metadata *importMetadata
+
 	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
 	sizeTracker
 }
@@ -102,7 +105,7 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 
 	// begin processing read bytes
 	go func() {
-		tsvErrChan <- streamDocuments(ordered, r.numDecoders, tsvRecordChan, readDocs)
+		tsvErrChan <- streamDocuments(ordered, r.numDecoders, tsvRecordChan, readDocs, r.metadata)
 	}()
 
 	return channelQuorumError(tsvErrChan, 2)
@@ -117,3 +120,8 @@ func (c TSVConverter) Convert() (bson.D, error) {
 		c.index,
 	)
 }
+
+// recordIndex implements the indexedConverter interface.
+func (c TSVConverter) recordIndex() uint64 {
+	return c.index
+}
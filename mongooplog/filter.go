@@ -0,0 +1,76 @@
+package mongooplog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// nsFilter decides which namespaces' operations are applied, following the
+// --nsInclude and --nsExclude patterns.
+type nsFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newNSFilter compiles the include and exclude patterns, returning nil if
+// there are none.
+func newNSFilter(include, exclude []string) (*nsFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	filter := &nsFilter{}
+	for _, pattern := range include {
+		compiled, err := compileNSPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nsInclude '%v': %v", pattern, err)
+		}
+		filter.include = append(filter.include, compiled)
+	}
+	for _, pattern := range exclude {
+		compiled, err := compileNSPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nsExclude '%v': %v", pattern, err)
+		}
+		filter.exclude = append(filter.exclude, compiled)
+	}
+	return filter, nil
+}
+
+// compileNSPattern returns a regular expression matching the namespaces
+// that fit a pattern in which '*' matches any run of characters.
+func compileNSPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern can not be blank")
+	}
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// Allows returns true if the operations on the namespace should be applied:
+// it must match an include pattern, if there are any, and must not match an
+// exclude pattern. A nil filter allows every namespace.
+func (filter *nsFilter) Allows(namespace string) bool {
+	if filter == nil {
+		return true
+	}
+	included := len(filter.include) == 0
+	for _, pattern := range filter.include {
+		if pattern.MatchString(namespace) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range filter.exclude {
+		if pattern.MatchString(namespace) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package mongooplog
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNSFilter(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Without patterns, every namespace should be allowed", t, func() {
+		filter, err := newNSFilter(nil, nil)
+		So(err, ShouldBeNil)
+		So(filter, ShouldBeNil)
+		So(filter.Allows("test.c"), ShouldBeTrue)
+	})
+
+	Convey("With --nsInclude and --nsExclude patterns", t, func() {
+		filter, err := newNSFilter([]string{"sales.*", "app.users"}, []string{"sales.tmp_*"})
+		So(err, ShouldBeNil)
+
+		Convey("only namespaces matching an include pattern should be allowed", func() {
+			So(filter.Allows("sales.orders"), ShouldBeTrue)
+			So(filter.Allows("app.users"), ShouldBeTrue)
+			So(filter.Allows("app.users2"), ShouldBeFalse)
+			So(filter.Allows("app.events"), ShouldBeFalse)
+		})
+
+		Convey("an exclude pattern should win over an include pattern", func() {
+			So(filter.Allows("sales.tmp_import"), ShouldBeFalse)
+		})
+
+		Convey("commands should be matched by their <db>.$cmd namespace", func() {
+			So(filter.Allows("sales.$cmd"), ShouldBeTrue)
+			So(filter.Allows("app.$cmd"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Only --nsExclude patterns should allow every other namespace", t, func() {
+		filter, err := newNSFilter(nil, []string{"*.system.*"})
+		So(err, ShouldBeNil)
+		So(filter.Allows("test.c"), ShouldBeTrue)
+		So(filter.Allows("test.system.js"), ShouldBeFalse)
+	})
+
+	Convey("A blank pattern should be refused", t, func() {
+		_, err := newNSFilter([]string{""}, nil)
+		So(err, ShouldNotBeNil)
+		_, err = newNSFilter(nil, []string{""})
+		So(err, ShouldNotBeNil)
+	})
+}
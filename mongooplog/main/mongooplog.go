@@ -55,8 +55,20 @@ func main() {
 	opts.ReplicaSetName = setName
 
 	// validate the mongooplog options
-	if sourceOpts.From == "" {
-		log.Logf(log.Always, "command line error: need to specify --from")
+	if sourceOpts.From == "" && sourceOpts.FromFile == "" {
+		log.Logf(log.Always, "command line error: need to specify --from or --fromFile")
+		os.Exit(util.ExitBadOptions)
+	}
+	if sourceOpts.From != "" && sourceOpts.FromFile != "" {
+		log.Logf(log.Always, "command line error: cannot use --from with --fromFile")
+		os.Exit(util.ExitBadOptions)
+	}
+	if sourceOpts.RateLimit < 0 {
+		log.Logf(log.Always, "command line error: --ratelimit can not be negative")
+		os.Exit(util.ExitBadOptions)
+	}
+	if sourceOpts.StatsInterval < 0 {
+		log.Logf(log.Always, "command line error: --statsInterval can not be negative")
 		os.Exit(util.ExitBadOptions)
 	}
 
@@ -67,13 +79,16 @@ func main() {
 		os.Exit(util.ExitError)
 	}
 
-	// create a session provider for the source server
-	opts.Connection.Host = sourceOpts.From
-	opts.Connection.Port = ""
-	sessionProviderFrom, err := db.NewSessionProvider(*opts)
-	if err != nil {
-		log.Logf(log.Always, "error connecting to source host: %v", err)
-		os.Exit(util.ExitError)
+	// create a session provider for the source server, unless reading a file
+	var sessionProviderFrom *db.SessionProvider
+	if sourceOpts.FromFile == "" {
+		opts.Connection.Host = sourceOpts.From
+		opts.Connection.Port = ""
+		sessionProviderFrom, err = db.NewSessionProvider(*opts)
+		if err != nil {
+			log.Logf(log.Always, "error connecting to source host: %v", err)
+			os.Exit(util.ExitError)
+		}
 	}
 
 	// initialize mongooplog
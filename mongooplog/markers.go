@@ -0,0 +1,85 @@
+package mongooplog
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Conflict-avoidance markers let two clusters replay their oplogs at each
+// other without looping. Every insert or update applied by mongooplog is
+// tagged by writing the --sourceId into --markerField of the affected
+// document. When tailing the other direction, oplog entries that carry the
+// --destinationId marker were themselves produced by mongooplog replaying
+// from the destination, so they are skipped instead of being sent back.
+//
+// Deletes cannot be tagged, but they do not loop: deleting a document that no
+// longer exists does not produce a new oplog entry.
+
+// markerValue returns the marker stored in an insert or update operation,
+// and whether one was found.
+func markerValue(entry *db.Oplog, markerField string) (interface{}, bool) {
+	switch entry.Operation {
+	case "i":
+		value, ok := entry.Object[markerField]
+		return value, ok
+	case "u":
+		if !isOperatorUpdate(entry.Object) {
+			value, ok := entry.Object[markerField]
+			return value, ok
+		}
+		setDoc, ok := entry.Object["$set"].(bson.M)
+		if !ok {
+			return nil, false
+		}
+		value, ok := setDoc[markerField]
+		return value, ok
+	}
+	return nil, false
+}
+
+// originatesFromDestination returns true if the oplog entry was written
+// by a mongooplog replaying from the destination server.
+func (mo *MongoOplog) originatesFromDestination(entry *db.Oplog) bool {
+	if mo.SourceOptions.DestinationID == "" {
+		return false
+	}
+	value, ok := markerValue(entry, mo.SourceOptions.MarkerField)
+	return ok && value == mo.SourceOptions.DestinationID
+}
+
+// tagOperation marks an insert or update with the source id before it is
+// applied, so that it can be recognized if it is replayed back to the source.
+func (mo *MongoOplog) tagOperation(entry *db.Oplog) {
+	if mo.SourceOptions.SourceID == "" {
+		return
+	}
+	markerField := mo.SourceOptions.MarkerField
+	switch entry.Operation {
+	case "i":
+		entry.Object[markerField] = mo.SourceOptions.SourceID
+	case "u":
+		if !isOperatorUpdate(entry.Object) {
+			// a full document replacement
+			entry.Object[markerField] = mo.SourceOptions.SourceID
+			return
+		}
+		setDoc, ok := entry.Object["$set"].(bson.M)
+		if !ok {
+			setDoc = bson.M{}
+			entry.Object["$set"] = setDoc
+		}
+		setDoc[markerField] = mo.SourceOptions.SourceID
+	}
+}
+
+// isOperatorUpdate returns true if the update document uses update operators
+// such as $set, rather than replacing the whole document.
+func isOperatorUpdate(update bson.M) bool {
+	for key := range update {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+package mongooplog
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSourceRefresh is how often the source's latest oplog timestamp is
+// read when only the metrics endpoint is on.
+const defaultSourceRefresh = 10 * time.Second
+
+// replayMetrics counts the operations applied by mongooplog and tracks how
+// far the destination is behind the source.
+type replayMetrics struct {
+	mutex sync.Mutex
+
+	appliedOps   int64
+	appliedBytes int64
+	skippedOps   int64
+	namespaceOps map[string]int64
+
+	// timestamp of the last operation applied to the destination
+	appliedTS bson.MongoTimestamp
+
+	// timestamp of the newest operation in the source's oplog
+	sourceTS bson.MongoTimestamp
+
+	// totals at the time of the last stats line, for computing rates
+	lastReport      time.Time
+	lastReportOps   int64
+	lastReportBytes int64
+}
+
+func newReplayMetrics() *replayMetrics {
+	return &replayMetrics{
+		namespaceOps: map[string]int64{},
+		lastReport:   time.Now(),
+	}
+}
+
+// applied records an operation of the given size applied to the destination.
+func (m *replayMetrics) applied(entry *db.Oplog, size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.appliedOps++
+	m.appliedBytes += int64(size)
+	m.namespaceOps[entry.Namespace]++
+	m.appliedTS = entry.Timestamp
+	if m.appliedTS > m.sourceTS {
+		m.sourceTS = m.appliedTS
+	}
+}
+
+// skipped records an operation that was read but not applied.
+func (m *replayMetrics) skipped(entry *db.Oplog) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.skippedOps++
+	if entry.Timestamp > m.sourceTS {
+		m.sourceTS = entry.Timestamp
+	}
+}
+
+// setSourceTimestamp records the newest timestamp in the source's oplog.
+func (m *replayMetrics) setSourceTimestamp(ts bson.MongoTimestamp) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if ts > m.sourceTS {
+		m.sourceTS = ts
+	}
+}
+
+// lag returns how many seconds of the source's oplog have not yet been
+// applied, and false if nothing has been applied yet.
+func (m *replayMetrics) lag() (int64, bool) {
+	if m.appliedTS == 0 {
+		return 0, false
+	}
+	lag := timestampSeconds(m.sourceTS) - timestampSeconds(m.appliedTS)
+	if lag < 0 {
+		lag = 0
+	}
+	return lag, true
+}
+
+func timestampSeconds(ts bson.MongoTimestamp) int64 {
+	return int64(uint64(ts) >> 32)
+}
+
+func formatTimestamp(ts bson.MongoTimestamp) string {
+	if ts == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%v:%v", timestampSeconds(ts), uint32(ts))
+}
+
+// report returns a stats line covering the operations applied since the
+// previous one.
+func (m *replayMetrics) report(now time.Time) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	elapsed := now.Sub(m.lastReport).Seconds()
+	var opsRate, bytesRate float64
+	if elapsed > 0 {
+		opsRate = float64(m.appliedOps-m.lastReportOps) / elapsed
+		bytesRate = float64(m.appliedBytes-m.lastReportBytes) / elapsed
+	}
+	m.lastReport, m.lastReportOps, m.lastReportBytes = now, m.appliedOps, m.appliedBytes
+
+	lag := "unknown"
+	if seconds, ok := m.lag(); ok {
+		lag = fmt.Sprintf("%vs", seconds)
+	}
+	return fmt.Sprintf("applied %v ops (%.1f ops/sec, %.1f bytes/sec), skipped %v; "+
+		"source at %v, applied through %v, lag %v",
+		m.appliedOps, opsRate, bytesRate, m.skippedOps,
+		formatTimestamp(m.sourceTS), formatTimestamp(m.appliedTS), lag)
+}
+
+// namespaceReport returns the number of operations applied to each
+// namespace, busiest first.
+func (m *replayMetrics) namespaceReport() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	namespaces := m.sortedNamespaces()
+	sort.Stable(byOpsDescending{namespaces, m.namespaceOps})
+	counts := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		counts = append(counts, fmt.Sprintf("%v: %v", ns, m.namespaceOps[ns]))
+	}
+	return strings.Join(counts, ", ")
+}
+
+// byOpsDescending sorts namespaces by their operation counts, largest first.
+type byOpsDescending struct {
+	namespaces []string
+	ops        map[string]int64
+}
+
+func (s byOpsDescending) Len() int { return len(s.namespaces) }
+func (s byOpsDescending) Swap(i, j int) {
+	s.namespaces[i], s.namespaces[j] = s.namespaces[j], s.namespaces[i]
+}
+func (s byOpsDescending) Less(i, j int) bool {
+	return s.ops[s.namespaces[i]] > s.ops[s.namespaces[j]]
+}
+
+func (m *replayMetrics) sortedNamespaces() []string {
+	namespaces := make([]string, 0, len(m.namespaceOps))
+	for ns := range m.namespaceOps {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// writePrometheus writes the metrics in the Prometheus text exposition
+// format. Rates are left to Prometheus to compute from the counters.
+func (m *replayMetrics) writePrometheus(out io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	metric := func(name, kind, help string, value int64) {
+		fmt.Fprintf(out, "# HELP %v %v\n# TYPE %v %v\n%v %v\n", name, help, name, kind, name, value)
+	}
+	metric("mongooplog_applied_ops_total", "counter", "Operations applied to the destination.", m.appliedOps)
+	metric("mongooplog_applied_bytes_total", "counter", "Bytes of operations applied to the destination.", m.appliedBytes)
+	metric("mongooplog_skipped_ops_total", "counter", "Operations read from the source but not applied.", m.skippedOps)
+	metric("mongooplog_source_timestamp_seconds", "gauge", "Time of the newest operation in the source's oplog.",
+		timestampSeconds(m.sourceTS))
+	metric("mongooplog_applied_timestamp_seconds", "gauge", "Time of the last operation applied to the destination.",
+		timestampSeconds(m.appliedTS))
+	if lag, ok := m.lag(); ok {
+		metric("mongooplog_lag_seconds", "gauge", "Seconds of the source's oplog not yet applied.", lag)
+	}
+
+	fmt.Fprintf(out, "# HELP mongooplog_namespace_applied_ops_total Operations applied to the destination, by namespace.\n")
+	fmt.Fprintf(out, "# TYPE mongooplog_namespace_applied_ops_total counter\n")
+	for _, ns := range m.sortedNamespaces() {
+		fmt.Fprintf(out, "mongooplog_namespace_applied_ops_total{ns=%q} %v\n", ns, m.namespaceOps[ns])
+	}
+}
+
+// ServeHTTP serves the metrics to Prometheus.
+func (m *replayMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.writePrometheus(w)
+}
+
+// serveMetrics starts serving the metrics at /metrics on the given address.
+func (m *replayMetrics) serveMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on --metricsAddr %v: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Logf(log.Always, "error serving metrics: %v", err)
+		}
+	}()
+	log.Logf(log.Always, "serving metrics at http://%v/metrics", listener.Addr())
+	return nil
+}
+
+// latestTimestamp returns the timestamp of the newest entry in the oplog.
+func latestTimestamp(oplog *mgo.Collection) (bson.MongoTimestamp, error) {
+	entry := struct {
+		Timestamp bson.MongoTimestamp `bson:"ts"`
+	}{}
+	err := oplog.Find(nil).Sort("-$natural").Select(bson.M{"ts": 1}).One(&entry)
+	return entry.Timestamp, err
+}
+
+// monitor refreshes the source's latest oplog timestamp and, if
+// --statsInterval is set, logs a stats line each interval until the
+// returned function is called.
+func (mo *MongoOplog) monitor(oplog *mgo.Collection, metrics *replayMetrics) func() {
+	interval := time.Duration(mo.SourceOptions.StatsInterval) * time.Second
+	logStats := interval > 0
+	if !logStats {
+		interval = defaultSourceRefresh
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			ts, err := latestTimestamp(oplog)
+			if err != nil {
+				log.Logf(log.Info, "error reading the source's latest oplog timestamp: %v", err)
+			} else {
+				metrics.setSourceTimestamp(ts)
+			}
+			if logStats {
+				log.Logf(log.Always, "%v", metrics.report(time.Now()))
+				log.Logf(log.Info, "applied ops by namespace: %v", metrics.namespaceReport())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
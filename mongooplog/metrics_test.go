@@ -0,0 +1,59 @@
+package mongooplog
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func timestamp(seconds, increment uint32) bson.MongoTimestamp {
+	return bson.MongoTimestamp(int64(seconds)<<32 | int64(increment))
+}
+
+func TestReplayMetrics(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With metrics for a replay", t, func() {
+		metrics := newReplayMetrics()
+		start := metrics.lastReport
+
+		Convey("the lag should be unknown until an op is applied", func() {
+			metrics.setSourceTimestamp(timestamp(1000, 1))
+			_, ok := metrics.lag()
+			So(ok, ShouldBeFalse)
+			So(metrics.report(start.Add(time.Second)), ShouldContainSubstring, "lag unknown")
+		})
+
+		Convey("applied ops should be counted by namespace and against the source", func() {
+			metrics.applied(&db.Oplog{Timestamp: timestamp(1000, 1), Namespace: "a.b"}, 100)
+			metrics.applied(&db.Oplog{Timestamp: timestamp(1001, 1), Namespace: "a.c"}, 50)
+			metrics.applied(&db.Oplog{Timestamp: timestamp(1002, 1), Namespace: "a.c"}, 50)
+			metrics.skipped(&db.Oplog{Timestamp: timestamp(1003, 1), Namespace: "a.b"})
+			metrics.setSourceTimestamp(timestamp(1030, 4))
+
+			lag, ok := metrics.lag()
+			So(ok, ShouldBeTrue)
+			So(lag, ShouldEqual, 28)
+			So(metrics.report(start.Add(2*time.Second)), ShouldEqual,
+				"applied 3 ops (1.5 ops/sec, 100.0 bytes/sec), skipped 1; "+
+					"source at 1030:4, applied through 1002:1, lag 28s")
+			So(metrics.namespaceReport(), ShouldEqual, "a.c: 2, a.b: 1")
+
+			// rates cover only the ops since the previous report
+			metrics.applied(&db.Oplog{Timestamp: timestamp(1004, 1), Namespace: "a.b"}, 10)
+			So(metrics.report(start.Add(3*time.Second)), ShouldStartWith,
+				"applied 4 ops (1.0 ops/sec, 10.0 bytes/sec)")
+
+			out := &bytes.Buffer{}
+			metrics.writePrometheus(out)
+			So(out.String(), ShouldContainSubstring, "mongooplog_applied_ops_total 4\n")
+			So(out.String(), ShouldContainSubstring, "mongooplog_applied_bytes_total 210\n")
+			So(out.String(), ShouldContainSubstring, "mongooplog_lag_seconds 26\n")
+			So(out.String(), ShouldContainSubstring, "mongooplog_namespace_applied_ops_total{ns=\"a.b\"} 2\n")
+		})
+	})
+}
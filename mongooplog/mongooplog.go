@@ -6,7 +6,6 @@ import (
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
-	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"time"
@@ -30,20 +29,12 @@ type MongoOplog struct {
 // Run executes the mongooplog program.
 func (mo *MongoOplog) Run() error {
 
-	// split up the oplog namespace we are using
-	oplogDB, oplogColl, err :=
-		util.SplitAndValidateNamespace(mo.SourceOptions.OplogNS)
-
+	// the namespaces to apply operations on, and the pace to apply them at
+	filter, err := newNSFilter(mo.SourceOptions.NSInclude, mo.SourceOptions.NSExclude)
 	if err != nil {
 		return err
 	}
-
-	// the full oplog namespace needs to be specified
-	if oplogColl == "" {
-		return fmt.Errorf("the oplog namespace must specify a collection")
-	}
-
-	log.Logf(log.DebugLow, "using oplog namespace `%v.%v`", oplogDB, oplogColl)
+	limiter := db.NewRateLimiter(mo.SourceOptions.RateLimit)
 
 	// connect to the destination server
 	toSession, err := mo.SessionProviderTo.GetSession()
@@ -60,43 +51,62 @@ func (mo *MongoOplog) Run() error {
 	}
 	log.Logf(log.DebugLow, "successfully connected to destination server `%v`", destServerStr)
 
-	// connect to the source server
-	fromSession, err := mo.SessionProviderFrom.GetSession()
-	if err != nil {
-		return fmt.Errorf("error connecting to source db: %v", err)
+	metrics := newReplayMetrics()
+	if mo.SourceOptions.MetricsAddr != "" {
+		if err = metrics.serveMetrics(mo.SourceOptions.MetricsAddr); err != nil {
+			return err
+		}
 	}
-	defer fromSession.Close()
-	fromSession.SetSocketTimeout(0)
-
-	log.Logf(log.DebugLow, "successfully connected to source server `%v`", mo.SourceOptions.From)
-
-	// set slave ok
-	fromSession.SetMode(mgo.Eventual, true)
 
-	// get the tailing cursor for the source server's oplog
-	tail := buildTailingCursor(fromSession.DB(oplogDB).C(oplogColl),
-		mo.SourceOptions)
-	defer tail.Close()
+	// open the source server's oplog, or the --fromFile
+	tail, closeSource, err := mo.openSource(metrics)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
 
-	// read the cursor dry, applying ops to the destination
+	// read the source dry, applying ops to the destination
 	// server in the process
-	oplogEntry := &db.Oplog{}
+	rawEntry := bson.Raw{}
 	res := &db.ApplyOpsResponse{}
 
 	log.Log(log.DebugLow, "applying oplog entries...")
 
-	for tail.Next(oplogEntry) {
+	for tail.Next(&rawEntry) {
+		oplogEntry := &db.Oplog{}
+		if err := rawEntry.Unmarshal(oplogEntry); err != nil {
+			return fmt.Errorf("error reading oplog entry: %v", err)
+		}
 
 		// skip noops
 		if oplogEntry.Operation == "n" {
 			log.Logf(log.DebugHigh, "skipping no-op for namespace `%v`", oplogEntry.Namespace)
+			metrics.skipped(oplogEntry)
+			continue
+		}
+
+		// skip ops that were replayed here from the destination, so that
+		// two servers replaying at each other don't loop forever
+		if mo.originatesFromDestination(oplogEntry) {
+			log.Logf(log.DebugHigh, "skipping op for namespace `%v` originating from `%v`",
+				oplogEntry.Namespace, mo.SourceOptions.DestinationID)
+			metrics.skipped(oplogEntry)
 			continue
 		}
 
+		// skip ops on namespaces left out by --nsInclude and --nsExclude
+		if !filter.Allows(oplogEntry.Namespace) {
+			log.Logf(log.DebugHigh, "skipping op for filtered out namespace `%v`", oplogEntry.Namespace)
+			metrics.skipped(oplogEntry)
+			continue
+		}
+		mo.tagOperation(oplogEntry)
+
 		// prepare the op to be applied
 		opsToApply := []db.Oplog{*oplogEntry}
 
-		// apply the operation
+		// apply the operation, within --ratelimit
+		limiter.Wait(1)
 		err := toSession.Run(bson.M{"applyOps": opsToApply}, res)
 
 		if err != nil {
@@ -107,14 +117,21 @@ func (mo *MongoOplog) Run() error {
 		if !res.Ok {
 			return fmt.Errorf("server gave error applying ops: %v", res.ErrMsg)
 		}
+		metrics.applied(oplogEntry, len(rawEntry.Data))
 	}
 
 	// make sure there was no tailing error
 	if err := tail.Err(); err != nil {
+		if mo.SourceOptions.FromFile != "" {
+			return fmt.Errorf("error reading --fromFile: %v", err)
+		}
 		return fmt.Errorf("error querying oplog: %v", err)
 	}
 
 	log.Log(log.DebugLow, "done applying oplog entries")
+	if mo.SourceOptions.StatsInterval > 0 {
+		log.Logf(log.Always, "%v", metrics.report(time.Now()))
+	}
 
 	return nil
 }
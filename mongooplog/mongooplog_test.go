@@ -137,3 +137,54 @@ func TestBasicOps(t *testing.T) {
 	})
 
 }
+
+func TestConflictAvoidanceMarkers(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongooplog replaying from 'A' to 'B'", t, func() {
+		oplog := MongoOplog{
+			SourceOptions: &SourceOptions{
+				SourceID:      "A",
+				DestinationID: "B",
+				MarkerField:   "_mongooplogSource",
+			},
+		}
+
+		Convey("inserts and replacements should be tagged with the source id", func() {
+			insert := &db.Oplog{Operation: "i", Object: bson.M{"_id": 1}}
+			oplog.tagOperation(insert)
+			So(insert.Object["_mongooplogSource"], ShouldEqual, "A")
+
+			replace := &db.Oplog{Operation: "u", Object: bson.M{"_id": 1, "x": 2}}
+			oplog.tagOperation(replace)
+			So(replace.Object["_mongooplogSource"], ShouldEqual, "A")
+		})
+
+		Convey("operator updates should be tagged with $set", func() {
+			update := &db.Oplog{Operation: "u", Object: bson.M{"$inc": bson.M{"x": 1}}}
+			oplog.tagOperation(update)
+			So(update.Object["$set"], ShouldResemble, bson.M{"_mongooplogSource": "A"})
+
+			update = &db.Oplog{Operation: "u", Object: bson.M{"$set": bson.M{"x": 1}}}
+			oplog.tagOperation(update)
+			So(update.Object["$set"], ShouldResemble, bson.M{"x": 1, "_mongooplogSource": "A"})
+		})
+
+		Convey("deletes should be left untouched", func() {
+			remove := &db.Oplog{Operation: "d", Object: bson.M{"_id": 1}}
+			oplog.tagOperation(remove)
+			So(remove.Object, ShouldResemble, bson.M{"_id": 1})
+		})
+
+		Convey("only operations tagged by the destination should be skipped", func() {
+			So(oplog.originatesFromDestination(&db.Oplog{Operation: "i",
+				Object: bson.M{"_id": 1, "_mongooplogSource": "B"}}), ShouldBeTrue)
+			So(oplog.originatesFromDestination(&db.Oplog{Operation: "u",
+				Object: bson.M{"$set": bson.M{"_mongooplogSource": "B"}}}), ShouldBeTrue)
+			So(oplog.originatesFromDestination(&db.Oplog{Operation: "i",
+				Object: bson.M{"_id": 1, "_mongooplogSource": "A"}}), ShouldBeFalse)
+			So(oplog.originatesFromDestination(&db.Oplog{Operation: "i",
+				Object: bson.M{"_id": 1}}), ShouldBeFalse)
+		})
+	})
+}
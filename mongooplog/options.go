@@ -5,16 +5,30 @@ import (
 )
 
 var Usage = `--from <remote host> <options>
+       mongooplog --fromFile <oplog.bson> <options>
 
-Poll operations from the replication oplog of one server, and apply them to another.
+Poll operations from the replication oplog of one server, and apply them to another,
+or apply the operations of an oplog file, such as the oplog.bson of mongodump --oplog.
 
 See http://docs.mongodb.org/manual/reference/program/mongooplog/ for more information.`
 
 // SourceOptions defines the set of options to use in retrieving oplog data from the source server.
 type SourceOptions struct {
-	From    string              `long:"from" description:"specify the host for mongooplog to retrive operations from"`
-	OplogNS string              `long:"oplogns" description:"specify the namespace in the --from host where the oplog lives (default 'local.oplog.rs') " default:"local.oplog.rs" default-mask:"-"`
-	Seconds bson.MongoTimestamp `long:"seconds" short:"s" description:"specify a number of seconds for mongooplog to pull from the remote host" default:"86400"  default-mask:"-"`
+	From     string              `long:"from" description:"specify the host for mongooplog to retrive operations from"`
+	FromFile string              `long:"fromFile" value-name:"<filename>" description:"apply the oplog entries of a file, such as the oplog.bson written by mongodump --oplog, or of standard input if '-', instead of those of a --from host; all of its entries are applied, regardless of --seconds, within --nsInclude, --nsExclude and --ratelimit"`
+	OplogNS  string              `long:"oplogns" description:"specify the namespace in the --from host where the oplog lives (default 'local.oplog.rs') " default:"local.oplog.rs" default-mask:"-"`
+	Seconds  bson.MongoTimestamp `long:"seconds" short:"s" description:"specify a number of seconds for mongooplog to pull from the remote host" default:"86400"  default-mask:"-"`
+
+	SourceID      string `long:"sourceId" description:"id of the --from host; applied inserts and updates are tagged with it in the marker field"`
+	DestinationID string `long:"destinationId" description:"id of the destination host; operations tagged with it are skipped, preventing replication loops between two servers"`
+	MarkerField   string `long:"markerField" description:"document field used to tag applied operations with --sourceId (default '_mongooplogSource')" default:"_mongooplogSource" default-mask:"-"`
+
+	NSInclude []string `long:"nsInclude" value-name:"<pattern>" description:"only apply the operations on namespaces matching this pattern, e.g. 'sales.*'; '*' matches any characters; may be repeated; commands are matched by their <db>.$cmd namespace"`
+	NSExclude []string `long:"nsExclude" value-name:"<pattern>" description:"skip the operations on namespaces matching this pattern, even if matched by --nsInclude; may be repeated"`
+	RateLimit float64  `long:"ratelimit" value-name:"<ops/s>" description:"apply at most this many operations per second"`
+
+	StatsInterval int    `long:"statsInterval" value-name:"<seconds>" description:"log the applied ops/sec, bytes/sec and lag behind the source every this many seconds; off by default"`
+	MetricsAddr   string `long:"metricsAddr" value-name:"<host:port>" description:"serve replay metrics to Prometheus at http://<host:port>/metrics"`
 }
 
 // Name returns a human-readable group name for source options.
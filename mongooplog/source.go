@@ -0,0 +1,99 @@
+package mongooplog
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"io"
+	"os"
+)
+
+// oplogSource yields the oplog entries to apply, as from a cursor on the
+// source server's oplog or from an oplog.bson file.
+type oplogSource interface {
+	Next(result interface{}) bool
+	Err() error
+	Close() error
+}
+
+// openSource opens the source of oplog entries, --fromFile or the oplog of
+// the --from server, returning a function releasing it once done.
+func (mo *MongoOplog) openSource(metrics *replayMetrics) (oplogSource, func(), error) {
+	if mo.SourceOptions.FromFile != "" {
+		source, err := openOplogFile(mo.SourceOptions.FromFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return source, func() { source.Close() }, nil
+	}
+	return mo.openServerOplog(metrics)
+}
+
+// openOplogFile opens a file of oplog entries, such as the oplog.bson
+// written by mongodump --oplog, or standard input if the path is "-".
+func openOplogFile(path string) (oplogSource, error) {
+	var in io.ReadCloser = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening --fromFile: %v", err)
+		}
+		in = file
+	}
+	log.Logf(log.DebugLow, "reading oplog entries from `%v`", path)
+	return db.NewDecodedBSONSource(db.NewBSONSource(in)), nil
+}
+
+// openServerOplog connects to the --from server and returns a cursor on its
+// oplog from --seconds ago, tracking the source's latest oplog timestamp
+// until the returned function is called.
+func (mo *MongoOplog) openServerOplog(metrics *replayMetrics) (oplogSource, func(), error) {
+	// split up the oplog namespace we are using
+	oplogDB, oplogColl, err :=
+		util.SplitAndValidateNamespace(mo.SourceOptions.OplogNS)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the full oplog namespace needs to be specified
+	if oplogColl == "" {
+		return nil, nil, fmt.Errorf("the oplog namespace must specify a collection")
+	}
+
+	log.Logf(log.DebugLow, "using oplog namespace `%v.%v`", oplogDB, oplogColl)
+
+	// connect to the source server
+	fromSession, err := mo.SessionProviderFrom.GetSession()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to source db: %v", err)
+	}
+	fromSession.SetSocketTimeout(0)
+
+	log.Logf(log.DebugLow, "successfully connected to source server `%v`", mo.SourceOptions.From)
+
+	// set slave ok
+	fromSession.SetMode(mgo.Eventual, true)
+
+	// get the tailing cursor for the source server's oplog
+	tail := buildTailingCursor(fromSession.DB(oplogDB).C(oplogColl),
+		mo.SourceOptions)
+
+	// the source is only polled if the stats are logged or served
+	if mo.SourceOptions.StatsInterval == 0 && mo.SourceOptions.MetricsAddr == "" {
+		return tail, func() {
+			tail.Close()
+			fromSession.Close()
+		}, nil
+	}
+	monitorSession := fromSession.Copy()
+	stopMonitor := mo.monitor(monitorSession.DB(oplogDB).C(oplogColl), metrics)
+	return tail, func() {
+		stopMonitor()
+		monitorSession.Close()
+		tail.Close()
+		fromSession.Close()
+	}, nil
+}
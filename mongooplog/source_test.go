@@ -0,0 +1,48 @@
+package mongooplog
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOplogFileSource(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The entries of an oplog.bson file should be read in order", t, func() {
+		file, err := ioutil.TempFile("", "oplog")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+		for _, entry := range []db.Oplog{
+			{Timestamp: bson.MongoTimestamp(1 << 32), Operation: "i", Namespace: "test.c", Object: bson.M{"_id": 1}},
+			{Timestamp: bson.MongoTimestamp(2 << 32), Operation: "d", Namespace: "test.c", Object: bson.M{"_id": 1}},
+		} {
+			raw, err := bson.Marshal(entry)
+			So(err, ShouldBeNil)
+			_, err = file.Write(raw)
+			So(err, ShouldBeNil)
+		}
+		So(file.Close(), ShouldBeNil)
+
+		// its entries should be read in order
+		source, err := openOplogFile(file.Name())
+		So(err, ShouldBeNil)
+		defer source.Close()
+		operations := []string{}
+		entry := db.Oplog{}
+		for source.Next(&entry) {
+			operations = append(operations, entry.Operation)
+		}
+		So(source.Err(), ShouldBeNil)
+		So(operations, ShouldResemble, []string{"i", "d"})
+	})
+
+	Convey("A missing file should be an error", t, func() {
+		_, err := openOplogFile("/nonexistent/oplog.bson")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,84 @@
+// Main package for the mongoprune tool.
+package main
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/util"
+	"github.com/mongodb/mongo-tools/mongoprune"
+	"os"
+)
+
+func main() {
+	go signals.Handle()
+
+	// initialize command line options
+	opts := options.New("mongoprune", mongoprune.Usage,
+		options.EnabledOptions{Auth: true, Connection: true, Namespace: false})
+
+	// add the mongoprune-specific options
+	pruneOpts := &mongoprune.PruneOptions{}
+	opts.AddOptions(pruneOpts)
+
+	// parse the command line options
+	args, err := opts.Parse()
+	if err != nil {
+		log.Logf(log.Always, "error parsing command line options: %v", err)
+		log.Logf(log.Always, "try 'mongoprune --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if len(args) != 0 {
+		log.Logf(log.Always, "positional arguments not allowed: %v", args)
+		log.Logf(log.Always, "try 'mongoprune --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	// print help, if specified
+	if opts.PrintHelp(false) {
+		return
+	}
+
+	// print version, if specified
+	if opts.PrintVersion() {
+		return
+	}
+
+	// init logger
+	log.SetVerbosity(opts.Verbosity)
+
+	// connect directly, unless a replica set name is explicitly specified
+	_, setName := util.ParseConnectionString(opts.Host)
+	opts.Direct = (setName == "")
+	opts.ReplicaSetName = setName
+
+	prune := mongoprune.MongoPrune{
+		ToolOptions:  opts,
+		PruneOptions: pruneOpts,
+	}
+
+	if err = prune.ValidateSettings(); err != nil {
+		log.Logf(log.Always, "error validating settings: %v", err)
+		log.Logf(log.Always, "try 'mongoprune --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	prune.SessionProvider, err = db.NewSessionProvider(*opts)
+	if err != nil {
+		log.Logf(log.Always, "error connecting to host: %v", err)
+		os.Exit(util.ExitError)
+	}
+
+	deleted, err := prune.Run()
+	if err != nil {
+		log.Logf(log.Always, "error: %v", err)
+		os.Exit(util.ExitError)
+	}
+	if pruneOpts.DryRun {
+		log.Logf(log.Always, "would delete %v documents in total", deleted)
+	} else {
+		log.Logf(log.Always, "deleted %v documents in total", deleted)
+	}
+}
@@ -0,0 +1,129 @@
+// Package mongoprune deletes the documents matching age and filter rules, in rate-limited batches.
+package mongoprune
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"time"
+)
+
+const (
+	progressBarLength   = 24
+	progressBarWaitTime = time.Second * 3
+)
+
+// MongoPrune is a container for the user-specified options and the rules
+// for running mongoprune.
+type MongoPrune struct {
+	// standard tool options
+	ToolOptions *options.ToolOptions
+
+	// mongoprune-specific options
+	PruneOptions *PruneOptions
+
+	// session provider for the server
+	SessionProvider *db.SessionProvider
+
+	// the rules read from the config, and the time their ages are
+	// measured from
+	rules []Rule
+	asOf  time.Time
+
+	limiter *db.RateLimiter
+}
+
+// ValidateSettings checks the options and loads the rules of the config.
+func (prune *MongoPrune) ValidateSettings() error {
+	if prune.PruneOptions.Config == "" {
+		return fmt.Errorf("need to specify --config")
+	}
+	if prune.PruneOptions.BatchSize <= 0 {
+		return fmt.Errorf("--batchSize must be positive")
+	}
+	if prune.PruneOptions.RateLimit < 0 {
+		return fmt.Errorf("--ratelimit can not be negative")
+	}
+	prune.asOf = time.Now()
+	if prune.PruneOptions.AsOf != "" {
+		asOf, err := time.Parse(time.RFC3339, prune.PruneOptions.AsOf)
+		if err != nil {
+			return fmt.Errorf("invalid --asOf '%v', expected a date and time such as 2024-05-01T00:00:00Z",
+				prune.PruneOptions.AsOf)
+		}
+		prune.asOf = asOf
+	}
+	rules, err := ReadRules(prune.PruneOptions.Config)
+	if err != nil {
+		return err
+	}
+	prune.rules = rules
+	prune.limiter = db.NewRateLimiter(prune.PruneOptions.RateLimit)
+	return nil
+}
+
+// Run applies each rule in turn, returning the number of documents deleted,
+// or that would be with --dryRun.
+func (prune *MongoPrune) Run() (int64, error) {
+	session, err := prune.SessionProvider.GetSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	total := int64(0)
+	for _, rule := range prune.rules {
+		deleted, err := prune.applyRule(session, rule)
+		total += deleted
+		if err != nil {
+			return total, fmt.Errorf("error pruning %v: %v", rule.Namespace, err)
+		}
+	}
+	return total, nil
+}
+
+// applyRule deletes the documents matching the rule in batches, or counts
+// them with --dryRun.
+func (prune *MongoPrune) applyRule(session *mgo.Session, rule Rule) (int64, error) {
+	dbName, collName, err := util.SplitAndValidateNamespace(rule.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	collection := session.DB(dbName).C(collName)
+	query := rule.Query(prune.asOf)
+
+	count, err := collection.Find(query).Count()
+	if err != nil {
+		return 0, err
+	}
+	if prune.PruneOptions.DryRun {
+		log.Logf(log.Always, "%v: would delete %v documents matching %v",
+			rule.Namespace, count, formatQuery(query))
+		return int64(count), nil
+	}
+	log.Logf(log.Info, "%v: deleting ~%v documents matching %v", rule.Namespace, count, formatQuery(query))
+
+	pruneProgressor := progress.NewCounter(int64(count))
+	bar := &progress.Bar{
+		Name:      rule.Namespace,
+		Watching:  pruneProgressor,
+		BarLength: progressBarLength,
+		ShowRate:  true,
+	}
+	progressManager := progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
+	progressManager.Attach(bar)
+	progressManager.Start()
+	defer progressManager.Stop()
+
+	deleted, err := db.DeleteInBatches(collection, query, prune.PruneOptions.BatchSize,
+		prune.limiter, pruneProgressor.Inc)
+	if err != nil {
+		return deleted, err
+	}
+	log.Logf(log.Always, "%v: deleted %v documents", rule.Namespace, deleted)
+	return deleted, nil
+}
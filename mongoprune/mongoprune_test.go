@@ -0,0 +1,97 @@
+package mongoprune
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With ages to parse", t, func() {
+		Convey("each unit should be accepted", func() {
+			age, err := ParseAge("45s")
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, 45*time.Second)
+			age, err = ParseAge("12h")
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, 12*time.Hour)
+			age, err = ParseAge("30d")
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, 30*24*time.Hour)
+			age, err = ParseAge("2w")
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, 14*24*time.Hour)
+		})
+
+		Convey("invalid ages should be rejected", func() {
+			for _, age := range []string{"", "30", "d", "-1d", "0d", "1.5h", "3y"} {
+				_, err := ParseAge(age)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestLoadRules(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a config of rules", t, func() {
+		Convey("a sequence of rules should be loaded", func() {
+			rules, err := LoadRules(strings.NewReader(`
+				{ns: "logs.events", field: "createdAt", olderThan: "30d", filter: {level: "debug"}}
+				{"ns": "app.sessions", "field": "lastSeen", "olderThan": "12h"}`))
+			So(err, ShouldBeNil)
+			So(len(rules), ShouldEqual, 2)
+			So(rules[0].Namespace, ShouldEqual, "logs.events")
+			So(rules[0].Field, ShouldEqual, "createdAt")
+			So(rules[0].OlderThan, ShouldEqual, 30*24*time.Hour)
+			So(rules[0].Filter, ShouldResemble, bson.M{"level": "debug"})
+			So(rules[1].Namespace, ShouldEqual, "app.sessions")
+			So(rules[1].Filter, ShouldBeNil)
+		})
+
+		Convey("invalid rules should be rejected", func() {
+			for _, config := range []string{
+				``,
+				`{ns: "logs", field: "createdAt", olderThan: "30d"}`,
+				`{ns: "logs.events", olderThan: "30d"}`,
+				`{ns: "logs.events", field: "$createdAt", olderThan: "30d"}`,
+				`{ns: "logs.events", field: "createdAt"}`,
+				`{ns: "logs.events", field: "createdAt", olderThan: "30"}`,
+				`{ns: "logs.events", field: "createdAt", olderThan: "30d", filter: 1}`,
+				`{ns: "logs.events", field: "createdAt", olderThan: "30d", limit: 5}`,
+				`{ns: "logs.events"`,
+			} {
+				_, err := LoadRules(strings.NewReader(config))
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestRuleQuery(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a rule", t, func() {
+		asOf := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+		cutoff := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		rule := Rule{Namespace: "logs.events", Field: "createdAt", OlderThan: 30 * 24 * time.Hour}
+
+		Convey("its query should select the documents older than the age", func() {
+			So(rule.Query(asOf), ShouldResemble, bson.M{"createdAt": bson.M{"$lt": cutoff}})
+		})
+
+		Convey("its query should also match its filter", func() {
+			rule.Filter = bson.M{"level": "debug"}
+			So(rule.Query(asOf), ShouldResemble, bson.M{"$and": []interface{}{
+				bson.M{"level": "debug"},
+				bson.M{"createdAt": bson.M{"$lt": cutoff}},
+			}})
+		})
+	})
+}
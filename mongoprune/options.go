@@ -0,0 +1,24 @@
+package mongoprune
+
+var Usage = `--config <filename> <options>
+
+Delete the documents matching the age and filter rules of a config file, in rate-limited batches.
+
+Each rule of the config file is a JSON document such as
+  {ns: "logs.events", field: "createdAt", olderThan: "30d", filter: {level: "debug"}}
+deleting the documents of the namespace whose field is a date older than the age, in
+s, m, h, d or w units, and that match the optional filter.`
+
+// PruneOptions defines the set of options for deleting documents.
+type PruneOptions struct {
+	Config    string  `long:"config" value-name:"<filename>" description:"file of prune rules, a sequence of JSON documents such as {ns: \"logs.events\", field: \"createdAt\", olderThan: \"30d\", filter: {level: \"debug\"}}"`
+	DryRun    bool    `long:"dryRun" description:"only count the documents each rule would delete, and print the query selecting them, e.g. to export them first with mongodump --query"`
+	AsOf      string  `long:"asOf" value-name:"<time>" description:"measure ages from this date and time, e.g. 2024-05-01T00:00:00Z, rather than from now, so that a prune deletes what a dry run or an export with the same cutoff selected"`
+	BatchSize int     `long:"batchSize" value-name:"<count>" default:"1000" default-mask:"-" description:"number of documents to delete per batch (defaults to 1000)"`
+	RateLimit float64 `long:"ratelimit" value-name:"<documents/s>" description:"delete at most this many documents per second, across all rules"`
+}
+
+// Name returns a human-readable group name for prune options.
+func (_ *PruneOptions) Name() string {
+	return "prune"
+}
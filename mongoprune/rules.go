@@ -0,0 +1,157 @@
+package mongoprune
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule selects the documents of a namespace to delete: those whose date
+// field is older than an age, and that match an optional filter.
+type Rule struct {
+	Namespace string
+	Field     string
+	OlderThan time.Duration
+	Filter    bson.M
+}
+
+// ageUnits are the units of a rule's olderThan age.
+var ageUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// ParseAge parses an age such as "30d" or "12h": a whole number followed by
+// a unit of s, m, h, d or w.
+func ParseAge(age string) (time.Duration, error) {
+	age = strings.TrimSpace(age)
+	if age == "" {
+		return 0, fmt.Errorf("empty age")
+	}
+	unit, ok := ageUnits[age[len(age)-1:]]
+	if !ok {
+		return 0, fmt.Errorf("invalid age '%v', expected a number followed by s, m, h, d or w", age)
+	}
+	count, err := strconv.ParseInt(age[:len(age)-1], 10, 64)
+	if err != nil || count <= 0 {
+		return 0, fmt.Errorf("invalid age '%v', expected a positive number followed by s, m, h, d or w", age)
+	}
+	return time.Duration(count) * unit, nil
+}
+
+// LoadRules reads the prune rules of a config: a sequence of extended JSON
+// documents such as {ns: "logs.events", field: "createdAt", olderThan: "30d"},
+// with an optional filter document.
+func LoadRules(reader io.Reader) ([]Rule, error) {
+	decoder := json.NewDecoder(reader)
+	var rules []Rule
+	for {
+		var asJSON interface{}
+		err := decoder.Decode(&asJSON)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing rule %v: %v", len(rules)+1, err)
+		}
+		rule, err := newRule(asJSON)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %v: %v", len(rules)+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules")
+	}
+	return rules, nil
+}
+
+func newRule(asJSON interface{}) (Rule, error) {
+	rule := Rule{}
+	converted, err := bsonutil.ConvertJSONValueToBSON(asJSON)
+	if err != nil {
+		return rule, err
+	}
+	doc, ok := converted.(map[string]interface{})
+	if !ok {
+		return rule, fmt.Errorf("expected a document")
+	}
+	for key := range doc {
+		if key != "ns" && key != "field" && key != "olderThan" && key != "filter" {
+			return rule, fmt.Errorf("unknown field '%v'", key)
+		}
+	}
+
+	if rule.Namespace, ok = doc["ns"].(string); !ok {
+		return rule, fmt.Errorf("'ns' must be a string")
+	}
+	_, collection, err := util.SplitAndValidateNamespace(rule.Namespace)
+	if err != nil {
+		return rule, err
+	}
+	if collection == "" {
+		return rule, fmt.Errorf("'ns' must be a <database>.<collection> namespace")
+	}
+	if rule.Field, ok = doc["field"].(string); !ok || rule.Field == "" || strings.HasPrefix(rule.Field, "$") {
+		return rule, fmt.Errorf("'field' must be the name of a date field")
+	}
+	age, ok := doc["olderThan"].(string)
+	if !ok {
+		return rule, fmt.Errorf("'olderThan' must be an age such as \"30d\"")
+	}
+	if rule.OlderThan, err = ParseAge(age); err != nil {
+		return rule, err
+	}
+	if filter, present := doc["filter"]; present {
+		asMap, ok := filter.(map[string]interface{})
+		if !ok {
+			return rule, fmt.Errorf("'filter' must be a document")
+		}
+		rule.Filter = bson.M(asMap)
+	}
+	return rule, nil
+}
+
+// ReadRules loads the rules from the --config file.
+func ReadRules(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening config: %v", err)
+	}
+	defer file.Close()
+	return LoadRules(file)
+}
+
+// Query returns the query selecting the documents the rule deletes, for
+// ages measured from asOf.
+func (rule Rule) Query(asOf time.Time) bson.M {
+	query := bson.M{rule.Field: bson.M{"$lt": asOf.Add(-rule.OlderThan)}}
+	if len(rule.Filter) > 0 {
+		query = bson.M{"$and": []interface{}{rule.Filter, query}}
+	}
+	return query
+}
+
+// formatQuery returns the query as extended JSON, as mongodump --query
+// takes it.
+func formatQuery(query bson.M) string {
+	out, err := bsonutil.ConvertBSONValueToJSON(query)
+	if err != nil {
+		return fmt.Sprintf("%v", query)
+	}
+	formatted, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Sprintf("%v", query)
+	}
+	return string(formatted)
+}
@@ -0,0 +1,120 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+)
+
+// archiveEntry is a namespace in an archive's table of contents.
+type archiveEntry struct {
+	namespace string
+	documents int64
+	bytes     int64
+}
+
+// archiveLister reads the body of an archive, counting the documents and
+// bytes of each namespace. It implements archive.SkippingConsumer, skipping
+// the namespaces --nsInclude leaves out.
+type archiveLister struct {
+	restore *MongoRestore
+	entries map[string]*archiveEntry
+	current *archiveEntry
+}
+
+// HeaderBSON is part of the archive.ParserConsumer interface.
+func (lister *archiveLister) HeaderBSON(data []byte) error {
+	header := archive.NamespaceHeader{}
+	if err := bson.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("error reading namespace header: %v", err)
+	}
+	lister.current = lister.entries[header.Database+"."+header.Collection]
+	return nil
+}
+
+// BodyBSON is part of the archive.ParserConsumer interface.
+func (lister *archiveLister) BodyBSON(data []byte) error {
+	if lister.current == nil {
+		return fmt.Errorf("collection data without a collection header")
+	}
+	lister.current.documents++
+	lister.current.bytes += int64(len(data))
+	return nil
+}
+
+// End is part of the archive.ParserConsumer interface.
+func (lister *archiveLister) End() error {
+	return nil
+}
+
+// SkipBody is part of the archive.SkippingConsumer interface.
+func (lister *archiveLister) SkipBody() bool {
+	return lister.current == nil
+}
+
+// archiveNamespace returns the namespace of a collection in an archive's
+// prelude, as the archive's namespace headers name it.
+func archiveNamespace(metadata *archive.CollectionMetadata) string {
+	return metadata.Database + "." + metadata.Collection
+}
+
+// ListArchive writes the table of contents of the --archive to out: its
+// namespaces, in the order of its prelude, with the number of documents
+// and bytes of each. The whole archive is read to count them.
+func (restore *MongoRestore) ListArchive(out io.Writer) error {
+	if restore.InputOptions.Archive == "" {
+		return fmt.Errorf("--list requires --archive")
+	}
+	var err error
+	restore.nsInclude, err = compileNSIncludes(restore.OutputOptions.NSInclude)
+	if err != nil {
+		return err
+	}
+
+	in, err := restore.getArchiveReader()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	prelude := &archive.Prelude{}
+	if err = prelude.Read(in); err != nil {
+		return err
+	}
+
+	lister := &archiveLister{restore: restore, entries: map[string]*archiveEntry{}}
+	listed := []*archiveEntry{}
+	for _, metadata := range prelude.NamespaceMetadatas {
+		namespace := archiveNamespace(metadata)
+		if metadata.Database != "" && !restore.nsIncluded(namespace) {
+			continue
+		}
+		entry := &archiveEntry{namespace: namespace}
+		if metadata.Database == "" {
+			// the oplog is not in any database
+			entry.namespace = metadata.Collection
+		}
+		lister.entries[namespace] = entry
+		listed = append(listed, entry)
+	}
+	parser := archive.Parser{In: in}
+	if err = parser.ReadAllBlocks(lister); err != nil {
+		return fmt.Errorf("error reading archive: %v", err)
+	}
+
+	grid := &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("ns", "documents", "size")
+	grid.EndRow()
+	var documents, bytes int64
+	for _, entry := range listed {
+		grid.WriteCells(entry.namespace, fmt.Sprint(entry.documents), text.FormatByteAmount(entry.bytes))
+		grid.EndRow()
+		documents += entry.documents
+		bytes += entry.bytes
+	}
+	grid.WriteCells("total", fmt.Sprint(documents), text.FormatByteAmount(bytes))
+	grid.EndRow()
+	grid.Flush(out)
+	return nil
+}
@@ -0,0 +1,88 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestArchive writes an archive holding the given number of documents
+// for each collection of the database "test".
+func writeTestArchive(path string, collections []string, counts []int) error {
+	out := &bytes.Buffer{}
+	prelude := &archive.Prelude{Header: &archive.Header{FormatVersion: "0.1"}}
+	for _, collection := range collections {
+		prelude.AddMetadata(&archive.CollectionMetadata{Database: "test", Collection: collection})
+	}
+	if err := prelude.Write(out); err != nil {
+		return err
+	}
+	terminator := []byte{0xFF, 0xFF, 0xFF, 0xFF}
+	for i, collection := range collections {
+		for _, eof := range []bool{false, true} {
+			header, err := bson.Marshal(archive.NamespaceHeader{Database: "test", Collection: collection, EOF: eof})
+			if err != nil {
+				return err
+			}
+			out.Write(header)
+			for j := 0; !eof && j < counts[i]; j++ {
+				doc, err := bson.Marshal(bson.D{{"_id", j}})
+				if err != nil {
+					return err
+				}
+				out.Write(doc)
+			}
+			out.Write(terminator)
+		}
+	}
+	return ioutil.WriteFile(path, out.Bytes(), 0644)
+}
+
+func TestListArchive(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive of two collections", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_list")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "archive")
+		So(writeTestArchive(path, []string{"a", "b"}, []int{3, 5}), ShouldBeNil)
+
+		restore := &MongoRestore{
+			InputOptions:  &InputOptions{Archive: path, List: true},
+			OutputOptions: &OutputOptions{},
+		}
+
+		Convey("listing it should count the documents of each", func() {
+			out := &bytes.Buffer{}
+			So(restore.ListArchive(out), ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			So(len(lines), ShouldEqual, 4)
+			So(strings.Fields(lines[1])[:2], ShouldResemble, []string{"test.a", "3"})
+			So(strings.Fields(lines[2])[:2], ShouldResemble, []string{"test.b", "5"})
+			So(strings.Fields(lines[3])[:2], ShouldResemble, []string{"total", "8"})
+		})
+
+		Convey("listing it with --nsInclude should skip the other collections", func() {
+			restore.OutputOptions.NSInclude = []string{"test.b"}
+			out := &bytes.Buffer{}
+			So(restore.ListArchive(out), ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			So(len(lines), ShouldEqual, 3)
+			So(strings.Fields(lines[1])[:2], ShouldResemble, []string{"test.b", "5"})
+		})
+
+		Convey("listing requires --archive", func() {
+			restore.InputOptions.Archive = ""
+			So(restore.ListArchive(&bytes.Buffer{}), ShouldNotBeNil)
+		})
+	})
+}
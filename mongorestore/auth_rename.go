@@ -0,0 +1,116 @@
+package mongorestore
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// documentTransformer rewrites each document restored to a collection.
+type documentTransformer interface {
+	Apply(raw []byte) ([]byte, error)
+}
+
+// authRenamer rewrites the user and role documents restored through the
+// temporary auth collections, so that users, roles and the grants in them
+// follow their databases when --nsFrom and --nsTo rename them.
+type authRenamer struct {
+	renamer *nsRenamer
+}
+
+// Apply is part of the documentTransformer interface.
+func (ar *authRenamer) Apply(raw []byte) ([]byte, error) {
+	doc := bson.D{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return bson.Marshal(ar.renameAuthDocument(doc))
+}
+
+// renameAuthDocument renames the databases in a user or role document: its
+// own db and the _id prefixed with it, the db of each role it is granted,
+// and, for roles, the resource of each privilege.
+func (ar *authRenamer) renameAuthDocument(doc bson.D) bson.D {
+	fromDB := ""
+	for _, elem := range doc {
+		if elem.Name == "db" {
+			fromDB, _ = elem.Value.(string)
+		}
+	}
+	for i, elem := range doc {
+		switch elem.Name {
+		case "_id":
+			if id, ok := elem.Value.(string); ok && fromDB != "" && strings.HasPrefix(id, fromDB+".") {
+				doc[i].Value = ar.renamer.RenameDB(fromDB) + strings.TrimPrefix(id, fromDB)
+			}
+		case "db":
+			doc[i].Value = ar.renamer.RenameDB(fromDB)
+		case "roles":
+			doc[i].Value = ar.renameEach(elem.Value, ar.renameRoleGrant)
+		case "privileges":
+			doc[i].Value = ar.renameEach(elem.Value, ar.renamePrivilege)
+		}
+	}
+	return doc
+}
+
+// renameEach applies rename to each embedded document in an array.
+func (ar *authRenamer) renameEach(value interface{}, rename func(bson.D) bson.D) interface{} {
+	values, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	for i, v := range values {
+		if d, ok := v.(bson.D); ok {
+			values[i] = rename(d)
+		}
+	}
+	return values
+}
+
+// renameRoleGrant renames the database of a {role, db} grant.
+func (ar *authRenamer) renameRoleGrant(grant bson.D) bson.D {
+	for i, elem := range grant {
+		if dbName, ok := elem.Value.(string); ok && elem.Name == "db" {
+			grant[i].Value = ar.renamer.RenameDB(dbName)
+		}
+	}
+	return grant
+}
+
+// renamePrivilege renames the resource of a {resource, actions} privilege.
+// A resource naming a collection follows the collection's renaming, and one
+// naming only a database follows the database's. An empty db, which means
+// any database, is kept.
+func (ar *authRenamer) renamePrivilege(privilege bson.D) bson.D {
+	for i, elem := range privilege {
+		resource, ok := elem.Value.(bson.D)
+		if elem.Name != "resource" || !ok {
+			continue
+		}
+		dbIndex, colIndex := -1, -1
+		var dbName, colName string
+		for j, field := range resource {
+			switch field.Name {
+			case "db":
+				dbIndex = j
+				dbName, _ = field.Value.(string)
+			case "collection":
+				colIndex = j
+				colName, _ = field.Value.(string)
+			}
+		}
+		if dbIndex == -1 || dbName == "" {
+			continue
+		}
+		if colIndex == -1 || colName == "" {
+			resource[dbIndex].Value = ar.renamer.RenameDB(dbName)
+		} else {
+			renamed := ar.renamer.target(dbName + "." + colName)
+			if parts := strings.SplitN(renamed, ".", 2); len(parts) == 2 {
+				resource[dbIndex].Value, resource[colIndex].Value = parts[0], parts[1]
+			}
+		}
+		privilege[i].Value = resource
+	}
+	return privilege
+}
@@ -0,0 +1,75 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestAuthRenamer(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With users and roles restored while renaming prod to staging", t, func() {
+		renamer, err := newNSRenamer([]string{"prod.*", "shared.orders"}, []string{"staging.*", "shared.staging_orders"})
+		So(err, ShouldBeNil)
+		ar := &authRenamer{renamer}
+
+		Convey("a user of prod should become a user of staging, with its grants", func() {
+			user := bson.D{
+				{"_id", "prod.app"},
+				{"user", "app"},
+				{"db", "prod"},
+				{"roles", []interface{}{
+					bson.D{{"role", "readWrite"}, {"db", "prod"}},
+					bson.D{{"role", "read"}, {"db", "reporting"}},
+				}},
+			}
+			raw, err := bson.Marshal(user)
+			So(err, ShouldBeNil)
+			renamedRaw, err := ar.Apply(raw)
+			So(err, ShouldBeNil)
+			renamed := bson.D{}
+			So(bson.Unmarshal(renamedRaw, &renamed), ShouldBeNil)
+			So(renamed, ShouldResemble, bson.D{
+				{"_id", "staging.app"},
+				{"user", "app"},
+				{"db", "staging"},
+				{"roles", []interface{}{
+					bson.D{{"role", "readWrite"}, {"db", "staging"}},
+					bson.D{{"role", "read"}, {"db", "reporting"}},
+				}},
+			})
+		})
+
+		Convey("privilege resources should follow their database or collection", func() {
+			role := bson.D{
+				{"_id", "prod.auditor"},
+				{"role", "auditor"},
+				{"db", "prod"},
+				{"privileges", []interface{}{
+					bson.D{{"resource", bson.D{{"db", "prod"}, {"collection", ""}}}, {"actions", []interface{}{"find"}}},
+					bson.D{{"resource", bson.D{{"db", "shared"}, {"collection", "orders"}}}, {"actions", []interface{}{"find"}}},
+					bson.D{{"resource", bson.D{{"db", ""}, {"collection", "logs"}}}, {"actions", []interface{}{"find"}}},
+				}},
+			}
+			renamed := ar.renameAuthDocument(role)
+			So(renamed[0].Value, ShouldEqual, "staging.auditor")
+			privileges := renamed[3].Value.([]interface{})
+			So(privileges[0].(bson.D)[0].Value, ShouldResemble, bson.D{{"db", "staging"}, {"collection", ""}})
+			So(privileges[1].(bson.D)[0].Value, ShouldResemble, bson.D{{"db", "shared"}, {"collection", "staging_orders"}})
+			So(privileges[2].(bson.D)[0].Value, ShouldResemble, bson.D{{"db", ""}, {"collection", "logs"}})
+		})
+	})
+
+	Convey("The temporary auth collections should only be transformed when renaming", t, func() {
+		restore := &MongoRestore{tempUsersCol: "tempusers", tempRolesCol: "temproles"}
+		So(restore.transformFor("admin", "tempusers"), ShouldBeNil)
+		renamer, err := newNSRenamer([]string{"prod.*"}, []string{"staging.*"})
+		So(err, ShouldBeNil)
+		restore.renamer = renamer
+		So(restore.transformFor("admin", "temproles"), ShouldNotBeNil)
+		So(restore.transformFor("prod", "users"), ShouldBeNil)
+	})
+}
@@ -0,0 +1,316 @@
+package mongorestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkpointInterval is how often the restore's progress is saved to the
+// --stateFile while collections are being restored.
+const checkpointInterval = 10 * time.Second
+
+// restoreState is the progress of a restore, as saved to the --stateFile.
+type restoreState struct {
+	// Completed lists the namespaces whose documents have all been restored
+	Completed []string `json:"completed"`
+
+	// Offsets holds, for each partly restored namespace, the number of bytes
+	// at the start of its BSON file whose documents have all been inserted
+	Offsets map[string]int64 `json:"offsets"`
+}
+
+// checkpointer records which collections have been restored, and how far
+// into each BSON file the restore has got, saving it to the --stateFile so
+// that an interrupted restore can be continued with --resume. A nil
+// checkpointer records nothing.
+type checkpointer struct {
+	path string
+
+	mutex     sync.Mutex
+	completed map[string]bool
+	offsets   map[string]int64
+	trackers  map[string]*offsetTracker
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newCheckpointer returns a checkpointer saving to the given path. With
+// resume set, the progress already saved there is loaded, and a missing
+// file starts a new restore.
+func newCheckpointer(path string, resume bool) (*checkpointer, error) {
+	cp := &checkpointer{
+		path:      path,
+		completed: map[string]bool{},
+		offsets:   map[string]int64{},
+		trackers:  map[string]*offsetTracker{},
+	}
+	if !resume {
+		return cp, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Logf(log.Always, "no state file found at %v, starting a new restore", path)
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading --stateFile: %v", err)
+	}
+	state := restoreState{}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing --stateFile %v: %v", path, err)
+	}
+	for _, ns := range state.Completed {
+		cp.completed[ns] = true
+	}
+	for ns, offset := range state.Offsets {
+		cp.offsets[ns] = offset
+	}
+	log.Logf(log.Always, "resuming restore: %v collections already restored, %v partly restored",
+		len(cp.completed), len(cp.offsets))
+	return cp, nil
+}
+
+// isCompleted returns true if all of the namespace's documents were
+// restored by an earlier run.
+func (cp *checkpointer) isCompleted(ns string) bool {
+	if cp == nil {
+		return false
+	}
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	return cp.completed[ns]
+}
+
+// resumeOffset returns the number of bytes of the namespace's BSON file
+// whose documents were inserted by an earlier run.
+func (cp *checkpointer) resumeOffset(ns string) int64 {
+	if cp == nil {
+		return 0
+	}
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	return cp.offsets[ns]
+}
+
+// hasProgress returns true if an earlier run restored some or all of the
+// namespace's documents, which must then be kept.
+func (cp *checkpointer) hasProgress(ns string) bool {
+	if cp == nil {
+		return false
+	}
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	return cp.completed[ns] || cp.offsets[ns] > 0
+}
+
+// track starts recording the progress through the namespace's BSON file,
+// whose documents are restored from the given offset.
+func (cp *checkpointer) track(ns string, offset int64) *offsetTracker {
+	if cp == nil {
+		return nil
+	}
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	tracker := newOffsetTracker(offset)
+	cp.trackers[ns] = tracker
+	return tracker
+}
+
+// tracker returns the offset tracker for the namespace, or nil if its
+// progress isn't being recorded.
+func (cp *checkpointer) tracker(ns string) *offsetTracker {
+	if cp == nil {
+		return nil
+	}
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	return cp.trackers[ns]
+}
+
+// complete records that all of the namespace's documents have been
+// restored, and saves the progress.
+func (cp *checkpointer) complete(ns string) error {
+	if cp == nil {
+		return nil
+	}
+	cp.mutex.Lock()
+	cp.completed[ns] = true
+	delete(cp.offsets, ns)
+	delete(cp.trackers, ns)
+	cp.mutex.Unlock()
+	return cp.save()
+}
+
+// state returns the progress recorded so far.
+func (cp *checkpointer) state() restoreState {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	state := restoreState{
+		Completed: []string{},
+		Offsets:   map[string]int64{},
+	}
+	for ns := range cp.completed {
+		state.Completed = append(state.Completed, ns)
+	}
+	sort.Strings(state.Completed)
+	// keep the offsets loaded from an earlier run until their collections
+	// are restored further
+	for ns, offset := range cp.offsets {
+		state.Offsets[ns] = offset
+	}
+	for ns, tracker := range cp.trackers {
+		if offset := tracker.offset(); offset > 0 {
+			state.Offsets[ns] = offset
+		}
+	}
+	return state
+}
+
+// save writes the progress to the --stateFile, replacing it atomically so
+// an interruption never leaves it half-written.
+func (cp *checkpointer) save() error {
+	if cp == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(cp.state(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(cp.path), filepath.Base(cp.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error writing --stateFile: %v", err)
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), cp.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing --stateFile: %v", err)
+	}
+	return nil
+}
+
+// start saves the progress every checkpointInterval until stop is called.
+func (cp *checkpointer) start() {
+	if cp == nil {
+		return
+	}
+	cp.done = make(chan struct{})
+	cp.wg.Add(1)
+	go func() {
+		defer cp.wg.Done()
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cp.done:
+				return
+			case <-ticker.C:
+			}
+			if err := cp.save(); err != nil {
+				log.Logf(log.Always, "%v", err)
+			}
+		}
+	}()
+}
+
+// stop stops the periodic saves and saves the progress one last time.
+func (cp *checkpointer) stop() error {
+	if cp == nil || cp.done == nil {
+		return nil
+	}
+	close(cp.done)
+	cp.wg.Wait()
+	cp.done = nil
+	return cp.save()
+}
+
+// offsetTracker follows the documents of a BSON file through the insertion
+// workers. Each document is numbered as it is read, and the tracked offset
+// only moves past a document once it and every document before it have been
+// inserted, since the workers insert their batches in no particular order.
+// A nil offsetTracker tracks nothing.
+type offsetTracker struct {
+	mutex sync.Mutex
+
+	// number of the next document read, and the offset at its end
+	nextRead  int64
+	readEnd   int64
+	endOffset map[int64]int64
+
+	// numbers of inserted documents not yet contiguous with the offset
+	inserted map[int64]bool
+
+	// number of the first document not yet inserted, and the offset at its
+	// start
+	nextInserted int64
+	committed    int64
+}
+
+func newOffsetTracker(offset int64) *offsetTracker {
+	return &offsetTracker{
+		readEnd:   offset,
+		committed: offset,
+		endOffset: map[int64]int64{},
+		inserted:  map[int64]bool{},
+	}
+}
+
+// read records a document of the given size read from the file, returning
+// its number.
+func (tracker *offsetTracker) read(size int) int64 {
+	if tracker == nil {
+		return 0
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	seq := tracker.nextRead
+	tracker.nextRead++
+	tracker.readEnd += int64(size)
+	tracker.endOffset[seq] = tracker.readEnd
+	return seq
+}
+
+// done records that the numbered documents have been inserted, or
+// otherwise won't need inserting when resuming.
+func (tracker *offsetTracker) done(seqs ...int64) {
+	if tracker == nil {
+		return
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	for _, seq := range seqs {
+		tracker.inserted[seq] = true
+	}
+	for tracker.inserted[tracker.nextInserted] {
+		delete(tracker.inserted, tracker.nextInserted)
+		tracker.committed = tracker.endOffset[tracker.nextInserted]
+		delete(tracker.endOffset, tracker.nextInserted)
+		tracker.nextInserted++
+	}
+}
+
+// offset returns the number of bytes at the start of the file whose
+// documents have all been inserted.
+func (tracker *offsetTracker) offset() int64 {
+	if tracker == nil {
+		return 0
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return tracker.committed
+}
@@ -0,0 +1,102 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOffsetTracker(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an offset tracker resuming from byte 100", t, func() {
+		tracker := newOffsetTracker(100)
+		first := tracker.read(10)
+		second := tracker.read(20)
+		third := tracker.read(30)
+		So(tracker.offset(), ShouldEqual, 100)
+
+		Convey("the offset should only move past contiguous inserted documents", func() {
+			tracker.done(second)
+			So(tracker.offset(), ShouldEqual, 100)
+			tracker.done(first)
+			So(tracker.offset(), ShouldEqual, 130)
+			tracker.done(third)
+			So(tracker.offset(), ShouldEqual, 160)
+		})
+
+		Convey("a nil tracker should track nothing", func() {
+			var nilTracker *offsetTracker
+			So(nilTracker.read(10), ShouldEqual, 0)
+			nilTracker.done(0)
+			So(nilTracker.offset(), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestCheckpointer(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a state file in a temporary directory", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_checkpoint")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "restore.state")
+
+		Convey("resuming without a state file should start a new restore", func() {
+			cp, err := newCheckpointer(path, true)
+			So(err, ShouldBeNil)
+			So(cp.isCompleted("test.a"), ShouldBeFalse)
+			So(cp.resumeOffset("test.a"), ShouldEqual, 0)
+		})
+
+		Convey("progress should be saved and picked up when resuming", func() {
+			cp, err := newCheckpointer(path, false)
+			So(err, ShouldBeNil)
+			So(cp.complete("test.a"), ShouldBeNil)
+			tracker := cp.track("test.b", 0)
+			tracker.done(tracker.read(50))
+			tracker.read(50)
+			cp.track("test.c", 0)
+			So(cp.save(), ShouldBeNil)
+
+			resumed, err := newCheckpointer(path, true)
+			So(err, ShouldBeNil)
+			So(resumed.isCompleted("test.a"), ShouldBeTrue)
+			So(resumed.isCompleted("test.b"), ShouldBeFalse)
+			So(resumed.resumeOffset("test.b"), ShouldEqual, 50)
+			So(resumed.resumeOffset("test.c"), ShouldEqual, 0)
+
+			// collections with progress must not be dropped by --drop
+			So(resumed.hasProgress("test.a"), ShouldBeTrue)
+			So(resumed.hasProgress("test.b"), ShouldBeTrue)
+			So(resumed.hasProgress("test.c"), ShouldBeFalse)
+
+			Convey("and kept until the collection is restored further", func() {
+				So(resumed.save(), ShouldBeNil)
+				again, err := newCheckpointer(path, true)
+				So(err, ShouldBeNil)
+				So(again.resumeOffset("test.b"), ShouldEqual, 50)
+			})
+		})
+
+		Convey("a corrupt state file should be reported", func() {
+			So(ioutil.WriteFile(path, []byte("{"), 0644), ShouldBeNil)
+			_, err := newCheckpointer(path, true)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a nil checkpointer should record nothing", func() {
+			var cp *checkpointer
+			So(cp.complete("test.a"), ShouldBeNil)
+			So(cp.isCompleted("test.a"), ShouldBeFalse)
+			So(cp.hasProgress("test.a"), ShouldBeFalse)
+			So(cp.track("test.a", 0), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,123 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// optionsOverride is a --collectionOptionsOverride: collection options to
+// set, or to remove, when creating the collections matching its pattern.
+type optionsOverride struct {
+	// pattern matches the namespaces the override applies to, or is nil to
+	// apply it to every collection
+	pattern *regexp.Regexp
+
+	// set holds the options to set, and unset those given as null
+	set   bson.D
+	unset []string
+}
+
+// optionsOverrides are the --collectionOptionsOverride arguments, applied
+// in order.
+type optionsOverrides []optionsOverride
+
+// parseOptionsOverrides parses the --collectionOptionsOverride arguments.
+// Each is a JSON document of collection options, optionally preceded by a
+// namespace pattern and '=', such as
+// 'logs.*={capped: true, size: 1048576, validator: null}'. Options with a
+// null value are removed from the dumped options; others replace them.
+func parseOptionsOverrides(specs []string) (optionsOverrides, error) {
+	overrides := optionsOverrides{}
+	for _, spec := range specs {
+		override := optionsOverride{}
+		document := strings.TrimSpace(spec)
+		if !strings.HasPrefix(document, "{") {
+			i := strings.Index(document, "=")
+			if i < 0 {
+				return nil, fmt.Errorf("invalid --collectionOptionsOverride '%v': "+
+					"expected a JSON document, optionally preceded by a namespace pattern and '='", spec)
+			}
+			pattern, err := compileNSPattern(strings.TrimSpace(document[:i]))
+			if err == nil && strings.TrimSpace(document[:i]) == "" {
+				err = fmt.Errorf("empty namespace pattern")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid --collectionOptionsOverride '%v': %v", spec, err)
+			}
+			override.pattern = pattern
+			document = strings.TrimSpace(document[i+1:])
+		}
+
+		options := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(document), &options); err != nil {
+			return nil, fmt.Errorf("invalid --collectionOptionsOverride '%v': %v", spec, err)
+		}
+		if err := bsonutil.ConvertJSONDocumentToBSON(options); err != nil {
+			return nil, fmt.Errorf("invalid --collectionOptionsOverride '%v': %v", spec, err)
+		}
+		names := make([]string, 0, len(options))
+		for name := range options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if options[name] == nil {
+				override.unset = append(override.unset, name)
+			} else {
+				override.set = append(override.set, bson.DocElem{name, options[name]})
+			}
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+// apply returns the options to create the collection of the namespace with:
+// its dumped options, overridden by each override matching the namespace.
+func (overrides optionsOverrides) apply(namespace string, options bson.D) bson.D {
+	for _, override := range overrides {
+		if override.pattern != nil && !override.pattern.MatchString(namespace) {
+			continue
+		}
+		overridden := bson.D{}
+		for _, option := range options {
+			if !override.replaces(option.Name) {
+				overridden = append(overridden, option)
+			}
+		}
+		options = append(overridden, override.set...)
+	}
+	return options
+}
+
+// replaces returns true if the override sets or removes the option.
+func (override optionsOverride) replaces(name string) bool {
+	for _, unset := range override.unset {
+		if unset == name {
+			return true
+		}
+	}
+	for _, option := range override.set {
+		if option.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// optionsWithoutMetadata returns the options to create the collection of an
+// intent without a metadata file with: those of the overrides matching it,
+// or none. Special collections, and intents without documents, get none.
+func (restore *MongoRestore) optionsWithoutMetadata(intent *intents.Intent) bson.D {
+	if len(restore.optionsOverrides) == 0 || intent.MetadataPath != "" || intent.BSONPath == "" ||
+		strings.HasPrefix(intent.C, "system.") || intent.IsSpecialCollection() {
+		return nil
+	}
+	return restore.optionsOverrides.apply(intent.Namespace(), nil)
+}
@@ -0,0 +1,84 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestOptionsOverrides(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --collectionOptionsOverride arguments", t, func() {
+		overrides, err := parseOptionsOverrides([]string{
+			`{collation: {locale: "fr"}, validator: null}`,
+			`logs.*={capped: true, size: 1048576}`,
+		})
+		So(err, ShouldBeNil)
+		So(len(overrides), ShouldEqual, 2)
+
+		dumped := bson.D{
+			{"validator", bson.M{"age": bson.M{"$gte": 0}}},
+			{"collation", bson.M{"locale": "en"}},
+			{"validationLevel", "strict"},
+		}
+
+		Convey("options should be replaced, removed and added", func() {
+			options := overrides.apply("app.users", dumped)
+			So(options, ShouldResemble, bson.D{
+				{"validationLevel", "strict"},
+				{"collation", map[string]interface{}{"locale": "fr"}},
+			})
+		})
+
+		Convey("overrides with a pattern should only apply to matching namespaces", func() {
+			options := overrides.apply("logs.events", nil)
+			So(options, ShouldResemble, bson.D{
+				{"collation", map[string]interface{}{"locale": "fr"}},
+				{"capped", true},
+				{"size", int32(1048576)},
+			})
+		})
+
+		Convey("the dumped options should be left as they were", func() {
+			overrides.apply("app.users", dumped)
+			So(len(dumped), ShouldEqual, 3)
+		})
+
+		Convey("a collection dumped without metadata should be created with the matching overrides", func() {
+			restore := &MongoRestore{optionsOverrides: overrides}
+			intent := &intents.Intent{DB: "logs", C: "events", BSONPath: "logs/events.bson"}
+			So(restore.optionsWithoutMetadata(intent), ShouldResemble, bson.D{
+				{"collation", map[string]interface{}{"locale": "fr"}},
+				{"capped", true},
+				{"size", int32(1048576)},
+			})
+
+			Convey("but not one with metadata, whose dumped options are overridden instead", func() {
+				intent.MetadataPath = "logs/events.metadata.json"
+				So(restore.optionsWithoutMetadata(intent), ShouldBeNil)
+			})
+
+			Convey("nor a system collection", func() {
+				intent.C = "system.js"
+				So(restore.optionsWithoutMetadata(intent), ShouldBeNil)
+			})
+		})
+
+		Convey("without overrides, a collection dumped without metadata should get no options", func() {
+			restore := &MongoRestore{}
+			intent := &intents.Intent{DB: "logs", C: "events", BSONPath: "logs/events.bson"}
+			So(restore.optionsWithoutMetadata(intent), ShouldBeNil)
+		})
+	})
+
+	Convey("Malformed overrides should be rejected", t, func() {
+		for _, spec := range []string{"", "{capped: ", "logs.*", "={capped: true}", "logs.*=[1]"} {
+			_, err := parseOptionsOverrides([]string{spec})
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Kinds of collections, as told by their options. Time-series and clustered
+// collections and views can only be made by the create command, so they
+// must be created from their options before any document is inserted, which
+// would otherwise create a regular collection. Views hold no documents of
+// their own: those dumped from a view are computed from the collection it
+// is on. Capped collections are created with their dumped size and max,
+// and their documents inserted in order, as they are kept in insertion
+// order and the oldest are removed first.
+const (
+	collectionRegular    = "regular"
+	collectionTimeSeries = "time-series"
+	collectionClustered  = "clustered"
+	collectionView       = "view"
+	collectionCapped     = "capped"
+)
+
+// bucketsPrefix starts the names of the collections holding the buckets of
+// time-series collections.
+const bucketsPrefix = "system.buckets."
+
+// collectionKind returns the kind of collection the options create.
+func collectionKind(options bson.D) string {
+	for _, opt := range options {
+		switch opt.Name {
+		case "timeseries":
+			return collectionTimeSeries
+		case "clusteredIndex":
+			return collectionClustered
+		case "viewOn":
+			return collectionView
+		case "capped":
+			if util.IsTruthy(opt.Value) {
+				return collectionCapped
+			}
+		}
+	}
+	return collectionRegular
+}
+
+// createOptions returns the collection options from a dump's metadata as
+// the create command takes them. listCollections reports time-series and
+// clustered collections with fields create rejects: the bucketing
+// parameters derived from a time-series granularity, and the version of a
+// clustered index.
+func createOptions(options bson.D) bson.D {
+	created := bson.D{}
+	for _, opt := range options {
+		switch opt.Name {
+		case "timeseries":
+			// the bucketing parameters follow from the granularity, and
+			// create refuses both together
+			if hasField(opt.Value, "granularity") {
+				opt.Value = filterFields(opt.Value, func(name string) bool {
+					return name != "bucketMaxSpanSeconds" && name != "bucketRoundingSeconds"
+				})
+			}
+		case "clusteredIndex":
+			opt.Value = filterFields(opt.Value, func(name string) bool {
+				return name == "key" || name == "unique" || name == "name"
+			})
+		}
+		created = append(created, opt)
+	}
+	return created
+}
+
+// hasField returns true if the document, a bson.D or a map, has the field.
+func hasField(doc interface{}, name string) bool {
+	switch d := doc.(type) {
+	case bson.D:
+		for _, field := range d {
+			if field.Name == name {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		_, ok := d[name]
+		return ok
+	case bson.M:
+		_, ok := d[name]
+		return ok
+	}
+	return false
+}
+
+// filterFields returns a copy of the document, a bson.D or a map, with only
+// the fields keep accepts. Other values are returned unchanged.
+func filterFields(doc interface{}, keep func(name string) bool) interface{} {
+	switch d := doc.(type) {
+	case bson.D:
+		kept := bson.D{}
+		for _, field := range d {
+			if keep(field.Name) {
+				kept = append(kept, field)
+			}
+		}
+		return kept
+	case map[string]interface{}:
+		kept := map[string]interface{}{}
+		for name, value := range d {
+			if keep(name) {
+				kept[name] = value
+			}
+		}
+		return kept
+	case bson.M:
+		kept := bson.M{}
+		for name, value := range d {
+			if keep(name) {
+				kept[name] = value
+			}
+		}
+		return kept
+	}
+	return doc
+}
+
+// withoutClusteredIndex removes a clustered collection's clustered index
+// from its indexes, as it's made by creating the collection and can't be
+// created with createIndexes.
+func withoutClusteredIndex(indexes []IndexDocument) []IndexDocument {
+	kept := []IndexDocument{}
+	for _, index := range indexes {
+		if !util.IsTruthy(index.Options["clustered"]) {
+			kept = append(kept, index)
+		}
+	}
+	return kept
+}
+
+// withSimpleCollation gives an explicit simple collation to the indexes of a
+// collection with a default collation that have none. listIndexes reports
+// the collation of the indexes that inherited the collection's default, so
+// those without one were created with the simple collation, and would
+// otherwise inherit the default when recreated.
+func withSimpleCollation(options bson.D, indexes []IndexDocument) []IndexDocument {
+	collation, err := bsonutil.FindValueByKey("collation", &options)
+	if err != nil || collation == nil || isSimpleCollation(collation) {
+		return indexes
+	}
+	for _, index := range indexes {
+		if _, ok := index.Options["collation"]; !ok && index.Options["name"] != "_id_" {
+			index.Options["collation"] = bson.M{"locale": "simple"}
+		}
+	}
+	return indexes
+}
+
+// isSimpleCollation returns true if the collation, a bson.D or a map,
+// compares strings bytewise.
+func isSimpleCollation(collation interface{}) bool {
+	var locale interface{}
+	switch c := collation.(type) {
+	case bson.D:
+		locale, _ = bsonutil.FindValueByKey("locale", &c)
+	case map[string]interface{}:
+		locale = c["locale"]
+	case bson.M:
+		locale = c["locale"]
+	}
+	return locale == "simple"
+}
+
+// isTimeSeriesBuckets returns true if the collection holds the buckets of a
+// time-series collection.
+func isTimeSeriesBuckets(colName string) bool {
+	return strings.HasPrefix(colName, bucketsPrefix)
+}
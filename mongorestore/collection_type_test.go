@@ -0,0 +1,138 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestCollectionKinds(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the metadata of a time-series collection", t, func() {
+		restore := &MongoRestore{}
+		options, indexes, err := restore.MetadataFromJSON([]byte(`{"options":{"timeseries":` +
+			`{"timeField":"ts","metaField":"sensor","granularity":"seconds","bucketMaxSpanSeconds":3600},` +
+			`"expireAfterSeconds":86400},"indexes":[{"v":2,"key":{"sensor":1,"ts":1},"name":"sensor_1_ts_1"}]}`))
+		So(err, ShouldBeNil)
+
+		Convey("it should be recognized as one", func() {
+			So(collectionKind(options), ShouldEqual, collectionTimeSeries)
+		})
+
+		Convey("the bucketing parameters should be dropped in favor of the granularity", func() {
+			created := createOptions(options)
+			So(created[0].Name, ShouldEqual, "timeseries")
+			So(hasField(created[0].Value, "granularity"), ShouldBeTrue)
+			So(hasField(created[0].Value, "bucketMaxSpanSeconds"), ShouldBeFalse)
+			So(created[1].Name, ShouldEqual, "expireAfterSeconds")
+			So(created[1].Value, ShouldEqual, 86400)
+		})
+
+		Convey("its indexes should all be kept", func() {
+			So(len(withoutClusteredIndex(indexes)), ShouldEqual, 1)
+		})
+	})
+
+	Convey("With the metadata of a clustered collection", t, func() {
+		restore := &MongoRestore{}
+		options, indexes, err := restore.MetadataFromJSON([]byte(`{"options":{"clusteredIndex":` +
+			`{"v":2,"key":{"_id":1},"name":"_id_","unique":true}},"indexes":[` +
+			`{"v":2,"key":{"_id":1},"name":"_id_","unique":true,"clustered":true},` +
+			`{"v":2,"key":{"a":1},"name":"a_1"}]}`))
+		So(err, ShouldBeNil)
+
+		Convey("it should be recognized as one, and its clustered index made by create", func() {
+			So(collectionKind(options), ShouldEqual, collectionClustered)
+			created := createOptions(options)
+			So(hasField(created[0].Value, "v"), ShouldBeFalse)
+			So(hasField(created[0].Value, "key"), ShouldBeTrue)
+			kept := withoutClusteredIndex(indexes)
+			So(len(kept), ShouldEqual, 1)
+			So(kept[0].Options["name"], ShouldEqual, "a_1")
+		})
+	})
+
+	Convey("With the metadata of a view", t, func() {
+		restore := &MongoRestore{}
+		options, _, err := restore.MetadataFromJSON([]byte(`{"options":{"viewOn":"orders",` +
+			`"pipeline":[{"$match":{"status":"open"}}],"collation":{"locale":"fr"}},"indexes":[]}`))
+		So(err, ShouldBeNil)
+
+		Convey("it should be recognized as one and created with all its options", func() {
+			So(collectionKind(options), ShouldEqual, collectionView)
+			created := createOptions(options)
+			So(len(created), ShouldEqual, 3)
+			So(created[0].Name, ShouldEqual, "viewOn")
+			So(created[1].Name, ShouldEqual, "pipeline")
+			So(created[2].Name, ShouldEqual, "collation")
+		})
+	})
+
+	Convey("With the metadata of a collection with a default collation", t, func() {
+		restore := &MongoRestore{}
+		options, indexes, err := restore.MetadataFromJSON([]byte(`{"options":{"collation":{"locale":"fr","strength":2}},` +
+			`"indexes":[{"v":2,"key":{"_id":1},"name":"_id_","collation":{"locale":"fr","strength":2}},` +
+			`{"v":2,"key":{"name":1},"name":"name_1","collation":{"locale":"fr","strength":2}},` +
+			`{"v":2,"key":{"code":1},"name":"code_1"}]}`))
+		So(err, ShouldBeNil)
+
+		Convey("the indexes without a collation should be given the simple one", func() {
+			indexes = withSimpleCollation(options, indexes)
+			So(indexes[0].Options["collation"], ShouldNotResemble, bson.M{"locale": "simple"})
+			So(indexes[1].Options["collation"], ShouldNotResemble, bson.M{"locale": "simple"})
+			So(indexes[2].Options["collation"], ShouldResemble, bson.M{"locale": "simple"})
+		})
+	})
+
+	Convey("Indexes should be left alone without a default collation", t, func() {
+		indexes := []IndexDocument{{Options: bson.M{"name": "code_1"}, Key: bson.D{{"code", 1}}}}
+		for _, options := range []bson.D{{}, {{"collation", bson.D{{"locale", "simple"}}}}} {
+			_, ok := withSimpleCollation(options, indexes)[0].Options["collation"]
+			So(ok, ShouldBeFalse)
+		}
+	})
+
+	Convey("Validation options should be set apart from those of create", t, func() {
+		options := bson.D{{"capped", true}, {"validator", bson.D{{"level", bson.D{{"$exists", true}}}}},
+			{"validationLevel", "moderate"}, {"size", 4096}, {"validationAction", "warn"}}
+		created, validation := splitValidationOptions(options)
+		So(created, ShouldResemble, bson.D{{"capped", true}, {"size", 4096}})
+		So(len(validation), ShouldEqual, 3)
+		So(validation[0].Name, ShouldEqual, "validator")
+		So(validation[1].Name, ShouldEqual, "validationLevel")
+		So(validation[2].Name, ShouldEqual, "validationAction")
+
+		created, validation = splitValidationOptions(bson.D{{"capped", true}})
+		So(created, ShouldResemble, bson.D{{"capped", true}})
+		So(validation, ShouldBeEmpty)
+	})
+
+	Convey("With the metadata of a capped collection", t, func() {
+		restore := &MongoRestore{}
+		options, _, err := restore.MetadataFromJSON([]byte(`{"options":{"capped":true,"size":4096,"max":100},"indexes":[]}`))
+		So(err, ShouldBeNil)
+
+		Convey("it should be recognized as one and created with its size and max", func() {
+			So(collectionKind(options), ShouldEqual, collectionCapped)
+			created := createOptions(options)
+			So(len(created), ShouldEqual, 3)
+			So(created[1].Name, ShouldEqual, "size")
+			So(created[2].Name, ShouldEqual, "max")
+		})
+
+		Convey("but not once an override makes it uncapped", func() {
+			So(collectionKind(bson.D{{"capped", false}, {"size", 4096}}), ShouldEqual, collectionRegular)
+		})
+	})
+
+	Convey("Regular collections should keep their options", t, func() {
+		options := bson.D{{"collation", bson.D{{"locale", "fr"}}}, {"storageEngine", bson.D{}}}
+		So(collectionKind(options), ShouldEqual, collectionRegular)
+		So(createOptions(options), ShouldResemble, options)
+		So(isTimeSeriesBuckets("system.buckets.weather"), ShouldBeTrue)
+		So(isTimeSeriesBuckets("weather"), ShouldBeFalse)
+	})
+}
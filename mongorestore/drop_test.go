@@ -0,0 +1,89 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDropCollections(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With collections to drop that exist on the server", t, func() {
+		restore := &MongoRestore{
+			OutputOptions:    &OutputOptions{NumParallelCollections: 3},
+			knownCollections: map[string][]string{"db": {}},
+		}
+		toDrop := []*intents.Intent{}
+		for i := 0; i < 9; i++ {
+			intent := &intents.Intent{DB: "db", C: fmt.Sprintf("c%v", i)}
+			toDrop = append(toDrop, intent)
+			restore.knownCollections["db"] = append(restore.knownCollections["db"], intent.C)
+		}
+
+		Convey("no more than --numParallelCollections should be dropped at once", func() {
+			mutex := sync.Mutex{}
+			inFlight, mostInFlight := 0, 0
+			err := restore.dropCollections(toDrop, func(intent *intents.Intent) error {
+				mutex.Lock()
+				inFlight++
+				if inFlight > mostInFlight {
+					mostInFlight = inFlight
+				}
+				mutex.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mutex.Lock()
+				inFlight--
+				mutex.Unlock()
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(mostInFlight, ShouldEqual, 3)
+
+			Convey("and the dropped collections should no longer be known to exist", func() {
+				So(restore.knownCollections["db"], ShouldBeEmpty)
+			})
+		})
+
+		Convey("the first error should stop the remaining drops", func() {
+			restore.OutputOptions.NumParallelCollections = 1
+			dropped := []string{}
+			err := restore.dropCollections(toDrop, func(intent *intents.Intent) error {
+				if intent.C == "c2" {
+					return fmt.Errorf("not authorized")
+				}
+				dropped = append(dropped, intent.C)
+				return nil
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "db.c2: not authorized")
+			So(dropped, ShouldResemble, []string{"c0", "c1"})
+
+			Convey("keeping the collections that weren't dropped known to exist", func() {
+				So(restore.knownCollections["db"], ShouldResemble,
+					[]string{"c2", "c3", "c4", "c5", "c6", "c7", "c8"})
+			})
+		})
+	})
+
+	Convey("With --resume, collections an earlier run restored should not be dropped", t, func() {
+		restore := &MongoRestore{
+			manager: intents.NewIntentManager(),
+			checkpoint: &checkpointer{
+				completed: map[string]bool{"db.done": true},
+				offsets:   map[string]int64{"db.partial": 100},
+			},
+		}
+		for _, c := range []string{"done", "partial", "new"} {
+			restore.manager.Put(&intents.Intent{DB: "db", C: c, BSONPath: c + ".bson"})
+		}
+		candidates := restore.dropCandidates()
+		So(len(candidates), ShouldEqual, 1)
+		So(candidates[0].Namespace(), ShouldEqual, "db.new")
+	})
+}
@@ -1,10 +1,14 @@
 package mongorestore
 
 import (
+	"bufio"
+	"compress/gzip"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
 	"io"
 	"io/ioutil"
@@ -24,11 +28,11 @@ const (
 )
 
 // realBSONFile implements the intents.file interface. It lets intents read from real BSON files
-// ok disk via an embedded os.File
-// The Read, Write and Close methods of the intents.file interface is implemented here by the
-// embedded os.File, the Write will return an error and not succeed
+// on disk, decompressing them if they are gzipped.
+// The Read and Close methods of the intents.file interface are implemented here by the
+// embedded io.ReadCloser, and Write will return an error and not succeed
 type realBSONFile struct {
-	*os.File
+	io.ReadCloser
 	intent *intents.Intent
 }
 
@@ -39,19 +43,103 @@ func (f *realBSONFile) Open() (err error) {
 		// this error shouldn't happen normally
 		return fmt.Errorf("error reading BSON file for %v", f.intent.Namespace())
 	}
-	f.File, err = os.Open(f.intent.BSONPath)
+	f.ReadCloser, err = openDumpFile(f.intent.BSONPath)
 	if err != nil {
 		return fmt.Errorf("error reading BSON file %v: %v", f.intent.BSONPath, err)
 	}
 	return nil
 }
 
+// Write is part of the intents.file interface. BSON files are only read
+// from while restoring.
+func (f *realBSONFile) Write(p []byte) (n int, err error) {
+	return 0, fmt.Errorf("can't write to BSON file %v", f.intent.BSONPath)
+}
+
+// mmapMinSize is the size from which local .bson files are mapped into
+// memory rather than read as streams.
+const mmapMinSize = 4 * 1024 * 1024
+
+// mappedBSONFile maps the opened BSON file of the intent into memory, from
+// its current offset, when it is a large uncompressed local file. It
+// returns nil to read the file as a stream otherwise, or if it can't be
+// mapped.
+func mappedBSONFile(intent *intents.Intent) *db.MappedBSONSource {
+	bsonFile, ok := intent.BSONFile.(*realBSONFile)
+	if !ok {
+		return nil
+	}
+	file, ok := bsonFile.ReadCloser.(*os.File)
+	if !ok || intent.Size < mmapMinSize {
+		return nil
+	}
+	mapped, err := db.NewMappedBSONSource(file, db.MaxMessageSize)
+	if err != nil {
+		log.Logf(log.DebugLow, "reading %v as a stream: %v", intent.BSONPath, err)
+		return nil
+	}
+	log.Logf(log.DebugLow, "reading %v mapped into memory", intent.BSONPath)
+	return mapped
+}
+
+// mergedBSONFile implements the intents.file interface for the BSON files
+// of several dump collections merged into one by --nsConflict=merge,
+// reading each in turn.
+type mergedBSONFile struct {
+	files   []intentFile
+	current int
+}
+
+// intentFile is the interface of an intent's BSON or metadata file.
+type intentFile interface {
+	io.ReadWriteCloser
+	Open() error
+}
+
+// Open is part of the intents.file interface. It opens the first file.
+func (f *mergedBSONFile) Open() error {
+	f.current = 0
+	return f.files[0].Open()
+}
+
+// Read is part of the intents.file interface. It moves on to the next
+// file at the end of each one.
+func (f *mergedBSONFile) Read(p []byte) (int, error) {
+	for {
+		n, err := f.files[f.current].Read(p)
+		if err != io.EOF || f.current == len(f.files)-1 {
+			return n, err
+		}
+		if err = f.files[f.current].Close(); err != nil {
+			return n, err
+		}
+		f.current++
+		if err = f.files[f.current].Open(); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Write is part of the intents.file interface. BSON files are only read
+// from while restoring.
+func (f *mergedBSONFile) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("can't write to merged BSON files")
+}
+
+// Close is part of the intents.file interface. It closes the open file.
+func (f *mergedBSONFile) Close() error {
+	return f.files[f.current].Close()
+}
+
 // realMetadataFile implements the intents.file interface. It lets intents read from real
-// metadata.json files ok disk via an embedded os.File
-// The Read, Write and Close methods of the intents.file interface is implemented here by the
-// embedded os.File, the Write will return an error and not succeed
+// metadata.json files on disk, decompressing them if they are gzipped.
+// The Read and Close methods of the intents.file interface are implemented here by the
+// embedded io.ReadCloser, and Write will return an error and not succeed
 type realMetadataFile struct {
-	*os.File
+	io.ReadCloser
 	intent *intents.Intent
 }
 
@@ -61,13 +149,124 @@ func (f *realMetadataFile) Open() (err error) {
 	if f.intent.MetadataPath == "" {
 		return fmt.Errorf("error reading Metadata file for %v", f.intent.Namespace())
 	}
-	f.File, err = os.Open(f.intent.MetadataPath)
+	f.ReadCloser, err = openDumpFile(f.intent.MetadataPath)
 	if err != nil {
 		return fmt.Errorf("error reading Metadata file %v: %v", f.intent.MetadataPath, err)
 	}
 	return nil
 }
 
+// Write is part of the intents.file interface. Metadata files are only read
+// from while restoring.
+func (f *realMetadataFile) Write(p []byte) (n int, err error) {
+	return 0, fmt.Errorf("can't write to metadata file %v", f.intent.MetadataPath)
+}
+
+// openDumpFile opens a file of the dump, decompressing it as it is read if
+// its name ends in .gz.
+func openDumpFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, gzipSuffix) {
+		return file, nil
+	}
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &wrappedReadCloser{gzipReader, file}, nil
+}
+
+// wrappedReadCloser is an io.ReadCloser that reads through the embedded
+// io.ReadCloser and closes it along with the wrapped one, such as a
+// decompressor and the file it reads from.
+type wrappedReadCloser struct {
+	io.ReadCloser
+	wrapped io.Closer
+}
+
+// Close is part of the io.ReadCloser interface.
+func (wrc *wrappedReadCloser) Close() error {
+	err := wrc.ReadCloser.Close()
+	if wrappedErr := wrc.wrapped.Close(); err == nil {
+		err = wrappedErr
+	}
+	return err
+}
+
+// Skip is part of the archive.Skipper interface. It skips by seeking when
+// the embedded io.ReadCloser can, and by reading otherwise.
+func (wrc *wrappedReadCloser) Skip(n int64) error {
+	if skipper, ok := wrc.ReadCloser.(archive.Skipper); ok {
+		return skipper.Skip(n)
+	}
+	_, err := io.CopyN(ioutil.Discard, wrc.ReadCloser, n)
+	return err
+}
+
+// seekingReader reads a file through a buffer, and skips over parts of it
+// by seeking past them.
+type seekingReader struct {
+	buffered *bufio.Reader
+	file     io.ReadSeeker
+}
+
+func (sr *seekingReader) Read(p []byte) (int, error) {
+	return sr.buffered.Read(p)
+}
+
+// Skip is part of the archive.Skipper interface.
+func (sr *seekingReader) Skip(n int64) error {
+	buffered := int64(sr.buffered.Buffered())
+	if n <= buffered {
+		_, err := sr.buffered.Discard(int(n))
+		return err
+	}
+	if _, err := sr.buffered.Discard(int(buffered)); err != nil {
+		return err
+	}
+	if _, err := sr.file.Seek(n-buffered, io.SeekCurrent); err != nil {
+		return err
+	}
+	sr.buffered.Reset(sr.file)
+	return nil
+}
+
+// Close is part of the io.ReadCloser interface. It does nothing, as the
+// file is closed by the wrappedReadCloser.
+func (sr *seekingReader) Close() error {
+	return nil
+}
+
+// countingReader counts the bytes of the archive input consumed, whether
+// read or seeked past, for the archive's progress bar.
+type countingReader struct {
+	in       io.Reader
+	progress progress.Progressor
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.in.Read(p)
+	cr.progress.Inc(int64(n))
+	return n, err
+}
+
+// Seek is part of the io.Seeker interface, for a seekingReader over a file.
+func (cr *countingReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := cr.in.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("archive input can not seek")
+	}
+	position, err := seeker.Seek(offset, whence)
+	if err == nil {
+		cr.progress.Set(position)
+	}
+	return position, err
+}
+
 // stdinFile implements the intents.file interface. They allow intents to read single collections
 // from standard input
 type stdinFile struct {
@@ -94,9 +293,23 @@ func (f *stdinFile) Write(p []byte) (n int, err error) {
 	return 0, fmt.Errorf("can't write to standard output")
 }
 
+// gzipSuffix is appended to the name of gzip-compressed dump files.
+const gzipSuffix = ".gz"
+
+// bsonDataSize returns the size of the documents in the intent's BSON file,
+// and false if it is unknown: the size of a gzipped file is that of its
+// compressed data, and the dump doesn't record the uncompressed size.
+func bsonDataSize(intent *intents.Intent) (int64, bool) {
+	if strings.HasSuffix(intent.BSONPath, gzipSuffix) {
+		return 0, false
+	}
+	return intent.Size, true
+}
+
 // GetInfoFromFilename pulls the base collection name and FileType from a given file.
+// Gzip-compressed files, such as c.bson.gz, are recognized by their extension.
 func GetInfoFromFilename(filename string) (string, FileType) {
-	baseFileName := filepath.Base(filename)
+	baseFileName := strings.TrimSuffix(filepath.Base(filename), gzipSuffix)
 	switch {
 	case strings.HasSuffix(baseFileName, ".metadata.json"):
 		// this logic can't be simple because technically
@@ -115,6 +328,32 @@ func GetInfoFromFilename(filename string) (string, FileType) {
 	}
 }
 
+// fileIncluded returns true if the .bson file at path is to be restored,
+// as it matches --filterFiles or there is no --filterFiles.
+func (restore *MongoRestore) fileIncluded(path string) bool {
+	if restore.filterFiles == nil || restore.filterFiles.MatchString(filepath.ToSlash(path)) {
+		return true
+	}
+	log.Logf(log.DebugLow, "not restoring %v, which doesn't match --filterFiles", path)
+	return false
+}
+
+// metadataIncluded returns true if the .metadata.json file at path is to be
+// restored: with --filterFiles, only if the .bson file of its collection,
+// gzipped or not, matches it, so that the collections the filter excludes
+// are neither created nor dropped.
+func (restore *MongoRestore) metadataIncluded(path string) bool {
+	if restore.filterFiles == nil {
+		return true
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(filepath.ToSlash(path), gzipSuffix), ".metadata.json")
+	if restore.filterFiles.MatchString(base+".bson") || restore.filterFiles.MatchString(base+".bson"+gzipSuffix) {
+		return true
+	}
+	log.Logf(log.DebugLow, "not restoring %v, as the .bson file of its collection doesn't match --filterFiles", path)
+	return false
+}
+
 // CreateAllIntents drills down into a dump folder, creating intents for all of
 // the databases and collections it finds.
 func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB string, filterCollection string) error {
@@ -126,6 +365,11 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB stri
 	}
 	log.Logf(log.Always, "%v", entries)
 	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() == "config" && restore.OutputOptions.Sharded {
+			log.Logf(log.Info, "reading sharding metadata from %v rather than restoring it", entry.Path())
+			restore.configDir = entry
+			continue
+		}
 		if entry.IsDir() {
 			if err = util.ValidateDBName(entry.Name()); err != nil {
 				return fmt.Errorf("invalid database name '%v': %v", entry.Name(), err)
@@ -139,7 +383,10 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB stri
 				return err
 			}
 		} else {
-			if entry.Name() == "oplog.bson" {
+			if entry.Name() == "oplog.bson" || entry.Name() == "oplog.bson"+gzipSuffix {
+				if !restore.fileIncluded(entry.Path()) {
+					continue
+				}
 				if restore.InputOptions.OplogReplay {
 					log.Log(log.DebugLow, "found oplog.bson file to replay")
 				}
@@ -175,6 +422,9 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB stri
 					oplogIntent.BSONFile = &realBSONFile{intent: oplogIntent}
 				}
 				restore.manager.Put(oplogIntent)
+			} else if entry.Name() == "dump_info.json" {
+				// settings of the source server, recorded for reference only
+				log.Logf(log.DebugLow, "found %v, skipping", entry.Path())
 			} else {
 				log.Logf(log.Always,
 					`don't know what to do with file "%v", skipping...`,
@@ -183,7 +433,7 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike, filterDB stri
 			}
 		}
 	}
-	if restore.InputOptions.OplogReplay && !foundOplog {
+	if restore.InputOptions.OplogReplay && !foundOplog && len(restore.InputOptions.OplogFiles) == 0 {
 		return fmt.Errorf("no %v/oplog.bson file to replay; make sure you run mongodump with --oplog", dir.Path())
 	}
 	return nil
@@ -237,12 +487,33 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, filterCollection stri
 				if filterCollection != "" && filterCollection != collection {
 					skip = true
 				}
+				// time-series buckets are restored through their time-series
+				// collection, so their data, e.g. in an archive, is skipped
+				if !skip && isTimeSeriesBuckets(collection) {
+					timeSeries := strings.TrimPrefix(collection, bucketsPrefix)
+					if hasBSONFile(entries, timeSeries) {
+						log.Logf(log.Always, "skipping %v.%v: time-series buckets are restored through "+
+							"their time-series collection %v", db, collection, timeSeries)
+					} else {
+						log.Logf(log.Always, "warning: skipping %v.%v: the dump holds the buckets of time-series "+
+							"collection %v but not its measurements, so it can't be restored; dump %v itself "+
+							"to restore it", db, collection, timeSeries, timeSeries)
+					}
+					skip = true
+				}
+				if !skip && !restore.fileIncluded(entry.Path()) {
+					skip = true
+				}
 				intent := &intents.Intent{
 					DB:       db,
 					C:        collection,
 					Size:     entry.Size(),
 					BSONPath: entry.Path(),
 				}
+				if !skip && !intent.IsSpecialCollection() && !restore.nsIncluded(intent.Namespace()) {
+					log.Logf(log.DebugLow, "not restoring %v, which no --nsInclude pattern matches", intent.Namespace())
+					skip = true
+				}
 				if restore.InputOptions.Archive != "" {
 					if skip {
 						// adding the DemuxOut to the demux, but not adding the intent to the manager
@@ -272,8 +543,11 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, filterCollection stri
 						intent.BSONFile = &realBSONFile{intent: intent}
 					}
 				}
+				if err = restore.renameIntent(intent); err != nil {
+					return err
+				}
 				log.Logf(log.Info, "found collection %v bson to restore", intent.Namespace())
-				restore.manager.Put(intent)
+				restore.putIntent(intent)
 			case MetadataFileType:
 				usesMetadataFiles = true
 				intent := &intents.Intent{
@@ -281,13 +555,22 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, filterCollection stri
 					C:            collection,
 					MetadataPath: entry.Path(),
 				}
+				if !intent.IsSpecialCollection() && !restore.nsIncluded(intent.Namespace()) {
+					continue
+				}
+				if !restore.metadataIncluded(entry.Path()) {
+					continue
+				}
 				if restore.InputOptions.Archive != "" {
 					intent.MetadataFile = &archive.MetadataPreludeFile{Intent: intent, Prelude: restore.archive.Prelude}
 				} else {
 					intent.MetadataFile = &realMetadataFile{intent: intent}
 				}
+				if err = restore.renameIntent(intent); err != nil {
+					return err
+				}
 				log.Logf(log.Info, "found collection %v metadata to restore", intent.Namespace())
-				restore.manager.Put(intent)
+				restore.putIntent(intent)
 			default:
 				log.Logf(log.Always, `don't know what to do with file "%v", skipping...`,
 					entry.Path())
@@ -316,6 +599,9 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 			BSONPath: "-",
 		}
 		intent.BSONFile = &stdinFile{intent: intent}
+		if err := restore.renameIntent(intent); err != nil {
+			return err
+		}
 		restore.manager.Put(intent)
 		return nil
 	}
@@ -342,6 +628,9 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 		Size:     dir.Size(),
 	}
 	intent.BSONFile = &realBSONFile{intent: intent}
+	if err = restore.renameIntent(intent); err != nil {
+		return err
+	}
 
 	// finally, check if it has a .metadata.json file in its folder
 	log.Logf(log.DebugLow, "scanning directory %v for metadata file", dir.Name())
@@ -355,7 +644,7 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 	}
 	metadataName := baseName + ".metadata.json"
 	for _, entry := range entries {
-		if entry.Name() == metadataName {
+		if entry.Name() == metadataName || entry.Name() == metadataName+gzipSuffix {
 			metadataPath := entry.Path()
 			log.Logf(log.Info, "found metadata for collection at %v", metadataPath)
 			intent.MetadataPath = metadataPath
@@ -376,7 +665,18 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 // helper for searching a list of FileInfo for metadata files
 func hasMetadataFiles(files []archive.DirLike) bool {
 	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".metadata.json") {
+		if _, fileType := GetInfoFromFilename(file.Name()); fileType == MetadataFileType {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBSONFile returns true if the files hold the BSON file of the
+// collection.
+func hasBSONFile(files []archive.DirLike, collection string) bool {
+	for _, file := range files {
+		if name, fileType := GetInfoFromFilename(file.Name()); fileType == BSONFileType && name == collection {
 			return true
 		}
 	}
@@ -1,14 +1,24 @@
 package mongorestore
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	"github.com/mongodb/mongo-tools/common/util"
 	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -155,6 +165,60 @@ func TestCreateIntentsForDB(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("running CreateIntentsForDB with --nsInclude should only create the matching intents", func() {
+			var err error
+			mr.nsInclude, err = compileNSIncludes([]string{"myDB.c1", "myDB.c3"})
+			So(err, ShouldBeNil)
+			ddl, err := newActualPath("testdata/testdirs/db1")
+			So(err, ShouldBeNil)
+			err = mr.CreateIntentsForDB("myDB", "", ddl, false)
+			So(err, ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			i0 := mr.manager.Pop()
+			So(i0.C, ShouldEqual, "c1")
+			So(i0.MetadataPath, ShouldNotEqual, "")
+			i1 := mr.manager.Pop()
+			So(i1.C, ShouldEqual, "c3")
+			So(mr.manager.Pop(), ShouldBeNil)
+		})
+
+		Convey("running CreateIntentsForDB with --filterFiles should only restore the matching .bson files", func() {
+			mr.filterFiles = regexp.MustCompile(`db1/c[12]\.bson$`)
+			ddl, err := newActualPath("testdata/testdirs/db1")
+			So(err, ShouldBeNil)
+			err = mr.CreateIntentsForDB("myDB", "", ddl, false)
+			So(err, ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			i0 := mr.manager.Pop()
+			So(i0.C, ShouldEqual, "c1")
+			So(i0.BSONPath, ShouldNotEqual, "")
+			i1 := mr.manager.Pop()
+			So(i1.C, ShouldEqual, "c2")
+			So(i1.BSONPath, ShouldNotEqual, "")
+
+			Convey("leaving out the metadata of the others", func() {
+				So(mr.manager.Pop(), ShouldBeNil)
+			})
+		})
+
+		Convey("running CreateIntentsForDB with --filterFiles and --drop should only drop the matching collections", func() {
+			mr.filterFiles = regexp.MustCompile(`db1/c[12]\.bson$`)
+			mr.OutputOptions = &OutputOptions{Drop: true}
+			ddl, err := newActualPath("testdata/testdirs/db1")
+			So(err, ShouldBeNil)
+			err = mr.CreateIntentsForDB("myDB", "", ddl, false)
+			So(err, ShouldBeNil)
+
+			dropped := []string{}
+			for _, intent := range mr.dropCandidates() {
+				dropped = append(dropped, intent.C)
+			}
+			sort.Strings(dropped)
+			So(dropped, ShouldResemble, []string{"c1", "c2"})
+		})
 	})
 }
 
@@ -295,3 +359,131 @@ func TestCreateIntentsForCollection(t *testing.T) {
 
 	})
 }
+
+func TestGzippedDumpFiles(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Gzipped dump files should be recognized by their extension", t, func() {
+		name, fileType := GetInfoFromFilename("dump/db/c1.bson.gz")
+		So(name, ShouldEqual, "c1")
+		So(fileType, ShouldEqual, BSONFileType)
+		name, fileType = GetInfoFromFilename("dump/db/c1.metadata.json.gz")
+		So(name, ShouldEqual, "c1")
+		So(fileType, ShouldEqual, MetadataFileType)
+		_, fileType = GetInfoFromFilename("dump/db/c1.txt.gz")
+		So(fileType, ShouldEqual, UnknownFileType)
+	})
+
+	Convey("With a gzipped BSON file", t, func() {
+		var dir string
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		dir, err := ioutil.TempDir("", "mongorestore_gzip")
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "c1.bson.gz")
+		file, err := os.Create(path)
+		So(err, ShouldBeNil)
+		gzipWriter := gzip.NewWriter(file)
+		_, err = gzipWriter.Write([]byte("some bson"))
+		So(err, ShouldBeNil)
+		So(gzipWriter.Close(), ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+
+		Convey("reading its intent should decompress it", func() {
+			intent := &intents.Intent{DB: "db", C: "c1", BSONPath: path}
+			bsonFile := &realBSONFile{intent: intent}
+			So(bsonFile.Open(), ShouldBeNil)
+			contents, err := ioutil.ReadAll(bsonFile)
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "some bson")
+			So(bsonFile.Close(), ShouldBeNil)
+		})
+
+		Convey("gzipped archives should be detected from their header", func() {
+			file, err := os.Open(path)
+			So(err, ShouldBeNil)
+			defer file.Close()
+			So(isGzipped(bufio.NewReader(file)), ShouldBeTrue)
+			So(isGzipped(bufio.NewReader(strings.NewReader("plain"))), ShouldBeFalse)
+		})
+	})
+}
+
+func TestCountingReader(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive read through a counting reader", t, func() {
+		data := bytes.Repeat([]byte("0123456789"), 1000)
+		counter := progress.NewCounter(int64(len(data)))
+		counted := &countingReader{in: bytes.NewReader(data), progress: counter}
+
+		Convey("the bytes read and skipped over should be counted", func() {
+			reader := &seekingReader{bufio.NewReaderSize(counted, 16), counted}
+			head := make([]byte, 10)
+			_, err := reader.Read(head)
+			So(err, ShouldBeNil)
+			So(reader.Skip(5000), ShouldBeNil)
+			So(counter.Get(), ShouldEqual, 5010)
+			rest, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(len(rest), ShouldEqual, len(data)-5010)
+			So(counter.Get(), ShouldEqual, len(data))
+		})
+
+		Convey("a stream should not seek", func() {
+			streamed := &countingReader{in: strings.NewReader("stream"), progress: counter}
+			streamed.in = ioutil.NopCloser(streamed.in)
+			_, err := streamed.Seek(1, io.SeekCurrent)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCreateIntentsForTimeSeriesBuckets(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive holding time-series buckets", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_buckets")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "archive")
+
+		// openArchive reads the prelude of the archive and creates the
+		// intents of its collections, as a restore of it does
+		openArchive := func() *MongoRestore {
+			in, err := os.Open(path)
+			So(err, ShouldBeNil)
+			Reset(func() { in.Close() })
+			mr := &MongoRestore{
+				manager:       intents.NewIntentManager(),
+				InputOptions:  &InputOptions{Archive: path},
+				OutputOptions: &OutputOptions{},
+				ToolOptions:   &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+				archive:       &archive.Reader{In: in, Prelude: &archive.Prelude{}},
+			}
+			So(mr.archive.Prelude.Read(in), ShouldBeNil)
+			target, err := mr.archive.Prelude.NewPreludeExplorer()
+			So(err, ShouldBeNil)
+			mr.archive.Demux = &archive.Demultiplexer{In: in}
+			So(mr.CreateAllIntents(target, "", ""), ShouldBeNil)
+			return mr
+		}
+
+		Convey("the buckets should be skipped along with the time-series collection", func() {
+			So(writeTestArchive(path, []string{"weather", "system.buckets.weather"}, []int{3, 1}), ShouldBeNil)
+			mr := openArchive()
+			So(mr.manager.IntentForNamespace("test.weather"), ShouldNotBeNil)
+			So(mr.manager.IntentForNamespace("test.system.buckets.weather"), ShouldBeNil)
+		})
+
+		Convey("an archive of only buckets should be read through without restoring them", func() {
+			So(writeTestArchive(path, []string{"system.buckets.weather"}, []int{3}), ShouldBeNil)
+			mr := openArchive()
+			So(mr.manager.IntentForNamespace("test.system.buckets.weather"), ShouldBeNil)
+			So(mr.archive.Demux.Run(), ShouldBeNil)
+		})
+	})
+}
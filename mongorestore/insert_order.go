@@ -0,0 +1,63 @@
+package mongorestore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Insertion orders of --insertionOrder.
+const (
+	insertOrdered   = "ordered"
+	insertUnordered = "unordered"
+)
+
+// insertionOrder is an --insertionOrder: whether to insert the documents
+// of the namespaces matching its pattern in order.
+type insertionOrder struct {
+	pattern *regexp.Regexp
+	ordered bool
+}
+
+// parseInsertionOrders parses the --insertionOrder arguments, each a
+// namespace pattern, '=' and either ordered or unordered, such as
+// 'app.events_*=ordered'.
+func parseInsertionOrders(specs []string) ([]insertionOrder, error) {
+	orders := []insertionOrder{}
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid --insertionOrder '%v': expected <pattern>=%v or <pattern>=%v",
+				spec, insertOrdered, insertUnordered)
+		}
+		namespace, order := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		if namespace == "" {
+			return nil, fmt.Errorf("invalid --insertionOrder '%v': empty namespace pattern", spec)
+		}
+		if order != insertOrdered && order != insertUnordered {
+			return nil, fmt.Errorf("invalid --insertionOrder '%v': order must be %v or %v",
+				spec, insertOrdered, insertUnordered)
+		}
+		pattern, err := compileNSPattern(namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --insertionOrder '%v': %v", spec, err)
+		}
+		orders = append(orders, insertionOrder{pattern: pattern, ordered: order == insertOrdered})
+	}
+	return orders, nil
+}
+
+// orderedInserts returns true if the documents of the namespace are to be
+// inserted in order, by a single insertion worker making ordered bulk
+// inserts: as the first --insertionOrder matching the namespace says, or
+// else with --maintainInsertionOrder, or if the collection is capped, as
+// capped collections keep their documents in insertion order.
+func (restore *MongoRestore) orderedInserts(namespace string, capped bool) bool {
+	namespace = restore.stager.target(namespace)
+	for _, order := range restore.insertionOrders {
+		if order.pattern.MatchString(namespace) {
+			return order.ordered
+		}
+	}
+	return restore.OutputOptions.MaintainInsertionOrder || capped
+}
@@ -0,0 +1,43 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestInsertionOrder(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --insertionOrder overrides", t, func() {
+		orders, err := parseInsertionOrders([]string{"app.events=unordered", "app.*=ordered"})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}, insertionOrders: orders}
+
+		Convey("the first matching pattern should decide the order", func() {
+			So(restore.orderedInserts("app.users", false), ShouldBeTrue)
+			So(restore.orderedInserts("app.events", true), ShouldBeFalse)
+		})
+
+		Convey("other namespaces should be ordered only if capped or with --maintainInsertionOrder", func() {
+			So(restore.orderedInserts("logs.requests", false), ShouldBeFalse)
+			So(restore.orderedInserts("logs.requests", true), ShouldBeTrue)
+			restore.OutputOptions.MaintainInsertionOrder = true
+			So(restore.orderedInserts("logs.requests", false), ShouldBeTrue)
+		})
+
+		Convey("a staged collection should be matched by its target", func() {
+			restore.stager = &stager{}
+			restore.stager.add(stagedCollection{db: "app", staged: stagedName("users"), target: "users"})
+			So(restore.orderedInserts("app."+stagedName("users"), false), ShouldBeTrue)
+		})
+	})
+
+	Convey("Invalid --insertionOrder arguments should be rejected", t, func() {
+		for _, spec := range []string{"app.users", "=ordered", "app.users=sorted"} {
+			_, err := parseInsertionOrders([]string{spec})
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestInsertionWorkers(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With insertion workers per collection", t, func() {
+		restore := &MongoRestore{
+			ToolOptions:   &options.ToolOptions{Namespace: &options.Namespace{}},
+			InputOptions:  &InputOptions{},
+			OutputOptions: &OutputOptions{NumParallelCollections: 4, NumInsertionWorkers: 3},
+		}
+
+		Convey("the document buffer should grow with the number of workers", func() {
+			workers, bufferSize := restore.insertionWorkers(false)
+			So(workers, ShouldEqual, 3)
+			So(bufferSize, ShouldEqual, 3*insertBufferFactor)
+		})
+
+		Convey("a single worker should insert when keeping the insertion order", func() {
+			workers, bufferSize := restore.insertionWorkers(true)
+			So(workers, ShouldEqual, 1)
+			So(bufferSize, ShouldEqual, insertBufferFactor)
+		})
+
+		Convey("less than one worker should be refused", func() {
+			restore.OutputOptions.NumInsertionWorkers = 0
+			err := restore.ParseAndValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "at least one insertion worker")
+		})
+
+		Convey("an archive dumped with more parallel collections", func() {
+
+			Convey("should raise the parallel collections, keeping explicitly set workers", func() {
+				restore.useArchiveConcurrency(8)
+				So(restore.OutputOptions.NumParallelCollections, ShouldEqual, 8)
+				So(restore.OutputOptions.NumInsertionWorkers, ShouldEqual, 3)
+			})
+
+			Convey("should raise the default single worker too", func() {
+				restore.OutputOptions.NumInsertionWorkers = 1
+				restore.useArchiveConcurrency(8)
+				So(restore.OutputOptions.NumInsertionWorkers, ShouldEqual, 8)
+			})
+		})
+
+		Convey("an archive dumped with fewer parallel collections should change nothing", func() {
+			restore.OutputOptions.NumInsertionWorkers = 1
+			restore.useArchiveConcurrency(2)
+			So(restore.OutputOptions.NumParallelCollections, ShouldEqual, 4)
+			So(restore.OutputOptions.NumInsertionWorkers, ShouldEqual, 1)
+		})
+	})
+}
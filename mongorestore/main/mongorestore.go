@@ -6,6 +6,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/password"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongorestore"
@@ -53,6 +54,15 @@ func main() {
 	opts.Direct = (setName == "")
 	opts.ReplicaSetName = setName
 
+	// a password read from standard input would be read from the archive
+	if inputOpts.Archive == "-" && opts.Auth.ShouldAskForPassword() && !password.IsTerminal() {
+		log.Logf(log.Always, "--password is required when reading the archive from standard input")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	// ask for any password up front, so it can be reused for --mongosHosts
+	db.AskForPassword(opts)
+
 	provider, err := db.NewSessionProvider(*opts)
 	if err != nil {
 		log.Logf(log.Always, "error connecting to host: %v", err)
@@ -10,6 +10,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"strconv"
 	"strings"
 )
 
@@ -101,7 +102,6 @@ func (restore *MongoRestore) LoadIndexesFromBSON() error {
 	dbCollectionIndexes := make(map[string]collectionIndexes)
 
 	for _, dbname := range restore.manager.SystemIndexDBs() {
-		dbCollectionIndexes[dbname] = make(collectionIndexes)
 		intent := restore.manager.SystemIndexes(dbname)
 		err := intent.BSONFile.Open()
 		if err != nil {
@@ -115,8 +115,19 @@ func (restore *MongoRestore) LoadIndexesFromBSON() error {
 		indexDocument := &IndexDocument{}
 		for bsonSource.Next(indexDocument) {
 			namespace := indexDocument.Options["ns"].(string)
-			dbCollectionIndexes[dbname][stripDBFromNS(namespace)] =
-				append(dbCollectionIndexes[dbname][stripDBFromNS(namespace)], *indexDocument)
+			// file the index under the collection it is restored to
+			targetDB, collection := dbname, stripDBFromNS(namespace)
+			if restore.renamer != nil {
+				renamed := restore.renamer.target(dbname + "." + collection)
+				if db, c, err := util.SplitAndValidateNamespace(renamed); err == nil {
+					targetDB, collection = db, c
+				}
+			}
+			if dbCollectionIndexes[targetDB] == nil {
+				dbCollectionIndexes[targetDB] = make(collectionIndexes)
+			}
+			dbCollectionIndexes[targetDB][collection] =
+				append(dbCollectionIndexes[targetDB][collection], *indexDocument)
 		}
 		if err := bsonSource.Err(); err != nil {
 			return fmt.Errorf("error scanning system.indexes: %v", err)
@@ -166,12 +177,29 @@ func (restore *MongoRestore) CollectionExists(intent *intents.Intent) (bool, err
 	return exists, nil
 }
 
+// forgetCollection removes a dropped collection from the cache of
+// collections known to exist on the server.
+func (restore *MongoRestore) forgetCollection(intent *intents.Intent) {
+	restore.knownCollectionsMutex.Lock()
+	defer restore.knownCollectionsMutex.Unlock()
+
+	collections := restore.knownCollections[intent.DB]
+	for i, name := range collections {
+		if name == intent.C {
+			restore.knownCollections[intent.DB] = append(collections[:i:i], collections[i+1:]...)
+			return
+		}
+	}
+}
+
 // CreateIndexes takes in an intent and an array of index documents and
 // attempts to create them using the createIndexes command. If that command
 // fails, we fall back to individual index creation.
 func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []IndexDocument) error {
+	// TTL indexes held off by --holdTTLExpiry, by index
+	held := map[int]heldTTLIndex{}
 	// first, sanitize the indexes
-	for _, index := range indexes {
+	for i, index := range indexes {
 		// update the namespace of the index before inserting
 		index.Options["ns"] = intent.Namespace()
 
@@ -188,6 +216,14 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 		if !restore.OutputOptions.KeepIndexVersion {
 			delete(index.Options, "v")
 		}
+
+		if restore.OutputOptions.BackgroundIndexes {
+			index.Options["background"] = true
+		}
+
+		if ttlIndex, ok := restore.ttlHolder.hold(intent, index); ok {
+			held[i] = ttlIndex
+		}
 	}
 
 	session, err := restore.SessionProvider.GetSession()
@@ -202,9 +238,17 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 		{"createIndexes", intent.C},
 		{"indexes", indexes},
 	}
+	if restore.commitQuorum != nil {
+		rawCommand = append(rawCommand, bson.DocElem{"commitQuorum", restore.commitQuorum})
+	}
 	results := bson.M{}
 	err = session.DB(intent.DB).Run(rawCommand, &results)
 	if err == nil {
+		for i := range indexes {
+			if ttlIndex, ok := held[i]; ok {
+				restore.ttlHolder.record(ttlIndex)
+			}
+		}
 		return nil
 	}
 	if err.Error() != "no such cmd: createIndexes" {
@@ -213,16 +257,31 @@ func (restore *MongoRestore) CreateIndexes(intent *intents.Intent, indexes []Ind
 
 	// if we're here, the connected server does not support the command, so we fall back
 	log.Log(log.Info, "\tcreateIndexes command not supported, attemping legacy index insertion")
-	for _, idx := range indexes {
+	for i, idx := range indexes {
 		log.Logf(log.Info, "\tmanually creating index %v", idx.Options["name"])
 		err = restore.LegacyInsertIndex(intent, idx)
 		if err != nil {
 			return fmt.Errorf("error creating index %v: %v", idx.Options["name"], err)
 		}
+		if ttlIndex, ok := held[i]; ok {
+			restore.ttlHolder.record(ttlIndex)
+		}
 	}
 	return nil
 }
 
+// parseCommitQuorum parses the --commitQuorum option, which is either a
+// number of replica set members or the name of a quorum such as 'majority'.
+func parseCommitQuorum(quorum string) (interface{}, error) {
+	if members, err := strconv.Atoi(quorum); err == nil {
+		if members < 0 {
+			return nil, fmt.Errorf("--commitQuorum can not be negative")
+		}
+		return members, nil
+	}
+	return quorum, nil
+}
+
 // LegacyInsertIndex takes in an intent and an index document and attempts to
 // create the index on the "system.indexes" collection.
 func (restore *MongoRestore) LegacyInsertIndex(intent *intents.Intent, index IndexDocument) error {
@@ -270,6 +329,26 @@ func (restore *MongoRestore) CreateCollection(intent *intents.Intent, options bs
 	return nil
 }
 
+// shouldPreallocate returns true if the intent's dump file is large enough
+// for its collection to be created with a preallocated size. Gzipped files
+// are never preallocated, as the size of their documents is unknown.
+func (restore *MongoRestore) shouldPreallocate(intent *intents.Intent) bool {
+	size, known := bsonDataSize(intent)
+	return restore.preallocateSize > 0 && known && size >= restore.preallocateSize
+}
+
+// preallocatedOptions returns the collection options with an initial size
+// taken from the intent's dump file. Options that already set a size, such
+// as those of capped collections, are returned unchanged.
+func preallocatedOptions(intent *intents.Intent, options bson.D) bson.D {
+	for _, opt := range options {
+		if opt.Name == "size" || opt.Name == "capped" {
+			return options
+		}
+	}
+	return append(append(bson.D{}, options...), bson.DocElem{"size", intent.Size})
+}
+
 // RestoreUsersOrRoles accepts a collection type (Users or Roles) and restores the intent
 // in the appropriate collection.
 func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *intents.Intent) error {
@@ -314,7 +393,7 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 	}
 
 	log.Logf(log.DebugLow, "restoring %v to temporary collection", collectionType)
-	err = restore.RestoreCollectionToDB("admin", tempCol, bsonSource, 0)
+	err = restore.RestoreCollectionToDB("admin", tempCol, bsonSource, 0, restore.OutputOptions.MaintainInsertionOrder)
 	if err != nil {
 		return fmt.Errorf("error restoring %v: %v", collectionType, err)
 	}
@@ -343,25 +422,16 @@ func (restore *MongoRestore) RestoreUsersOrRoles(collectionType string, intent *
 	if userTargetDB == "admin" {
 		// _mergeAuthzCollections uses an empty db string as a sentinel for "all databases"
 		userTargetDB = ""
-	}
-
-	// we have to manually convert mgo's safety to a writeconcern object
-	writeConcern := bson.M{}
-	if restore.safety == nil {
-		writeConcern["w"] = 0
-	} else {
-		if restore.safety.WMode != "" {
-			writeConcern["w"] = restore.safety.WMode
-		} else {
-			writeConcern["w"] = restore.safety.W
-		}
+	} else if restore.renamer != nil {
+		// the users and roles were renamed along with their database
+		userTargetDB = restore.renamer.RenameDB(userTargetDB)
 	}
 
 	command := bsonutil.MarshalD{
 		{"_mergeAuthzCollections", 1},
 		{tempColCommandField, "admin." + tempCol},
 		{"drop", restore.OutputOptions.Drop},
-		{"writeConcern", writeConcern},
+		{"writeConcern", db.WriteConcernDocument(restore.safety)},
 		{"db", userTargetDB},
 	}
 
@@ -483,7 +553,11 @@ func (restore *MongoRestore) ShouldRestoreUsersAndRoles() bool {
 	// If the user has done anything that would indicate the restoration
 	// of users and roles (i.e. used --restoreDbUsersAndRoles, -d admin, or
 	// is doing a full restore), then we check if users or roles BSON files
-	// actually exist in the dump dir. If they do, return true.
+	// actually exist in the dump dir. If they do, return true. Users and
+	// roles are never restored with --indexesOnly.
+	if restore.OutputOptions.IndexesOnly {
+		return false
+	}
 	if restore.InputOptions.RestoreDBUsersAndRoles ||
 		restore.ToolOptions.DB == "" ||
 		restore.ToolOptions.DB == "admin" {
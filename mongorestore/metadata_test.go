@@ -174,3 +174,113 @@ func TestGetDumpAuthVersion(t *testing.T) {
 	})
 
 }
+
+func TestPreallocatedOptions(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongorestore preallocating collections of at least 1KB", t, func() {
+		restore := &MongoRestore{preallocateSize: 1024}
+		intent := &intents.Intent{DB: "test", C: "big", Size: 4096}
+
+		Convey("only large enough dump files should be preallocated", func() {
+			So(restore.shouldPreallocate(intent), ShouldBeTrue)
+			So(restore.shouldPreallocate(&intents.Intent{Size: 1023}), ShouldBeFalse)
+			So((&MongoRestore{}).shouldPreallocate(intent), ShouldBeFalse)
+		})
+
+		Convey("gzipped dump files should not be preallocated, whatever their compressed size", func() {
+			gzipped := &intents.Intent{DB: "test", C: "big", BSONPath: "dump/test/big.bson.gz", Size: 4096}
+			So(restore.shouldPreallocate(gzipped), ShouldBeFalse)
+		})
+
+		Convey("the dump file size should be added to the options", func() {
+			So(preallocatedOptions(intent, nil), ShouldResemble, bson.D{{"size", int64(4096)}})
+			options := bson.D{{"autoIndexId", false}}
+			So(preallocatedOptions(intent, options), ShouldResemble,
+				bson.D{{"autoIndexId", false}, {"size", int64(4096)}})
+			So(options, ShouldResemble, bson.D{{"autoIndexId", false}})
+		})
+
+		Convey("options that already set a size should be left alone", func() {
+			capped := bson.D{{"capped", true}, {"size", 100}}
+			So(preallocatedOptions(intent, capped), ShouldResemble, capped)
+		})
+	})
+}
+
+func TestShouldRestoreUsersAndRoles(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a full restore of a dump containing users", t, func() {
+		restore := &MongoRestore{
+			InputOptions:  &InputOptions{},
+			OutputOptions: &OutputOptions{},
+			ToolOptions:   &commonOpts.ToolOptions{Namespace: &commonOpts.Namespace{}},
+			manager:       intents.NewIntentManager(),
+		}
+		restore.manager.Put(&intents.Intent{DB: "admin", C: "system.users", BSONPath: "admin/system.users.bson"})
+
+		Convey("users and roles should be restored", func() {
+			So(restore.ShouldRestoreUsersAndRoles(), ShouldBeTrue)
+		})
+
+		Convey("users and roles should not be restored with --indexesOnly", func() {
+			restore.OutputOptions.IndexesOnly = true
+			So(restore.ShouldRestoreUsersAndRoles(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestParseCommitQuorum(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --commitQuorum", t, func() {
+		Convey("numbers should be parsed as a count of members", func() {
+			quorum, err := parseCommitQuorum("2")
+			So(err, ShouldBeNil)
+			So(quorum, ShouldEqual, 2)
+		})
+
+		Convey("other values should be passed on as quorum names", func() {
+			quorum, err := parseCommitQuorum("votingMembers")
+			So(err, ShouldBeNil)
+			So(quorum, ShouldEqual, "votingMembers")
+		})
+
+		Convey("negative numbers should be rejected", func() {
+			_, err := parseCommitQuorum("-1")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLoadIndexesFromBSON(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the system.indexes of two databases renamed to one collection", t, func() {
+		renamer, err := newNSRenamer([]string{"a.users", "b.users"}, []string{"all.users", "all.users"})
+		So(err, ShouldBeNil)
+		renamer.conflict = nsConflictSuffix
+		restore := &MongoRestore{renamer: renamer, manager: intents.NewIntentManager()}
+		for _, dbName := range []string{"a", "b"} {
+			So(restore.renameIntent(&intents.Intent{DB: dbName, C: "users"}), ShouldBeNil)
+			data, err := bson.Marshal(bson.D{{"name", dbName + "_idx"}, {"ns", dbName + ".users"}, {"key", bson.D{{dbName, 1}}}})
+			So(err, ShouldBeNil)
+			restore.manager.Put(&intents.Intent{DB: dbName, C: "system.indexes",
+				BSONPath: dbName + "/system.indexes.bson", BSONFile: &memoryBSONFile{data: data}})
+		}
+
+		Convey("each index should be filed under the target its collection is restored to", func() {
+			So(restore.LoadIndexesFromBSON(), ShouldBeNil)
+			indexes := restore.dbCollectionIndexes["all"]
+			So(len(indexes["users"]), ShouldEqual, 1)
+			So(indexes["users"][0].Options["name"], ShouldEqual, "a_idx")
+			So(len(indexes["users_2"]), ShouldEqual, 1)
+			So(indexes["users_2"][0].Options["name"], ShouldEqual, "b_idx")
+		})
+	})
+}
@@ -2,6 +2,7 @@
 package mongorestore
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/archive"
@@ -11,13 +12,18 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 )
 
 // MongoRestore is a container for the user-specified options and
@@ -38,13 +44,54 @@ type MongoRestore struct {
 	manager         *intents.Manager
 	safety          *mgo.Safe
 	progressManager *progress.Manager
+	showHistory     bool
+
+	// bytes of the archive consumed, read or skipped over, with --archive
+	archiveProgress progress.Progressor
 
 	objCheck         bool
+	oplogStart       bson.MongoTimestamp
 	oplogLimit       bson.MongoTimestamp
+	oplogNSFilter    *oplogNSFilter
+	preallocateSize  int64
 	useStdin         bool
 	isMongos         bool
+	serverLimits     db.ServerLimits
 	useWriteCommands bool
 	authVersions     authVersionPair
+	renamer          *nsRenamer
+	nsInclude        []*regexp.Regexp
+	restoreOrder     []*regexp.Regexp
+	insertionOrders  []insertionOrder
+	filterFiles      *regexp.Regexp
+	smokeTests       []smokeTest
+	transform        documentTransform
+	optionsOverrides optionsOverrides
+	commitQuorum     interface{}
+	sizeGuard        *db.SizeGuard
+	checkpoint       *checkpointer
+	rateLimiter      *rateLimiter
+	retry            *db.RetryPolicy
+	rejects          *rejectWriter
+	readyEvents      *readyNotifier
+	upsertWriter     *upsertWriter
+	verifier         *restoreVerifier
+	stager           *stager
+	sharding         *shardingConfig
+
+	// the dump's config database, read rather than restored with --sharded
+	configDir archive.DirLike
+
+	// archiveBufferSize bounds the data buffered for each collection
+	// restored from an archive, or is 0 for the default
+	archiveBufferSize int64
+
+	// per-collection statistics, for --statsFile
+	stats statsCollector
+
+	// sessions on the --mongosHosts, handed to insertion workers in turn
+	mongosProviders []*db.SessionProvider
+	nextMongos      uint32
 
 	// a map of database names to a list of collection names
 	knownCollections      map[string][]string
@@ -53,6 +100,14 @@ type MongoRestore struct {
 	// indexes belonging to dbs and collections
 	dbCollectionIndexes map[string]collectionIndexes
 
+	// TTL indexes whose expiry is held off until the restore is done, with
+	// --holdTTLExpiry
+	ttlHolder *ttlHolder
+
+	// index builds postponed until all data is restored, with --deferIndexes
+	deferredIndexes      []deferredIndexBuild
+	deferredIndexesMutex sync.Mutex
+
 	archive *archive.Reader
 }
 
@@ -92,6 +147,11 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		return fmt.Errorf("cannot use --restoreDbUsersAndRoles with the admin database")
 	}
 
+	if restore.OutputOptions.NumInsertionWorkers < 1 {
+		return fmt.Errorf(
+			"must specify at least one insertion worker per collection")
+	}
+
 	var err error
 	restore.isMongos, err = restore.SessionProvider.IsMongos()
 	if err != nil {
@@ -101,16 +161,319 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		log.Log(log.DebugLow, "restoring to a sharded system")
 	}
 
+	// bulk inserts are split to fit in the server's messages
+	restore.serverLimits, err = restore.SessionProvider.GetServerLimits()
+	if err != nil {
+		return fmt.Errorf("error reading the server's limits: %v", err)
+	}
+	log.Logf(log.DebugLow, "server accepts documents of up to %v and messages of up to %v",
+		text.FormatByteAmount(int64(restore.serverLimits.MaxBSONObjectSize)),
+		text.FormatByteAmount(int64(restore.serverLimits.MaxMessageSizeBytes)))
+
+	if restore.OutputOptions.BatchSize < 0 {
+		return fmt.Errorf("--batchSize must be positive")
+	}
+	if restore.OutputOptions.BatchSize > 0 {
+		restore.ToolOptions.BulkBufferSize = restore.OutputOptions.BatchSize
+	}
+
+	if restore.OutputOptions.MongosHosts != "" {
+		if err = restore.connectMongosHosts(); err != nil {
+			return err
+		}
+	}
+
 	if restore.InputOptions.OplogLimit != "" {
 		if !restore.InputOptions.OplogReplay {
 			return fmt.Errorf("cannot use --oplogLimit without --oplogReplay enabled")
 		}
-		restore.oplogLimit, err = ParseTimestampFlag(restore.InputOptions.OplogLimit)
+		restore.oplogStart, restore.oplogLimit, err = ParseOplogLimit(restore.InputOptions.OplogLimit)
 		if err != nil {
 			return fmt.Errorf("error parsing timestamp argument to --oplogLimit: %v", err)
 		}
 	}
 
+	if restore.InputOptions.OplogReplayUntil != "" {
+		if !restore.InputOptions.OplogReplay {
+			return fmt.Errorf("cannot use --oplogReplayUntil without --oplogReplay enabled")
+		}
+		if restore.InputOptions.OplogLimit != "" {
+			return fmt.Errorf("cannot use --oplogReplayUntil with --oplogLimit")
+		}
+		restore.oplogLimit, err = ParseOplogReplayUntil(restore.InputOptions.OplogReplayUntil)
+		if err != nil {
+			return fmt.Errorf("error parsing --oplogReplayUntil: %v", err)
+		}
+	}
+
+	if len(restore.InputOptions.OplogFiles) > 0 && !restore.InputOptions.OplogReplay {
+		return fmt.Errorf("cannot use --oplogFile without --oplogReplay enabled")
+	}
+	if restore.InputOptions.OplogAllowGaps && len(restore.InputOptions.OplogFiles) == 0 {
+		return fmt.Errorf("cannot use --oplogAllowGaps without --oplogFile")
+	}
+
+	if len(restore.InputOptions.OplogNsInclude) > 0 || len(restore.InputOptions.OplogNsExclude) > 0 {
+		if !restore.InputOptions.OplogReplay {
+			return fmt.Errorf("cannot use --oplogNsInclude or --oplogNsExclude without --oplogReplay enabled")
+		}
+		restore.oplogNSFilter, err = newOplogNSFilter(
+			restore.InputOptions.OplogNsInclude, restore.InputOptions.OplogNsExclude)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restore.InputOptions.ArchiveBufferSize != "" {
+		if restore.InputOptions.Archive == "" {
+			return fmt.Errorf("--archiveBufferSize requires --archive")
+		}
+		restore.archiveBufferSize, err = text.ParseByteAmount(restore.InputOptions.ArchiveBufferSize)
+		if err != nil {
+			return fmt.Errorf("error parsing --archiveBufferSize: %v", err)
+		}
+		if restore.archiveBufferSize == 0 {
+			return fmt.Errorf("--archiveBufferSize must be greater than zero")
+		}
+	}
+
+	if restore.OutputOptions.PreallocateMinSize != "" {
+		restore.preallocateSize, err = text.ParseByteAmount(restore.OutputOptions.PreallocateMinSize)
+		if err != nil {
+			return fmt.Errorf("error parsing --preallocateMinSize: %v", err)
+		}
+		if restore.preallocateSize == 0 {
+			return fmt.Errorf("--preallocateMinSize must be greater than zero")
+		}
+	}
+
+	restore.upsertWriter, err = newUpsertWriter(restore.OutputOptions.Mode, restore.OutputOptions.UpsertFields)
+	if err != nil {
+		return err
+	}
+
+	if restore.OutputOptions.Staged {
+		switch {
+		case restore.upsertWriter != nil:
+			return fmt.Errorf("cannot use --staged with --mode %v", restore.OutputOptions.Mode)
+		case restore.OutputOptions.IndexesOnly:
+			return fmt.Errorf("cannot use --staged with --indexesOnly")
+		case restore.OutputOptions.StateFile != "":
+			return fmt.Errorf("cannot use --staged with --stateFile")
+		}
+		restore.stager = &stager{}
+	}
+
+	if restore.OutputOptions.HoldTTLExpiry {
+		restore.ttlHolder = &ttlHolder{}
+	}
+
+	if restore.OutputOptions.Sharded {
+		switch {
+		case !restore.isMongos:
+			return fmt.Errorf("--sharded can only be used when --host is a mongos")
+		case restore.InputOptions.Archive != "":
+			return fmt.Errorf("cannot use --sharded with --archive")
+		case restore.OutputOptions.Staged:
+			return fmt.Errorf("cannot use --sharded with --staged")
+		}
+	} else if restore.OutputOptions.ShardingConfig != "" {
+		return fmt.Errorf("--shardingConfig requires --sharded")
+	}
+
+	var retryBackoff time.Duration
+	if restore.OutputOptions.RetryBackoff != "" {
+		retryBackoff, err = time.ParseDuration(restore.OutputOptions.RetryBackoff)
+		if err != nil || retryBackoff < 0 {
+			return fmt.Errorf("invalid --retryBackoff '%v', expected a duration such as 500ms or 2s",
+				restore.OutputOptions.RetryBackoff)
+		}
+	}
+	if restore.OutputOptions.MaxWriteAttempts < 0 {
+		return fmt.Errorf("--maxWriteAttempts can not be negative")
+	}
+	restore.retry = db.NewRetryPolicy(restore.OutputOptions.MaxWriteAttempts, retryBackoff)
+
+	if restore.OutputOptions.RateLimit != "" {
+		restore.rateLimiter, err = parseRateLimit(restore.OutputOptions.RateLimit)
+		if err != nil {
+			return err
+		}
+		log.Logf(log.Info, "limiting inserts to %v", restore.rateLimiter)
+	}
+
+	restore.nsInclude, err = compileNSIncludes(restore.OutputOptions.NSInclude)
+	if err != nil {
+		return err
+	}
+
+	if len(restore.OutputOptions.RestoreOrder) > 0 {
+		if restore.InputOptions.Archive != "" {
+			// an archive's collections are restored in the order they come
+			return fmt.Errorf("cannot use --restoreOrder with --archive")
+		}
+		restore.restoreOrder, err = compileRestoreOrder(restore.OutputOptions.RestoreOrder)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restore.InputOptions.FilterFiles != "" {
+		if restore.InputOptions.Archive != "" {
+			return fmt.Errorf("cannot use --filterFiles with --archive")
+		}
+		restore.filterFiles, err = regexp.Compile(restore.InputOptions.FilterFiles)
+		if err != nil {
+			return fmt.Errorf("error parsing --filterFiles: %v", err)
+		}
+	}
+
+	if len(restore.OutputOptions.NSFrom) > 0 || len(restore.OutputOptions.NSTo) > 0 {
+		if restore.InputOptions.Archive != "" {
+			return fmt.Errorf("cannot use --nsFrom and --nsTo with --archive")
+		}
+		restore.renamer, err = newNSRenamer(restore.OutputOptions.NSFrom, restore.OutputOptions.NSTo)
+		if err != nil {
+			return err
+		}
+		restore.renamer.conflict, err = validateNSConflict(restore.OutputOptions.NSConflict)
+		if err != nil {
+			return err
+		}
+	} else if restore.OutputOptions.NSConflict != "" {
+		return fmt.Errorf("--nsConflict requires --nsFrom and --nsTo")
+	}
+
+	if restore.OutputOptions.NoIndexRestore {
+		switch {
+		case restore.OutputOptions.DeferIndexes:
+			return fmt.Errorf("cannot use --deferIndexes with --noIndexRestore")
+		case restore.OutputOptions.BackgroundIndexes:
+			return fmt.Errorf("cannot use --backgroundIndexes with --noIndexRestore")
+		case restore.OutputOptions.CommitQuorum != "":
+			return fmt.Errorf("cannot use --commitQuorum with --noIndexRestore")
+		case restore.OutputOptions.HoldTTLExpiry:
+			return fmt.Errorf("cannot use --holdTTLExpiry with --noIndexRestore")
+		}
+	}
+
+	if restore.OutputOptions.CommitQuorum != "" {
+		restore.commitQuorum, err = parseCommitQuorum(restore.OutputOptions.CommitQuorum)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restore.OutputOptions.IndexesOnly {
+		switch {
+		case restore.OutputOptions.NoIndexRestore:
+			return fmt.Errorf("cannot use --indexesOnly with --noIndexRestore")
+		case restore.OutputOptions.Drop:
+			// the collections' documents would be dropped and not restored
+			return fmt.Errorf("cannot use --indexesOnly with --drop")
+		case restore.InputOptions.OplogReplay:
+			return fmt.Errorf("cannot use --indexesOnly with --oplogReplay")
+		case restore.InputOptions.Archive != "":
+			return fmt.Errorf("cannot use --indexesOnly with --archive")
+		case len(restore.OutputOptions.Transform) > 0:
+			return fmt.Errorf("cannot use --indexesOnly with --transform")
+		case restore.OutputOptions.FixBrokenFieldNames != "":
+			return fmt.Errorf("cannot use --indexesOnly with --fixBrokenFieldNames")
+		}
+	}
+
+	if len(restore.OutputOptions.Transform) > 0 {
+		if restore.InputOptions.OplogReplay {
+			// the oplog would replay the untransformed documents
+			return fmt.Errorf("cannot use --transform with --oplogReplay")
+		}
+		restore.transform, err = parseTransforms(restore.OutputOptions.Transform)
+		if err != nil {
+			return err
+		}
+	}
+
+	if replacement := restore.OutputOptions.FixBrokenFieldNames; replacement != "" {
+		switch {
+		case strings.Contains(replacement, ".") || strings.HasPrefix(replacement, "$"):
+			return fmt.Errorf("invalid --fixBrokenFieldNames replacement '%v': "+
+				"it can't contain '.' or start with '$'", replacement)
+		case restore.InputOptions.OplogReplay:
+			// the oplog would replay the documents with their broken names
+			return fmt.Errorf("cannot use --fixBrokenFieldNames with --oplogReplay")
+		}
+		// fix the names first, so that --transform may refer to the fixed ones
+		restore.transform = append(documentTransform{fixFieldNamesTransform(replacement)}, restore.transform...)
+	}
+
+	if len(restore.OutputOptions.OptionsOverride) > 0 {
+		switch {
+		case restore.OutputOptions.NoOptionsRestore:
+			return fmt.Errorf("cannot use --collectionOptionsOverride with --noOptionsRestore")
+		case restore.OutputOptions.IndexesOnly:
+			return fmt.Errorf("cannot use --collectionOptionsOverride with --indexesOnly")
+		}
+		restore.optionsOverrides, err = parseOptionsOverrides(restore.OutputOptions.OptionsOverride)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restore.OutputOptions.OmitID {
+		switch {
+		case restore.InputOptions.OplogReplay:
+			// the oplog's entries refer to the documents by their dumped _id
+			return fmt.Errorf("cannot use --omitId with --oplogReplay")
+		case restore.upsertWriter != nil && restore.upsertWriter.keyedOnID():
+			return fmt.Errorf("cannot use --omitId with --mode %v matching documents on _id; "+
+				"use --upsertFields to match on other fields", restore.OutputOptions.Mode)
+		}
+		// drop the _id first, so that --transform may set a new one
+		restore.transform = append(documentTransform{omitIDTransform}, restore.transform...)
+	}
+
+	restore.sizeGuard, err = db.NewSizeGuard(restore.OutputOptions.OversizedDocs, restore.OutputOptions.TruncateFields)
+	if err != nil {
+		return err
+	}
+
+	if restore.OutputOptions.RejectFile != "" {
+		if restore.OutputOptions.StopOnError {
+			return fmt.Errorf("cannot use --rejectFile with --stopOnError")
+		}
+		restore.rejects, err = newRejectWriter(restore.OutputOptions.RejectFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restore.OutputOptions.ReadyEvents != "" {
+		restore.readyEvents, err = newReadyNotifier(restore.OutputOptions.ReadyEvents)
+		if err != nil {
+			return err
+		}
+		if restore.InputOptions.OplogReplay {
+			restore.readyEvents.hold()
+		}
+	}
+
+	if restore.OutputOptions.VerifyReport != "" && !restore.OutputOptions.Verify {
+		return fmt.Errorf("--verifyReport requires --verify")
+	}
+	if restore.OutputOptions.Verify {
+		if restore.OutputOptions.IndexesOnly {
+			return fmt.Errorf("cannot use --verify with --indexesOnly")
+		}
+		restore.verifier = newRestoreVerifier()
+	}
+
+	if restore.OutputOptions.SmokeTests != "" {
+		restore.smokeTests, err = readSmokeTests(restore.OutputOptions.SmokeTests)
+		if err != nil {
+			return fmt.Errorf("error reading --smokeTests: %v", err)
+		}
+	}
+
 	// check if we are using a replica set and fall back to w=1 if we aren't (for <= 2.4)
 	nodeType, err := restore.SessionProvider.GetNodeType()
 	if err != nil {
@@ -135,9 +498,9 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		restore.tempRolesCol = *restore.ToolOptions.HiddenOptions.TempRolesColl
 	}
 
-	if restore.OutputOptions.NumInsertionWorkers < 0 {
-		return fmt.Errorf(
-			"cannot specify a negative number of insertion workers per collection")
+	restore.insertionOrders, err = parseInsertionOrders(restore.OutputOptions.InsertionOrder)
+	if err != nil {
+		return err
 	}
 
 	// a single dash signals reading from stdin
@@ -152,11 +515,65 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		}
 	}
 
+	if restore.OutputOptions.Resume && restore.OutputOptions.StateFile == "" {
+		return fmt.Errorf("cannot use --resume without --stateFile")
+	}
+	if restore.OutputOptions.StateFile != "" {
+		if restore.InputOptions.Archive != "" {
+			return fmt.Errorf("cannot use --stateFile with --archive")
+		}
+		if restore.useStdin {
+			return fmt.Errorf("cannot use --stateFile when restoring from stdin")
+		}
+		restore.checkpoint, err = newCheckpointer(restore.OutputOptions.StateFile, restore.OutputOptions.Resume)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// Restore runs the mongorestore program.
+// Restore runs the mongorestore program, writing its statistics to the
+// --statsFile whether it succeeds or not.
 func (restore *MongoRestore) Restore() error {
+	if restore.InputOptions.List {
+		return restore.ListArchive(os.Stdout)
+	}
+
+	restore.stats.start = time.Now()
+	err := restore.restore()
+	if ttlErr := restore.ReleaseTTLIndexes(); ttlErr != nil {
+		if err != nil {
+			log.Logf(log.Always, "%v", ttlErr)
+		} else {
+			err = ttlErr
+		}
+	}
+	if rejectErr := restore.rejects.Close(); rejectErr != nil && err == nil {
+		err = rejectErr
+	}
+	if readyErr := restore.notifyDone(err); readyErr != nil {
+		if err != nil {
+			log.Logf(log.Always, "%v", readyErr)
+		} else {
+			err = readyErr
+		}
+	}
+	if readyErr := restore.readyEvents.Close(); readyErr != nil && err == nil {
+		err = readyErr
+	}
+	if statsErr := restore.writeStats(err); statsErr != nil {
+		if err != nil {
+			log.Logf(log.Always, "%v", statsErr)
+		} else {
+			err = statsErr
+		}
+	}
+	return err
+}
+
+func (restore *MongoRestore) restore() error {
 	var target archive.DirLike
 	err := restore.ParseAndValidateOptions()
 	if err != nil {
@@ -177,6 +594,10 @@ func (restore *MongoRestore) Restore() error {
 			Prelude: &archive.Prelude{},
 		}
 		err = restore.archive.Prelude.Read(restore.archive.In)
+		if err != nil && restore.InputOptions.Archive == "-" && restore.archiveProgress.Get() == 0 {
+			return fmt.Errorf("no archive data on standard input; check that the command writing " +
+				"the archive, such as mongodump --archive, succeeded")
+		}
 		if err != nil {
 			return err
 		}
@@ -215,21 +636,15 @@ func (restore *MongoRestore) Restore() error {
 		restore.OutputOptions.NumInsertionWorkers = restore.OutputOptions.NumParallelCollections
 	}
 	if restore.InputOptions.Archive != "" {
-		if int(restore.archive.Prelude.Header.ConcurrentCollections) > restore.OutputOptions.NumParallelCollections {
-			restore.OutputOptions.NumParallelCollections = int(restore.archive.Prelude.Header.ConcurrentCollections)
-			restore.OutputOptions.NumInsertionWorkers = int(restore.archive.Prelude.Header.ConcurrentCollections)
-			log.Logf(log.Always,
-				"setting number of parallel collections to number of parallel collections in archive (%v)",
-				restore.archive.Prelude.Header.ConcurrentCollections,
-			)
-		}
+		restore.useArchiveConcurrency(int(restore.archive.Prelude.Header.ConcurrentCollections))
 	}
 
 	// Create the demux before intent creation, because muted archive intents need
 	// to register themselves with the demux directly
 	if restore.InputOptions.Archive != "" {
 		restore.archive.Demux = &archive.Demultiplexer{
-			In: restore.archive.In,
+			In:         restore.archive.In,
+			BufferSize: int(restore.archiveBufferSize),
 		}
 	}
 
@@ -265,6 +680,12 @@ func (restore *MongoRestore) Restore() error {
 		return fmt.Errorf("error scanning filesystem: %v", err)
 	}
 
+	if restore.OutputOptions.Sharded {
+		if err = restore.loadShardingConfig(); err != nil {
+			return err
+		}
+	}
+
 	if restore.isMongos && restore.manager.HasConfigDBIntent() && restore.ToolOptions.DB == "" {
 		return fmt.Errorf("cannot do a full restore on a sharded system - " +
 			"remove the 'config' directory from the dump directory first")
@@ -325,9 +746,27 @@ func (restore *MongoRestore) Restore() error {
 		return fmt.Errorf("restore error: %v", err)
 	}
 
+	if !restore.OutputOptions.NoPreflightChecks {
+		err = restore.PreflightChecks()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Drop the target collections up front, in parallel, unless they are
+	// only to be replaced once restored
+	if restore.OutputOptions.Drop && restore.stager == nil {
+		err = restore.DropIntents()
+		if err != nil {
+			return fmt.Errorf("restore error: error dropping collections: %v", err)
+		}
+	}
+
 	// Restore the regular collections
 	if restore.InputOptions.Archive != "" {
 		restore.manager.UsePrioritizer(restore.archive.Demux.NewPrioritizer(restore.manager))
+	} else if len(restore.restoreOrder) > 0 {
+		restore.manager.FinalizeRanked(restore.restoreRank)
 	} else if restore.OutputOptions.NumParallelCollections > 1 {
 		restore.manager.Finalize(intents.MultiDatabaseLTF)
 	} else {
@@ -335,11 +774,36 @@ func (restore *MongoRestore) Restore() error {
 		restore.manager.Finalize(intents.Legacy)
 	}
 
+	restore.checkpoint.start()
 	err = restore.RestoreIntents()
+	if stopErr := restore.checkpoint.stop(); stopErr != nil {
+		log.Logf(log.Always, "%v", stopErr)
+	}
+	restore.sizeGuard.LogSummary()
 	if err != nil {
+		restore.DropStagedCollections()
 		return fmt.Errorf("restore error: %v", err)
 	}
 
+	err = restore.CreateDeferredIndexes()
+	if err != nil {
+		restore.DropStagedCollections()
+		return fmt.Errorf("restore error: %v", err)
+	}
+
+	err = restore.SwapStagedCollections()
+	if err != nil {
+		return fmt.Errorf("restore error: %v", err)
+	}
+
+	// Verify the data before the oplog replay changes it
+	if restore.verifier != nil {
+		err = restore.Verify()
+		if err != nil {
+			return fmt.Errorf("restore error: %v", err)
+		}
+	}
+
 	// Restore users/roles
 	if restore.ShouldRestoreUsersAndRoles() {
 		if restore.manager.Users() != nil {
@@ -362,6 +826,16 @@ func (restore *MongoRestore) Restore() error {
 		if err != nil {
 			return fmt.Errorf("restore error: %v", err)
 		}
+		if err = restore.readyEvents.release(); err != nil {
+			return err
+		}
+	}
+
+	if len(restore.smokeTests) > 0 {
+		err = restore.RunSmokeTests()
+		if err != nil {
+			return fmt.Errorf("restore error: %v", err)
+		}
 	}
 
 	log.Log(log.Always, "done")
@@ -379,21 +853,82 @@ func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 		if targetStat.IsDir() {
 			defaultArchiveFilePath := filepath.Join(restore.InputOptions.Archive, "archive")
 			if restore.InputOptions.Gzip {
-				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
+				defaultArchiveFilePath = defaultArchiveFilePath + gzipSuffix
+			} else if _, err := os.Stat(defaultArchiveFilePath); os.IsNotExist(err) {
+				// fall back to a compressed archive
+				defaultArchiveFilePath = defaultArchiveFilePath + gzipSuffix
 			}
-			rc, err = os.Open(defaultArchiveFilePath)
+			rc, err = openArchiveFile(defaultArchiveFilePath)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			rc, err = os.Open(restore.InputOptions.Archive)
+			rc, err = openArchiveFile(restore.InputOptions.Archive)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
-	if restore.InputOptions.Gzip {
-		return gzip.NewReader(rc)
+	// count the bytes consumed, out of the file's size if it has one; the
+	// size of a stream, or of an archive in volumes, is unknown
+	var total int64
+	file, isFile := rc.(*os.File)
+	if isFile && file != os.Stdin {
+		if stat, err := file.Stat(); err == nil && stat.Mode().IsRegular() {
+			total = stat.Size()
+		}
 	}
-	return rc, nil
+	restore.archiveProgress = progress.NewCounter(total)
+	counted := &countingReader{in: rc, progress: restore.archiveProgress}
+
+	// decompress the archive with --gzip, or when it starts with a gzip header
+	buffered := bufio.NewReader(counted)
+	if restore.InputOptions.Gzip || isGzipped(buffered) {
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return &wrappedReadCloser{gzipReader, rc}, nil
+	}
+	if isFile && file != os.Stdin {
+		// skip the namespaces left out of the restore by seeking past them;
+		// standard input is always read through, as a stream
+		return &wrappedReadCloser{&seekingReader{buffered, counted}, rc}, nil
+	}
+	return &wrappedReadCloser{ioutil.NopCloser(buffered), rc}, nil
+}
+
+// openArchiveFile opens the archive at path, reading it back from all its
+// volumes if mongodump split it into volumes.
+func openArchiveFile(path string) (io.ReadCloser, error) {
+	if !archive.HasVolumes(path) {
+		return os.Open(path)
+	}
+	log.Logf(log.DebugLow, "reading archive %v from its volumes", path)
+	return archive.OpenVolumes(path)
+}
+
+// isGzipped returns true if the reader's data starts with the gzip magic
+// number, without consuming it.
+func isGzipped(reader *bufio.Reader) bool {
+	header, err := reader.Peek(2)
+	return err == nil && header[0] == 0x1f && header[1] == 0x8b
+}
+
+// useArchiveConcurrency raises the number of parallel collections, and of
+// insertion workers unless set explicitly, to the number of collections the
+// archive was dumped with in parallel.
+func (restore *MongoRestore) useArchiveConcurrency(concurrentCollections int) {
+	if concurrentCollections <= restore.OutputOptions.NumParallelCollections {
+		return
+	}
+	restore.OutputOptions.NumParallelCollections = concurrentCollections
+	// keep an explicitly set --numInsertionWorkersPerCollection
+	if restore.OutputOptions.NumInsertionWorkers == 1 {
+		restore.OutputOptions.NumInsertionWorkers = concurrentCollections
+	}
+	log.Logf(log.Always,
+		"setting number of parallel collections to number of parallel collections in archive (%v)",
+		concurrentCollections,
+	)
 }
@@ -0,0 +1,85 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"gopkg.in/mgo.v2"
+	"strings"
+	"sync/atomic"
+)
+
+// parseMongosHosts splits the comma-separated --mongosHosts list.
+func parseMongosHosts(hosts string) ([]string, error) {
+	parsed := []string{}
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" || strings.Contains(host, "/") {
+			return nil, fmt.Errorf("invalid host '%v' in --mongosHosts, expected host or host:port", host)
+		}
+		parsed = append(parsed, host)
+	}
+	return parsed, nil
+}
+
+// mongosHostOptions returns a copy of the tool options connecting to the
+// given mongos instead of --host.
+func mongosHostOptions(opts *options.ToolOptions, host string) *options.ToolOptions {
+	mongosOpts := *opts
+	connection := *opts.Connection
+	connection.Host = host
+	if strings.Contains(host, ":") {
+		connection.Port = ""
+	}
+	mongosOpts.Connection = &connection
+	mongosOpts.Direct = true
+	mongosOpts.ReplicaSetName = ""
+	return &mongosOpts
+}
+
+// connectMongosHosts creates a session provider for each of the
+// --mongosHosts, checking that each one is a mongos.
+func (restore *MongoRestore) connectMongosHosts() error {
+	if !restore.isMongos {
+		return fmt.Errorf("--mongosHosts can only be used when --host is a mongos")
+	}
+	hosts, err := parseMongosHosts(restore.OutputOptions.MongosHosts)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		provider, err := db.NewSessionProvider(*mongosHostOptions(restore.ToolOptions, host))
+		if err != nil {
+			return fmt.Errorf("error connecting to mongos %v: %v", host, err)
+		}
+		provider.SetFlags(db.DisableSocketTimeout)
+		isMongos, err := provider.IsMongos()
+		if err != nil {
+			return fmt.Errorf("error connecting to mongos %v: %v", host, err)
+		}
+		if !isMongos {
+			return fmt.Errorf("%v in --mongosHosts is not a mongos", host)
+		}
+		restore.mongosProviders = append(restore.mongosProviders, provider)
+	}
+	log.Logf(log.Info, "spreading insertion workers across %v mongos hosts", len(hosts))
+	return nil
+}
+
+// insertionSession returns the session an insertion worker inserts with:
+// a session on the next of the --mongosHosts in turn, or else a copy of the
+// collection's session.
+func (restore *MongoRestore) insertionSession(session *mgo.Session) (*mgo.Session, error) {
+	if len(restore.mongosProviders) == 0 {
+		return session.Copy(), nil
+	}
+	next := atomic.AddUint32(&restore.nextMongos, 1) - 1
+	provider := restore.mongosProviders[next%uint32(len(restore.mongosProviders))]
+	s, err := provider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	s.SetSafe(restore.safety)
+	return s, nil
+}
@@ -0,0 +1,44 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestMongosHosts(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --mongosHosts", t, func() {
+		Convey("hosts should be split on commas", func() {
+			hosts, err := parseMongosHosts("mongos1:27017, mongos2")
+			So(err, ShouldBeNil)
+			So(hosts, ShouldResemble, []string{"mongos1:27017", "mongos2"})
+		})
+
+		Convey("empty hosts and replica set names should be rejected", func() {
+			_, err := parseMongosHosts("mongos1,,mongos2")
+			So(err, ShouldNotBeNil)
+			_, err = parseMongosHosts("rs0/mongos1")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With tool options connecting to a mongos through --host", t, func() {
+		opts := &options.ToolOptions{
+			Connection: &options.Connection{Host: "mongos0", Port: "27018"},
+		}
+
+		Convey("the options for another mongos should only change the host", func() {
+			mongosOpts := mongosHostOptions(opts, "mongos1:27017")
+			So(mongosOpts.Host, ShouldEqual, "mongos1:27017")
+			So(mongosOpts.Port, ShouldEqual, "")
+			So(opts.Host, ShouldEqual, "mongos0")
+
+			mongosOpts = mongosHostOptions(opts, "mongos2")
+			So(mongosOpts.Port, ShouldEqual, "27018")
+		})
+	})
+}
@@ -0,0 +1,256 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"regexp"
+	"strings"
+)
+
+// nsRenamer maps the namespaces in a dump to the namespaces they are
+// restored to, following the --nsFrom and --nsTo patterns. A '*' in a
+// --nsFrom pattern matches any run of characters, and the matching '*' in
+// its --nsTo pattern is replaced with them.
+type nsRenamer struct {
+	from []*regexp.Regexp
+	to   [][]string
+
+	// sources records which dump namespace each target was renamed from,
+	// so that two collections are only restored into one as --nsConflict
+	// allows, and targets which target each dump namespace was given
+	sources map[string]string
+	targets map[string]string
+
+	// conflict is the --nsConflict policy
+	conflict string
+}
+
+// Policies for dump namespaces renamed to the same target, for --nsConflict.
+const (
+	nsConflictFail   = "fail"
+	nsConflictMerge  = "merge"
+	nsConflictSuffix = "suffix"
+)
+
+// validateNSConflict checks the --nsConflict policy, returning the default
+// for an empty one.
+func validateNSConflict(policy string) (string, error) {
+	switch policy {
+	case "":
+		return nsConflictFail, nil
+	case nsConflictFail, nsConflictMerge, nsConflictSuffix:
+		return policy, nil
+	}
+	return "", fmt.Errorf("--nsConflict must be one of fail, merge or suffix, not '%v'", policy)
+}
+
+// newNSRenamer compiles the pairs of --nsFrom and --nsTo patterns. Pairs
+// are tried in order, and the first matching one is used.
+func newNSRenamer(from, to []string) (*nsRenamer, error) {
+	if len(from) != len(to) {
+		return nil, fmt.Errorf("--nsFrom and --nsTo must be given the same number of times")
+	}
+	renamer := &nsRenamer{sources: map[string]string{}, targets: map[string]string{}}
+	for i := range from {
+		if from[i] == "" || to[i] == "" {
+			return nil, fmt.Errorf("--nsFrom and --nsTo patterns can not be blank")
+		}
+		toParts := strings.Split(to[i], "*")
+		if strings.Count(from[i], "*") != len(toParts)-1 {
+			return nil, fmt.Errorf("--nsFrom '%v' and --nsTo '%v' must have the same number of '*' wildcards",
+				from[i], to[i])
+		}
+		pattern, err := compileNSPattern(from[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nsFrom '%v': %v", from[i], err)
+		}
+		renamer.from = append(renamer.from, pattern)
+		renamer.to = append(renamer.to, toParts)
+	}
+	return renamer, nil
+}
+
+// compileNSPattern returns a regular expression matching the namespaces
+// that fit a pattern in which '*' matches any run of characters. Each '*'
+// becomes a capturing group.
+func compileNSPattern(pattern string) (*regexp.Regexp, error) {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.Compile("^" + strings.Join(parts, "(.*?)") + "$")
+}
+
+// Rename returns the namespace the given one is restored to, which is the
+// namespace itself if no --nsFrom pattern matches it.
+func (renamer *nsRenamer) Rename(namespace string) string {
+	for i, pattern := range renamer.from {
+		matches := pattern.FindStringSubmatch(namespace)
+		if matches == nil {
+			continue
+		}
+		toParts := renamer.to[i]
+		renamed := toParts[0]
+		for j, match := range matches[1:] {
+			renamed += match + toParts[j+1]
+		}
+		return renamed
+	}
+	return namespace
+}
+
+// wholeDBProbe stands for any collection when renaming a database: it can't
+// appear in a collection name or a pattern, so only patterns that match every
+// collection of the database carry it through.
+const wholeDBProbe = "\x00"
+
+// RenameDB returns the database the given one is restored to, which is the
+// database itself unless a --nsFrom pattern renames all of its collections
+// into one database, such as --nsFrom 'prod.*' --nsTo 'staging.*'.
+func (renamer *nsRenamer) RenameDB(dbName string) string {
+	renamed := renamer.Rename(dbName + "." + wholeDBProbe)
+	if !strings.HasSuffix(renamed, "."+wholeDBProbe) {
+		return dbName
+	}
+	return strings.TrimSuffix(renamed, "."+wholeDBProbe)
+}
+
+// compileNSIncludes compiles the --nsInclude patterns.
+func compileNSIncludes(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("--nsInclude patterns can not be blank")
+		}
+		re, err := compileNSPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nsInclude '%v': %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// nsIncluded returns true if the namespace of the dump matches one of the
+// --nsInclude patterns, or if there are none.
+func (restore *MongoRestore) nsIncluded(namespace string) bool {
+	if len(restore.nsInclude) == 0 {
+		return true
+	}
+	for _, pattern := range restore.nsInclude {
+		if pattern.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the target of a dump namespace, settling any conflict
+// with another namespace renamed to the same target by the --nsConflict
+// policy: failing, merging both into the target, or renaming the later one
+// to the first free target with a numbered suffix, such as users_2.
+func (renamer *nsRenamer) resolve(source string) (string, error) {
+	if target, ok := renamer.targets[source]; ok {
+		return target, nil
+	}
+	target := renamer.Rename(source)
+	if other, ok := renamer.sources[target]; ok && other != source {
+		switch renamer.conflict {
+		case nsConflictMerge:
+			log.Logf(log.Always, "warning: restoring both %v and %v to %v", other, source, target)
+			renamer.targets[source] = target
+			return target, nil
+		case nsConflictSuffix:
+			suffixed := target
+			for n := 2; ; n++ {
+				suffixed = fmt.Sprintf("%v_%v", target, n)
+				if _, taken := renamer.sources[suffixed]; !taken {
+					break
+				}
+			}
+			log.Logf(log.Always, "warning: restoring %v to %v, as %v is also restored to %v",
+				source, suffixed, other, target)
+			target = suffixed
+		default:
+			return "", fmt.Errorf("cannot restore both %v and %v to %v", other, source, target)
+		}
+	}
+	renamer.sources[target] = source
+	renamer.targets[source] = target
+	return target, nil
+}
+
+// target returns the namespace a dump namespace is restored to: the target
+// its collection was given, with any --nsConflict suffix, or the namespace
+// the patterns rename it to for one without a collection in the dump.
+func (renamer *nsRenamer) target(source string) string {
+	if target, ok := renamer.targets[source]; ok {
+		return target
+	}
+	return renamer.Rename(source)
+}
+
+// renameIntent points the intent of a regular collection at the namespace
+// it is restored to. Special collections, such as users, roles and
+// system.indexes, keep their namespace.
+func (restore *MongoRestore) renameIntent(intent *intents.Intent) error {
+	if restore.renamer == nil || intent.IsSpecialCollection() || intent.IsOplog() ||
+		strings.HasPrefix(intent.C, "$") {
+		return nil
+	}
+	source := intent.Namespace()
+	target, err := restore.renamer.resolve(source)
+	if err != nil {
+		return err
+	}
+	if target == source {
+		return nil
+	}
+
+	db, collection, err := util.SplitAndValidateNamespace(target)
+	if err != nil {
+		return fmt.Errorf("cannot restore %v to %v: %v", source, target, err)
+	}
+	if err = util.ValidateDBName(db); err != nil {
+		return fmt.Errorf("cannot restore %v to %v: %v", source, target, err)
+	}
+	if err = util.ValidateCollectionGrammar(collection); err != nil {
+		return fmt.Errorf("cannot restore %v to %v: %v", source, target, err)
+	}
+	intent.DB, intent.C = db, collection
+	if intent.IsSpecialCollection() {
+		return fmt.Errorf("cannot restore %v to the special collection %v", source, target)
+	}
+	log.Logf(log.DebugLow, "restoring %v to %v", source, target)
+	return nil
+}
+
+// putIntent adds an intent to the manager. With --nsConflict=merge, the
+// BSON file of a collection renamed to the target of another is read after
+// the other's, and the metadata of the first collection is kept.
+func (restore *MongoRestore) putIntent(intent *intents.Intent) {
+	existing := restore.manager.IntentForNamespace(intent.Namespace())
+	if existing == nil {
+		restore.manager.Put(intent)
+		return
+	}
+	if intent.BSONFile != nil && existing.BSONFile != nil && intent.BSONPath != existing.BSONPath {
+		merged, ok := existing.BSONFile.(*mergedBSONFile)
+		if !ok {
+			merged = &mergedBSONFile{files: []intentFile{existing.BSONFile}}
+			existing.BSONFile = merged
+		}
+		merged.files = append(merged.files, intent.BSONFile)
+		existing.Size += intent.Size
+		log.Logf(log.Info, "merging %v into %v", intent.BSONPath, intent.Namespace())
+		intent.BSONPath, intent.BSONFile, intent.Size = "", nil, 0
+	}
+	if intent.MetadataPath != "" && existing.MetadataPath != "" && intent.MetadataPath != existing.MetadataPath {
+		log.Logf(log.Always, "warning: ignoring %v, restoring %v with the options and indexes of %v",
+			intent.MetadataPath, intent.Namespace(), existing.MetadataPath)
+		intent.MetadataPath, intent.MetadataFile = "", nil
+	}
+	restore.manager.Put(intent)
+}
@@ -0,0 +1,150 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+// memoryBSONFile is an in-memory intent file, read from the start each
+// time it is opened.
+type memoryBSONFile struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (f *memoryBSONFile) Open() error                 { f.Reader = bytes.NewReader(f.data); return nil }
+func (f *memoryBSONFile) Write(p []byte) (int, error) { return len(p), nil }
+func (f *memoryBSONFile) Close() error                { return nil }
+
+func TestNSRenamer(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --nsFrom and --nsTo patterns", t, func() {
+		renamer, err := newNSRenamer(
+			[]string{"prod.*", "logs.*_2015", "other.c"},
+			[]string{"staging.*", "archive.2015_*", "other.d"})
+		So(err, ShouldBeNil)
+
+		Convey("wildcards should carry the matched text over", func() {
+			So(renamer.Rename("prod.users"), ShouldEqual, "staging.users")
+			So(renamer.Rename("prod.system.js"), ShouldEqual, "staging.system.js")
+			So(renamer.Rename("logs.access_2015"), ShouldEqual, "archive.2015_access")
+		})
+
+		Convey("patterns without wildcards should match exactly", func() {
+			So(renamer.Rename("other.c"), ShouldEqual, "other.d")
+			So(renamer.Rename("other.cc"), ShouldEqual, "other.cc")
+		})
+
+		Convey("unmatched namespaces should be left alone", func() {
+			So(renamer.Rename("production.users"), ShouldEqual, "production.users")
+			So(renamer.Rename("logs.access_2016"), ShouldEqual, "logs.access_2016")
+		})
+	})
+
+	Convey("Mismatched --nsFrom and --nsTo patterns should be rejected", t, func() {
+		_, err := newNSRenamer([]string{"a.*"}, []string{})
+		So(err, ShouldNotBeNil)
+		_, err = newNSRenamer([]string{"a.*"}, []string{"b.c"})
+		So(err, ShouldNotBeNil)
+		_, err = newNSRenamer([]string{"a.*"}, []string{""})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("With a mongorestore renaming prod to staging", t, func() {
+		renamer, err := newNSRenamer([]string{"prod.*"}, []string{"staging.*"})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{renamer: renamer}
+
+		Convey("regular collections should be renamed", func() {
+			intent := &intents.Intent{DB: "prod", C: "users"}
+			So(restore.renameIntent(intent), ShouldBeNil)
+			So(intent.Namespace(), ShouldEqual, "staging.users")
+
+			// the metadata of the same collection maps to the same target
+			metadata := &intents.Intent{DB: "prod", C: "users", MetadataPath: "users.metadata.json"}
+			So(restore.renameIntent(metadata), ShouldBeNil)
+			So(metadata.Namespace(), ShouldEqual, "staging.users")
+		})
+
+		Convey("special collections should keep their namespace", func() {
+			intent := &intents.Intent{DB: "prod", C: "system.indexes", BSONPath: "system.indexes.bson"}
+			So(restore.renameIntent(intent), ShouldBeNil)
+			So(intent.Namespace(), ShouldEqual, "prod.system.indexes")
+		})
+
+		Convey("two collections restored to one namespace should be rejected", func() {
+			So(restore.renameIntent(&intents.Intent{DB: "prod", C: "users"}), ShouldBeNil)
+			So(restore.renameIntent(&intents.Intent{DB: "staging", C: "users"}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a mongorestore renaming several collections to one", t, func() {
+		renamer, err := newNSRenamer(
+			[]string{"a.users", "b.users", "c.users"},
+			[]string{"all.users", "all.users", "all.users"})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{renamer: renamer, manager: intents.NewIntentManager()}
+
+		Convey("--nsConflict=suffix should restore the later ones to numbered targets", func() {
+			renamer.conflict = nsConflictSuffix
+			for _, db := range []string{"a", "b", "c"} {
+				So(restore.renameIntent(&intents.Intent{DB: db, C: "users"}), ShouldBeNil)
+			}
+			metadata := &intents.Intent{DB: "b", C: "users", MetadataPath: "b/users.metadata.json"}
+			So(restore.renameIntent(metadata), ShouldBeNil)
+			So(metadata.Namespace(), ShouldEqual, "all.users_2")
+			So(renamer.sources["all.users"], ShouldEqual, "a.users")
+			So(renamer.sources["all.users_3"], ShouldEqual, "c.users")
+		})
+
+		Convey("--nsConflict=merge should read both BSON files into the target", func() {
+			renamer.conflict = nsConflictMerge
+			for _, db := range []string{"a", "b"} {
+				intent := &intents.Intent{DB: db, C: "users", BSONPath: db + "/users.bson", Size: 3,
+					MetadataPath: db + "/users.metadata.json"}
+				intent.BSONFile = &memoryBSONFile{data: []byte(db + db + db)}
+				So(restore.renameIntent(intent), ShouldBeNil)
+				restore.putIntent(intent)
+			}
+			merged := restore.manager.IntentForNamespace("all.users")
+			So(merged.Size, ShouldEqual, 6)
+			So(merged.MetadataPath, ShouldEqual, "a/users.metadata.json")
+			So(merged.BSONFile.Open(), ShouldBeNil)
+			data, err := ioutil.ReadAll(merged.BSONFile)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "aaabbb")
+			So(merged.BSONFile.Close(), ShouldBeNil)
+		})
+	})
+
+	Convey("--nsConflict should only accept known policies", t, func() {
+		policy, err := validateNSConflict("")
+		So(err, ShouldBeNil)
+		So(policy, ShouldEqual, nsConflictFail)
+		_, err = validateNSConflict("overwrite")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("When renaming whole databases", t, func() {
+		renamer, err := newNSRenamer(
+			[]string{"prod.*", "logs.events", "*_old.*"},
+			[]string{"staging.*", "archive.events", "*.*"})
+		So(err, ShouldBeNil)
+
+		Convey("patterns matching every collection should rename the database", func() {
+			So(renamer.RenameDB("prod"), ShouldEqual, "staging")
+			So(renamer.RenameDB("app_old"), ShouldEqual, "app")
+		})
+
+		Convey("patterns naming particular collections should not", func() {
+			So(renamer.RenameDB("logs"), ShouldEqual, "logs")
+			So(renamer.RenameDB("other"), ShouldEqual, "other")
+		})
+	})
+}
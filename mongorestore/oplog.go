@@ -8,6 +8,12 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,29 +21,71 @@ import (
 
 const oplogMaxCommandSize = 1024 * 1024 * 16.5
 
-// RestoreOplog attempts to restore a MongoDB oplog.
+// oplogSource is an oplog file replayed by RestoreOplog: the dump's
+// oplog.bson, or an archived oplog slice given with --oplogFile.
+type oplogSource struct {
+	name string
+	file io.ReadCloser
+	size int64
+
+	// first is the timestamp of the source's first entry
+	first bson.MongoTimestamp
+}
+
+// oplogReplayer applies oplog entries in batches, across oplog sources.
+type oplogReplayer struct {
+	restore  *MongoRestore
+	session  *mgo.Session
+	progress progress.Progressor
+
+	entries       []interface{}
+	bufferedBytes int
+
+	totalOps, skippedOps int64
+
+	// last is the timestamp of the last entry replayed or passed over, so
+	// entries of overlapping sources are only replayed once
+	last bson.MongoTimestamp
+
+	// lastSource is the source the last entry was read from
+	lastSource string
+
+	// reachedLimit is set once an entry at or past the limit is found
+	reachedLimit bool
+}
+
+// RestoreOplog attempts to restore a MongoDB oplog: the dump's oplog.bson,
+// followed by the archived oplog slices given with --oplogFile.
 func (restore *MongoRestore) RestoreOplog() error {
 	log.Log(log.Always, "replaying oplog")
-	intent := restore.manager.Oplog()
-	if intent == nil {
+	sources := []*oplogSource{}
+	defer func() {
+		for _, source := range sources {
+			source.file.Close()
+		}
+	}()
+	if intent := restore.manager.Oplog(); intent != nil {
+		if err := intent.BSONFile.Open(); err != nil {
+			return err
+		}
+		sources = append(sources, &oplogSource{name: intent.BSONPath, file: intent.BSONFile, size: intent.BSONSize})
+	}
+	slices, err := openOplogSlices(restore.InputOptions.OplogFiles)
+	sources = append(sources, slices...)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
 		// this should not be reached
 		log.Log(log.Always, "no oplog.bson file in root of the dump directory, skipping oplog application")
 		return nil
 	}
-	if err := intent.BSONFile.Open(); err != nil {
-		return err
-	}
-	defer intent.BSONFile.Close()
-	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(intent.BSONFile))
-	defer bsonSource.Close()
-
-	entryArray := make([]interface{}, 0, 1024)
-	rawOplogEntry := &bson.Raw{}
 
-	var totalOps int64
-	var entrySize, bufferedBytes int
-
-	oplogProgressor := progress.NewCounter(intent.BSONSize)
+	var totalSize int64
+	for _, source := range sources {
+		totalSize += source.size
+	}
+	oplogProgressor := progress.NewCounter(totalSize)
 	bar := progress.Bar{
 		Name:      "oplog",
 		Watching:  oplogProgressor,
@@ -55,27 +103,69 @@ func (restore *MongoRestore) RestoreOplog() error {
 	}
 	defer session.Close()
 
-	// To restore the oplog, we iterate over the oplog entries,
-	// filling up a buffer. Once the buffer reaches max document size,
-	// apply the current buffered ops and reset the buffer.
+	replayer := &oplogReplayer{
+		restore:  restore,
+		session:  session,
+		progress: oplogProgressor,
+		entries:  make([]interface{}, 0, 1024),
+	}
+	for _, source := range sources {
+		if replayer.reachedLimit {
+			break
+		}
+		if err = replayer.checkContinuity(source); err != nil {
+			// leave the restore consistent as of the last entry before the gap
+			if flushErr := replayer.flush(); flushErr != nil {
+				return flushErr
+			}
+			return err
+		}
+		log.Logf(log.Info, "replaying oplog entries from %v", source.name)
+		if err = replayer.replay(source); err != nil {
+			return err
+		}
+	}
+	// finally, flush the remaining entries
+	if err = replayer.flush(); err != nil {
+		return err
+	}
+
+	log.Logf(log.Info, "applied %v ops", replayer.totalOps)
+	if replayer.skippedOps > 0 {
+		log.Logf(log.Info, "skipped %v ops for namespaces excluded from the replay", replayer.skippedOps)
+	}
+	if restore.InputOptions.OplogReplayUntil != "" && !replayer.reachedLimit {
+		log.Logf(log.Always, "warning: the oplog ends at %v, before --oplogReplayUntil %v; "+
+			"the restore is only as recent as the end of the oplog",
+			formatOplogTimestamp(replayer.last), restore.InputOptions.OplogReplayUntil)
+	}
+	return nil
+}
+
+// replay applies the entries of an oplog source, until the --oplogLimit.
+// To restore the oplog, we iterate over the oplog entries,
+// filling up a buffer. Once the buffer reaches max document size,
+// apply the current buffered ops and reset the buffer.
+func (replayer *oplogReplayer) replay(source *oplogSource) error {
+	restore := replayer.restore
+	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(source.file))
+	rawOplogEntry := &bson.Raw{}
 	for bsonSource.Next(rawOplogEntry) {
-		entrySize = len(rawOplogEntry.Data)
-		if bufferedBytes+entrySize > oplogMaxCommandSize {
-			err = restore.ApplyOps(session, entryArray)
-			if err != nil {
-				return fmt.Errorf("error applying oplog: %v", err)
+		entrySize := len(rawOplogEntry.Data)
+		replayer.progress.Inc(int64(entrySize))
+		if replayer.bufferedBytes+entrySize > oplogMaxCommandSize {
+			if err := replayer.flush(); err != nil {
+				return err
 			}
-			entryArray = make([]interface{}, 0, 1024)
-			bufferedBytes = 0
 		}
 
 		entryAsOplog := db.Oplog{}
-		err = bson.Unmarshal(rawOplogEntry.Data, &entryAsOplog)
+		err := bson.Unmarshal(rawOplogEntry.Data, &entryAsOplog)
 		if err != nil {
 			return fmt.Errorf("error reading oplog: %v", err)
 		}
-		if entryAsOplog.Operation == "n" {
-			//skip no-ops
+		if entryAsOplog.Timestamp <= replayer.last {
+			// already replayed from an earlier, overlapping source
 			continue
 		}
 		if !restore.TimestampBeforeLimit(entryAsOplog.Timestamp) {
@@ -85,32 +175,191 @@ func (restore *MongoRestore) RestoreOplog() error {
 				entryAsOplog.Timestamp,
 				restore.oplogLimit,
 			)
+			replayer.reachedLimit = true
 			break
 		}
+		replayer.last = entryAsOplog.Timestamp
+		replayer.lastSource = source.name
+		if entryAsOplog.Operation == "n" {
+			//skip no-ops
+			replayer.skippedOps++
+			continue
+		}
+		if entryAsOplog.Timestamp < restore.oplogStart {
+			continue
+		}
+		entryAsOplog, ok := restore.filterOplogEntry(entryAsOplog)
+		if !ok {
+			log.Logf(log.DebugHigh, "skipping oplog entry for namespace %v", oplogEntryNamespace(entryAsOplog))
+			replayer.skippedOps++
+			continue
+		}
 
-		totalOps++
-		bufferedBytes += entrySize
-		oplogProgressor.Inc(int64(entrySize))
-		entryArray = append(entryArray, entryAsOplog)
+		replayer.totalOps++
+		replayer.bufferedBytes += entrySize
+		replayer.entries = append(replayer.entries, entryAsOplog)
 	}
-	// finally, flush the remaining entries
-	if len(entryArray) > 0 {
-		err = restore.ApplyOps(session, entryArray)
+	if err := bsonSource.Err(); err != nil {
+		return fmt.Errorf("error reading oplog %v: %v", source.name, err)
+	}
+	return nil
+}
+
+// checkContinuity returns an error if the source's first entry is after the
+// last entry read from the sources before it: sources of an oplog chain must
+// overlap by at least one entry to show that no entries are missing between
+// them. With --oplogAllowGaps, a gap is only warned about.
+func (replayer *oplogReplayer) checkContinuity(source *oplogSource) error {
+	if replayer.lastSource == "" || source.first == 0 || source.first <= replayer.last {
+		return nil
+	}
+	gap := fmt.Sprintf("gap in the oplog: %v starts at %v, after %v ends at %v, so entries between them may be missing",
+		source.name, formatOplogTimestamp(source.first), replayer.lastSource, formatOplogTimestamp(replayer.last))
+	if replayer.restore.InputOptions.OplogAllowGaps {
+		log.Logf(log.Always, "warning: %v", gap)
+		return nil
+	}
+	return fmt.Errorf("%v; the oplog was replayed up to %v. Oplog files must overlap by at least one entry "+
+		"to be replayed in sequence; use --oplogAllowGaps to replay past the gap",
+		gap, formatOplogTimestamp(replayer.last))
+}
+
+// flush applies the buffered entries.
+func (replayer *oplogReplayer) flush() error {
+	if len(replayer.entries) == 0 {
+		return nil
+	}
+	if err := replayer.restore.ApplyOps(replayer.session, replayer.entries); err != nil {
+		return fmt.Errorf("error applying oplog: %v", err)
+	}
+	replayer.entries = make([]interface{}, 0, 1024)
+	replayer.bufferedBytes = 0
+	return nil
+}
+
+// openOplogSlices opens the --oplogFile archived oplog slices, ordered by
+// the timestamp of their first entry. The sources opened are returned even
+// on error, to be closed.
+func openOplogSlices(paths []string) ([]*oplogSource, error) {
+	sources := []*oplogSource{}
+	paths, err := expandOplogPaths(paths)
+	if err != nil {
+		return sources, err
+	}
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return sources, fmt.Errorf("error reading --oplogFile: %v", err)
+		}
+		first, err := firstOplogTimestamp(path)
+		if err != nil {
+			return sources, err
+		}
+		file, err := openDumpFile(path)
 		if err != nil {
-			return fmt.Errorf("error applying oplog: %v", err)
+			return sources, fmt.Errorf("error reading --oplogFile %v: %v", path, err)
 		}
+		sources = append(sources, &oplogSource{name: path, file: file, size: stat.Size(), first: first})
 	}
+	sort.Stable(byFirstTimestamp(sources))
+	return sources, nil
+}
 
-	log.Logf(log.Info, "applied %v ops", totalOps)
-	return nil
+// expandOplogPaths replaces the directories among the --oplogFile paths
+// with the .bson and .bson.gz files they hold.
+func expandOplogPaths(paths []string) ([]string, error) {
+	expanded := []string{}
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading --oplogFile: %v", err)
+		}
+		if !stat.IsDir() {
+			expanded = append(expanded, path)
+			continue
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading --oplogFile %v: %v", path, err)
+		}
+		found := false
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !(strings.HasSuffix(name, ".bson") || strings.HasSuffix(name, ".bson"+gzipSuffix)) {
+				continue
+			}
+			expanded = append(expanded, filepath.Join(path, name))
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("--oplogFile directory %v holds no .bson or .bson.gz files", path)
+		}
+	}
+	return expanded, nil
+}
 
+// firstOplogTimestamp returns the timestamp of the first entry of an oplog
+// file, or 0 if it is empty.
+func firstOplogTimestamp(path string) (bson.MongoTimestamp, error) {
+	file, err := openDumpFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading --oplogFile %v: %v", path, err)
+	}
+	bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(file))
+	defer bsonSource.Close()
+	entry := db.Oplog{}
+	if !bsonSource.Next(&entry) {
+		if err = bsonSource.Err(); err != nil {
+			return 0, fmt.Errorf("error reading --oplogFile %v: %v", path, err)
+		}
+		return 0, nil
+	}
+	return entry.Timestamp, nil
+}
+
+// byFirstTimestamp sorts oplog sources by the timestamp of their first entry.
+type byFirstTimestamp []*oplogSource
+
+func (s byFirstTimestamp) Len() int           { return len(s) }
+func (s byFirstTimestamp) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byFirstTimestamp) Less(i, j int) bool { return s[i].first < s[j].first }
+
+// ParseOplogReplayUntil parses the --oplogReplayUntil argument, either a
+// date and time such as 2024-05-01T14:32:00Z, or a timestamp
+// (seconds[:ordinal]), and returns the limit to replay the oplog up to,
+// excluding it, so that every entry at or before the argument is replayed.
+// Oplog timestamps count seconds, so a date and time includes the entries
+// of its whole second.
+func ParseOplogReplayUntil(until string) (bson.MongoTimestamp, error) {
+	if date, err := time.Parse(time.RFC3339, until); err == nil {
+		if date.Unix() < 0 {
+			return 0, fmt.Errorf("%v is before 1970", until)
+		}
+		return bson.MongoTimestamp((date.Unix() + 1) << 32), nil
+	}
+	ts, err := ParseTimestampFlag(until)
+	if err != nil {
+		return 0, fmt.Errorf("expected a date and time such as 2024-05-01T14:32:00Z, or seconds[:ordinal]: %v", err)
+	}
+	return ts + 1, nil
+}
+
+// formatOplogTimestamp formats a timestamp as its UTC date and time,
+// followed by its ordinal.
+func formatOplogTimestamp(ts bson.MongoTimestamp) string {
+	seconds, ordinal := int64(ts>>32), uint32(ts)
+	return fmt.Sprintf("%v (%v:%v)", time.Unix(seconds, 0).UTC().Format(time.RFC3339), seconds, ordinal)
 }
 
 // ApplyOps is a wrapper for the applyOps database command, we pass in
 // a session to avoid opening a new connection for a few inserts at a time.
+// The ops are applied with the --writeConcern.
 func (restore *MongoRestore) ApplyOps(session *mgo.Session, entries []interface{}) error {
 	res := bson.M{}
-	err := session.Run(bson.D{{"applyOps", entries}}, &res)
+	err := session.Run(bson.D{
+		{"applyOps", entries},
+		{"writeConcern", db.WriteConcernDocument(restore.safety)},
+	}, &res)
 	if err != nil {
 		return fmt.Errorf("applyOps: %v", err)
 	}
@@ -131,6 +380,225 @@ func (restore *MongoRestore) TimestampBeforeLimit(ts bson.MongoTimestamp) bool {
 	return ts < restore.oplogLimit
 }
 
+// ParseOplogLimit parses the --oplogLimit argument, which is either the
+// timestamp to stop replaying at, or a range of timestamps
+// <start>-<end> to replay, including the start and excluding the end.
+// Either side of the range can be left out. A zero timestamp means no limit.
+func ParseOplogLimit(limit string) (start, end bson.MongoTimestamp, err error) {
+	dash := strings.Index(limit, "-")
+	if dash == -1 {
+		end, err = ParseTimestampFlag(limit)
+		return 0, end, err
+	}
+	if limit[:dash] != "" {
+		if start, err = ParseTimestampFlag(limit[:dash]); err != nil {
+			return 0, 0, fmt.Errorf("start of range: %v", err)
+		}
+	}
+	if limit[dash+1:] != "" {
+		if end, err = ParseTimestampFlag(limit[dash+1:]); err != nil {
+			return 0, 0, fmt.Errorf("end of range: %v", err)
+		}
+	}
+	if end != 0 && start >= end {
+		return 0, 0, fmt.Errorf("start of range must be before its end")
+	}
+	return start, end, nil
+}
+
+// oplogNSFilter decides which namespaces' oplog entries are replayed,
+// following the --oplogNsInclude and --oplogNsExclude patterns.
+type oplogNSFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newOplogNSFilter compiles the include and exclude patterns, returning nil
+// if there are none.
+func newOplogNSFilter(include, exclude []string) (*oplogNSFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	filter := &oplogNSFilter{}
+	for _, pattern := range include {
+		compiled, err := compileNSPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --oplogNsInclude '%v': %v", pattern, err)
+		}
+		filter.include = append(filter.include, compiled)
+	}
+	for _, pattern := range exclude {
+		compiled, err := compileNSPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --oplogNsExclude '%v': %v", pattern, err)
+		}
+		filter.exclude = append(filter.exclude, compiled)
+	}
+	return filter, nil
+}
+
+// Allows returns true if oplog entries for the namespace should be
+// replayed: it must match an include pattern, if there are any, and must
+// not match an exclude pattern. A nil filter allows every namespace.
+func (filter *oplogNSFilter) Allows(namespace string) bool {
+	if filter == nil {
+		return true
+	}
+	included := len(filter.include) == 0
+	for _, pattern := range filter.include {
+		if pattern.MatchString(namespace) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range filter.exclude {
+		if pattern.MatchString(namespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterOplogEntry returns the entry to replay, renamed by --nsFrom and
+// --nsTo, and false if it is to be skipped, as the oplog filter doesn't
+// allow its namespace or no --nsInclude pattern matches it. An applyOps entry,
+// such as one of a transaction, only keeps the operations the filter allows,
+// and is skipped if none is left.
+func (restore *MongoRestore) filterOplogEntry(entry db.Oplog) (db.Oplog, bool) {
+	ops, ok := entry.Object["applyOps"].([]interface{})
+	if entry.Operation != "c" || !ok {
+		namespace := oplogEntryNamespace(entry)
+		if !restore.oplogNSFilter.Allows(namespace) || !restore.nsIncluded(namespace) {
+			return entry, false
+		}
+		return restore.renameOplogEntry(entry), true
+	}
+	kept := make([]interface{}, 0, len(ops))
+	for _, op := range ops {
+		fields, ok := op.(bson.M)
+		if !ok {
+			kept = append(kept, op)
+			continue
+		}
+		nested := db.Oplog{}
+		nested.Operation, _ = fields["op"].(string)
+		nested.Namespace, _ = fields["ns"].(string)
+		nested.Object, _ = fields["o"].(bson.M)
+		if nested, ok = restore.filterOplogEntry(nested); !ok {
+			continue
+		}
+		filtered := bson.M{}
+		for key, value := range fields {
+			filtered[key] = value
+		}
+		filtered["ns"] = nested.Namespace
+		if nested.Object != nil {
+			filtered["o"] = nested.Object
+		}
+		kept = append(kept, filtered)
+	}
+	if len(kept) == 0 {
+		return entry, false
+	}
+	object := bson.M{}
+	for key, value := range entry.Object {
+		object[key] = value
+	}
+	object["applyOps"] = kept
+	entry.Object = object
+	return entry, true
+}
+
+// collectionCommands are the commands logged in the oplog that name the
+// collection of their database they act on.
+var collectionCommands = []string{"create", "drop", "collMod", "emptycapped", "convertToCapped"}
+
+// renameOplogEntry points the entry at the namespaces --nsFrom and --nsTo
+// restore its own to, as the collections are: the namespace of an
+// operation, the collection a command acts on and the database it runs
+// on, the source and target of renameCollection, and the indexed
+// namespace of an index build.
+func (restore *MongoRestore) renameOplogEntry(entry db.Oplog) db.Oplog {
+	renamer := restore.renamer
+	if renamer == nil {
+		return entry
+	}
+	dbName, collName := splitNamespace(entry.Namespace)
+	object := bson.M{}
+	for key, value := range entry.Object {
+		object[key] = value
+	}
+	switch {
+	case entry.Operation == "c" && collName == "$cmd":
+		for _, command := range collectionCommands {
+			if target, ok := entry.Object[command].(string); ok {
+				renamedDB, renamedColl := splitNamespace(renamer.target(dbName + "." + target))
+				entry.Namespace = renamedDB + ".$cmd"
+				object[command] = renamedColl
+				entry.Object = object
+				return entry
+			}
+		}
+		if source, ok := entry.Object["renameCollection"].(string); ok {
+			object["renameCollection"] = renamer.target(source)
+			if to, ok := entry.Object["to"].(string); ok {
+				object["to"] = renamer.target(to)
+			}
+			entry.Object = object
+			return entry
+		}
+		// other commands, such as dropDatabase, act on the whole database
+		entry.Namespace = renamer.RenameDB(dbName) + ".$cmd"
+		return entry
+	case entry.Operation == "i" && collName == "system.indexes":
+		if indexed, ok := entry.Object["ns"].(string); ok {
+			renamed := renamer.target(indexed)
+			renamedDB, _ := splitNamespace(renamed)
+			entry.Namespace = renamedDB + ".system.indexes"
+			object["ns"] = renamed
+			entry.Object = object
+		}
+		return entry
+	}
+	entry.Namespace = renamer.target(entry.Namespace)
+	return entry
+}
+
+// splitNamespace splits a namespace into its database and collection.
+func splitNamespace(namespace string) (string, string) {
+	if i := strings.Index(namespace, "."); i != -1 {
+		return namespace[:i], namespace[i+1:]
+	}
+	return namespace, ""
+}
+
+// oplogEntryNamespace returns the namespace an oplog entry affects. For
+// commands, which are logged against <db>.$cmd, this is the collection the
+// command acts on, and for index builds the indexed collection.
+func oplogEntryNamespace(entry db.Oplog) string {
+	dbName, collName := splitNamespace(entry.Namespace)
+	switch {
+	case entry.Operation == "c" && collName == "$cmd":
+		for _, command := range collectionCommands {
+			if target, ok := entry.Object[command].(string); ok {
+				return dbName + "." + target
+			}
+		}
+		// renameCollection names the full source namespace
+		if source, ok := entry.Object["renameCollection"].(string); ok {
+			return source
+		}
+	case entry.Operation == "i" && collName == "system.indexes":
+		if indexed, ok := entry.Object["ns"].(string); ok {
+			return indexed
+		}
+	}
+	return entry.Namespace
+}
+
 // ParseTimestampFlag takes in a string the form of <time_t>:<ordinal>,
 // where <time_t> is the seconds since the UNIX epoch, and <ordinal> represents
 // a counter of operations in the oplog that occurred in the specified second.
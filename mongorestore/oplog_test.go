@@ -1,10 +1,16 @@
 package mongorestore
 
 import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestTimestampStringParsing(t *testing.T) {
@@ -113,3 +119,295 @@ func TestValidOplogLimitChecking(t *testing.T) {
 	})
 
 }
+
+func TestOplogLimitRanges(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --oplogLimit", t, func() {
+
+		Convey("a single timestamp should only set the end", func() {
+			start, end, err := ParseOplogLimit("5:1")
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, 0)
+			So(end, ShouldEqual, bson.MongoTimestamp(int64(5)<<32|1))
+		})
+
+		Convey("a range should set both ends", func() {
+			start, end, err := ParseOplogLimit("5:1-10")
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, bson.MongoTimestamp(int64(5)<<32|1))
+			So(end, ShouldEqual, bson.MongoTimestamp(int64(10)<<32))
+		})
+
+		Convey("a range may leave out its end", func() {
+			start, end, err := ParseOplogLimit("5-")
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, bson.MongoTimestamp(int64(5)<<32))
+			So(end, ShouldEqual, 0)
+		})
+
+		Convey("backwards or malformed ranges should be rejected", func() {
+			_, _, err := ParseOplogLimit("10-5")
+			So(err, ShouldNotBeNil)
+			_, _, err = ParseOplogLimit("5-5")
+			So(err, ShouldNotBeNil)
+			_, _, err = ParseOplogLimit("a-5")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestOplogNSFilter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --oplogNsInclude and --oplogNsExclude patterns", t, func() {
+		filter, err := newOplogNSFilter([]string{"app.*", "logs.errors"}, []string{"app.cache*"})
+		So(err, ShouldBeNil)
+
+		Convey("only included namespaces that are not excluded should be replayed", func() {
+			So(filter.Allows("app.users"), ShouldBeTrue)
+			So(filter.Allows("logs.errors"), ShouldBeTrue)
+			So(filter.Allows("logs.access"), ShouldBeFalse)
+			So(filter.Allows("app.cache_sessions"), ShouldBeFalse)
+			So(filter.Allows("application.users"), ShouldBeFalse)
+		})
+
+		Convey("commands should be matched against the collection they act on", func() {
+			create := db.Oplog{Operation: "c", Namespace: "app.$cmd", Object: bson.M{"create": "cache_pages"}}
+			So(oplogEntryNamespace(create), ShouldEqual, "app.cache_pages")
+			So(filter.Allows(oplogEntryNamespace(create)), ShouldBeFalse)
+
+			rename := db.Oplog{Operation: "c", Namespace: "admin.$cmd",
+				Object: bson.M{"renameCollection": "logs.errors", "to": "logs.errors_old"}}
+			So(oplogEntryNamespace(rename), ShouldEqual, "logs.errors")
+
+			index := db.Oplog{Operation: "i", Namespace: "app.system.indexes", Object: bson.M{"ns": "app.users"}}
+			So(oplogEntryNamespace(index), ShouldEqual, "app.users")
+		})
+
+		Convey("the operations of an applyOps entry should be filtered one by one", func() {
+			restore := &MongoRestore{oplogNSFilter: filter}
+			applyOps := db.Oplog{Operation: "c", Namespace: "admin.$cmd", Object: bson.M{"applyOps": []interface{}{
+				bson.M{"op": "i", "ns": "app.users", "o": bson.M{"_id": 1}},
+				bson.M{"op": "u", "ns": "logs.access", "o": bson.M{"$set": bson.M{"a": 1}}, "o2": bson.M{"_id": 2}},
+				bson.M{"op": "c", "ns": "app.$cmd", "o": bson.M{"applyOps": []interface{}{
+					bson.M{"op": "d", "ns": "app.cache_pages", "o": bson.M{"_id": 3}},
+				}}},
+			}}}
+			filtered, ok := restore.filterOplogEntry(applyOps)
+			So(ok, ShouldBeTrue)
+			So(filtered.Object["applyOps"], ShouldResemble, []interface{}{
+				bson.M{"op": "i", "ns": "app.users", "o": bson.M{"_id": 1}},
+			})
+			So(len(applyOps.Object["applyOps"].([]interface{})), ShouldEqual, 3)
+
+			Convey("and the entry skipped if none is left", func() {
+				applyOps.Object["applyOps"] = []interface{}{
+					bson.M{"op": "i", "ns": "logs.access", "o": bson.M{"_id": 1}},
+				}
+				_, ok := restore.filterOplogEntry(applyOps)
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("With --nsInclude, only the oplog entries of included namespaces should be replayed", t, func() {
+		include, err := compileNSIncludes([]string{"app.users"})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{nsInclude: include}
+		_, ok := restore.filterOplogEntry(db.Oplog{Operation: "i", Namespace: "app.users", Object: bson.M{"_id": 1}})
+		So(ok, ShouldBeTrue)
+		_, ok = restore.filterOplogEntry(db.Oplog{Operation: "i", Namespace: "app.orders", Object: bson.M{"_id": 1}})
+		So(ok, ShouldBeFalse)
+		_, ok = restore.filterOplogEntry(db.Oplog{Operation: "c", Namespace: "app.$cmd", Object: bson.M{"drop": "orders"}})
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Without patterns every namespace should be replayed", t, func() {
+		filter, err := newOplogNSFilter(nil, nil)
+		So(err, ShouldBeNil)
+		So(filter.Allows("anything.at.all"), ShouldBeTrue)
+	})
+}
+
+func TestRenameOplogEntries(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --nsFrom and --nsTo patterns", t, func() {
+		renamer, err := newNSRenamer([]string{"prod.*", "logs.errors"}, []string{"staging.*", "archive.errors"})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{renamer: renamer}
+
+		Convey("operations should be replayed on the renamed namespace", func() {
+			entry, ok := restore.filterOplogEntry(db.Oplog{Operation: "i", Namespace: "prod.users", Object: bson.M{"_id": 1}})
+			So(ok, ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "staging.users")
+			entry, _ = restore.filterOplogEntry(db.Oplog{Operation: "i", Namespace: "other.users", Object: bson.M{"_id": 1}})
+			So(entry.Namespace, ShouldEqual, "other.users")
+		})
+
+		Convey("commands should act on the renamed collection, in its database", func() {
+			drop := db.Oplog{Operation: "c", Namespace: "logs.$cmd", Object: bson.M{"drop": "errors"}}
+			entry, _ := restore.filterOplogEntry(drop)
+			So(entry.Namespace, ShouldEqual, "archive.$cmd")
+			So(entry.Object, ShouldResemble, bson.M{"drop": "errors"})
+			So(drop.Object["drop"], ShouldEqual, "errors")
+
+			rename := db.Oplog{Operation: "c", Namespace: "admin.$cmd",
+				Object: bson.M{"renameCollection": "prod.a", "to": "prod.b"}}
+			entry, _ = restore.filterOplogEntry(rename)
+			So(entry.Namespace, ShouldEqual, "admin.$cmd")
+			So(entry.Object, ShouldResemble, bson.M{"renameCollection": "staging.a", "to": "staging.b"})
+
+			dropDatabase := db.Oplog{Operation: "c", Namespace: "prod.$cmd", Object: bson.M{"dropDatabase": 1}}
+			entry, _ = restore.filterOplogEntry(dropDatabase)
+			So(entry.Namespace, ShouldEqual, "staging.$cmd")
+		})
+
+		Convey("index builds should be on the renamed collection", func() {
+			index := db.Oplog{Operation: "i", Namespace: "prod.system.indexes", Object: bson.M{"ns": "prod.users"}}
+			entry, _ := restore.filterOplogEntry(index)
+			So(entry.Namespace, ShouldEqual, "staging.system.indexes")
+			So(entry.Object["ns"], ShouldEqual, "staging.users")
+		})
+
+		Convey("the operations of applyOps entries should be renamed", func() {
+			applyOps := db.Oplog{Operation: "c", Namespace: "admin.$cmd", Object: bson.M{"applyOps": []interface{}{
+				bson.M{"op": "i", "ns": "prod.users", "o": bson.M{"_id": 1}},
+			}}}
+			entry, _ := restore.filterOplogEntry(applyOps)
+			So(entry.Namespace, ShouldEqual, "admin.$cmd")
+			So(entry.Object["applyOps"], ShouldResemble, []interface{}{
+				bson.M{"op": "i", "ns": "staging.users", "o": bson.M{"_id": 1}},
+			})
+		})
+
+		Convey("collections renamed with a --nsConflict suffix should keep it", func() {
+			renamer.conflict = nsConflictSuffix
+			_, err := renamer.resolve("prod.users")
+			So(err, ShouldBeNil)
+			renamer.sources["staging.orders"] = "other.orders"
+			target, err := renamer.resolve("prod.orders")
+			So(err, ShouldBeNil)
+			So(target, ShouldEqual, "staging.orders_2")
+			entry, _ := restore.filterOplogEntry(db.Oplog{Operation: "d", Namespace: "prod.orders", Object: bson.M{"_id": 1}})
+			So(entry.Namespace, ShouldEqual, "staging.orders_2")
+		})
+	})
+}
+
+func TestOplogReplayUntil(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --oplogReplayUntil", t, func() {
+		Convey("a date and time should include every entry of its second", func() {
+			limit, err := ParseOplogReplayUntil("2024-05-01T14:32:00Z")
+			So(err, ShouldBeNil)
+			seconds := time.Date(2024, 5, 1, 14, 32, 0, 0, time.UTC).Unix()
+			So(limit, ShouldEqual, bson.MongoTimestamp((seconds+1)<<32))
+
+			restore := &MongoRestore{oplogLimit: limit}
+			So(restore.TimestampBeforeLimit(bson.MongoTimestamp(seconds<<32|7)), ShouldBeTrue)
+			So(restore.TimestampBeforeLimit(bson.MongoTimestamp((seconds+1)<<32)), ShouldBeFalse)
+		})
+
+		Convey("a date and time in another zone should be converted", func() {
+			limit, err := ParseOplogReplayUntil("2024-05-01T16:32:00+02:00")
+			So(err, ShouldBeNil)
+			utc, err := ParseOplogReplayUntil("2024-05-01T14:32:00Z")
+			So(err, ShouldBeNil)
+			So(limit, ShouldEqual, utc)
+		})
+
+		Convey("a timestamp should be included", func() {
+			limit, err := ParseOplogReplayUntil("100:3")
+			So(err, ShouldBeNil)
+			restore := &MongoRestore{oplogLimit: limit}
+			So(restore.TimestampBeforeLimit(bson.MongoTimestamp(100<<32|3)), ShouldBeTrue)
+			So(restore.TimestampBeforeLimit(bson.MongoTimestamp(100<<32|4)), ShouldBeFalse)
+		})
+
+		Convey("malformed arguments should be rejected", func() {
+			for _, until := range []string{"", "yesterday", "2024-05-01", "1:2:3"} {
+				_, err := ParseOplogReplayUntil(until)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("With archived oplog slices", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_oplog")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+
+		writeSlice := func(name string, timestamps ...int64) string {
+			out := &bytes.Buffer{}
+			for _, ts := range timestamps {
+				data, err := bson.Marshal(bson.D{{"ts", bson.MongoTimestamp(ts)}, {"op", "n"}, {"ns", ""}})
+				So(err, ShouldBeNil)
+				out.Write(data)
+			}
+			path := filepath.Join(dir, name)
+			So(ioutil.WriteFile(path, out.Bytes(), 0644), ShouldBeNil)
+			return path
+		}
+		later := writeSlice("later.bson", 20<<32, 21<<32)
+		earlier := writeSlice("earlier.bson", 10<<32, 11<<32)
+		empty := writeSlice("empty.bson")
+
+		Convey("they should be ordered by their first entries", func() {
+			sources, err := openOplogSlices([]string{later, empty, earlier})
+			Reset(func() {
+				for _, source := range sources {
+					source.file.Close()
+				}
+			})
+			So(err, ShouldBeNil)
+			So(len(sources), ShouldEqual, 3)
+			So(sources[0].name, ShouldEqual, empty)
+			So(sources[1].name, ShouldEqual, earlier)
+			So(sources[1].first, ShouldEqual, bson.MongoTimestamp(10<<32))
+			So(sources[2].name, ShouldEqual, later)
+		})
+
+		Convey("a missing slice should be an error", func() {
+			sources, err := openOplogSlices([]string{earlier, filepath.Join(dir, "missing.bson")})
+			for _, source := range sources {
+				source.file.Close()
+			}
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a directory should stand for the slices it holds", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0644), ShouldBeNil)
+			paths, err := expandOplogPaths([]string{dir})
+			So(err, ShouldBeNil)
+			So(paths, ShouldResemble, []string{earlier, empty, later})
+
+			_, err = expandOplogPaths([]string{filepath.Join(dir, "missing")})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a slice starting after the last entry replayed should be a gap", func() {
+			replayer := &oplogReplayer{
+				restore:    &MongoRestore{InputOptions: &InputOptions{}},
+				last:       bson.MongoTimestamp(11 << 32),
+				lastSource: earlier,
+			}
+			So(replayer.checkContinuity(&oplogSource{name: later, first: 11 << 32}), ShouldBeNil)
+			So(replayer.checkContinuity(&oplogSource{name: later, first: 10 << 32}), ShouldBeNil)
+			So(replayer.checkContinuity(&oplogSource{name: later, first: 20 << 32}), ShouldNotBeNil)
+
+			replayer.restore.InputOptions.OplogAllowGaps = true
+			So(replayer.checkContinuity(&oplogSource{name: later, first: 20 << 32}), ShouldBeNil)
+		})
+	})
+
+	Convey("Oplog timestamps should be formatted as UTC dates", t, func() {
+		So(formatOplogTimestamp(bson.MongoTimestamp(1714573920<<32|2)), ShouldEqual, "2024-05-01T14:32:00Z (1714573920:2)")
+	})
+}
@@ -12,13 +12,21 @@ See http://docs.mongodb.org/manual/reference/program/mongorestore/ for more info
 
 // InputOptions defines the set of options to use in configuring the restore process.
 type InputOptions struct {
-	Objcheck               bool   `long:"objcheck" description:"validate all objects before inserting"`
-	OplogReplay            bool   `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
-	OplogLimit             string `long:"oplogLimit" description:"only include oplog entries before the provided Timestamp (seconds[:ordinal])"`
-	Archive                string `long:"archive" optional:"true" optional-value:"-" description:"restore from a dump-archive stream or file"`
-	RestoreDBUsersAndRoles bool   `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
-	Directory              string `long:"dir" description:"input directory, use '-' for stdin"`
-	Gzip                   bool   `long:"gzip" description:"decompress gzipped input"`
+	Objcheck               bool     `long:"objcheck" description:"validate all objects before inserting"`
+	OplogReplay            bool     `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
+	OplogLimit             string   `long:"oplogLimit" description:"only include oplog entries before the provided Timestamp (seconds[:ordinal]), or within a range of them (seconds[:ordinal]-seconds[:ordinal]) that includes its start"`
+	OplogReplayUntil       string   `long:"oplogReplayUntil" value-name:"<time>" description:"replay the oplog up to and including the provided date and time (e.g. 2024-05-01T14:32:00Z) or Timestamp (seconds[:ordinal]), to restore to that point in time"`
+	OplogFiles             []string `long:"oplogFile" value-name:"<filename>" description:"an archived oplog slice (.bson or .bson.gz), or a directory of them, to replay after the dump's oplog, in order of their first entries; entries already replayed are skipped, and each slice must overlap the ones before it by at least one entry, or the replay stops at the gap; may be repeated"`
+	OplogAllowGaps         bool     `long:"oplogAllowGaps" description:"with --oplogFile, replay past gaps between oplog slices, warning about them, instead of stopping at the first one"`
+	OplogNsInclude         []string `long:"oplogNsInclude" value-name:"<pattern>" description:"only replay oplog entries for namespaces matching this pattern, e.g. 'db.*'; '*' matches any characters; the operations of applyOps entries, such as those of transactions, are filtered one by one; may be repeated"`
+	OplogNsExclude         []string `long:"oplogNsExclude" value-name:"<pattern>" description:"don't replay oplog entries for namespaces matching this pattern; may be repeated"`
+	Archive                string   `long:"archive" optional:"true" optional-value:"-" description:"restore from a dump-archive stream or file; with no value or '-', the archive is streamed from standard input, e.g. mongodump --archive | ssh host mongorestore --archive, without seeking; an archive split into volumes with mongodump --maxFileSize or --archivePartSize is read from all its volumes, given the archive path"`
+	ArchiveBufferSize      string   `long:"archiveBufferSize" value-name:"<size>" description:"with --archive, the most data to buffer for each collection being restored, e.g. 64MB, letting the archive be read ahead of collections whose inserts are behind; once a collection's buffer is full, reading waits for its inserts to catch up (defaults to 16MB)"`
+	List                   bool     `long:"list" description:"with --archive, print the namespaces in the archive, with the number of documents and bytes of each, instead of restoring it; with --nsInclude, only the matching namespaces are listed"`
+	RestoreDBUsersAndRoles bool     `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
+	Directory              string   `long:"dir" description:"input directory, use '-' for stdin"`
+	FilterFiles            string   `long:"filterFiles" value-name:"<regex>" description:"when restoring a dump directory, only consider the .bson files whose path matches this regular expression, e.g. 'shard1/', to restore one shard's files out of a backup directory holding several; a collection's metadata file is only restored if its .bson file matches"`
+	Gzip                   bool     `long:"gzip" description:"decompress gzipped input; gzipped archives and .bson.gz and .metadata.json.gz files in a dump directory are also recognized without it"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -28,15 +36,53 @@ func (*InputOptions) Name() string {
 
 // OutputOptions defines the set of options for restoring dump data.
 type OutputOptions struct {
-	Drop                   bool   `long:"drop" description:"drop each collection before import"`
-	WriteConcern           string `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
-	NoIndexRestore         bool   `long:"noIndexRestore" description:"don't restore indexes"`
-	NoOptionsRestore       bool   `long:"noOptionsRestore" description:"don't restore collection options"`
-	KeepIndexVersion       bool   `long:"keepIndexVersion" description:"don't update index version"`
-	MaintainInsertionOrder bool   `long:"maintainInsertionOrder" description:"preserve order of documents during restoration"`
-	NumParallelCollections int    `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel (4 by default)" default:"4" default-mask:"-"`
-	NumInsertionWorkers    int    `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection (1 by default)" default:"1" default-mask:"-"`
-	StopOnError            bool   `long:"stopOnError" description:"stop restoring if an error is encountered on insert (off by default)"`
+	Drop                   bool     `long:"drop" description:"drop each collection before import"`
+	WriteConcern           string   `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: \"majority\", wtimeout: 5000}', --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'; applies to every insert, the oplog replay and the users and roles merge (defaults to 'majority')"`
+	NoIndexRestore         bool     `long:"noIndexRestore" description:"don't restore indexes"`
+	IndexesOnly            bool     `long:"indexesOnly" description:"only create the indexes in the dump's metadata, without restoring documents, collection options, users or roles; for rebuilding indexes on collections whose data is already present"`
+	DeferIndexes           bool     `long:"deferIndexes" description:"build indexes only after the documents of every collection have been restored, rather than after each collection's documents"`
+	BackgroundIndexes      bool     `long:"backgroundIndexes" description:"build indexes with background:true so the builds don't block other operations on their databases; MongoDB 4.2 and later ignore this"`
+	CommitQuorum           string   `long:"commitQuorum" value-name:"<quorum>" description:"number of voting replica set members, 'majority' or 'votingMembers', that must be ready to commit each index build; requires MongoDB 4.4 or later"`
+	HoldTTLExpiry          bool     `long:"holdTTLExpiry" description:"create the TTL indexes of the collections the restore creates with expireAfterSeconds set to about 68 years, so the server doesn't expire restored documents, such as historical ones, while the restore runs, and set each back to its dumped value once the restore, including any oplog replay, is done"`
+	NoOptionsRestore       bool     `long:"noOptionsRestore" description:"don't restore collection options"`
+	OptionsOverride        []string `long:"collectionOptionsOverride" value-name:"[<pattern>=]<json>" description:"override the dumped options of the collections created, including those dumped without a .metadata.json file, with a JSON document of options, e.g. '{collation: {locale: \"fr\"}, validator: null}', optionally preceded by a namespace pattern and '=', e.g. 'logs.*={capped: true, size: 1048576}'; a null value removes the option; may be repeated, and overrides are applied in order"`
+	KeepIndexVersion       bool     `long:"keepIndexVersion" description:"don't update index version"`
+	NoPreflightChecks      bool     `long:"noPreflightChecks" description:"don't check, before writing anything, that the target server supports the features the dump uses, such as collations, views, validators, index versions and decimal128 values"`
+	Mode                   string   `long:"mode" value-name:"<mode>" description:"how to write documents that may already be in the collection: insert (the default) fails on duplicate keys, upsert replaces the matching document or inserts a new one, replace only replaces documents already present, and merge sets the document's fields on the matching document or inserts a new one; documents are matched on --upsertFields" default:"insert" default-mask:"-"`
+	UpsertFields           string   `long:"upsertFields" value-name:"<field>[,<field>]*" description:"comma-separated fields to match documents on with --mode upsert, replace or merge (defaults to '_id')"`
+	Staged                 bool     `long:"staged" description:"restore each collection into a staging collection of its database, and only once every collection's documents and indexes are restored, rename each staging collection over its target, replacing it; a failed restore drops the staging collections and leaves the targets untouched; system and time-series collections are restored in place"`
+	MaintainInsertionOrder bool     `long:"maintainInsertionOrder" description:"preserve order of documents during restoration, inserting the documents of each collection with a single insertion worker making ordered bulk inserts; without --stopOnError, a document failing to insert, e.g. on a duplicate key, doesn't keep the ones after it from being inserted; capped collections are always restored in order"`
+	InsertionOrder         []string `long:"insertionOrder" value-name:"<pattern>=ordered|unordered" description:"insert the documents of the namespaces matching this pattern, e.g. 'app.events_*=ordered', in order, as with --maintainInsertionOrder, or unordered, with --numInsertionWorkersPerCollection workers making unordered bulk inserts, overriding --maintainInsertionOrder and the order of capped collections; may be repeated, and the first matching pattern applies"`
+	NumParallelCollections int      `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel (4 by default)" default:"4" default-mask:"-"`
+	BatchSize              int      `long:"batchSize" value-name:"<count>" description:"most documents to send in each bulk insert; each is also split to fit in the server's largest message, so batches of large documents hold fewer (defaults to 10000)"`
+	NumInsertionWorkers    int      `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection, each batching documents into unordered bulk inserts (1 by default)" default:"1" default-mask:"-"`
+	RateLimit              string   `long:"ratelimit" value-name:"<rate>" description:"limit inserts, across all collections and insertion workers, to this many documents per second, or to this many bytes per second with a size such as 20MB, so a restore into a live cluster doesn't starve other traffic"`
+	MaxWriteAttempts       int      `long:"maxWriteAttempts" value-name:"<count>" default:"5" default-mask:"-" description:"make up to this many attempts in all at a write failing with a transient error, such as a primary stepping down, a dropped connection or a write conflict, before giving up on it; 1 disables retries (defaults to 5)"`
+	RetryBackoff           string   `long:"retryBackoff" value-name:"<duration>" default:"500ms" default-mask:"-" description:"wait this long, e.g. 500ms or 2s, before retrying a failed write, doubling the wait for each further attempt up to 30s (defaults to 500ms)"`
+	Sharded                bool     `long:"sharded" description:"when restoring through mongos, recreate the sharding of the dump's collections from its config database, or from --shardingConfig: shard each collection by its shard key, split it into the dump's chunks, move each chunk to the shard it was on, or one in its place, and restore zones, before inserting its documents, so each is written to its final shard"`
+	ShardingConfig         string   `long:"shardingConfig" value-name:"<directory>" description:"with --sharded, read the sharding metadata from this dump of the config database, e.g. when restoring per-shard dumps"`
+	MongosHosts            string   `long:"mongosHosts" value-name:"<host>[,<host>]*" description:"when restoring through mongos, spread the insertion workers across these mongos hosts in turn, rather than sending every insert through --host"`
+	StopOnError            bool     `long:"stopOnError" description:"stop restoring if an error is encountered on insert (off by default)"`
+	RejectFile             string   `long:"rejectFile" value-name:"<filename>" description:"write the documents that can't be restored, such as invalid or oversized documents, or documents the server fails to insert or write, e.g. on a duplicate key or a validation error, to this BSON file with the reason for each, and go on with the restore; can not be used with --stopOnError"`
+	NSInclude              []string `long:"nsInclude" value-name:"<pattern>" description:"only restore namespaces matching this pattern, e.g. 'sales.*'; '*' matches any characters; may be repeated; only the oplog entries of matching namespaces are replayed with --oplogReplay; the data of other namespaces in an archive is skipped over, by seeking when the archive is an uncompressed file"`
+	NSFrom                 []string `long:"nsFrom" value-name:"<pattern>" description:"rename namespaces matching this pattern, e.g. 'prod.*', as they are restored; '*' matches any characters; may be repeated, each paired with an --nsTo; users, roles and their grants follow the databases renamed as a whole, and --oplogReplay entries the namespaces they act on"`
+	NSTo                   []string `long:"nsTo" value-name:"<pattern>" description:"namespace pattern to restore --nsFrom matches to, e.g. 'staging.*'; each '*' is replaced with the text matched by the same '*' in --nsFrom"`
+	NSConflict             string   `long:"nsConflict" value-name:"<policy>" description:"what to do when --nsFrom and --nsTo rename several namespaces to the same target: fail, merge them into the target, keeping the options and indexes of the first, or suffix the later ones' targets with _2, _3, ... (defaults to 'fail')"`
+	RestoreOrder           []string `long:"restoreOrder" value-name:"<pattern>" description:"restore the namespaces matching this pattern, e.g. 'app.users' or 'app.*', before the others, in the order the patterns are given; '*' matches any characters; may be repeated; with --numParallelCollections above 1, collections are begun in this order but may finish out of it; can not be used with --archive"`
+	ReadyEvents            string   `long:"readyEvents" value-name:"<filename or URL>" description:"as each collection is ready, with its documents restored and its indexes built, write a JSON event such as {\"event\": \"ready\", \"ns\": \"app.users\", ...} on its own line to this file, or POST it to this http:// or https:// URL, so applications can be pointed at restored collections as they become ready; with --oplogReplay, the collections are only ready, and their events sent, once the oplog is replayed; a last event, 'done' or 'failed', reports the end of the restore"`
+	SmokeTests             string   `long:"smokeTests" value-name:"<filename>" description:"after restoring, run the queries in this file, a sequence of JSON documents such as {ns: \"db.users\", filter: {active: true}, count: 1200}, and fail if any matches a different number of documents"`
+	Verify                 bool     `long:"verify" description:"after restoring, compare the document count of each restored collection, and a hashed sample of its documents, with the documents restored from the dump, and fail if any differ; collections restored into without --drop, or with --mode other than insert, may legitimately differ"`
+	VerifyReport           string   `long:"verifyReport" value-name:"<filename>" description:"write the --verify result for each collection as JSON to this file"`
+	StatsFile              string   `long:"statsFile" value-name:"<filename>" description:"write a JSON summary of the restore (per-collection documents inserted, write failures, durations, index build times, and total bytes) to this file, whether it succeeds or fails"`
+	OmitID                 bool     `long:"omitId" description:"insert documents without their dumped _id, so the server generates new ObjectIds, e.g. to merge collections from several sources into one without duplicate keys; system collections keep their _id"`
+	Transform              []string `long:"transform" value-name:"<statement>" description:"transform each restored document with a statement: 'drop <field>', 'rename <field> <newField>', 'set <field> <json value>' or 'hash <field> [<salt>]'; may be repeated, and statements are applied in order"`
+	FixBrokenFieldNames    string   `long:"fixBrokenFieldNames" value-name:"<replacement>" optional:"true" optional-value:"_" description:"rename the fields whose names contain dots or start with '$', which dumps of very old servers may hold and servers reject, replacing each dot and the leading '$' with this string (defaults to '_'); the $ref, $id and $db fields of DBRefs are kept; a document in which a new name is already taken isn't restored"`
+	OversizedDocs          string   `long:"oversizedDocs" value-name:"<policy>" description:"what to do with documents over the 16MB BSON limit: fail, skip or truncate (defaults to 'fail')" default:"fail" default-mask:"-"`
+	TruncateFields         string   `long:"truncateFields" value-name:"<field>[,<field>]*" description:"comma-separated fields to remove, in order, from documents over the BSON limit until they fit, with --oversizedDocs=truncate"`
+	StateFile              string   `long:"stateFile" value-name:"<filename>" description:"record the collections restored, and how far into each .bson file the restore has got, in this file, so an interrupted restore can be continued with --resume"`
+	Resume                 bool     `long:"resume" description:"continue an interrupted restore from the progress recorded in --stateFile, skipping the collections and documents it already restored"`
+	PreallocateMinSize     string   `long:"preallocateMinSize" value-name:"<size>" description:"pre-create collections whose dump files are at least this large (e.g. 10GB), preallocating their size up front; gzipped dump files are not preallocated; only MMAPv1 preallocates space, other storage engines ignore the size"`
+	NoProgressHistory      bool     `long:"noProgressHistory" description:"don't draw a sparkline of each progress bar's recent throughput, which is otherwise drawn when standard error is a terminal"`
 }
 
 // Name returns a human-readable group name for output options.
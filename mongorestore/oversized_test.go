@@ -0,0 +1,40 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+func TestDecodedBSONSource(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document over the BSON limit", t, func() {
+		data, err := bson.Marshal(bson.D{{"_id", 1}, {"blob", strings.Repeat("x", db.MaxBSONSize)}})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		read := func() bool {
+			source := restore.decodedBSONSource(db.NewBSONSource(&memoryBSONFile{Reader: bytes.NewReader(data)}))
+			defer source.Close()
+			doc := bson.Raw{}
+			return source.Next(&doc)
+		}
+
+		Convey("it should be refused by default", func() {
+			restore.OutputOptions.OversizedDocs = db.OversizedFail
+			So(read(), ShouldBeFalse)
+		})
+
+		Convey("it should be read whole when --oversizedDocs can handle it", func() {
+			restore.OutputOptions.OversizedDocs = db.OversizedSkip
+			So(read(), ShouldBeTrue)
+			restore.OutputOptions.OversizedDocs = db.OversizedTruncate
+			So(read(), ShouldBeTrue)
+		})
+	})
+}
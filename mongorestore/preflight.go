@@ -0,0 +1,371 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// versionDecimal128 is the first server version storing decimal128 values.
+var versionDecimal128 = []int{3, 4}
+
+// decimal128Feature describes a collection holding decimal128 values.
+const decimal128Feature = "a decimal128 value"
+
+// dumpFeature is a feature of a dumped collection that the target server
+// must support for the collection to be restored.
+type dumpFeature struct {
+	namespace string
+	feature   string
+	version   []int
+}
+
+func (feature dumpFeature) String() string {
+	return fmt.Sprintf("%v: %v requires MongoDB %v or later",
+		feature.namespace, feature.feature, formatVersion(feature.version))
+}
+
+// formatVersion returns a version array as a dotted version.
+func formatVersion(version []int) string {
+	parts := make([]string, len(version))
+	for i, part := range version {
+		parts[i] = fmt.Sprint(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// versionAtLeast returns true if the version is the given one or later.
+func versionAtLeast(version []int, atLeast []int) bool {
+	for i := range atLeast {
+		if i == len(version) {
+			return false
+		}
+		if version[i] != atLeast[i] {
+			return version[i] > atLeast[i]
+		}
+	}
+	return true
+}
+
+// collectionFeatures returns the features the collection options need.
+func collectionFeatures(options bson.D) []dumpFeature {
+	features := []dumpFeature{}
+	for _, opt := range options {
+		switch opt.Name {
+		case "collation":
+			features = append(features, dumpFeature{feature: "a default collation", version: []int{3, 4}})
+		case "viewOn":
+			features = append(features, dumpFeature{feature: "a view", version: []int{3, 4}})
+		case "timeseries":
+			features = append(features, dumpFeature{feature: "a time-series collection", version: []int{5, 0}})
+		case "clusteredIndex":
+			features = append(features, dumpFeature{feature: "a clustered collection", version: []int{5, 3}})
+		case "validator":
+			if hasField(opt.Value, "$jsonSchema") {
+				features = append(features, dumpFeature{feature: "a $jsonSchema validator", version: []int{3, 6}})
+			} else {
+				features = append(features, dumpFeature{feature: "a validator", version: []int{3, 2}})
+			}
+		}
+	}
+	return features
+}
+
+// indexFeatures returns the features the index needs. The index version
+// only matters with keepVersion, as it is otherwise left to the server.
+func indexFeatures(index IndexDocument, keepVersion bool) []dumpFeature {
+	features := []dumpFeature{}
+	name := fmt.Sprint(index.Options["name"])
+	if _, ok := index.Options["collation"]; ok {
+		features = append(features, dumpFeature{
+			feature: fmt.Sprintf("the collation of index %v", name), version: []int{3, 4}})
+	}
+	if _, ok := index.Options["partialFilterExpression"]; ok {
+		features = append(features, dumpFeature{
+			feature: fmt.Sprintf("partial index %v", name), version: []int{3, 2}})
+	}
+	if util.IsTruthy(index.Options["hidden"]) {
+		features = append(features, dumpFeature{
+			feature: fmt.Sprintf("hidden index %v", name), version: []int{4, 4}})
+	}
+	for _, key := range index.Key {
+		if key.Name == "$**" || strings.HasSuffix(key.Name, ".$**") {
+			features = append(features, dumpFeature{
+				feature: fmt.Sprintf("wildcard index %v", name), version: []int{4, 2}})
+			break
+		}
+	}
+	if version, ok := index.Options["v"]; ok && keepVersion {
+		if v, err := util.ToInt(version); err == nil && v >= 2 {
+			features = append(features, dumpFeature{
+				feature: fmt.Sprintf("version %v of index %v, kept with --keepIndexVersion", v, name),
+				version: []int{3, 4}})
+		}
+	}
+	return features
+}
+
+// PreflightChecks checks, before anything is written, that the target
+// server supports the features of the dump's collections that are to be
+// restored, such as collations, views, validators, index versions and
+// decimal128 values, failing with every incompatibility found.
+func (restore *MongoRestore) PreflightChecks() error {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	buildInfo, err := session.BuildInfo()
+	session.Close()
+	if err != nil {
+		return fmt.Errorf("error getting the target server's version: %v", err)
+	}
+	log.Logf(log.DebugLow, "checking that MongoDB %v supports the dump's features", buildInfo.Version)
+
+	// documents are scanned for decimal128 values only until one is found,
+	// which is enough to know the dump can't be restored
+	scanDecimal128 := !versionAtLeast(buildInfo.VersionArray, versionDecimal128)
+	incompatible := []string{}
+	for _, intent := range restore.manager.Intents() {
+		if intent.IsSpecialCollection() || intent.IsOplog() || isTimeSeriesBuckets(intent.C) {
+			continue
+		}
+		features, err := restore.intentFeatures(intent, scanDecimal128)
+		if err != nil {
+			return err
+		}
+		for _, feature := range features {
+			if feature.feature == decimal128Feature {
+				log.Logf(log.Info, "found a decimal128 value in %v; "+
+					"not checking the documents of the other collections", intent.Namespace())
+				scanDecimal128 = false
+			}
+			if !versionAtLeast(buildInfo.VersionArray, feature.version) {
+				incompatible = append(incompatible, feature.String())
+			}
+		}
+	}
+	if len(incompatible) == 0 {
+		return nil
+	}
+	sort.Strings(incompatible)
+	return fmt.Errorf("the target server, MongoDB %v, can't restore the dump:\n\t%v\n"+
+		"use --noPreflightChecks to restore anyway", buildInfo.Version, strings.Join(incompatible, "\n\t"))
+}
+
+// intentFeatures returns the features the intent's collection needs, as
+// restored with the given options. Its documents are only read, from files,
+// with scanDecimal128, for the decimal128 values servers before 3.4 don't
+// support.
+func (restore *MongoRestore) intentFeatures(intent *intents.Intent, scanDecimal128 bool) ([]dumpFeature, error) {
+	var options bson.D
+	var indexes []IndexDocument
+	if intent.MetadataPath != "" {
+		if err := intent.MetadataFile.Open(); err != nil {
+			return nil, err
+		}
+		metadata, err := ioutil.ReadAll(intent.MetadataFile)
+		intent.MetadataFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading metadata file %v: %v", intent.MetadataPath, err)
+		}
+		options, indexes, err = restore.MetadataFromJSON(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
+		}
+		options = createOptions(options)
+		if len(restore.optionsOverrides) > 0 {
+			options = restore.optionsOverrides.apply(intent.Namespace(), options)
+		}
+	} else if collections, ok := restore.dbCollectionIndexes[intent.DB]; ok {
+		indexes = collections[intent.C]
+	}
+
+	features := []dumpFeature{}
+	if !restore.OutputOptions.NoOptionsRestore && !restore.OutputOptions.IndexesOnly {
+		features = append(features, collectionFeatures(options)...)
+	}
+	if !restore.OutputOptions.NoIndexRestore {
+		for _, index := range indexes {
+			features = append(features, indexFeatures(index, restore.OutputOptions.KeepIndexVersion)...)
+		}
+	}
+
+	if scanDecimal128 && intent.BSONPath != "" &&
+		restore.InputOptions.Archive == "" && !restore.useStdin && !restore.OutputOptions.IndexesOnly {
+		found, err := restore.hasDecimal128(intent)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			features = append(features, dumpFeature{feature: decimal128Feature, version: versionDecimal128})
+		}
+	}
+
+	for i := range features {
+		features[i].namespace = intent.Namespace()
+	}
+	return features, nil
+}
+
+// hasDecimal128 reads the intent's documents until one holds a decimal128
+// value.
+func (restore *MongoRestore) hasDecimal128(intent *intents.Intent) (bool, error) {
+	log.Logf(log.Info, "checking the documents of %v for decimal128 values", intent.Namespace())
+	if err := intent.BSONFile.Open(); err != nil {
+		return false, err
+	}
+	defer intent.BSONFile.Close()
+	bsonSource := restore.decodedBSONSource(db.NewBSONSource(intent.BSONFile))
+	doc := bson.Raw{}
+	for bsonSource.Next(&doc) {
+		found, err := containsDecimal128(doc.Data)
+		if err != nil {
+			return false, fmt.Errorf("error reading %v: %v", intent.BSONPath, err)
+		}
+		if found {
+			return true, nil
+		}
+	}
+	if err := bsonSource.Err(); err != nil {
+		return false, fmt.Errorf("error reading %v: %v", intent.BSONPath, err)
+	}
+	return false, nil
+}
+
+// BSON element types whose values are skipped over by their size.
+var fixedElementSizes = map[byte]int{
+	0x01: 8,  // double
+	0x06: 0,  // undefined
+	0x07: 12, // ObjectId
+	0x08: 1,  // boolean
+	0x09: 8,  // date
+	0x0A: 0,  // null
+	0x10: 4,  // int32
+	0x11: 8,  // timestamp
+	0x12: 8,  // int64
+	0x13: 16, // decimal128
+	0x7F: 0,  // max key
+	0xFF: 0,  // min key
+}
+
+// containsDecimal128 returns true if the raw BSON document, or one nested
+// in it, holds a decimal128 value. The document isn't decoded, as the BSON
+// library doesn't know decimal128.
+func containsDecimal128(doc []byte) (bool, error) {
+	if len(doc) < 5 {
+		return false, fmt.Errorf("invalid BSON document of %v bytes", len(doc))
+	}
+	pos := 4
+	for pos < len(doc)-1 {
+		kind := doc[pos]
+		pos++
+		// skip the element's name
+		end := pos
+		for end < len(doc) && doc[end] != 0 {
+			end++
+		}
+		if end == len(doc) {
+			return false, fmt.Errorf("invalid BSON element name")
+		}
+		pos = end + 1
+
+		if kind == 0x13 {
+			return true, nil
+		}
+		size, ok := fixedElementSizes[kind]
+		if !ok {
+			var err error
+			var nested []byte
+			size, nested, err = variableElementSize(kind, doc[pos:])
+			if err != nil {
+				return false, err
+			}
+			if nested != nil {
+				found, err := containsDecimal128(nested)
+				if found || err != nil {
+					return found, err
+				}
+			}
+		}
+		if pos+size > len(doc) {
+			return false, fmt.Errorf("invalid BSON element of type 0x%02x", kind)
+		}
+		pos += size
+	}
+	return false, nil
+}
+
+// variableElementSize returns the size of a value of the given type, whose
+// bytes start the data, and the document it is or holds, if any.
+func variableElementSize(kind byte, data []byte) (int, []byte, error) {
+	int32At := func(pos int) (int, error) {
+		if pos+4 > len(data) {
+			return 0, fmt.Errorf("truncated BSON element of type 0x%02x", kind)
+		}
+		return int(int32(uint32(data[pos]) | uint32(data[pos+1])<<8 |
+			uint32(data[pos+2])<<16 | uint32(data[pos+3])<<24)), nil
+	}
+	cstringSize := func(pos int) (int, error) {
+		for i := pos; i < len(data); i++ {
+			if data[i] == 0 {
+				return i - pos + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("truncated BSON element of type 0x%02x", kind)
+	}
+
+	// lengthAt returns the non-negative length at pos, which with extra
+	// bytes must fit in the data
+	lengthAt := func(pos, extra int) (int, error) {
+		length, err := int32At(pos)
+		if err != nil {
+			return 0, err
+		}
+		if length < 0 || length+extra > len(data) {
+			return 0, fmt.Errorf("invalid length %v of BSON element of type 0x%02x", length, kind)
+		}
+		return length, nil
+	}
+
+	switch kind {
+	case 0x02, 0x0D, 0x0E: // string, JavaScript, symbol
+		length, err := lengthAt(0, 4)
+		return 4 + length, nil, err
+	case 0x03, 0x04: // document, array
+		length, err := lengthAt(0, 0)
+		if err != nil || length < 5 {
+			return 0, nil, fmt.Errorf("invalid nested BSON document")
+		}
+		return length, data[:length], nil
+	case 0x05: // binary
+		length, err := lengthAt(0, 5)
+		return 5 + length, nil, err
+	case 0x0B: // regular expression
+		pattern, err := cstringSize(0)
+		if err != nil {
+			return 0, nil, err
+		}
+		flags, err := cstringSize(pattern)
+		return pattern + flags, nil, err
+	case 0x0C: // DBPointer
+		length, err := lengthAt(0, 4+12)
+		return 4 + length + 12, nil, err
+	case 0x0F: // JavaScript with scope
+		length, err := lengthAt(0, 0)
+		if err != nil {
+			return 0, nil, err
+		}
+		codeLength, err := int32At(4)
+		if err != nil || codeLength < 0 || 8+codeLength+5 > length {
+			return 0, nil, fmt.Errorf("invalid BSON JavaScript with scope")
+		}
+		return length, data[8+codeLength : length], nil
+	}
+	return 0, nil, fmt.Errorf("unknown BSON element type 0x%02x", kind)
+}
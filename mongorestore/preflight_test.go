@@ -0,0 +1,198 @@
+package mongorestore
+
+import (
+	"encoding/binary"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// withDecimal128 returns the raw document with a decimal128 field appended,
+// as the BSON library can't marshal one.
+func withDecimal128(doc []byte, name string) []byte {
+	element := append([]byte{0x13}, name...)
+	element = append(element, 0)
+	element = append(element, make([]byte, 16)...)
+	raw := append(append([]byte{}, doc[:len(doc)-1]...), element...)
+	raw = append(raw, 0)
+	binary.LittleEndian.PutUint32(raw, uint32(len(raw)))
+	return raw
+}
+
+func TestPreflightFeatures(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With the metadata of a view with a collation", t, func() {
+		restore := &MongoRestore{}
+		options, indexes, err := restore.MetadataFromJSON([]byte(`{"options":{"viewOn":"events",` +
+			`"pipeline":[],"collation":{"locale":"fr"}},"indexes":[]}`))
+		So(err, ShouldBeNil)
+		So(len(indexes), ShouldEqual, 0)
+
+		Convey("both should be required of the server", func() {
+			features := collectionFeatures(options)
+			So(len(features), ShouldEqual, 2)
+			So(features[0].feature, ShouldEqual, "a view")
+			So(features[0].version, ShouldResemble, []int{3, 4})
+			So(features[1].feature, ShouldEqual, "a default collation")
+		})
+	})
+
+	Convey("A $jsonSchema validator should require 3.6 and another 3.2", t, func() {
+		features := collectionFeatures(bson.D{{"validator", bson.D{{"$jsonSchema", bson.M{}}}}})
+		So(features[0].version, ShouldResemble, []int{3, 6})
+		features = collectionFeatures(bson.D{{"validator", bson.D{{"a", bson.M{"$gt": 1}}}}})
+		So(features[0].version, ShouldResemble, []int{3, 2})
+	})
+
+	Convey("With a wildcard, partial and hidden index of version 2", t, func() {
+		index := IndexDocument{
+			Key: bson.D{{"attributes.$**", 1}},
+			Options: bson.M{"name": "attrs", "v": 2, "hidden": true,
+				"partialFilterExpression": bson.M{"a": 1}},
+		}
+
+		Convey("each feature should be required", func() {
+			features := indexFeatures(index, false)
+			So(len(features), ShouldEqual, 3)
+			So(features[0].feature, ShouldEqual, "partial index attrs")
+			So(features[1].version, ShouldResemble, []int{4, 4})
+			So(features[2].version, ShouldResemble, []int{4, 2})
+		})
+
+		Convey("its version should only be required with --keepIndexVersion", func() {
+			features := indexFeatures(index, true)
+			So(len(features), ShouldEqual, 4)
+			So(features[3].version, ShouldResemble, []int{3, 4})
+		})
+	})
+
+	Convey("Versions should be compared part by part", t, func() {
+		So(versionAtLeast([]int{3, 2, 22}, []int{3, 4}), ShouldBeFalse)
+		So(versionAtLeast([]int{3, 4, 0}, []int{3, 4}), ShouldBeTrue)
+		So(versionAtLeast([]int{4, 0}, []int{3, 6}), ShouldBeTrue)
+		So(versionAtLeast([]int{5}, []int{5, 3}), ShouldBeFalse)
+		So(dumpFeature{"db.c", "a view", []int{3, 4}}.String(), ShouldEqual,
+			"db.c: a view requires MongoDB 3.4 or later")
+	})
+}
+
+func TestContainsDecimal128(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document of most BSON types", t, func() {
+		doc, err := bson.Marshal(bson.D{
+			{"double", 1.5},
+			{"string", "text"},
+			{"doc", bson.D{{"a", int32(1)}}},
+			{"array", []interface{}{int64(1), "b"}},
+			{"binary", bson.Binary{Kind: 0, Data: []byte{1, 2, 3}}},
+			{"id", bson.NewObjectId()},
+			{"bool", true},
+			{"null", nil},
+			{"regex", bson.RegEx{Pattern: "^a", Options: "i"}},
+			{"code", bson.JavaScript{Code: "f()", Scope: bson.M{"x": 1}}},
+			{"ts", bson.MongoTimestamp(1)},
+			{"min", bson.MinKey},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("it should hold no decimal128", func() {
+			found, err := containsDecimal128(doc)
+			So(err, ShouldBeNil)
+			So(found, ShouldBeFalse)
+		})
+
+		Convey("a decimal128 appended to it should be found", func() {
+			found, err := containsDecimal128(withDecimal128(doc, "price"))
+			So(err, ShouldBeNil)
+			So(found, ShouldBeTrue)
+		})
+
+		Convey("a decimal128 nested in it should be found", func() {
+			nested := withDecimal128(doc, "price")
+			outer, err := bson.Marshal(bson.D{{"x", 1}})
+			So(err, ShouldBeNil)
+			element := append([]byte{0x03, 'n', 0}, nested...)
+			raw := append(append([]byte{}, outer[:len(outer)-1]...), element...)
+			raw = append(raw, 0)
+			binary.LittleEndian.PutUint32(raw, uint32(len(raw)))
+			found, err := containsDecimal128(raw)
+			So(err, ShouldBeNil)
+			So(found, ShouldBeTrue)
+		})
+
+		Convey("a truncated document should be an error", func() {
+			_, err := containsDecimal128(doc[:len(doc)/2])
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Elements with invalid lengths should be errors, not panics", t, func() {
+		// a document holding a single element of the type, named "a", with
+		// the given bytes as value
+		element := func(kind byte, value ...byte) []byte {
+			raw := append([]byte{0, 0, 0, 0, kind, 'a', 0}, value...)
+			raw = append(raw, 0)
+			binary.LittleEndian.PutUint32(raw, uint32(len(raw)))
+			return raw
+		}
+		negative := []byte{0xf6, 0xff, 0xff, 0xff}
+		invalid := [][]byte{
+			element(0x02, negative...),
+			element(0x02, 0xff, 0xff, 0xff, 0x7f),
+			element(0x05, negative...),
+			element(0x03, negative...),
+			element(0x0C, negative...),
+			element(0x0F, append([]byte{20, 0, 0, 0}, negative...)...),
+			element(0x0F, 0xff, 0xff, 0xff, 0x7f, 1, 0, 0, 0),
+		}
+		for _, doc := range invalid {
+			_, err := containsDecimal128(doc)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestPreflightDecimal128Scan(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a dumped collection holding a decimal128 value", t, func() {
+		doc, err := bson.Marshal(bson.D{{"_id", 1}})
+		So(err, ShouldBeNil)
+		bsonFile, err := ioutil.TempFile("", "preflight")
+		So(err, ShouldBeNil)
+		_, err = bsonFile.Write(withDecimal128(doc, "price"))
+		So(err, ShouldBeNil)
+		So(bsonFile.Close(), ShouldBeNil)
+
+		intent := &intents.Intent{DB: "db", C: "prices", BSONPath: bsonFile.Name()}
+		intent.BSONFile = &realBSONFile{intent: intent}
+		restore := &MongoRestore{InputOptions: &InputOptions{}, OutputOptions: &OutputOptions{}}
+
+		Convey("the value should be found when scanning", func() {
+			features, err := restore.intentFeatures(intent, true)
+			So(err, ShouldBeNil)
+			So(len(features), ShouldEqual, 1)
+			So(features[0].feature, ShouldEqual, decimal128Feature)
+			So(features[0].namespace, ShouldEqual, "db.prices")
+		})
+
+		Convey("the documents shouldn't be read once a value was found elsewhere", func() {
+			features, err := restore.intentFeatures(intent, false)
+			So(err, ShouldBeNil)
+			So(len(features), ShouldEqual, 0)
+		})
+
+		Reset(func() {
+			os.Remove(bsonFile.Name())
+		})
+	})
+}
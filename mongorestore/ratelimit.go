@@ -0,0 +1,89 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/text"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter holds the insertion workers of every collection to a combined
+// rate of documents or bytes per second, with --ratelimit. It's a token
+// bucket holding up to a second's worth of inserts: a worker takes what its
+// document costs, and if that leaves the bucket in debt, sleeps until the
+// debt would have been refilled. A nil rateLimiter never waits.
+type rateLimiter struct {
+	// whether the rate is in bytes rather than documents
+	bytes bool
+	rate  float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// parseRateLimit parses a --ratelimit value: a number of documents per
+// second, such as "5000", or an amount of bytes per second, such as "20MB"
+// or "20MB/s".
+func parseRateLimit(limit string) (*rateLimiter, error) {
+	trimmed := strings.TrimSuffix(strings.TrimSpace(limit), "/s")
+	limiter := &rateLimiter{}
+	rate, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil {
+		byteRate, err := text.ParseByteAmount(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --ratelimit '%v', expected documents or bytes (e.g. 20MB) per second", limit)
+		}
+		limiter.bytes = true
+		rate = float64(byteRate)
+	}
+	if rate <= 0 {
+		return nil, fmt.Errorf("--ratelimit must be greater than zero")
+	}
+	limiter.rate = rate
+	limiter.tokens = rate
+	limiter.last = time.Now()
+	return limiter, nil
+}
+
+// String describes the limit, for logging.
+func (limiter *rateLimiter) String() string {
+	if limiter.bytes {
+		return fmt.Sprintf("%v/s", text.FormatByteAmount(int64(limiter.rate)))
+	}
+	return fmt.Sprintf("%v documents/s", limiter.rate)
+}
+
+// reserve takes the cost of inserting a document of the given size from the
+// bucket, returning how long to wait before inserting it.
+func (limiter *rateLimiter) reserve(size int) time.Duration {
+	cost := 1.0
+	if limiter.bytes {
+		cost = float64(size)
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.rate {
+		limiter.tokens = limiter.rate
+	}
+	limiter.last = now
+	limiter.tokens -= cost
+	if limiter.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+}
+
+// wait blocks until a document of the given size may be inserted.
+func (limiter *rateLimiter) wait(size int) {
+	if limiter == nil {
+		return
+	}
+	if delay := limiter.reserve(size); delay > 0 {
+		time.Sleep(delay)
+	}
+}
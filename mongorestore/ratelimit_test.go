@@ -0,0 +1,57 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --ratelimit", t, func() {
+		Convey("a plain number should limit documents per second", func() {
+			limiter, err := parseRateLimit("5000")
+			So(err, ShouldBeNil)
+			So(limiter.bytes, ShouldBeFalse)
+			So(limiter.rate, ShouldEqual, 5000)
+		})
+
+		Convey("a size should limit bytes per second", func() {
+			limiter, err := parseRateLimit("20MB/s")
+			So(err, ShouldBeNil)
+			So(limiter.bytes, ShouldBeTrue)
+			So(limiter.rate, ShouldEqual, 20*1024*1024)
+		})
+
+		Convey("zero and garbage should be rejected", func() {
+			_, err := parseRateLimit("0")
+			So(err, ShouldNotBeNil)
+			_, err = parseRateLimit("fast")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a limiter of 100 documents per second", t, func() {
+		limiter, err := parseRateLimit("100")
+		So(err, ShouldBeNil)
+
+		Convey("a second's worth of documents should go through without waiting", func() {
+			for i := 0; i < 100; i++ {
+				So(limiter.reserve(10), ShouldEqual, 0)
+			}
+
+			Convey("and the next ones should wait for their share of the rate", func() {
+				So(limiter.reserve(10), ShouldBeGreaterThan, 0)
+				So(limiter.reserve(10), ShouldBeBetween, 10*time.Millisecond, 30*time.Millisecond)
+			})
+		})
+
+		Convey("a nil limiter should never wait", func() {
+			var nilLimiter *rateLimiter
+			nilLimiter.wait(10)
+		})
+	})
+}
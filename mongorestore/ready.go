@@ -0,0 +1,212 @@
+package mongorestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// readyPostAttempts and readyPostBackoff bound the retries of an event
+	// POSTed to a --readyEvents URL
+	readyPostAttempts = 3
+	readyPostBackoff  = time.Second
+
+	readyPostTimeout = 30 * time.Second
+)
+
+// readyEvent is an event of the --readyEvents stream: "ready" once a
+// collection's documents and indexes are restored, and "done" or "failed"
+// at the end of the restore.
+type readyEvent struct {
+	Event     string    `json:"event"`
+	Namespace string    `json:"ns,omitempty"`
+	Documents int64     `json:"documents,omitempty"`
+	Indexes   int       `json:"indexes,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// readyNotifier sends the --readyEvents stream, appending each event as a
+// line of JSON to a file or POSTing it to a URL. A nil readyNotifier sends
+// nothing.
+type readyNotifier struct {
+	sync.Mutex
+	url    string
+	client *http.Client
+	out    io.WriteCloser
+
+	// with holding set, "ready" events are held until release
+	holding bool
+	held    []readyEvent
+}
+
+// newReadyNotifier returns a notifier POSTing to target if it is an http://
+// or https:// URL, or else creating the file at target.
+func newReadyNotifier(target string) (*readyNotifier, error) {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return &readyNotifier{url: target, client: &http.Client{Timeout: readyPostTimeout}}, nil
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return nil, fmt.Errorf("error creating --readyEvents file: %v", err)
+	}
+	return &readyNotifier{out: out}, nil
+}
+
+// send writes the event, stamping it with the current time. Events are sent
+// one at a time, in the order they happen.
+func (notifier *readyNotifier) send(event readyEvent) error {
+	if notifier == nil {
+		return nil
+	}
+	notifier.Lock()
+	defer notifier.Unlock()
+	if notifier.holding && event.Event == "ready" {
+		notifier.held = append(notifier.held, event)
+		return nil
+	}
+	event.Time = time.Now()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding --readyEvents event: %v", err)
+	}
+	if notifier.url != "" {
+		return notifier.post(data)
+	}
+	if _, err = notifier.out.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing to --readyEvents file: %v", err)
+	}
+	return nil
+}
+
+// hold makes the notifier hold the "ready" events until release, as with
+// --oplogReplay, where collections are only ready once the oplog replay
+// has brought them up to date.
+func (notifier *readyNotifier) hold() {
+	if notifier == nil {
+		return
+	}
+	notifier.Lock()
+	defer notifier.Unlock()
+	notifier.holding = true
+}
+
+// release sends the events held, in the order they happened, and those
+// after them as they happen.
+func (notifier *readyNotifier) release() error {
+	if notifier == nil {
+		return nil
+	}
+	notifier.Lock()
+	held := notifier.held
+	notifier.holding, notifier.held = false, nil
+	notifier.Unlock()
+	for _, event := range held {
+		if err := notifier.send(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// post POSTs the event to the URL, retrying a few times if the request
+// fails or isn't accepted.
+func (notifier *readyNotifier) post(data []byte) error {
+	var err error
+	for attempt := 1; attempt <= readyPostAttempts; attempt++ {
+		if attempt > 1 {
+			log.Logf(log.Info, "retrying --readyEvents POST after error: %v", err)
+			time.Sleep(readyPostBackoff)
+		}
+		var resp *http.Response
+		resp, err = notifier.client.Post(notifier.url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("server replied %v", resp.Status)
+	}
+	return fmt.Errorf("error sending --readyEvents event to %v: %v", notifier.url, err)
+}
+
+// Close closes the --readyEvents file.
+func (notifier *readyNotifier) Close() error {
+	if notifier == nil || notifier.out == nil {
+		return nil
+	}
+	if err := notifier.out.Close(); err != nil {
+		return fmt.Errorf("error closing --readyEvents file: %v", err)
+	}
+	return nil
+}
+
+// notifyReady sends the "ready" event of a collection restored into
+// namespace, which is reported under the namespace of its target.
+func (restore *MongoRestore) notifyReady(namespace string) error {
+	if restore.readyEvents == nil {
+		return nil
+	}
+	stats := restore.stats.snapshot(namespace)
+	target := restore.stager.target(namespace)
+	log.Logf(log.DebugLow, "sending the ready event of %v", target)
+	return restore.readyEvents.send(readyEvent{
+		Event:     "ready",
+		Namespace: target,
+		Documents: stats.Documents,
+		Indexes:   stats.Indexes,
+	})
+}
+
+// notifyDone sends the last event, for a restore that ended with err.
+func (restore *MongoRestore) notifyDone(err error) error {
+	if restore.readyEvents == nil {
+		return nil
+	}
+	if err != nil {
+		return restore.readyEvents.send(readyEvent{Event: "failed", Error: err.Error()})
+	}
+	return restore.readyEvents.send(readyEvent{Event: "done"})
+}
+
+// compileRestoreOrder compiles the --restoreOrder patterns.
+func compileRestoreOrder(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("--restoreOrder patterns can not be blank")
+		}
+		re, err := compileNSPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --restoreOrder '%v': %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// restoreRank returns the position of the first --restoreOrder pattern
+// matching the intent's namespace, or the number of patterns if none
+// does, so that the namespaces left out are restored last.
+func (restore *MongoRestore) restoreRank(intent *intents.Intent) int {
+	for i, pattern := range restore.restoreOrder {
+		if pattern.MatchString(intent.Namespace()) {
+			return i
+		}
+	}
+	return len(restore.restoreOrder)
+}
@@ -0,0 +1,148 @@
+package mongorestore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadyEvents(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a --readyEvents file", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_ready_test")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "events.json")
+		notifier, err := newReadyNotifier(path)
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{readyEvents: notifier}
+		restore.stats.recordDocuments("app.users", 10, 1000, 0, 0, nil)
+		restore.stats.recordIndexes("app.users", 2, 0, nil)
+
+		Convey("each event should be written on its own line", func() {
+			So(restore.notifyReady("app.users"), ShouldBeNil)
+			So(restore.notifyDone(fmt.Errorf("insertion error")), ShouldBeNil)
+			So(notifier.Close(), ShouldBeNil)
+
+			file, err := os.Open(path)
+			So(err, ShouldBeNil)
+			defer file.Close()
+			scanner := bufio.NewScanner(file)
+			events := []readyEvent{}
+			for scanner.Scan() {
+				event := readyEvent{}
+				So(json.Unmarshal(scanner.Bytes(), &event), ShouldBeNil)
+				events = append(events, event)
+			}
+			So(len(events), ShouldEqual, 2)
+			So(events[0].Event, ShouldEqual, "ready")
+			So(events[0].Namespace, ShouldEqual, "app.users")
+			So(events[0].Documents, ShouldEqual, 10)
+			So(events[0].Indexes, ShouldEqual, 2)
+			So(events[0].Time.IsZero(), ShouldBeFalse)
+			So(events[1].Event, ShouldEqual, "failed")
+			So(events[1].Error, ShouldEqual, "insertion error")
+		})
+
+		Convey("with --oplogReplay, ready events should be held until the oplog is replayed", func() {
+			notifier.hold()
+			So(restore.notifyReady("app.users"), ShouldBeNil)
+			data, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(len(data), ShouldEqual, 0)
+
+			So(notifier.release(), ShouldBeNil)
+			So(restore.notifyDone(nil), ShouldBeNil)
+			So(notifier.Close(), ShouldBeNil)
+			data, err = ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			So(len(lines), ShouldEqual, 2)
+			event := readyEvent{}
+			So(json.Unmarshal([]byte(lines[0]), &event), ShouldBeNil)
+			So(event.Event, ShouldEqual, "ready")
+			So(event.Namespace, ShouldEqual, "app.users")
+			So(json.Unmarshal([]byte(lines[1]), &event), ShouldBeNil)
+			So(event.Event, ShouldEqual, "done")
+		})
+
+		Convey("a staged collection should be reported under its target", func() {
+			restore.stager = &stager{}
+			restore.stager.add(stagedCollection{db: "app", staged: stagedName("users"), target: "users"})
+			So(restore.notifyReady("app."+stagedName("users")), ShouldBeNil)
+			So(notifier.Close(), ShouldBeNil)
+
+			data, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			event := readyEvent{}
+			So(json.Unmarshal(data, &event), ShouldBeNil)
+			So(event.Namespace, ShouldEqual, "app.users")
+		})
+	})
+
+	Convey("With a --readyEvents URL", t, func() {
+		received := []readyEvent{}
+		failures := 1
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			event := readyEvent{}
+			if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received = append(received, event)
+		}))
+		Reset(func() {
+			server.Close()
+		})
+		notifier, err := newReadyNotifier(server.URL)
+		So(err, ShouldBeNil)
+
+		Convey("events should be POSTed, retrying those refused", func() {
+			So(notifier.send(readyEvent{Event: "done"}), ShouldBeNil)
+			So(len(received), ShouldEqual, 1)
+			So(received[0].Event, ShouldEqual, "done")
+			So(notifier.Close(), ShouldBeNil)
+		})
+	})
+}
+
+func TestRestoreRank(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --restoreOrder patterns", t, func() {
+		order, err := compileRestoreOrder([]string{"app.users", "app.*"})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{restoreOrder: order}
+
+		Convey("namespaces should be ranked by the first pattern they match", func() {
+			So(restore.restoreRank(&intents.Intent{DB: "app", C: "users"}), ShouldEqual, 0)
+			So(restore.restoreRank(&intents.Intent{DB: "app", C: "orders"}), ShouldEqual, 1)
+			So(restore.restoreRank(&intents.Intent{DB: "logs", C: "events"}), ShouldEqual, 2)
+		})
+
+		Convey("blank patterns should be rejected", func() {
+			_, err := compileRestoreOrder([]string{""})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
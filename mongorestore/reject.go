@@ -0,0 +1,86 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// rejectWriter writes the documents that can't be restored, with the
+// reason, to the --rejectFile, so the rest of the restore goes on and the
+// rejected documents can be triaged afterwards. A nil rejectWriter rejects
+// nothing.
+type rejectWriter struct {
+	sync.Mutex
+	path     string
+	out      io.WriteCloser
+	rejected int64
+}
+
+// rejectedDocument is an entry of the --rejectFile. The document is
+// embedded as restored from the dump, or as binary data if it isn't valid
+// BSON.
+type rejectedDocument struct {
+	Namespace string      `bson:"ns"`
+	Error     string      `bson:"error"`
+	Time      time.Time   `bson:"time"`
+	Document  interface{} `bson:"document"`
+}
+
+// newRejectWriter creates the --rejectFile at path.
+func newRejectWriter(path string) (*rejectWriter, error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating --rejectFile: %v", err)
+	}
+	return &rejectWriter{path: path, out: out}, nil
+}
+
+// reject writes the document of the namespace, rejected for the reason, to
+// the file. Without a file, it returns the reason as the error, for the
+// caller to fail with as it would have otherwise.
+func (writer *rejectWriter) reject(namespace string, doc []byte, reason error) error {
+	if writer == nil {
+		return reason
+	}
+	entry := rejectedDocument{Namespace: namespace, Error: reason.Error(), Time: time.Now()}
+	if err := bson.Unmarshal(doc, &bson.D{}); err == nil {
+		entry.Document = bson.Raw{Kind: 0x03, Data: doc}
+	} else {
+		entry.Document = bson.Binary{Kind: 0x00, Data: doc}
+	}
+	data, err := bson.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding rejected document: %v", err)
+	}
+
+	writer.Lock()
+	defer writer.Unlock()
+	if _, err = writer.out.Write(data); err != nil {
+		return fmt.Errorf("error writing to --rejectFile: %v", err)
+	}
+	writer.rejected++
+	log.Logf(log.Info, "rejected a document of %v: %v", namespace, reason)
+	return nil
+}
+
+// Close closes the file, reporting how many documents were rejected.
+func (writer *rejectWriter) Close() error {
+	if writer == nil {
+		return nil
+	}
+	writer.Lock()
+	defer writer.Unlock()
+	if writer.rejected > 0 {
+		log.Logf(log.Always, "%v document(s) could not be restored and were written to %v",
+			writer.rejected, writer.path)
+	}
+	if err := writer.out.Close(); err != nil {
+		return fmt.Errorf("error closing --rejectFile: %v", err)
+	}
+	return nil
+}
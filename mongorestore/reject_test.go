@@ -0,0 +1,88 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRejectWriter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a --rejectFile", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_reject_test")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		path := filepath.Join(dir, "rejects.bson")
+		writer, err := newRejectWriter(path)
+		So(err, ShouldBeNil)
+
+		Convey("rejected documents should be written with their reason", func() {
+			doc, err := bson.Marshal(bson.D{{"_id", 1}, {"name", "too big"}})
+			So(err, ShouldBeNil)
+			So(writer.reject("db.c", doc, fmt.Errorf("document is too large")), ShouldBeNil)
+			So(writer.reject("db.c", []byte{1, 2, 3}, fmt.Errorf("invalid object")), ShouldBeNil)
+			So(writer.Close(), ShouldBeNil)
+
+			file, err := os.Open(path)
+			So(err, ShouldBeNil)
+			source := db.NewDecodedBSONSource(db.NewBSONSource(file))
+			defer source.Close()
+
+			entry := bson.M{}
+			So(source.Next(&entry), ShouldBeTrue)
+			So(entry["ns"], ShouldEqual, "db.c")
+			So(entry["error"], ShouldEqual, "document is too large")
+			So(entry["document"], ShouldResemble, bson.M{"_id": 1, "name": "too big"})
+
+			entry = bson.M{}
+			So(source.Next(&entry), ShouldBeTrue)
+			So(entry["error"], ShouldEqual, "invalid object")
+			So(entry["document"], ShouldResemble, []byte{1, 2, 3})
+
+			So(source.Next(&entry), ShouldBeFalse)
+			So(source.Err(), ShouldBeNil)
+		})
+
+		Convey("documents the server failed to insert should be counted and written", func() {
+			restore := &MongoRestore{rejects: writer}
+			doc, err := bson.Marshal(bson.D{{"_id", 1}})
+			So(err, ShouldBeNil)
+			failures := int64(0)
+			bulkErr := &db.BulkInsertError{Failed: []db.FailedDocument{
+				{Doc: bson.Raw{Kind: 0x03, Data: doc}, Err: fmt.Errorf("E11000 duplicate key error")},
+			}}
+			So(restore.insertFailed("db.c", bulkErr, &failures), ShouldBeNil)
+			So(restore.insertFailed("db.c", fmt.Errorf("not master"), &failures), ShouldBeNil)
+			So(failures, ShouldEqual, 2)
+			So(writer.Close(), ShouldBeNil)
+
+			file, err := os.Open(path)
+			So(err, ShouldBeNil)
+			source := db.NewDecodedBSONSource(db.NewBSONSource(file))
+			defer source.Close()
+			entry := bson.M{}
+			So(source.Next(&entry), ShouldBeTrue)
+			So(entry["error"], ShouldEqual, "E11000 duplicate key error")
+			So(entry["document"], ShouldResemble, bson.M{"_id": 1})
+			So(source.Next(&entry), ShouldBeFalse)
+		})
+	})
+
+	Convey("Without a --rejectFile, rejecting a document should fail with its reason", t, func() {
+		var writer *rejectWriter
+		err := writer.reject("db.c", []byte{}, fmt.Errorf("invalid object"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "invalid object")
+		So(writer.Close(), ShouldBeNil)
+	})
+}
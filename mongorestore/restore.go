@@ -6,9 +6,14 @@ import (
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"gopkg.in/mgo.v2/bson"
+	"io"
 	"io/ioutil"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,9 +29,26 @@ func (restore *MongoRestore) RestoreIntents() error {
 
 	// start up the progress bar manager
 	restore.progressManager = progress.NewProgressBarManager(log.Writer(0), progressBarWaitTime)
+	// the bars are logged, to standard error
+	restore.showHistory = !restore.OutputOptions.NoProgressHistory && progress.HistoryShownOn(os.Stderr)
 	restore.progressManager.Start()
 	defer restore.progressManager.Stop()
 
+	// show how much of the archive is consumed, as the total of a stream
+	// isn't known
+	if restore.archiveProgress != nil {
+		archiveBar := &progress.Bar{
+			Name:        "archive",
+			Watching:    restore.archiveProgress,
+			BarLength:   progressBarLength,
+			IsBytes:     true,
+			ShowRate:    true,
+			ShowHistory: restore.showHistory,
+		}
+		restore.progressManager.Attach(archiveBar)
+		defer restore.progressManager.Detach(archiveBar)
+	}
+
 	log.Logf(log.DebugLow, "restoring up to %v collections in parallel", restore.OutputOptions.NumParallelCollections)
 
 	if restore.OutputOptions.NumParallelCollections > 0 {
@@ -77,20 +99,146 @@ func (restore *MongoRestore) RestoreIntents() error {
 	return nil
 }
 
+// dropCandidates returns the intents whose target collections --drop drops
+// if they exist: every regular collection being restored, except those an
+// earlier run restored some or all of, with --resume.
+func (restore *MongoRestore) dropCandidates() []*intents.Intent {
+	candidates := []*intents.Intent{}
+	for _, intent := range restore.manager.Intents() {
+		if intent.IsSpecialCollection() || intent.IsOplog() {
+			continue
+		}
+		if restore.checkpoint.hasProgress(intent.Namespace()) {
+			log.Logf(log.Info, "not dropping %v, which was restored by an earlier run", intent.Namespace())
+			continue
+		}
+		candidates = append(candidates, intent)
+	}
+	return candidates
+}
+
+// DropIntents drops the target collection of every intent that already
+// exists on the server, using NumParallelCollections workers, and waits for
+// all of the drops to finish. Doing this up front, rather than interleaved
+// with the restores, keeps slow drops off of the restore's critical path.
+func (restore *MongoRestore) DropIntents() error {
+	toDrop := []*intents.Intent{}
+	for _, intent := range restore.dropCandidates() {
+		exists, err := restore.CollectionExists(intent)
+		if err != nil {
+			return fmt.Errorf("error reading database: %v", err)
+		}
+		if !exists {
+			log.Logf(log.DebugLow, "collection %v doesn't exist, skipping drop command", intent.Namespace())
+			continue
+		}
+		if strings.HasPrefix(intent.C, "system.") {
+			log.Logf(log.Always, "cannot drop system collection %v, skipping", intent.Namespace())
+			continue
+		}
+		toDrop = append(toDrop, intent)
+	}
+	return restore.dropCollections(toDrop, restore.DropCollection)
+}
+
+// dropCollections drops the target collection of each intent with drop,
+// using NumParallelCollections workers. Once a drop fails, no more are
+// started, and the first error is returned when the drops under way finish.
+func (restore *MongoRestore) dropCollections(toDrop []*intents.Intent, drop func(*intents.Intent) error) error {
+	if len(toDrop) == 0 {
+		return nil
+	}
+
+	workers := restore.OutputOptions.NumParallelCollections
+	if workers < 1 {
+		workers = 1
+	}
+	log.Logf(log.Info, "dropping %v collections with %v workers before restoring", len(toDrop), workers)
+
+	intentChan := make(chan *intents.Intent, len(toDrop))
+	for _, intent := range toDrop {
+		intentChan <- intent
+	}
+	close(intentChan)
+
+	var failed int32
+	resultChan := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			var firstErr error
+			for intent := range intentChan {
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
+				}
+				log.Logf(log.Info, "dropping collection %v before restoring", intent.Namespace())
+				if err := drop(intent); err != nil {
+					atomic.StoreInt32(&failed, 1)
+					firstErr = fmt.Errorf("%v: %v", intent.Namespace(), err)
+					continue
+				}
+				restore.forgetCollection(intent)
+			}
+			resultChan <- firstErr
+		}()
+	}
+
+	// wait for the drops under way to finish, even if one of them fails
+	var err error
+	for i := 0; i < workers; i++ {
+		if workerErr := <-resultChan; workerErr != nil && err == nil {
+			err = workerErr
+		}
+	}
+	return err
+}
+
 // RestoreIntent attempts to restore a given intent into MongoDB.
 func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 
+	if isTimeSeriesBuckets(intent.C) {
+		log.Logf(log.Always, "skipping %v: time-series buckets are restored through their time-series collection %v",
+			intent.Namespace(), strings.TrimPrefix(intent.C, bucketsPrefix))
+		return nil
+	}
+
+	intent, err := restore.stageIntent(intent)
+	if err != nil {
+		return err
+	}
+
 	collectionExists, err := restore.CollectionExists(intent)
 	if err != nil {
 		return fmt.Errorf("error reading database: %v", err)
 	}
 
-	if restore.safety == nil && !restore.OutputOptions.Drop && collectionExists {
+	if collectionExists && restore.stager.target(intent.Namespace()) != intent.Namespace() {
+		log.Logf(log.Info, "dropping staging collection %v left by an earlier restore", intent.Namespace())
+		if err = restore.DropCollection(intent); err != nil {
+			return err
+		}
+		collectionExists = false
+	}
+	if !collectionExists {
+		restore.ttlHolder.creating(intent)
+	}
+
+	// progress made by an earlier run, when resuming with --resume
+	dataRestored := restore.checkpoint.isCompleted(intent.Namespace())
+	resumeOffset := restore.checkpoint.resumeOffset(intent.Namespace())
+
+	if restore.OutputOptions.IndexesOnly && !collectionExists {
+		log.Logf(log.Always, "collection %v does not exist; its indexes will be built on an empty collection",
+			intent.Namespace())
+	}
+
+	if restore.safety == nil && !restore.OutputOptions.Drop && !restore.OutputOptions.IndexesOnly && collectionExists {
 		log.Logf(log.Always, "restoring to existing collection %v without dropping", intent.Namespace())
 		log.Log(log.Always, "Important: restored data will be inserted without raising errors; check your server log")
 	}
 
-	if restore.OutputOptions.Drop {
+	if restore.OutputOptions.Drop && (dataRestored || resumeOffset > 0) {
+		log.Logf(log.Info, "not dropping collection %v, as its restore is being resumed", intent.Namespace())
+	} else if restore.OutputOptions.Drop {
 		if collectionExists {
 			if strings.HasPrefix(intent.C, "system.") {
 				log.Logf(log.Always, "cannot drop system collection %v, skipping", intent.Namespace())
@@ -107,8 +255,9 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		}
 	}
 
-	var options bson.D
+	var options, validation bson.D
 	var indexes []IndexDocument
+	kind := collectionRegular
 
 	// get indexes from system.indexes dump if we have it but don't have metadata files
 	if intent.MetadataPath == "" {
@@ -135,49 +284,173 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		if err != nil {
 			return fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
 		}
-		if !restore.OutputOptions.NoOptionsRestore {
+		indexes = withSimpleCollation(options, withoutClusteredIndex(indexes))
+		options = createOptions(options)
+		if len(restore.optionsOverrides) > 0 {
+			options = restore.optionsOverrides.apply(intent.Namespace(), options)
+			log.Logf(log.DebugLow, "options of %v after --collectionOptionsOverride: %v", intent.Namespace(), options)
+		}
+		// time-series, clustered and capped collections and views are only
+		// made by create, so they must be created before any document is
+		// inserted; an override may make a collection capped, or no longer
+		kind = collectionKind(options)
+		if kind == collectionTimeSeries {
+			restore.verifier.record(intent.Namespace()).countOnly(
+				"time-series measurements are read back from their buckets, not as restored")
+		}
+		if restore.OutputOptions.IndexesOnly {
+			log.Log(log.Info, "skipping options restoration with --indexesOnly")
+		} else if !restore.OutputOptions.NoOptionsRestore {
 			if options != nil {
 				if !collectionExists {
-					log.Logf(log.Info, "creating collection %v using options from metadata", intent.Namespace())
+					if kind == collectionRegular {
+						log.Logf(log.Info, "creating collection %v using options from metadata", intent.Namespace())
+						if restore.shouldPreallocate(intent) {
+							options = preallocatedOptions(intent, options)
+						}
+					} else if kind == collectionView {
+						log.Logf(log.Info, "creating view %v using options from metadata", intent.Namespace())
+					} else {
+						log.Logf(log.Info, "creating %v collection %v using options from metadata", kind, intent.Namespace())
+					}
+					// the validator is set once the documents are restored
+					options, validation = splitValidationOptions(options)
 					err = restore.CreateCollection(intent, options)
 					if err != nil {
 						return fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)
 					}
+					collectionExists = true
+				} else if kind != collectionRegular {
+					log.Logf(log.Always, "collection %v already exists; it must be a %v collection, "+
+						"as in the dump, for its documents to be restored alike", intent.Namespace(), kind)
 				} else {
 					log.Logf(log.Info, "collection %v already exists", intent.Namespace())
 				}
 			} else {
 				log.Log(log.Info, "no collection options to restore")
 			}
+		} else if kind != collectionRegular {
+			log.Logf(log.Always, "warning: %v is a %v collection in the dump, but is restored as a "+
+				"regular collection with --noOptionsRestore", intent.Namespace(), kind)
+			kind = collectionRegular
 		} else {
 			log.Log(log.Info, "skipping options restoration")
 		}
 	}
 
+	// create a collection dumped without metadata with the options of any
+	// --collectionOptionsOverride matching it
+	if overridden := restore.optionsWithoutMetadata(intent); len(overridden) > 0 && !collectionExists {
+		options = overridden
+		kind = collectionKind(options)
+		if kind == collectionTimeSeries {
+			restore.verifier.record(intent.Namespace()).countOnly(
+				"time-series measurements are read back from their buckets, not as restored")
+		}
+		if kind == collectionRegular && restore.shouldPreallocate(intent) {
+			options = preallocatedOptions(intent, options)
+		}
+		log.Logf(log.Info, "creating collection %v using options from --collectionOptionsOverride", intent.Namespace())
+		// the validator is set once the documents are restored
+		options, validation = splitValidationOptions(options)
+		err = restore.CreateCollection(intent, options)
+		if err != nil {
+			return fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)
+		}
+		collectionExists = true
+	}
+
+	// pre-create large collections that were not created from their options
+	if !collectionExists && intent.BSONPath != "" && !strings.HasPrefix(intent.C, "system.") &&
+		!restore.OutputOptions.IndexesOnly && restore.shouldPreallocate(intent) {
+		log.Logf(log.Info, "creating collection %v with %v preallocated",
+			intent.Namespace(), text.FormatByteAmount(intent.Size))
+		err = restore.CreateCollection(intent, preallocatedOptions(intent, nil))
+		if err != nil {
+			return fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)
+		}
+	}
+
+	// recreate the collection's shard key and chunks, with --sharded
+	if intent.BSONPath != "" && !restore.OutputOptions.IndexesOnly && !dataRestored && kind != collectionView {
+		if err = restore.ShardCollection(intent); err != nil {
+			return err
+		}
+	}
+
 	// then do bson
-	if intent.BSONPath != "" {
+	if intent.BSONPath != "" && restore.OutputOptions.IndexesOnly {
+		log.Logf(log.Info, "skipping documents for %v with --indexesOnly", intent.Namespace())
+	} else if intent.BSONPath != "" && kind == collectionView {
+		log.Logf(log.Info, "skipping documents for view %v, which are computed from the collection it is on",
+			intent.Namespace())
+		restore.verifier.record(intent.Namespace()).skip("views hold no documents of their own")
+	} else if intent.BSONPath != "" && dataRestored {
+		log.Logf(log.Always, "skipping documents for %v, already restored", intent.Namespace())
+		restore.verifier.record(intent.Namespace()).skip("documents restored by an earlier run")
+	} else if intent.BSONPath != "" {
 		err = intent.BSONFile.Open()
 		if err != nil {
 			return err
 		}
 		defer intent.BSONFile.Close()
 
-		log.Logf(log.Always, "restoring %v from file %v", intent.Namespace(), intent.BSONPath)
+		if resumeOffset > 0 {
+			log.Logf(log.Always, "resuming %v from byte %v of file %v", intent.Namespace(), resumeOffset, intent.BSONPath)
+			restore.verifier.record(intent.Namespace()).skip("restore resumed part way through the collection")
+			if _, err = io.CopyN(ioutil.Discard, intent.BSONFile, resumeOffset); err != nil {
+				return fmt.Errorf("error skipping to byte %v of %v: %v", resumeOffset, intent.BSONPath, err)
+			}
+		} else {
+			log.Logf(log.Always, "restoring %v from file %v", intent.Namespace(), intent.BSONPath)
+		}
+		restore.checkpoint.track(intent.Namespace(), resumeOffset)
+
+		// show the progress out of the documents left to read, if their size is known
 		var size int64
+		if dataSize, known := bsonDataSize(intent); known && dataSize > resumeOffset {
+			size = dataSize - resumeOffset
+		}
 
-		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(intent.BSONFile))
+		var rawSource db.RawDocSource = db.NewBSONSource(intent.BSONFile)
+		if mapped := mappedBSONFile(intent); mapped != nil {
+			rawSource = mapped
+		}
+		bsonSource := restore.decodedBSONSource(rawSource)
 		defer bsonSource.Close()
 
-		err = restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSource, size)
+		maintainOrder := restore.orderedInserts(intent.Namespace(), kind == collectionCapped)
+		if maintainOrder && kind == collectionCapped {
+			log.Logf(log.Info, "restoring the documents of capped collection %v in order", intent.Namespace())
+		} else if maintainOrder {
+			log.Logf(log.Info, "restoring the documents of %v in order", intent.Namespace())
+		}
+		err = restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSource, size, maintainOrder)
 		if err != nil {
 			return fmt.Errorf("error restoring from %v: %v", intent.BSONPath, err)
 		}
+		if err = restore.checkpoint.complete(intent.Namespace()); err != nil {
+			return err
+		}
+	}
+
+	// then set the validator, which may reject documents dumped from before
+	// it was added
+	if len(validation) > 0 {
+		log.Logf(log.Info, "setting the validation options of %v from metadata", intent.Namespace())
+		if err = restore.ApplyValidation(intent, validation); err != nil {
+			return fmt.Errorf("error setting the validation options of %v: %v", intent.Namespace(), err)
+		}
 	}
 
 	// finally, add indexes
-	if len(indexes) > 0 && !restore.OutputOptions.NoIndexRestore {
+	deferred := len(indexes) > 0 && !restore.OutputOptions.NoIndexRestore && restore.OutputOptions.DeferIndexes
+	if deferred {
+		log.Logf(log.Always, "deferring index builds for collection %v", intent.Namespace())
+		restore.deferIndexBuild(intent, indexes)
+	} else if len(indexes) > 0 && !restore.OutputOptions.NoIndexRestore {
 		log.Logf(log.Always, "restoring indexes for collection %v from metadata", intent.Namespace())
-		err = restore.CreateIndexes(intent, indexes)
+		err = restore.buildIndexes(intent, indexes)
 		if err != nil {
 			return fmt.Errorf("error creating indexes for %v: %v", intent.Namespace(), err)
 		}
@@ -186,12 +459,143 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 	}
 
 	log.Logf(log.Always, "finished restoring %v", intent.Namespace())
+
+	// a staged collection is ready once renamed over its target
+	if !deferred && restore.stager.target(intent.Namespace()) == intent.Namespace() {
+		return restore.notifyReady(intent.Namespace())
+	}
 	return nil
 }
 
-// RestoreCollectionToDB pipes the given BSON data into the database.
+// decodedBSONSource decodes the documents of a BSON file. Documents over the
+// BSON limit are only read whole when --oversizedDocs can skip or truncate
+// them, as that takes a buffer of the maximum message size.
+func (restore *MongoRestore) decodedBSONSource(source db.RawDocSource) *db.DecodedBSONSource {
+	switch restore.OutputOptions.OversizedDocs {
+	case db.OversizedSkip, db.OversizedTruncate:
+		return db.NewDecodedBSONSourceWithMaxSize(source, db.MaxMessageSize)
+	}
+	return db.NewDecodedBSONSource(source)
+}
+
+// deferredIndexBuild holds the indexes of a collection to be built once
+// every collection's documents have been restored.
+type deferredIndexBuild struct {
+	intent  *intents.Intent
+	indexes []IndexDocument
+}
+
+// deferIndexBuild queues the collection's indexes to be built by
+// CreateDeferredIndexes.
+func (restore *MongoRestore) deferIndexBuild(intent *intents.Intent, indexes []IndexDocument) {
+	restore.deferredIndexesMutex.Lock()
+	defer restore.deferredIndexesMutex.Unlock()
+	restore.deferredIndexes = append(restore.deferredIndexes, deferredIndexBuild{intent, indexes})
+}
+
+// CreateDeferredIndexes builds the indexes deferred with --deferIndexes,
+// for up to --numParallelCollections collections at once.
+func (restore *MongoRestore) CreateDeferredIndexes() error {
+	if len(restore.deferredIndexes) == 0 {
+		return nil
+	}
+	log.Logf(log.Always, "building deferred indexes for %v collections", len(restore.deferredIndexes))
+
+	builds := make(chan deferredIndexBuild, len(restore.deferredIndexes))
+	for _, build := range restore.deferredIndexes {
+		builds <- build
+	}
+	close(builds)
+
+	workers := restore.OutputOptions.NumParallelCollections
+	if workers < 1 {
+		workers = 1
+	}
+	resultChan := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for build := range builds {
+				log.Logf(log.Always, "restoring indexes for collection %v from metadata", build.intent.Namespace())
+				if err := restore.buildIndexes(build.intent, build.indexes); err != nil {
+					resultChan <- fmt.Errorf("error creating indexes for %v: %v", build.intent.Namespace(), err)
+					return
+				}
+				namespace := build.intent.Namespace()
+				if restore.stager.target(namespace) == namespace {
+					if err := restore.notifyReady(namespace); err != nil {
+						resultChan <- err
+						return
+					}
+				}
+			}
+			resultChan <- nil
+		}()
+	}
+
+	// wait until all goroutines are done or one of them errors out
+	for i := 0; i < workers; i++ {
+		if err := <-resultChan; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildIndexes creates the collection's indexes, recording how long they
+// took for --statsFile.
+func (restore *MongoRestore) buildIndexes(intent *intents.Intent, indexes []IndexDocument) error {
+	start := time.Now()
+	err := restore.CreateIndexes(intent, indexes)
+	restore.stats.recordIndexes(intent.Namespace(), len(indexes), time.Since(start), err)
+	return err
+}
+
+// numberedDoc is a document read from a BSON file, numbered so the
+// checkpointer can tell when it and the documents before it are inserted.
+type numberedDoc struct {
+	raw bson.Raw
+	seq int64
+}
+
+// insertFailed counts the documents of the namespace a bulk insert failed
+// to insert, handing them to the --rejectFile if there is one, and returns
+// an error only if they can't be written to it.
+func (restore *MongoRestore) insertFailed(namespace string, err error, failures *int64) error {
+	bulkErr, ok := err.(*db.BulkInsertError)
+	if !ok {
+		log.Logf(log.Always, "error: %v", err)
+		atomic.AddInt64(failures, 1)
+		return nil
+	}
+	atomic.AddInt64(failures, int64(len(bulkErr.Failed)))
+	if restore.rejects == nil {
+		log.Logf(log.Always, "error: %v", err)
+		return nil
+	}
+	for _, failed := range bulkErr.Failed {
+		if err = restore.rejects.reject(namespace, failed.Doc.Data, failed.Err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreCollectionToDB pipes the given BSON data into the database. With
+// maintainOrder, as for capped collections, the documents are inserted in
+// the order they are read, by a single worker making ordered bulk inserts.
 func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
-	bsonSource *db.DecodedBSONSource, fileSize int64) error {
+	bsonSource *db.DecodedBSONSource, fileSize int64, maintainOrder bool) (err error) {
+
+	// count what is sent to the server for --statsFile, except for the
+	// temporary collections users and roles are restored through
+	start := time.Now()
+	var documents, bytes, failures int64
+	if dbName != "admin" || (colName != restore.tempUsersCol && colName != restore.tempRolesCol) {
+		defer func() {
+			restore.stats.recordDocuments(dbName+"."+colName, atomic.LoadInt64(&documents),
+				atomic.LoadInt64(&bytes), atomic.LoadInt64(&failures), time.Since(start), err)
+		}()
+	}
 
 	session, err := restore.SessionProvider.GetSession()
 	if err != nil {
@@ -204,89 +608,227 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 
 	watchProgressor := progress.NewCounter(fileSize)
 	bar := &progress.Bar{
-		Name:      fmt.Sprintf("%v.%v", dbName, colName),
-		Watching:  watchProgressor,
-		BarLength: progressBarLength,
-		IsBytes:   true,
+		Name:        fmt.Sprintf("%v.%v", dbName, colName),
+		Watching:    watchProgressor,
+		BarLength:   progressBarLength,
+		IsBytes:     true,
+		ShowHistory: restore.showHistory,
 	}
 	restore.progressManager.Attach(bar)
 	defer restore.progressManager.Detach(bar)
 
-	maxInsertWorkers := restore.OutputOptions.NumInsertionWorkers
-	if restore.OutputOptions.MaintainInsertionOrder {
-		maxInsertWorkers = 1
-	}
-	docChan := make(chan bson.Raw, insertBufferFactor)
+	maxInsertWorkers, bufferSize := restore.insertionWorkers(maintainOrder)
+	docChan := make(chan numberedDoc, bufferSize)
 	resultChan := make(chan error, maxInsertWorkers)
 
+	// follows the documents through the workers for --stateFile
+	tracker := restore.checkpoint.tracker(dbName + "." + colName)
+
+	// documents of a mapped file are used in place, while others are
+	// copied out of the source's buffer
+	_, mapped := bsonSource.RawDocSource.(*db.MappedBSONSource)
+
+	// stop reading documents once a worker fails; the reader is waited for
+	// before returning, as the caller closing the source unmaps a mapped
+	// file, which the reader may otherwise still be reading from
+	stop := make(chan struct{})
+	readerDone := make(chan struct{})
 	go func() {
+		defer close(readerDone)
+		defer close(docChan)
 		doc := bson.Raw{}
 		for bsonSource.Next(&doc) {
-			rawBytes := make([]byte, len(doc.Data))
-			copy(rawBytes, doc.Data)
-			docChan <- bson.Raw{Data: rawBytes}
+			rawBytes := doc.Data
+			if !mapped {
+				rawBytes = make([]byte, len(doc.Data))
+				copy(rawBytes, doc.Data)
+			}
+			select {
+			case docChan <- numberedDoc{bson.Raw{Data: rawBytes}, tracker.read(len(rawBytes))}:
+			case <-stop:
+				return
+			}
 		}
-		close(docChan)
 	}()
 
-	log.Logf(log.DebugLow, "using %v insertion workers", maxInsertWorkers)
+	log.Logf(log.DebugLow, "restoring %v.%v using %v insertion workers", dbName, colName, maxInsertWorkers)
 
+	transform := restore.transformFor(dbName, colName)
+	verifyRecord := restore.verifier.record(dbName + "." + colName)
+
+	var workers sync.WaitGroup
 	for i := 0; i < maxInsertWorkers; i++ {
+		workers.Add(1)
 		go func() {
-			// get a session copy for each insert worker
-			s := session.Copy()
+			defer workers.Done()
+			// get a session for each insert worker
+			s, err := restore.insertionSession(session)
+			if err != nil {
+				resultChan <- fmt.Errorf("error establishing connection: %v", err)
+				return
+			}
 			defer s.Close()
 
 			coll := collection.With(s)
 			bulk := db.NewBufferedBulkInserter(
 				coll, restore.ToolOptions.BulkBufferSize, !restore.OutputOptions.StopOnError)
-			for rawDoc := range docChan {
+			if maintainOrder {
+				bulk.KeepOrder()
+			}
+			bulk.SetRetryPolicy(restore.retry)
+			bulk.SetMaxMessageSize(restore.serverLimits.MaxMessageSizeBytes)
+			// documents buffered for the next bulk insert, by number
+			var pending []int64
+			failed := false
+			// rejected hands a document that can't be restored to the
+			// --rejectFile, returning the reason if there is none
+			rejected := func(doc numberedDoc, reason error) error {
+				if err := restore.rejects.reject(collection.FullName, doc.raw.Data, reason); err != nil {
+					return err
+				}
+				tracker.done(doc.seq)
+				watchProgressor.Inc(int64(len(doc.raw.Data)))
+				return nil
+			}
+			for doc := range docChan {
+				rawDoc := doc.raw
 				if restore.objCheck {
 					err := bson.Unmarshal(rawDoc.Data, &bson.D{})
 					if err != nil {
-						resultChan <- fmt.Errorf("invalid object: %v", err)
+						if err = rejected(doc, fmt.Errorf("invalid object: %v", err)); err != nil {
+							resultChan <- err
+							return
+						}
+						continue
+					}
+				}
+				if transform != nil {
+					data, err := transform.Apply(rawDoc.Data)
+					if err != nil {
+						if err = rejected(doc, fmt.Errorf("error transforming document: %v", err)); err != nil {
+							resultChan <- err
+							return
+						}
+						continue
+					}
+					rawDoc = bson.Raw{Data: data}
+				}
+				data, err := restore.sizeGuard.Check(rawDoc.Data, collection.FullName)
+				if err != nil {
+					if err = rejected(doc, err); err != nil {
+						resultChan <- err
 						return
 					}
+					continue
+				}
+				if data == nil {
+					tracker.done(doc.seq)
+					watchProgressor.Inc(int64(len(rawDoc.Data)))
+					continue
+				}
+				rawDoc = bson.Raw{Data: data}
+				verifyRecord.add(rawDoc.Data)
+				restore.rateLimiter.wait(len(rawDoc.Data))
+				if restore.upsertWriter != nil {
+					err = restore.retry.Do("write to "+coll.FullName, func(attempt int) error {
+						if attempt > 1 {
+							s.Refresh()
+						}
+						return restore.upsertWriter.write(coll, rawDoc)
+					})
+				} else {
+					err = bulk.Insert(rawDoc)
 				}
-				if err := bulk.Insert(rawDoc); err != nil {
+				atomic.AddInt64(&documents, 1)
+				atomic.AddInt64(&bytes, int64(len(rawDoc.Data)))
+				if err != nil {
 					if db.IsConnectionError(err) || restore.OutputOptions.StopOnError {
 						// Propagate this error, since it's either a fatal connection error
 						// or the user has turned on --stopOnError
 						resultChan <- err
-					} else {
-						// Otherwise just log the error but don't propagate it.
-						log.Logf(log.Always, "error: %v", err)
+						failed = true
+					} else if restore.upsertWriter != nil && restore.rejects != nil {
+						// documents are written one at a time, so the one that
+						// failed can be rejected
+						atomic.AddInt64(&failures, 1)
+						if err = restore.rejects.reject(collection.FullName, doc.raw.Data, err); err != nil {
+							resultChan <- err
+							failed = true
+						}
+					} else if err = restore.insertFailed(collection.FullName, err, &failures); err != nil {
+						// Otherwise just log or reject the documents that
+						// failed, but don't propagate the error.
+						resultChan <- err
+						failed = true
 					}
 				}
 				watchProgressor.Inc(int64(len(rawDoc.Data)))
+				if restore.upsertWriter != nil {
+					if !failed {
+						tracker.done(doc.seq)
+					}
+					continue
+				}
+				// a single buffered document means the ones before it were
+				// just inserted
+				if !failed && bulk.Buffered() == 1 {
+					tracker.done(pending...)
+					pending = pending[:0]
+				}
+				pending = append(pending, doc.seq)
 			}
-			err := bulk.Flush()
+			err = bulk.Flush()
 			if err != nil {
 				if !db.IsConnectionError(err) && !restore.OutputOptions.StopOnError {
 					// Suppress this error since it's not a severe connection error and
 					// the user has not specified --stopOnError
-					log.Logf(log.Always, "error: %v", err)
-					err = nil
+					err = restore.insertFailed(collection.FullName, err, &failures)
 				}
 			}
+			if err == nil && !failed {
+				tracker.done(pending...)
+			}
 			resultChan <- err
 			return
 		}()
 
-		// sleep to prevent all threads from inserting at the same time at start
-		time.Sleep(time.Duration(i) * 10 * time.Millisecond)
+		// stagger the workers to prevent them all from inserting at the same
+		// time at start, without holding up the later ones for long
+		time.Sleep(10 * time.Millisecond)
 	}
 
-	// wait until all insert jobs finish
-	for done := 0; done < maxInsertWorkers; done++ {
-		err := <-resultChan
-		if err != nil {
-			return fmt.Errorf("insertion error: %v", err)
+	// wait until all insert jobs finish, even once one fails, as the others
+	// may still be using documents of a mapped file
+	go func() {
+		workers.Wait()
+		close(resultChan)
+	}()
+	var insertErr error
+	for err := range resultChan {
+		if err != nil && insertErr == nil {
+			insertErr = err
+			close(stop)
 		}
 	}
+	<-readerDone
+	if insertErr != nil {
+		return fmt.Errorf("insertion error: %v", insertErr)
+	}
 	// final error check
 	if err = bsonSource.Err(); err != nil {
 		return fmt.Errorf("reading bson input: %v", err)
 	}
 	return nil
 }
+
+// insertionWorkers returns the number of workers inserting the documents of
+// a collection, and the number of documents to buffer for them: enough for
+// every worker to keep filling its batch while the others are waiting on the
+// server.
+func (restore *MongoRestore) insertionWorkers(maintainOrder bool) (workers int, bufferSize int) {
+	workers = restore.OutputOptions.NumInsertionWorkers
+	if maintainOrder {
+		workers = 1
+	}
+	return workers, insertBufferFactor * workers
+}
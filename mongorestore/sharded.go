@@ -0,0 +1,354 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"sort"
+	"strings"
+)
+
+// configCollection is a sharded collection, as dumped from config.collections.
+type configCollection struct {
+	ID      string      `bson:"_id"`
+	Key     bson.D      `bson:"key"`
+	Unique  bool        `bson:"unique"`
+	Dropped bool        `bson:"dropped"`
+	UUID    bson.Binary `bson:"uuid"`
+}
+
+// configChunk is a chunk, as dumped from config.chunks. Chunks name their
+// collection by ns before MongoDB 5.0, and by uuid since.
+type configChunk struct {
+	NS    string      `bson:"ns"`
+	UUID  bson.Binary `bson:"uuid"`
+	Min   bson.D      `bson:"min"`
+	Max   bson.D      `bson:"max"`
+	Shard string      `bson:"shard"`
+}
+
+// configTag is a zone key range, as dumped from config.tags.
+type configTag struct {
+	NS  string `bson:"ns"`
+	Min bson.D `bson:"min"`
+	Max bson.D `bson:"max"`
+	Tag string `bson:"tag"`
+}
+
+// configShard is a shard, as dumped from config.shards.
+type configShard struct {
+	ID   string   `bson:"_id"`
+	Tags []string `bson:"tags"`
+}
+
+// shardedNamespace is what --sharded recreates for a collection: its shard
+// key, chunks and zone key ranges.
+type shardedNamespace struct {
+	collection configCollection
+	chunks     []configChunk
+	tags       []configTag
+}
+
+// shardingConfig is the sharding metadata of a dump's config database,
+// for --sharded.
+type shardingConfig struct {
+	namespaces map[string]*shardedNamespace
+	shards     []configShard
+
+	// shardMap maps the shards of the dump to the shards of the target
+	shardMap map[string]string
+}
+
+// readConfigCollection decodes each document of a collection of the config
+// database dump with decode. A collection missing from the dump is empty.
+func readConfigCollection(dir archive.DirLike, collection string, decode func(*db.DecodedBSONSource) bool) error {
+	entries, err := dir.ReadDir()
+	if err != nil {
+		return fmt.Errorf("error reading config database dump %v: %v", dir.Path(), err)
+	}
+	for _, entry := range entries {
+		if name, fileType := GetInfoFromFilename(entry.Name()); name != collection || fileType != BSONFileType {
+			continue
+		}
+		file, err := openDumpFile(entry.Path())
+		if err != nil {
+			return fmt.Errorf("error reading %v: %v", entry.Path(), err)
+		}
+		source := db.NewDecodedBSONSource(db.NewBSONSource(file))
+		defer source.Close()
+		for decode(source) {
+		}
+		if err = source.Err(); err != nil {
+			return fmt.Errorf("error reading %v: %v", entry.Path(), err)
+		}
+		return nil
+	}
+	log.Logf(log.Info, "no config.%v in %v", collection, dir.Path())
+	return nil
+}
+
+// readShardingConfig reads the sharded collections, chunks, zone key ranges
+// and shards of a config database dump. Namespaces are renamed to the
+// targets their collections are restored to, following --nsFrom, --nsTo and
+// --nsConflict.
+func readShardingConfig(dir archive.DirLike, renamer *nsRenamer) (*shardingConfig, error) {
+	config := &shardingConfig{namespaces: map[string]*shardedNamespace{}}
+	rename := func(namespace string) string {
+		if renamer == nil {
+			return namespace
+		}
+		return renamer.target(namespace)
+	}
+
+	byUUID := map[string]*shardedNamespace{}
+	err := readConfigCollection(dir, "collections", func(source *db.DecodedBSONSource) bool {
+		collection := configCollection{}
+		if !source.Next(&collection) {
+			return false
+		}
+		if !collection.Dropped && len(collection.Key) > 0 {
+			namespace := &shardedNamespace{collection: collection}
+			namespace.collection.ID = rename(collection.ID)
+			config.namespaces[namespace.collection.ID] = namespace
+			if len(collection.UUID.Data) > 0 {
+				byUUID[string(collection.UUID.Data)] = namespace
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readConfigCollection(dir, "chunks", func(source *db.DecodedBSONSource) bool {
+		chunk := configChunk{}
+		if !source.Next(&chunk) {
+			return false
+		}
+		namespace := config.namespaces[rename(chunk.NS)]
+		if chunk.NS == "" {
+			namespace = byUUID[string(chunk.UUID.Data)]
+		}
+		if namespace != nil {
+			namespace.chunks = append(namespace.chunks, chunk)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readConfigCollection(dir, "tags", func(source *db.DecodedBSONSource) bool {
+		tag := configTag{}
+		if !source.Next(&tag) {
+			return false
+		}
+		if namespace := config.namespaces[rename(tag.NS)]; namespace != nil {
+			namespace.tags = append(namespace.tags, tag)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readConfigCollection(dir, "shards", func(source *db.DecodedBSONSource) bool {
+		shard := configShard{}
+		if !source.Next(&shard) {
+			return false
+		}
+		config.shards = append(config.shards, shard)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// mapShards maps each shard of the dump to a shard of the target: to the
+// shard of the same name, if there is one, or else to the target's shards
+// in turn.
+func mapShards(dumpShards, targetShards []string) map[string]string {
+	shardMap := map[string]string{}
+	if len(targetShards) == 0 {
+		return shardMap
+	}
+	targets := map[string]bool{}
+	for _, shard := range targetShards {
+		targets[shard] = true
+	}
+	sorted := append([]string{}, targetShards...)
+	sort.Strings(sorted)
+	next := 0
+	for _, shard := range dumpShards {
+		if targets[shard] {
+			shardMap[shard] = shard
+			continue
+		}
+		shardMap[shard] = sorted[next%len(sorted)]
+		next++
+	}
+	return shardMap
+}
+
+// isMinBound returns true if every field of a chunk bound is MinKey, as in
+// the bound of the first chunk of a collection.
+func isMinBound(bound bson.D) bool {
+	for _, elem := range bound {
+		if elem.Value != bson.MinKey {
+			return false
+		}
+	}
+	return true
+}
+
+// splitPoints returns the bounds to split a collection at to recreate its
+// chunks: the lower bound of every chunk but the first.
+func splitPoints(chunks []configChunk) []bson.D {
+	points := []bson.D{}
+	for _, chunk := range chunks {
+		if !isMinBound(chunk.Min) {
+			points = append(points, chunk.Min)
+		}
+	}
+	return points
+}
+
+// tolerable returns true for errors from sharding commands that mean the
+// command's work was already done, such as by an earlier restore.
+func tolerable(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "already") || strings.Contains(message, "boundary")
+}
+
+// loadShardingConfig reads the sharding metadata to recreate, from the
+// --shardingConfig directory or the dump's config database, and maps the
+// dump's shards to the target's, assigning them the dump's zones.
+func (restore *MongoRestore) loadShardingConfig() error {
+	dir := restore.configDir
+	if restore.OutputOptions.ShardingConfig != "" {
+		configPath, err := newActualPath(restore.OutputOptions.ShardingConfig)
+		if err != nil {
+			return fmt.Errorf("error reading --shardingConfig: %v", err)
+		}
+		if !configPath.IsDir() {
+			return fmt.Errorf("--shardingConfig %v is not a directory", configPath.Path())
+		}
+		dir = configPath
+	}
+	if dir == nil {
+		return fmt.Errorf("--sharded requires the dump's config database, or a --shardingConfig directory holding it")
+	}
+	var err error
+	restore.sharding, err = readShardingConfig(dir, restore.renamer)
+	if err != nil {
+		return err
+	}
+
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	result := struct {
+		Shards []configShard `bson:"shards"`
+	}{}
+	if err = session.DB("admin").Run(bson.D{{"listShards", 1}}, &result); err != nil {
+		return fmt.Errorf("error listing shards: %v", err)
+	}
+	targetShards := make([]string, len(result.Shards))
+	for i, shard := range result.Shards {
+		targetShards[i] = shard.ID
+	}
+	dumpShards := make([]string, len(restore.sharding.shards))
+	for i, shard := range restore.sharding.shards {
+		dumpShards[i] = shard.ID
+	}
+	restore.sharding.shardMap = mapShards(dumpShards, targetShards)
+	for _, shard := range restore.sharding.shards {
+		target := restore.sharding.shardMap[shard.ID]
+		if target != shard.ID {
+			log.Logf(log.Always, "restoring the chunks of shard %v to shard %v", shard.ID, target)
+		}
+		for _, zone := range shard.Tags {
+			command := bson.D{{"addShardToZone", target}, {"zone", zone}}
+			if err = session.DB("admin").Run(command, &bson.M{}); err != nil {
+				return fmt.Errorf("error adding shard %v to zone %v: %v", target, zone, err)
+			}
+		}
+	}
+	log.Logf(log.Always, "recreating %v sharded collections across %v shards",
+		len(restore.sharding.namespaces), len(targetShards))
+	return nil
+}
+
+// ShardCollection recreates the sharding of a collection before its
+// documents are restored, with --sharded: it shards the collection by its
+// shard key, splits it into the dump's chunks, moves each chunk to the
+// shard it was on, and restores its zone key ranges, so that every
+// document inserted through mongos is written to its final shard rather
+// than migrated there afterwards.
+func (restore *MongoRestore) ShardCollection(intent *intents.Intent) error {
+	if restore.sharding == nil {
+		return nil
+	}
+	namespace := restore.sharding.namespaces[intent.Namespace()]
+	if namespace == nil {
+		return nil
+	}
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	admin := session.DB("admin")
+	ns := intent.Namespace()
+
+	run := func(command bson.D) error {
+		err := admin.Run(command, &bson.M{})
+		if err != nil && tolerable(err) {
+			log.Logf(log.DebugLow, "%v on %v: %v", command[0].Name, ns, err)
+			return nil
+		}
+		return err
+	}
+
+	log.Logf(log.Info, "sharding %v by %v into %v chunks", ns, namespace.collection.Key, len(namespace.chunks))
+	if err = run(bson.D{{"enableSharding", intent.DB}}); err != nil {
+		return fmt.Errorf("error enabling sharding on %v: %v", intent.DB, err)
+	}
+	command := bson.D{{"shardCollection", ns}, {"key", namespace.collection.Key}}
+	if namespace.collection.Unique {
+		command = append(command, bson.DocElem{"unique", true})
+	}
+	if err = run(command); err != nil {
+		return fmt.Errorf("error sharding %v: %v", ns, err)
+	}
+
+	for _, point := range splitPoints(namespace.chunks) {
+		if err = run(bson.D{{"split", ns}, {"middle", point}}); err != nil {
+			return fmt.Errorf("error splitting %v at %v: %v", ns, point, err)
+		}
+	}
+	for _, chunk := range namespace.chunks {
+		target, ok := restore.sharding.shardMap[chunk.Shard]
+		if !ok {
+			continue
+		}
+		err = run(bson.D{{"moveChunk", ns}, {"bounds", []bson.D{chunk.Min, chunk.Max}}, {"to", target}})
+		if err != nil {
+			return fmt.Errorf("error moving chunk %v of %v to shard %v: %v", chunk.Min, ns, target, err)
+		}
+	}
+	for _, tag := range namespace.tags {
+		err = run(bson.D{{"updateZoneKeyRange", ns}, {"min", tag.Min}, {"max", tag.Max}, {"zone", tag.Tag}})
+		if err != nil {
+			return fmt.Errorf("error restoring zone %v of %v: %v", tag.Tag, ns, err)
+		}
+	}
+	return nil
+}
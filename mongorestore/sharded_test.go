@@ -0,0 +1,113 @@
+package mongorestore
+
+import (
+	"bytes"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfigCollection writes documents to a .bson file of a config
+// database dump.
+func writeConfigCollection(dir, collection string, docs ...interface{}) error {
+	out := &bytes.Buffer{}
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		out.Write(data)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, collection+".bson"), out.Bytes(), 0644)
+}
+
+func TestShardingConfig(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a dump of a config database", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_sharded")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+
+		uuid := bson.Binary{Kind: 0x04, Data: []byte("0123456789abcdef")}
+		So(writeConfigCollection(dir, "collections",
+			bson.D{{"_id", "shop.orders"}, {"key", bson.D{{"customer", 1}}}, {"uuid", uuid}},
+			bson.D{{"_id", "shop.old"}, {"key", bson.D{{"_id", 1}}}, {"dropped", true}},
+			bson.D{{"_id", "logs.events"}, {"key", bson.D{{"_id", "hashed"}}}, {"unique", false}},
+		), ShouldBeNil)
+		So(writeConfigCollection(dir, "chunks",
+			bson.D{{"uuid", uuid}, {"min", bson.D{{"customer", bson.MinKey}}}, {"max", bson.D{{"customer", 100}}}, {"shard", "rs0"}},
+			bson.D{{"uuid", uuid}, {"min", bson.D{{"customer", 100}}}, {"max", bson.D{{"customer", bson.MaxKey}}}, {"shard", "rs1"}},
+			bson.D{{"ns", "logs.events"}, {"min", bson.D{{"_id", bson.MinKey}}}, {"max", bson.D{{"_id", bson.MaxKey}}}, {"shard", "rs1"}},
+		), ShouldBeNil)
+		So(writeConfigCollection(dir, "tags",
+			bson.D{{"ns", "shop.orders"}, {"min", bson.D{{"customer", 100}}}, {"max", bson.D{{"customer", 200}}}, {"tag", "eu"}},
+		), ShouldBeNil)
+		So(writeConfigCollection(dir, "shards",
+			bson.D{{"_id", "rs0"}, {"host", "rs0/a:27018"}},
+			bson.D{{"_id", "rs1"}, {"host", "rs1/b:27018"}, {"tags", []string{"eu"}}},
+		), ShouldBeNil)
+		configDir, err := newActualPath(dir)
+		So(err, ShouldBeNil)
+
+		Convey("its sharded collections, chunks, zones and shards should be read", func() {
+			config, err := readShardingConfig(configDir, nil)
+			So(err, ShouldBeNil)
+			So(len(config.namespaces), ShouldEqual, 2)
+
+			orders := config.namespaces["shop.orders"]
+			So(orders, ShouldNotBeNil)
+			So(len(orders.chunks), ShouldEqual, 2)
+			So(len(orders.tags), ShouldEqual, 1)
+			So(splitPoints(orders.chunks), ShouldResemble, []bson.D{{{"customer", 100}}})
+
+			events := config.namespaces["logs.events"]
+			So(events, ShouldNotBeNil)
+			So(len(events.chunks), ShouldEqual, 1)
+			So(splitPoints(events.chunks), ShouldBeEmpty)
+
+			So(len(config.shards), ShouldEqual, 2)
+			So(config.shards[1].Tags, ShouldResemble, []string{"eu"})
+		})
+
+		Convey("renamed collections should be read under their new namespace", func() {
+			renamer, err := newNSRenamer([]string{"shop.*"}, []string{"store.*"})
+			So(err, ShouldBeNil)
+			config, err := readShardingConfig(configDir, renamer)
+			So(err, ShouldBeNil)
+			So(config.namespaces["store.orders"], ShouldNotBeNil)
+			So(len(config.namespaces["store.orders"].tags), ShouldEqual, 1)
+		})
+
+		Convey("a collection suffixed by --nsConflict should be read under its suffixed target", func() {
+			renamer, err := newNSRenamer([]string{"shop.orders", "logs.events"}, []string{"all.orders", "all.orders"})
+			So(err, ShouldBeNil)
+			renamer.conflict = nsConflictSuffix
+			restore := &MongoRestore{renamer: renamer}
+			So(restore.renameIntent(&intents.Intent{DB: "shop", C: "orders"}), ShouldBeNil)
+			So(restore.renameIntent(&intents.Intent{DB: "logs", C: "events"}), ShouldBeNil)
+			config, err := readShardingConfig(configDir, renamer)
+			So(err, ShouldBeNil)
+			So(len(config.namespaces["all.orders"].chunks), ShouldEqual, 2)
+			So(len(config.namespaces["all.orders_2"].chunks), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Shards of the dump should map to the target's", t, func() {
+		Convey("by name, when the target has shards of the same names", func() {
+			shardMap := mapShards([]string{"rs0", "rs1"}, []string{"rs1", "rs0"})
+			So(shardMap, ShouldResemble, map[string]string{"rs0": "rs0", "rs1": "rs1"})
+		})
+
+		Convey("or else in turn", func() {
+			shardMap := mapShards([]string{"a", "b", "c"}, []string{"y", "x"})
+			So(shardMap, ShouldResemble, map[string]string{"a": "x", "b": "y", "c": "x"})
+		})
+	})
+}
@@ -0,0 +1,141 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+)
+
+// smokeTest is a query run after the restore, with the number of documents
+// it is expected to match.
+type smokeTest struct {
+	Namespace string
+	Filter    bson.M
+	Count     int64
+}
+
+// loadSmokeTests reads the --smokeTests file: a sequence of extended JSON
+// documents such as {ns: "db.users", filter: {active: true}, count: 1200}.
+// The filter is optional and matches every document when left out.
+func loadSmokeTests(reader io.Reader) ([]smokeTest, error) {
+	decoder := json.NewDecoder(reader)
+	var tests []smokeTest
+	for {
+		var asJSON interface{}
+		err := decoder.Decode(&asJSON)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing smoke test %v: %v", len(tests)+1, err)
+		}
+		test, err := newSmokeTest(asJSON)
+		if err != nil {
+			return nil, fmt.Errorf("invalid smoke test %v: %v", len(tests)+1, err)
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+func newSmokeTest(asJSON interface{}) (smokeTest, error) {
+	test := smokeTest{}
+	converted, err := bsonutil.ConvertJSONValueToBSON(asJSON)
+	if err != nil {
+		return test, err
+	}
+	doc, ok := converted.(map[string]interface{})
+	if !ok {
+		return test, fmt.Errorf("expected a document")
+	}
+	for key := range doc {
+		if key != "ns" && key != "filter" && key != "count" {
+			return test, fmt.Errorf("unknown field '%v'", key)
+		}
+	}
+
+	if test.Namespace, ok = doc["ns"].(string); !ok {
+		return test, fmt.Errorf("'ns' must be a string")
+	}
+	if err = util.ValidateFullNamespace(test.Namespace); err != nil {
+		return test, err
+	}
+	if filter, present := doc["filter"]; present {
+		asMap, ok := filter.(map[string]interface{})
+		if !ok {
+			return test, fmt.Errorf("'filter' must be a document")
+		}
+		test.Filter = bson.M(asMap)
+	}
+	count, err := util.ToInt(doc["count"])
+	if err != nil || count < 0 {
+		return test, fmt.Errorf("'count' must be a non-negative number")
+	}
+	test.Count = int64(count)
+	return test, nil
+}
+
+// readSmokeTests loads the tests from the --smokeTests file.
+func readSmokeTests(path string) ([]smokeTest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening smoke tests: %v", err)
+	}
+	defer file.Close()
+	return loadSmokeTests(file)
+}
+
+// RunSmokeTests runs each smoke test against the restored data, failing if
+// any of them matches a different number of documents than expected.
+func (restore *MongoRestore) RunSmokeTests() error {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	failed := 0
+	for _, test := range restore.smokeTests {
+		db, collection, err := util.SplitAndValidateNamespace(test.Namespace)
+		if err != nil {
+			return err
+		}
+		count, err := session.DB(db).C(collection).Find(test.Filter).Count()
+		if err != nil {
+			return fmt.Errorf("error running smoke test on %v: %v", test.Namespace, err)
+		}
+		if int64(count) != test.Count {
+			failed++
+			log.Logf(log.Always, "smoke test failed: %v with filter %v matched %v documents, expected %v",
+				test.Namespace, formatFilter(test.Filter), count, test.Count)
+		} else {
+			log.Logf(log.Info, "smoke test passed: %v with filter %v matched %v documents",
+				test.Namespace, formatFilter(test.Filter), count)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v smoke tests failed", failed, len(restore.smokeTests))
+	}
+	log.Logf(log.Always, "all %v smoke tests passed", len(restore.smokeTests))
+	return nil
+}
+
+func formatFilter(filter bson.M) string {
+	if filter == nil {
+		return "{}"
+	}
+	out, err := bsonutil.ConvertBSONValueToJSON(filter)
+	if err != nil {
+		return fmt.Sprintf("%v", filter)
+	}
+	formatted, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Sprintf("%v", filter)
+	}
+	return string(formatted)
+}
@@ -0,0 +1,45 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+func TestLoadSmokeTests(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a file of smoke tests", t, func() {
+
+		Convey("each document should become a test", func() {
+			tests, err := loadSmokeTests(strings.NewReader(`
+				{ns: "db.users", filter: {active: true}, count: 1200}
+				{ns: "db.orders", count: 0}`))
+			So(err, ShouldBeNil)
+			So(len(tests), ShouldEqual, 2)
+			So(tests[0], ShouldResemble, smokeTest{
+				Namespace: "db.users",
+				Filter:    bson.M{"active": true},
+				Count:     1200,
+			})
+			So(tests[1].Filter, ShouldBeNil)
+			So(tests[1].Count, ShouldEqual, 0)
+		})
+
+		Convey("invalid tests should be reported with their position", func() {
+			_, err := loadSmokeTests(strings.NewReader(`{ns: "db.users", count: 1} {ns: "db.users"}`))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid smoke test 2")
+
+			_, err = loadSmokeTests(strings.NewReader(`{ns: "db.users", count: 1, limit: 5}`))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown field 'limit'")
+
+			_, err = loadSmokeTests(strings.NewReader(`{ns: ".users", count: 1}`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
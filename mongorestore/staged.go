@@ -0,0 +1,162 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// stagedPrefix starts the names of the collections that --staged restores
+// into before renaming them over their targets.
+const stagedPrefix = "mongorestore_staged."
+
+// stagedCollection is a collection restored into a staging collection of
+// the same database.
+type stagedCollection struct {
+	db     string
+	staged string
+	target string
+}
+
+// stager keeps track of the collections restored into staging collections,
+// for --staged. A nil stager stages nothing.
+type stager struct {
+	mutex       sync.Mutex
+	collections []stagedCollection
+}
+
+// add records a staged collection.
+func (stgr *stager) add(collection stagedCollection) {
+	stgr.mutex.Lock()
+	defer stgr.mutex.Unlock()
+	stgr.collections = append(stgr.collections, collection)
+}
+
+// target returns the namespace a namespace is restored to: the target of a
+// staging collection, or the namespace itself.
+func (stgr *stager) target(namespace string) string {
+	if stgr == nil {
+		return namespace
+	}
+	stgr.mutex.Lock()
+	defer stgr.mutex.Unlock()
+	for _, collection := range stgr.collections {
+		if namespace == collection.db+"."+collection.staged {
+			return collection.db + "." + collection.target
+		}
+	}
+	return namespace
+}
+
+// stagedName returns the name of the staging collection for a collection.
+func stagedName(colName string) string {
+	return stagedPrefix + colName
+}
+
+// metadataKind returns the kind of collection the intent's metadata
+// creates, reading it ahead of the restore.
+func (restore *MongoRestore) metadataKind(intent *intents.Intent) (string, error) {
+	if intent.MetadataPath == "" {
+		return collectionRegular, nil
+	}
+	if err := intent.MetadataFile.Open(); err != nil {
+		return "", err
+	}
+	defer intent.MetadataFile.Close()
+	metadata, err := ioutil.ReadAll(intent.MetadataFile)
+	if err != nil {
+		return "", fmt.Errorf("error reading metadata file %v: %v", intent.MetadataPath, err)
+	}
+	options, _, err := restore.MetadataFromJSON(metadata)
+	if err != nil {
+		return "", fmt.Errorf("error parsing metadata file %v: %v", intent.MetadataPath, err)
+	}
+	return collectionKind(options), nil
+}
+
+// stageIntent returns the intent to restore in place of the given one: with
+// --staged, a copy pointing at a staging collection, which still reads the
+// original's files. Special and system collections are restored in place,
+// and so are time-series collections and views, which can't be renamed.
+func (restore *MongoRestore) stageIntent(intent *intents.Intent) (*intents.Intent, error) {
+	if restore.stager == nil || intent.IsSpecialCollection() || intent.IsOplog() ||
+		strings.HasPrefix(intent.C, "system.") || strings.HasPrefix(intent.C, "$") {
+		return intent, nil
+	}
+	kind, err := restore.metadataKind(intent)
+	if err != nil {
+		return nil, err
+	}
+	if kind == collectionTimeSeries {
+		log.Logf(log.Always, "warning: restoring %v in place rather than staged, as time-series collections "+
+			"can't be renamed", intent.Namespace())
+		return intent, nil
+	}
+	if kind == collectionView {
+		log.Logf(log.Always, "warning: restoring %v in place rather than staged, as views can't be renamed",
+			intent.Namespace())
+		return intent, nil
+	}
+	staged := *intent
+	staged.C = stagedName(intent.C)
+	restore.stager.add(stagedCollection{db: intent.DB, staged: staged.C, target: intent.C})
+	log.Logf(log.Info, "restoring %v into the staging collection %v", intent.Namespace(), staged.Namespace())
+	return &staged, nil
+}
+
+// SwapStagedCollections renames each staging collection over its target,
+// replacing the target collection. Each collection is replaced atomically,
+// but not all of them at once.
+func (restore *MongoRestore) SwapStagedCollections() error {
+	if restore.stager == nil || len(restore.stager.collections) == 0 {
+		return nil
+	}
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+
+	log.Logf(log.Always, "replacing %v collections with their staged restores", len(restore.stager.collections))
+	for _, collection := range restore.stager.collections {
+		from := collection.db + "." + collection.staged
+		to := collection.db + "." + collection.target
+		log.Logf(log.Info, "renaming %v to %v", from, to)
+		command := bson.D{{"renameCollection", from}, {"to", to}, {"dropTarget", true}}
+		if err = session.DB("admin").Run(command, &bson.M{}); err != nil {
+			return fmt.Errorf("error renaming staged collection %v to %v: %v", from, to, err)
+		}
+		if err = restore.notifyReady(from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropStagedCollections drops the staging collections after a failed
+// restore, leaving the target collections as they were.
+func (restore *MongoRestore) DropStagedCollections() {
+	if restore.stager == nil || len(restore.stager.collections) == 0 {
+		return
+	}
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		log.Logf(log.Always, "error establishing connection to drop staged collections: %v", err)
+		return
+	}
+	defer session.Close()
+
+	log.Logf(log.Always, "restore failed; dropping %v staged collections, leaving their targets untouched",
+		len(restore.stager.collections))
+	for _, collection := range restore.stager.collections {
+		restore.ttlHolder.forget(collection.db, collection.staged)
+		err = session.DB(collection.db).C(collection.staged).DropCollection()
+		if err != nil && !strings.Contains(err.Error(), "ns not found") {
+			log.Logf(log.Always, "error dropping staged collection %v.%v: %v", collection.db, collection.staged, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStageIntent(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --staged", t, func() {
+		restore := &MongoRestore{stager: &stager{}}
+
+		Convey("a regular collection should be restored into a staging collection", func() {
+			intent := &intents.Intent{DB: "db", C: "users", BSONPath: "db/users.bson"}
+			staged, err := restore.stageIntent(intent)
+			So(err, ShouldBeNil)
+			So(staged.DB, ShouldEqual, "db")
+			So(staged.C, ShouldEqual, stagedPrefix+"users")
+			So(staged.BSONPath, ShouldEqual, intent.BSONPath)
+			So(intent.C, ShouldEqual, "users")
+
+			Convey("whose target should be the original namespace", func() {
+				So(restore.stager.target(staged.Namespace()), ShouldEqual, "db.users")
+				So(restore.stager.target("db.other"), ShouldEqual, "db.other")
+			})
+		})
+
+		Convey("special and system collections should be restored in place", func() {
+			for _, intent := range []*intents.Intent{
+				{DB: "admin", C: "system.users"},
+				{DB: "db", C: "system.js"},
+				{C: "oplog"},
+			} {
+				staged, err := restore.stageIntent(intent)
+				So(err, ShouldBeNil)
+				So(staged, ShouldEqual, intent)
+			}
+			So(restore.stager.collections, ShouldBeEmpty)
+		})
+
+		Convey("time-series collections should be restored in place", func() {
+			dir, err := ioutil.TempDir("", "mongorestore_staged")
+			So(err, ShouldBeNil)
+			Reset(func() { os.RemoveAll(dir) })
+			path := filepath.Join(dir, "weather.metadata.json")
+			metadata := `{"options": {"timeseries": {"timeField": "ts"}}, "indexes": []}`
+			So(ioutil.WriteFile(path, []byte(metadata), 0644), ShouldBeNil)
+
+			intent := &intents.Intent{DB: "db", C: "weather", MetadataPath: path}
+			intent.MetadataFile = &realMetadataFile{intent: intent}
+			staged, err := restore.stageIntent(intent)
+			So(err, ShouldBeNil)
+			So(staged, ShouldEqual, intent)
+		})
+	})
+
+	Convey("Without --staged, every collection should be restored in place", t, func() {
+		restore := &MongoRestore{}
+		intent := &intents.Intent{DB: "db", C: "users"}
+		staged, err := restore.stageIntent(intent)
+		So(err, ShouldBeNil)
+		So(staged, ShouldEqual, intent)
+		So(restore.stager.target("db.users"), ShouldEqual, "db.users")
+	})
+}
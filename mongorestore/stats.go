@@ -0,0 +1,156 @@
+package mongorestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// collectionStats describes how restoring a single collection went.
+type collectionStats struct {
+	Namespace string `json:"ns"`
+
+	// Documents and Bytes count the documents sent to the server; Failures
+	// counts the write errors skipped without --stopOnError, each failing
+	// one or more of them
+	Documents int64   `json:"documents"`
+	Bytes     int64   `json:"bytes"`
+	Failures  int64   `json:"failures"`
+	Seconds   float64 `json:"seconds"`
+
+	Indexes      int     `json:"indexes"`
+	IndexSeconds float64 `json:"indexSeconds"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// restoreStats is the summary of a whole mongorestore run, written to
+// --statsFile.
+type restoreStats struct {
+	OK           bool              `json:"ok"`
+	Error        string            `json:"error,omitempty"`
+	Start        time.Time         `json:"start"`
+	Seconds      float64           `json:"seconds"`
+	Documents    int64             `json:"documents"`
+	Bytes        int64             `json:"bytes"`
+	BytesPerSec  float64           `json:"bytesPerSec"`
+	Failures     int64             `json:"failures"`
+	IndexSeconds float64           `json:"indexSeconds"`
+	Collections  []collectionStats `json:"collections"`
+}
+
+// statsCollector gathers per-collection statistics from concurrent restore
+// routines.
+type statsCollector struct {
+	sync.Mutex
+	start       time.Time
+	collections map[string]*collectionStats
+}
+
+// collection returns the statistics of the namespace, adding them if they
+// aren't recorded yet. The caller holds the lock.
+func (collector *statsCollector) collection(namespace string) *collectionStats {
+	if collector.collections == nil {
+		collector.collections = map[string]*collectionStats{}
+	}
+	stats, ok := collector.collections[namespace]
+	if !ok {
+		stats = &collectionStats{Namespace: namespace}
+		collector.collections[namespace] = stats
+	}
+	return stats
+}
+
+// recordDocuments adds the documents restored into a collection.
+func (collector *statsCollector) recordDocuments(namespace string, documents, bytes, failures int64,
+	duration time.Duration, err error) {
+	collector.Lock()
+	defer collector.Unlock()
+	stats := collector.collection(namespace)
+	stats.Documents += documents
+	stats.Bytes += bytes
+	stats.Failures += failures
+	stats.Seconds += duration.Seconds()
+	if err != nil {
+		stats.Error = err.Error()
+	}
+}
+
+// recordIndexes adds the indexes built on a collection.
+func (collector *statsCollector) recordIndexes(namespace string, indexes int, duration time.Duration, err error) {
+	collector.Lock()
+	defer collector.Unlock()
+	stats := collector.collection(namespace)
+	stats.Indexes += indexes
+	stats.IndexSeconds += duration.Seconds()
+	if err != nil {
+		stats.Error = err.Error()
+	}
+}
+
+// snapshot returns the statistics recorded so far for the namespace.
+func (collector *statsCollector) snapshot(namespace string) collectionStats {
+	collector.Lock()
+	defer collector.Unlock()
+	if stats, ok := collector.collections[namespace]; ok {
+		return *stats
+	}
+	return collectionStats{Namespace: namespace}
+}
+
+// summarize totals the recorded statistics, with collections listed in
+// namespace order, for a run that ended with err.
+func (collector *statsCollector) summarize(err error) restoreStats {
+	collector.Lock()
+	defer collector.Unlock()
+	summary := restoreStats{
+		OK:          err == nil,
+		Start:       collector.start,
+		Seconds:     time.Since(collector.start).Seconds(),
+		Collections: []collectionStats{},
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	for _, stats := range collector.collections {
+		summary.Collections = append(summary.Collections, *stats)
+		summary.Documents += stats.Documents
+		summary.Bytes += stats.Bytes
+		summary.Failures += stats.Failures
+		summary.IndexSeconds += stats.IndexSeconds
+	}
+	sort.Sort(byNamespace(summary.Collections))
+	if summary.Seconds > 0 {
+		summary.BytesPerSec = float64(summary.Bytes) / summary.Seconds
+	}
+	return summary
+}
+
+// writeStats writes the summary of a run that ended with err as JSON to
+// the --statsFile, if one was given.
+func (restore *MongoRestore) writeStats(err error) error {
+	if restore.OutputOptions == nil || restore.OutputOptions.StatsFile == "" {
+		return nil
+	}
+	summary := restore.stats.summarize(err)
+	statsJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding restore statistics: %v", err)
+	}
+	if err = ioutil.WriteFile(restore.OutputOptions.StatsFile, append(statsJSON, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing --statsFile: %v", err)
+	}
+	log.Logf(log.Info, "wrote restore statistics to %v", restore.OutputOptions.StatsFile)
+	return nil
+}
+
+// byNamespace sorts collection statistics by namespace.
+type byNamespace []collectionStats
+
+func (s byNamespace) Len() int           { return len(s) }
+func (s byNamespace) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byNamespace) Less(i, j int) bool { return s[i].Namespace < s[j].Namespace }
@@ -0,0 +1,64 @@
+package mongorestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRestoreStats(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With statistics recorded for two collections", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		restore.stats.start = time.Now().Add(-2 * time.Second)
+		restore.stats.recordDocuments("db.b", 10, 1000, 0, time.Second, nil)
+		restore.stats.recordDocuments("db.a", 5, 500, 2, time.Second, nil)
+		restore.stats.recordIndexes("db.a", 3, 500*time.Millisecond, nil)
+		restore.stats.recordIndexes("db.b", 1, time.Second, fmt.Errorf("index build failed"))
+
+		Convey("the summary should total the collections in namespace order", func() {
+			summary := restore.stats.summarize(nil)
+			So(summary.OK, ShouldBeTrue)
+			So(summary.Documents, ShouldEqual, 15)
+			So(summary.Bytes, ShouldEqual, 1500)
+			So(summary.Failures, ShouldEqual, 2)
+			So(summary.IndexSeconds, ShouldEqual, 1.5)
+			So(summary.BytesPerSec, ShouldBeGreaterThan, 0)
+			So(len(summary.Collections), ShouldEqual, 2)
+			So(summary.Collections[0].Namespace, ShouldEqual, "db.a")
+			So(summary.Collections[0].Indexes, ShouldEqual, 3)
+			So(summary.Collections[1].Error, ShouldEqual, "index build failed")
+		})
+
+		Convey("a failed run should be reported with its error", func() {
+			summary := restore.stats.summarize(fmt.Errorf("restore error: insertion error"))
+			So(summary.OK, ShouldBeFalse)
+			So(summary.Error, ShouldEqual, "restore error: insertion error")
+		})
+
+		Convey("the summary should be written to the --statsFile as JSON", func() {
+			statsFile, err := ioutil.TempFile("", "mongorestore_stats")
+			So(err, ShouldBeNil)
+			So(statsFile.Close(), ShouldBeNil)
+			defer os.Remove(statsFile.Name())
+
+			restore.OutputOptions.StatsFile = statsFile.Name()
+			So(restore.writeStats(nil), ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(statsFile.Name())
+			So(err, ShouldBeNil)
+			summary := restoreStats{}
+			So(json.Unmarshal(contents, &summary), ShouldBeNil)
+			So(summary.OK, ShouldBeTrue)
+			So(summary.Documents, ShouldEqual, 15)
+			So(len(summary.Collections), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,333 @@
+package mongorestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Operations accepted by --transform.
+const (
+	transformDrop   = "drop"
+	transformRename = "rename"
+	transformSet    = "set"
+	transformHash   = "hash"
+
+	// transformFixNames renames broken field names, with --fixBrokenFieldNames
+	transformFixNames = "fixNames"
+)
+
+// transformOp is a single --transform statement applied to each restored
+// document. Paths are dot-delimited and descend into embedded documents.
+type transformOp struct {
+	op    string
+	path  []string
+	to    []string
+	value interface{}
+	salt  string
+}
+
+// omitIDTransform drops the dumped _id of each document restored with
+// --omitId, so that the server generates a new one.
+var omitIDTransform = transformOp{op: transformDrop, path: []string{"_id"}}
+
+// fixFieldNamesTransform renames the fields of each restored document whose
+// names servers reject, with --fixBrokenFieldNames: each dot, and a leading
+// dollar sign, is replaced with the replacement.
+func fixFieldNamesTransform(replacement string) transformOp {
+	return transformOp{op: transformFixNames, value: replacement}
+}
+
+// documentTransform is the list of --transform statements, applied in order.
+type documentTransform []transformOp
+
+// parseTransforms parses the --transform statements. Each is one of:
+//
+//	drop <field>              removes the field
+//	rename <field> <newField> moves the field's value to newField
+//	set <field> <value>       sets the field to an extended JSON value, adding it if missing
+//	hash <field> [<salt>]     replaces the field's value with the hex SHA-256 of the salt and value
+func parseTransforms(statements []string) (documentTransform, error) {
+	transform := documentTransform{}
+	for _, statement := range statements {
+		op, err := parseTransform(statement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform '%v': %v", statement, err)
+		}
+		transform = append(transform, op)
+	}
+	return transform, nil
+}
+
+func parseTransform(statement string) (transformOp, error) {
+	op := transformOp{}
+	fields := strings.Fields(statement)
+	if len(fields) < 2 {
+		return op, fmt.Errorf("expected an operation and a field")
+	}
+	op.op = fields[0]
+	if op.path = splitFieldPath(fields[1]); op.path == nil {
+		return op, fmt.Errorf("invalid field '%v'", fields[1])
+	}
+
+	switch op.op {
+	case transformDrop:
+		if len(fields) != 2 {
+			return op, fmt.Errorf("drop takes a single field")
+		}
+	case transformRename:
+		if len(fields) != 3 {
+			return op, fmt.Errorf("rename takes a field and its new name")
+		}
+		if op.to = splitFieldPath(fields[2]); op.to == nil {
+			return op, fmt.Errorf("invalid field '%v'", fields[2])
+		}
+	case transformSet:
+		// the value is everything after the field, so it may contain spaces
+		rest := strings.TrimSpace(statement)
+		rest = strings.TrimSpace(rest[len(fields[0]):])
+		rest = strings.TrimSpace(rest[len(fields[1]):])
+		if rest == "" {
+			return op, fmt.Errorf("set takes a field and a value")
+		}
+		var asJSON interface{}
+		if err := json.Unmarshal([]byte(rest), &asJSON); err != nil {
+			return op, fmt.Errorf("error parsing value as json: %v", err)
+		}
+		value, err := bsonutil.ConvertJSONValueToBSON(asJSON)
+		if err != nil {
+			return op, fmt.Errorf("error converting value to bson: %v", err)
+		}
+		op.value = value
+	case transformHash:
+		if len(fields) > 3 {
+			return op, fmt.Errorf("hash takes a field and an optional salt")
+		}
+		if len(fields) == 3 {
+			op.salt = fields[2]
+		}
+	default:
+		return op, fmt.Errorf("unknown operation '%v', expected drop, rename, set or hash", op.op)
+	}
+	return op, nil
+}
+
+// splitFieldPath splits a dot-delimited field path, returning nil if any
+// part of it is empty.
+func splitFieldPath(field string) []string {
+	path := strings.Split(field, ".")
+	for _, part := range path {
+		if part == "" {
+			return nil
+		}
+	}
+	return path
+}
+
+// transformFor returns the transformation to apply to the documents restored
+// to the collection. For the temporary collections users and roles are
+// restored through, that's the renaming of their databases by --nsFrom and
+// --nsTo; for other collections except system ones, it's the --transform
+// statements. It returns nil if there is none.
+func (restore *MongoRestore) transformFor(dbName, colName string) documentTransformer {
+	if dbName == "admin" && (colName == restore.tempUsersCol || colName == restore.tempRolesCol) {
+		if restore.renamer == nil {
+			return nil
+		}
+		return &authRenamer{restore.renamer}
+	}
+	if len(restore.transform) == 0 || strings.HasPrefix(colName, "system.") {
+		return nil
+	}
+	return restore.transform
+}
+
+// Apply transforms the BSON document, returning the transformed document.
+func (transform documentTransform) Apply(raw []byte) ([]byte, error) {
+	doc := bson.D{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	for _, op := range transform {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, err
+		}
+	}
+	return bson.Marshal(doc)
+}
+
+func (op transformOp) apply(doc bson.D) (bson.D, error) {
+	switch op.op {
+	case transformDrop:
+		doc, _, _ = removeField(doc, op.path)
+	case transformRename:
+		doc, value, found := removeField(doc, op.path)
+		if found {
+			return setField(doc, op.to, value)
+		}
+		return doc, nil
+	case transformSet:
+		return setField(doc, op.path, op.value)
+	case transformFixNames:
+		return fixFieldNames(doc, op.value.(string))
+	case transformHash:
+		value, found := getField(doc, op.path)
+		if !found || value == nil {
+			return doc, nil
+		}
+		hashed, err := op.hash(value)
+		if err != nil {
+			return nil, err
+		}
+		return setField(doc, op.path, hashed)
+	}
+	return doc, nil
+}
+
+// hash returns the hex SHA-256 of the salt followed by the value: the bytes
+// of a string, or the BSON encoding of any other value.
+func (op transformOp) hash(value interface{}) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(op.salt))
+	if str, ok := value.(string); ok {
+		hash.Write([]byte(str))
+	} else {
+		encoded, err := bson.Marshal(bson.D{{"", value}})
+		if err != nil {
+			return "", fmt.Errorf("error hashing field '%v': %v", strings.Join(op.path, "."), err)
+		}
+		hash.Write(encoded)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// getField returns the value of the field at the path in the document, and
+// whether it was found.
+func getField(doc bson.D, path []string) (interface{}, bool) {
+	for _, elem := range doc {
+		if elem.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return elem.Value, true
+		}
+		subdoc, ok := elem.Value.(bson.D)
+		if !ok {
+			return nil, false
+		}
+		return getField(subdoc, path[1:])
+	}
+	return nil, false
+}
+
+// removeField removes the field at the path from the document, returning
+// the updated document, the field's value and whether it was found.
+func removeField(doc bson.D, path []string) (bson.D, interface{}, bool) {
+	for i, elem := range doc {
+		if elem.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(doc[:i:i], doc[i+1:]...), elem.Value, true
+		}
+		subdoc, ok := elem.Value.(bson.D)
+		if !ok {
+			return doc, nil, false
+		}
+		subdoc, value, found := removeField(subdoc, path[1:])
+		doc[i].Value = subdoc
+		return doc, value, found
+	}
+	return doc, nil, false
+}
+
+// setField sets the field at the path in the document, creating any missing
+// embedded documents along the way. The field keeps its position if it
+// already exists and is appended otherwise.
+func setField(doc bson.D, path []string, value interface{}) (bson.D, error) {
+	for i, elem := range doc {
+		if elem.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			doc[i].Value = value
+			return doc, nil
+		}
+		subdoc, ok := elem.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("cannot set '%v': '%v' is not a document", strings.Join(path, "."), path[0])
+		}
+		subdoc, err := setField(subdoc, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		doc[i].Value = subdoc
+		return doc, nil
+	}
+	if len(path) == 1 {
+		return append(doc, bson.DocElem{path[0], value}), nil
+	}
+	subdoc, err := setField(bson.D{}, path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	return append(doc, bson.DocElem{path[0], subdoc}), nil
+}
+
+// dbRefFields are the dollar-prefixed field names of DBRefs, which servers
+// accept.
+var dbRefFields = map[string]bool{"$ref": true, "$id": true, "$db": true}
+
+// fixFieldName returns the field name with each dot, and a leading dollar
+// sign, replaced with the replacement.
+func fixFieldName(name, replacement string) string {
+	if strings.HasPrefix(name, "$") && !dbRefFields[name] {
+		name = replacement + name[1:]
+	}
+	return strings.Replace(name, ".", replacement, -1)
+}
+
+// fixFieldNames renames the fields of the document, and of the documents
+// embedded in it, whose names have a dot or a leading dollar sign. It fails
+// if a new name is already taken in the same document.
+func fixFieldNames(doc bson.D, replacement string) (bson.D, error) {
+	for i := range doc {
+		if fixed := fixFieldName(doc[i].Name, replacement); fixed != doc[i].Name {
+			for _, elem := range doc {
+				if elem.Name == fixed {
+					return nil, fmt.Errorf("cannot rename field '%v' to '%v', which already exists", doc[i].Name, fixed)
+				}
+			}
+			doc[i].Name = fixed
+		}
+		value, err := fixValueFieldNames(doc[i].Value, replacement)
+		if err != nil {
+			return nil, err
+		}
+		doc[i].Value = value
+	}
+	return doc, nil
+}
+
+// fixValueFieldNames renames the broken field names of the documents in the
+// value, a document or an array.
+func fixValueFieldNames(value interface{}, replacement string) (interface{}, error) {
+	switch v := value.(type) {
+	case bson.D:
+		return fixFieldNames(v, replacement)
+	case []interface{}:
+		for i := range v {
+			fixed, err := fixValueFieldNames(v[i], replacement)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = fixed
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,132 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestDocumentTransform(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a document to restore", t, func() {
+		raw, err := bson.Marshal(bson.D{
+			{"_id", 1},
+			{"name", "Ada"},
+			{"ssn", "123-45-6789"},
+			{"contact", bson.D{{"email", "ada@example.com"}, {"phone", nil}}},
+		})
+		So(err, ShouldBeNil)
+
+		apply := func(statements ...string) bson.D {
+			transform, err := parseTransforms(statements)
+			So(err, ShouldBeNil)
+			out, err := transform.Apply(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(out, &doc), ShouldBeNil)
+			return doc
+		}
+
+		Convey("fields should be dropped, renamed and set in order", func() {
+			doc := apply(
+				"drop ssn",
+				"rename name fullName",
+				"rename contact.email email",
+				`set contact.verified {"$date": "2015-06-01T00:00:00Z"}`,
+				`set status "active user"`,
+				"drop missing.field")
+			So(len(doc), ShouldEqual, 5)
+			So(doc[0], ShouldResemble, bson.DocElem{"_id", 1})
+			So(doc[1].Name, ShouldEqual, "contact")
+			contact := doc[1].Value.(bson.D)
+			So(contact[0], ShouldResemble, bson.DocElem{"phone", nil})
+			So(contact[1].Name, ShouldEqual, "verified")
+			So(doc[2], ShouldResemble, bson.DocElem{"fullName", "Ada"})
+			So(doc[3], ShouldResemble, bson.DocElem{"email", "ada@example.com"})
+			So(doc[4], ShouldResemble, bson.DocElem{"status", "active user"})
+		})
+
+		Convey("hashed fields should keep their position and skip nulls", func() {
+			doc := apply("hash ssn", "hash contact.phone", "hash name pepper")
+			So(doc[2].Name, ShouldEqual, "ssn")
+			So(doc[2].Value, ShouldEqual, "01a54629efb952287e554eb23ef69c52097a75aecc0e3a93ca0855ab6d7a31a0")
+			So(doc[1].Value, ShouldNotEqual, "Ada")
+			So(len(doc[1].Value.(string)), ShouldEqual, 64)
+			So(doc[3].Value, ShouldResemble, bson.D{{"email", "ada@example.com"}, {"phone", nil}})
+		})
+
+		Convey("setting a field inside a non-document should fail", func() {
+			transform, err := parseTransforms([]string{"set name.first 1"})
+			So(err, ShouldBeNil)
+			_, err = transform.Apply(raw)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Invalid statements should be rejected", t, func() {
+		for _, statement := range []string{"drop", "drop a b", "rename a", "set a", "set a {", "hash a b c", "move a b", "drop a..b"} {
+			_, err := parseTransforms([]string{statement})
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("System and temporary auth collections should not be transformed", t, func() {
+		transform, err := parseTransforms([]string{"drop ssn"})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{transform: transform, tempUsersCol: "tempusers", tempRolesCol: "temproles"}
+		So(restore.transformFor("db", "users"), ShouldNotBeNil)
+		So(restore.transformFor("db", "system.js"), ShouldBeNil)
+		So(restore.transformFor("admin", "tempusers"), ShouldBeNil)
+	})
+
+	Convey("With --fixBrokenFieldNames", t, func() {
+		transform := documentTransform{fixFieldNamesTransform("_")}
+
+		Convey("dotted and dollar-prefixed names should be fixed at any depth, except in DBRefs", func() {
+			raw, err := bson.Marshal(bson.D{
+				{"_id", 1},
+				{"a.b", 2},
+				{"$inc", bson.D{{"x.y.z", 3}}},
+				{"list", []interface{}{bson.D{{"$set", 4}}, 5}},
+				{"ref", bson.D{{"$ref", "users"}, {"$id", 6}, {"$db", "app"}}},
+				{"price$", 7},
+			})
+			So(err, ShouldBeNil)
+			data, err := transform.Apply(raw)
+			So(err, ShouldBeNil)
+			doc := bson.D{}
+			So(bson.Unmarshal(data, &doc), ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{
+				{"_id", 1},
+				{"a_b", 2},
+				{"_inc", bson.D{{"x_y_z", 3}}},
+				{"list", []interface{}{bson.D{{"_set", 4}}, 5}},
+				{"ref", bson.D{{"$ref", "users"}, {"$id", 6}, {"$db", "app"}}},
+				{"price$", 7},
+			})
+		})
+
+		Convey("a document in which a fixed name is taken should fail", func() {
+			raw, err := bson.Marshal(bson.D{{"a_b", 1}, {"a.b", 2}})
+			So(err, ShouldBeNil)
+			_, err = transform.Apply(raw)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With --omitId, the dumped _id should be dropped before --transform", t, func() {
+		set, err := parseTransforms([]string{"set source \"eu\""})
+		So(err, ShouldBeNil)
+		transform := append(documentTransform{omitIDTransform}, set...)
+		raw, err := bson.Marshal(bson.D{{"_id", 1}, {"name", "ada"}})
+		So(err, ShouldBeNil)
+		data, err := transform.Apply(raw)
+		So(err, ShouldBeNil)
+		doc := bson.D{}
+		So(bson.Unmarshal(data, &doc), ShouldBeNil)
+		So(doc, ShouldResemble, bson.D{{"name", "ada"}, {"source", "eu"}})
+	})
+}
@@ -0,0 +1,145 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"strings"
+	"sync"
+)
+
+// heldExpireAfterSeconds is the expireAfterSeconds TTL indexes are created
+// with under --holdTTLExpiry: the largest value servers accept, about 68
+// years, so that no restored document expires before the restore is done.
+const heldExpireAfterSeconds = math.MaxInt32
+
+// heldTTLIndex is a TTL index created with its expiry held off, with the
+// expireAfterSeconds it is given back once the restore is done.
+type heldTTLIndex struct {
+	db                 string
+	collection         string
+	key                bson.D
+	expireAfterSeconds interface{}
+}
+
+// ttlHolder keeps track of the TTL indexes whose expiry is held off, for
+// --holdTTLExpiry. A nil ttlHolder holds nothing.
+type ttlHolder struct {
+	mutex   sync.Mutex
+	indexes []heldTTLIndex
+
+	// the collections the restore creates, by namespace: only their TTL
+	// indexes are held off, as those of a collection already there may
+	// exist with their own expiry, which creating them again with another
+	// one conflicts with
+	created map[string]bool
+}
+
+// creating records that the restore creates the collection of the intent.
+func (holder *ttlHolder) creating(intent *intents.Intent) {
+	if holder == nil {
+		return
+	}
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	if holder.created == nil {
+		holder.created = map[string]bool{}
+	}
+	holder.created[intent.Namespace()] = true
+}
+
+// hold replaces the index's expireAfterSeconds with heldExpireAfterSeconds,
+// if the index is a TTL index of a collection the restore creates. It
+// returns the held index, to record once it's created.
+func (holder *ttlHolder) hold(intent *intents.Intent, index IndexDocument) (heldTTLIndex, bool) {
+	if holder == nil {
+		return heldTTLIndex{}, false
+	}
+	expireAfterSeconds, ok := index.Options["expireAfterSeconds"]
+	if !ok {
+		return heldTTLIndex{}, false
+	}
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	if !holder.created[intent.Namespace()] {
+		log.Logf(log.Always, "not holding off the expiry of the TTL index %v of %v, which already existed",
+			index.Key, intent.Namespace())
+		return heldTTLIndex{}, false
+	}
+	index.Options["expireAfterSeconds"] = heldExpireAfterSeconds
+	return heldTTLIndex{
+		db:                 intent.DB,
+		collection:         intent.C,
+		key:                index.Key,
+		expireAfterSeconds: expireAfterSeconds,
+	}, true
+}
+
+// record keeps track of held indexes once they are created, to give them
+// their expiry back.
+func (holder *ttlHolder) record(held ...heldTTLIndex) {
+	if holder == nil || len(held) == 0 {
+		return
+	}
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	holder.indexes = append(holder.indexes, held...)
+}
+
+// forget stops keeping track of the held TTL indexes of a collection that
+// was dropped, such as a staging collection after a failed restore.
+func (holder *ttlHolder) forget(db, collection string) {
+	if holder == nil {
+		return
+	}
+	holder.mutex.Lock()
+	defer holder.mutex.Unlock()
+	delete(holder.created, db+"."+collection)
+	kept := holder.indexes[:0]
+	for _, index := range holder.indexes {
+		if index.db != db || index.collection != collection {
+			kept = append(kept, index)
+		}
+	}
+	holder.indexes = kept
+}
+
+// ReleaseTTLIndexes gives each TTL index held off by --holdTTLExpiry its
+// dumped expireAfterSeconds back with the collMod command, at which point
+// the server starts expiring documents again. Indexes of staging
+// collections are released on the collections they were renamed to.
+func (restore *MongoRestore) ReleaseTTLIndexes() error {
+	if restore.ttlHolder == nil || len(restore.ttlHolder.indexes) == 0 {
+		return nil
+	}
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+
+	log.Logf(log.Always, "restoring the expiry of %v TTL indexes", len(restore.ttlHolder.indexes))
+	failed := 0
+	for _, index := range restore.ttlHolder.indexes {
+		namespace := restore.stager.target(index.db + "." + index.collection)
+		collection := strings.TrimPrefix(namespace, index.db+".")
+		log.Logf(log.Info, "setting expireAfterSeconds of the TTL index %v of %v back to %v",
+			index.key, namespace, index.expireAfterSeconds)
+		command := bson.D{
+			{"collMod", collection},
+			{"index", bson.D{{"keyPattern", index.key}, {"expireAfterSeconds", index.expireAfterSeconds}}},
+		}
+		if err = session.DB(index.db).Run(command, &bson.M{}); err != nil {
+			log.Logf(log.Always, "error restoring the expiry of the TTL index %v of %v: %v",
+				index.key, namespace, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v TTL indexes still have their expiry held off, "+
+			"with expireAfterSeconds set to %v", failed, heldExpireAfterSeconds)
+	}
+	return nil
+}
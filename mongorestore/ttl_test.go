@@ -0,0 +1,70 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestHoldTTLIndexes(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With --holdTTLExpiry", t, func() {
+		holder := &ttlHolder{}
+		intent := &intents.Intent{DB: "db", C: "sessions"}
+
+		Convey("a TTL index of a collection the restore creates should be held off", func() {
+			holder.creating(intent)
+			index := IndexDocument{
+				Options: bson.M{"name": "created_1", "expireAfterSeconds": 3600},
+				Key:     bson.D{{"created", 1}},
+			}
+			held, ok := holder.hold(intent, index)
+			So(ok, ShouldBeTrue)
+			So(index.Options["expireAfterSeconds"], ShouldEqual, heldExpireAfterSeconds)
+			So(len(holder.indexes), ShouldEqual, 0)
+
+			Convey("and its expiry recorded once it's created", func() {
+				holder.record(held)
+				So(len(holder.indexes), ShouldEqual, 1)
+				So(holder.indexes[0].collection, ShouldEqual, "sessions")
+				So(holder.indexes[0].expireAfterSeconds, ShouldEqual, 3600)
+
+				Convey("and forgotten when its collection is dropped", func() {
+					holder.forget("db", "other")
+					So(len(holder.indexes), ShouldEqual, 1)
+					holder.forget("db", "sessions")
+					So(len(holder.indexes), ShouldEqual, 0)
+				})
+			})
+		})
+
+		Convey("a TTL index of a collection already there should keep its expiry", func() {
+			index := IndexDocument{Options: bson.M{"expireAfterSeconds": 3600}, Key: bson.D{{"created", 1}}}
+			_, ok := holder.hold(intent, index)
+			So(ok, ShouldBeFalse)
+			So(index.Options["expireAfterSeconds"], ShouldEqual, 3600)
+		})
+
+		Convey("other indexes should be left alone", func() {
+			holder.creating(intent)
+			index := IndexDocument{Options: bson.M{"name": "user_1"}, Key: bson.D{{"user", 1}}}
+			_, ok := holder.hold(intent, index)
+			So(ok, ShouldBeFalse)
+			_, ok = index.Options["expireAfterSeconds"]
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Without --holdTTLExpiry, TTL indexes should keep their expiry", t, func() {
+		var holder *ttlHolder
+		index := IndexDocument{Options: bson.M{"expireAfterSeconds": 3600}, Key: bson.D{{"created", 1}}}
+		holder.creating(&intents.Intent{DB: "db", C: "sessions"})
+		_, ok := holder.hold(&intents.Intent{DB: "db", C: "sessions"}, index)
+		So(ok, ShouldBeFalse)
+		So(index.Options["expireAfterSeconds"], ShouldEqual, 3600)
+	})
+}
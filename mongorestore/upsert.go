@@ -0,0 +1,151 @@
+package mongorestore
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Ways of writing restored documents, with --mode.
+const (
+	modeInsert  = "insert"
+	modeUpsert  = "upsert"
+	modeReplace = "replace"
+	modeMerge   = "merge"
+)
+
+// upsertWriter writes restored documents one at a time, matching them to the
+// documents already in the collection on the --upsertFields, for the modes
+// other than insert.
+type upsertWriter struct {
+	mode   string
+	fields [][]string
+}
+
+// newUpsertWriter returns an upsertWriter for the given --mode and
+// comma-separated --upsertFields, or nil for the insert mode.
+func newUpsertWriter(mode, upsertFields string) (*upsertWriter, error) {
+	switch mode {
+	case "", modeInsert:
+		if upsertFields != "" {
+			return nil, fmt.Errorf("--upsertFields requires --mode %v, %v or %v", modeUpsert, modeReplace, modeMerge)
+		}
+		return nil, nil
+	case modeUpsert, modeReplace, modeMerge:
+	default:
+		return nil, fmt.Errorf("invalid --mode '%v', choose '%v', '%v', '%v' or '%v'",
+			mode, modeInsert, modeUpsert, modeReplace, modeMerge)
+	}
+	if upsertFields == "" {
+		upsertFields = "_id"
+	}
+	writer := &upsertWriter{mode: mode}
+	for _, field := range strings.Split(upsertFields, ",") {
+		path := strings.Split(strings.TrimSpace(field), ".")
+		for _, part := range path {
+			if part == "" || strings.HasPrefix(part, "$") {
+				return nil, fmt.Errorf("invalid field '%v' in --upsertFields", field)
+			}
+		}
+		writer.fields = append(writer.fields, path)
+	}
+	return writer, nil
+}
+
+// lookupField returns the value at a dotted path in a document.
+func lookupField(doc interface{}, path []string) (interface{}, bool) {
+	var value interface{}
+	found := false
+	switch d := doc.(type) {
+	case bson.D:
+		for _, elem := range d {
+			if elem.Name == path[0] {
+				value, found = elem.Value, true
+				break
+			}
+		}
+	case bson.M:
+		value, found = d[path[0]]
+	}
+	if !found || len(path) == 1 {
+		return value, found
+	}
+	return lookupField(value, path[1:])
+}
+
+// selector returns the query matching the document on the --upsertFields,
+// or nil if the document has none of them.
+func (writer *upsertWriter) selector(doc bson.D) bson.D {
+	selector := bson.D{}
+	hasKey := false
+	for _, path := range writer.fields {
+		value, found := lookupField(doc, path)
+		if found {
+			hasKey = true
+		}
+		selector = append(selector, bson.DocElem{strings.Join(path, "."), value})
+	}
+	if !hasKey {
+		return nil
+	}
+	return selector
+}
+
+// keyedOnID returns true if _id is one of the --upsertFields.
+func (writer *upsertWriter) keyedOnID() bool {
+	for _, path := range writer.fields {
+		if len(path) == 1 && path[0] == "_id" {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeUpdate returns an update setting each of the document's fields,
+// and its _id if the update inserts it and the selector doesn't hold it.
+func (writer *upsertWriter) mergeUpdate(doc bson.D) bson.D {
+	set := bson.D{}
+	var id interface{}
+	for _, elem := range doc {
+		if elem.Name == "_id" {
+			id = elem.Value
+			continue
+		}
+		set = append(set, elem)
+	}
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.DocElem{"$set", set})
+	}
+	if id != nil && (!writer.keyedOnID() || len(set) == 0) {
+		update = append(update, bson.DocElem{"$setOnInsert", bson.D{{"_id", id}}})
+	}
+	return update
+}
+
+// write writes the document according to the --mode. Documents without any
+// of the --upsertFields are inserted.
+func (writer *upsertWriter) write(collection *mgo.Collection, raw bson.Raw) error {
+	doc := bson.D{}
+	if err := bson.Unmarshal(raw.Data, &doc); err != nil {
+		return fmt.Errorf("error unmarshaling document: %v", err)
+	}
+	selector := writer.selector(doc)
+	if selector == nil {
+		return collection.Insert(doc)
+	}
+	var err error
+	switch writer.mode {
+	case modeUpsert:
+		_, err = collection.Upsert(selector, doc)
+	case modeReplace:
+		// only documents already in the collection are replaced
+		if err = collection.Update(selector, doc); err == mgo.ErrNotFound {
+			err = nil
+		}
+	case modeMerge:
+		_, err = collection.Upsert(selector, writer.mergeUpdate(doc))
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package mongorestore
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestUpsertWriter(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing --mode and --upsertFields", t, func() {
+		Convey("the insert mode should need no writer", func() {
+			writer, err := newUpsertWriter(modeInsert, "")
+			So(err, ShouldBeNil)
+			So(writer, ShouldBeNil)
+		})
+
+		Convey("the other modes should match on _id by default", func() {
+			writer, err := newUpsertWriter(modeUpsert, "")
+			So(err, ShouldBeNil)
+			So(writer.fields, ShouldResemble, [][]string{{"_id"}})
+		})
+
+		Convey("invalid modes and fields should be rejected", func() {
+			_, err := newUpsertWriter("overwrite", "")
+			So(err, ShouldNotBeNil)
+			_, err = newUpsertWriter(modeInsert, "email")
+			So(err, ShouldNotBeNil)
+			_, err = newUpsertWriter(modeMerge, "a..b")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a writer matching on email and account.id", t, func() {
+		writer, err := newUpsertWriter(modeMerge, "email, account.id")
+		So(err, ShouldBeNil)
+
+		Convey("the selector should hold the document's values of the fields", func() {
+			doc := bson.D{{"_id", 1}, {"email", "a@b.c"}, {"account", bson.D{{"id", 7}}}}
+			So(writer.selector(doc), ShouldResemble, bson.D{{"email", "a@b.c"}, {"account.id", 7}})
+		})
+
+		Convey("a document with none of the fields should have no selector", func() {
+			So(writer.selector(bson.D{{"_id", 1}, {"name", "x"}}), ShouldBeNil)
+		})
+
+		Convey("merging should set the fields and only set _id on insert", func() {
+			doc := bson.D{{"_id", 1}, {"email", "a@b.c"}}
+			So(writer.mergeUpdate(doc), ShouldResemble, bson.D{
+				{"$set", bson.D{{"email", "a@b.c"}}},
+				{"$setOnInsert", bson.D{{"_id", 1}}},
+			})
+		})
+	})
+
+	Convey("With a writer merging on _id", t, func() {
+		writer, err := newUpsertWriter(modeMerge, "")
+		So(err, ShouldBeNil)
+
+		Convey("merging should only set the fields other than _id", func() {
+			doc := bson.D{{"_id", 1}, {"name", "x"}}
+			So(writer.mergeUpdate(doc), ShouldResemble, bson.D{{"$set", bson.D{{"name", "x"}}}})
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package mongorestore
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// validationOptionNames are the collection options setting a collection's
+// document validator and how it is enforced.
+var validationOptionNames = map[string]bool{
+	"validator":        true,
+	"validationLevel":  true,
+	"validationAction": true,
+}
+
+// splitValidationOptions separates the validation options from the other
+// collection options. The validator is set once the documents are restored,
+// so that documents dumped from before it was added, which it may reject,
+// are restored as they were.
+func splitValidationOptions(options bson.D) (created bson.D, validation bson.D) {
+	created = bson.D{}
+	for _, opt := range options {
+		if validationOptionNames[opt.Name] {
+			validation = append(validation, opt)
+		} else {
+			created = append(created, opt)
+		}
+	}
+	return created, validation
+}
+
+// ApplyValidation sets the validation options on the collection specified
+// in the intent with the collMod command.
+func (restore *MongoRestore) ApplyValidation(intent *intents.Intent, validation bson.D) error {
+	jsonCommand, err := bsonutil.ConvertBSONValueToJSON(
+		append(bson.D{{"collMod", intent.C}}, validation...),
+	)
+	if err != nil {
+		return err
+	}
+
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+
+	res := bson.M{}
+	err = session.DB(intent.DB).Run(jsonCommand, &res)
+	if err != nil {
+		return fmt.Errorf("error running collMod command: %v", err)
+	}
+	if util.IsFalsy(res["ok"]) {
+		return fmt.Errorf("collMod command: %v", res["errmsg"])
+	}
+	return nil
+}
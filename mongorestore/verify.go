@@ -0,0 +1,319 @@
+package mongorestore
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// verifySampleSize is how many documents of each collection --verify reads
+// back from the target to compare with the dump.
+const verifySampleSize = 1000
+
+// Outcomes of verifying a namespace.
+const (
+	verifyOK       = "ok"
+	verifyMismatch = "mismatch"
+	verifySkipped  = "skipped"
+)
+
+// verifySample is a document sampled from the dump: its _id, as raw BSON so
+// it can be looked up as is, and the hash of the document as restored.
+type verifySample struct {
+	id   bson.Raw
+	hash [md5.Size]byte
+}
+
+// sampleHeap holds the samples of a collection with the largest hash on
+// top, so the documents with the smallest hashes can be kept: a sample that
+// is uniform over the documents, yet doesn't depend on their order.
+type sampleHeap []verifySample
+
+func (h sampleHeap) Len() int            { return len(h) }
+func (h sampleHeap) Less(i, j int) bool  { return bytes.Compare(h[i].hash[:], h[j].hash[:]) > 0 }
+func (h sampleHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sampleHeap) Push(x interface{}) { *h = append(*h, x.(verifySample)) }
+func (h *sampleHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// byHash sorts samples by increasing hash.
+type byHash []verifySample
+
+func (s byHash) Len() int           { return len(s) }
+func (s byHash) Less(i, j int) bool { return bytes.Compare(s[i].hash[:], s[j].hash[:]) < 0 }
+func (s byHash) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// verifyRecord is what --verify knows of a collection from the documents
+// restored to it. A nil verifyRecord records nothing.
+type verifyRecord struct {
+	mutex     sync.Mutex
+	count     int64
+	samples   sampleHeap
+	noSamples string
+	skipped   string
+}
+
+// add records a document as it is written to the collection.
+func (record *verifyRecord) add(data []byte) {
+	if record == nil {
+		return
+	}
+	sample := verifySample{hash: md5.Sum(data)}
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+	record.count++
+	if record.noSamples != "" {
+		return
+	}
+	if len(record.samples) == verifySampleSize &&
+		bytes.Compare(sample.hash[:], record.samples[0].hash[:]) >= 0 {
+		return
+	}
+	idDoc := struct {
+		ID bson.Raw `bson:"_id"`
+	}{}
+	if err := bson.Unmarshal(data, &idDoc); err != nil || idDoc.ID.Kind == 0 {
+		// documents without an _id can't be looked up, so are only counted
+		return
+	}
+	// copy the _id, as the document may be a slice of a mapped file
+	sample.id = bson.Raw{Kind: idDoc.ID.Kind, Data: append([]byte{}, idDoc.ID.Data...)}
+	if len(record.samples) < verifySampleSize {
+		heap.Push(&record.samples, sample)
+		return
+	}
+	record.samples[0] = sample
+	heap.Fix(&record.samples, 0)
+}
+
+// skip excludes the collection from verification, for the given reason.
+func (record *verifyRecord) skip(reason string) {
+	if record == nil {
+		return
+	}
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+	record.skipped = reason
+}
+
+// countOnly only has the collection's document count verified, for the
+// given reason, as the documents read back won't match the dump's.
+func (record *verifyRecord) countOnly(reason string) {
+	if record == nil {
+		return
+	}
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+	record.noSamples = reason
+	record.samples = nil
+}
+
+// restoreVerifier keeps a verifyRecord for each namespace restored, for
+// --verify. A nil restoreVerifier records nothing.
+type restoreVerifier struct {
+	mutex   sync.Mutex
+	records map[string]*verifyRecord
+}
+
+func newRestoreVerifier() *restoreVerifier {
+	return &restoreVerifier{records: map[string]*verifyRecord{}}
+}
+
+// record returns the namespace's record, creating it on first use.
+func (verifier *restoreVerifier) record(namespace string) *verifyRecord {
+	if verifier == nil {
+		return nil
+	}
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	record, ok := verifier.records[namespace]
+	if !ok {
+		record = &verifyRecord{}
+		verifier.records[namespace] = record
+	}
+	return record
+}
+
+// verifyResult is the outcome of verifying a namespace, as written to the
+// --verifyReport.
+type verifyResult struct {
+	Namespace      string `json:"ns"`
+	Status         string `json:"status"`
+	Reason         string `json:"reason,omitempty"`
+	ExpectedCount  int64  `json:"expectedCount"`
+	ActualCount    int64  `json:"actualCount"`
+	Sampled        int    `json:"sampled"`
+	MissingSamples int    `json:"missingSamples"`
+	ChangedSamples int    `json:"changedSamples"`
+	ExpectedDigest string `json:"expectedDigest,omitempty"`
+	ActualDigest   string `json:"actualDigest,omitempty"`
+}
+
+// verifyReport is the --verifyReport document.
+type verifyReport struct {
+	Mismatches int            `json:"mismatches"`
+	Namespaces []verifyResult `json:"namespaces"`
+}
+
+// idKey identifies an _id by its BSON type and bytes.
+func idKey(id bson.Raw) string {
+	return string(id.Kind) + string(id.Data)
+}
+
+// sampleDigest hashes the hashes of the samples, in order, into a digest
+// of the whole sample.
+func sampleDigest(hashes [][md5.Size]byte) string {
+	digest := md5.New()
+	for _, hash := range hashes {
+		digest.Write(hash[:])
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// compareSamples compares the sampled documents of the dump to the ones
+// found in the target, by hash of _id, filling in the result's sample
+// fields.
+func compareSamples(samples []verifySample, found map[string][md5.Size]byte, result *verifyResult) {
+	result.Sampled = len(samples)
+	if len(samples) == 0 {
+		return
+	}
+	expected := make([][md5.Size]byte, len(samples))
+	actual := make([][md5.Size]byte, len(samples))
+	for i, sample := range samples {
+		expected[i] = sample.hash
+		hash, ok := found[idKey(sample.id)]
+		switch {
+		case !ok:
+			result.MissingSamples++
+		case hash != sample.hash:
+			result.ChangedSamples++
+		}
+		actual[i] = hash
+	}
+	result.ExpectedDigest = sampleDigest(expected)
+	result.ActualDigest = sampleDigest(actual)
+}
+
+// verifyNamespace compares a restored collection in the target with its
+// record.
+func (restore *MongoRestore) verifyNamespace(namespace string, record *verifyRecord) (verifyResult, error) {
+	result := verifyResult{Namespace: namespace, ExpectedCount: record.count}
+	if record.skipped != "" {
+		result.Status, result.Reason = verifySkipped, record.skipped
+		return result, nil
+	}
+	dbName, colName, err := util.SplitAndValidateNamespace(namespace)
+	if err != nil {
+		return result, err
+	}
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return result, err
+	}
+	defer session.Close()
+	collection := session.DB(dbName).C(colName)
+
+	count, err := collection.Count()
+	if err != nil {
+		return result, fmt.Errorf("error counting documents in %v: %v", namespace, err)
+	}
+	result.ActualCount = int64(count)
+
+	samples := append([]verifySample{}, record.samples...)
+	sort.Sort(byHash(samples))
+	ids := make([]interface{}, len(samples))
+	for i, sample := range samples {
+		ids[i] = sample.id
+	}
+	found := map[string][md5.Size]byte{}
+	if len(ids) > 0 {
+		iter := collection.Find(bson.M{"_id": bson.M{"$in": ids}}).Iter()
+		doc := bson.Raw{}
+		for iter.Next(&doc) {
+			idDoc := struct {
+				ID bson.Raw `bson:"_id"`
+			}{}
+			if err = bson.Unmarshal(doc.Data, &idDoc); err != nil {
+				return result, fmt.Errorf("error reading document from %v: %v", namespace, err)
+			}
+			found[idKey(idDoc.ID)] = md5.Sum(doc.Data)
+		}
+		if err = iter.Close(); err != nil {
+			return result, fmt.Errorf("error reading sampled documents from %v: %v", namespace, err)
+		}
+	}
+	compareSamples(samples, found, &result)
+
+	result.Status = verifyOK
+	if result.ActualCount != result.ExpectedCount || result.MissingSamples > 0 || result.ChangedSamples > 0 {
+		result.Status = verifyMismatch
+	}
+	result.Reason = record.noSamples
+	return result, nil
+}
+
+// Verify compares each restored collection in the target to the documents
+// restored to it from the dump, logging and reporting any that differ, and
+// failing if any do.
+func (restore *MongoRestore) Verify() error {
+	// records of staged collections are kept under their staging namespace
+	records := map[string]*verifyRecord{}
+	namespaces := make([]string, 0, len(restore.verifier.records))
+	for namespace, record := range restore.verifier.records {
+		namespace = restore.stager.target(namespace)
+		records[namespace] = record
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	log.Logf(log.Always, "verifying %v restored collections", len(namespaces))
+
+	report := verifyReport{Namespaces: []verifyResult{}}
+	for _, namespace := range namespaces {
+		result, err := restore.verifyNamespace(namespace, records[namespace])
+		if err != nil {
+			return err
+		}
+		switch result.Status {
+		case verifySkipped:
+			log.Logf(log.Info, "not verifying %v: %v", namespace, result.Reason)
+		case verifyMismatch:
+			report.Mismatches++
+			log.Logf(log.Always, "verification failed for %v: %v documents, expected %v; "+
+				"%v of %v sampled documents missing and %v changed",
+				namespace, result.ActualCount, result.ExpectedCount,
+				result.MissingSamples, result.Sampled, result.ChangedSamples)
+		default:
+			log.Logf(log.Info, "verified %v: %v documents, %v sampled", namespace, result.ActualCount, result.Sampled)
+		}
+		report.Namespaces = append(report.Namespaces, result)
+	}
+
+	if restore.OutputOptions.VerifyReport != "" {
+		reportJSON, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding verification report: %v", err)
+		}
+		if err = ioutil.WriteFile(restore.OutputOptions.VerifyReport, append(reportJSON, '\n'), 0644); err != nil {
+			return fmt.Errorf("error writing --verifyReport: %v", err)
+		}
+	}
+	if report.Mismatches > 0 {
+		return fmt.Errorf("verification failed for %v of %v collections", report.Mismatches, len(namespaces))
+	}
+	log.Logf(log.Always, "verified %v collections", len(namespaces))
+	return nil
+}
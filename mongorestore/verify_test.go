@@ -0,0 +1,111 @@
+package mongorestore
+
+import (
+	"crypto/md5"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"sort"
+	"testing"
+)
+
+func TestVerifyRecord(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a verifier", t, func() {
+		verifier := newRestoreVerifier()
+		record := verifier.record("db.c")
+		So(verifier.record("db.c"), ShouldEqual, record)
+
+		Convey("every document should be counted and the sample bounded", func() {
+			all := []verifySample{}
+			for i := 0; i < verifySampleSize+500; i++ {
+				data, err := bson.Marshal(bson.D{{"_id", i}, {"x", "value"}})
+				So(err, ShouldBeNil)
+				record.add(data)
+				all = append(all, verifySample{hash: md5.Sum(data)})
+			}
+			So(record.count, ShouldEqual, verifySampleSize+500)
+			So(len(record.samples), ShouldEqual, verifySampleSize)
+
+			Convey("keeping the documents with the smallest hashes", func() {
+				sort.Sort(byHash(all))
+				kept := append([]verifySample{}, record.samples...)
+				sort.Sort(byHash(kept))
+				for i := range kept {
+					So(kept[i].hash, ShouldEqual, all[i].hash)
+				}
+			})
+		})
+
+		Convey("documents without an _id should only be counted", func() {
+			data, err := bson.Marshal(bson.D{{"x", 1}})
+			So(err, ShouldBeNil)
+			record.add(data)
+			So(record.count, ShouldEqual, 1)
+			So(len(record.samples), ShouldEqual, 0)
+		})
+
+		Convey("a count-only record should keep no samples", func() {
+			record.countOnly("reason")
+			data, err := bson.Marshal(bson.D{{"_id", 1}})
+			So(err, ShouldBeNil)
+			record.add(data)
+			So(record.count, ShouldEqual, 1)
+			So(len(record.samples), ShouldEqual, 0)
+		})
+	})
+
+	Convey("A nil verifier should record nothing", t, func() {
+		var verifier *restoreVerifier
+		record := verifier.record("db.c")
+		So(record, ShouldBeNil)
+		record.add([]byte{})
+		record.skip("reason")
+	})
+}
+
+func TestCompareSamples(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When comparing sampled documents to the target", t, func() {
+		samples := []verifySample{
+			{bson.Raw{Kind: 0x10, Data: []byte{1, 0, 0, 0}}, md5.Sum([]byte("one"))},
+			{bson.Raw{Kind: 0x10, Data: []byte{2, 0, 0, 0}}, md5.Sum([]byte("two"))},
+			{bson.Raw{Kind: 0x10, Data: []byte{3, 0, 0, 0}}, md5.Sum([]byte("three"))},
+		}
+		found := map[string][md5.Size]byte{}
+		for _, sample := range samples {
+			found[idKey(sample.id)] = sample.hash
+		}
+
+		Convey("identical documents should have the same digest", func() {
+			result := verifyResult{}
+			compareSamples(samples, found, &result)
+			So(result.Sampled, ShouldEqual, 3)
+			So(result.MissingSamples, ShouldEqual, 0)
+			So(result.ChangedSamples, ShouldEqual, 0)
+			So(result.ActualDigest, ShouldEqual, result.ExpectedDigest)
+		})
+
+		Convey("missing and changed documents should be counted", func() {
+			delete(found, idKey(samples[0].id))
+			found[idKey(samples[1].id)] = md5.Sum([]byte("changed"))
+			result := verifyResult{}
+			compareSamples(samples, found, &result)
+			So(result.MissingSamples, ShouldEqual, 1)
+			So(result.ChangedSamples, ShouldEqual, 1)
+			So(result.ActualDigest, ShouldNotEqual, result.ExpectedDigest)
+		})
+
+		Convey("an _id of another type should not match", func() {
+			delete(found, idKey(samples[2].id))
+			found[idKey(bson.Raw{Kind: 0x12, Data: samples[2].id.Data})] = samples[2].hash
+			result := verifyResult{}
+			compareSamples(samples, found, &result)
+			So(result.MissingSamples, ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,186 @@
+package mongostat
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/text"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultColorRules are the color rules used when none are given with
+// --colorRule. Later rules take precedence, so each red threshold follows
+// the yellow one for the same field.
+var DefaultColorRules = []string{
+	"qr>10:yellow", "qw>10:yellow",
+	"qr>100:red", "qw>100:red",
+	"dirty>5:yellow", "dirty>20:red",
+	"used>80:yellow", "used>95:red",
+	"locked>50:yellow", "locked>80:red",
+}
+
+// colorNames maps the color names accepted in color rules to their ANSI
+// escape sequences.
+var colorNames = map[string]string{
+	"red":     text.ColorRed,
+	"green":   text.ColorGreen,
+	"yellow":  text.ColorYellow,
+	"blue":    text.ColorBlue,
+	"magenta": text.ColorMagenta,
+	"cyan":    text.ColorCyan,
+}
+
+// colorField describes a value that color rules can test, and the column
+// whose cell is colored when a rule matches.
+type colorField struct {
+	column string
+
+	// value returns the field's value for the line, and false if the line
+	// has no value for it
+	value func(line *StatLine) (float64, bool)
+}
+
+func countField(column string, count func(line *StatLine) int64) colorField {
+	return colorField{column, func(line *StatLine) (float64, bool) {
+		return float64(count(line)), true
+	}}
+}
+
+func optionalField(column string, count func(line *StatLine) int64) colorField {
+	return colorField{column, func(line *StatLine) (float64, bool) {
+		value := count(line)
+		return float64(value), value >= 0
+	}}
+}
+
+// colorFields are the fields color rules can test, by name. Percentages are
+// compared as displayed, from 0 to 100.
+var colorFields = map[string]colorField{
+	"insert":  countField("insert", func(line *StatLine) int64 { return line.Insert }),
+	"query":   countField("query", func(line *StatLine) int64 { return line.Query }),
+	"update":  countField("update", func(line *StatLine) int64 { return line.Update }),
+	"delete":  countField("delete", func(line *StatLine) int64 { return line.Delete }),
+	"getmore": countField("getmore", func(line *StatLine) int64 { return line.GetMore }),
+	"command": countField("command", func(line *StatLine) int64 { return line.Command }),
+	"dirty": {"dirty", func(line *StatLine) (float64, bool) {
+		return line.CacheDirtyPercent * 100, line.CacheDirtyPercent >= 0
+	}},
+	"used": {"used", func(line *StatLine) (float64, bool) {
+		return line.CacheUsedPercent * 100, line.CacheUsedPercent >= 0
+	}},
+	"flushes": countField("flushes", func(line *StatLine) int64 { return line.Flushes }),
+	"faults":  optionalField("faults", func(line *StatLine) int64 { return line.Faults }),
+	"vsize":   optionalField("vsize", func(line *StatLine) int64 { return line.Virtual }),
+	"res":     optionalField("res", func(line *StatLine) int64 { return line.Resident }),
+	"locked": {"locked", func(line *StatLine) (float64, bool) {
+		if line.HighestLocked == nil || line.IsMongos {
+			return 0, false
+		}
+		return line.HighestLocked.Percentage, true
+	}},
+	"qr":     countField("qr|qw", func(line *StatLine) int64 { return line.QueuedReaders }),
+	"qw":     countField("qr|qw", func(line *StatLine) int64 { return line.QueuedWriters }),
+	"ar":     countField("ar|aw", func(line *StatLine) int64 { return line.ActiveReaders }),
+	"aw":     countField("ar|aw", func(line *StatLine) int64 { return line.ActiveWriters }),
+	"netIn":  countField("netIn", func(line *StatLine) int64 { return line.NetIn }),
+	"netOut": countField("netOut", func(line *StatLine) int64 { return line.NetOut }),
+	"conn":   countField("conn", func(line *StatLine) int64 { return line.NumConnections }),
+}
+
+// ColorRule colors a field's cell when the field's value is above, or
+// below, a threshold.
+type ColorRule struct {
+	Field     string
+	Above     bool
+	Threshold float64
+	Color     string
+}
+
+// ParseColorRule parses a rule of the form <field>(>|<)<threshold>:<color>,
+// for example "qr>10:red".
+func ParseColorRule(rule string) (ColorRule, error) {
+	parsed := ColorRule{}
+	colon := strings.LastIndex(rule, ":")
+	if colon < 0 {
+		return parsed, fmt.Errorf("invalid color rule '%v', expected <field>><threshold>:<color>", rule)
+	}
+	color, ok := colorNames[strings.ToLower(strings.TrimSpace(rule[colon+1:]))]
+	if !ok {
+		return parsed, fmt.Errorf("unknown color in color rule '%v', expected one of %v",
+			rule, strings.Join(sortedKeys(colorNames), ", "))
+	}
+	parsed.Color = color
+
+	var err error
+	parsed.Field, parsed.Above, parsed.Threshold, err = parseCondition(rule[:colon])
+	if err != nil {
+		return parsed, fmt.Errorf("invalid color rule '%v': %v", rule, err)
+	}
+	return parsed, nil
+}
+
+// parseCondition parses a condition of the form <field>(>|<)<threshold>,
+// for example "qr>10", returning whether it tests for values above the
+// threshold.
+func parseCondition(condition string) (field string, above bool, threshold float64, err error) {
+	op := strings.IndexAny(condition, "<>")
+	if op < 0 {
+		return "", false, 0, fmt.Errorf("expected <field>><threshold> or <field><<threshold>")
+	}
+	field = strings.TrimSpace(condition[:op])
+	if _, ok := colorFields[field]; !ok {
+		return "", false, 0, fmt.Errorf("unknown field '%v'", field)
+	}
+	threshold, ok := parseThreshold(condition[op+1:])
+	if !ok {
+		return "", false, 0, fmt.Errorf("invalid threshold '%v'", strings.TrimSpace(condition[op+1:]))
+	}
+	return field, condition[op] == '>', threshold, nil
+}
+
+// ParseColorRules parses a list of color rules.
+func ParseColorRules(rules []string) ([]ColorRule, error) {
+	parsed := make([]ColorRule, 0, len(rules))
+	for _, rule := range rules {
+		colorRule, err := ParseColorRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, colorRule)
+	}
+	return parsed, nil
+}
+
+func parseThreshold(threshold string) (float64, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(threshold), "%"), 64)
+	return value, err == nil
+}
+
+// cellColors returns the color of each column of the line that matches a
+// rule, keyed by the column's name in colorFields.
+func cellColors(line *StatLine, rules []ColorRule) map[string]string {
+	if len(rules) == 0 {
+		return nil
+	}
+	colors := map[string]string{}
+	for _, rule := range rules {
+		field := colorFields[rule.Field]
+		value, ok := field.value(line)
+		if !ok {
+			continue
+		}
+		if (rule.Above && value > rule.Threshold) || (!rule.Above && value < rule.Threshold) {
+			colors[field.column] = rule.Color
+		}
+	}
+	return colors
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,15 +2,19 @@
 package main
 
 import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
-	"github.com/mongodb/mongo-tools/common/password"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongostat"
+	"golang.org/x/crypto/ssh/terminal"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -70,18 +74,46 @@ func main() {
 
 	// we have to check this here, otherwise the user will be prompted
 	// for a password for each discovered node
-	if opts.Auth.ShouldAskForPassword() {
-		opts.Auth.Password = password.Prompt()
+	db.AskForPassword(opts)
+
+	var assertions []mongostat.Assertion
+	if len(statOpts.Assertions) > 0 {
+		if !statOpts.Once {
+			log.Logf(log.Always, "--assert requires --once")
+			log.Logf(log.Always, "try 'mongostat --help' for more information")
+			os.Exit(util.ExitBadOptions)
+		}
+		assertions, err = mongostat.ParseAssertions(statOpts.Assertions)
+		if err != nil {
+			log.Logf(log.Always, "error parsing --assert: %v", err)
+			log.Logf(log.Always, "try 'mongostat --help' for more information")
+			os.Exit(util.ExitBadOptions)
+		}
 	}
 
 	var formatter mongostat.LineFormatter
 	if statOpts.Json {
 		formatter = &mongostat.JSONLineFormatter{}
 	} else {
+		rules := statOpts.ColorRules
+		if len(rules) == 0 {
+			rules = mongostat.DefaultColorRules
+		}
+		colorRules, err := mongostat.ParseColorRules(rules)
+		if err != nil {
+			log.Logf(log.Always, "error parsing --colorRule: %v", err)
+			log.Logf(log.Always, "try 'mongostat --help' for more information")
+			os.Exit(util.ExitBadOptions)
+		}
+		// only color output to terminals that understand ANSI escape sequences
+		if statOpts.NoColor || runtime.GOOS == "windows" || !terminal.IsTerminal(int(os.Stdout.Fd())) {
+			colorRules = nil
+		}
 		formatter = &mongostat.GridLineFormatter{
 			IncludeHeader:  !statOpts.NoHeaders,
 			HeaderInterval: 10,
 			Writer:         &text.GridWriter{ColumnPadding: 1},
+			ColorRules:     colorRules,
 		}
 	}
 
@@ -117,6 +149,16 @@ func main() {
 		Cluster:       cluster,
 	}
 
+	if statOpts.Once {
+		snapshot := stat.PollOnce(seedHosts, assertions)
+		fmt.Print(snapshot)
+		if !snapshot.OK {
+			log.Logf(log.Always, "Failed: %v", strings.Join(snapshot.Failures, "; "))
+			os.Exit(util.ExitError)
+		}
+		return
+	}
+
 	for _, v := range seedHosts {
 		stat.AddNewNode(v)
 	}
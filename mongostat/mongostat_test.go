@@ -1,7 +1,9 @@
 package mongostat
 
 import (
+	"fmt"
 	"github.com/mongodb/mongo-tools/common/testutil"
+	"github.com/mongodb/mongo-tools/common/text"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 	"time"
@@ -234,3 +236,91 @@ func TestStatLine(t *testing.T) {
 		So(statsLine.NumConnections, ShouldEqual, 5)
 	})
 }
+
+func TestColorRules(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Color rules should be parsed", t, func() {
+		rule, err := ParseColorRule("qr>10:red")
+		So(err, ShouldBeNil)
+		So(rule, ShouldResemble, ColorRule{Field: "qr", Above: true, Threshold: 10, Color: text.ColorRed})
+
+		rule, err = ParseColorRule("dirty < 2.5%:Yellow")
+		So(err, ShouldBeNil)
+		So(rule, ShouldResemble, ColorRule{Field: "dirty", Above: false, Threshold: 2.5, Color: text.ColorYellow})
+
+		for _, invalid := range []string{"qr>10", "qr>10:purple", "qr=10:red", "nope>1:red", "qr>x:red"} {
+			_, err = ParseColorRule(invalid)
+			So(err, ShouldNotBeNil)
+		}
+
+		_, err = ParseColorRules(DefaultColorRules)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("With a stat line and the default color rules", t, func() {
+		rules, err := ParseColorRules(DefaultColorRules)
+		So(err, ShouldBeNil)
+		line := &StatLine{
+			QueuedReaders:     150,
+			QueuedWriters:     2,
+			CacheDirtyPercent: 0.1,
+			CacheUsedPercent:  -1,
+		}
+
+		Convey("matching columns should take the color of the last matching rule", func() {
+			So(cellColors(line, rules), ShouldResemble, map[string]string{
+				"qr|qw": text.ColorRed,
+				"dirty": text.ColorYellow,
+			})
+		})
+
+		Convey("no cells should be colored without rules", func() {
+			So(cellColors(line, nil), ShouldBeNil)
+		})
+	})
+}
+
+func TestOnceSnapshot(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Assertions should be parsed", t, func() {
+		assertions, err := ParseAssertions([]string{"qr<10", "conn > 5"})
+		So(err, ShouldBeNil)
+		So(assertions, ShouldResemble, []Assertion{{"qr", false, 10}, {"conn", true, 5}})
+
+		for _, invalid := range []string{"qr", "nope<1", "qr<x", "insert>100"} {
+			_, err = ParseAssertions([]string{invalid})
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("With a snapshot and assertions", t, func() {
+		assertions, err := ParseAssertions([]string{"qr<10", "dirty<20"})
+		So(err, ShouldBeNil)
+		snapshot := newSnapshot()
+
+		Convey("a healthy host should be recorded with its fields", func() {
+			snapshot.add("a:27017", &StatLine{QueuedReaders: 3, NumConnections: 12, CacheDirtyPercent: -1,
+				CacheUsedPercent: -1, Virtual: -1, Resident: -1, ReplSetName: "rs0", NodeType: "PRI"}, assertions)
+			So(snapshot.OK, ShouldBeTrue)
+			So(snapshot.Hosts["a:27017"]["qr"], ShouldEqual, 3)
+			So(snapshot.Hosts["a:27017"]["conn"], ShouldEqual, 12)
+			So(snapshot.Hosts["a:27017"]["repl"], ShouldEqual, "PRI")
+			_, hasDirty := snapshot.Hosts["a:27017"]["dirty"]
+			So(hasDirty, ShouldBeFalse)
+		})
+
+		Convey("failed assertions and unreachable hosts should fail it", func() {
+			snapshot.add("a:27017", &StatLine{QueuedReaders: 30, CacheDirtyPercent: 0.05}, assertions)
+			snapshot.add("b:27017", &StatLine{Error: fmt.Errorf("no reachable servers")}, assertions)
+			So(snapshot.OK, ShouldBeFalse)
+			So(snapshot.Failures, ShouldResemble, []string{
+				"a:27017: qr is 30, not below 10",
+				"b:27017: no reachable servers",
+			})
+			So(snapshot.Hosts["b:27017"]["ok"], ShouldEqual, false)
+			So(snapshot.String(), ShouldContainSubstring, `"ok": false`)
+		})
+	})
+}
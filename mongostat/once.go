@@ -0,0 +1,171 @@
+package mongostat
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/log"
+	"sort"
+	"strings"
+)
+
+// snapshotFields are the fields of a --once snapshot. Rates such as the
+// opcounters take two polls to measure, so only the fields a single
+// serverStatus gives are included.
+var snapshotFields = []string{"conn", "qr", "qw", "ar", "aw", "dirty", "used", "vsize", "res"}
+
+// Assertion is a condition a host's --once snapshot must meet, such as
+// "qr<10", for mongostat to succeed.
+type Assertion struct {
+	Field     string
+	Above     bool
+	Threshold float64
+}
+
+// ParseAssertions parses the --assert conditions, each of the form
+// <field>(>|<)<threshold>.
+func ParseAssertions(assertions []string) ([]Assertion, error) {
+	parsed := make([]Assertion, 0, len(assertions))
+	for _, assertion := range assertions {
+		field, above, threshold, err := parseCondition(assertion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid assertion '%v': %v", assertion, err)
+		}
+		if !isSnapshotField(field) {
+			return nil, fmt.Errorf("invalid assertion '%v': %v is a rate, which a single poll can't measure; "+
+				"expected one of %v", assertion, field, strings.Join(snapshotFields, ", "))
+		}
+		parsed = append(parsed, Assertion{Field: field, Above: above, Threshold: threshold})
+	}
+	return parsed, nil
+}
+
+func isSnapshotField(field string) bool {
+	for _, name := range snapshotFields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns a description of how the line fails the assertion, or ""
+// if it meets it. A line without a value for the field meets it.
+func (assertion Assertion) check(line *StatLine) string {
+	value, ok := colorFields[assertion.Field].value(line)
+	if !ok {
+		return ""
+	}
+	if assertion.Above && value <= assertion.Threshold {
+		return fmt.Sprintf("%v is %v, not above %v", assertion.Field, value, assertion.Threshold)
+	}
+	if !assertion.Above && value >= assertion.Threshold {
+		return fmt.Sprintf("%v is %v, not below %v", assertion.Field, value, assertion.Threshold)
+	}
+	return ""
+}
+
+// Snapshot is the --once report of the hosts polled: the fields of each,
+// or the error polling it, and the assertions they fail.
+type Snapshot struct {
+	OK       bool                              `json:"ok"`
+	Hosts    map[string]map[string]interface{} `json:"hosts"`
+	Failures []string                          `json:"failures,omitempty"`
+}
+
+// newSnapshot returns an empty, healthy snapshot.
+func newSnapshot() *Snapshot {
+	return &Snapshot{OK: true, Hosts: map[string]map[string]interface{}{}}
+}
+
+// add records the line polled from a host, failing the snapshot if the
+// host was unreachable or fails an assertion.
+func (snapshot *Snapshot) add(host string, line *StatLine, assertions []Assertion) {
+	if line.Error != nil {
+		snapshot.Hosts[host] = map[string]interface{}{"ok": false, "error": line.Error.Error()}
+		snapshot.fail(fmt.Sprintf("%v: %v", host, line.Error))
+		return
+	}
+	fields := map[string]interface{}{"ok": true, "mongos": line.IsMongos, "storageEngine": line.StorageEngine}
+	for _, name := range snapshotFields {
+		if value, ok := colorFields[name].value(line); ok {
+			fields[name] = value
+		}
+	}
+	if line.ReplSetName != "" {
+		fields["set"] = line.ReplSetName
+	}
+	if line.NodeType != "" {
+		fields["repl"] = line.NodeType
+	}
+	snapshot.Hosts[host] = fields
+	for _, assertion := range assertions {
+		if failure := assertion.check(line); failure != "" {
+			snapshot.fail(fmt.Sprintf("%v: %v", host, failure))
+		}
+	}
+}
+
+func (snapshot *Snapshot) fail(failure string) {
+	snapshot.OK = false
+	snapshot.Failures = append(snapshot.Failures, failure)
+}
+
+// PollOnce polls each of the hosts exactly once, along with the replica set
+// members they report with --discover, and returns a snapshot of them.
+func (mstat *MongoStat) PollOnce(hosts []string, assertions []Assertion) *Snapshot {
+	snapshot := newSnapshot()
+	var discover chan string
+	if mstat.StatOptions.Discover {
+		discover = make(chan string, 128)
+	}
+	polled := map[string]bool{}
+	pending := append([]string{}, hosts...)
+	for len(pending) > 0 {
+		host := pending[0]
+		pending = pending[1:]
+		if polled[host] {
+			continue
+		}
+		polled[host] = true
+		snapshot.add(host, mstat.pollHost(host, discover), assertions)
+
+		// collect the members the host reported, without blocking
+		for discovering := discover != nil; discovering; {
+			select {
+			case member := <-discover:
+				pending = append(pending, member)
+			default:
+				discovering = false
+			}
+		}
+	}
+	sort.Strings(snapshot.Failures)
+	return snapshot
+}
+
+// pollHost runs serverStatus on the host once, returning a line of the
+// fields it gives, or of the error if it failed.
+func (mstat *MongoStat) pollHost(host string, discover chan string) *StatLine {
+	log.Logf(log.DebugLow, "polling server: %v", host)
+	node, err := NewNodeMonitor(*mstat.Options, host, mstat.StatOptions.All)
+	if err != nil {
+		return &StatLine{Key: host, Host: host, Error: err}
+	}
+	defer node.sessionProvider.Close()
+	if line := node.Poll(discover, mstat.StatOptions.All, false, 1); line != nil {
+		// only an error gives a line on the first poll
+		return line
+	}
+	// rates are measured between two polls: compared to itself, the only
+	// poll gives the fields that don't need one
+	return NewStatLine(*node.LastStatus, *node.LastStatus, host, mstat.StatOptions.All, 1)
+}
+
+// String returns the snapshot as indented JSON.
+func (snapshot *Snapshot) String() string {
+	out, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Sprintf(`{"json error": "%v"}`, err.Error())
+	}
+	return string(out) + "\n"
+}
@@ -14,6 +14,14 @@ type StatOptions struct {
 	Http      bool `long:"http" description:"use HTTP instead of raw db connection"`
 	All       bool `long:"all" description:"all optional fields"`
 	Json      bool `long:"json" description:"output as JSON rather than a formatted table"`
+
+	// ColorRules replace the default rules for coloring cells on a terminal
+	ColorRules []string `long:"colorRule" value-name:"<field><op><threshold>:<color>" description:"color a cell when its value is above (>) or below (<) a threshold, e.g. --colorRule 'qr>10:red'; may be repeated, with later rules taking precedence, and replaces the default rules. Fields: insert, query, update, delete, getmore, command, dirty, used, flushes, faults, vsize, res, locked, qr, qw, ar, aw, netIn, netOut, conn. Colors: red, yellow, green, blue, magenta, cyan"`
+	NoColor    bool     `long:"noColor" description:"don't color cells, even when writing to a terminal"`
+
+	// Once and Assertions make mongostat a health check
+	Once       bool     `long:"once" description:"poll each host once, print a JSON snapshot of the fields a single poll gives (conn, qr, qw, ar, aw, dirty, used, vsize, res), and exit with an error if any host is unreachable or fails an --assert"`
+	Assertions []string `long:"assert" value-name:"<field><op><threshold>" description:"with --once, fail unless each host's field is above (>) or below (<) a threshold, e.g. --assert 'qr<10'; may be repeated"`
 }
 
 // Name returns a human-readable group name for mongostat options.
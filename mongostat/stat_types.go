@@ -500,6 +500,9 @@ type GridLineFormatter struct {
 
 	// Grid writer
 	Writer *text.GridWriter
+
+	// Rules for coloring cells; no cells are colored if empty
+	ColorRules []ColorRule
 }
 
 // describes which sets of columns are printable in a StatLine
@@ -576,29 +579,30 @@ func (glf *GridLineFormatter) FormatLines(lines []StatLine, index int, discover
 			glf.Writer.Feed(line.Error.Error())
 			continue
 		}
+		colors := cellColors(&line, glf.ColorRules)
 
 		// Write the opcount columns (always active)
-		glf.Writer.WriteCell(formatOpcount(line.Insert, line.InsertR, false))
-		glf.Writer.WriteCell(formatOpcount(line.Query, line.QueryR, false))
-		glf.Writer.WriteCell(formatOpcount(line.Update, line.UpdateR, false))
-		glf.Writer.WriteCell(formatOpcount(line.Delete, line.DeleteR, false))
-		glf.Writer.WriteCell(fmt.Sprintf("%v", line.GetMore))
-		glf.Writer.WriteCell(formatOpcount(line.Command, line.CommandR, true))
+		glf.Writer.WriteColoredCell(formatOpcount(line.Insert, line.InsertR, false), colors["insert"])
+		glf.Writer.WriteColoredCell(formatOpcount(line.Query, line.QueryR, false), colors["query"])
+		glf.Writer.WriteColoredCell(formatOpcount(line.Update, line.UpdateR, false), colors["update"])
+		glf.Writer.WriteColoredCell(formatOpcount(line.Delete, line.DeleteR, false), colors["delete"])
+		glf.Writer.WriteColoredCell(fmt.Sprintf("%v", line.GetMore), colors["getmore"])
+		glf.Writer.WriteColoredCell(formatOpcount(line.Command, line.CommandR, true), colors["command"])
 
 		if lineFlags&WTOnly > 0 {
 			if line.CacheDirtyPercent < 0 {
 				glf.Writer.WriteCell("")
 			} else {
-				glf.Writer.WriteCell(fmt.Sprintf("%.1f", line.CacheDirtyPercent*100))
+				glf.Writer.WriteColoredCell(fmt.Sprintf("%.1f", line.CacheDirtyPercent*100), colors["dirty"])
 			}
 			if line.CacheUsedPercent < 0 {
 				glf.Writer.WriteCell("")
 			} else {
-				glf.Writer.WriteCell(fmt.Sprintf("%.1f", line.CacheUsedPercent*100))
+				glf.Writer.WriteColoredCell(fmt.Sprintf("%.1f", line.CacheUsedPercent*100), colors["used"])
 			}
 		}
 
-		glf.Writer.WriteCell(fmt.Sprintf("%v", line.Flushes))
+		glf.Writer.WriteColoredCell(fmt.Sprintf("%v", line.Flushes), colors["flushes"])
 
 		// Columns for flushes + mapped only show up if mmap columns are active
 		if lineFlags&MMAPOnly > 0 {
@@ -612,8 +616,8 @@ func (glf *GridLineFormatter) FormatLines(lines []StatLine, index int, discover
 		}
 
 		// Columns for Virtual and Resident are always active
-		glf.Writer.WriteCell(text.FormatMegabyteAmount(int64(line.Virtual)))
-		glf.Writer.WriteCell(text.FormatMegabyteAmount(int64(line.Resident)))
+		glf.Writer.WriteColoredCell(text.FormatMegabyteAmount(int64(line.Virtual)), colors["vsize"])
+		glf.Writer.WriteColoredCell(text.FormatMegabyteAmount(int64(line.Resident)), colors["res"])
 
 		if lineFlags&MMAPOnly > 0 {
 			if lineFlags&AllOnly > 0 {
@@ -624,7 +628,7 @@ func (glf *GridLineFormatter) FormatLines(lines []StatLine, index int, discover
 				glf.Writer.WriteCell(nonMappedVal)
 			}
 			if mmap {
-				glf.Writer.WriteCell(fmt.Sprintf("%v", line.Faults))
+				glf.Writer.WriteColoredCell(fmt.Sprintf("%v", line.Faults), colors["faults"])
 			} else {
 				glf.Writer.WriteCell("n/a")
 			}
@@ -635,19 +639,19 @@ func (glf *GridLineFormatter) FormatLines(lines []StatLine, index int, discover
 			if line.HighestLocked != nil && !line.IsMongos {
 				lockCell := fmt.Sprintf("%v:%.1f", line.HighestLocked.DBName,
 					line.HighestLocked.Percentage) + "%"
-				glf.Writer.WriteCell(lockCell)
+				glf.Writer.WriteColoredCell(lockCell, colors["locked"])
 			} else {
 				//don't write any lock status for mongos nodes
 				glf.Writer.WriteCell("")
 			}
 		}
-		glf.Writer.WriteCell(fmt.Sprintf("%v|%v", line.QueuedReaders, line.QueuedWriters))
-		glf.Writer.WriteCell(fmt.Sprintf("%v|%v", line.ActiveReaders, line.ActiveWriters))
+		glf.Writer.WriteColoredCell(fmt.Sprintf("%v|%v", line.QueuedReaders, line.QueuedWriters), colors["qr|qw"])
+		glf.Writer.WriteColoredCell(fmt.Sprintf("%v|%v", line.ActiveReaders, line.ActiveWriters), colors["ar|aw"])
 
-		glf.Writer.WriteCell(text.FormatBits(line.NetIn))
-		glf.Writer.WriteCell(text.FormatBits(line.NetOut))
+		glf.Writer.WriteColoredCell(text.FormatBits(line.NetIn), colors["netIn"])
+		glf.Writer.WriteColoredCell(text.FormatBits(line.NetOut), colors["netOut"])
 
-		glf.Writer.WriteCell(fmt.Sprintf("%v", line.NumConnections))
+		glf.Writer.WriteColoredCell(fmt.Sprintf("%v", line.NumConnections), colors["conn"])
 		if discover || lineFlags&Repl > 0 { //only show these fields when in discover or repl mode.
 			glf.Writer.WriteCell(line.ReplSetName)
 			glf.Writer.WriteCell(line.NodeType)
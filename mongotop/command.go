@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2/bson"
 	"sort"
 	"time"
 )
@@ -16,6 +17,9 @@ type FormattableDiff interface {
 	JSON() string
 	// Generate a table-like representation which can be printed to a terminal
 	Grid() string
+	// Generate a document per namespace, tagged with the monitored host, for
+	// storing in a collection
+	Documents(host string) []interface{}
 }
 
 // ServerStatus represents the results of the "serverStatus" command.
@@ -165,6 +169,30 @@ func (td TopDiff) JSON() string {
 	return string(bytes)
 }
 
+// Documents returns a document for each namespace in the TopDiff, with
+// times in milliseconds.
+func (td TopDiff) Documents(host string) []interface{} {
+	namespaces := make([]string, 0, len(td.Totals))
+	for ns := range td.Totals {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	docs := make([]interface{}, 0, len(namespaces))
+	for _, ns := range namespaces {
+		diff := td.Totals[ns]
+		docs = append(docs, bson.D{
+			{"time", td.Time},
+			{"host", host},
+			{"ns", ns},
+			{"total", diff.Total},
+			{"read", diff.Read},
+			{"write", diff.Write},
+		})
+	}
+	return docs
+}
+
 // JSON returns a JSON representation of the ServerStatusDiff.
 func (ssd ServerStatusDiff) JSON() string {
 	bytes, err := json.Marshal(ssd)
@@ -205,6 +233,30 @@ func (ssd ServerStatusDiff) Grid() string {
 	return buf.String()
 }
 
+// Documents returns a document for each database in the ServerStatusDiff,
+// with lock times in milliseconds.
+func (ssd ServerStatusDiff) Documents(host string) []interface{} {
+	dbs := make([]string, 0, len(ssd.Totals))
+	for db := range ssd.Totals {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+
+	docs := make([]interface{}, 0, len(dbs))
+	for _, db := range dbs {
+		diff := ssd.Totals[db]
+		docs = append(docs, bson.D{
+			{"time", ssd.Time},
+			{"host", host},
+			{"db", db},
+			{"total", diff.Read + diff.Write},
+			{"read", diff.Read},
+			{"write", diff.Write},
+		})
+	}
+	return docs
+}
+
 // Diff takes an older ServerStatus sample, and produces a ServerStatusDiff
 // representing the deltas of each metric between the two samples.
 func (ss ServerStatus) Diff(previous ServerStatus) ServerStatusDiff {
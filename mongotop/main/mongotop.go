@@ -6,6 +6,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongotop"
 	"os"
@@ -23,6 +24,8 @@ func main() {
 	// add mongotop-specific options
 	outputOpts := &mongotop.Output{}
 	opts.AddOptions(outputOpts)
+	storeOpts := &mongotop.Store{}
+	opts.AddOptions(storeOpts)
 
 	args, err := opts.Parse()
 	if err != nil {
@@ -60,6 +63,18 @@ func main() {
 		os.Exit(util.ExitBadOptions)
 	}
 
+	var storeSize int64
+	if storeOpts.StoreTo != "" {
+		storeSize, err = text.ParseByteAmount(storeOpts.StoreSize)
+		if err != nil || storeSize <= 0 {
+			log.Logf(log.Always, "invalid value for --storeSize: %v", storeOpts.StoreSize)
+			os.Exit(util.ExitBadOptions)
+		}
+	} else if storeOpts.StoreHost != "" {
+		log.Logf(log.Always, "--storeHost requires --storeTo")
+		os.Exit(util.ExitBadOptions)
+	}
+
 	if opts.Auth.Username != "" && opts.Auth.Source == "" && !opts.Auth.RequiresExternalDB() {
 		log.Logf(log.Always, "--authenticationDatabase is required when authenticating against a non $external database")
 		os.Exit(util.ExitBadOptions)
@@ -100,6 +115,28 @@ func main() {
 		Sleeptime:       time.Duration(sleeptime) * time.Second,
 	}
 
+	// set up the collection to store stats into, possibly on another server
+	if storeOpts.StoreTo != "" {
+		storeProvider := sessionProvider
+		if storeOpts.StoreHost != "" {
+			storeToolOpts := *opts
+			_, storeSetName := util.ParseConnectionString(storeOpts.StoreHost)
+			storeToolOpts.Connection = &options.Connection{Host: storeOpts.StoreHost}
+			storeToolOpts.Direct = (storeSetName == "")
+			storeToolOpts.ReplicaSetName = storeSetName
+			storeProvider, err = db.NewSessionProvider(storeToolOpts)
+			if err != nil {
+				log.Logf(log.Always, "error connecting to store host: %v", err)
+				os.Exit(util.ExitError)
+			}
+		}
+		top.StatsStore, err = mongotop.NewStatsStore(storeProvider, storeOpts.StoreTo, storeSize)
+		if err != nil {
+			log.Logf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitError)
+		}
+	}
+
 	// kick it off
 	if err := top.Run(); err != nil {
 		log.Logf(log.Always, "Failed: %v", err)
@@ -24,8 +24,12 @@ type MongoTop struct {
 	// Length of time to sleep between each polling.
 	Sleeptime time.Duration
 
+	// If set, each diff is also inserted into this store
+	StatsStore *StatsStore
+
 	previousServerStatus *ServerStatus
 	previousTop          *Top
+	previousOplogWindow  *OplogWindow
 }
 
 func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
@@ -99,6 +103,17 @@ func (mt *MongoTop) Run() error {
 			time.Sleep(mt.Sleeptime)
 		}
 
+		var window *OplogWindow
+		if mt.OutputOptions.Oplog {
+			window, err = mt.sampleOplogWindow()
+			if err != nil {
+				if !hasData {
+					return err
+				}
+				log.Logf(log.Always, "Error: %v\n", err)
+			}
+		}
+
 		// if this is the first time and the connection is successful, print
 		// the connection message
 		if !hasData && !mt.OutputOptions.Json {
@@ -113,6 +128,18 @@ func (mt *MongoTop) Run() error {
 			} else {
 				fmt.Println(diff.Grid())
 			}
+			if mt.StatsStore != nil {
+				if err := mt.StatsStore.Insert(diff, connURL); err != nil {
+					log.Logf(log.Always, "Error: %v\n", err)
+				}
+			}
+		}
+		if window != nil {
+			if mt.OutputOptions.Json {
+				fmt.Println(window.JSON())
+			} else {
+				fmt.Println(window.Grid())
+			}
 		}
 		time.Sleep(mt.Sleeptime)
 	}
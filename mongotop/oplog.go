@@ -0,0 +1,161 @@
+package mongotop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// OplogWindow is a sample of a replica set member's oplog window: the span
+// of time its oplog holds, how fast that span is shrinking, and how much of
+// it is left once the most lagged secondary's lag is taken out.
+type OplogWindow struct {
+	// First and Last are the times of the oldest and newest oplog entries
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+
+	// WindowSecs is the time between the first and last entries
+	WindowSecs int64 `json:"windowSecs"`
+
+	// ShrinkRate is the number of seconds the window lost per second since
+	// the previous sample, negative when it grew; nil on the first sample
+	ShrinkRate *float64 `json:"shrinkRate,omitempty"`
+
+	// LagSecs is the replication lag of the most lagged secondary, and
+	// HeadroomSecs what is left of the window after it: how far that
+	// secondary can fall further behind before it needs a resync
+	LagSecs      int64 `json:"lagSecs"`
+	HeadroomSecs int64 `json:"headroomSecs"`
+
+	Time time.Time `json:"time"`
+}
+
+// oplogEntryTime is the timestamp of an oplog entry.
+type oplogEntryTime struct {
+	Timestamp bson.MongoTimestamp `bson:"ts"`
+}
+
+// replSetStatus holds the parts of the replSetGetStatus result used to
+// measure replication lag.
+type replSetStatus struct {
+	Members []struct {
+		Name       string    `bson:"name"`
+		StateStr   string    `bson:"stateStr"`
+		OptimeDate time.Time `bson:"optimeDate"`
+	} `bson:"members"`
+}
+
+// timestampTime returns the time of the seconds part of an oplog timestamp.
+func timestampTime(ts bson.MongoTimestamp) time.Time {
+	return time.Unix(int64(ts>>32), 0)
+}
+
+// replicationLag returns the lag of the most lagged secondary behind the
+// primary, or behind the most recent member if there is no primary.
+func (status replSetStatus) replicationLag() time.Duration {
+	var newest time.Time
+	for _, member := range status.Members {
+		if member.StateStr == "PRIMARY" {
+			newest = member.OptimeDate
+			break
+		}
+		if member.OptimeDate.After(newest) {
+			newest = member.OptimeDate
+		}
+	}
+	var lag time.Duration
+	for _, member := range status.Members {
+		if member.StateStr == "SECONDARY" && newest.Sub(member.OptimeDate) > lag {
+			lag = newest.Sub(member.OptimeDate)
+		}
+	}
+	return lag
+}
+
+// newOplogWindow returns the sample of an oplog spanning first to last, with
+// the given replication lag, and its shrink rate since the previous sample.
+func newOplogWindow(first, last time.Time, lag time.Duration, now time.Time, previous *OplogWindow) *OplogWindow {
+	window := &OplogWindow{
+		First:      first,
+		Last:       last,
+		WindowSecs: int64(last.Sub(first) / time.Second),
+		LagSecs:    int64(lag / time.Second),
+		Time:       now,
+	}
+	window.HeadroomSecs = window.WindowSecs - window.LagSecs
+	if previous != nil {
+		if elapsed := now.Sub(previous.Time).Seconds(); elapsed > 0 {
+			rate := float64(previous.WindowSecs-window.WindowSecs) / elapsed
+			window.ShrinkRate = &rate
+		}
+	}
+	return window
+}
+
+// sampleOplogWindow reads the first and last entries of the member's oplog,
+// and the replication lag of its set.
+func (mt *MongoTop) sampleOplogWindow() (*OplogWindow, error) {
+	session, err := mt.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	oplog := session.DB("local").C("oplog.rs")
+	var first, last oplogEntryTime
+	err = oplog.Find(nil).Select(bson.M{"ts": 1}).Sort("$natural").One(&first)
+	if err == nil {
+		err = oplog.Find(nil).Select(bson.M{"ts": 1}).Sort("-$natural").One(&last)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the oplog window, which requires a replica set member: %v", err)
+	}
+	status := replSetStatus{}
+	if err = session.DB("admin").Run(bson.D{{"replSetGetStatus", 1}}, &status); err != nil {
+		return nil, fmt.Errorf("error getting the replication lag: %v", err)
+	}
+	window := newOplogWindow(timestampTime(first.Timestamp), timestampTime(last.Timestamp),
+		status.replicationLag(), time.Now(), mt.previousOplogWindow)
+	mt.previousOplogWindow = window
+	return window, nil
+}
+
+// Grid returns a tabular representation of the OplogWindow.
+func (window *OplogWindow) Grid() string {
+	buf := &bytes.Buffer{}
+	out := &text.GridWriter{ColumnPadding: 4}
+	out.WriteCells("oplog", "first", "last", "window", "shrinking", "lag", "headroom")
+	out.EndRow()
+	shrinking := ""
+	if window.ShrinkRate != nil {
+		shrinking = fmt.Sprintf("%.2fs/s", *window.ShrinkRate)
+	}
+	out.WriteCells("",
+		window.First.Format("2006-01-02T15:04:05Z07:00"),
+		window.Last.Format("2006-01-02T15:04:05Z07:00"),
+		formatSeconds(window.WindowSecs),
+		shrinking,
+		formatSeconds(window.LagSecs),
+		formatSeconds(window.HeadroomSecs))
+	out.EndRow()
+	out.Flush(buf)
+	return buf.String()
+}
+
+// JSON returns a JSON representation of the OplogWindow, as an "oplog"
+// document.
+func (window *OplogWindow) JSON() string {
+	bytes, err := json.Marshal(map[string]*OplogWindow{"oplog": window})
+	if err != nil {
+		panic(err)
+	}
+	return string(bytes)
+}
+
+// formatSeconds formats a number of seconds as a duration such as 26h3m0s.
+func formatSeconds(seconds int64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
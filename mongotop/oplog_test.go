@@ -0,0 +1,94 @@
+package mongotop
+
+import (
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+// replSetStatusOf returns the replSetGetStatus result listing the members.
+func replSetStatusOf(members ...bson.M) replSetStatus {
+	data, err := bson.Marshal(bson.M{"members": members})
+	So(err, ShouldBeNil)
+	status := replSetStatus{}
+	So(bson.Unmarshal(data, &status), ShouldBeNil)
+	return status
+}
+
+func TestOplogWindow(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	first := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := first.Add(10 * time.Hour)
+
+	Convey("The first sample should measure the window and headroom, without a shrink rate", t, func() {
+		window := newOplogWindow(first, first.Add(8*time.Hour), 30*time.Minute, now, nil)
+		So(window.WindowSecs, ShouldEqual, 8*3600)
+		So(window.LagSecs, ShouldEqual, 1800)
+		So(window.HeadroomSecs, ShouldEqual, 8*3600-1800)
+		So(window.ShrinkRate, ShouldBeNil)
+	})
+
+	Convey("A lag longer than the window should leave negative headroom", t, func() {
+		window := newOplogWindow(first, first.Add(time.Hour), 2*time.Hour, now, nil)
+		So(window.HeadroomSecs, ShouldEqual, -3600)
+	})
+
+	Convey("With a previous sample", t, func() {
+		previous := newOplogWindow(first, first.Add(8*time.Hour), 0, now, nil)
+
+		Convey("the shrink rate should be the window lost per second since", func() {
+			window := newOplogWindow(first.Add(20*time.Second), first.Add(8*time.Hour+10*time.Second), 0,
+				now.Add(10*time.Second), previous)
+			So(window.ShrinkRate, ShouldNotBeNil)
+			So(*window.ShrinkRate, ShouldEqual, 1)
+		})
+
+		Convey("a growing window should shrink at a negative rate", func() {
+			window := newOplogWindow(first, first.Add(8*time.Hour+20*time.Second), 0,
+				now.Add(10*time.Second), previous)
+			So(*window.ShrinkRate, ShouldEqual, -2)
+		})
+
+		Convey("no time having passed should give no shrink rate", func() {
+			window := newOplogWindow(first, first.Add(8*time.Hour), 0, now, previous)
+			So(window.ShrinkRate, ShouldBeNil)
+		})
+	})
+}
+
+func TestReplicationLag(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	Convey("The lag should be that of the most lagged secondary behind the primary", t, func() {
+		status := replSetStatusOf(
+			bson.M{"name": "a", "stateStr": "SECONDARY", "optimeDate": now.Add(-5 * time.Second)},
+			bson.M{"name": "b", "stateStr": "PRIMARY", "optimeDate": now},
+			bson.M{"name": "c", "stateStr": "SECONDARY", "optimeDate": now.Add(-time.Minute)},
+			bson.M{"name": "d", "stateStr": "ARBITER"},
+		)
+		So(status.replicationLag(), ShouldEqual, time.Minute)
+	})
+
+	Convey("Without a primary, the lag should be behind the most recent member", t, func() {
+		status := replSetStatusOf(
+			bson.M{"name": "a", "stateStr": "SECONDARY", "optimeDate": now},
+			bson.M{"name": "b", "stateStr": "SECONDARY", "optimeDate": now.Add(-10 * time.Second)},
+		)
+		So(status.replicationLag(), ShouldEqual, 10*time.Second)
+	})
+
+	Convey("A secondary missing from the status should not count", t, func() {
+		status := replSetStatusOf(
+			bson.M{"name": "b", "stateStr": "PRIMARY", "optimeDate": now},
+		)
+		So(status.replicationLag(), ShouldEqual, 0)
+		So(replSetStatus{}.replicationLag(), ShouldEqual, 0)
+	})
+}
@@ -11,9 +11,23 @@ type Output struct {
 	Locks    bool `long:"locks" description:"report on use of per-database locks"`
 	RowCount int  `long:"rowcount" short:"n" description:"number of stats lines to print (0 for indefinite)"`
 	Json     bool `long:"json" description:"format output as JSON"`
+	Oplog    bool `long:"oplog" description:"also report the oplog window of the replica set member: the times of its first and last entries, how fast the window is shrinking, the lag of the most lagged secondary and the headroom left after it; printed after each interval's stats, as an \"oplog\" document with --json"`
 }
 
 // Name returns a human-readable group name for output options.
 func (_ *Output) Name() string {
 	return "output"
 }
+
+// Store defines the set of options for saving each interval's stats into a
+// MongoDB collection.
+type Store struct {
+	StoreTo   string `long:"storeTo" value-name:"<db>.<collection>" description:"also insert each interval's per-namespace stats as documents into this capped collection, which is created if needed"`
+	StoreHost string `long:"storeHost" value-name:"<hostname>" description:"server or replica set holding the --storeTo collection, using the same credentials (defaults to the server being monitored)"`
+	StoreSize string `long:"storeSize" value-name:"<size>" default:"100MB" default-mask:"-" description:"size of the --storeTo capped collection when it is created (defaults to 100MB)"`
+}
+
+// Name returns a human-readable group name for store options.
+func (_ *Store) Name() string {
+	return "store"
+}
@@ -0,0 +1,71 @@
+package mongotop
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+)
+
+// StatsStore inserts the stats of each interval into a capped collection,
+// one document per namespace, so that they can be queried later.
+type StatsStore struct {
+	sessionProvider *db.SessionProvider
+	db              string
+	collection      string
+}
+
+// NewStatsStore returns a store for the given namespace, creating it as a
+// capped collection of maxBytes if it does not exist yet.
+func NewStatsStore(sessionProvider *db.SessionProvider, namespace string, maxBytes int64) (*StatsStore, error) {
+	dbName, collection, err := util.SplitAndValidateNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if collection == "" {
+		return nil, fmt.Errorf("--storeTo must be a namespace of the form <db>.<collection>")
+	}
+
+	collections, err := sessionProvider.CollectionNames(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("error listing collections in %v: %v", dbName, err)
+	}
+	if !util.StringSliceContains(collections, collection) {
+		session, err := sessionProvider.GetSession()
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+		log.Logf(log.Info, "creating capped collection %v of %v bytes", namespace, maxBytes)
+		err = session.DB(dbName).C(collection).Create(&mgo.CollectionInfo{Capped: true, MaxBytes: int(maxBytes)})
+		if err != nil {
+			return nil, fmt.Errorf("error creating %v: %v", namespace, err)
+		}
+	}
+
+	return &StatsStore{
+		sessionProvider: sessionProvider,
+		db:              dbName,
+		collection:      collection,
+	}, nil
+}
+
+// Insert writes a document for each namespace in the diff. The monitored
+// host is recorded in each document, so that several mongotops can share a
+// collection.
+func (store *StatsStore) Insert(diff FormattableDiff, host string) error {
+	docs := diff.Documents(host)
+	if len(docs) == 0 {
+		return nil
+	}
+	session, err := store.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if err = session.DB(store.db).C(store.collection).Insert(docs...); err != nil {
+		return fmt.Errorf("error inserting stats into %v.%v: %v", store.db, store.collection, err)
+	}
+	return nil
+}
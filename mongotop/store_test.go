@@ -0,0 +1,138 @@
+package mongotop
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+const storeTestDB = "mongotop_store_test"
+
+func TestStatsDocuments(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	now := time.Now()
+
+	Convey("A TopDiff should give a document per namespace, sorted by namespace, with the time and count of each lock", t, func() {
+		diff := TopDiff{
+			Totals: map[string]NSTopInfo{
+				"test.b": {Total: TopField{Time: 30}, Read: TopField{Time: 10}, Write: TopField{Time: 20}},
+				"test.a": {Total: TopField{Time: 5}, Read: TopField{Time: 5}},
+			},
+			Time: now,
+		}
+		So(diff.Documents("localhost:27017"), ShouldResemble, []interface{}{
+			bson.D{{"time", now}, {"host", "localhost:27017"}, {"ns", "test.a"},
+				{"total", TopField{Time: 5}}, {"read", TopField{Time: 5}}, {"write", TopField{}}},
+			bson.D{{"time", now}, {"host", "localhost:27017"}, {"ns", "test.b"},
+				{"total", TopField{Time: 30}}, {"read", TopField{Time: 10}}, {"write", TopField{Time: 20}}},
+		})
+	})
+
+	Convey("A ServerStatusDiff should give a document per database, with read and write summed", t, func() {
+		diff := ServerStatusDiff{
+			Totals: map[string]LockDelta{"test": {Read: 3, Write: 4}},
+			Time:   now,
+		}
+		So(diff.Documents("localhost:27017"), ShouldResemble, []interface{}{
+			bson.D{{"time", now}, {"host", "localhost:27017"}, {"db", "test"},
+				{"total", int64(7)}, {"read", int64(3)}, {"write", int64(4)}},
+		})
+	})
+
+	Convey("An empty diff should give no documents", t, func() {
+		So(TopDiff{}.Documents("localhost"), ShouldBeEmpty)
+	})
+}
+
+func TestStatsStoreNamespace(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("--storeTo should be refused", t, func() {
+
+		Convey("without a collection", func() {
+			_, err := NewStatsStore(nil, "stats", 1024)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "<db>.<collection>")
+		})
+
+		Convey("for an invalid namespace", func() {
+			_, err := NewStatsStore(nil, "my db.stats", 1024)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestStatsStoreInsert(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a session to a test server", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		sessionProvider, err := db.NewSessionProvider(options.ToolOptions{
+			Connection: &options.Connection{
+				Host: "localhost",
+				Port: db.DefaultTestPort,
+			},
+			Auth: &auth,
+			SSL:  &ssl,
+		})
+		So(err, ShouldBeNil)
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		So(session.DB(storeTestDB).DropDatabase(), ShouldBeNil)
+
+		Convey("a missing --storeTo collection should be created capped", func() {
+			_, err := NewStatsStore(sessionProvider, storeTestDB+".stats", 4096)
+			So(err, ShouldBeNil)
+			var stats struct {
+				Capped  bool `bson:"capped"`
+				MaxSize int  `bson:"maxSize"`
+			}
+			So(session.DB(storeTestDB).Run(bson.D{{"collStats", "stats"}}, &stats), ShouldBeNil)
+			So(stats.Capped, ShouldBeTrue)
+			So(stats.MaxSize, ShouldEqual, 4096)
+
+			Convey("and reused by a second store", func() {
+				_, err := NewStatsStore(sessionProvider, storeTestDB+".stats", 4096)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("each interval should be inserted as a document per namespace", func() {
+			store, err := NewStatsStore(sessionProvider, storeTestDB+".stats", 4096)
+			So(err, ShouldBeNil)
+			diff := TopDiff{
+				Totals: map[string]NSTopInfo{
+					"test.a": {Total: TopField{Time: 5}, Read: TopField{Time: 5}},
+					"test.b": {Total: TopField{Time: 30}, Read: TopField{Time: 10}, Write: TopField{Time: 20}},
+				},
+				Time: time.Now(),
+			}
+			So(store.Insert(diff, "localhost:27017"), ShouldBeNil)
+			So(store.Insert(TopDiff{}, "localhost:27017"), ShouldBeNil)
+
+			var docs []bson.M
+			err = session.DB(storeTestDB).C("stats").Find(nil).Sort("ns").All(&docs)
+			So(err, ShouldBeNil)
+			So(len(docs), ShouldEqual, 2)
+			So(docs[0]["host"], ShouldEqual, "localhost:27017")
+			So(docs[0]["ns"], ShouldEqual, "test.a")
+			So(docs[1]["ns"], ShouldEqual, "test.b")
+			So(docs[1]["total"], ShouldResemble, bson.M{"time": 30, "count": 0})
+			So(docs[1]["write"], ShouldResemble, bson.M{"time": 20, "count": 0})
+		})
+
+		Reset(func() {
+			session.DB(storeTestDB).DropDatabase()
+			session.Close()
+		})
+	})
+}